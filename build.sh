@@ -13,9 +13,9 @@ package() {
 
     echo "Building $BIN..."
 
-    GOOS=$GOOS GOARCH=$GOARCH go build -o "$BIN" main.go rpc_client.go wallet.go
+    GOOS=$GOOS GOARCH=$GOARCH go build -o "$BIN" ./cmd/webwallet
 
-    tar --no-xattrs --disable-copyfile -czf "release/$BIN.tar.gz" "$BIN" index.html
+    tar --no-xattrs --disable-copyfile -czf "release/$BIN.tar.gz" "$BIN"
 }
 
 package linux   amd64 ""     lin-x86_x64
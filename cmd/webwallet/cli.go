@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// stdin is shared so commands can read several lines from it
+var stdin = bufio.NewReader(os.Stdin)
+
+// readLine reads one line from stdin, prompting on stderr when stdin is a
+// terminal. The input is echoed; pipe it in to keep it off the screen.
+func readLine(prompt string) (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("reading stdin: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// printJSON writes a command's result to stdout
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// newFlagSet returns a flag set for a command, whose usage line is synopsis.
+// Every command takes -network.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: webwallet %s %s\n", name, synopsis)
+		fs.PrintDefaults()
+	}
+	fs.Func("network", "chain of the keys and addresses: main, test or regtest (default $NETWORK, or main)", hdwallet.UseNetwork)
+	return fs
+}
+
+// KeyOutput is a key printed by new-wallet and mnemonic-to-wif
+type KeyOutput struct {
+	Mnemonic       string `json:"mnemonic,omitempty"`
+	PrivateKeyWIF  string `json:"private_key_wif"`
+	LegacyAddress  string `json:"legacy_address"`
+	SegWitAddress  string `json:"segwit_address,omitempty"`
+	DerivationPath string `json:"derivation_path,omitempty"`
+}
+
+func keyOutput(wallet *hdwallet.Wallet) KeyOutput {
+	return KeyOutput{
+		Mnemonic:       wallet.Mnemonic,
+		PrivateKeyWIF:  wallet.PrivateKeyWIF,
+		LegacyAddress:  wallet.LegacyAddress,
+		SegWitAddress:  wallet.SegWitAddress,
+		DerivationPath: wallet.DerivationPath,
+	}
+}
+
+func cmdNewWallet(args []string) error {
+	fs := newFlagSet("new-wallet", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	wallet, err := hdwallet.GenerateNewWallet()
+	if err != nil {
+		return err
+	}
+	return printJSON(keyOutput(wallet))
+}
+
+func cmdMnemonicToWIF(args []string) error {
+	fs := newFlagSet("mnemonic-to-wif", "[-path m/44'/2'/0'/0/0] < mnemonic")
+	path := fs.String("path", hdwallet.DefaultDerivationPath, "BIP32 derivation path of the key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	mnemonic, err := readLine("Mnemonic: ")
+	if err != nil {
+		return err
+	}
+	wallet, err := hdwallet.WalletFromMnemonic(mnemonic, *path)
+	if err != nil {
+		return err
+	}
+	out := keyOutput(wallet)
+	out.Mnemonic = ""
+	return printJSON(out)
+}
+
+// DerivedAddress is one address printed by derive-address
+type DerivedAddress struct {
+	Path          string `json:"path"`
+	LegacyAddress string `json:"legacy_address"`
+	SegWitAddress string `json:"segwit_address"`
+}
+
+func cmdDeriveAddress(args []string) error {
+	fs := newFlagSet("derive-address", "[-account 0] [-change] [-index 0] [-count 1] < mnemonic")
+	account := fs.Uint("account", 0, "BIP44 account")
+	change := fs.Bool("change", false, "derive change addresses instead of receiving ones")
+	index := fs.Uint("index", 0, "first address index")
+	count := fs.Uint("count", 1, "how many consecutive addresses to derive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *count == 0 || *count > 1000 {
+		return fmt.Errorf("-count must be between 1 and 1000")
+	}
+	mnemonic, err := readLine("Mnemonic: ")
+	if err != nil {
+		return err
+	}
+
+	chain := 0
+	if *change {
+		chain = 1
+	}
+	addresses := []DerivedAddress{}
+	for i := *index; i < *index+*count; i++ {
+		path := fmt.Sprintf("m/44'/2'/%d'/%d/%d", *account, chain, i)
+		wallet, err := hdwallet.WalletFromMnemonic(mnemonic, path)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, DerivedAddress{
+			Path:          path,
+			LegacyAddress: wallet.LegacyAddress,
+			SegWitAddress: wallet.SegWitAddress,
+		})
+	}
+	return printJSON(addresses)
+}
+
+// SignedTransaction is what sign-tx prints
+type SignedTransaction struct {
+	Txid   string     `json:"txid"`
+	Hex    string     `json:"hex"`
+	Fee    rpc.Amount `json:"fee"`
+	Change rpc.Amount `json:"change"`
+	VSize  int64      `json:"vsize"`
+	Inputs int        `json:"inputs"`
+}
+
+// readUTXOs reads spendable outputs from a listunspent result, or the
+// unspents of a scantxoutset one, saved on an online machine
+func readUTXOs(path string) ([]hdwallet.LocalUTXO, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var parsed interface{}
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	items, ok := parsed.([]interface{})
+	if scan, isObject := parsed.(map[string]interface{}); isObject {
+		items, ok = scan["unspents"].([]interface{})
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s: expected listunspent or scantxoutset output", path)
+	}
+
+	utxos := []hdwallet.LocalUTXO{}
+	for i, item := range items {
+		m, _ := item.(map[string]interface{})
+		hash, err := chainhash.NewHashFromStr(rpc.GetString(m, "txid"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: output %d has a bad txid: %w", path, i, err)
+		}
+		pkScript, err := hex.DecodeString(rpc.GetString(m, "scriptPubKey"))
+		if err != nil || len(pkScript) == 0 {
+			return nil, fmt.Errorf("%s: output %d has a bad or missing scriptPubKey", path, i)
+		}
+		utxos = append(utxos, hdwallet.LocalUTXO{
+			OutPoint: *wire.NewOutPoint(hash, uint32(rpc.GetInt(m, "vout"))),
+			Value:    int64(rpc.GetAmount(m, "amount")),
+			PkScript: pkScript,
+		})
+	}
+	return utxos, nil
+}
+
+func cmdSignTx(args []string) error {
+	fs := newFlagSet("sign-tx", "-utxos utxos.json -to ADDRESS (-amount KCN | -sweep) -fee-rate N [-change ADDRESS] < key")
+	utxosPath := fs.String("utxos", "", "listunspent or scantxoutset output for the key's addresses")
+	to := fs.String("to", "", "address to pay")
+	amountStr := fs.String("amount", "", "KCN to pay")
+	sweep := fs.Bool("sweep", false, "pay everything, less the fee, instead of -amount")
+	feeRate := fs.Int64("fee-rate", 0, "fee rate in kernels per vbyte")
+	changeAddress := fs.String("change", "", "change address (default: the key's own address)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *utxosPath == "" || *to == "":
+		return fmt.Errorf("-utxos and -to are required")
+	case *feeRate < 1:
+		return fmt.Errorf("-fee-rate is required: there is no node to estimate it")
+	case *sweep == (*amountStr != ""):
+		return fmt.Errorf("give either -amount or -sweep")
+	}
+	var amount rpc.Amount
+	if !*sweep {
+		var err error
+		if amount, err = rpc.ParseAmount(*amountStr); err != nil || amount <= 0 {
+			return fmt.Errorf("invalid -amount %q", *amountStr)
+		}
+	}
+	utxos, err := readUTXOs(*utxosPath)
+	if err != nil {
+		return err
+	}
+
+	key, err := readLine("WIF or BIP38 key: ")
+	if err != nil {
+		return err
+	}
+	var passphrase string
+	if hdwallet.IsBIP38(key) {
+		if passphrase, err = readLine("BIP38 passphrase: "); err != nil {
+			return err
+		}
+	}
+	wifStr, err := hdwallet.DecryptKeyInput(key, passphrase)
+	if err != nil {
+		return err
+	}
+	wallet, err := hdwallet.WalletFromWIF(wifStr)
+	if err != nil {
+		return err
+	}
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKeyWIF)
+	if err != nil {
+		return err
+	}
+
+	var built *hdwallet.LocalTransaction
+	if *sweep {
+		built, err = hdwallet.BuildSweepTransaction(wif.PrivKey, wif.CompressPubKey, utxos, *to, *feeRate)
+	} else {
+		change := *changeAddress
+		if change == "" {
+			change = wallet.SegWitAddress
+		}
+		if change == "" {
+			change = wallet.LegacyAddress
+		}
+		built, err = hdwallet.BuildSignedTransaction(wif.PrivKey, wif.CompressPubKey, utxos,
+			*to, int64(amount), *feeRate, change)
+	}
+	if err != nil {
+		return err
+	}
+	rawHex, err := hdwallet.SerializeTx(built.Tx)
+	if err != nil {
+		return err
+	}
+	return printJSON(SignedTransaction{
+		Txid:   built.Tx.TxHash().String(),
+		Hex:    rawHex,
+		Fee:    rpc.Amount(built.Fee),
+		Change: rpc.Amount(built.Change),
+		VSize:  built.VSize,
+		Inputs: len(built.Tx.TxIn),
+	})
+}
+
+func cmdSend(args []string) error {
+	fs := newFlagSet("send", "[-rpc-url URL] [-rpc-user USER] [HEX | < hex]")
+	url := fs.String("rpc-url", envOr("RPC_URL", "http://127.0.0.1:9332"), "kernelcoind RPC URL")
+	user := fs.String("rpc-user", os.Getenv("RPC_USER"), "kernelcoind RPC user; the password is read from RPC_PASS")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rawHex := fs.Arg(0)
+	if rawHex == "" || rawHex == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+		rawHex = strings.TrimSpace(string(data))
+	}
+	// Accept sign-tx's output as it is
+	var signed SignedTransaction
+	if json.Unmarshal([]byte(rawHex), &signed) == nil && signed.Hex != "" {
+		rawHex = signed.Hex
+	}
+	if _, err := hex.DecodeString(rawHex); err != nil || rawHex == "" {
+		return errors.New("the transaction must be hex, as printed by sign-tx")
+	}
+
+	client := rpc.NewClient(*url, *user, os.Getenv("RPC_PASS"))
+	client.SetLogger(func(requestID, line string) {})
+	txid, err := client.SendRawTransaction(rawHex)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]string{"txid": txid})
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,74 @@
+// Command webwallet serves the Kernelcoin web wallet, and works with keys
+// and transactions from the terminal without the server, e.g. on an
+// air-gapped machine. See the server package for the server's
+// configuration.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/server"
+)
+
+const usage = `Usage: webwallet [command] [flags]
+
+Commands:
+  serve            run the web wallet (the default when no command is given)
+  new-wallet       generate a mnemonic and its first key
+  mnemonic-to-wif  print the WIF key of a mnemonic read from stdin
+  derive-address   print addresses derived from a mnemonic read from stdin
+  sign-tx          build and sign a transaction offline with a key read from stdin
+  send             broadcast a signed transaction through kernelcoind
+
+Run webwallet <command> -h for a command's flags. Mnemonics and keys are
+read from stdin so they stay out of shell history and process listings.
+`
+
+// commands are the subcommands besides serve, each given the arguments
+// after its name
+var commands = map[string]func(args []string) error{
+	"new-wallet":      cmdNewWallet,
+	"mnemonic-to-wif": cmdMnemonicToWIF,
+	"derive-address":  cmdDeriveAddress,
+	"sign-tx":         cmdSignTx,
+	"send":            cmdSend,
+}
+
+func main() {
+	args := os.Args[1:]
+	// Flags alone run the server, as before there were commands
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		server.Main(args)
+		return
+	}
+
+	name := args[0]
+	switch name {
+	case "serve":
+		server.Main(args[1:])
+		return
+	case "help":
+		fmt.Print(usage)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "webwallet: unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	// NETWORK is the server's setting too; -network overrides it
+	if err := hdwallet.UseNetwork(envOr("NETWORK", "main")); err != nil {
+		fmt.Fprintf(os.Stderr, "webwallet %s: %v\n", name, err)
+		os.Exit(2)
+	}
+	if err := cmd(args[1:]); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "webwallet %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
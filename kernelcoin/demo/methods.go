@@ -0,0 +1,894 @@
+package demo
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// minRelayFee is the node's minimum fee rate, in kernels per kvB
+const minRelayFee rpc.Amount = 1000
+
+// methods are the RPC methods the node answers, called with its lock held
+var methods = map[string]func(n *Node, p params) (interface{}, error){
+	"getblockchaininfo":            (*Node).getBlockchainInfo,
+	"getnetworkinfo":               (*Node).getNetworkInfo,
+	"getblockhash":                 (*Node).getBlockHash,
+	"getblockheader":               (*Node).getBlockHeader,
+	"getpeerinfo":                  (*Node).getPeerInfo,
+	"getnettotals":                 (*Node).getNetTotals,
+	"getmempoolinfo":               (*Node).getMempoolInfo,
+	"getmempoolentry":              (*Node).getMempoolEntry,
+	"estimatesmartfee":             (*Node).estimateSmartFee,
+	"generatetoaddress":            (*Node).generateToAddress,
+	"scantxoutset":                 (*Node).scanTxOutSet,
+	"validateaddress":              (*Node).validateAddress,
+	"listwallets":                  (*Node).listWallets,
+	"getwalletinfo":                (*Node).getWalletInfo,
+	"getbalances":                  (*Node).getBalances,
+	"listtransactions":             (*Node).listTransactions,
+	"gettransaction":               (*Node).getTransaction,
+	"listunspent":                  (*Node).listUnspent,
+	"lockunspent":                  (*Node).lockUnspent,
+	"listlockunspent":              (*Node).listLockUnspent,
+	"listaddressgroupings":         (*Node).listAddressGroupings,
+	"getnewaddress":                (*Node).getNewAddress,
+	"getrawchangeaddress":          (*Node).getRawChangeAddress,
+	"getaddressesbylabel":          (*Node).getAddressesByLabel,
+	"getaddressinfo":               (*Node).getAddressInfo,
+	"getreceivedbyaddress":         (*Node).getReceivedByAddress,
+	"sendtoaddress":                (*Node).sendToAddress,
+	"bumpfee":                      (*Node).bumpFee,
+	"createrawtransaction":         (*Node).createRawTransaction,
+	"fundrawtransaction":           (*Node).fundRawTransaction,
+	"signrawtransactionwithwallet": (*Node).signRawTransactionWithWallet,
+	"sendrawtransaction":           (*Node).sendRawTransaction,
+	"abandontransaction":           (*Node).abandonTransaction,
+	"importprivkey":                (*Node).importPrivKey,
+	"dumpprivkey":                  (*Node).dumpPrivKey,
+	"rescanblockchain":             (*Node).rescanBlockchain,
+	"abortrescan":                  (*Node).abortRescan,
+}
+
+// Chain and network
+
+func (n *Node) getBlockchainInfo(p params) (interface{}, error) {
+	return map[string]interface{}{
+		"chain":                n.chain,
+		"blocks":               n.height,
+		"headers":              n.height,
+		"bestblockhash":        blockHash(n.height),
+		"difficulty":           14230.5,
+		"time":                 n.blockTime(n.height),
+		"mediantime":           n.blockTime(n.height - 5),
+		"verificationprogress": 1,
+		"initialblockdownload": false,
+		"size_on_disk":         4200000000 + n.height*1000,
+		"pruned":               false,
+		"warnings":             "",
+	}, nil
+}
+
+func (n *Node) getNetworkInfo(p params) (interface{}, error) {
+	return map[string]interface{}{
+		"version":            210300,
+		"subversion":         "/Kernelcoin:0.21.3(demo)/",
+		"protocolversion":    70016,
+		"localservicesnames": []string{"NETWORK", "WITNESS", "NETWORK_LIMITED"},
+		"networkactive":      true,
+		"connections":        len(demoPeers),
+		"connections_in":     2,
+		"connections_out":    len(demoPeers) - 2,
+		"relayfee":           minRelayFee.Number(),
+		"incrementalfee":     minRelayFee.Number(),
+		"localaddresses":     []interface{}{},
+		"warnings":           "This is a simulated node: nothing is sent to the Kernelcoin network",
+	}, nil
+}
+
+func (n *Node) getBlockHash(p params) (interface{}, error) {
+	height := p.int(0, -1)
+	if height < 0 || height > n.height {
+		return nil, &rpcError{Code: -8, Message: "Block height out of range"}
+	}
+	return blockHash(height), nil
+}
+
+func (n *Node) getBlockHeader(p params) (interface{}, error) {
+	hash := p.string(0)
+	height, ok := n.blockHeight(hash)
+	if !ok {
+		return nil, &rpcError{Code: -5, Message: "Block not found"}
+	}
+	header := map[string]interface{}{
+		"hash":          hash,
+		"confirmations": n.height - height + 1,
+		"height":        height,
+		"version":       536870912,
+		"time":          n.blockTime(height),
+		"mediantime":    n.blockTime(height - 5),
+		"nonce":         uint32(height * 2654435761),
+		"bits":          "1b0404cb",
+		"difficulty":    14230.5,
+		"nTx":           1 + height%40,
+	}
+	if height > 0 {
+		header["previousblockhash"] = blockHash(height - 1)
+	}
+	if height < n.height {
+		header["nextblockhash"] = blockHash(height + 1)
+	}
+	return header, nil
+}
+
+// demoPeers are the node's simulated connections
+var demoPeers = []struct {
+	addr    string
+	inbound bool
+	subver  string
+	ping    float64
+}{
+	{"203.0.113.12:9333", false, "/Kernelcoin:0.21.3/", 0.041},
+	{"198.51.100.7:9333", false, "/Kernelcoin:0.21.3/", 0.087},
+	{"192.0.2.44:9333", false, "/Kernelcoin:0.21.2/", 0.126},
+	{"203.0.113.201:9333", false, "/Kernelcoin:0.21.3/", 0.058},
+	{"198.51.100.93:9333", false, "/Kernelcoin:0.21.1/", 0.211},
+	{"192.0.2.150:9333", false, "/Kernelcoin:0.21.3/", 0.073},
+	{"203.0.113.77:50412", true, "/Kernelcoin:0.21.3/", 0.095},
+	{"198.51.100.18:41876", true, "/Kernelcoin:0.21.2/", 0.164},
+}
+
+func (n *Node) getPeerInfo(p params) (interface{}, error) {
+	uptime := int64(time.Since(n.started).Seconds())
+	peers := []interface{}{}
+	for i, peer := range demoPeers {
+		connectionType := "outbound-full-relay"
+		if peer.inbound {
+			connectionType = "inbound"
+		}
+		peers = append(peers, map[string]interface{}{
+			"id":              i,
+			"addr":            peer.addr,
+			"network":         "ipv4",
+			"inbound":         peer.inbound,
+			"connection_type": connectionType,
+			"version":         70016,
+			"subver":          peer.subver,
+			"servicesnames":   []string{"NETWORK", "WITNESS", "NETWORK_LIMITED"},
+			"startingheight":  startHeight - int64(i),
+			"synced_blocks":   n.height,
+			"pingtime":        peer.ping,
+			"bytessent":       (40000 + int64(i)*1500) * (1 + uptime/60),
+			"bytesrecv":       (90000 + int64(i)*3100) * (1 + uptime/60),
+			"conntime":        n.started.Unix() - int64(i+1)*3600,
+		})
+	}
+	return peers, nil
+}
+
+func (n *Node) getNetTotals(p params) (interface{}, error) {
+	uptime := int64(time.Since(n.started).Seconds())
+	return map[string]interface{}{
+		"totalbytesrecv": 1200000 + uptime*5400,
+		"totalbytessent": 800000 + uptime*2300,
+		"timemillis":     time.Now().UnixMilli(),
+	}, nil
+}
+
+// Mempool and fees
+
+// inMempool returns the wallet's unconfirmed transactions
+func (n *Node) inMempool() []*walletTx {
+	txs := []*walletTx{}
+	for _, tx := range n.txs {
+		if tx.height == 0 && tx.live() {
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
+
+func (n *Node) getMempoolInfo(p params) (interface{}, error) {
+	others := n.waiting()
+	size, vbytes, fees := int64(others), int64(others)*230, rpc.Amount(others)*690
+	for _, tx := range n.inMempool() {
+		size++
+		vbytes += tx.vsize
+		fees += tx.fee
+	}
+	return map[string]interface{}{
+		"loaded":           true,
+		"size":             size,
+		"bytes":            vbytes,
+		"usage":            vbytes * 4,
+		"total_fee":        fees.Number(),
+		"maxmempool":       300000000,
+		"mempoolminfee":    minRelayFee.Number(),
+		"minrelaytxfee":    minRelayFee.Number(),
+		"unbroadcastcount": 0,
+	}, nil
+}
+
+// related returns tx and its unconfirmed ancestors (or descendants),
+// which are mined with it
+func (n *Node) related(tx *walletTx, descendants bool) []*walletTx {
+	found := map[string]bool{tx.txid: true}
+	list := []*walletTx{tx}
+	for i := 0; i < len(list); i++ {
+		for _, other := range n.inMempool() {
+			if found[other.txid] {
+				continue
+			}
+			parent, child := other, list[i]
+			if descendants {
+				parent, child = list[i], other
+			}
+			for _, in := range child.inputs {
+				if in.txid == parent.txid {
+					found[other.txid] = true
+					list = append(list, other)
+					break
+				}
+			}
+		}
+	}
+	return list
+}
+
+func (n *Node) getMempoolEntry(p params) (interface{}, error) {
+	tx, ok := n.txByID[p.string(0)]
+	if !ok || tx.height != 0 || !tx.live() {
+		return nil, &rpcError{Code: -5, Message: "Transaction not in mempool"}
+	}
+	sum := func(txs []*walletTx) (vsize int64, fees rpc.Amount) {
+		for _, t := range txs {
+			vsize += t.vsize
+			fees += t.fee
+		}
+		return vsize, fees
+	}
+	ancestors, descendants := n.related(tx, false), n.related(tx, true)
+	ancestorSize, ancestorFees := sum(ancestors)
+	descendantSize, descendantFees := sum(descendants)
+	depends := []string{}
+	for _, a := range ancestors[1:] {
+		depends = append(depends, a.txid)
+	}
+	return map[string]interface{}{
+		"vsize":  tx.vsize,
+		"weight": tx.vsize * 4,
+		"time":   tx.time,
+		"height": n.height,
+		"fees": map[string]interface{}{
+			"base":       tx.fee.Number(),
+			"modified":   tx.fee.Number(),
+			"ancestor":   ancestorFees.Number(),
+			"descendant": descendantFees.Number(),
+		},
+		"ancestorcount":      len(ancestors),
+		"ancestorsize":       ancestorSize,
+		"descendantcount":    len(descendants),
+		"descendantsize":     descendantSize,
+		"depends":            depends,
+		"spentby":            []string{},
+		"bip125-replaceable": tx.replaceable,
+		"unbroadcast":        false,
+	}, nil
+}
+
+func (n *Node) estimateSmartFee(p params) (interface{}, error) {
+	target := p.int(0, 6)
+	if target < 1 || target > 1008 {
+		return nil, &rpcError{Code: -8, Message: "Invalid conf_target, must be between 1 and 1008"}
+	}
+	// kernels per vbyte to KCN per kvB
+	return map[string]interface{}{
+		"feerate": rpc.Amount(n.feeRate(target) * 1000).Number(),
+		"blocks":  target,
+	}, nil
+}
+
+func (n *Node) generateToAddress(p params) (interface{}, error) {
+	blocks, address := p.int(0, 0), p.string(1)
+	if _, err := hdwallet.DecodeAddress(address); err != nil {
+		return nil, &rpcError{Code: -5, Message: "Error: Invalid address"}
+	}
+	hashes := []string{}
+	for i := int64(0); i < blocks; i++ {
+		hashes = append(hashes, n.mineBlock(address))
+	}
+	return hashes, nil
+}
+
+// scanTxOutSet finds the confirmed coins of addr() descriptors for wallet
+// addresses; the demo knows no others
+func (n *Node) scanTxOutSet(p params) (interface{}, error) {
+	if p.string(0) != "start" {
+		return nil, &rpcError{Code: -8, Message: "Invalid action"}
+	}
+	wanted := map[string]string{}
+	for _, item := range p.list(1) {
+		desc, _ := item.(string)
+		if m, ok := item.(map[string]interface{}); ok {
+			desc, _ = m["desc"].(string)
+		}
+		if strings.HasPrefix(desc, "addr(") && strings.HasSuffix(desc, ")") {
+			wanted[desc[len("addr("):len(desc)-1]] = desc
+		}
+	}
+
+	unspents := []interface{}{}
+	var total rpc.Amount
+	for _, c := range n.unspent() {
+		desc, ok := wanted[c.out.address]
+		if !ok || c.tx.height == 0 {
+			continue
+		}
+		unspents = append(unspents, map[string]interface{}{
+			"txid":         c.txid,
+			"vout":         c.vout,
+			"scriptPubKey": hex.EncodeToString(c.script),
+			"desc":         desc,
+			"amount":       c.out.amount.Number(),
+			"coinbase":     c.tx.coinbase,
+			"height":       c.tx.height,
+		})
+		total += c.out.amount
+	}
+	return map[string]interface{}{
+		"success":      true,
+		"txouts":       5123456,
+		"height":       n.height,
+		"bestblock":    blockHash(n.height),
+		"unspents":     unspents,
+		"total_amount": total.Number(),
+	}, nil
+}
+
+func (n *Node) validateAddress(p params) (interface{}, error) {
+	address := p.string(0)
+	decoded, err := hdwallet.DecodeAddress(address)
+	if err != nil {
+		return map[string]interface{}{"isvalid": false, "error": "Invalid address"}, nil
+	}
+	info := addressFields(decoded)
+	info["isvalid"] = true
+	return info, nil
+}
+
+// addressFields are the validateaddress fields of an address
+func addressFields(addr btcutil.Address) map[string]interface{} {
+	script, _ := txscript.PayToAddrScript(addr)
+	fields := map[string]interface{}{
+		"address":      addr.EncodeAddress(),
+		"scriptPubKey": hex.EncodeToString(script),
+		"isscript":     false,
+		"iswitness":    false,
+	}
+	switch a := addr.(type) {
+	case *btcutil.AddressScriptHash:
+		fields["isscript"] = true
+	case interface {
+		WitnessVersion() byte
+		WitnessProgram() []byte
+	}:
+		fields["iswitness"] = true
+		fields["witness_version"] = a.WitnessVersion()
+		fields["witness_program"] = hex.EncodeToString(a.WitnessProgram())
+		fields["isscript"] = len(a.WitnessProgram()) == 32 && a.WitnessVersion() == 0
+	}
+	return fields
+}
+
+// Wallet
+
+func (n *Node) listWallets(p params) (interface{}, error) {
+	return []string{"demo"}, nil
+}
+
+func (n *Node) getWalletInfo(p params) (interface{}, error) {
+	trusted, pending, immature := n.balances()
+	return map[string]interface{}{
+		"walletname":              "demo",
+		"walletversion":           169900,
+		"format":                  "sqlite",
+		"balance":                 trusted.Number(),
+		"unconfirmed_balance":     pending.Number(),
+		"immature_balance":        immature.Number(),
+		"txcount":                 len(n.txs),
+		"keypoolsize":             1000,
+		"keypoolsize_hd_internal": 1000,
+		"paytxfee":                rpc.Amount(0).Number(),
+		"private_keys_enabled":    true,
+		"avoid_reuse":             false,
+		"scanning":                false,
+		"descriptors":             true,
+	}, nil
+}
+
+func (n *Node) getBalances(p params) (interface{}, error) {
+	trusted, pending, immature := n.balances()
+	return map[string]interface{}{
+		"mine": map[string]interface{}{
+			"trusted":           trusted.Number(),
+			"untrusted_pending": pending.Number(),
+			"immature":          immature.Number(),
+		},
+		"lastprocessedblock": map[string]interface{}{
+			"hash":   blockHash(n.height),
+			"height": n.height,
+		},
+	}, nil
+}
+
+// entries returns tx's listtransactions entries: a send for each output
+// the wallet paid to someone else, and a receive for each output to a
+// wallet address that is not change
+func (n *Node) entries(tx *walletTx) []map[string]interface{} {
+	entries := []map[string]interface{}{}
+	for vout, out := range tx.outputs {
+		k, mine := n.keys[out.address]
+		if tx.fromMe() && !(mine && k.change) {
+			entry := n.entry(tx, vout, "send", -out.amount)
+			entry["fee"] = (-tx.fee).Number()
+			entry["abandoned"] = tx.abandoned
+			entries = append(entries, entry)
+		}
+		if mine && !k.change {
+			category := "receive"
+			if tx.coinbase {
+				category = "generate"
+				if n.confirmations(tx) < coinbaseMaturity {
+					category = "immature"
+				}
+			}
+			entry := n.entry(tx, vout, category, out.amount)
+			if k.label != "" {
+				entry["label"] = k.label
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func (n *Node) entry(tx *walletTx, vout int, category string, amount rpc.Amount) map[string]interface{} {
+	entry := n.txFields(tx)
+	if address := tx.outputs[vout].address; address != "" {
+		// Data outputs have none
+		entry["address"] = address
+	}
+	entry["category"] = category
+	entry["amount"] = amount.Number()
+	entry["vout"] = vout
+	return entry
+}
+
+// txFields are the fields listtransactions and gettransaction share
+func (n *Node) txFields(tx *walletTx) map[string]interface{} {
+	replaceable := "no"
+	if tx.height == 0 && tx.replaceable {
+		replaceable = "yes"
+	}
+	conflicts := append([]string{}, tx.conflicts...)
+	fields := map[string]interface{}{
+		"confirmations":      n.confirmations(tx),
+		"txid":               tx.txid,
+		"walletconflicts":    conflicts,
+		"time":               tx.time,
+		"timereceived":       tx.time,
+		"bip125-replaceable": replaceable,
+	}
+	if tx.height > 0 {
+		fields["blockhash"] = blockHash(tx.height)
+		fields["blockheight"] = tx.height
+		fields["blockindex"] = 1
+		fields["blocktime"] = n.blockTime(tx.height)
+	}
+	if tx.coinbase {
+		fields["generated"] = true
+	}
+	if tx.comment != "" {
+		fields["comment"] = tx.comment
+	}
+	if tx.commentTo != "" {
+		fields["to"] = tx.commentTo
+	}
+	return fields
+}
+
+func (n *Node) listTransactions(p params) (interface{}, error) {
+	count, skip := int(p.int(1, 10)), int(p.int(2, 0))
+	if count < 0 || skip < 0 {
+		return nil, &rpcError{Code: -8, Message: "Negative count or from"}
+	}
+	all := []map[string]interface{}{}
+	for _, tx := range n.txs {
+		all = append(all, n.entries(tx)...)
+	}
+	// The count most recent entries after skipping skip, oldest first
+	end := max(len(all)-skip, 0)
+	return all[max(end-count, 0):end], nil
+}
+
+func (n *Node) getTransaction(p params) (interface{}, error) {
+	tx, ok := n.txByID[p.string(0)]
+	if !ok {
+		return nil, &rpcError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+	}
+	// What the wallet gained or, less the fee, spent
+	var amount rpc.Amount
+	for _, out := range tx.outputs {
+		switch {
+		case n.mine(out.address) && !tx.fromMe():
+			amount += out.amount
+		case !n.mine(out.address) && tx.fromMe():
+			amount -= out.amount
+		}
+	}
+	result := n.txFields(tx)
+	result["amount"] = amount.Number()
+	if tx.fromMe() {
+		result["fee"] = (-tx.fee).Number()
+	}
+	result["details"] = n.entries(tx)
+	return result, nil
+}
+
+func (n *Node) listUnspent(p params) (interface{}, error) {
+	minConf := p.int(0, 1)
+	utxos := []interface{}{}
+	for _, c := range n.unspent() {
+		if n.confirmations(c.tx) < minConf || n.immature(c) || n.locked[c.outpoint] {
+			continue
+		}
+		utxo := map[string]interface{}{
+			"txid":          c.txid,
+			"vout":          c.vout,
+			"address":       c.out.address,
+			"scriptPubKey":  hex.EncodeToString(c.script),
+			"amount":        c.out.amount.Number(),
+			"confirmations": n.confirmations(c.tx),
+			"spendable":     true,
+			"solvable":      true,
+			"safe":          n.safe(c),
+		}
+		if k := n.keys[c.out.address]; k.label != "" {
+			utxo["label"] = k.label
+		}
+		utxos = append(utxos, utxo)
+	}
+	return utxos, nil
+}
+
+func (n *Node) lockUnspent(p params) (interface{}, error) {
+	unlock := p.bool(0, false)
+	if unlock && len(p.list(1)) == 0 {
+		n.locked = map[outpoint]bool{}
+		return true, nil
+	}
+
+	unspent := map[outpoint]bool{}
+	for _, c := range n.unspent() {
+		unspent[c.outpoint] = true
+	}
+	outpoints := []outpoint{}
+	for _, item := range p.list(1) {
+		m, _ := item.(map[string]interface{})
+		op := outpoint{rpc.GetString(m, "txid"), rpc.GetInt(m, "vout")}
+		switch {
+		case !unspent[op]:
+			return nil, &rpcError{Code: -8, Message: "Invalid parameter, unknown transaction or spent output"}
+		case unlock && !n.locked[op]:
+			return nil, &rpcError{Code: -8, Message: "Invalid parameter, expected locked output"}
+		case !unlock && n.locked[op]:
+			return nil, &rpcError{Code: -8, Message: "Invalid parameter, output already locked"}
+		}
+		outpoints = append(outpoints, op)
+	}
+	for _, op := range outpoints {
+		if unlock {
+			delete(n.locked, op)
+		} else {
+			n.locked[op] = true
+		}
+	}
+	return true, nil
+}
+
+func (n *Node) listLockUnspent(p params) (interface{}, error) {
+	list := []interface{}{}
+	for _, c := range n.unspent() {
+		if n.locked[c.outpoint] {
+			list = append(list, map[string]interface{}{"txid": c.txid, "vout": c.vout})
+		}
+	}
+	return list, nil
+}
+
+// listAddressGroupings groups the addresses that have received coins by
+// common ownership: the inputs of a send and its change go together
+func (n *Node) listAddressGroupings(p params) (interface{}, error) {
+	group := map[string]string{}
+	var find func(a string) string
+	find = func(a string) string {
+		if parent, ok := group[a]; ok && parent != a {
+			root := find(parent)
+			group[a] = root
+			return root
+		}
+		return a
+	}
+	balances := map[string]rpc.Amount{}
+	for _, c := range n.unspent() {
+		balances[c.out.address] += c.out.amount
+	}
+	used := map[string]bool{}
+	for _, tx := range n.txs {
+		if !tx.live() {
+			continue
+		}
+		linked := []string{}
+		for _, in := range tx.inputs {
+			linked = append(linked, n.txByID[in.txid].outputs[in.vout].address)
+		}
+		for _, out := range tx.outputs {
+			if k, ok := n.keys[out.address]; ok {
+				used[out.address] = true
+				if k.change && tx.fromMe() {
+					linked = append(linked, out.address)
+				}
+			}
+		}
+		for _, a := range linked[min(len(linked), 1):] {
+			group[find(a)] = find(linked[0])
+		}
+	}
+
+	groups := map[string][]interface{}{}
+	roots := []string{}
+	for _, address := range n.addresses {
+		if !used[address] {
+			continue
+		}
+		root := find(address)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		entry := []interface{}{address, balances[address].Number()}
+		if k := n.keys[address]; !k.change {
+			entry = append(entry, k.label)
+		}
+		groups[root] = append(groups[root], entry)
+	}
+	list := []interface{}{}
+	for _, root := range roots {
+		list = append(list, groups[root])
+	}
+	return list, nil
+}
+
+func (n *Node) getNewAddress(p params) (interface{}, error) {
+	switch addressType := p.string(1); addressType {
+	case "", "bech32":
+		return n.newKey(p.string(0), false, false).address, nil
+	case "legacy":
+		return n.newKey(p.string(0), false, true).address, nil
+	default:
+		return nil, &rpcError{Code: -5, Message: fmt.Sprintf("Unknown address type '%s'", addressType)}
+	}
+}
+
+func (n *Node) getRawChangeAddress(p params) (interface{}, error) {
+	switch addressType := p.string(0); addressType {
+	case "", "bech32":
+		return n.newKey("", true, false).address, nil
+	case "legacy":
+		return n.newKey("", true, true).address, nil
+	default:
+		return nil, &rpcError{Code: -5, Message: fmt.Sprintf("Unknown address type '%s'", addressType)}
+	}
+}
+
+func (n *Node) getAddressesByLabel(p params) (interface{}, error) {
+	label := p.string(0)
+	result := map[string]interface{}{}
+	for _, address := range n.addresses {
+		if k := n.keys[address]; !k.change && k.label == label {
+			result[address] = map[string]string{"purpose": "receive"}
+		}
+	}
+	if len(result) == 0 {
+		return nil, &rpcError{Code: -11, Message: fmt.Sprintf("No addresses with label %s", label)}
+	}
+	return result, nil
+}
+
+func (n *Node) getAddressInfo(p params) (interface{}, error) {
+	address := p.string(0)
+	decoded, err := hdwallet.DecodeAddress(address)
+	if err != nil {
+		return nil, &rpcError{Code: -5, Message: "Invalid address"}
+	}
+	info := addressFields(decoded)
+	info["ismine"] = false
+	info["solvable"] = false
+	info["iswatchonly"] = false
+	info["ischange"] = false
+	info["labels"] = []string{}
+
+	k, ok := n.keys[address]
+	if !ok {
+		return info, nil
+	}
+	pubKey := hex.EncodeToString(k.priv.PubKey().SerializeCompressed())
+	info["ismine"] = true
+	info["solvable"] = true
+	info["pubkey"] = pubKey
+	info["ischange"] = k.change
+	if !k.change {
+		info["labels"] = []string{k.label}
+	}
+	function := "wpkh"
+	if _, legacy := decoded.(*btcutil.AddressPubKeyHash); legacy {
+		function = "pkh"
+	}
+	if k.path == "" {
+		info["desc"] = fmt.Sprintf("%s(%s)", function, pubKey)
+	} else {
+		info["desc"] = fmt.Sprintf("%s([%s%s]%s)", function, masterFingerprint, strings.TrimPrefix(k.path, "m"), pubKey)
+		info["hdkeypath"] = k.path
+		info["hdmasterfingerprint"] = masterFingerprint
+	}
+	return info, nil
+}
+
+func (n *Node) getReceivedByAddress(p params) (interface{}, error) {
+	address, minConf := p.string(0), p.int(1, 1)
+	if _, err := hdwallet.DecodeAddress(address); err != nil {
+		return nil, &rpcError{Code: -5, Message: "Invalid address"}
+	}
+	if !n.mine(address) {
+		return nil, &rpcError{Code: -4, Message: "Address not found in wallet"}
+	}
+	var total rpc.Amount
+	for _, tx := range n.txs {
+		if !tx.live() || tx.coinbase || n.confirmations(tx) < minConf {
+			continue
+		}
+		for _, out := range tx.outputs {
+			if out.address == address {
+				total += out.amount
+			}
+		}
+	}
+	return total.Number(), nil
+}
+
+func (n *Node) sendToAddress(p params) (interface{}, error) {
+	amount, err := p.amount(1)
+	if err != nil {
+		return nil, &rpcError{Code: -3, Message: "Invalid amount"}
+	}
+	feeRate := n.feeRate(6)
+	if rate := p.float(9); rate > 0 {
+		feeRate = int64(rate + 0.999)
+	}
+	tx, err := n.send(sendRequest{
+		to:          p.string(0),
+		amount:      amount,
+		comment:     p.string(2),
+		commentTo:   p.string(3),
+		subtractFee: p.bool(4, false),
+		replaceable: p.bool(5, true),
+		feeRate:     feeRate,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx.txid, nil
+}
+
+func (n *Node) bumpFee(p params) (interface{}, error) {
+	tx, ok := n.txByID[p.string(0)]
+	switch {
+	case !ok:
+		return nil, &rpcError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+	case !tx.fromMe():
+		return nil, &rpcError{Code: -4, Message: "Transaction contains inputs that don't belong to this wallet"}
+	case tx.replacedBy != "":
+		return nil, &rpcError{Code: -4, Message: fmt.Sprintf("Cannot bump transaction %s which was already bumped by transaction %s", tx.txid, tx.replacedBy)}
+	case tx.height > 0 || tx.abandoned:
+		return nil, &rpcError{Code: -4, Message: "Transaction has been mined, or is conflicted with a mined transaction"}
+	case !tx.replaceable:
+		return nil, &rpcError{Code: -4, Message: "Transaction is not BIP 125 replaceable"}
+	}
+
+	// The replacement must pay at least the incremental relay fee more
+	minFee := tx.fee + rpc.Amount(tx.vsize)*minRelayFee/1000
+	options := p.object(1)
+	var fee rpc.Amount
+	if rate, ok := options["fee_rate"]; ok {
+		satPerVByte := params{rate}.float(0)
+		fee = rpc.Amount(satPerVByte * float64(tx.vsize))
+		if fee < minFee {
+			return nil, &rpcError{Code: -8, Message: fmt.Sprintf("Insufficient total fee %s, must be at least %s (oldFee %s + incrementalFee %s)",
+				fee, minFee, tx.fee, minFee-tx.fee)}
+		}
+	} else {
+		fee = max(rpc.Amount(n.feeRate(params{options["conf_target"]}.int(0, 6))*tx.vsize), minFee)
+	}
+
+	bumped, err := n.bump(tx, fee)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"txid":    bumped.txid,
+		"origfee": tx.fee.Number(),
+		"fee":     fee.Number(),
+		"errors":  []string{},
+	}, nil
+}
+
+// abandonTransaction refuses, as kernelcoind does for a transaction in
+// its mempool: every unconfirmed demo transaction is
+func (n *Node) abandonTransaction(p params) (interface{}, error) {
+	tx, ok := n.txByID[p.string(0)]
+	if !ok {
+		return nil, &rpcError{Code: -5, Message: "Invalid or non-wallet transaction id"}
+	}
+	if tx.abandoned {
+		return nil, nil
+	}
+	return nil, &rpcError{Code: -5, Message: "Transaction not eligible for abandonment"}
+}
+
+func (n *Node) importPrivKey(p params) (interface{}, error) {
+	wif, err := btcutil.DecodeWIF(p.string(0))
+	if err != nil || !wif.IsForNet(hdwallet.Params()) {
+		return nil, &rpcError{Code: -5, Message: "Invalid private key encoding"}
+	}
+	k := &key{priv: wif.PrivKey, label: p.string(1)}
+	k.address, k.script = legacyAddress(wif.PrivKey)
+	if wif.CompressPubKey {
+		k.address, k.script = segwitAddress(wif.PrivKey)
+	}
+	if _, ok := n.keys[k.address]; !ok {
+		n.keys[k.address] = k
+		n.addresses = append(n.addresses, k.address)
+	}
+	return nil, nil
+}
+
+func (n *Node) dumpPrivKey(p params) (interface{}, error) {
+	address := p.string(0)
+	k, ok := n.keys[address]
+	if !ok {
+		return nil, &rpcError{Code: -4, Message: fmt.Sprintf("Private key for address %s is not known", address)}
+	}
+	wif, err := btcutil.NewWIF(k.priv, hdwallet.Params(), true)
+	if err != nil {
+		return nil, err
+	}
+	return wif.String(), nil
+}
+
+func (n *Node) rescanBlockchain(p params) (interface{}, error) {
+	start, stop := p.int(0, 0), p.int(1, n.height)
+	if start < 0 || stop < start || stop > n.height {
+		return nil, &rpcError{Code: -8, Message: "Invalid start_height or stop_height"}
+	}
+	return map[string]interface{}{"start_height": start, "stop_height": stop}, nil
+}
+
+func (n *Node) abortRescan(p params) (interface{}, error) {
+	return false, nil
+}
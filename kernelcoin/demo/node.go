@@ -0,0 +1,285 @@
+// Package demo is a simulated kernelcoind for demo mode: a JSON-RPC server
+// whose wallet comes with a few weeks of canned history, whose chain mines
+// a block every interval and whose mempool fills up between blocks, so the
+// web wallet can be developed and shown without a running node.
+package demo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// startHeight is the chain height at start, where the canned history ends
+const startHeight = 1284600
+
+// rpcError is a JSON-RPC error, with kernelcoind's codes
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// errNotFound is kernelcoind's answer to a method it does not have
+func errNotFound(method string) error {
+	return &rpcError{Code: -32601, Message: method + " is not available in demo mode"}
+}
+
+// Node is the simulated node and its single wallet, called "demo". It
+// answers the RPC methods the web wallet uses; anything else is an error.
+// Its state lives in memory and is rebuilt on every start.
+type Node struct {
+	mu      sync.Mutex
+	chain   string
+	rand    *rand.Rand
+	started time.Time
+
+	height int64
+	// historyEnd is the time of the block at startHeight; blocks mined
+	// since are in blockTimes
+	historyEnd int64
+	blockTimes map[int64]int64
+
+	keys        map[string]*key
+	addresses   []string // in the order the wallet gave them out
+	receiveKeys int
+	changeKeys  int
+
+	txs    []*walletTx // in the order the wallet saw them
+	txByID map[string]*walletTx
+	locked map[outpoint]bool
+
+	// others is how many transactions not the wallet's were waiting at the
+	// last block; more arrive until the next
+	others    int
+	lastBlock time.Time
+}
+
+// NewNode returns a node reporting chain (main, test or regtest) with the
+// canned wallet history
+func NewNode(chain string) *Node {
+	now := time.Now()
+	n := &Node{
+		chain: chain,
+		// The history is the same on every start
+		rand:       rand.New(rand.NewSource(1)),
+		started:    now,
+		height:     startHeight,
+		historyEnd: now.Unix(),
+		blockTimes: map[int64]int64{},
+		keys:       map[string]*key{},
+		txByID:     map[string]*walletTx{},
+		locked:     map[outpoint]bool{},
+		lastBlock:  now,
+	}
+	n.buildHistory()
+	n.rand = rand.New(rand.NewSource(now.UnixNano()))
+	n.others = 20 + n.rand.Intn(30)
+	return n
+}
+
+// Start serves the node's RPC on a free loopback port and mines a block
+// every interval. It returns the RPC URL.
+func (n *Node) Start(interval time.Duration) (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("demo node: %w", err)
+	}
+	go http.Serve(listener, n)
+	go func() {
+		for range time.Tick(interval) {
+			n.mu.Lock()
+			n.mineBlock("")
+			n.mu.Unlock()
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+func (n *Node) now() int64 {
+	return time.Now().Unix()
+}
+
+// blockTime returns when the block at height was mined
+func (n *Node) blockTime(height int64) int64 {
+	if t, ok := n.blockTimes[height]; ok {
+		return t
+	}
+	return n.historyEnd - (startHeight-height)*blockSpacing
+}
+
+// blockHash returns the hash of the block at height. It carries the height
+// so blockHeight can read it back.
+func blockHash(height int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("kernelcoin demo block %d", height)))
+	return fmt.Sprintf("00000000%08x%x", height, sum[:24])
+}
+
+func (n *Node) blockHeight(hash string) (int64, bool) {
+	if len(hash) != 64 {
+		return 0, false
+	}
+	height, err := strconv.ParseInt(hash[8:16], 16, 64)
+	if err != nil || height > n.height || blockHash(height) != hash {
+		return 0, false
+	}
+	return height, true
+}
+
+// mineBlock confirms the wallet's unconfirmed transactions and empties the
+// mempool, paying the reward to coinbaseTo if it is a wallet address. Now
+// and then a payment to the wallet arrives for the next block.
+func (n *Node) mineBlock(coinbaseTo string) string {
+	n.height++
+	n.blockTimes[n.height] = n.now()
+	for _, tx := range n.txs {
+		if tx.height == 0 && tx.live() {
+			tx.height = n.height
+		}
+	}
+	if n.mine(coinbaseTo) {
+		n.coinbase(coinbaseTo, n.height)
+	}
+	n.others = n.rand.Intn(15)
+	n.lastBlock = time.Now()
+	if n.rand.Intn(4) == 0 {
+		// 0.01 to 5 KCN, in whole hundredths
+		n.receive("", rpc.Amount(1+n.rand.Int63n(500))*rpc.KernelsPerKCN/100)
+	}
+	return blockHash(n.height)
+}
+
+// waiting returns how many transactions not the wallet's are in the mempool
+func (n *Node) waiting() int {
+	return n.others + int(time.Since(n.lastBlock)/(3*time.Second))
+}
+
+// feeRate is the fee rate, in kernels per vbyte, that confirms within
+// target blocks: it rises as the mempool fills
+func (n *Node) feeRate(target int64) int64 {
+	rate := 1 + int64(n.waiting())/8
+	if target >= 6 {
+		rate = (rate + 1) / 2
+	}
+	return rate
+}
+
+// ServeHTTP answers one JSON-RPC call
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+		ID     interface{}   `json:"id"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	var err error
+	if method, ok := methods[req.Method]; ok {
+		n.mu.Lock()
+		result, err = method(n, params(req.Params))
+		n.mu.Unlock()
+	} else {
+		err = errNotFound(req.Method)
+	}
+
+	response := map[string]interface{}{"result": result, "error": nil, "id": req.ID}
+	status := http.StatusOK
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{Code: -1, Message: err.Error()}
+		}
+		response["result"] = nil
+		response["error"] = rpcErr
+		// kernelcoind's statuses for errors
+		status = http.StatusInternalServerError
+		if rpcErr.Code == -32601 {
+			status = http.StatusNotFound
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// params are a call's positional parameters; missing ones read as the
+// given default
+type params []interface{}
+
+func (p params) get(i int) interface{} {
+	if i < len(p) {
+		return p[i]
+	}
+	return nil
+}
+
+func (p params) string(i int) string {
+	s, _ := p.get(i).(string)
+	return s
+}
+
+func (p params) int(i int, def int64) int64 {
+	if n, ok := p.get(i).(json.Number); ok {
+		if v, err := n.Int64(); err == nil {
+			return v
+		}
+	}
+	return def
+}
+
+func (p params) bool(i int, def bool) bool {
+	if b, ok := p.get(i).(bool); ok {
+		return b
+	}
+	return def
+}
+
+func (p params) float(i int) float64 {
+	if n, ok := p.get(i).(json.Number); ok {
+		v, _ := n.Float64()
+		return v
+	}
+	return 0
+}
+
+// amount reads a KCN amount given as a number or a string
+func (p params) amount(i int) (rpc.Amount, error) {
+	switch v := p.get(i).(type) {
+	case json.Number:
+		return rpc.ParseAmount(v.String())
+	case string:
+		return rpc.ParseAmount(v)
+	}
+	return 0, &rpcError{Code: -3, Message: "Amount is not a number or string"}
+}
+
+func (p params) object(i int) map[string]interface{} {
+	m, _ := p.get(i).(map[string]interface{})
+	return m
+}
+
+func (p params) list(i int) []interface{} {
+	l, _ := p.get(i).([]interface{})
+	return l
+}
+
+// masterFingerprint is the demo wallet's BIP32 master key fingerprint
+var masterFingerprint = hex.EncodeToString(keyHash(seedKey("master"))[:4])
@@ -0,0 +1,307 @@
+package demo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Input sequence numbers: replaceable (BIP125) or final with the lock time
+// enabled
+const (
+	sequenceReplaceable = wire.MaxTxInSequenceNum - 2
+	sequenceFinal       = wire.MaxTxInSequenceNum - 1
+)
+
+// decodeTx parses a hex transaction. Unsigned transactions are read
+// without witness, as a transaction with no inputs looks like a witness
+// marker otherwise.
+func decodeTx(rawHex string, witness bool) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(rawHex)
+	var msg wire.MsgTx
+	if err == nil {
+		if witness {
+			err = msg.Deserialize(bytes.NewReader(raw))
+		} else {
+			err = msg.DeserializeNoWitness(bytes.NewReader(raw))
+		}
+	}
+	if err != nil {
+		return nil, &rpcError{Code: -22, Message: "TX decode failed"}
+	}
+	return &msg, nil
+}
+
+func encodeTx(msg *wire.MsgTx) string {
+	var buf bytes.Buffer
+	msg.Serialize(&buf)
+	return hex.EncodeToString(buf.Bytes())
+}
+
+func (n *Node) createRawTransaction(p params) (interface{}, error) {
+	msg := wire.NewMsgTx(2)
+	sequence := uint32(sequenceFinal)
+	if p.bool(3, false) {
+		sequence = sequenceReplaceable
+	}
+	for _, item := range p.list(0) {
+		m, _ := item.(map[string]interface{})
+		hash, err := chainhash.NewHashFromStr(rpc.GetString(m, "txid"))
+		if err != nil || len(rpc.GetString(m, "txid")) != 64 {
+			return nil, &rpcError{Code: -8, Message: "txid must be of length 64"}
+		}
+		in := wire.NewTxIn(wire.NewOutPoint(hash, uint32(rpc.GetInt(m, "vout"))), nil, nil)
+		in.Sequence = sequence
+		msg.AddTxIn(in)
+	}
+
+	// Outputs come as a list of single-key objects, or one object
+	var outputs []map[string]interface{}
+	switch v := p.get(1).(type) {
+	case []interface{}:
+		for _, item := range v {
+			m, _ := item.(map[string]interface{})
+			outputs = append(outputs, m)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			outputs = append(outputs, map[string]interface{}{k: v[k]})
+		}
+	}
+	for _, output := range outputs {
+		for k, v := range output {
+			if k == "data" {
+				data, err := hex.DecodeString(fmt.Sprint(v))
+				script, scriptErr := txscript.NullDataScript(data)
+				if err != nil || scriptErr != nil {
+					return nil, &rpcError{Code: -8, Message: "Data must be hexadecimal string"}
+				}
+				msg.AddTxOut(wire.NewTxOut(0, script))
+				continue
+			}
+			addr, err := hdwallet.DecodeAddress(k)
+			if err != nil {
+				return nil, &rpcError{Code: -5, Message: "Invalid Kernelcoin address: " + k}
+			}
+			amount, err := params{v}.amount(0)
+			if err != nil || amount < 0 {
+				return nil, &rpcError{Code: -3, Message: "Invalid amount"}
+			}
+			script, _ := txscript.PayToAddrScript(addr)
+			msg.AddTxOut(wire.NewTxOut(int64(amount), script))
+		}
+	}
+	return encodeTx(msg), nil
+}
+
+// fundRawTransaction adds wallet coins and a change output to pay for a
+// transaction's outputs. Options: add_inputs, changeAddress, replaceable,
+// conf_target, fee_rate (kernels per vbyte) and subtractFeeFromOutputs.
+func (n *Node) fundRawTransaction(p params) (interface{}, error) {
+	msg, err := decodeTx(p.string(0), false)
+	if err != nil {
+		return nil, err
+	}
+	options := p.object(1)
+
+	coins := map[outpoint]coin{}
+	for _, c := range n.unspent() {
+		coins[c.outpoint] = c
+	}
+	preselected := []coin{}
+	for _, in := range msg.TxIn {
+		c, ok := coins[outpoint{in.PreviousOutPoint.Hash.String(), int(in.PreviousOutPoint.Index)}]
+		if !ok {
+			return nil, &rpcError{Code: -4, Message: "Input not found or already spent"}
+		}
+		preselected = append(preselected, c)
+	}
+	addInputs := true
+	if v, ok := options["add_inputs"].(bool); ok {
+		addInputs = v
+	}
+	sequence := uint32(sequenceReplaceable)
+	if v, ok := options["replaceable"].(bool); ok && !v {
+		sequence = sequenceFinal
+	}
+	feeRate := n.feeRate(params{options["conf_target"]}.int(0, 6))
+	rate := params{options["fee_rate"]}.float(0)
+	if rate > 0 {
+		feeRate = int64(rate + 0.999)
+	}
+
+	var changeScript []byte
+	if address, ok := options["changeAddress"].(string); ok {
+		addr, err := hdwallet.DecodeAddress(address)
+		if err != nil {
+			return nil, &rpcError{Code: -5, Message: "Change address must be a valid kernelcoin address"}
+		}
+		changeScript, _ = txscript.PayToAddrScript(addr)
+	}
+
+	// The fee comes out of the first output subtractFeeFromOutputs lists
+	subtractFrom := -1
+	if outputs := (params{options["subtractFeeFromOutputs"]}).list(0); len(outputs) > 0 {
+		subtractFrom = int(params(outputs).int(0, -1))
+		if subtractFrom < 0 || subtractFrom >= len(msg.TxOut) {
+			return nil, &rpcError{Code: -8, Message: "Invalid parameter, subtractFeeFromOutputs out of range"}
+		}
+	}
+
+	scripts := [][]byte{}
+	var amount rpc.Amount
+	for _, out := range msg.TxOut {
+		scripts = append(scripts, out.PkScript)
+		amount += rpc.Amount(out.Value)
+	}
+	f, err := n.fund(scripts, amount, preselected, !addInputs, subtractFrom >= 0, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if subtractFrom >= 0 {
+		msg.TxOut[subtractFrom].Value -= int64(f.subtracted)
+	}
+
+	for _, c := range f.coins[len(preselected):] {
+		hash, _ := chainhash.NewHashFromStr(c.txid)
+		msg.AddTxIn(wire.NewTxIn(wire.NewOutPoint(hash, uint32(c.vout)), nil, nil))
+	}
+	for _, in := range msg.TxIn {
+		in.Sequence = sequence
+	}
+	changePos := -1
+	if f.change > 0 {
+		changePos = len(msg.TxOut)
+		if changeScript == nil {
+			changeScript = n.newKey("", true, false).script
+		}
+		msg.AddTxOut(wire.NewTxOut(int64(f.change), changeScript))
+	}
+	return map[string]interface{}{
+		"hex":       encodeTx(msg),
+		"fee":       f.fee.Number(),
+		"changepos": changePos,
+	}, nil
+}
+
+// signRawTransactionWithWallet signs the inputs that spend wallet coins
+func (n *Node) signRawTransactionWithWallet(p params) (interface{}, error) {
+	msg, err := decodeTx(p.string(0), true)
+	if err != nil {
+		return nil, err
+	}
+
+	// The coin each input spends, if the wallet has it
+	prevOuts := make([]*txOut, len(msg.TxIn))
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, in := range msg.TxIn {
+		prev, ok := n.txByID[in.PreviousOutPoint.Hash.String()]
+		if !ok || int(in.PreviousOutPoint.Index) >= len(prev.outputs) {
+			continue
+		}
+		out := prev.outputs[in.PreviousOutPoint.Index]
+		if k, ok := n.keys[out.address]; ok {
+			prevOuts[i] = &out
+			fetcher.AddPrevOut(in.PreviousOutPoint, wire.NewTxOut(int64(out.amount), k.script))
+		}
+	}
+	sigHashes := txscript.NewTxSigHashes(msg, fetcher)
+
+	errors := []interface{}{}
+	for i, in := range msg.TxIn {
+		if prevOuts[i] == nil {
+			errors = append(errors, map[string]interface{}{
+				"txid":  in.PreviousOutPoint.Hash.String(),
+				"vout":  in.PreviousOutPoint.Index,
+				"error": "Input not found or already spent",
+			})
+			continue
+		}
+		k := n.keys[prevOuts[i].address]
+		switch txscript.GetScriptClass(k.script) {
+		case txscript.WitnessV0PubKeyHashTy:
+			in.Witness, err = txscript.WitnessSignature(msg, sigHashes, i, int64(prevOuts[i].amount), k.script, txscript.SigHashAll, k.priv, true)
+		default:
+			in.SignatureScript, err = txscript.SignatureScript(msg, i, k.script, txscript.SigHashAll, k.priv, true)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := map[string]interface{}{"hex": encodeTx(msg), "complete": len(errors) == 0}
+	if len(errors) > 0 {
+		result["errors"] = errors
+	}
+	return result, nil
+}
+
+// sendRawTransaction accepts any well-formed transaction; the wallet
+// records it if it pays or spends the wallet
+func (n *Node) sendRawTransaction(p params) (interface{}, error) {
+	msg, err := decodeTx(p.string(0), true)
+	if err != nil {
+		return nil, err
+	}
+	txid := msg.TxHash().String()
+	if _, ok := n.txByID[txid]; ok {
+		return txid, nil
+	}
+
+	coins := map[outpoint]coin{}
+	for _, c := range n.unspent() {
+		coins[c.outpoint] = c
+	}
+	tx := &walletTx{
+		txid:  txid,
+		time:  n.now(),
+		vsize: int64(msg.SerializeSizeStripped()*3+msg.SerializeSize()+3) / 4,
+	}
+	var in, out rpc.Amount
+	ours := false
+	for _, input := range msg.TxIn {
+		op := outpoint{input.PreviousOutPoint.Hash.String(), int(input.PreviousOutPoint.Index)}
+		if c, ok := coins[op]; ok {
+			tx.inputs = append(tx.inputs, op)
+			in += c.out.amount
+		}
+		if input.Sequence < wire.MaxTxInSequenceNum-1 {
+			tx.replaceable = true
+		}
+	}
+	for _, output := range msg.TxOut {
+		var address string
+		if _, addrs, _, err := txscript.ExtractPkScriptAddrs(output.PkScript, hdwallet.Params()); err == nil && len(addrs) == 1 {
+			address = addrs[0].EncodeAddress()
+		}
+		ours = ours || n.mine(address)
+		tx.outputs = append(tx.outputs, txOut{address: address, amount: rpc.Amount(output.Value)})
+		out += rpc.Amount(output.Value)
+	}
+	if len(tx.inputs) == len(msg.TxIn) && in >= out {
+		tx.fee = in - out
+	} else if len(tx.inputs) > 0 {
+		// Spending the wallet's coins with others' is beyond the demo
+		return nil, &rpcError{Code: -25, Message: "bad-txns-inputs-missingorspent"}
+	}
+
+	if ours || tx.fromMe() {
+		n.addTx(tx)
+	} else {
+		n.others++
+	}
+	return txid, nil
+}
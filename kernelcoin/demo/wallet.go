@@ -0,0 +1,471 @@
+package demo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// blockSpacing is the time between the blocks of the canned history
+	blockSpacing = 150 // seconds
+	blocksPerDay = 86400 / blockSpacing
+
+	// coinbaseMaturity is how many confirmations a mining reward needs
+	// before it can be spent
+	coinbaseMaturity = 100
+	blockReward      = 50 * rpc.KernelsPerKCN
+)
+
+// p2wpkhInputVSize and p2wpkhOutputVSize size change outputs, which always
+// pay P2WPKH addresses, and payments from outside the wallet
+var p2wpkhInputVSize, p2wpkhOutputVSize = func() (int64, int64) {
+	_, script := segwitAddress(seedKey("size"))
+	in, _ := hdwallet.InputVSize(script)
+	return in, hdwallet.OutputVSize(script)
+}()
+
+// key is a wallet key and the address the wallet gave out for it
+type key struct {
+	priv    *btcec.PrivateKey
+	address string
+	script  []byte
+	path    string // empty for imported keys
+	label   string
+	change  bool
+}
+
+// outpoint is a transaction output
+type outpoint struct {
+	txid string
+	vout int
+}
+
+// txOut is an output of a wallet transaction
+type txOut struct {
+	address string
+	amount  rpc.Amount
+}
+
+// walletTx is a transaction that pays or spends the wallet
+type walletTx struct {
+	txid   string
+	height int64 // 0 while unconfirmed
+	time   int64
+	// inputs are the wallet coins it spends; none for incoming payments
+	inputs  []outpoint
+	outputs []txOut
+	fee     rpc.Amount // the wallet reports it only when it paid it
+	vsize   int64
+
+	comment     string
+	commentTo   string
+	replaceable bool
+	coinbase    bool
+	abandoned   bool
+	replacedBy  string
+	conflicts   []string
+}
+
+// fromMe reports whether the wallet paid for tx
+func (tx *walletTx) fromMe() bool {
+	return len(tx.inputs) > 0
+}
+
+// live reports whether tx is still in the chain or mempool
+func (tx *walletTx) live() bool {
+	return !tx.abandoned && tx.replacedBy == ""
+}
+
+// seedKey derives a key from a name, so the demo wallet is the same on
+// every start
+func seedKey(name string) *btcec.PrivateKey {
+	sum := sha256.Sum256([]byte("kernelcoin demo wallet " + name))
+	priv, _ := btcec.PrivKeyFromBytes(sum[:])
+	return priv
+}
+
+// keyHash is the HASH160 of priv's compressed public key
+func keyHash(priv *btcec.PrivateKey) []byte {
+	return btcutil.Hash160(priv.PubKey().SerializeCompressed())
+}
+
+// segwitAddress returns the P2WPKH address of priv and its script
+func segwitAddress(priv *btcec.PrivateKey) (string, []byte) {
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(keyHash(priv), hdwallet.Params())
+	if err != nil {
+		panic(err)
+	}
+	script, _ := txscript.PayToAddrScript(addr)
+	return addr.EncodeAddress(), script
+}
+
+// legacyAddress returns the P2PKH address of priv and its script
+func legacyAddress(priv *btcec.PrivateKey) (string, []byte) {
+	addr, err := btcutil.NewAddressPubKeyHash(keyHash(priv), hdwallet.Params())
+	if err != nil {
+		panic(err)
+	}
+	script, _ := txscript.PayToAddrScript(addr)
+	return addr.EncodeAddress(), script
+}
+
+// newKey derives the next receive or change key and adds its address to
+// the wallet
+func (n *Node) newKey(label string, change, legacy bool) *key {
+	branch, index := 0, n.receiveKeys
+	if change {
+		branch, index = 1, n.changeKeys
+		n.changeKeys++
+	} else {
+		n.receiveKeys++
+	}
+	k := &key{
+		priv:   seedKey(fmt.Sprintf("%d/%d", branch, index)),
+		path:   fmt.Sprintf("m/84'/2'/0'/%d/%d", branch, index),
+		label:  label,
+		change: change,
+	}
+	if legacy {
+		k.address, k.script = legacyAddress(k.priv)
+	} else {
+		k.address, k.script = segwitAddress(k.priv)
+	}
+	n.keys[k.address] = k
+	n.addresses = append(n.addresses, k.address)
+	return k
+}
+
+// externalAddress returns an address outside the wallet
+func (n *Node) externalAddress() string {
+	addr, _ := segwitAddress(seedKey(fmt.Sprintf("external %d", n.rand.Int63())))
+	return addr
+}
+
+// newTxid returns a random transaction ID
+func (n *Node) newTxid() string {
+	var b [32]byte
+	n.rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (n *Node) addTx(tx *walletTx) {
+	n.txs = append(n.txs, tx)
+	n.txByID[tx.txid] = tx
+}
+
+// confirmations returns how deep tx is in the chain
+func (n *Node) confirmations(tx *walletTx) int64 {
+	if tx.height == 0 {
+		return 0
+	}
+	return n.height - tx.height + 1
+}
+
+// mine reports whether address belongs to the wallet
+func (n *Node) mine(address string) bool {
+	_, ok := n.keys[address]
+	return ok
+}
+
+// coin is an unspent wallet output
+type coin struct {
+	outpoint
+	tx     *walletTx
+	out    txOut
+	script []byte
+}
+
+// unspent returns the wallet's unspent outputs, in history order
+func (n *Node) unspent() []coin {
+	spent := map[outpoint]bool{}
+	for _, tx := range n.txs {
+		if tx.live() {
+			for _, in := range tx.inputs {
+				spent[in] = true
+			}
+		}
+	}
+	coins := []coin{}
+	for _, tx := range n.txs {
+		if !tx.live() {
+			continue
+		}
+		for vout, out := range tx.outputs {
+			op := outpoint{tx.txid, vout}
+			if k, ok := n.keys[out.address]; ok && !spent[op] {
+				coins = append(coins, coin{outpoint: op, tx: tx, out: out, script: k.script})
+			}
+		}
+	}
+	return coins
+}
+
+// immature reports whether c is a mining reward that cannot be spent yet
+func (n *Node) immature(c coin) bool {
+	return c.tx.coinbase && n.confirmations(c.tx) < coinbaseMaturity
+}
+
+// safe reports whether the wallet will spend c: it is confirmed, or the
+// wallet's own unconfirmed change
+func (n *Node) safe(c coin) bool {
+	return n.confirmations(c.tx) > 0 || c.tx.fromMe()
+}
+
+// balances returns getbalances' trusted, untrusted_pending and immature
+func (n *Node) balances() (trusted, pending, immature rpc.Amount) {
+	for _, c := range n.unspent() {
+		switch {
+		case n.immature(c):
+			immature += c.out.amount
+		case n.safe(c):
+			trusted += c.out.amount
+		default:
+			pending += c.out.amount
+		}
+	}
+	return trusted, pending, immature
+}
+
+// receive records a payment from outside the wallet to a new address
+func (n *Node) receive(label string, amount rpc.Amount) *walletTx {
+	to := n.newKey(label, false, false).address
+	outputs := []txOut{{address: to, amount: amount}}
+	// Most payments come with the sender's change
+	if n.rand.Intn(3) > 0 {
+		change := txOut{address: n.externalAddress(), amount: rpc.Amount(n.rand.Int63n(20 * rpc.KernelsPerKCN))}
+		if n.rand.Intn(2) == 0 {
+			outputs = append(outputs, change)
+		} else {
+			outputs = append([]txOut{change}, outputs...)
+		}
+	}
+	tx := &walletTx{
+		txid:        n.newTxid(),
+		time:        n.now(),
+		outputs:     outputs,
+		vsize:       hdwallet.TxOverheadVSize + p2wpkhInputVSize + p2wpkhOutputVSize*int64(len(outputs)),
+		replaceable: n.rand.Intn(2) == 0,
+	}
+	tx.fee = rpc.Amount(tx.vsize * (1 + n.rand.Int63n(5)))
+	n.addTx(tx)
+	return tx
+}
+
+// sendRequest is a payment the wallet makes
+type sendRequest struct {
+	to          string
+	amount      rpc.Amount
+	subtractFee bool
+	replaceable bool
+	comment     string
+	commentTo   string
+	feeRate     int64 // kernels per vbyte
+}
+
+// funding is the coins chosen to pay for some outputs, and what is left
+type funding struct {
+	coins []coin
+	fee   rpc.Amount
+	// subtracted is the part of the fee taken from the amount paid
+	subtracted rpc.Amount
+	// change is zero when it would have been dust, which goes to the fee
+	change rpc.Amount
+	vsize  int64
+}
+
+// fund selects coins to pay amount to outputs with the given scripts, the
+// way the node's wallet does: the preselected coins, then unless fixed
+// the largest spendable ones until there is enough. With subtractFee the
+// fee comes out of amount, and the caller pays amount-subtracted.
+func (n *Node) fund(scripts [][]byte, amount rpc.Amount, preselected []coin, fixed, subtractFee bool, feeRate int64) (*funding, error) {
+	candidates := append([]coin(nil), preselected...)
+	if !fixed {
+		chosen := map[outpoint]bool{}
+		for _, c := range preselected {
+			chosen[c.outpoint] = true
+		}
+		spendable := []coin{}
+		for _, c := range n.unspent() {
+			if !n.immature(c) && n.safe(c) && !n.locked[c.outpoint] && !chosen[c.outpoint] {
+				spendable = append(spendable, c)
+			}
+		}
+		sort.SliceStable(spendable, func(i, j int) bool { return spendable[i].out.amount > spendable[j].out.amount })
+		candidates = append(candidates, spendable...)
+	}
+
+	// The change output is counted from the start; it is dropped below if
+	// it would be dust
+	f := &funding{vsize: hdwallet.TxOverheadVSize + p2wpkhOutputVSize}
+	for _, script := range scripts {
+		f.vsize += hdwallet.OutputVSize(script)
+	}
+	var total rpc.Amount
+	funded := false
+	for i, c := range candidates {
+		inSize, err := hdwallet.InputVSize(c.script)
+		if err != nil {
+			continue
+		}
+		f.coins = append(f.coins, c)
+		total += c.out.amount
+		f.vsize += inSize
+		f.fee = rpc.Amount(f.vsize * feeRate)
+		if i+1 >= len(preselected) && ((subtractFee && total >= amount) || total >= amount+f.fee) {
+			funded = true
+			break
+		}
+	}
+	if !funded {
+		return nil, &rpcError{Code: -6, Message: "Insufficient funds"}
+	}
+
+	if subtractFee {
+		f.subtracted = f.fee
+	}
+	f.change = total - amount - f.fee + f.subtracted
+	if f.change < hdwallet.DustThreshold {
+		f.fee += f.change
+		f.change = 0
+		f.vsize -= p2wpkhOutputVSize
+	}
+	return f, nil
+}
+
+// send pays req like sendtoaddress, returning the change to a new change
+// address
+func (n *Node) send(req sendRequest) (*walletTx, error) {
+	dest, err := hdwallet.DecodeAddress(req.to)
+	if err != nil {
+		return nil, &rpcError{Code: -5, Message: "Invalid address"}
+	}
+	if req.amount <= 0 {
+		return nil, &rpcError{Code: -3, Message: "Invalid amount for send"}
+	}
+	destScript, _ := txscript.PayToAddrScript(dest)
+	f, err := n.fund([][]byte{destScript}, req.amount, nil, false, req.subtractFee, req.feeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	pay := req.amount - f.subtracted
+	if pay < hdwallet.DustThreshold {
+		return nil, &rpcError{Code: -6, Message: "The transaction amount is too small to pay the fee"}
+	}
+	outputs := []txOut{{address: req.to, amount: pay}}
+	if f.change > 0 {
+		outputs = append(outputs, txOut{address: n.newKey("", true, false).address, amount: f.change})
+	}
+
+	tx := &walletTx{
+		txid:        n.newTxid(),
+		time:        n.now(),
+		outputs:     outputs,
+		fee:         f.fee,
+		vsize:       f.vsize,
+		comment:     req.comment,
+		commentTo:   req.commentTo,
+		replaceable: req.replaceable,
+	}
+	for _, c := range f.coins {
+		tx.inputs = append(tx.inputs, c.outpoint)
+	}
+	n.addTx(tx)
+	return tx, nil
+}
+
+// bump replaces the unconfirmed tx with a copy paying fee, taken from its
+// change, as bumpfee does
+func (n *Node) bump(tx *walletTx, fee rpc.Amount) (*walletTx, error) {
+	changeAt := -1
+	for i, out := range tx.outputs {
+		if k, ok := n.keys[out.address]; ok && k.change {
+			changeAt = i
+		}
+	}
+	if changeAt < 0 {
+		return nil, &rpcError{Code: -4, Message: "Transaction does not have a change output"}
+	}
+	outputs := append([]txOut(nil), tx.outputs...)
+	outputs[changeAt].amount -= fee - tx.fee
+	if outputs[changeAt].amount < hdwallet.DustThreshold {
+		return nil, &rpcError{Code: -4, Message: "Change output is too small to bump the fee"}
+	}
+
+	replacement := *tx
+	replacement.txid = n.newTxid()
+	replacement.time = n.now()
+	replacement.outputs = outputs
+	replacement.fee = fee
+	replacement.conflicts = []string{tx.txid}
+	tx.replacedBy = replacement.txid
+	tx.conflicts = append(tx.conflicts, replacement.txid)
+	n.addTx(&replacement)
+	return &replacement, nil
+}
+
+// coinbase records a mining reward paid to address at height
+func (n *Node) coinbase(address string, height int64) {
+	n.addTx(&walletTx{
+		txid:     n.newTxid(),
+		height:   height,
+		time:     n.blockTime(height),
+		outputs:  []txOut{{address: address, amount: blockReward}},
+		coinbase: true,
+	})
+}
+
+// buildHistory fills the wallet with a few weeks of activity, ending with
+// a payment still in the mempool
+func (n *Node) buildHistory() {
+	at := func(tx *walletTx, daysAgo float64) {
+		tx.height = n.height - int64(daysAgo*blocksPerDay)
+		tx.time = n.blockTime(tx.height)
+	}
+	kcn := func(s string) rpc.Amount {
+		a, err := rpc.ParseAmount(s)
+		if err != nil {
+			panic(err)
+		}
+		return a
+	}
+	sendAt := func(daysAgo float64, amount, comment, commentTo string) {
+		tx, err := n.send(sendRequest{
+			to:          n.externalAddress(),
+			amount:      kcn(amount),
+			replaceable: true,
+			comment:     comment,
+			commentTo:   commentTo,
+			feeRate:     2,
+		})
+		if err != nil {
+			panic(err)
+		}
+		at(tx, daysAgo)
+	}
+
+	n.coinbase(n.newKey("Mining", false, false).address, n.height-int64(44*blocksPerDay))
+	at(n.receive("Exchange withdrawal", kcn("12.5")), 42)
+	at(n.receive("", kcn("3.2")), 38)
+	sendAt(35, "2.75", "Rent share", "Sam")
+	at(n.receive("Donations", kcn("0.845")), 30)
+	sendAt(26, "5", "", "")
+	at(n.receive("", kcn("7.31")), 20)
+	sendAt(15, "1.2", "Hosting", "")
+	at(n.receive("Donations", kcn("0.5")), 12)
+	sendAt(9, "0.3337", "", "")
+	at(n.receive("Invoice #1042", kcn("2")), 5)
+	sendAt(2, "4.1", "Hardware", "Parts shop")
+	at(n.receive("", kcn("0.0421")), 1)
+	n.coinbase(n.newKey("Mining", false, false).address, n.height-40)
+	n.receive("", kcn("1.5"))
+}
@@ -0,0 +1,187 @@
+package hdwallet
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"golang.org/x/crypto/scrypt"
+)
+
+// BIP38 encrypted keys are base58check with a two-byte prefix, so they start
+// with "6P". The first prefix byte is passed to base58 as the version.
+const (
+	bip38Version        = 0x01
+	bip38NonECMultiply  = 0x42
+	bip38ECMultiply     = 0x43
+	bip38FlagCompressed = 0x20
+	bip38FlagLotNumber  = 0x04
+	bip38FlagNonEC      = 0xc0
+	bip38PayloadSize    = 38 // after the version byte
+)
+
+// bip38Scrypt is scrypt with BIP38's parameters for the passphrase
+func bip38Scrypt(passphrase, salt []byte, keyLen int) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, 16384, 8, 8, keyLen)
+}
+
+// bip38AddressHash is the checksum of the key's P2PKH address that lets
+// decryption tell a wrong passphrase
+func bip38AddressHash(privKey *btcec.PrivateKey, compressed bool) ([]byte, error) {
+	pubKey := privKey.PubKey().SerializeUncompressed()
+	if compressed {
+		pubKey = privKey.PubKey().SerializeCompressed()
+	}
+	addr, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubKey), activeParams)
+	if err != nil {
+		return nil, err
+	}
+	return chainhash256([]byte(addr.EncodeAddress()))[:4], nil
+}
+
+// chainhash256 is double SHA-256
+func chainhash256(b []byte) []byte {
+	first := sha256.Sum256(b)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// xorAES encrypts or decrypts one 16-byte block with AES-256, XORing the
+// plaintext side with mask
+func xorAES(key, block, mask []byte, decrypt bool) []byte {
+	c, _ := aes.NewCipher(key) // key is always 32 bytes
+	out := make([]byte, 16)
+	if decrypt {
+		c.Decrypt(out, block)
+		for i := range out {
+			out[i] ^= mask[i]
+		}
+		return out
+	}
+	in := make([]byte, 16)
+	for i := range in {
+		in[i] = block[i] ^ mask[i]
+	}
+	c.Encrypt(out, in)
+	return out
+}
+
+// EncryptBIP38 encrypts a private key with a passphrase (BIP38, without EC
+// multiplication). Passphrases are used as given, not NFC-normalized.
+func EncryptBIP38(wif *btcutil.WIF, passphrase string) (string, error) {
+	addressHash, err := bip38AddressHash(wif.PrivKey, wif.CompressPubKey)
+	if err != nil {
+		return "", err
+	}
+	derived, err := bip38Scrypt([]byte(passphrase), addressHash, 64)
+	if err != nil {
+		return "", err
+	}
+
+	key := wif.PrivKey.Serialize()
+	flag := byte(bip38FlagNonEC)
+	if wif.CompressPubKey {
+		flag |= bip38FlagCompressed
+	}
+	payload := []byte{bip38NonECMultiply, flag}
+	payload = append(payload, addressHash...)
+	payload = append(payload, xorAES(derived[32:], key[:16], derived[:16], false)...)
+	payload = append(payload, xorAES(derived[32:], key[16:], derived[16:32], false)...)
+	return base58.CheckEncode(payload, bip38Version), nil
+}
+
+// DecryptBIP38 decrypts a BIP38 key, made either directly from a private
+// key or by EC multiplication from an intermediate code (as paper wallet
+// generators do)
+func DecryptBIP38(encrypted, passphrase string) (*btcutil.WIF, error) {
+	payload, version, err := base58.CheckDecode(encrypted)
+	if err != nil || version != bip38Version || len(payload) != bip38PayloadSize {
+		return nil, errors.New("not a BIP38 encrypted key")
+	}
+	flag := payload[1]
+	compressed := flag&bip38FlagCompressed != 0
+	addressHash := payload[2:6]
+
+	var privKey *btcec.PrivateKey
+	switch payload[0] {
+	case bip38NonECMultiply:
+		derived, err := bip38Scrypt([]byte(passphrase), addressHash, 64)
+		if err != nil {
+			return nil, err
+		}
+		key := append(xorAES(derived[32:], payload[6:22], derived[:16], true),
+			xorAES(derived[32:], payload[22:38], derived[16:32], true)...)
+		privKey, _ = btcec.PrivKeyFromBytes(key)
+
+	case bip38ECMultiply:
+		ownerEntropy := payload[6:14]
+		ownerSalt := ownerEntropy
+		if flag&bip38FlagLotNumber != 0 {
+			ownerSalt = ownerEntropy[:4]
+		}
+		passFactor, err := bip38Scrypt([]byte(passphrase), ownerSalt, 32)
+		if err != nil {
+			return nil, err
+		}
+		if flag&bip38FlagLotNumber != 0 {
+			passFactor = chainhash256(append(passFactor, ownerEntropy...))
+		}
+		passKey, _ := btcec.PrivKeyFromBytes(passFactor)
+		derived, err := scrypt.Key(passKey.PubKey().SerializeCompressed(), payload[2:14], 1024, 1, 1, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		// encryptedpart2 holds the second half of encryptedpart1 and the
+		// end of seedb
+		part2 := xorAES(derived[32:], payload[22:38], derived[16:32], true)
+		part1 := xorAES(derived[32:], append(append([]byte(nil), payload[14:22]...), part2[:8]...), derived[:16], true)
+		seedB := append(part1, part2[8:]...)
+
+		var factor, key btcec.ModNScalar
+		factor.SetByteSlice(chainhash256(seedB))
+		key.SetByteSlice(passFactor)
+		key.Mul(&factor)
+		keyBytes := key.Bytes()
+		privKey, _ = btcec.PrivKeyFromBytes(keyBytes[:])
+
+	default:
+		return nil, errors.New("not a BIP38 encrypted key")
+	}
+
+	check, err := bip38AddressHash(privKey, compressed)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(check, addressHash) {
+		return nil, errors.New("wrong passphrase")
+	}
+	return btcutil.NewWIF(privKey, activeParams, compressed)
+}
+
+// IsBIP38 reports whether key looks like a BIP38 encrypted key
+func IsBIP38(key string) bool {
+	return strings.HasPrefix(key, "6P") && len(key) == 58
+}
+
+// DecryptKeyInput returns key as WIF, decrypting it with passphrase first
+// if it is a BIP38 key
+func DecryptKeyInput(key, passphrase string) (string, error) {
+	if !IsBIP38(key) {
+		return key, nil
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the key is BIP38 encrypted: a passphrase is needed")
+	}
+	wif, err := DecryptBIP38(key, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return wif.String(), nil
+}
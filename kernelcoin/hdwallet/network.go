@@ -0,0 +1,111 @@
+package hdwallet
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// KernelcoinParams defines the network parameters for Kernelcoin mainnet
+var KernelcoinParams = chaincfg.Params{
+	Name: "kernelcoin",
+	Net:  0xf1c8d2fd, // Message start: 0xfd, 0xd2, 0xc8, 0xf1
+
+	// Address encoding prefixes
+	PubKeyHashAddrID:        45,   // K
+	ScriptHashAddrID:        23,   // A
+	PrivateKeyID:            28,   // C
+	WitnessPubKeyHashAddrID: 0x06, // bc1 equivalent for kcn
+	WitnessScriptHashAddrID: 0x0A, // bc1 equivalent for kcn
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x77, 0x88, 0xad, 0xe4}, // EXT_SECRET_KEY
+	HDPublicKeyID:  [4]byte{0x77, 0x88, 0xb2, 0x1e}, // EXT_PUBLIC_KEY
+
+	// Human-readable part for Bech32 encoded addresses
+	Bech32HRPSegwit: "kcn",
+}
+
+// KernelcoinTestnetParams defines the network parameters for Kernelcoin
+// testnet
+var KernelcoinTestnetParams = chaincfg.Params{
+	Name: "kernelcoin-testnet",
+	Net:  0xdcb7c1fc, // Message start: 0xfc, 0xc1, 0xb7, 0xdc
+
+	// Address encoding prefixes
+	PubKeyHashAddrID:        111, // m or n
+	ScriptHashAddrID:        58,  // Q
+	PrivateKeyID:            239, // c
+	WitnessPubKeyHashAddrID: 0x06,
+	WitnessScriptHashAddrID: 0x0A,
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+
+	// Human-readable part for Bech32 encoded addresses
+	Bech32HRPSegwit: "tkcn",
+}
+
+// KernelcoinRegtestParams defines the network parameters for Kernelcoin
+// regtest. Only the magic and bech32 prefix differ from testnet.
+var KernelcoinRegtestParams = chaincfg.Params{
+	Name: "kernelcoin-regtest",
+	Net:  0xdab5bffb, // Message start: 0xfb, 0xbf, 0xb5, 0xda
+
+	// Address encoding prefixes
+	PubKeyHashAddrID:        111, // m or n
+	ScriptHashAddrID:        58,  // Q
+	PrivateKeyID:            239, // c
+	WitnessPubKeyHashAddrID: 0x06,
+	WitnessScriptHashAddrID: 0x0A,
+
+	// BIP32 hierarchical deterministic extended key magics
+	HDPrivateKeyID: [4]byte{0x04, 0x35, 0x83, 0x94}, // tprv
+	HDPublicKeyID:  [4]byte{0x04, 0x35, 0x87, 0xcf}, // tpub
+
+	// Human-readable part for Bech32 encoded addresses
+	Bech32HRPSegwit: "rkcn",
+}
+
+// networks are the parameter sets by the names kernelcoind's getblockchaininfo
+// reports
+var networks = map[string]*chaincfg.Params{
+	"main":    &KernelcoinParams,
+	"test":    &KernelcoinTestnetParams,
+	"regtest": &KernelcoinRegtestParams,
+}
+
+// activeNetwork is the network keys and addresses are made for, and the
+// only one whose keys and addresses are accepted; see UseNetwork
+var (
+	activeNetwork = "main"
+	activeParams  = &KernelcoinParams
+)
+
+func init() {
+	// btcutil only decodes bech32 addresses whose prefix belongs to a
+	// registered network
+	for _, params := range []*chaincfg.Params{&KernelcoinParams, &KernelcoinTestnetParams, &KernelcoinRegtestParams} {
+		if err := chaincfg.Register(params); err != nil {
+			panic(fmt.Sprintf("failed to register %s network parameters: %v", params.Name, err))
+		}
+	}
+}
+
+// UseNetwork switches the package to network (main, test or regtest):
+// the keys and addresses it makes, and the ones it accepts, are that
+// network's from then on. Call it once at startup, before any are made.
+func UseNetwork(network string) error {
+	params, ok := networks[network]
+	if !ok {
+		return fmt.Errorf("unknown network %q: must be main, test or regtest", network)
+	}
+	activeNetwork, activeParams = network, params
+	return nil
+}
+
+// Params returns the parameters of the network in use
+func Params() *chaincfg.Params {
+	return activeParams
+}
@@ -0,0 +1,269 @@
+package hdwallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DustThreshold is the smallest output (in kernels) the builder will create;
+// smaller change is added to the fee instead
+const DustThreshold = 546
+
+// Estimated virtual sizes (vbytes) used to size fees before signing
+const (
+	TxOverheadVSize   = 11
+	p2pkhInputVSize   = 148
+	p2wpkhInputVSize  = 68
+	p2pkhOutputVSize  = 34
+	p2shOutputVSize   = 32
+	p2wpkhOutputVSize = 31
+	p2wshOutputVSize  = 43
+)
+
+// LocalUTXO is an output spendable by a locally held key
+type LocalUTXO struct {
+	OutPoint wire.OutPoint
+	Value    int64
+	PkScript []byte
+}
+
+// LocalTransaction is a fully signed transaction built by BuildSignedTransaction
+type LocalTransaction struct {
+	Tx     *wire.MsgTx
+	Fee    int64
+	Change int64
+	VSize  int64
+}
+
+// DecodeAddress parses an address and checks it belongs to the network in
+// use
+func DecodeAddress(address string) (btcutil.Address, error) {
+	addr, err := btcutil.DecodeAddress(address, activeParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if !addr.IsForNet(activeParams) {
+		return nil, fmt.Errorf("address %q is not for Kernelcoin %s", address, activeNetwork)
+	}
+	return addr, nil
+}
+
+// InputVSize returns the estimated signed size of an input spending pkScript
+func InputVSize(pkScript []byte) (int64, error) {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.PubKeyHashTy:
+		return p2pkhInputVSize, nil
+	case txscript.WitnessV0PubKeyHashTy:
+		return p2wpkhInputVSize, nil
+	default:
+		return 0, fmt.Errorf("unsupported input script type %s", txscript.GetScriptClass(pkScript))
+	}
+}
+
+// OutputVSize returns the serialized size of an output paying to pkScript
+func OutputVSize(pkScript []byte) int64 {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.WitnessV0PubKeyHashTy:
+		return p2wpkhOutputVSize
+	case txscript.WitnessV0ScriptHashTy:
+		return p2wshOutputVSize
+	case txscript.ScriptHashTy:
+		return p2shOutputVSize
+	default:
+		return p2pkhOutputVSize
+	}
+}
+
+// BuildSignedTransaction selects inputs from utxos (largest first), pays
+// amount kernels to toAddress, returns change to changeAddress and signs
+// every input with key. feeRate is in kernels per vbyte.
+func BuildSignedTransaction(key *btcec.PrivateKey, compressed bool, utxos []LocalUTXO,
+	toAddress string, amount int64, feeRate int64, changeAddress string) (*LocalTransaction, error) {
+
+	if amount < DustThreshold {
+		return nil, fmt.Errorf("amount %d is below the dust threshold of %d kernels", amount, DustThreshold)
+	}
+	if feeRate < 1 {
+		feeRate = 1
+	}
+
+	toAddr, err := DecodeAddress(toAddress)
+	if err != nil {
+		return nil, err
+	}
+	toScript, err := txscript.PayToAddrScript(toAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build output script: %w", err)
+	}
+
+	changeAddr, err := DecodeAddress(changeAddress)
+	if err != nil {
+		return nil, err
+	}
+	changeScript, err := txscript.PayToAddrScript(changeAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build change script: %w", err)
+	}
+
+	// Largest-first keeps the input count (and fee) low
+	sorted := append([]LocalUTXO(nil), utxos...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value > sorted[j].Value })
+
+	baseVSize := int64(TxOverheadVSize) + OutputVSize(toScript) + OutputVSize(changeScript)
+	selected := []LocalUTXO{}
+	var total, vsize, fee int64
+	for _, utxo := range sorted {
+		size, err := InputVSize(utxo.PkScript)
+		if err != nil {
+			continue
+		}
+		selected = append(selected, utxo)
+		total += utxo.Value
+		vsize += size
+		fee = (baseVSize + vsize) * feeRate
+		if total >= amount+fee {
+			break
+		}
+	}
+	if total < amount+fee {
+		return nil, fmt.Errorf("insufficient funds: have %d kernels, need %d plus %d fee", total, amount, fee)
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	for _, utxo := range selected {
+		outPoint := utxo.OutPoint
+		tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(amount, toScript))
+
+	change := total - amount - fee
+	if change >= DustThreshold {
+		tx.AddTxOut(wire.NewTxOut(change, changeScript))
+	} else {
+		// Not worth an output: leave it to the miner and drop the change size
+		vsize -= OutputVSize(changeScript)
+		fee += change
+		change = 0
+	}
+
+	if err := signLocalInputs(tx, selected, key, compressed); err != nil {
+		return nil, err
+	}
+
+	return &LocalTransaction{
+		Tx:     tx,
+		Fee:    fee,
+		Change: change,
+		VSize:  baseVSize + vsize,
+	}, nil
+}
+
+// BuildSweepTransaction spends every utxo key can sign for to toAddress in
+// a single output, less the fee. feeRate is in kernels per vbyte.
+func BuildSweepTransaction(key *btcec.PrivateKey, compressed bool, utxos []LocalUTXO,
+	toAddress string, feeRate int64) (*LocalTransaction, error) {
+
+	if feeRate < 1 {
+		feeRate = 1
+	}
+
+	toAddr, err := DecodeAddress(toAddress)
+	if err != nil {
+		return nil, err
+	}
+	toScript, err := txscript.PayToAddrScript(toAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build output script: %w", err)
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	selected := []LocalUTXO{}
+	vsize := int64(TxOverheadVSize) + OutputVSize(toScript)
+	var total int64
+	for _, utxo := range utxos {
+		size, err := InputVSize(utxo.PkScript)
+		if err != nil {
+			continue
+		}
+		outPoint := utxo.OutPoint
+		tx.AddTxIn(wire.NewTxIn(&outPoint, nil, nil))
+		selected = append(selected, utxo)
+		total += utxo.Value
+		vsize += size
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no spendable outputs")
+	}
+
+	fee := vsize * feeRate
+	if total-fee < DustThreshold {
+		return nil, fmt.Errorf("%d kernels is not enough to pay the %d kernel fee", total, fee)
+	}
+	tx.AddTxOut(wire.NewTxOut(total-fee, toScript))
+
+	if err := signLocalInputs(tx, selected, key, compressed); err != nil {
+		return nil, err
+	}
+
+	return &LocalTransaction{
+		Tx:    tx,
+		Fee:   fee,
+		VSize: vsize,
+	}, nil
+}
+
+// signLocalInputs signs every input of tx (spending prevOuts, in order) with
+// key and verifies the result with the script engine
+func signLocalInputs(tx *wire.MsgTx, prevOuts []LocalUTXO, key *btcec.PrivateKey, compressed bool) error {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for _, prev := range prevOuts {
+		fetcher.AddPrevOut(prev.OutPoint, wire.NewTxOut(prev.Value, prev.PkScript))
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	for i, prev := range prevOuts {
+		switch txscript.GetScriptClass(prev.PkScript) {
+		case txscript.PubKeyHashTy:
+			sigScript, err := txscript.SignatureScript(tx, i, prev.PkScript, txscript.SigHashAll, key, compressed)
+			if err != nil {
+				return fmt.Errorf("failed to sign input %d: %w", i, err)
+			}
+			tx.TxIn[i].SignatureScript = sigScript
+		case txscript.WitnessV0PubKeyHashTy:
+			witness, err := txscript.WitnessSignature(tx, sigHashes, i, prev.Value, prev.PkScript, txscript.SigHashAll, key, true)
+			if err != nil {
+				return fmt.Errorf("failed to sign input %d: %w", i, err)
+			}
+			tx.TxIn[i].Witness = witness
+		default:
+			return fmt.Errorf("cannot sign input %d: unsupported script type", i)
+		}
+	}
+
+	for i, prev := range prevOuts {
+		vm, err := txscript.NewEngine(prev.PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prev.Value, fetcher)
+		if err != nil {
+			return fmt.Errorf("failed to verify input %d: %w", i, err)
+		}
+		if err := vm.Execute(); err != nil {
+			return fmt.Errorf("signature check failed for input %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// SerializeTx returns the hex encoding of a transaction
+func SerializeTx(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
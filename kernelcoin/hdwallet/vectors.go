@@ -0,0 +1,73 @@
+package hdwallet
+
+import "fmt"
+
+// TestVector is a key derived from a mnemonic, with the WIF and addresses
+// a correct build gets for it. A wrong network parameter, BIP32 library or
+// BIP39 word list shows up as a vector that no longer matches.
+type TestVector struct {
+	Network       string `json:"network"` // main, test or regtest
+	Mnemonic      string `json:"mnemonic"`
+	Path          string `json:"path"`
+	WIF           string `json:"wif"`
+	LegacyAddress string `json:"legacy_address"`
+	SegWitAddress string `json:"segwit_address"`
+}
+
+// The mnemonics are BIP39's own test vectors (with an empty passphrase)
+const (
+	vectorAbandon = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	vectorLegal   = "legal winner thank year wave sausage worth useful legal winner thank yellow"
+	vectorLetter  = "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"
+	vectorZoo     = "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"
+	vectorArt     = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon " +
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"
+)
+
+// TestVectors are the known derivations. Kernelcoin shares Litecoin's coin
+// type, so the key hashes are Litecoin's published ones for the same paths
+// (vectorAbandon's m/44'/2'/0'/0/0 is LUWPbpM43E2p7ZSh8cyTBEkvpHmr3cB8Ez
+// there); only the address and WIF prefixes are Kernelcoin's. Testnet and
+// regtest keys are the same, and their addresses differ only in bech32
+// prefix.
+var TestVectors = []TestVector{
+	{"main", vectorAbandon, "m/44'/2'/0'/0/0", "5BmjoqBHxMvuvNbLjys1yYchE18GoXTgKsMEsaHGxJEsTjbyVKTr", "KGVaeVTBugeBfG2S4MyVirwZvn11ryD7d1", "kcn1qvh20q3zqd8ecsy3puf9md2vmr4f7qzx0lvt7d2"},
+	{"main", vectorAbandon, "m/44'/2'/0'/0/1", "5AasADirNZ6P6p8vQ3mfqxyzCYZKWYQiCUWCbxMCKd7UgkBMZvQ5", "KRa5yofsYosk2Vf2H76UDq3NtBLzpz1WVt", "kcn1qe95rsmq6evahegkz7t5mqw67c3gw4qrggnggu6"},
+	{"main", vectorAbandon, "m/44'/2'/0'/1/0", "5HhEVdarxgL3FPvk5ibUH7g9iAN98YhmmcHNsbBoxTi5A2g3Rb1c", "KBBqzTyD6Wnd16i7ebDAQvkBNB8h4Qwqaq", "kcn1q9ws6ryatydx9pkug42pq4902c29q75avuex2mk"},
+	{"main", vectorAbandon, "m/44'/2'/1'/0/0", "5CbUFmDQcjtwGJiFv89XEg5PnF3Um9VbpmUFXxWEPW3cNPDFgQMt", "KLAxpNPaVB2mdT4cANyCobB8a5YvBx1m42", "kcn1q3ccqh9tsaww9q4vjreslugsgjcm8fuslvstymz"},
+	{"main", vectorAbandon, "m/84'/2'/0'/0/0", "5Bjsvp1hd9Vt5jnLwVKm87aFSjLZenk8sK8yhb3WZuJAnVTiy7qd", "KLxWUjotwsE8iDNdqJSCdwziZouKYn7r1q", "kcn1qjmxnz78nmc8nq77wuxh25n2es7rzm5c25ej4g7"},
+	{"main", vectorAbandon, "m/0/0", "5AEQYjWV2bWvVos5f941m1k3qNAhETE7bGKcWETiRupvzrGZAzaR", "K9vfR7JcKqs7HdGbjwsScnVvTtmJT4SRr3", "kcn1qrh98qvlnec9k9au5auntfj3y2tmmw9w0z80m75"},
+	{"main", vectorLegal, "m/44'/2'/0'/0/0", "5GFvnZxcQKx3Cq1DNXG2k2zXpqhHeW7RPf5U9DxepP7UMLtGA2hE", "KMGmpEK6F7iNnUN2cDm3STYch1CMTnuVsj", "kcn1qnfqhhq566zha2a8fxzjq9m3qcrd9xa4p68hh8g"},
+	{"main", vectorLegal, "m/84'/2'/0'/0/0", "5DgMKKDpBFC6YTz6EhobMLGgEay2K3gFrY5qEDpVfGfyP2GTb3jQ", "KDQGUHUHhyAYEbsqtBqLpxKUxAvigbnHuc", "kcn1qg0457yp54vvw74mdkrqhkvp2fyu387x20gxsnc"},
+	{"main", vectorLetter, "m/44'/2'/0'/0/0", "5FYC8fT5bHz7Lmuta7m7S3qAFgHMvf4KB7ZwbA25RRCacX5PA7Nz", "KK3ZmGZamK9y5ab97LAWAiF3dC53jdjszd", "kcn1qs8gu8qzv9he9g6hml6fwlj4zrfhjkscc3m6d9y"},
+	{"main", vectorZoo, "m/44'/2'/0'/0/0", "5H58WzS6p6kT4vYJuUv3iWJAHZ8vCukFoXEMLVgyoyfo8Qqt6zQ6", "KVW9zpKXEpsuCZRysYezxiUjdhCZfTqcnU", "kcn1q7j9xnnplrc4knzhuza82u34sfj83klhsfwd8du"},
+	{"main", vectorArt, "m/44'/2'/0'/0/0", "5DX42kXx3SQAcfixHyhiU5haxQEM7R57r8RQqUEn63zPXTgrKEuv", "KGm29a6jq9onBpxgZVkUT3JHsipa88gw9J", "kcn1qdrq8wfanvhzgrnr59fndac8uzzeax67zafkmuk"},
+	{"test", vectorAbandon, "m/44'/2'/0'/0/0", "cQ7nStD6toEvXZPRRy9SxGaTjgWuwpg4g5njwRPFZGG3saXQbBfb", "mpoPdf8CmbE1dsE9g3xXj8uVU51GmyiJP5", "tkcn1qvh20q3zqd8ecsy3puf9md2vmr4f7qzx0g7gh7q"},
+	{"test", vectorAbandon, "m/84'/2'/0'/0/0", "cQ5vZs3WZaotgvaRdUcC6qY1xQjCo5xXDXaUmS9VAsKMCLPTQY4N", "muGKTuUuomoxgpaMSzREeDxe76uaTDbmde", "tkcn1qjmxnz78nmc8nq77wuxh25n2es7rzm5c2rt3um5"},
+	{"test", vectorZoo, "m/44'/2'/0'/0/1", "cVrEmz6a8CTfzWE2gnY99sgzZ9vME239ULBvLk6Kox2i1kTLruZs", "mu6LVWQVw31G87WGnsUUPTm6JpvEjfHunD", "tkcn1qjn57gdsez4cm5gtla8nzk4ttat36szzk7mt6jp"},
+	{"regtest", vectorAbandon, "m/44'/2'/0'/0/0", "cQ7nStD6toEvXZPRRy9SxGaTjgWuwpg4g5njwRPFZGG3saXQbBfb", "mpoPdf8CmbE1dsE9g3xXj8uVU51GmyiJP5", "rkcn1qvh20q3zqd8ecsy3puf9md2vmr4f7qzx0djfdw7"},
+	{"regtest", vectorLegal, "m/44'/2'/0'/0/1", "cNxvCnENmdDBmZLx9NBEtRC2rnJrAr6qBuymWoPqzNuaRRpvdRUf", "moAE5kSuKmXxXrhKs8uNFunyAM1mTW5eiB", "rkcn1q202hxw4j5p5arnssyyfprwpwgchxd5unnjttdd"},
+	{"regtest", vectorArt, "m/44'/2'/0'/0/0", "cRs6foZkysiBDrX2yxz9SofMU5czFiHWCLruuKLkh21ZwJZdGz15", "mq4q8jmkh4PcASAQBBjWTKGDR1pq3SYNfT", "rkcn1qdrq8wfanvhzgrnr59fndac8uzzeax67z0h5glz"},
+}
+
+// Check derives v on its network, whichever one the package is using, and
+// reports the first result that differs from the expected one
+func (v TestVector) Check() error {
+	params, ok := networks[v.Network]
+	if !ok {
+		return fmt.Errorf("unknown network %q", v.Network)
+	}
+	w, err := walletFromMnemonic(v.Mnemonic, v.Path, params)
+	if err != nil {
+		return err
+	}
+	switch {
+	case w.PrivateKeyWIF != v.WIF:
+		return fmt.Errorf("WIF is %s, want %s", w.PrivateKeyWIF, v.WIF)
+	case w.LegacyAddress != v.LegacyAddress:
+		return fmt.Errorf("legacy address is %s, want %s", w.LegacyAddress, v.LegacyAddress)
+	case w.SegWitAddress != v.SegWitAddress:
+		return fmt.Errorf("SegWit address is %s, want %s", w.SegWitAddress, v.SegWitAddress)
+	}
+	return nil
+}
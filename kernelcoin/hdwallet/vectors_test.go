@@ -0,0 +1,53 @@
+package hdwallet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVectorsMatch(t *testing.T) {
+	for _, v := range TestVectors {
+		if err := v.Check(); err != nil {
+			t.Errorf("%s %s %s...: %v", v.Network, v.Path, v.Mnemonic[:12], err)
+		}
+	}
+}
+
+// The exported constructors, which use the active network, agree with the
+// vectors too
+func TestVectorsOnActiveNetwork(t *testing.T) {
+	defer UseNetwork(activeNetwork)
+	for _, v := range TestVectors {
+		if err := UseNetwork(v.Network); err != nil {
+			t.Fatal(err)
+		}
+		w, err := WalletFromMnemonic(v.Mnemonic, v.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.PrivateKeyWIF != v.WIF || w.LegacyAddress != v.LegacyAddress || w.SegWitAddress != v.SegWitAddress {
+			t.Errorf("%s %s: derived %s %s %s", v.Network, v.Path, w.PrivateKeyWIF, w.LegacyAddress, w.SegWitAddress)
+		}
+
+		fromWIF, err := WalletFromWIF(v.WIF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fromWIF.LegacyAddress != v.LegacyAddress || fromWIF.SegWitAddress != v.SegWitAddress {
+			t.Errorf("%s WIF %s: addresses %s %s", v.Network, v.WIF, fromWIF.LegacyAddress, fromWIF.SegWitAddress)
+		}
+	}
+}
+
+func TestVectorMismatch(t *testing.T) {
+	v := TestVectors[0]
+	v.Path = "m/44'/2'/0'/0/7"
+	if err := v.Check(); err == nil || !strings.Contains(err.Error(), "WIF") {
+		t.Errorf("wrong path checked as %v", err)
+	}
+	v = TestVectors[0]
+	v.Network = "test"
+	if err := v.Check(); err == nil {
+		t.Error("main vector passed on testnet")
+	}
+}
@@ -0,0 +1,195 @@
+// Package hdwallet generates and restores Kernelcoin keys (BIP39 mnemonics,
+// BIP32 derivation, WIF and BIP38) and builds and signs transactions
+// spending them, all without a node.
+package hdwallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/luxfi/go-bip39"
+)
+
+// Wallet represents a generated Kernelcoin wallet
+type Wallet struct {
+	Mnemonic       string
+	PrivateKeyHex  string
+	PrivateKeyWIF  string
+	PublicKeyHex   string
+	LegacyAddress  string
+	SegWitAddress  string
+	PublicKeyHash  string
+	DerivationPath string
+}
+
+// DefaultDerivationPath is the BIP44 path of the wallet's key. 2 is
+// Litecoin's coin type (Kernelcoin is a Litecoin fork).
+const DefaultDerivationPath = "m/44'/2'/0'/0/0"
+
+// GenerateNewWallet creates a new Kernelcoin wallet
+func GenerateNewWallet() (*Wallet, error) {
+	// Generate a new 128-bit entropy (12 words)
+	entropy, err := bip39.NewEntropy(128)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate entropy: %w", err)
+	}
+
+	// Generate mnemonic from entropy
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate mnemonic: %w", err)
+	}
+
+	return GenerateWalletFromMnemonic(mnemonic)
+}
+
+// GenerateWalletFromMnemonic creates a wallet from an existing mnemonic
+func GenerateWalletFromMnemonic(mnemonic string) (*Wallet, error) {
+	return WalletFromMnemonic(mnemonic, DefaultDerivationPath)
+}
+
+// ParseDerivationPath parses a BIP32 path such as m/44'/2'/0'/0/5 into
+// child indexes; ' or h marks a hardened one
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) < 2 || parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q must look like m/44'/2'/0'/0/0", path)
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || n >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("derivation path %q has an invalid index %q", path, part)
+		}
+		if hardened {
+			n += hdkeychain.HardenedKeyStart
+		}
+		indexes = append(indexes, uint32(n))
+	}
+	return indexes, nil
+}
+
+// WalletFromMnemonic derives the key at path (e.g. DefaultDerivationPath)
+// from a mnemonic
+func WalletFromMnemonic(mnemonic, path string) (*Wallet, error) {
+	return walletFromMnemonic(mnemonic, path, activeParams)
+}
+
+// walletFromMnemonic derives the key at path with params' key and address
+// encodings
+func walletFromMnemonic(mnemonic, path string, params *chaincfg.Params) (*Wallet, error) {
+	// Validate mnemonic
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, fmt.Errorf("invalid mnemonic phrase")
+	}
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate seed from mnemonic (with empty passphrase)
+	seed := bip39.NewSeed(mnemonic, "")
+
+	// Create master key from seed
+	key, err := hdkeychain.NewMaster(seed, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create master key: %w", err)
+	}
+
+	for _, index := range indexes {
+		if key, err = key.Derive(index); err != nil {
+			return nil, fmt.Errorf("failed to derive %s: %w", path, err)
+		}
+	}
+
+	// Get the private key
+	privKey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private key: %w", err)
+	}
+
+	// Get WIF (Wallet Import Format) for private key
+	wif, err := btcutil.NewWIF(privKey, params, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WIF: %w", err)
+	}
+
+	// Get the public key
+	pubKey := privKey.PubKey()
+
+	// Generate legacy P2PKH address (starts with K)
+	pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+	legacyAddr, err := btcutil.NewAddressPubKeyHash(pubKeyHash, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create legacy address: %w", err)
+	}
+
+	// Generate bech32 SegWit address (kcn prefix)
+	bech32Addr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bech32 address: %w", err)
+	}
+
+	wallet := &Wallet{
+		Mnemonic:       mnemonic,
+		PrivateKeyHex:  hex.EncodeToString(privKey.Serialize()),
+		PrivateKeyWIF:  wif.String(),
+		PublicKeyHex:   hex.EncodeToString(pubKey.SerializeCompressed()),
+		LegacyAddress:  legacyAddr.EncodeAddress(),
+		SegWitAddress:  bech32Addr.EncodeAddress(),
+		PublicKeyHash:  hex.EncodeToString(pubKeyHash),
+		DerivationPath: strings.TrimSpace(path),
+	}
+
+	return wallet, nil
+}
+
+// WalletFromWIF creates a wallet for a single imported private key. The
+// mnemonic and derivation path are unknown and left empty.
+func WalletFromWIF(wifStr string) (*Wallet, error) {
+	wif, err := btcutil.DecodeWIF(wifStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WIF: %w", err)
+	}
+
+	if !wif.IsForNet(activeParams) {
+		return nil, fmt.Errorf("WIF is not for Kernelcoin %s", activeNetwork)
+	}
+
+	pubKeyBytes := wif.SerializePubKey()
+
+	// Generate legacy P2PKH address (starts with K)
+	pubKeyHash := btcutil.Hash160(pubKeyBytes)
+	legacyAddr, err := btcutil.NewAddressPubKeyHash(pubKeyHash, activeParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create legacy address: %w", err)
+	}
+
+	wallet := &Wallet{
+		PrivateKeyHex: hex.EncodeToString(wif.PrivKey.Serialize()),
+		PrivateKeyWIF: wif.String(),
+		PublicKeyHex:  hex.EncodeToString(pubKeyBytes),
+		LegacyAddress: legacyAddr.EncodeAddress(),
+		PublicKeyHash: hex.EncodeToString(pubKeyHash),
+	}
+
+	// SegWit addresses require a compressed public key
+	if wif.CompressPubKey {
+		bech32Addr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, activeParams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bech32 address: %w", err)
+		}
+		wallet.SegWitAddress = bech32Addr.EncodeAddress()
+	}
+
+	return wallet, nil
+}
@@ -0,0 +1,156 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// KernelsPerKCN is the number of base units (kernels) in one KCN
+const KernelsPerKCN = 100000000
+
+// Amount is a KCN value held as an integer number of kernels, so 8-decimal
+// values survive arithmetic and round trips exactly. In JSON it is written
+// as a decimal string ("1.50000000") and read from either a string or a
+// number.
+type Amount int64
+
+// Units an amount can be written in: KCN, milli-KCN (100000 kernels) or
+// kernels
+const (
+	UnitKCN      = "kcn"
+	UnitMilliKCN = "mkcn"
+	UnitKernels  = "kernels"
+)
+
+// unitKernels is the number of kernels in one of each unit
+var unitKernels = map[string]int64{
+	UnitKCN:      KernelsPerKCN,
+	UnitMilliKCN: KernelsPerKCN / 1000,
+	UnitKernels:  1,
+}
+
+// ValidUnit reports whether unit is one Format writes
+func ValidUnit(unit string) bool {
+	_, ok := unitKernels[unit]
+	return ok
+}
+
+// AmountsAsNumbers restores the old float JSON encoding for clients that
+// cannot handle string amounts (AMOUNT_FORMAT=number)
+var AmountsAsNumbers bool
+
+// AmountError is a value ParseAmount could not read. JSON decoding
+// returns it as it is, so callers can tell a bad amount from a bad body.
+type AmountError struct {
+	Text string
+	// Precision is set when the value has more than 8 decimal places
+	Precision bool
+	reason    string
+}
+
+func (e *AmountError) Error() string {
+	return fmt.Sprintf("amount %q %s", e.Text, e.reason)
+}
+
+// ParseAmount parses a decimal KCN value such as "1.5", "0.00000001" or
+// "1e-5". More than 8 decimal places is an error rather than being rounded.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, &AmountError{Text: s, reason: "is not a number"}
+	}
+
+	r.Mul(r, big.NewRat(KernelsPerKCN, 1))
+	if !r.IsInt() {
+		return 0, &AmountError{Text: s, Precision: true, reason: "has more than 8 decimal places"}
+	}
+	if !r.Num().IsInt64() {
+		return 0, &AmountError{Text: s, reason: "is out of range"}
+	}
+	return Amount(r.Num().Int64()), nil
+}
+
+// AmountFromKCN converts a float KCN value, rounding to the nearest kernel
+func AmountFromKCN(kcn float64) Amount {
+	return Amount(math.Round(kcn * KernelsPerKCN))
+}
+
+// KCN returns the amount as a float, for display and logging only
+func (a Amount) KCN() float64 {
+	return float64(a) / KernelsPerKCN
+}
+
+// Abs returns the amount without its sign
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// String formats the amount with exactly 8 decimal places
+func (a Amount) String() string {
+	sign := ""
+	n := int64(a)
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	return fmt.Sprintf("%s%d.%08d", sign, n/KernelsPerKCN, n%KernelsPerKCN)
+}
+
+// Format writes the amount in unit with every decimal place the unit has:
+// "1.50000000" KCN, "1500.00000" mKCN or "150000000" kernels. Unknown units
+// are KCN.
+func (a Amount) Format(unit string) string {
+	per, ok := unitKernels[unit]
+	if !ok || per == KernelsPerKCN {
+		return a.String()
+	}
+	if per == 1 {
+		return strconv.FormatInt(int64(a), 10)
+	}
+	sign := ""
+	n := int64(a)
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+	decimals := len(strconv.FormatInt(per, 10)) - 1
+	return fmt.Sprintf("%s%d.%0*d", sign, n/per, decimals, n%per)
+}
+
+// Number returns the amount as an exact JSON number, the form kernelcoind
+// expects in RPC parameters
+func (a Amount) Number() json.Number {
+	return json.Number(a.String())
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if AmountsAsNumbers {
+		return []byte(a.String()), nil
+	}
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	parsed, err := ParseAmount(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
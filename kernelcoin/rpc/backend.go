@@ -0,0 +1,91 @@
+package rpc
+
+// WalletBackend is what the web wallet needs from a node and its wallet.
+// Client, over kernelcoind's JSON-RPC, is the implementation the server
+// runs with; another one (an Electrum or SPV wallet, or a mock in tests)
+// can stand in without the handlers changing. Errors are the backend's
+// own; methods a backend cannot serve return an error rather than zero
+// values.
+type WalletBackend interface {
+	// WithRequestID returns a backend whose log lines carry requestID
+	WithRequestID(requestID string) WalletBackend
+	// ForWallet returns a backend for the node wallet called name.
+	// Callers keep it rather than making one per request.
+	ForWallet(name string) WalletBackend
+	// URL identifies the node, for logs and ETags
+	URL() string
+	// WalletChanges returns a counter that moves whenever the backend
+	// sends, imports or otherwise changes the wallet
+	WalletChanges() int64
+	// NoteTxCount tells the backend the wallet's transaction count, so it
+	// can drop a cached balance that predates it
+	NoteTxCount(n int)
+
+	// Chain and network
+	GetBlockchainInfo() (interface{}, error)
+	GetNetworkInfo() (interface{}, error)
+	GetChainName() (string, error)
+	GetBestBlock() (int64, string, error)
+	GetBlockHash(height int64) (string, error)
+	GetBlockTime(height int64) (int64, error)
+	InvalidateBlock(hash string) error
+	GenerateToAddress(blocks int, address string) ([]string, error)
+	GetPeerInfo() ([]PeerInfo, error)
+	GetNetTotals() (*NetTotals, error)
+	GetMempoolInfo() (*MempoolInfo, error)
+	GetMempoolEntry(txid string) (*MempoolEntry, error)
+	EstimateSmartFee(confTarget int) (float64, error)
+	ScanTxOutSet(descriptors []string) ([]ScannedUTXO, error)
+	ValidateAddress(addr string) (bool, error)
+
+	// Wallet state
+	GetWalletInfo() (map[string]interface{}, error)
+	GetBalanceInfo(address string) (*BalanceInfo, error)
+	ListTransactions(address string, count, skip int) ([]interface{}, error)
+	GetTransaction(txid string) (map[string]interface{}, error)
+	ListUnspent(minConf int) ([]UnspentOutput, error)
+	LockUnspent(unlock bool, outpoints []Outpoint, persistent bool) error
+	ListLockUnspent() ([]Outpoint, error)
+	ListAddressGroupings() ([][]GroupedAddress, error)
+	GetReceivedByAddress(address string, minConf int) (Amount, error)
+
+	// Addresses and keys
+	GetNewAddress(label, addressType string) (string, error)
+	GetRawChangeAddress(addressType string) (string, error)
+	GetAddressesByLabel(label string) ([]string, error)
+	GetAddressInfo(address string) (*AddressDetails, error)
+	AddMultisigAddress(required int, pubkeys []string, label, addressType string) (*MultisigAddress, error)
+	ImportPrivateKey(wif string, rescan bool) (interface{}, error)
+	DumpPrivKey(address string) (string, error)
+
+	// Sending
+	SendToAddress(toAddress string, amount Amount) (string, error)
+	SendToAddressWithOptions(toAddress string, amount Amount, opts SendOptions) (string, error)
+	SendMaxToAddress(toAddress string, amount Amount) (string, error)
+	BumpFee(txid string, confTarget int, feeRate float64) (*BumpFeeResult, error)
+	AbandonTransaction(txid string) error
+	CreateRawTransaction(inputs []Outpoint, outputs []map[string]interface{}) (string, error)
+	FundRawTransaction(hex string, options map[string]interface{}) (*FundedTransaction, error)
+	SignRawTransactionWithWallet(hex string) (string, bool, error)
+	SendRawTransaction(hex string) (string, error)
+
+	// PSBTs
+	WalletCreateFundedPSBT(inputs []Outpoint, outputs []map[string]interface{}, options map[string]interface{}) (*PSBTResult, error)
+	WalletProcessPSBT(psbt string, sign bool) (*PSBTResult, error)
+	FinalizePSBT(psbt string) (*PSBTResult, error)
+	CombinePSBT(psbts []string) (string, error)
+	DecodePSBT(psbt string) (map[string]interface{}, error)
+
+	// Wallet files and rescans
+	ListWallets() ([]string, error)
+	CreateWallet(name string) error
+	LoadWallet(name string) error
+	UnloadWallet(name string) error
+	BackupWallet(destination string) error
+	RestoreWallet(name, backupFile string) (string, error)
+	RescanBlockchain(start, stop int64) (int64, int64, error)
+	AbortRescan() (bool, error)
+	ScanProgress() (bool, float64, error)
+}
+
+var _ WalletBackend = (*Client)(nil)
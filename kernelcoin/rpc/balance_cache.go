@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultBalanceCacheTTL is how long a getbalances result is reused
+const DefaultBalanceCacheTTL = 5 * time.Second
+
+// balanceChangingMethods are the RPCs after which a cached balance is stale
+var balanceChangingMethods = map[string]bool{
+	"sendtoaddress":      true,
+	"sendmany":           true,
+	"sendrawtransaction": true,
+	"bumpfee":            true,
+	"psbtbumpfee":        true,
+	"abandontransaction": true,
+	"importprivkey":      true,
+	"importaddress":      true,
+	"importmulti":        true,
+	"importdescriptors":  true,
+	"rescanblockchain":   true,
+	"generatetoaddress":  true,
+	"invalidateblock":    true,
+	"reconsiderblock":    true,
+}
+
+// balanceCache keeps the last getbalances result for a short TTL. It is
+// dropped whenever the wallet sends or imports, and when the chain tip moves.
+// A zero TTL disables caching.
+type balanceCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	info    *BalanceInfo
+	fetched time.Time
+	tip     string
+	txcount int
+	// gen counts invalidations, so that a fetch which was under way when
+	// the balance changed doesn't store what it read
+	gen uint64
+}
+
+func newBalanceCache(ttl time.Duration) *balanceCache {
+	return &balanceCache{ttl: ttl}
+}
+
+// Get returns a copy of the cached balance if it is still fresh
+func (c *balanceCache) Get() (*BalanceInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info == nil || time.Since(c.fetched) >= c.ttl {
+		return nil, false
+	}
+	info := *c.info
+	return &info, true
+}
+
+// Generation is taken before fetching a balance and handed to Set
+func (c *balanceCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// Set caches info, fetched at generation gen. It is dropped if the cache has
+// been invalidated since.
+func (c *balanceCache) Set(info *BalanceInfo, gen uint64) {
+	if c.ttl <= 0 {
+		return
+	}
+	stored := *info
+	c.mu.Lock()
+	if gen == c.gen {
+		c.info = &stored
+		c.fetched = time.Now()
+	}
+	c.mu.Unlock()
+}
+
+func (c *balanceCache) Invalidate() {
+	c.mu.Lock()
+	c.invalidate()
+	c.mu.Unlock()
+}
+
+func (c *balanceCache) invalidate() {
+	c.info = nil
+	c.gen++
+}
+
+// NoteTip invalidates the cache when the chain tip differs from the last one
+// seen, since a new block can confirm or mature coins
+func (c *balanceCache) NoteTip(hash string) {
+	c.mu.Lock()
+	if hash != c.tip {
+		c.tip = hash
+		c.invalidate()
+	}
+	c.mu.Unlock()
+}
+
+// NoteTxCount invalidates the cache when the wallet's transaction count
+// differs from the last one seen, since an incoming payment changes the
+// pending balance without a new block
+func (c *balanceCache) NoteTxCount(n int) {
+	c.mu.Lock()
+	if n != c.txcount {
+		c.txcount = n
+		c.invalidate()
+	}
+	c.mu.Unlock()
+}
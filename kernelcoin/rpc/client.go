@@ -0,0 +1,1657 @@
+// Package rpc is a JSON-RPC client for kernelcoind and its wallet, with the
+// Amount type it reads KCN values into. Read calls are coalesced and
+// balances cached briefly; see Client. WalletBackend is the interface the
+// web wallet works through, which Client implements.
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrAuth is returned when kernelcoind rejects the RPC credentials
+var ErrAuth = errors.New("RPC credentials rejected")
+
+// Client communicates with kernelcoind; it is the WalletBackend the server
+// runs with. WithRequestID makes cheap copies that share the connection
+// state but tag their log lines.
+type Client struct {
+	*rpcConn
+
+	// requestID is the HTTP request this copy works for, if any
+	requestID string
+}
+
+// rpcConn is the state shared by every copy of a client
+type rpcConn struct {
+	url      string
+	user     string
+	password string
+
+	// balances caches GetBalanceInfo
+	balances *balanceCache
+
+	// changes counts successful balance-changing calls
+	changes atomic.Int64
+
+	// inflight coalesces concurrent identical read calls
+	inflight singleflight.Group
+
+	// logger writes the client's log lines
+	logger func(requestID, line string)
+}
+
+// JSONRPCRequest represents a JSON-RPC 2.0 request
+type JSONRPCRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+	ID      int           `json:"id"`
+}
+
+// JSONRPCResponse represents JSON-RPC 2.0 response
+type JSONRPCResponse struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Result  interface{} `json:"result"`
+	Error   interface{} `json:"error"`
+	ID      int         `json:"id"`
+}
+
+// NewClient creates an authenticated RPC client
+func NewClient(url, user, password string) *Client {
+	return &Client{rpcConn: &rpcConn{
+		url:      url,
+		user:     user,
+		password: password,
+		balances: newBalanceCache(DefaultBalanceCacheTTL),
+		logger: func(requestID, line string) {
+			log.Print(line)
+		},
+	}}
+}
+
+// SetLogger sends the client's log lines, with the request ID of the copy
+// that wrote them, to logger instead of the standard logger. Call it
+// before using the client.
+func (c *Client) SetLogger(logger func(requestID, line string)) {
+	c.logger = logger
+}
+
+// SetBalanceTTL sets how long GetBalanceInfo results are reused; zero
+// disables caching. Call it before using the client.
+func (c *Client) SetBalanceTTL(ttl time.Duration) {
+	c.balances = newBalanceCache(ttl)
+}
+
+// NoteTxCount drops the cached balance when the wallet's transaction count
+// is not the one it was cached at
+func (c *Client) NoteTxCount(n int) {
+	c.balances.NoteTxCount(n)
+}
+
+// URL is the node URL the client calls
+func (c *Client) URL() string {
+	return c.url
+}
+
+// WithRequestID returns a client whose log lines carry requestID
+func (c *Client) WithRequestID(requestID string) WalletBackend {
+	return &Client{rpcConn: c.rpcConn, requestID: requestID}
+}
+
+// ForWallet returns a client for the node wallet called name, through the
+// node's multiwallet endpoint. It has its own connection state, so its
+// balance cache and change counter are separate from c's; callers keep it
+// rather than making one per request.
+func (c *Client) ForWallet(name string) WalletBackend {
+	base := c.url
+	if i := strings.Index(base, "/wallet/"); i >= 0 {
+		base = base[:i]
+	}
+	return &Client{rpcConn: &rpcConn{
+		url:      strings.TrimSuffix(base, "/") + "/wallet/" + url.PathEscape(name),
+		user:     c.user,
+		password: c.password,
+		balances: newBalanceCache(c.balances.ttl),
+		logger:   c.logger,
+	}}
+}
+
+// logf is log.Printf tagged with the client's request ID
+func (c *Client) logf(format string, args ...interface{}) {
+	c.logger(c.requestID, fmt.Sprintf(format, args...))
+}
+
+// WalletChanges returns a counter that moves whenever this client sends,
+// imports or otherwise changes the wallet
+func (c *Client) WalletChanges() int64 {
+	return c.changes.Load()
+}
+
+// sharedCall is call for read-only methods: concurrent calls with the same
+// method and params share one round trip to the node. The result is shared
+// too, so callers must not modify it.
+func (c *Client) sharedCall(method string, params []interface{}) (interface{}, error) {
+	key, err := json.Marshal(append([]interface{}{method}, params...))
+	if err != nil {
+		return c.call(method, params)
+	}
+	result, err, _ := c.inflight.Do(string(key), func() (interface{}, error) {
+		return c.call(method, params)
+	})
+	return result, err
+}
+
+// secretParamMethods take private keys, seeds or passphrases as params,
+// which stay out of the logs at every level
+var secretParamMethods = map[string]bool{
+	"importprivkey":             true,
+	"walletpassphrase":          true,
+	"walletpassphrasechange":    true,
+	"signrawtransactionwithkey": true,
+	"encryptwallet":             true,
+	"sethdseed":                 true,
+}
+
+// call makes an authenticated RPC call
+func (c *Client) call(method string, params []interface{}) (interface{}, error) {
+	c.logf("[RPC] Calling method: %s", method)
+	if secretParamMethods[method] {
+		c.logf("[RPC] DEBUG Params: <withheld for %s>", method)
+	} else {
+		c.logf("[RPC] DEBUG Params: %v", params)
+	}
+	c.logf("[RPC] DEBUG URL: %s, User: %s", c.url, c.user)
+
+	request := JSONRPCRequest{
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  params,
+		ID:      1,
+	}
+
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		c.logf("[RPC] ERROR: Failed to marshal request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if !secretParamMethods[method] {
+		c.logf("[RPC] DEBUG Request body: %s", string(requestBody))
+	}
+
+	req, err := http.NewRequest("POST", c.url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		c.logf("[RPC] ERROR: Failed to create HTTP request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.SetBasicAuth(c.user, c.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		c.logf("[RPC] ERROR: RPC POST failed: %v", err)
+		return nil, fmt.Errorf("RPC POST failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	c.logf("[RPC] DEBUG Response status: %d %s", resp.StatusCode, resp.Status)
+	// Rejected credentials and rpcallowip come back as bare 401/403s
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		c.logf("[RPC] ERROR: %s", resp.Status)
+		return nil, fmt.Errorf("%w (HTTP %s)", ErrAuth, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logf("[RPC] ERROR: Failed to read response body: %v", err)
+		return nil, fmt.Errorf("RPC read error: %w", err)
+	}
+
+	// For listtransactions and listunspent, avoid logging the massive response body
+	if method == "listtransactions" || method == "listunspent" {
+		c.logf("[RPC] DEBUG Response body: <truncated for %s, size: %d bytes>", method, len(body))
+	} else if method == "dumpprivkey" {
+		// Private keys stay out of the logs, even at debug level
+		c.logf("[RPC] DEBUG Response body: <withheld for %s>", method)
+	} else {
+		c.logf("[RPC] DEBUG Response body: %s", string(body))
+	}
+
+	// Decode numbers as json.Number so amounts are parsed exactly
+	var response JSONRPCResponse
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&response); err != nil {
+		c.logf("[RPC] ERROR: Failed to unmarshal response: %v", err)
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	if response.Error != nil {
+		c.logf("[RPC] ERROR: RPC returned error: %v", response.Error)
+		return nil, fmt.Errorf("RPC error: %v", response.Error)
+	}
+
+	if balanceChangingMethods[method] {
+		c.balances.Invalidate()
+		c.changes.Add(1)
+	}
+
+	// For listtransactions and listunspent, just log the count, not the full result
+	if method == "listtransactions" || method == "listunspent" {
+		if array, ok := response.Result.([]interface{}); ok {
+			c.logf("[RPC] SUCCESS: Retrieved %d items", len(array))
+		} else {
+			c.logf("[RPC] SUCCESS: Result type: %T", response.Result)
+		}
+	} else {
+		c.logf("[RPC] DEBUG SUCCESS: Result type: %T, value: %v", response.Result, response.Result)
+	}
+	return response.Result, nil
+}
+
+// -----------------------------------------------------------
+// API Helpers
+// -----------------------------------------------------------
+
+// BalanceInfo holds the wallet balances reported by getbalances
+type BalanceInfo struct {
+	Confirmed   Amount // trusted: confirmed, or unconfirmed change from ourselves
+	Unconfirmed Amount // untrusted_pending: unconfirmed incoming
+	Immature    Amount // coinbase outputs not yet mature
+	Total       Amount
+
+	// WatchOnly is nil unless the wallet holds watch-only addresses
+	WatchOnly *WatchOnlyBalance
+}
+
+// WatchOnlyBalance is the getbalances "watchonly" section
+type WatchOnlyBalance struct {
+	Trusted          Amount `json:"trusted"`
+	UntrustedPending Amount `json:"untrusted_pending"`
+	Immature         Amount `json:"immature"`
+}
+
+func (c *Client) GetBalance(address string) (Amount, error) {
+	balanceInfo, err := c.GetBalanceInfo(address)
+	if err != nil {
+		return 0, err
+	}
+	return balanceInfo.Total, nil
+}
+
+func (c *Client) GetBalanceInfo(address string) (*BalanceInfo, error) {
+	if info, ok := c.balances.Get(); ok {
+		return info, nil
+	}
+
+	c.logf("[RPC] GetBalanceInfo: Fetching balance for wallet (address: %s)", address)
+	gen := c.balances.Generation()
+
+	// Use getbalances - much faster than listunspent
+	result, err := c.sharedCall("getbalances", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetBalanceInfo ERROR: %v", err)
+		return nil, err
+	}
+
+	// Parse getbalances response
+	balances, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] GetBalanceInfo ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected getbalances response type: %T", result)
+	}
+
+	mine, ok := balances["mine"].(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] GetBalanceInfo ERROR: missing 'mine' field")
+		return nil, fmt.Errorf("getbalances missing 'mine' field")
+	}
+
+	// Extract balances
+	info := &BalanceInfo{
+		Confirmed:   GetAmount(mine, "trusted"),
+		Unconfirmed: GetAmount(mine, "untrusted_pending"),
+		Immature:    GetAmount(mine, "immature"),
+	}
+	info.Total = info.Confirmed + info.Unconfirmed + info.Immature
+
+	if watch, ok := balances["watchonly"].(map[string]interface{}); ok {
+		info.WatchOnly = &WatchOnlyBalance{
+			Trusted:          GetAmount(watch, "trusted"),
+			UntrustedPending: GetAmount(watch, "untrusted_pending"),
+			Immature:         GetAmount(watch, "immature"),
+		}
+	}
+
+	c.logf("[RPC] GetBalanceInfo: Total %s (Confirmed: %s, Unconfirmed: %s, Immature: %s)",
+		info.Total, info.Confirmed, info.Unconfirmed, info.Immature)
+	c.balances.Set(info, gen)
+	return info, nil
+}
+
+// ImportPrivateKey adds a key to the node wallet. With rescan the call
+// blocks until the node has scanned the whole chain for the key's coins.
+func (c *Client) ImportPrivateKey(wif string, rescan bool) (interface{}, error) {
+	c.logf("[RPC] ImportPrivateKey: importing private key (rescan=%v)", rescan)
+	result, err := c.call("importprivkey", []interface{}{wif, "", rescan})
+	if err != nil {
+		c.logf("[RPC] ImportPrivateKey ERROR: %v", err)
+		return nil, err
+	}
+	c.logf("[RPC] ImportPrivateKey SUCCESS")
+	return result, nil
+}
+
+func (c *Client) SendTransaction(fromWIF, toAddress string, amount Amount) (string, error) {
+	c.logf("[RPC] SendTransaction: importing private key and sending %s to %s", amount, toAddress)
+	_, _ = c.call("importprivkey", []interface{}{fromWIF})
+
+	txID, err := c.call("sendtoaddress", []interface{}{toAddress, amount.Number()})
+	if err != nil {
+		c.logf("[RPC] SendTransaction ERROR: %v", err)
+		return "", err
+	}
+
+	if s, ok := txID.(string); ok {
+		c.logf("[RPC] SendTransaction SUCCESS: txid=%s", s)
+		return s, nil
+	}
+	c.logf("[RPC] SendTransaction ERROR: unexpected txid type: %T, value: %v", txID, txID)
+	return "", fmt.Errorf("unexpected txid type: %T", txID)
+}
+
+func (c *Client) SendToAddress(toAddress string, amount Amount) (string, error) {
+	c.logf("[RPC] SendToAddress: sending %s to %s using loaded wallet", amount, toAddress)
+
+	txID, err := c.call("sendtoaddress", []interface{}{toAddress, amount.Number()})
+	if err != nil {
+		c.logf("[RPC] SendToAddress ERROR: %v", err)
+		return "", err
+	}
+
+	if s, ok := txID.(string); ok {
+		c.logf("[RPC] SendToAddress SUCCESS: txid=%s", s)
+		return s, nil
+	}
+	c.logf("[RPC] SendToAddress ERROR: unexpected txid type: %T, value: %v", txID, txID)
+	return "", fmt.Errorf("unexpected txid type: %T", txID)
+}
+
+// SendOptions are the optional sendtoaddress parameters
+type SendOptions struct {
+	Comment     string
+	CommentTo   string
+	SubtractFee bool
+	Replaceable bool
+	// FeeRate is in kernels per vbyte; 0 leaves the fee to the wallet's
+	// estimate
+	FeeRate float64
+}
+
+// SendToAddressWithOptions sends amount to toAddress using the loaded wallet,
+// passing the optional comment, fee-subtraction, BIP125 and fee rate
+// parameters
+func (c *Client) SendToAddressWithOptions(toAddress string, amount Amount, opts SendOptions) (string, error) {
+	c.logf("[RPC] SendToAddressWithOptions: sending %s to %s (replaceable=%v, fee_rate=%.3f)", amount, toAddress, opts.Replaceable, opts.FeeRate)
+
+	params := []interface{}{
+		toAddress, amount.Number(), opts.Comment, opts.CommentTo, opts.SubtractFee, opts.Replaceable,
+	}
+	if opts.FeeRate > 0 {
+		// conf_target, estimate_mode and avoid_reuse stay at their defaults
+		params = append(params, nil, "unset", nil, opts.FeeRate)
+	}
+	txID, err := c.call("sendtoaddress", params)
+	if err != nil {
+		c.logf("[RPC] SendToAddressWithOptions ERROR: %v", err)
+		return "", err
+	}
+
+	if s, ok := txID.(string); ok {
+		c.logf("[RPC] SendToAddressWithOptions SUCCESS: txid=%s", s)
+		return s, nil
+	}
+	c.logf("[RPC] SendToAddressWithOptions ERROR: unexpected txid type: %T, value: %v", txID, txID)
+	return "", fmt.Errorf("unexpected txid type: %T", txID)
+}
+
+// BumpFeeResult is the result of bumpfee
+type BumpFeeResult struct {
+	Txid    string
+	OrigFee Amount
+	Fee     Amount
+	Errors  []string
+}
+
+// BumpFee replaces an unconfirmed BIP125 transaction with a higher-fee
+// version. confTarget and feeRate (sat/vB) are optional (0 = node default).
+func (c *Client) BumpFee(txid string, confTarget int, feeRate float64) (*BumpFeeResult, error) {
+	c.logf("[RPC] BumpFee: bumping %s (conf_target=%d, fee_rate=%.3f)", txid, confTarget, feeRate)
+
+	options := map[string]interface{}{}
+	if confTarget > 0 {
+		options["conf_target"] = confTarget
+	}
+	if feeRate > 0 {
+		options["fee_rate"] = feeRate
+	}
+
+	result, err := c.call("bumpfee", []interface{}{txid, options})
+	if err != nil {
+		c.logf("[RPC] BumpFee ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] BumpFee ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected bumpfee response type: %T", result)
+	}
+
+	bumped := &BumpFeeResult{
+		Txid:    GetString(m, "txid"),
+		OrigFee: GetAmount(m, "origfee"),
+		Fee:     GetAmount(m, "fee"),
+		Errors:  []string{},
+	}
+	if errs, ok := m["errors"].([]interface{}); ok {
+		for _, e := range errs {
+			if s, ok := e.(string); ok {
+				bumped.Errors = append(bumped.Errors, s)
+			}
+		}
+	}
+
+	c.logf("[RPC] BumpFee SUCCESS: %s -> %s (fee %s -> %s)", txid, bumped.Txid, bumped.OrigFee, bumped.Fee)
+	return bumped, nil
+}
+
+// SendMaxToAddress sends amount to toAddress with the fee deducted from the
+// amount itself, so the wallet can be emptied without a change output
+func (c *Client) SendMaxToAddress(toAddress string, amount Amount) (string, error) {
+	c.logf("[RPC] SendMaxToAddress: sending %s (fee subtracted) to %s", amount, toAddress)
+
+	txID, err := c.call("sendtoaddress", []interface{}{toAddress, amount.Number(), "", "", true})
+	if err != nil {
+		c.logf("[RPC] SendMaxToAddress ERROR: %v", err)
+		return "", err
+	}
+
+	if s, ok := txID.(string); ok {
+		c.logf("[RPC] SendMaxToAddress SUCCESS: txid=%s", s)
+		return s, nil
+	}
+	c.logf("[RPC] SendMaxToAddress ERROR: unexpected txid type: %T, value: %v", txID, txID)
+	return "", fmt.Errorf("unexpected txid type: %T", txID)
+}
+
+func (c *Client) ValidateAddress(addr string) (bool, error) {
+	result, err := c.call("validateaddress", []interface{}{addr})
+	if err != nil {
+		return false, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("unexpected validateaddress type: %T", result)
+	}
+
+	if v, ok := m["isvalid"].(bool); ok {
+		return v, nil
+	}
+
+	return false, fmt.Errorf("validateaddress missing isvalid")
+}
+
+// ListTransactions returns up to count wallet entries, skipping the skip most
+// recent ones. Entries come back oldest first.
+func (c *Client) ListTransactions(address string, count, skip int) ([]interface{}, error) {
+	c.logf("[RPC] ListTransactions: Fetching up to %d transactions (skip %d)...", count, skip)
+	result, err := c.sharedCall("listtransactions", []interface{}{"*", count, skip, true})
+	if err != nil {
+		c.logf("[RPC] ListTransactions ERROR: %v", err)
+		return nil, err
+	}
+
+	txs, ok := result.([]interface{})
+	if !ok {
+		c.logf("[RPC] ListTransactions ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected listtransactions response type: %T", result)
+	}
+
+	c.logf("[RPC] ListTransactions: Retrieved %d transactions", len(txs))
+	return txs, nil
+}
+
+// UnspentOutput is a single wallet UTXO as reported by listunspent
+type UnspentOutput struct {
+	Txid          string `json:"txid"`
+	Vout          int    `json:"vout"`
+	Address       string `json:"address"`
+	Label         string `json:"label,omitempty"`
+	ScriptPubKey  string `json:"script_pub_key"`
+	Amount        Amount `json:"amount"`
+	Confirmations int    `json:"confirmations"`
+	Spendable     bool   `json:"spendable"`
+	Solvable      bool   `json:"solvable"`
+	Safe          bool   `json:"safe"`
+}
+
+func (c *Client) ListUnspent(minConf int) ([]UnspentOutput, error) {
+	c.logf("[RPC] ListUnspent: Fetching UTXOs with at least %d confirmations", minConf)
+	result, err := c.sharedCall("listunspent", []interface{}{minConf})
+	if err != nil {
+		c.logf("[RPC] ListUnspent ERROR: %v", err)
+		return nil, err
+	}
+
+	items, ok := result.([]interface{})
+	if !ok {
+		c.logf("[RPC] ListUnspent ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected listunspent response type: %T", result)
+	}
+
+	utxos := []UnspentOutput{}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		spendable, _ := m["spendable"].(bool)
+		solvable, _ := m["solvable"].(bool)
+		safe, _ := m["safe"].(bool)
+		utxos = append(utxos, UnspentOutput{
+			Txid:          GetString(m, "txid"),
+			Vout:          GetInt(m, "vout"),
+			Address:       GetString(m, "address"),
+			Label:         GetString(m, "label"),
+			ScriptPubKey:  GetString(m, "scriptPubKey"),
+			Amount:        GetAmount(m, "amount"),
+			Confirmations: GetInt(m, "confirmations"),
+			Spendable:     spendable,
+			Solvable:      solvable,
+			Safe:          safe,
+		})
+	}
+
+	c.logf("[RPC] ListUnspent: Retrieved %d UTXOs", len(utxos))
+	return utxos, nil
+}
+
+// Outpoint identifies a transaction output
+type Outpoint struct {
+	Txid string `json:"txid"`
+	Vout int    `json:"vout"`
+}
+
+// FundedTransaction is the result of fundrawtransaction
+type FundedTransaction struct {
+	Hex       string
+	Fee       Amount
+	ChangePos int
+}
+
+// CreateRawTransaction builds an unsigned transaction spending inputs to outputs.
+// outputs is a list of {address: amount} or {"data": hex} objects, in order.
+func (c *Client) CreateRawTransaction(inputs []Outpoint, outputs []map[string]interface{}) (string, error) {
+	c.logf("[RPC] CreateRawTransaction: %d inputs, %d outputs", len(inputs), len(outputs))
+
+	rawInputs := []interface{}{}
+	for _, in := range inputs {
+		rawInputs = append(rawInputs, map[string]interface{}{"txid": in.Txid, "vout": in.Vout})
+	}
+	rawOutputs := []interface{}{}
+	for _, out := range outputs {
+		rawOutputs = append(rawOutputs, out)
+	}
+
+	result, err := c.call("createrawtransaction", []interface{}{rawInputs, rawOutputs})
+	if err != nil {
+		c.logf("[RPC] CreateRawTransaction ERROR: %v", err)
+		return "", err
+	}
+
+	hex, ok := result.(string)
+	if !ok {
+		c.logf("[RPC] CreateRawTransaction ERROR: unexpected result type: %T", result)
+		return "", fmt.Errorf("unexpected createrawtransaction response type: %T", result)
+	}
+	return hex, nil
+}
+
+// FundRawTransaction adds inputs and change to a raw transaction as needed
+func (c *Client) FundRawTransaction(hex string, options map[string]interface{}) (*FundedTransaction, error) {
+	c.logf("[RPC] FundRawTransaction: options %v", options)
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	result, err := c.call("fundrawtransaction", []interface{}{hex, options})
+	if err != nil {
+		c.logf("[RPC] FundRawTransaction ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] FundRawTransaction ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected fundrawtransaction response type: %T", result)
+	}
+
+	funded := &FundedTransaction{
+		Hex:       GetString(m, "hex"),
+		Fee:       GetAmount(m, "fee"),
+		ChangePos: GetInt(m, "changepos"),
+	}
+	c.logf("[RPC] FundRawTransaction SUCCESS: fee=%s changepos=%d", funded.Fee, funded.ChangePos)
+	return funded, nil
+}
+
+// SignRawTransactionWithWallet signs a raw transaction with the node's keys
+func (c *Client) SignRawTransactionWithWallet(hex string) (string, bool, error) {
+	c.logf("[RPC] SignRawTransactionWithWallet: signing transaction")
+	result, err := c.call("signrawtransactionwithwallet", []interface{}{hex})
+	if err != nil {
+		c.logf("[RPC] SignRawTransactionWithWallet ERROR: %v", err)
+		return "", false, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] SignRawTransactionWithWallet ERROR: unexpected result type: %T", result)
+		return "", false, fmt.Errorf("unexpected signrawtransactionwithwallet response type: %T", result)
+	}
+
+	complete, _ := m["complete"].(bool)
+	return GetString(m, "hex"), complete, nil
+}
+
+// SendRawTransaction broadcasts a signed transaction
+func (c *Client) SendRawTransaction(hex string) (string, error) {
+	c.logf("[RPC] SendRawTransaction: broadcasting transaction")
+	result, err := c.call("sendrawtransaction", []interface{}{hex})
+	if err != nil {
+		c.logf("[RPC] SendRawTransaction ERROR: %v", err)
+		return "", err
+	}
+
+	txid, ok := result.(string)
+	if !ok {
+		c.logf("[RPC] SendRawTransaction ERROR: unexpected result type: %T", result)
+		return "", fmt.Errorf("unexpected sendrawtransaction response type: %T", result)
+	}
+
+	c.logf("[RPC] SendRawTransaction SUCCESS: txid=%s", txid)
+	return txid, nil
+}
+
+// GetTransaction returns the wallet's view of a transaction (gettransaction)
+func (c *Client) GetTransaction(txid string) (map[string]interface{}, error) {
+	c.logf("[RPC] GetTransaction called for txid: %s", txid)
+	result, err := c.call("gettransaction", []interface{}{txid})
+	if err != nil {
+		c.logf("[RPC] GetTransaction ERROR: %v", err)
+		return nil, err
+	}
+
+	tx, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] GetTransaction ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected gettransaction response type: %T", result)
+	}
+	return tx, nil
+}
+
+func (c *Client) GetRawTransaction(txid string, verbose bool) (interface{}, error) {
+	c.logf("[RPC] GetRawTransaction called for txid: %s", txid)
+	verboseInt := 0
+	if verbose {
+		verboseInt = 1
+	}
+	result, err := c.call("getrawtransaction", []interface{}{txid, verboseInt})
+	if err != nil {
+		c.logf("[RPC] GetRawTransaction ERROR: %v", err)
+		return nil, err
+	}
+	c.logf("[RPC] GetRawTransaction SUCCESS")
+	return result, nil
+}
+
+func (c *Client) GetAddressesByLabel(label string) ([]string, error) {
+	c.logf("[RPC] GetAddressesByLabel: Fetching addresses with label '%s'", label)
+	result, err := c.call("getaddressesbylabel", []interface{}{label})
+	if err != nil {
+		c.logf("[RPC] GetAddressesByLabel ERROR: %v", err)
+		return nil, err
+	}
+
+	c.logf("[RPC] GetAddressesByLabel result type: %T, value: %v", result, result)
+
+	// Result should be a map of address -> info
+	addressMap, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] GetAddressesByLabel ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected getaddressesbylabel response type: %T", result)
+	}
+
+	addresses := []string{}
+	for addr := range addressMap {
+		addresses = append(addresses, addr)
+	}
+
+	c.logf("[RPC] GetAddressesByLabel SUCCESS: Retrieved %d addresses", len(addresses))
+	return addresses, nil
+}
+
+func (c *Client) GetNewAddress(label, addressType string) (string, error) {
+	c.logf("[RPC] GetNewAddress: Generating new address with type '%s'", addressType)
+	result, err := c.call("getnewaddress", []interface{}{label, addressType})
+	if err != nil {
+		c.logf("[RPC] GetNewAddress ERROR: %v", err)
+		return "", err
+	}
+
+	addr, ok := result.(string)
+	if !ok {
+		c.logf("[RPC] GetNewAddress ERROR: unexpected result type: %T", result)
+		return "", fmt.Errorf("unexpected getnewaddress response type: %T", result)
+	}
+
+	c.logf("[RPC] GetNewAddress SUCCESS: %s", addr)
+	return addr, nil
+}
+
+// GetRawChangeAddress returns a new address of the wallet's change keychain
+func (c *Client) GetRawChangeAddress(addressType string) (string, error) {
+	c.logf("[RPC] GetRawChangeAddress: Generating new change address with type '%s'", addressType)
+	result, err := c.call("getrawchangeaddress", []interface{}{addressType})
+	if err != nil {
+		c.logf("[RPC] GetRawChangeAddress ERROR: %v", err)
+		return "", err
+	}
+
+	addr, ok := result.(string)
+	if !ok {
+		c.logf("[RPC] GetRawChangeAddress ERROR: unexpected result type: %T", result)
+		return "", fmt.Errorf("unexpected getrawchangeaddress response type: %T", result)
+	}
+
+	c.logf("[RPC] GetRawChangeAddress SUCCESS: %s", addr)
+	return addr, nil
+}
+
+// DumpPrivKey returns the WIF of a node wallet address's key. The key
+// itself is never logged.
+func (c *Client) DumpPrivKey(address string) (string, error) {
+	c.logf("[RPC] DumpPrivKey: %s", address)
+	result, err := c.call("dumpprivkey", []interface{}{address})
+	if err != nil {
+		c.logf("[RPC] DumpPrivKey ERROR: %v", err)
+		return "", err
+	}
+
+	wif, ok := result.(string)
+	if !ok {
+		c.logf("[RPC] DumpPrivKey ERROR: unexpected result type: %T", result)
+		return "", fmt.Errorf("unexpected dumpprivkey response type: %T", result)
+	}
+	return wif, nil
+}
+
+// MultisigAddress is the result of addmultisigaddress
+type MultisigAddress struct {
+	Address      string
+	RedeemScript string
+	Descriptor   string
+}
+
+// AddMultisigAddress adds an m-of-n multisig address to the wallet, which
+// then watches it and can fill in its scripts when creating PSBTs
+func (c *Client) AddMultisigAddress(required int, pubkeys []string, label, addressType string) (*MultisigAddress, error) {
+	c.logf("[RPC] AddMultisigAddress: %d-of-%d, type '%s'", required, len(pubkeys), addressType)
+	result, err := c.call("addmultisigaddress", []interface{}{required, pubkeys, label, addressType})
+	if err != nil {
+		c.logf("[RPC] AddMultisigAddress ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] AddMultisigAddress ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected addmultisigaddress response type: %T", result)
+	}
+
+	c.logf("[RPC] AddMultisigAddress SUCCESS: %s", GetString(m, "address"))
+	return &MultisigAddress{
+		Address:      GetString(m, "address"),
+		RedeemScript: GetString(m, "redeemScript"),
+		Descriptor:   GetString(m, "descriptor"),
+	}, nil
+}
+
+func (c *Client) GetNetworkInfo() (interface{}, error) {
+	c.logf("[RPC] GetNetworkInfo: Fetching network information")
+	result, err := c.sharedCall("getnetworkinfo", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetNetworkInfo ERROR: %v", err)
+		return nil, err
+	}
+	c.logf("[RPC] GetNetworkInfo SUCCESS")
+	return result, nil
+}
+
+func (c *Client) GetBlockchainInfo() (interface{}, error) {
+	c.logf("[RPC] GetBlockchainInfo: Fetching blockchain information")
+	result, err := c.sharedCall("getblockchaininfo", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetBlockchainInfo ERROR: %v", err)
+		return nil, err
+	}
+	c.logf("[RPC] GetBlockchainInfo SUCCESS")
+	return result, nil
+}
+
+// EstimateSmartFee returns the estimated fee rate in KCN/kvB for confirmation
+// within confTarget blocks, or 0 if the node does not have enough data yet
+func (c *Client) EstimateSmartFee(confTarget int) (float64, error) {
+	c.logf("[RPC] EstimateSmartFee: Estimating fee for %d blocks", confTarget)
+	result, err := c.sharedCall("estimatesmartfee", []interface{}{confTarget})
+	if err != nil {
+		c.logf("[RPC] EstimateSmartFee ERROR: %v", err)
+		return 0, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] EstimateSmartFee ERROR: unexpected result type: %T", result)
+		return 0, fmt.Errorf("unexpected estimatesmartfee response type: %T", result)
+	}
+
+	if _, ok := m["feerate"]; !ok {
+		c.logf("[RPC] EstimateSmartFee: no estimate available (%v)", m["errors"])
+		return 0, nil
+	}
+	return GetFloat64(m, "feerate"), nil
+}
+
+// MempoolInfo is the subset of getmempoolinfo the wallet uses
+type MempoolInfo struct {
+	Size       int64   `json:"size"`
+	Bytes      int64   `json:"bytes"`
+	MinFeeRate float64 `json:"mempool_min_fee"`
+}
+
+func (c *Client) GetMempoolInfo() (*MempoolInfo, error) {
+	c.logf("[RPC] GetMempoolInfo: Fetching mempool statistics")
+	result, err := c.sharedCall("getmempoolinfo", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetMempoolInfo ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] GetMempoolInfo ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected getmempoolinfo response type: %T", result)
+	}
+
+	return &MempoolInfo{
+		Size:       GetInt64(m, "size"),
+		Bytes:      GetInt64(m, "bytes"),
+		MinFeeRate: GetFloat64(m, "mempoolminfee"),
+	}, nil
+}
+
+// GetChainName returns the chain the node is running on (main, test, regtest)
+func (c *Client) GetChainName() (string, error) {
+	info, err := c.GetBlockchainInfo()
+	if err != nil {
+		return "", err
+	}
+	m, ok := info.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("unexpected getblockchaininfo response type: %T", info)
+	}
+	return GetString(m, "chain"), nil
+}
+
+// GetBestBlock returns the height and hash of the node's chain tip
+func (c *Client) GetBestBlock() (int64, string, error) {
+	info, err := c.GetBlockchainInfo()
+	if err != nil {
+		return 0, "", err
+	}
+	m, ok := info.(map[string]interface{})
+	if !ok {
+		return 0, "", fmt.Errorf("unexpected getblockchaininfo response type: %T", info)
+	}
+	hash := GetString(m, "bestblockhash")
+	c.balances.NoteTip(hash)
+	return GetInt64(m, "blocks"), hash, nil
+}
+
+// GenerateToAddress mines blocks paying the coinbase to address (regtest only)
+func (c *Client) GenerateToAddress(blocks int, address string) ([]string, error) {
+	c.logf("[RPC] GenerateToAddress: Mining %d blocks to %s", blocks, address)
+	result, err := c.call("generatetoaddress", []interface{}{blocks, address})
+	if err != nil {
+		c.logf("[RPC] GenerateToAddress ERROR: %v", err)
+		return nil, err
+	}
+
+	items, ok := result.([]interface{})
+	if !ok {
+		c.logf("[RPC] GenerateToAddress ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected generatetoaddress response type: %T", result)
+	}
+
+	hashes := []string{}
+	for _, item := range items {
+		if hash, ok := item.(string); ok {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	c.logf("[RPC] GenerateToAddress SUCCESS: Mined %d blocks", len(hashes))
+	return hashes, nil
+}
+
+func (c *Client) GetBlockHash(height int64) (string, error) {
+	result, err := c.call("getblockhash", []interface{}{height})
+	if err != nil {
+		return "", err
+	}
+
+	hash, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected getblockhash response type: %T", result)
+	}
+	return hash, nil
+}
+
+// GetBlockTime returns the timestamp of the block at height
+func (c *Client) GetBlockTime(height int64) (int64, error) {
+	hash, err := c.GetBlockHash(height)
+	if err != nil {
+		return 0, err
+	}
+	result, err := c.sharedCall("getblockheader", []interface{}{hash})
+	if err != nil {
+		return 0, err
+	}
+
+	header, ok := result.(map[string]interface{})
+	if !ok {
+		return 0, fmt.Errorf("unexpected getblockheader response type: %T", result)
+	}
+	return GetInt64(header, "time"), nil
+}
+
+// InvalidateBlock marks a block and all its descendants invalid
+func (c *Client) InvalidateBlock(hash string) error {
+	c.logf("[RPC] InvalidateBlock: %s", hash)
+	_, err := c.call("invalidateblock", []interface{}{hash})
+	if err != nil {
+		c.logf("[RPC] InvalidateBlock ERROR: %v", err)
+	}
+	return err
+}
+
+// ScannedUTXO is an unspent output found by scantxoutset
+type ScannedUTXO struct {
+	Txid         string
+	Vout         int
+	ScriptPubKey string
+	Amount       Amount
+	Height       int64
+}
+
+// ScanTxOutSet scans the chain's UTXO set for outputs matching the output
+// descriptors (e.g. "addr(K...)"). Works without importing anything into the
+// wallet, but only sees confirmed outputs.
+func (c *Client) ScanTxOutSet(descriptors []string) ([]ScannedUTXO, error) {
+	c.logf("[RPC] ScanTxOutSet: Scanning UTXO set for %d descriptors", len(descriptors))
+
+	objects := []interface{}{}
+	for _, desc := range descriptors {
+		objects = append(objects, desc)
+	}
+
+	result, err := c.call("scantxoutset", []interface{}{"start", objects})
+	if err != nil {
+		c.logf("[RPC] ScanTxOutSet ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] ScanTxOutSet ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected scantxoutset response type: %T", result)
+	}
+	if success, ok := m["success"].(bool); ok && !success {
+		return nil, fmt.Errorf("scantxoutset did not complete")
+	}
+
+	utxos := []ScannedUTXO{}
+	if unspents, ok := m["unspents"].([]interface{}); ok {
+		for _, item := range unspents {
+			u, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			utxos = append(utxos, ScannedUTXO{
+				Txid:         GetString(u, "txid"),
+				Vout:         GetInt(u, "vout"),
+				ScriptPubKey: GetString(u, "scriptPubKey"),
+				Amount:       GetAmount(u, "amount"),
+				Height:       GetInt64(u, "height"),
+			})
+		}
+	}
+
+	c.logf("[RPC] ScanTxOutSet SUCCESS: Found %d UTXOs", len(utxos))
+	return utxos, nil
+}
+
+// PSBTResult is the common shape of the wallet PSBT RPCs
+type PSBTResult struct {
+	PSBT      string
+	Fee       Amount
+	ChangePos int
+	Complete  bool
+	Hex       string
+}
+
+// WalletCreateFundedPSBT creates and funds a PSBT paying outputs. Inputs are
+// optional; options are passed through to the node.
+func (c *Client) WalletCreateFundedPSBT(inputs []Outpoint, outputs []map[string]interface{}, options map[string]interface{}) (*PSBTResult, error) {
+	c.logf("[RPC] WalletCreateFundedPSBT: %d inputs, %d outputs", len(inputs), len(outputs))
+
+	rawInputs := []interface{}{}
+	for _, in := range inputs {
+		rawInputs = append(rawInputs, map[string]interface{}{"txid": in.Txid, "vout": in.Vout})
+	}
+	rawOutputs := []interface{}{}
+	for _, out := range outputs {
+		rawOutputs = append(rawOutputs, out)
+	}
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+
+	result, err := c.call("walletcreatefundedpsbt", []interface{}{rawInputs, rawOutputs, 0, options, true})
+	if err != nil {
+		c.logf("[RPC] WalletCreateFundedPSBT ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] WalletCreateFundedPSBT ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected walletcreatefundedpsbt response type: %T", result)
+	}
+
+	return &PSBTResult{
+		PSBT:      GetString(m, "psbt"),
+		Fee:       GetAmount(m, "fee"),
+		ChangePos: GetInt(m, "changepos"),
+	}, nil
+}
+
+// WalletProcessPSBT adds wallet UTXO data and, if sign is set, signatures
+func (c *Client) WalletProcessPSBT(psbt string, sign bool) (*PSBTResult, error) {
+	c.logf("[RPC] WalletProcessPSBT: processing PSBT (sign=%v)", sign)
+	result, err := c.call("walletprocesspsbt", []interface{}{psbt, sign, "ALL", true})
+	if err != nil {
+		c.logf("[RPC] WalletProcessPSBT ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] WalletProcessPSBT ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected walletprocesspsbt response type: %T", result)
+	}
+
+	complete, _ := m["complete"].(bool)
+	return &PSBTResult{
+		PSBT:     GetString(m, "psbt"),
+		Complete: complete,
+	}, nil
+}
+
+// FinalizePSBT finalizes a fully signed PSBT and extracts the network transaction
+func (c *Client) FinalizePSBT(psbt string) (*PSBTResult, error) {
+	c.logf("[RPC] FinalizePSBT: finalizing PSBT")
+	result, err := c.call("finalizepsbt", []interface{}{psbt, true})
+	if err != nil {
+		c.logf("[RPC] FinalizePSBT ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] FinalizePSBT ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected finalizepsbt response type: %T", result)
+	}
+
+	complete, _ := m["complete"].(bool)
+	return &PSBTResult{
+		PSBT:     GetString(m, "psbt"),
+		Hex:      GetString(m, "hex"),
+		Complete: complete,
+	}, nil
+}
+
+// CombinePSBT merges the signatures and data of PSBTs for the same
+// transaction, such as copies signed by different devices
+func (c *Client) CombinePSBT(psbts []string) (string, error) {
+	c.logf("[RPC] CombinePSBT: combining %d PSBTs", len(psbts))
+	result, err := c.call("combinepsbt", []interface{}{psbts})
+	if err != nil {
+		c.logf("[RPC] CombinePSBT ERROR: %v", err)
+		return "", err
+	}
+
+	psbt, ok := result.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected combinepsbt response type: %T", result)
+	}
+	return psbt, nil
+}
+
+// DecodePSBT returns the node's JSON description of a PSBT
+func (c *Client) DecodePSBT(psbt string) (map[string]interface{}, error) {
+	result, err := c.call("decodepsbt", []interface{}{psbt})
+	if err != nil {
+		c.logf("[RPC] DecodePSBT ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected decodepsbt response type: %T", result)
+	}
+	return m, nil
+}
+
+// MempoolEntry is the subset of getmempoolentry used for fee bumping.
+// Ancestor figures include the transaction itself.
+type MempoolEntry struct {
+	VSize        int64
+	Fee          Amount
+	AncestorSize int64
+	AncestorFees Amount
+}
+
+func (c *Client) GetMempoolEntry(txid string) (*MempoolEntry, error) {
+	c.logf("[RPC] GetMempoolEntry: %s", txid)
+	result, err := c.call("getmempoolentry", []interface{}{txid})
+	if err != nil {
+		c.logf("[RPC] GetMempoolEntry ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		c.logf("[RPC] GetMempoolEntry ERROR: unexpected result type: %T", result)
+		return nil, fmt.Errorf("unexpected getmempoolentry response type: %T", result)
+	}
+	fees, ok := m["fees"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("getmempoolentry missing 'fees' field")
+	}
+
+	return &MempoolEntry{
+		VSize:        GetInt64(m, "vsize"),
+		Fee:          GetAmount(fees, "base"),
+		AncestorSize: GetInt64(m, "ancestorsize"),
+		AncestorFees: GetAmount(fees, "ancestor"),
+	}, nil
+}
+
+// AbandonTransaction marks an unconfirmed wallet transaction that is not in
+// the mempool as abandoned, releasing its inputs for other sends
+func (c *Client) AbandonTransaction(txid string) error {
+	c.logf("[RPC] AbandonTransaction: %s", txid)
+	_, err := c.call("abandontransaction", []interface{}{txid})
+	if err != nil {
+		c.logf("[RPC] AbandonTransaction ERROR: %v", err)
+	}
+	return err
+}
+
+// BackupWallet has the node copy its wallet to destination, a path on the
+// node's filesystem
+func (c *Client) BackupWallet(destination string) error {
+	c.logf("[RPC] BackupWallet: %s", destination)
+	_, err := c.call("backupwallet", []interface{}{destination})
+	if err != nil {
+		c.logf("[RPC] BackupWallet ERROR: %v", err)
+	}
+	return err
+}
+
+// RestoreWallet has the node create and load wallet name from the backup
+// file at backupFile, loading it again on every node start. It returns the
+// node's warning, if any.
+func (c *Client) RestoreWallet(name, backupFile string) (string, error) {
+	c.logf("[RPC] RestoreWallet: %s from %s", name, backupFile)
+	result, err := c.call("restorewallet", []interface{}{name, backupFile, true})
+	if err != nil {
+		c.logf("[RPC] RestoreWallet ERROR: %v", err)
+		return "", err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("unexpected restorewallet response type: %T", result)
+	}
+	return GetString(m, "warning"), nil
+}
+
+// RescanBlockchain rescans blocks from start (to stop, or the tip when stop
+// is 0) for wallet transactions, returning the range scanned. It returns
+// when the rescan is done, which can take hours.
+func (c *Client) RescanBlockchain(start, stop int64) (int64, int64, error) {
+	c.logf("[RPC] RescanBlockchain: from %d to %d", start, stop)
+	params := []interface{}{start}
+	if stop > 0 {
+		params = append(params, stop)
+	}
+	result, err := c.call("rescanblockchain", params)
+	if err != nil {
+		c.logf("[RPC] RescanBlockchain ERROR: %v", err)
+		return 0, 0, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected rescanblockchain response type: %T", result)
+	}
+	return GetInt64(m, "start_height"), GetInt64(m, "stop_height"), nil
+}
+
+// AbortRescan stops a running rescan; false means none was running
+func (c *Client) AbortRescan() (bool, error) {
+	c.logf("[RPC] AbortRescan")
+	result, err := c.call("abortrescan", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] AbortRescan ERROR: %v", err)
+		return false, err
+	}
+	aborted, _ := result.(bool)
+	return aborted, nil
+}
+
+// ScanProgress returns whether the wallet is rescanning and how far along
+// (0 to 1), from getwalletinfo
+func (c *Client) ScanProgress() (bool, float64, error) {
+	info, err := c.GetWalletInfo()
+	if err != nil {
+		return false, 0, err
+	}
+	scanning, ok := info["scanning"].(map[string]interface{})
+	if !ok {
+		// false when idle
+		return false, 0, nil
+	}
+	return true, GetFloat64(scanning, "progress"), nil
+}
+
+// GroupedAddress is one address of a listaddressgroupings group
+type GroupedAddress struct {
+	Address string `json:"address"`
+	Amount  Amount `json:"amount"`
+	Label   string `json:"label,omitempty"`
+}
+
+// ListAddressGroupings returns the wallet's addresses grouped by common
+// ownership made public on chain: inputs spent together, and change
+func (c *Client) ListAddressGroupings() ([][]GroupedAddress, error) {
+	result, err := c.sharedCall("listaddressgroupings", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] ListAddressGroupings ERROR: %v", err)
+		return nil, err
+	}
+
+	list, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected listaddressgroupings response type: %T", result)
+	}
+	groups := make([][]GroupedAddress, 0, len(list))
+	for _, g := range list {
+		entries, _ := g.([]interface{})
+		group := make([]GroupedAddress, 0, len(entries))
+		for _, e := range entries {
+			// [address, amount] or [address, amount, label]
+			fields, _ := e.([]interface{})
+			if len(fields) < 2 {
+				continue
+			}
+			entry := map[string]interface{}{"amount": fields[1]}
+			addr := GroupedAddress{Amount: GetAmount(entry, "amount")}
+			addr.Address, _ = fields[0].(string)
+			if len(fields) > 2 {
+				addr.Label, _ = fields[2].(string)
+			}
+			group = append(group, addr)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// ListWallets returns the names of the wallets the node has loaded
+func (c *Client) ListWallets() ([]string, error) {
+	result, err := c.call("listwallets", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] ListWallets ERROR: %v", err)
+		return nil, err
+	}
+
+	list, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected listwallets response type: %T", result)
+	}
+	names := make([]string, 0, len(list))
+	for _, v := range list {
+		if name, ok := v.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// CreateWallet has the node create and load an empty descriptor wallet
+// called name, loading it again on every node start
+func (c *Client) CreateWallet(name string) error {
+	c.logf("[RPC] CreateWallet: %s", name)
+	// wallet_name, disable_private_keys, blank, passphrase, avoid_reuse,
+	// descriptors, load_on_startup
+	_, err := c.call("createwallet", []interface{}{name, false, false, "", false, true, true})
+	if err != nil {
+		c.logf("[RPC] CreateWallet ERROR: %v", err)
+	}
+	return err
+}
+
+// LoadWallet has the node load the wallet called name. A wallet that is
+// loaded already is not an error.
+func (c *Client) LoadWallet(name string) error {
+	c.logf("[RPC] LoadWallet: %s", name)
+	_, err := c.call("loadwallet", []interface{}{name})
+	if err != nil && strings.Contains(err.Error(), "already loaded") {
+		return nil
+	}
+	if err != nil {
+		c.logf("[RPC] LoadWallet ERROR: %v", err)
+	}
+	return err
+}
+
+// UnloadWallet has the node unload the wallet called name and stop
+// loading it on start. The wallet's files stay on the node.
+func (c *Client) UnloadWallet(name string) error {
+	c.logf("[RPC] UnloadWallet: %s", name)
+	_, err := c.call("unloadwallet", []interface{}{name, false})
+	if err != nil {
+		c.logf("[RPC] UnloadWallet ERROR: %v", err)
+	}
+	return err
+}
+
+// LockUnspent locks (or with unlock set, unlocks) outpoints so coin selection
+// skips them. Locks are in-memory unless persistent is set. Unlocking with no
+// outpoints releases every lock.
+func (c *Client) LockUnspent(unlock bool, outpoints []Outpoint, persistent bool) error {
+	c.logf("[RPC] LockUnspent: unlock=%v, %d outpoints, persistent=%v", unlock, len(outpoints), persistent)
+
+	params := []interface{}{unlock}
+	if len(outpoints) > 0 || persistent {
+		list := []interface{}{}
+		for _, op := range outpoints {
+			list = append(list, map[string]interface{}{"txid": op.Txid, "vout": op.Vout})
+		}
+		params = append(params, list)
+	}
+	if persistent {
+		params = append(params, true)
+	}
+
+	result, err := c.call("lockunspent", params)
+	if err != nil {
+		c.logf("[RPC] LockUnspent ERROR: %v", err)
+		return err
+	}
+	if ok, _ := result.(bool); !ok {
+		return fmt.Errorf("lockunspent returned %v", result)
+	}
+	return nil
+}
+
+// ListLockUnspent returns the currently locked outpoints
+func (c *Client) ListLockUnspent() ([]Outpoint, error) {
+	result, err := c.call("listlockunspent", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] ListLockUnspent ERROR: %v", err)
+		return nil, err
+	}
+
+	items, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected listlockunspent response type: %T", result)
+	}
+
+	outpoints := []Outpoint{}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			outpoints = append(outpoints, Outpoint{Txid: GetString(m, "txid"), Vout: GetInt(m, "vout")})
+		}
+	}
+	return outpoints, nil
+}
+
+// GetWalletInfo returns the getwalletinfo object for the loaded wallet
+func (c *Client) GetWalletInfo() (map[string]interface{}, error) {
+	result, err := c.sharedCall("getwalletinfo", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetWalletInfo ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected getwalletinfo response type: %T", result)
+	}
+	return m, nil
+}
+
+// GetReceivedByAddress returns the total received by a wallet address in
+// transactions with at least minConf confirmations
+func (c *Client) GetReceivedByAddress(address string, minConf int) (Amount, error) {
+	result, err := c.call("getreceivedbyaddress", []interface{}{address, minConf})
+	if err != nil {
+		c.logf("[RPC] GetReceivedByAddress ERROR: %v", err)
+		return 0, err
+	}
+
+	n, ok := result.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("unexpected getreceivedbyaddress response type: %T", result)
+	}
+	return ParseAmount(n.String())
+}
+
+// PeerInfo is the subset of a getpeerinfo entry the wallet reports
+type PeerInfo struct {
+	ID             int64    `json:"id"`
+	Addr           string   `json:"addr"`
+	Network        string   `json:"network,omitempty"`
+	Inbound        bool     `json:"inbound"`
+	ConnectionType string   `json:"connection_type,omitempty"`
+	Version        int64    `json:"version"`
+	SubVer         string   `json:"subver"`
+	Services       []string `json:"services,omitempty"`
+	StartingHeight int64    `json:"starting_height"`
+	SyncedBlocks   int64    `json:"synced_blocks"`
+	PingTime       float64  `json:"ping_time,omitempty"` // seconds
+	BytesSent      int64    `json:"bytes_sent"`
+	BytesRecv      int64    `json:"bytes_recv"`
+	ConnTime       int64    `json:"conn_time"`
+}
+
+func (c *Client) GetPeerInfo() ([]PeerInfo, error) {
+	result, err := c.call("getpeerinfo", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetPeerInfo ERROR: %v", err)
+		return nil, err
+	}
+
+	items, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected getpeerinfo response type: %T", result)
+	}
+
+	peers := []PeerInfo{}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		peer := PeerInfo{
+			ID:             GetInt64(m, "id"),
+			Addr:           GetString(m, "addr"),
+			Network:        GetString(m, "network"),
+			ConnectionType: GetString(m, "connection_type"),
+			Version:        GetInt64(m, "version"),
+			SubVer:         GetString(m, "subver"),
+			StartingHeight: GetInt64(m, "startingheight"),
+			SyncedBlocks:   GetInt64(m, "synced_blocks"),
+			PingTime:       GetFloat64(m, "pingtime"),
+			BytesSent:      GetInt64(m, "bytessent"),
+			BytesRecv:      GetInt64(m, "bytesrecv"),
+			ConnTime:       GetInt64(m, "conntime"),
+		}
+		peer.Inbound, _ = m["inbound"].(bool)
+		if names, ok := m["servicesnames"].([]interface{}); ok {
+			for _, name := range names {
+				if s, ok := name.(string); ok {
+					peer.Services = append(peer.Services, s)
+				}
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// NetTotals is the node's network traffic since startup
+type NetTotals struct {
+	TotalBytesRecv int64 `json:"total_bytes_recv"`
+	TotalBytesSent int64 `json:"total_bytes_sent"`
+	TimeMillis     int64 `json:"time_millis"`
+}
+
+func (c *Client) GetNetTotals() (*NetTotals, error) {
+	result, err := c.call("getnettotals", []interface{}{})
+	if err != nil {
+		c.logf("[RPC] GetNetTotals ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected getnettotals response type: %T", result)
+	}
+	return &NetTotals{
+		TotalBytesRecv: GetInt64(m, "totalbytesrecv"),
+		TotalBytesSent: GetInt64(m, "totalbytessent"),
+		TimeMillis:     GetInt64(m, "timemillis"),
+	}, nil
+}
+
+// AddressDetails is what the wallet knows about an address
+type AddressDetails struct {
+	Address     string `json:"address"`
+	IsMine      bool   `json:"ismine"`
+	IsWatchOnly bool   `json:"iswatchonly"`
+	Solvable    bool   `json:"solvable"`
+	// ScriptType is p2pkh, p2sh, p2wpkh, p2wsh, p2tr or witness_unknown;
+	// for p2sh the wallet's own redeem script type follows, e.g. p2sh-multisig
+	ScriptType          string `json:"script_type"`
+	Label               string `json:"label,omitempty"`
+	PubKey              string `json:"pubkey,omitempty"`
+	Descriptor          string `json:"desc,omitempty"`
+	HDKeyPath           string `json:"hdkeypath,omitempty"`
+	HDMasterFingerprint string `json:"hdmasterfingerprint,omitempty"`
+}
+
+// GetAddressInfo returns the wallet's view of a valid address
+func (c *Client) GetAddressInfo(address string) (*AddressDetails, error) {
+	result, err := c.sharedCall("getaddressinfo", []interface{}{address})
+	if err != nil {
+		c.logf("[RPC] GetAddressInfo ERROR: %v", err)
+		return nil, err
+	}
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected getaddressinfo response type: %T", result)
+	}
+	info := &AddressDetails{
+		Address:             GetString(m, "address"),
+		PubKey:              GetString(m, "pubkey"),
+		Descriptor:          GetString(m, "desc"),
+		HDKeyPath:           GetString(m, "hdkeypath"),
+		HDMasterFingerprint: GetString(m, "hdmasterfingerprint"),
+	}
+	info.IsMine, _ = m["ismine"].(bool)
+	info.IsWatchOnly, _ = m["iswatchonly"].(bool)
+	info.Solvable, _ = m["solvable"].(bool)
+
+	// labels replaced label; the wallet gives an address one at most
+	if labels, ok := m["labels"].([]interface{}); ok && len(labels) > 0 {
+		info.Label, _ = labels[0].(string)
+	} else {
+		info.Label = GetString(m, "label")
+	}
+
+	isWitness, _ := m["iswitness"].(bool)
+	isScript, _ := m["isscript"].(bool)
+	switch {
+	case isWitness:
+		program := GetString(m, "witness_program")
+		switch version := GetInt(m, "witness_version"); {
+		case version == 0 && len(program) == 40:
+			info.ScriptType = "p2wpkh"
+		case version == 0 && len(program) == 64:
+			info.ScriptType = "p2wsh"
+		case version == 1 && len(program) == 64:
+			info.ScriptType = "p2tr"
+		default:
+			info.ScriptType = "witness_unknown"
+		}
+	case isScript:
+		info.ScriptType = "p2sh"
+		if inner := GetString(m, "script"); inner != "" {
+			info.ScriptType += "-" + inner
+		}
+	default:
+		info.ScriptType = "p2pkh"
+	}
+	return info, nil
+}
@@ -0,0 +1,166 @@
+package rpc_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+	"kernelcoin-wallet/kernelcoin/rpc/rpctest"
+)
+
+func newNode(t *testing.T) *rpctest.Server {
+	t.Helper()
+	if err := hdwallet.UseNetwork("regtest"); err != nil {
+		t.Fatal(err)
+	}
+	node := rpctest.NewServer("regtest")
+	t.Cleanup(node.Close)
+	return node
+}
+
+func TestBalanceInfo(t *testing.T) {
+	node := newNode(t)
+	node.SetResult("getbalances", map[string]interface{}{
+		"mine": map[string]interface{}{"trusted": 1.1, "untrusted_pending": 0.2, "immature": 0.00000001},
+	})
+
+	info, err := node.Client().GetBalanceInfo("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Confirmed != 110000000 || info.Unconfirmed != 20000000 || info.Immature != 1 {
+		t.Errorf("balances %+v", info)
+	}
+	if info.Total != info.Confirmed+info.Unconfirmed+info.Immature {
+		t.Errorf("total %v of %+v", info.Total, info)
+	}
+}
+
+func TestBalanceCache(t *testing.T) {
+	node := newNode(t)
+	client := node.Client()
+	client.SetBalanceTTL(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetBalanceInfo(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := node.Calls("getbalances"); calls != 1 {
+		t.Errorf("3 cached reads made %d getbalances calls", calls)
+	}
+
+	// Spending drops the cached balance
+	address, err := client.GetNewAddress("", "bech32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SendToAddress(address, rpc.AmountFromKCN(0.1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetBalanceInfo(""); err != nil {
+		t.Fatal(err)
+	}
+	if calls := node.Calls("getbalances"); calls != 2 {
+		t.Errorf("read after a send made %d getbalances calls in all, want 2", calls)
+	}
+}
+
+func TestBalanceCacheDropsStaleFetch(t *testing.T) {
+	node := newNode(t)
+	client := node.Client()
+	client.SetBalanceTTL(time.Minute)
+	node.SetResult("getbalances", map[string]interface{}{"mine": map[string]interface{}{"trusted": 1.0}})
+	node.SetDelay("getbalances", 100*time.Millisecond)
+
+	// A send lands while a read is waiting on the node
+	done := make(chan error)
+	go func() {
+		_, err := client.GetBalanceInfo("")
+		done <- err
+	}()
+	for node.Calls("getbalances") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	node.SetResult("getbalances", map[string]interface{}{"mine": map[string]interface{}{"trusted": 2.0}})
+	address, err := client.GetNewAddress("", "bech32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SendToAddress(address, rpc.AmountFromKCN(0.1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The read from before the send isn't cached over the new balance
+	node.SetDelay("getbalances", 0)
+	info, err := client.GetBalanceInfo("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Confirmed != rpc.AmountFromKCN(2) {
+		t.Errorf("balance after the send %v, want 2 KCN", info.Confirmed)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	node := newNode(t)
+	node.SetError("sendtoaddress", -6, "Insufficient funds")
+
+	_, err := node.Client().SendToAddress("rkcn1qnothing", rpc.AmountFromKCN(1))
+	if err == nil || !strings.Contains(err.Error(), "-6") || !strings.Contains(err.Error(), "Insufficient funds") {
+		t.Errorf("injected error came back as %v", err)
+	}
+
+	client := rpc.NewClient(node.URL, rpctest.User, "wrong")
+	client.SetLogger(func(string, string) {})
+	if _, err := client.GetBlockchainInfo(); !errors.Is(err, rpc.ErrAuth) {
+		t.Errorf("wrong password gave %v, want ErrAuth", err)
+	}
+}
+
+func TestConcurrentReadsShareACall(t *testing.T) {
+	node := newNode(t)
+	node.SetDelay("getblockchaininfo", 200*time.Millisecond)
+	client := node.Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetBlockchainInfo(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := node.Calls("getblockchaininfo"); calls != 1 {
+		t.Errorf("5 concurrent reads made %d calls", calls)
+	}
+}
+
+func TestSecretsStayOutOfLogs(t *testing.T) {
+	node := newNode(t)
+	client := node.Client()
+	var lines []string
+	client.SetLogger(func(_, line string) { lines = append(lines, line) })
+
+	// The key need not be valid: the log is written before the node answers
+	const wif = "cNotARealKeyButSecretEnoughToLookFor1111111111111111"
+	client.ImportPrivateKey(wif, false)
+	for _, line := range lines {
+		if strings.Contains(line, wif) {
+			t.Errorf("key logged: %s", line)
+		}
+	}
+	if len(lines) == 0 {
+		t.Error("nothing logged")
+	}
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import "encoding/json"
+
+// The client decodes results with json.Decoder.UseNumber, so numbers arrive
+// as json.Number; these read fields of a result object whatever their form.
+
+// GetString reads a string from an RPC result, or "" when key is missing
+// or not a string
+func GetString(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// GetFloat64 reads a number from an RPC result, or 0
+func GetFloat64(m map[string]interface{}, key string) float64 {
+	switch v := m[key].(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// GetInt reads an integer from an RPC result, or 0
+func GetInt(m map[string]interface{}, key string) int {
+	return int(GetInt64(m, key))
+}
+
+// GetInt64 reads an integer from an RPC result, or 0
+func GetInt64(m map[string]interface{}, key string) int64 {
+	switch v := m[key].(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return int64(f)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// GetAmount reads a KCN value exactly from an RPC result, or 0
+func GetAmount(m map[string]interface{}, key string) Amount {
+	switch v := m[key].(type) {
+	case json.Number:
+		a, _ := ParseAmount(v.String())
+		return a
+	case float64:
+		return AmountFromKCN(v)
+	}
+	return 0
+}
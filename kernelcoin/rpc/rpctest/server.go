@@ -0,0 +1,174 @@
+// Package rpctest is a fake kernelcoind for tests: an httptest server
+// answering JSON-RPC from the demo package's simulated node, whose answers
+// a test can replace per method, turn into errors or slow down.
+//
+//	node := rpctest.NewServer("regtest")
+//	defer node.Close()
+//	node.SetError("sendtoaddress", -6, "Insufficient funds")
+//	client := node.Client()
+//
+// Keys and addresses are made for hdwallet's network, so tests call
+// hdwallet.UseNetwork with the chain they start the node on.
+package rpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/demo"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// The credentials the server accepts; anything else gets 401, as from
+// kernelcoind
+const (
+	User     = "test"
+	Password = "test"
+)
+
+// Error is a JSON-RPC error, with kernelcoind's codes (-6 insufficient
+// funds, -5 invalid address or key, -32601 unknown method...)
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server is a running fake node. Methods without a result, error or delay
+// set are answered by Node, a simulated wallet with a few weeks of history
+// that mines only when asked (generatetoaddress).
+type Server struct {
+	*httptest.Server
+	Node *demo.Node
+
+	mu      sync.Mutex
+	results map[string]json.RawMessage
+	errors  map[string]Error
+	delays  map[string]time.Duration
+	calls   map[string]int
+}
+
+// NewServer starts a fake node on chain (main, test or regtest)
+func NewServer(chain string) *Server {
+	s := &Server{
+		Node:    demo.NewNode(chain),
+		results: map[string]json.RawMessage{},
+		errors:  map[string]Error{},
+		delays:  map[string]time.Duration{},
+		calls:   map[string]int{},
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Client returns a client of the server that logs nothing and caches no
+// balances, so every call reaches the node
+func (s *Server) Client() *rpc.Client {
+	client := rpc.NewClient(s.URL, User, Password)
+	client.SetLogger(func(string, string) {})
+	client.SetBalanceTTL(0)
+	return client
+}
+
+// SetResult makes method answer result, whatever the parameters. It is
+// the way to give methods the simulated node lacks (PSBTs, multisig,
+// wallet loading) a fixture.
+func (s *Server) SetResult(method string, result interface{}) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		panic("rpctest: " + method + " result: " + err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[method] = raw
+}
+
+// SetError makes method fail with code and message
+func (s *Server) SetError(method string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[method] = Error{Code: code, Message: message}
+}
+
+// SetDelay holds method's answers back by d; an empty method delays every
+// call. A client that gives up stops the wait.
+func (s *Server) SetDelay(method string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[method] = d
+}
+
+// Reset drops every result, error and delay set, and the call counts
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = map[string]json.RawMessage{}
+	s.errors = map[string]Error{}
+	s.delays = map[string]time.Duration{}
+	s.calls = map[string]int{}
+}
+
+// Calls returns how many times method has been called
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// ServeHTTP answers one JSON-RPC call
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != User || password != Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Method string      `json:"method"`
+		ID     interface{} `json:"id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[req.Method]++
+	result, hasResult := s.results[req.Method]
+	rpcErr, hasErr := s.errors[req.Method]
+	delay := s.delays[""] + s.delays[req.Method]
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case hasErr:
+		// kernelcoind's statuses for errors
+		status := http.StatusInternalServerError
+		if rpcErr.Code == -32601 {
+			status = http.StatusNotFound
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": nil, "error": rpcErr, "id": req.ID})
+	case hasResult:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil, "id": req.ID})
+	default:
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		s.Node.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// AddressGroup is a set of wallet addresses anyone watching the chain can
+// tell belong together
+type AddressGroup struct {
+	Addresses []rpc.GroupedAddress `json:"addresses"`
+	Total     rpc.Amount           `json:"total"`
+}
+
+type AddressGroupingsResponse struct {
+	Success bool           `json:"success"`
+	Groups  []AddressGroup `json:"groups"` // largest first
+	// Linked counts addresses that share a group with another one;
+	// Unlinked ones have revealed nothing about the rest
+	Linked   int    `json:"linked"`
+	Unlinked int    `json:"unlinked"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HandleAddressGroupings shows which wallet addresses have been linked on
+// chain by being spent together or receiving change, so users can see
+// what an observer can tie together. Addresses that never received coins
+// aren't listed.
+func (ws *WalletServer) HandleAddressGroupings(w http.ResponseWriter, r *http.Request) {
+	groupings, err := ws.rpc(r).ListAddressGroupings()
+	if err != nil {
+		logRequest(r, "[API] AddressGroupings ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(AddressGroupingsResponse{
+			Success: false,
+			Error:   "Failed to get address groupings",
+		})
+		return
+	}
+
+	response := AddressGroupingsResponse{Success: true, Groups: make([]AddressGroup, 0, len(groupings))}
+	for _, addresses := range groupings {
+		group := AddressGroup{Addresses: addresses}
+		for _, a := range addresses {
+			group.Total += a.Amount
+		}
+		if len(addresses) > 1 {
+			response.Linked += len(addresses)
+		} else {
+			response.Unlinked += len(addresses)
+		}
+		response.Groups = append(response.Groups, group)
+	}
+	sort.SliceStable(response.Groups, func(i, j int) bool {
+		return len(response.Groups[i].Addresses) > len(response.Groups[j].Addresses)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
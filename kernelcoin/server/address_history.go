@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// serveAddressTransactions serves /api/address/{address}/transactions: the
+// wallet entries paying to or received on one address, paginated like
+// /api/transactions and accepting the same filters. The node does not track
+// which address a spend came from, so spends appear under their destination.
+func (ws *WalletServer) serveAddressTransactions(w http.ResponseWriter, r *http.Request, address string) {
+	if valid, err := ws.rpc(r).ValidateAddress(address); err != nil || !valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TransactionsListResponse{
+			Success: false,
+			Error:   "Invalid address",
+		})
+		return
+	}
+
+	page := parsePageParams(r)
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TransactionsListResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	filter.Address = address
+
+	transactions, total, err := ws.filteredTransactions(ws.rpc(r), filter, page)
+	if err != nil {
+		logRequest(r, "[API] AddressTransactions ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TransactionsListResponse{
+			Success: false,
+			Error:   "Failed to list transactions",
+		})
+		return
+	}
+
+	setDirections(transactions)
+	owner := walletOwner(r)
+	ws.setStatuses(owner, transactions)
+	ws.resolveContacts(owner, transactions)
+	ws.resolveMetadata(owner, transactions)
+	addFiatValues(transactions, ws.fiatQuote(r))
+
+	logRequest(r, "[API] AddressTransactions SUCCESS: %d of %d entries for %s", len(transactions), total, address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionsListResponse{
+		Success:      true,
+		Transactions: transactions,
+		Pagination: &Pagination{
+			Count:   page.Count,
+			Skip:    page.Skip,
+			Page:    page.Page,
+			Total:   total,
+			HasMore: page.Skip+len(transactions) < total,
+		},
+	})
+}
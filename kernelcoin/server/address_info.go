@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+type AddressInfoResponse struct {
+	Success bool                `json:"success"`
+	Info    *rpc.AddressDetails `json:"info,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// HandleAddressInfo shows what the wallet knows about ?address=: whether
+// it owns or watches it, its script type, label and HD derivation path
+func (ws *WalletServer) HandleAddressInfo(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimSpace(r.URL.Query().Get("address"))
+	rpc := ws.rpc(r)
+	if valid, err := rpc.ValidateAddress(address); err != nil || !valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(AddressInfoResponse{
+			Success: false,
+			Error:   "Invalid address",
+		})
+		return
+	}
+
+	info, err := rpc.GetAddressInfo(address)
+	if err != nil {
+		logRequest(r, "[API] AddressInfo ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(AddressInfoResponse{
+			Success: false,
+			Error:   "Failed to get address info",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AddressInfoResponse{
+		Success: true,
+		Info:    info,
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// amountText is how rpc.Amount is written in JSON: exactly 8 decimal places
+var amountText = regexp.MustCompile(`^-?[0-9]+\.[0-9]{8}$`)
+
+// freeTextKeys hold what users and the node write, which can look like an
+// amount without being one
+var freeTextKeys = map[string]bool{
+	"label": true, "comment": true, "comment_to": true, "note": true, "notes": true, "tags": true,
+	"name": true, "description": true, "order_id": true, "op_return": true, "text": true, "query": true,
+	"title": true, "message": true, "error": true, "reason": true, "warning": true, "warnings": true,
+	"username": true, "email": true, "amount_words": true,
+}
+
+// withAmountUnits writes the amounts of JSON responses in the unit the
+// unit query parameter names (kcn, mkcn or kernels) instead of KCN.
+// Amounts are found by their form, a string with 8 decimal places, outside
+// free text; with AMOUNT_FORMAT=number they are numbers and stay in KCN.
+// Request amounts are always KCN.
+func withAmountUnits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		unit := strings.ToLower(r.URL.Query().Get("unit"))
+		if unit == "" || unit == rpc.UnitKCN {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !rpc.ValidUnit(unit) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "unit must be kcn, mkcn or kernels",
+				"code":    ErrInvalidRequest,
+			})
+			return
+		}
+
+		uw := &heldWriter{ResponseWriter: w, hold: func(int) bool { return true }}
+		next.ServeHTTP(uw, r)
+		if uw.held == nil {
+			return
+		}
+		uw.rewrite(func(response interface{}) {
+			convertAmounts(response, unit)
+		})
+	})
+}
+
+// convertAmounts rewrites the amounts in a decoded JSON value in unit,
+// returning the value
+func convertAmounts(v interface{}, unit string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if !freeTextKeys[key] {
+				v[key] = convertAmounts(item, unit)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertAmounts(item, unit)
+		}
+	case string:
+		if amountText.MatchString(v) {
+			if amount, err := rpc.ParseAmount(v); err == nil {
+				return amount.Format(unit)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// amountSpeller renders the integer part, decimal separator and digit names
+// of an amount for one language
+type amountSpeller struct {
+	integer func(n uint64) string
+	point   string
+	minus   string
+	digits  [10]string
+}
+
+// amountWordsLocales holds the supported languages, keyed by primary subtag
+var amountWordsLocales = map[string]amountSpeller{
+	"en": {
+		integer: englishInteger,
+		point:   "point",
+		minus:   "minus",
+		digits:  [10]string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine"},
+	},
+	"es": {
+		integer: spanishInteger,
+		point:   "coma",
+		minus:   "menos",
+		digits:  [10]string{"cero", "uno", "dos", "tres", "cuatro", "cinco", "seis", "siete", "ocho", "nueve"},
+	},
+}
+
+type AmountWordsResponse struct {
+	Success bool   `json:"success"`
+	Amount  string `json:"amount,omitempty"`
+	Locale  string `json:"locale,omitempty"`
+	Words   string `json:"words,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// resolveWordsLocale picks a supported locale from a language tag or an
+// Accept-Language header value, defaulting to English
+func resolveWordsLocale(tags string) string {
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(strings.SplitN(tag, ";", 2)[0])
+		lang := strings.ToLower(strings.SplitN(strings.ReplaceAll(tag, "_", "-"), "-", 2)[0])
+		if _, ok := amountWordsLocales[lang]; ok {
+			return lang
+		}
+	}
+	return "en"
+}
+
+// AmountInWords spells out a KCN amount, reading the fractional part digit by
+// digit so "0.05" cannot be confused with "0.5": "zero point zero five kernelcoin"
+func AmountInWords(amount rpc.Amount, locale string) string {
+	speller := amountWordsLocales[resolveWordsLocale(locale)]
+
+	text := amount.String()
+	words := []string{}
+	if strings.HasPrefix(text, "-") {
+		words = append(words, speller.minus)
+		text = text[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(text, ".")
+	fracPart = strings.TrimRight(fracPart, "0")
+
+	n, _ := strconv.ParseUint(intPart, 10, 64)
+	words = append(words, speller.integer(n))
+
+	if fracPart != "" {
+		words = append(words, speller.point)
+		for _, d := range fracPart {
+			words = append(words, speller.digits[d-'0'])
+		}
+	}
+
+	words = append(words, "kernelcoin")
+	return strings.Join(words, " ")
+}
+
+var (
+	englishOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	englishTens   = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	englishScales = []string{"", "thousand", "million", "billion", "trillion"}
+)
+
+func englishInteger(n uint64) string {
+	if n == 0 {
+		return "zero"
+	}
+
+	groups := []string{}
+	for scale := 0; n > 0 && scale < len(englishScales); scale++ {
+		if group := n % 1000; group > 0 {
+			words := englishHundreds(int(group))
+			if englishScales[scale] != "" {
+				words += " " + englishScales[scale]
+			}
+			groups = append([]string{words}, groups...)
+		}
+		n /= 1000
+	}
+	return strings.Join(groups, " ")
+}
+
+func englishHundreds(n int) string {
+	words := []string{}
+	if n >= 100 {
+		words = append(words, englishOnes[n/100], "hundred")
+		n %= 100
+	}
+	switch {
+	case n >= 20 && n%10 != 0:
+		words = append(words, englishTens[n/10]+"-"+englishOnes[n%10])
+	case n >= 20:
+		words = append(words, englishTens[n/10])
+	case n > 0:
+		words = append(words, englishOnes[n])
+	}
+	return strings.Join(words, " ")
+}
+
+var (
+	spanishUnits = []string{"cero", "uno", "dos", "tres", "cuatro", "cinco", "seis", "siete", "ocho", "nueve",
+		"diez", "once", "doce", "trece", "catorce", "quince", "dieciséis", "diecisiete", "dieciocho", "diecinueve",
+		"veinte", "veintiuno", "veintidós", "veintitrés", "veinticuatro", "veinticinco", "veintiséis",
+		"veintisiete", "veintiocho", "veintinueve"}
+	spanishTens     = []string{"", "", "", "treinta", "cuarenta", "cincuenta", "sesenta", "setenta", "ochenta", "noventa"}
+	spanishHundreds = []string{"", "ciento", "doscientos", "trescientos", "cuatrocientos", "quinientos",
+		"seiscientos", "setecientos", "ochocientos", "novecientos"}
+)
+
+func spanishInteger(n uint64) string {
+	if n == 0 {
+		return "cero"
+	}
+
+	millions := n / 1000000
+	rest := n % 1000000
+	words := []string{}
+
+	switch {
+	case millions == 1:
+		words = append(words, "un millón")
+	case millions > 1:
+		words = append(words, spanishApocope(spanishBelowMillion(millions))+" millones")
+	}
+	if rest > 0 {
+		words = append(words, spanishBelowMillion(rest))
+	}
+	return strings.Join(words, " ")
+}
+
+func spanishBelowMillion(n uint64) string {
+	thousands := int(n / 1000)
+	rest := int(n % 1000)
+	words := []string{}
+
+	switch {
+	case thousands == 1:
+		words = append(words, "mil")
+	case thousands > 1:
+		words = append(words, spanishApocope(spanishHundredsWords(thousands))+" mil")
+	}
+	if rest > 0 {
+		words = append(words, spanishHundredsWords(rest))
+	}
+	return strings.Join(words, " ")
+}
+
+func spanishHundredsWords(n int) string {
+	if n == 100 {
+		return "cien"
+	}
+	words := []string{}
+	if n >= 100 {
+		words = append(words, spanishHundreds[n/100])
+		n %= 100
+	}
+	switch {
+	case n >= 30 && n%10 != 0:
+		words = append(words, spanishTens[n/10]+" y "+spanishUnits[n%10])
+	case n >= 30:
+		words = append(words, spanishTens[n/10])
+	case n > 0:
+		words = append(words, spanishUnits[n])
+	}
+	return strings.Join(words, " ")
+}
+
+// spanishApocope shortens a trailing "uno" before "mil"/"millones"
+// ("veintiún mil", "treinta y un millones")
+func spanishApocope(words string) string {
+	switch {
+	case strings.HasSuffix(words, "veintiuno"):
+		return strings.TrimSuffix(words, "veintiuno") + "veintiún"
+	case strings.HasSuffix(words, "uno"):
+		return strings.TrimSuffix(words, "uno") + "un"
+	}
+	return words
+}
+
+// HandleAmountWords spells out an amount for screen-reader friendly previews
+func (ws *WalletServer) HandleAmountWords(w http.ResponseWriter, r *http.Request) {
+	amountStr := r.URL.Query().Get("amount")
+	amount, err := rpc.ParseAmount(amountStr)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(AmountWordsResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid amount %q", amountStr),
+		})
+		return
+	}
+
+	locale := r.URL.Query().Get("locale")
+	if locale == "" {
+		locale = r.Header.Get("Accept-Language")
+	}
+	locale = resolveWordsLocale(locale)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AmountWordsResponse{
+		Success: true,
+		Amount:  amount.String(),
+		Locale:  locale,
+		Words:   AmountInWords(amount, locale),
+	})
+}
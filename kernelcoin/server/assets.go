@@ -0,0 +1,51 @@
+package server
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// embeddedAssets is the frontend built into the binary, so the server runs
+// from any working directory
+//
+//go:embed index.html
+var embeddedAssets embed.FS
+
+// assetsFS returns the frontend files: dir's when set, so UI changes show up
+// on reload without rebuilding, otherwise the embedded ones
+func assetsFS(dir string) (fs.FS, error) {
+	if dir == "" {
+		return embeddedAssets, nil
+	}
+	if _, err := os.Stat(dir + "/index.html"); err != nil {
+		return nil, fmt.Errorf("assets directory %s: %w", dir, err)
+	}
+	return os.DirFS(dir), nil
+}
+
+// serveAsset writes the named file from the assets with the usual
+// conditional-request and range handling
+func (ws *WalletServer) serveAsset(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := ws.assets.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read "+name, http.StatusInternalServerError)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "Failed to read "+name, http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
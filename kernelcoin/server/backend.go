@@ -0,0 +1,228 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Backends for session addresses
+const (
+	BackendNode     = "node"     // kernelcoind's scantxoutset and sendrawtransaction
+	BackendElectrum = "electrum" // an ElectrumX or Fulcrum server
+)
+
+// errNoAddressHistory is returned by backends that cannot list an
+// address's transactions
+var errNoAddressHistory = errors.New("address history needs the electrum backend")
+
+// addressBackend looks up and spends the outputs of addresses that aren't
+// in the node wallet, which is what signing sessions hold
+type addressBackend interface {
+	// UTXOs returns the confirmed outputs paying to addresses
+	UTXOs(addresses []string) ([]hdwallet.LocalUTXO, error)
+	Balance(addresses []string) (AddressBalance, error)
+	History(addresses []string) ([]AddressHistoryEntry, error)
+	// Broadcast sends a signed transaction and returns its txid
+	Broadcast(rawHex string) (string, error)
+	// FeeRate estimates kernels per vbyte for confirmation within blocks,
+	// or 0 when there is no estimate
+	FeeRate(blocks int) (int64, error)
+}
+
+// AddressBalance is the total held by a set of addresses
+type AddressBalance struct {
+	Confirmed   rpc.Amount `json:"confirmed"`
+	Unconfirmed rpc.Amount `json:"unconfirmed"`
+}
+
+// AddressHistoryEntry is a transaction touching a set of addresses.
+// Height is 0 while it is unconfirmed.
+type AddressHistoryEntry struct {
+	Txid   string `json:"txid"`
+	Height int64  `json:"height"`
+}
+
+// backend returns where session addresses are looked up and transactions
+// broadcast: the Electrum server when one is configured, otherwise the node
+func (ws *WalletServer) backend(r *http.Request) addressBackend {
+	if ws.electrum != nil {
+		return ws.electrum
+	}
+	return nodeBackend{ws.rpc(r)}
+}
+
+// nodeBackend serves session addresses from kernelcoind's UTXO set. It
+// sees confirmed outputs only and has no address history.
+type nodeBackend struct {
+	rpc rpc.WalletBackend
+}
+
+func (b nodeBackend) UTXOs(addresses []string) ([]hdwallet.LocalUTXO, error) {
+	descriptors := []string{}
+	for _, addr := range addresses {
+		if addr != "" {
+			descriptors = append(descriptors, "addr("+addr+")")
+		}
+	}
+
+	scanned, err := b.rpc.ScanTxOutSet(descriptors)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := []hdwallet.LocalUTXO{}
+	for _, s := range scanned {
+		hash, err := chainhash.NewHashFromStr(s.Txid)
+		if err != nil {
+			return nil, fmt.Errorf("bad txid %q from scantxoutset: %w", s.Txid, err)
+		}
+		pkScript, err := hex.DecodeString(s.ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("bad scriptPubKey from scantxoutset: %w", err)
+		}
+		utxos = append(utxos, hdwallet.LocalUTXO{
+			OutPoint: *wire.NewOutPoint(hash, uint32(s.Vout)),
+			Value:    int64(s.Amount),
+			PkScript: pkScript,
+		})
+	}
+	return utxos, nil
+}
+
+func (b nodeBackend) Balance(addresses []string) (AddressBalance, error) {
+	utxos, err := b.UTXOs(addresses)
+	if err != nil {
+		return AddressBalance{}, err
+	}
+	var balance AddressBalance
+	for _, u := range utxos {
+		balance.Confirmed += rpc.Amount(u.Value)
+	}
+	return balance, nil
+}
+
+func (b nodeBackend) History(addresses []string) ([]AddressHistoryEntry, error) {
+	return nil, errNoAddressHistory
+}
+
+func (b nodeBackend) Broadcast(rawHex string) (string, error) {
+	return b.rpc.SendRawTransaction(rawHex)
+}
+
+func (b nodeBackend) FeeRate(blocks int) (int64, error) {
+	rate, err := b.rpc.EstimateSmartFee(blocks)
+	if err != nil || rate <= 0 {
+		return 0, err
+	}
+	// KCN/kvB -> kernels/vB
+	return int64(math.Ceil(rate * 1e5)), nil
+}
+
+// estimateFeeRate returns the backend's 6-block estimate in kernels per
+// vbyte, or 1 when there is none
+func estimateFeeRate(b addressBackend) int64 {
+	rate, err := b.FeeRate(6)
+	if err != nil || rate <= 0 {
+		return 1
+	}
+	return rate
+}
+
+type SessionRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+type SessionBalanceResponse struct {
+	Success bool            `json:"success"`
+	Balance *AddressBalance `json:"balance,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type SessionHistoryResponse struct {
+	Success      bool                  `json:"success"`
+	Transactions []AddressHistoryEntry `json:"transactions,omitempty"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// sessionAddresses reads the session from a POSTed SessionRequest and
+// returns its addresses, writing the error response when it can't
+func (ws *WalletServer) sessionAddresses(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req SessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Invalid request format"})
+		return nil, false
+	}
+
+	session, ok := ws.getSession(req.SessionID)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Unknown or expired session"})
+		return nil, false
+	}
+	return []string{session.Wallet.LegacyAddress, session.Wallet.SegWitAddress}, true
+}
+
+// HandleSessionBalance returns the balance of a session's addresses
+func (ws *WalletServer) HandleSessionBalance(w http.ResponseWriter, r *http.Request) {
+	addresses, ok := ws.sessionAddresses(w, r)
+	if !ok {
+		return
+	}
+
+	balance, err := ws.backend(r).Balance(addresses)
+	if err != nil {
+		logRequest(r, "[API] SessionBalance ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(SessionBalanceResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to get balance: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionBalanceResponse{Success: true, Balance: &balance})
+}
+
+// HandleSessionHistory lists the transactions of a session's addresses,
+// newest first. Only the electrum backend keeps address history.
+func (ws *WalletServer) HandleSessionHistory(w http.ResponseWriter, r *http.Request) {
+	addresses, ok := ws.sessionAddresses(w, r)
+	if !ok {
+		return
+	}
+
+	history, err := ws.backend(r).History(addresses)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errNoAddressHistory) {
+			status = http.StatusNotImplemented
+		} else {
+			logRequest(r, "[API] SessionHistory ERROR: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(SessionHistoryResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to get history: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SessionHistoryResponse{Success: true, Transactions: history})
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// BackupPassphraseHeader carries the passphrase that encrypts a backup
+	// download or decrypts an uploaded one. A header keeps it out of URLs
+	// and access logs.
+	BackupPassphraseHeader = "X-Backup-Passphrase"
+	// maxBackupSize caps uploaded backups
+	maxBackupSize = 256 << 20
+	// backupKDFIterations is the PBKDF2-SHA256 work factor of encrypted
+	// backups; decrypt them by hand with
+	// openssl enc -d -aes-256-cbc -pbkdf2 -iter 600000 -md sha256
+	backupKDFIterations = 600000
+)
+
+// opensslMagic starts files written by openssl enc with a salt
+var opensslMagic = []byte("Salted__")
+
+// walletNamePattern is what restored wallets may be called
+var walletNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,63}$`)
+
+// WalletRestoreResponse reports a restored wallet
+type WalletRestoreResponse struct {
+	Success bool   `json:"success"`
+	Wallet  string `json:"wallet,omitempty"`
+	Warning string `json:"warning,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// backupCipher returns AES-256-CBC with the key and IV openssl enc -pbkdf2
+// derives from passphrase and salt
+func backupCipher(passphrase string, salt []byte) (cipher.Block, []byte, error) {
+	keyIV := pbkdf2.Key([]byte(passphrase), salt, backupKDFIterations, 32+aes.BlockSize, sha256.New)
+	block, err := aes.NewCipher(keyIV[:32])
+	return block, keyIV[32:], err
+}
+
+// cbcWriter encrypts or decrypts a stream in CBC mode with PKCS#7 padding,
+// passing whole blocks on as they arrive
+type cbcWriter struct {
+	w       io.Writer
+	mode    cipher.BlockMode
+	decrypt bool
+	buf     []byte
+}
+
+func (c *cbcWriter) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	n := len(c.buf) - len(c.buf)%aes.BlockSize
+	if c.decrypt && n == len(c.buf) {
+		// Hold back the last block: it carries the padding
+		n -= aes.BlockSize
+	}
+	if n <= 0 {
+		return len(p), nil
+	}
+	c.mode.CryptBlocks(c.buf[:n], c.buf[:n])
+	if _, err := c.w.Write(c.buf[:n]); err != nil {
+		return 0, err
+	}
+	c.buf = append(c.buf[:0], c.buf[n:]...)
+	return len(p), nil
+}
+
+// Close writes the final block
+func (c *cbcWriter) Close() error {
+	if !c.decrypt {
+		pad := aes.BlockSize - len(c.buf)
+		c.buf = append(c.buf, bytes.Repeat([]byte{byte(pad)}, pad)...)
+		c.mode.CryptBlocks(c.buf, c.buf)
+		_, err := c.w.Write(c.buf)
+		return err
+	}
+
+	if len(c.buf) != aes.BlockSize {
+		return errors.New("encrypted backup is truncated")
+	}
+	c.mode.CryptBlocks(c.buf, c.buf)
+	pad := int(c.buf[aes.BlockSize-1])
+	if pad < 1 || pad > aes.BlockSize || !bytes.Equal(c.buf[aes.BlockSize-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return errors.New("wrong passphrase or corrupt backup")
+	}
+	_, err := c.w.Write(c.buf[:aes.BlockSize-pad])
+	return err
+}
+
+// newBackupEncrypter writes the openssl header to w and returns a writer
+// that encrypts into it; Close finishes the stream
+func newBackupEncrypter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	block, iv, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(append([]byte(nil), opensslMagic...), salt...)); err != nil {
+		return nil, err
+	}
+	return &cbcWriter{w: w, mode: cipher.NewCBCEncrypter(block, iv)}, nil
+}
+
+// decryptBackup copies the encrypted backup in r to w
+func decryptBackup(w io.Writer, r io.Reader, passphrase string) error {
+	header := make([]byte, len(opensslMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(opensslMagic)], opensslMagic) {
+		return errors.New("backup is not encrypted, or not with openssl enc")
+	}
+	block, iv, err := backupCipher(passphrase, header[len(opensslMagic):])
+	if err != nil {
+		return err
+	}
+	dec := &cbcWriter{w: w, mode: cipher.NewCBCDecrypter(block, iv), decrypt: true}
+	if _, err := io.Copy(dec, r); err != nil {
+		return err
+	}
+	return dec.Close()
+}
+
+// backupPath is a fresh file name in the backup directory
+func (ws *WalletServer) backupPath(kind string) (string, error) {
+	id, err := newRecordID()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(ws.backupDir, fmt.Sprintf("%s-%s-%s.dat", kind, time.Now().UTC().Format("20060102-150405"), id)), nil
+}
+
+// requireBackupDir rejects backup requests when no directory is shared
+// with the node. Returns false if a response has already been written.
+func (ws *WalletServer) requireBackupDir(w http.ResponseWriter) bool {
+	if ws.backupDir != "" {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Wallet backups are not configured (set BACKUP_DIR)"})
+	return false
+}
+
+// HandleWalletBackup has the node back up its wallet into the backup
+// directory and streams the file to the client, encrypted when the
+// passphrase header is set. POST so that OIDC viewers can't download the
+// wallet's keys.
+func (ws *WalletServer) HandleWalletBackup(w http.ResponseWriter, r *http.Request) {
+	if !ws.requireBackupDir(w) {
+		return
+	}
+
+	path, err := ws.backupPath("wallet")
+	if err == nil {
+		defer os.Remove(path)
+		err = ws.rpc(r).BackupWallet(path)
+	}
+	if err != nil {
+		logRequest(r, "[BACKUP] ERROR: backup failed: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Backup failed: %v", err)})
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		logRequest(r, "[BACKUP] ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "The node wrote the backup but it isn't in BACKUP_DIR; the node and wallet server must share that directory"})
+		return
+	}
+	defer f.Close()
+
+	passphrase := r.Header.Get(BackupPassphraseHeader)
+	name := "wallet-" + time.Now().UTC().Format("20060102-150405") + ".dat"
+	if passphrase != "" {
+		name += ".enc"
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+
+	var out io.WriteCloser = nopWriteCloser{w}
+	if passphrase != "" {
+		if out, err = newBackupEncrypter(w, passphrase); err != nil {
+			logRequest(r, "[BACKUP] ERROR: %v", err)
+			return
+		}
+	}
+	if _, err = io.Copy(out, f); err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		// Headers are gone; the client sees a truncated download
+		logRequest(r, "[BACKUP] ERROR: streaming backup failed: %v", err)
+		return
+	}
+	logRequest(r, "[BACKUP] Wallet backup downloaded (encrypted: %v)", passphrase != "")
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// HandleWalletRestore takes a backup as the request body (encrypted ones
+// with the passphrase header) and has the node restore and load it as the
+// wallet named by the name query parameter
+func (ws *WalletServer) HandleWalletRestore(w http.ResponseWriter, r *http.Request) {
+	if !ws.requireBackupDir(w) {
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if !walletNamePattern.MatchString(name) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(WalletRestoreResponse{
+			Success: false,
+			Error:   "name must be 1-64 letters, digits, '.', '_' or '-', not starting with '.'",
+		})
+		return
+	}
+
+	path, err := ws.backupPath("restore")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(WalletRestoreResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer os.Remove(path)
+	if err := ws.saveBackupUpload(path, r); err != nil {
+		logRequest(r, "[BACKUP] Restore rejected: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(WalletRestoreResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	client := ws.rpc(r)
+	warning, err := client.RestoreWallet(name, path)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(WalletRestoreResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Restore failed: %v", err),
+		})
+		return
+	}
+	logRequest(r, "[BACKUP] Restored wallet %s", name)
+
+	// With several wallets loaded the node needs to be told which one each
+	// call is for, which only a /wallet/<name> RPC URL does
+	if wallets, err := client.ListWallets(); err == nil && len(wallets) > 1 && !strings.Contains(ws.rpcClient.URL(), "/wallet/") {
+		if warning != "" {
+			warning += "; "
+		}
+		warning += fmt.Sprintf("the node now has %d wallets loaded: set RPC_URL to .../wallet/%s and restart to use this one", len(wallets), name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(WalletRestoreResponse{
+		Success: true,
+		Wallet:  name,
+		Warning: warning,
+	})
+}
+
+// saveBackupUpload writes the uploaded backup to path, decrypting it if a
+// passphrase was sent
+func (ws *WalletServer) saveBackupUpload(path string, r *http.Request) error {
+	body := countingReader{io.LimitReader(r.Body, maxBackupSize+1), 0}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return fmt.Errorf("cannot write to BACKUP_DIR: %w", err)
+	}
+	defer f.Close()
+
+	if passphrase := r.Header.Get(BackupPassphraseHeader); passphrase != "" {
+		err = decryptBackup(f, &body, passphrase)
+	} else {
+		head := make([]byte, len(opensslMagic))
+		n, _ := io.ReadFull(&body, head)
+		if bytes.Equal(head[:n], opensslMagic) {
+			return fmt.Errorf("backup is encrypted: send its passphrase in %s", BackupPassphraseHeader)
+		}
+		if _, err = f.Write(head[:n]); err == nil {
+			_, err = io.Copy(f, &body)
+		}
+	}
+	if err == nil && body.n > maxBackupSize {
+		err = fmt.Errorf("backup is larger than %d MiB", maxBackupSize>>20)
+	}
+	if err == nil && body.n == 0 {
+		err = errors.New("empty backup")
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (b *countingReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	return n, err
+}
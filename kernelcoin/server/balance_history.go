@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// maxBalanceHistoryPoints bounds one series; a long history needs
+// interval=week
+const maxBalanceHistoryPoints = 5000
+
+// balanceIntervals are the bucket sizes of a balance history. Buckets are
+// aligned to UTC days, and weeks start on Monday.
+var balanceIntervals = map[string]time.Duration{
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// BalancePoint is the wallet's balance at the end of one interval
+type BalancePoint struct {
+	Time     int64      `json:"time"` // the start of the interval, unix seconds
+	Balance  rpc.Amount `json:"balance"`
+	Received rpc.Amount `json:"received"` // during the interval
+	Sent     rpc.Amount `json:"sent"`     // during the interval, fees included
+}
+
+type BalanceHistoryResponse struct {
+	Success  bool           `json:"success"`
+	Interval string         `json:"interval,omitempty"`
+	Points   []BalancePoint `json:"points"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// balanceDelta is what entry tx adds to the balance. A send lists once per
+// output, each carrying the whole fee, so the fee is counted for the first
+// only. Abandoned, conflicted and orphaned entries never moved coins.
+func balanceDelta(tx TransactionResponse, feeCounted map[string]bool) rpc.Amount {
+	if tx.Abandoned || tx.Conflicted || tx.Category == "orphan" {
+		return 0
+	}
+	delta := tx.Amount
+	if tx.Category == "send" && !feeCounted[tx.Txid] {
+		feeCounted[tx.Txid] = true
+		delta += tx.Fee
+	}
+	return delta
+}
+
+// HandleBalanceHistory replays the wallet's transactions into a balance
+// series with one point per ?interval= (day by default, or week), for
+// charting. from_time and to_time narrow the points returned; the balance
+// always counts the whole history. Empty intervals repeat the previous
+// balance so the series has no gaps.
+func (ws *WalletServer) HandleBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	step, ok := balanceIntervals[interval]
+	var err error
+	if !ok {
+		err = fmt.Errorf("interval must be day or week")
+	}
+	var from, to int64
+	if err == nil {
+		if from, err = parseTimeParam(q.Get("from_time"), false); err != nil {
+			err = fmt.Errorf("invalid from_time: %w", err)
+		}
+	}
+	if err == nil {
+		if to, err = parseTimeParam(q.Get("to_time"), true); err != nil {
+			err = fmt.Errorf("invalid to_time: %w", err)
+		}
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BalanceHistoryResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	bucket := func(t int64) int64 {
+		return time.Unix(t, 0).UTC().Truncate(step).Unix()
+	}
+
+	// Net received and sent per interval
+	type flow struct{ received, sent rpc.Amount }
+	flows := map[int64]*flow{}
+	feeCounted := map[string]bool{}
+	err = ws.streamTransactions(ws.rpc(r), TransactionFilter{}, func(batch []TransactionResponse) error {
+		for _, tx := range batch {
+			delta := balanceDelta(tx, feeCounted)
+			if delta == 0 {
+				continue
+			}
+			f := flows[bucket(tx.Time)]
+			if f == nil {
+				f = &flow{}
+				flows[bucket(tx.Time)] = f
+			}
+			if delta > 0 {
+				f.received += delta
+			} else {
+				f.sent -= delta
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logRequest(r, "[API] BalanceHistory ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(BalanceHistoryResponse{
+			Success: false,
+			Error:   "Failed to list transactions",
+		})
+		return
+	}
+
+	points := []BalancePoint{}
+	if len(flows) > 0 {
+		starts := make([]int64, 0, len(flows))
+		for start := range flows {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+		first, last := starts[0], bucket(time.Now().Unix())
+		if from != 0 {
+			first = max(first, bucket(from))
+		}
+		if to != 0 {
+			last = min(last, bucket(to))
+		}
+		if n := (last-first)/int64(step/time.Second) + 1; n > maxBalanceHistoryPoints {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(BalanceHistoryResponse{
+				Success: false,
+				Error:   fmt.Sprintf("%d points is too many (limit %d): use interval=week or from_time", n, maxBalanceHistoryPoints),
+			})
+			return
+		}
+
+		var balance rpc.Amount
+		next := 0
+		for start := starts[0]; start <= last; start += int64(step / time.Second) {
+			var f flow
+			if next < len(starts) && starts[next] == start {
+				f = *flows[start]
+				next++
+			}
+			balance += f.received - f.sent
+			if start >= first {
+				points = append(points, BalancePoint{Time: start, Balance: balance, Received: f.received, Sent: f.sent})
+			}
+		}
+	}
+
+	logRequest(r, "[API] BalanceHistory SUCCESS: %d %s points", len(points), interval)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BalanceHistoryResponse{
+		Success:  true,
+		Interval: interval,
+		Points:   points,
+	})
+}
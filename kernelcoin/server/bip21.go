@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// paymentURIScheme is the BIP 21 URI scheme for Kernelcoin
+const paymentURIScheme = "kernelcoin"
+
+type PaymentURIResponse struct {
+	Success bool   `json:"success"`
+	URI     string `json:"uri,omitempty"`
+	QRURL   string `json:"qr_url,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// bip21Escape percent-encodes a URI parameter value. Spaces become %20, not
+// '+', which BIP 21 parsers would keep literally.
+func bip21Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// paymentURI builds a BIP 21 URI. A zero amount and empty label or message
+// are left out. The amount is in KCN without trailing zeros.
+func paymentURI(address string, amount rpc.Amount, label, message string) string {
+	params := []string{}
+	if amount > 0 {
+		kcn := strings.TrimRight(strings.TrimRight(amount.String(), "0"), ".")
+		params = append(params, "amount="+kcn)
+	}
+	if label != "" {
+		params = append(params, "label="+bip21Escape(label))
+	}
+	if message != "" {
+		params = append(params, "message="+bip21Escape(message))
+	}
+
+	uri := paymentURIScheme + ":" + address
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+	return uri
+}
+
+// parsePaymentRequest reads amount, label and message from the query string
+func parsePaymentRequest(r *http.Request) (amount rpc.Amount, label, message string, err error) {
+	q := r.URL.Query()
+	if v := q.Get("amount"); v != "" {
+		if amount, err = rpc.ParseAmount(v); err != nil {
+			return 0, "", "", err
+		}
+	}
+	return amount, q.Get("label"), q.Get("message"), nil
+}
+
+// HandlePaymentURI builds a payment URI from ?address=&amount=&label=&message=.
+// With ?format=png or ?format=svg it returns the URI's QR code instead.
+func (ws *WalletServer) HandlePaymentURI(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if valid, err := ws.rpc(r).ValidateAddress(address); address == "" || err != nil || !valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PaymentURIResponse{
+			Success: false,
+			Error:   "Invalid address",
+		})
+		return
+	}
+
+	amount, label, message, err := parsePaymentRequest(r)
+	if err != nil || amount < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PaymentURIResponse{
+			Success: false,
+			Error:   "Invalid amount",
+		})
+		return
+	}
+
+	uri := paymentURI(address, amount, label, message)
+
+	switch r.URL.Query().Get("format") {
+	case "png", "svg":
+		writeQR(w, r, uri)
+		return
+	}
+
+	qrQuery := r.URL.Query()
+	qrQuery.Set("format", "svg")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PaymentURIResponse{
+		Success: true,
+		URI:     uri,
+		QRURL:   r.URL.Path + "?" + qrQuery.Encode(),
+	})
+}
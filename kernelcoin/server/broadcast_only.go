@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxRawTxSize caps raw transactions sent to /api/broadcast
+const maxRawTxSize = 1 << 20
+
+// keyHandlingPaths are the API paths that need private keys on the server:
+// the node wallet's, or ones sent in by the client. Entries ending in /
+// cover everything under them. Broadcast-only mode refuses them.
+var keyHandlingPaths = []string{
+	"/api/send",
+	"/api/send-max",
+	"/api/bumpfee",
+	"/api/cpfp",
+	"/api/psbt/process",
+	"/api/import",
+	"/api/import-mnemonic",
+	"/api/export-key",
+	"/api/new-wallet",
+	"/api/local/send",
+	"/api/sweep",
+	"/api/session/",
+	"/api/scheduler/",
+	"/api/dev/faucet",
+}
+
+// handlesKeys reports whether path is one of keyHandlingPaths
+func handlesKeys(path string) bool {
+	for _, p := range keyHandlingPaths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// withBroadcastOnlyGuard answers key-handling endpoints with 403 in
+// broadcast-only mode, whatever the method
+func withBroadcastOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !handlesKeys(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logRequest(r, "[API] WARNING: refused %s %s in broadcast-only mode", r.Method, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Disabled in broadcast-only mode: keys are kept offline",
+		})
+	})
+}
+
+// checkWatchOnlyWallet warns when the node wallet of a broadcast-only
+// server can sign after all
+func (ws *WalletServer) checkWatchOnlyWallet() {
+	info, err := ws.rpcClient.GetWalletInfo()
+	if err != nil {
+		log.Printf("[INIT] WARNING: Could not check that the node wallet is watch-only: %v", err)
+		return
+	}
+	if enabled, ok := info["private_keys_enabled"].(bool); ok && enabled {
+		log.Printf("[INIT] WARNING: Broadcast-only mode, but node wallet %v holds private keys; use a wallet created with disable_private_keys", info["walletname"])
+	}
+}
+
+type BroadcastRequest struct {
+	Hex string `json:"hex"`
+}
+
+type BroadcastResponse struct {
+	Success bool   `json:"success"`
+	Txid    string `json:"txid,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HandleBroadcast sends a transaction signed elsewhere, given as JSON
+// {"hex": ...} or a raw hex body, to the network
+func (ws *WalletServer) HandleBroadcast(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, 2*maxRawTxSize+1))
+	if err == nil && len(data) > 2*maxRawTxSize {
+		err = fmt.Errorf("Transaction is too large (limit is 1 MiB)")
+	}
+	if err == nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req BroadcastRequest
+		if err = json.Unmarshal(data, &req); err != nil {
+			err = fmt.Errorf("Invalid request format")
+		}
+		data = []byte(req.Hex)
+	}
+	rawHex := strings.TrimSpace(string(data))
+	if err == nil {
+		if _, decodeErr := hex.DecodeString(rawHex); decodeErr != nil || rawHex == "" {
+			err = fmt.Errorf("Transaction must be hex encoded")
+		}
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BroadcastResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	txid, err := ws.rpc(r).SendRawTransaction(rawHex)
+	if err != nil {
+		logRequest(r, "[API] Broadcast ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BroadcastResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to broadcast transaction: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] Broadcast SUCCESS: txid=%s", txid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BroadcastResponse{
+		Success: true,
+		Txid:    txid,
+	})
+}
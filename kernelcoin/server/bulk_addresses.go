@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+const (
+	// maxBulkAddresses bounds one bulk request
+	maxBulkAddresses = 1000
+	// maxBulkLabelLength bounds the label pattern
+	maxBulkLabelLength = 100
+)
+
+// bulkLabelCounter is the run of # in a label pattern replaced by the
+// zero-padded address number
+var bulkLabelCounter = regexp.MustCompile(`#+`)
+
+type BulkAddressRequest struct {
+	Count int `json:"count"`
+	// Label is the pattern of each address's label: a run of # is replaced
+	// by the address number padded to its length, so invoice-#### gives
+	// invoice-0001, invoice-0002, ... Without # every address gets Label.
+	Label       string `json:"label"`
+	Start       int    `json:"start"` // the first number, 1 by default
+	AddressType string `json:"address_type,omitempty"`
+}
+
+// BulkAddress is one minted address
+type BulkAddress struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+}
+
+type BulkAddressResponse struct {
+	Success   bool          `json:"success"`
+	Addresses []BulkAddress `json:"addresses,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// bulkLabels expands req's label pattern into Count labels
+func (req BulkAddressRequest) bulkLabels() ([]string, error) {
+	if req.Count < 1 || req.Count > maxBulkAddresses {
+		return nil, fmt.Errorf("count must be between 1 and %d", maxBulkAddresses)
+	}
+	if len(req.Label) > maxBulkLabelLength {
+		return nil, fmt.Errorf("label may be at most %d characters", maxBulkLabelLength)
+	}
+	runs := bulkLabelCounter.FindAllStringIndex(req.Label, -1)
+	if len(runs) > 1 {
+		return nil, fmt.Errorf("label may have only one run of # for the number")
+	}
+	if req.Start < 0 {
+		return nil, fmt.Errorf("start must not be negative")
+	}
+
+	labels := make([]string, req.Count)
+	for i := range labels {
+		labels[i] = req.Label
+		if len(runs) == 1 {
+			width := runs[0][1] - runs[0][0]
+			labels[i] = req.Label[:runs[0][0]] + fmt.Sprintf("%0*d", width, req.Start+i) + req.Label[runs[0][1]:]
+		}
+	}
+	return labels, nil
+}
+
+// HandleBulkAddresses mints Count new node wallet addresses with labels
+// from a pattern, for pre-allocating deposit addresses. ?format=csv or txt
+// downloads the list instead of returning JSON.
+func (ws *WalletServer) HandleBulkAddresses(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" && format != "txt" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BulkAddressResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Unknown format %q (use json, csv or txt)", format),
+		})
+		return
+	}
+
+	req := BulkAddressRequest{Start: 1}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = fmt.Errorf("Invalid request format")
+	}
+	var labels []string
+	if err == nil {
+		labels, err = req.bulkLabels()
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BulkAddressResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rpc := ws.rpc(r)
+	addresses := make([]BulkAddress, 0, len(labels))
+	for _, label := range labels {
+		addr, err := rpc.GetNewAddress(label, req.AddressType)
+		if err != nil {
+			// The ones already made are in the wallet; hand them back
+			logRequest(r, "[API] BulkAddresses ERROR after %d addresses: %v", len(addresses), err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(BulkAddressResponse{
+				Success:   false,
+				Addresses: addresses,
+				Error:     fmt.Sprintf("Failed to generate address %d of %d: %v", len(addresses)+1, len(labels), err),
+			})
+			return
+		}
+		addresses = append(addresses, BulkAddress{Label: label, Address: addr})
+	}
+	logRequest(r, "[API] BulkAddresses SUCCESS: %d addresses, labels %q..%q", len(addresses), labels[0], labels[len(labels)-1])
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="kernelcoin-addresses.csv"`)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"label", "address"})
+		for _, a := range addresses {
+			cw.Write([]string{a.Label, a.Address})
+		}
+		cw.Flush()
+	case "txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="kernelcoin-addresses.txt"`)
+		for _, a := range addresses {
+			fmt.Fprintln(w, a.Address)
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BulkAddressResponse{
+			Success:   true,
+			Addresses: addresses,
+		})
+	}
+}
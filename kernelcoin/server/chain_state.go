@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// chainState holds the last getblockchaininfo and getnetworkinfo results,
+// refreshed by RunChainStatePoller so page views don't each cost two RPCs
+type chainState struct {
+	mu         sync.RWMutex
+	blockchain map[string]interface{}
+	network    map[string]interface{}
+	fetchedAt  time.Time
+}
+
+func newChainState() *chainState {
+	return &chainState{}
+}
+
+func (s *chainState) set(blockchain, network map[string]interface{}) {
+	s.mu.Lock()
+	s.blockchain = blockchain
+	s.network = network
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *chainState) get() (blockchain, network map[string]interface{}, fetchedAt time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blockchain, s.network, s.fetchedAt
+}
+
+// refreshChainState fetches both infos; the cache only changes when both
+// succeed, so the two always describe the same moment
+func (ws *WalletServer) refreshChainState() error {
+	blockchain, err := ws.rpcClient.GetBlockchainInfo()
+	if err != nil {
+		return err
+	}
+	network, err := ws.rpcClient.GetNetworkInfo()
+	if err != nil {
+		return err
+	}
+
+	bm, ok := blockchain.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected getblockchaininfo response type: %T", blockchain)
+	}
+	nm, ok := network.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected getnetworkinfo response type: %T", network)
+	}
+	ws.chain.set(bm, nm)
+	return nil
+}
+
+// RunChainStatePoller refreshes the cached node info at once and then every
+// interval. Failures keep the last good info, which ages visibly through its
+// fetched_at. When the node answers again after failing, or is on another
+// chain, the node check runs again.
+func (ws *WalletServer) RunChainStatePoller(interval time.Duration) {
+	down := false
+	poll := func() {
+		if err := ws.refreshChainState(); err != nil {
+			log.Printf("[POLLER] WARNING: chain state refresh failed: %v", err)
+			down = true
+			return
+		}
+		info, _, _ := ws.chain.get()
+		if chain := rpc.GetString(info, "chain"); down || (chain != ws.node.Chain() && ws.node.Chain() != "") {
+			go ws.nodeReconnected()
+		}
+		down = false
+	}
+
+	poll()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		poll()
+	}
+}
+
+// blockchainInfo returns the cached getblockchaininfo and when it was
+// fetched, asking the node directly until the poller has run
+func (ws *WalletServer) blockchainInfo() (map[string]interface{}, time.Time, error) {
+	if info, _, at := ws.chain.get(); info != nil {
+		return info, at, nil
+	}
+	if err := ws.refreshChainState(); err != nil {
+		return nil, time.Time{}, err
+	}
+	info, _, at := ws.chain.get()
+	return info, at, nil
+}
+
+// networkInfo is blockchainInfo for getnetworkinfo
+func (ws *WalletServer) networkInfo() (map[string]interface{}, time.Time, error) {
+	if _, info, at := ws.chain.get(); info != nil {
+		return info, at, nil
+	}
+	if err := ws.refreshChainState(); err != nil {
+		return nil, time.Time{}, err
+	}
+	_, info, at := ws.chain.get()
+	return info, at, nil
+}
+
+// withFetchedAt copies a cached info map and adds its fetched_at (unix
+// seconds), leaving the cached map untouched. The block times in it
+// (time, mediantime) get RFC 3339 copies beside them, as does fetched_at.
+func withFetchedAt(info map[string]interface{}, at time.Time) map[string]interface{} {
+	out := make(map[string]interface{}, len(info)+4)
+	for k, v := range info {
+		out[k] = v
+	}
+	for _, key := range []string{"time", "mediantime"} {
+		if _, ok := info[key]; ok {
+			out[key+"_iso"] = formatTime(rpc.GetInt64(info, key))
+		}
+	}
+	out["fetched_at"] = at.Unix()
+	out["fetched_at_iso"] = formatTime(at.Unix())
+	return out
+}
@@ -0,0 +1,684 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// EventCheckout fires when a checkout is paid, confirmed or expires
+const EventCheckout = "checkout"
+
+// Checkout statuses
+const (
+	CheckoutPending   = "pending"   // waiting for the full amount
+	CheckoutPaid      = "paid"      // the full amount is in the mempool or under-confirmed
+	CheckoutConfirmed = "confirmed" // the full amount has the required confirmations
+	CheckoutExpired   = "expired"   // not paid in time
+)
+
+// Callback delivery statuses
+const (
+	CallbackPending   = "pending"
+	CallbackDelivered = "delivered"
+	CallbackFailed    = "failed" // gave up after maxCallbackAttempts
+)
+
+const (
+	// maxCallbackAttempts is how often a callback is tried before giving up;
+	// with the backoff below that spans about three hours
+	maxCallbackAttempts = 10
+	// callbackRetryBase is the delay after the first failed attempt; it
+	// doubles with each further one up to callbackRetryMax
+	callbackRetryBase = 30 * time.Second
+	callbackRetryMax  = time.Hour
+	// maxOrderIDLength bounds the merchant's order reference
+	maxOrderIDLength = 100
+)
+
+// Checkout is a merchant payment request for a fresh wallet address. Once
+// paid it is followed to Confirmations confirmations, after which the
+// merchant's callback is POSTed until it answers 2xx.
+type Checkout struct {
+	Owner            string     `json:"-"` // whose wallet is paid
+	ID               string     `json:"id"`
+	OrderID          string     `json:"order_id"`
+	Address          string     `json:"address"`
+	Amount           rpc.Amount `json:"amount"`
+	FiatAmount       float64    `json:"fiat_amount,omitempty"` // what Amount was priced from
+	FiatCurrency     string     `json:"fiat_currency,omitempty"`
+	Confirmations    int        `json:"confirmations"`
+	CallbackURL      string     `json:"callback_url,omitempty"`
+	Status           string     `json:"status"`
+	Received         rpc.Amount `json:"received"` // at 0 confirmations
+	CallbackStatus   string     `json:"callback_status,omitempty"`
+	CallbackAttempts int        `json:"callback_attempts,omitempty"`
+	NextCallbackAt   int64      `json:"-"`
+	CreatedAt        int64      `json:"created_at"`
+	ExpiresAt        int64      `json:"expires_at"`
+	PaidAt           int64      `json:"paid_at,omitempty"`
+	ConfirmedAt      int64      `json:"confirmed_at,omitempty"`
+	UpdatedAt        int64      `json:"updated_at"`
+}
+
+// PublicCheckout is what the unauthenticated payment page may see
+type PublicCheckout struct {
+	ID           string     `json:"id"`
+	OrderID      string     `json:"order_id"`
+	Address      string     `json:"address"`
+	Amount       rpc.Amount `json:"amount"`
+	FiatAmount   float64    `json:"fiat_amount,omitempty"`
+	FiatCurrency string     `json:"fiat_currency,omitempty"`
+	Received     rpc.Amount `json:"received"`
+	Status       string     `json:"status"`
+	ExpiresAt    int64      `json:"expires_at"`
+	PaymentURI   string     `json:"payment_uri"`
+}
+
+func (c Checkout) public() PublicCheckout {
+	return PublicCheckout{
+		ID:           c.ID,
+		OrderID:      c.OrderID,
+		Address:      c.Address,
+		Amount:       c.Amount,
+		FiatAmount:   c.FiatAmount,
+		FiatCurrency: c.FiatCurrency,
+		Received:     c.Received,
+		Status:       c.Status,
+		ExpiresAt:    c.ExpiresAt,
+		PaymentURI:   paymentURI(c.Address, c.Amount, "", "Order "+c.OrderID),
+	}
+}
+
+// CheckoutCallback is the body POSTed to a checkout's callback URL
+type CheckoutCallback struct {
+	CheckoutID    string     `json:"checkout_id"`
+	OrderID       string     `json:"order_id"`
+	Status        string     `json:"status"`
+	Address       string     `json:"address"`
+	Amount        rpc.Amount `json:"amount"`
+	Received      rpc.Amount `json:"received"`
+	Confirmations int        `json:"confirmations"`
+	ConfirmedAt   int64      `json:"confirmed_at"`
+}
+
+type CheckoutRequest struct {
+	OrderID       string     `json:"order_id"`
+	Amount        rpc.Amount `json:"amount,omitempty"`      // KCN, or
+	FiatAmount    float64    `json:"fiat_amount,omitempty"` // converted at the current price
+	Currency      string     `json:"currency,omitempty"`    // of fiat_amount; default PRICE_CURRENCY
+	CallbackURL   string     `json:"callback_url,omitempty"`
+	Confirmations *int       `json:"confirmations,omitempty"` // default CHECKOUT_CONFIRMATIONS
+	ExpiresIn     int64      `json:"expires_in,omitempty"`    // seconds; default CHECKOUT_EXPIRY
+}
+
+type CheckoutResponse struct {
+	Success    bool      `json:"success"`
+	Checkout   *Checkout `json:"checkout,omitempty"`
+	PaymentURI string    `json:"payment_uri,omitempty"`
+	PaymentURL string    `json:"payment_url,omitempty"` // hosted payment page
+	Error      string    `json:"error,omitempty"`
+}
+
+type CheckoutListResponse struct {
+	Success   bool       `json:"success"`
+	Checkouts []Checkout `json:"checkouts"`
+	Error     string     `json:"error,omitempty"`
+}
+
+const checkoutColumns = `owner, id, order_id, address, amount, fiat_amount, fiat_currency, confirmations,
+	callback_url, status, received, callback_status, callback_attempts, next_callback_at,
+	created_at, expires_at, paid_at, confirmed_at, updated_at`
+
+func scanCheckout(row interface{ Scan(...interface{}) error }) (Checkout, error) {
+	var c Checkout
+	err := row.Scan(&c.Owner, &c.ID, &c.OrderID, &c.Address, &c.Amount, &c.FiatAmount, &c.FiatCurrency, &c.Confirmations,
+		&c.CallbackURL, &c.Status, &c.Received, &c.CallbackStatus, &c.CallbackAttempts, &c.NextCallbackAt,
+		&c.CreatedAt, &c.ExpiresAt, &c.PaidAt, &c.ConfirmedAt, &c.UpdatedAt)
+	return c, err
+}
+
+// SaveCheckout stores a new checkout
+func (s *Store) SaveCheckout(c Checkout) error {
+	_, err := s.db.Exec(`INSERT INTO checkouts (`+checkoutColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Owner, c.ID, c.OrderID, c.Address, c.Amount, c.FiatAmount, c.FiatCurrency, c.Confirmations,
+		c.CallbackURL, c.Status, c.Received, c.CallbackStatus, c.CallbackAttempts, c.NextCallbackAt,
+		c.CreatedAt, c.ExpiresAt, c.PaidAt, c.ConfirmedAt, c.UpdatedAt)
+	return err
+}
+
+// UpdateCheckout saves a checkout's payment and callback progress
+func (s *Store) UpdateCheckout(c Checkout) error {
+	_, err := s.db.Exec(`UPDATE checkouts SET status = ?, received = ?, callback_status = ?,
+		callback_attempts = ?, next_callback_at = ?, paid_at = ?, confirmed_at = ?, updated_at = ?
+		WHERE id = ?`,
+		c.Status, c.Received, c.CallbackStatus, c.CallbackAttempts, c.NextCallbackAt,
+		c.PaidAt, c.ConfirmedAt, c.UpdatedAt, c.ID)
+	return err
+}
+
+// Checkout returns the checkout with id, or nil if there is none
+func (s *Store) Checkout(id string) (*Checkout, error) {
+	c, err := scanCheckout(s.db.QueryRow(`SELECT `+checkoutColumns+` FROM checkouts WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Checkouts returns owner's newest checkouts, optionally only those with
+// status
+func (s *Store) Checkouts(owner, status string, limit int) ([]Checkout, error) {
+	rows, err := s.db.Query(`SELECT `+checkoutColumns+` FROM checkouts
+		WHERE owner = ? AND (? = '' OR status = ?) ORDER BY created_at DESC LIMIT ?`, owner, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanCheckouts(rows)
+}
+
+// OpenCheckouts returns every owner's checkouts still waiting for a
+// payment, confirmations or callback delivery
+func (s *Store) OpenCheckouts() ([]Checkout, error) {
+	rows, err := s.db.Query(`SELECT `+checkoutColumns+` FROM checkouts
+		WHERE status IN (?, ?) OR callback_status = ? ORDER BY created_at`,
+		CheckoutPending, CheckoutPaid, CallbackPending)
+	if err != nil {
+		return nil, err
+	}
+	return scanCheckouts(rows)
+}
+
+func scanCheckouts(rows *sql.Rows) ([]Checkout, error) {
+	defer rows.Close()
+	checkouts := []Checkout{}
+	for rows.Next() {
+		c, err := scanCheckout(rows)
+		if err != nil {
+			return nil, err
+		}
+		checkouts = append(checkouts, c)
+	}
+	return checkouts, rows.Err()
+}
+
+// signCallback returns the X-Kernelcoin-Signature of a callback body sent
+// at timestamp: an HMAC-SHA256 over "timestamp.body" with the callback
+// secret
+func signCallback(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isPublicPath reports whether path is part of the checkout payment page,
+// which customers open without the wallet's credentials. Checkout IDs are
+// unguessable and the page shows nothing beyond the payment request.
+func isPublicPath(path string) bool {
+	return strings.HasPrefix(path, "/pay/") || strings.HasPrefix(path, "/api/pay/")
+}
+
+// updateCheckoutPayment moves c along pending -> paid -> confirmed, or to
+// expired, as client sees its address paid, and reports whether anything
+// changed
+func (ws *WalletServer) updateCheckoutPayment(client rpc.WalletBackend, c *Checkout, now int64) (bool, error) {
+	received, err := client.GetReceivedByAddress(c.Address, 0)
+	if err != nil {
+		return false, err
+	}
+	confirmed := received
+	if c.Confirmations > 0 && received >= c.Amount {
+		if confirmed, err = client.GetReceivedByAddress(c.Address, c.Confirmations); err != nil {
+			return false, err
+		}
+	}
+
+	before := *c
+	c.Received = received
+	switch {
+	case confirmed >= c.Amount:
+		c.Status = CheckoutConfirmed
+		c.ConfirmedAt = now
+		if c.PaidAt == 0 {
+			c.PaidAt = now
+		}
+		if c.CallbackURL != "" {
+			c.CallbackStatus = CallbackPending
+			c.NextCallbackAt = now
+		}
+	case received >= c.Amount && c.Status == CheckoutPending:
+		c.Status = CheckoutPaid
+		c.PaidAt = now
+	case c.Status == CheckoutPending && now >= c.ExpiresAt:
+		c.Status = CheckoutExpired
+	}
+	return *c != before, nil
+}
+
+// deliverCheckoutCallback POSTs the signed confirmation to the merchant and
+// schedules a retry with backoff if it doesn't answer 2xx
+func (ws *WalletServer) deliverCheckoutCallback(c *Checkout, now int64) {
+	body, err := json.Marshal(CheckoutCallback{
+		CheckoutID:    c.ID,
+		OrderID:       c.OrderID,
+		Status:        c.Status,
+		Address:       c.Address,
+		Amount:        c.Amount,
+		Received:      c.Received,
+		Confirmations: c.Confirmations,
+		ConfirmedAt:   c.ConfirmedAt,
+	})
+	if err != nil {
+		return
+	}
+
+	c.CallbackAttempts++
+	err = func() error {
+		req, err := http.NewRequest(http.MethodPost, c.CallbackURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Kernelcoin-Timestamp", strconv.FormatInt(now, 10))
+		req.Header.Set("X-Kernelcoin-Signature", signCallback(ws.checkout.CallbackSecret, now, body))
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("callback returned %s", resp.Status)
+		}
+		return nil
+	}()
+
+	if err == nil {
+		log.Printf("[CHECKOUT] Callback for order %s delivered", c.OrderID)
+		c.CallbackStatus = CallbackDelivered
+		return
+	}
+	if c.CallbackAttempts >= maxCallbackAttempts {
+		log.Printf("[CHECKOUT] ERROR: callback for order %s failed %d times, giving up: %v", c.OrderID, c.CallbackAttempts, err)
+		c.CallbackStatus = CallbackFailed
+		return
+	}
+	delay := min(callbackRetryBase<<(c.CallbackAttempts-1), callbackRetryMax)
+	log.Printf("[CHECKOUT] WARNING: callback for order %s failed, retrying in %s: %v", c.OrderID, delay, err)
+	c.NextCallbackAt = now + int64(delay/time.Second)
+}
+
+// checkCheckouts follows open checkouts' payments and sends due callbacks
+func (ws *WalletServer) checkCheckouts() {
+	checkouts, err := ws.store.OpenCheckouts()
+	if err != nil {
+		log.Printf("[CHECKOUT] WARNING: loading checkouts failed: %v", err)
+		return
+	}
+
+	for _, c := range checkouts {
+		now := time.Now().Unix()
+		status, callback := c.Status, c.CallbackAttempts
+
+		changed := false
+		if c.Status == CheckoutPending || c.Status == CheckoutPaid {
+			client, _, err := ws.ownerWallet(c.Owner)
+			if err == nil {
+				changed, err = ws.updateCheckoutPayment(client, &c, now)
+			}
+			if err != nil {
+				log.Printf("[CHECKOUT] WARNING: checking order %s failed: %v", c.OrderID, err)
+				continue
+			}
+		}
+		if c.Status != status {
+			log.Printf("[CHECKOUT] Order %s is %s (%s of %s KCN received)", c.OrderID, c.Status, c.Received, c.Amount)
+			ws.events.PublishFor(c.Owner, EventCheckout, c)
+		}
+		if c.CallbackStatus == CallbackPending && now >= c.NextCallbackAt {
+			ws.deliverCheckoutCallback(&c, now)
+		}
+
+		if !changed && c.CallbackAttempts == callback {
+			continue
+		}
+		c.UpdatedAt = now
+		if err := ws.store.UpdateCheckout(c); err != nil {
+			log.Printf("[CHECKOUT] WARNING: saving order %s failed: %v", c.OrderID, err)
+		}
+	}
+}
+
+// RunCheckoutMonitor checks open checkouts every interval. Like the
+// transaction watcher it runs without subscribers, since callbacks need no
+// client.
+func (ws *WalletServer) RunCheckoutMonitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ws.checkCheckouts()
+	}
+}
+
+// HandleCheckouts lists (GET, newest first, ?status= to filter) or creates
+// (POST) the requester's merchant checkouts
+func (ws *WalletServer) HandleCheckouts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		status := r.URL.Query().Get("status")
+		checkouts, err := ws.store.Checkouts(walletOwner(r), status, 100)
+		if err != nil {
+			logRequest(r, "[API] Checkouts ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(CheckoutListResponse{
+				Success: false,
+				Error:   "Failed to load checkouts",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(CheckoutListResponse{Success: true, Checkouts: checkouts})
+		return
+
+	case http.MethodPost:
+	}
+
+	var req CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CheckoutResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	if msg := ws.validateCheckoutRequest(&req); msg != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CheckoutResponse{Success: false, Error: msg})
+		return
+	}
+
+	amount := req.Amount
+	currency := ""
+	if req.FiatAmount > 0 {
+		prices := ws.prices.Load()
+		if prices == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(CheckoutResponse{
+				Success: false,
+				Error:   "fiat_amount needs a price provider (set PRICE_PROVIDER)",
+			})
+			return
+		}
+		quote, err := prices.Quote(req.Currency)
+		if err == nil && quote.Stale {
+			err = fmt.Errorf("no current %s price", quote.Currency)
+		}
+		if err != nil {
+			logRequest(r, "[API] Checkout ERROR: %v", err)
+			status := http.StatusServiceUnavailable
+			if errors.Is(err, errUnknownCurrency) {
+				status = http.StatusBadRequest
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(CheckoutResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Cannot price the checkout: %v", err),
+			})
+			return
+		}
+		// Round up so the merchant is never short
+		amount = rpc.Amount(math.Ceil(req.FiatAmount / quote.Price * 1e8))
+		currency = quote.Currency
+	}
+
+	id, err := newSessionID() // unguessable: the payment page is public
+	var address string
+	if err == nil {
+		address, err = ws.rpc(r).GetNewAddress("checkout "+req.OrderID, "bech32")
+	}
+	if err != nil {
+		logRequest(r, "[API] Checkout ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CheckoutResponse{
+			Success: false,
+			Error:   "Failed to create a payment address",
+		})
+		return
+	}
+
+	expiry := time.Duration(ws.checkout.Expiry)
+	if req.ExpiresIn > 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+	}
+	now := time.Now()
+	checkout := Checkout{
+		Owner:         walletOwner(r),
+		ID:            id,
+		OrderID:       req.OrderID,
+		Address:       address,
+		Amount:        amount,
+		FiatCurrency:  currency,
+		Confirmations: *req.Confirmations,
+		CallbackURL:   req.CallbackURL,
+		Status:        CheckoutPending,
+		CreatedAt:     now.Unix(),
+		ExpiresAt:     now.Add(expiry).Unix(),
+		UpdatedAt:     now.Unix(),
+	}
+	if currency != "" {
+		checkout.FiatAmount = req.FiatAmount
+	}
+	if err := ws.store.SaveCheckout(checkout); err != nil {
+		logRequest(r, "[API] Checkout ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CheckoutResponse{
+			Success: false,
+			Error:   "Failed to save checkout",
+		})
+		return
+	}
+
+	logRequest(r, "[API] Checkout SUCCESS: order %s, %s KCN to %s", checkout.OrderID, checkout.Amount, checkout.Address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CheckoutResponse{
+		Success:    true,
+		Checkout:   &checkout,
+		PaymentURI: checkout.public().PaymentURI,
+		PaymentURL: urlPath("/pay/" + checkout.ID),
+	})
+}
+
+// validateCheckoutRequest checks req and fills in the default
+// confirmations, returning a message for the client if it is invalid
+func (ws *WalletServer) validateCheckoutRequest(req *CheckoutRequest) string {
+	if req.OrderID == "" || len(req.OrderID) > maxOrderIDLength {
+		return fmt.Sprintf("order_id is required and may be at most %d characters", maxOrderIDLength)
+	}
+	if (req.Amount > 0) == (req.FiatAmount > 0) || req.Amount < 0 || req.FiatAmount < 0 {
+		return "Give exactly one of a positive amount or fiat_amount"
+	}
+	if req.CallbackURL != "" {
+		u, err := url.Parse(req.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "callback_url must be an http or https URL"
+		}
+		if ws.checkout.CallbackSecret == "" {
+			return "Callbacks need a signing secret (set CHECKOUT_CALLBACK_SECRET)"
+		}
+	}
+	if req.Confirmations == nil {
+		confirmations := ws.checkout.Confirmations
+		req.Confirmations = &confirmations
+	}
+	if *req.Confirmations < 0 || *req.Confirmations > 100 {
+		return "confirmations must be between 0 and 100"
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > int64(maxPaymentWatchTTL/time.Second) {
+		return "expires_in must be at most 30 days"
+	}
+	return ""
+}
+
+// HandleCheckout returns one checkout with its callback progress
+func (ws *WalletServer) HandleCheckout(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	checkout, err := ws.store.Checkout(id)
+	if err != nil || checkout == nil || checkout.Owner != walletOwner(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(CheckoutResponse{
+			Success: false,
+			Error:   "Checkout not found",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CheckoutResponse{
+		Success:    true,
+		Checkout:   checkout,
+		PaymentURI: checkout.public().PaymentURI,
+		PaymentURL: urlPath("/pay/" + checkout.ID),
+	})
+}
+
+// HandlePayStatus serves /api/pay/{id}, the payment page's view of a
+// checkout. It needs no credentials.
+func (ws *WalletServer) HandlePayStatus(w http.ResponseWriter, r *http.Request) {
+	checkout, err := ws.store.Checkout(pathParam(r, "id"))
+	if err != nil || checkout == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Checkout not found"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(checkout.public())
+}
+
+var payPage = template.Must(template.New("pay").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Order {{.OrderID}}</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f5f7; color: #222; margin: 0; }
+main { max-width: 420px; margin: 40px auto; background: #fff; border-radius: 8px; padding: 24px; text-align: center; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+.amount { font-size: 1.6em; font-weight: 600; margin: 8px 0; }
+.fiat { color: #666; }
+.qr svg { width: 240px; height: 240px; }
+.address { font-family: monospace; word-break: break-all; background: #f4f5f7; padding: 8px; border-radius: 4px; }
+.status { margin-top: 16px; font-weight: 600; }
+.status.confirmed { color: #1a7f37; }
+.status.expired { color: #b42318; }
+a.button { display: inline-block; margin-top: 12px; padding: 10px 18px; background: #2f6fed; color: #fff; border-radius: 4px; text-decoration: none; }
+</style>
+</head>
+<body>
+<main>
+<div>Order {{.OrderID}}</div>
+<div class="amount">{{.Amount}} KCN</div>
+{{if .FiatCurrency}}<div class="fiat">{{printf "%.2f" .FiatAmount}} {{.FiatCurrency}}</div>{{end}}
+<div class="qr">{{.QR}}</div>
+<div class="address">{{.Address}}</div>
+<a class="button" href="{{.PaymentURI}}">Open in wallet</a>
+<div id="status" class="status {{.Status}}">{{.StatusText}}</div>
+</main>
+<script>
+(function () {
+  var statusURL = {{.StatusURL}};
+  var texts = {{.Texts}};
+  var el = document.getElementById('status');
+  function poll() {
+    fetch(statusURL, {cache: 'no-store'}).then(function (r) { return r.json(); }).then(function (c) {
+      el.className = 'status ' + c.status;
+      el.textContent = texts[c.status] || c.status;
+      if (c.status === 'pending' || c.status === 'paid') setTimeout(poll, 5000);
+    }).catch(function () { setTimeout(poll, 15000); });
+  }
+  if ({{.Open}}) setTimeout(poll, 5000);
+})();
+</script>
+</body>
+</html>
+`))
+
+// checkoutStatusTexts are the payment page's words for each status
+var checkoutStatusTexts = map[string]string{
+	CheckoutPending:   "Waiting for payment",
+	CheckoutPaid:      "Payment received, waiting for confirmations",
+	CheckoutConfirmed: "Payment confirmed. Thank you!",
+	CheckoutExpired:   "This payment request has expired",
+}
+
+// HandlePay serves /pay/{id}, the hosted payment page a merchant sends
+// customers to: amount, address and QR code, updating as the payment
+// arrives. It needs no credentials.
+func (ws *WalletServer) HandlePay(w http.ResponseWriter, r *http.Request) {
+	checkout, err := ws.store.Checkout(pathParam(r, "id"))
+	if err != nil || checkout == nil {
+		http.NotFound(w, r)
+		return
+	}
+	public := checkout.public()
+
+	var qr template.HTML
+	if q, err := qrcode.New(public.PaymentURI, qrcode.Medium); err == nil {
+		// qrSVG's output is generated, not user data
+		qr = template.HTML(qrSVG(q.Bitmap()))
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err = payPage.Execute(w, struct {
+		PublicCheckout
+		QR         template.HTML
+		StatusText string
+		StatusURL  string
+		Texts      map[string]string
+		Open       bool
+	}{
+		PublicCheckout: public,
+		QR:             qr,
+		StatusText:     checkoutStatusTexts[public.Status],
+		StatusURL:      urlPath("/api/pay/" + public.ID),
+		Texts:          checkoutStatusTexts,
+		Open:           public.Status == CheckoutPending || public.Status == CheckoutPaid,
+	})
+	if err != nil {
+		logRequest(r, "[API] Pay ERROR: %v", err)
+	}
+}
@@ -0,0 +1,990 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Config is the server configuration. Each setting comes from, in rising
+// priority: the built-in default, the YAML config file (-config or
+// CONFIG_FILE), its environment variable, and its command-line flag.
+type Config struct {
+	RPC           RPCConfig           `yaml:"rpc"`
+	Electrum      ElectrumConfig      `yaml:"electrum"`
+	Server        ServerConfig        `yaml:"server"`
+	TLS           TLSConfig           `yaml:"tls"`
+	Auth          AuthConfig          `yaml:"auth"`
+	OIDC          OIDCConfig          `yaml:"oidc"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	Cache         CacheConfig         `yaml:"cache"`
+	Intervals     IntervalConfig      `yaml:"intervals"`
+	Prices        PriceConfig         `yaml:"prices"`
+	Fees          FeeConfig           `yaml:"fees"`
+	Log           LogConfig           `yaml:"log"`
+	Debug         DebugConfig         `yaml:"debug"`
+	Errors        ErrorsConfig        `yaml:"error_reporting"`
+	Telegram      TelegramConfig      `yaml:"telegram"`
+	Checkout      CheckoutConfig      `yaml:"checkout"`
+	Tor           TorConfig           `yaml:"tor"`
+	KeyExport     KeyExportConfig     `yaml:"key_export"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	MultiUser     MultiUserConfig     `yaml:"multi_user"`
+	StorePath     string              `yaml:"store_path"`
+	// BackupDir is a directory the node and the wallet server share, by the
+	// same absolute path, for wallet backups and restores
+	BackupDir string `yaml:"backup_dir"`
+	// Backend serves signing sessions' addresses: node, or electrum for
+	// users without a local kernelcoind
+	Backend string `yaml:"backend"`
+	// Network is the chain the node must report: main, test or regtest
+	Network string `yaml:"network"`
+	// StartupCheck is what a failed node check at startup does: fail,
+	// degraded (serve read-only) or off
+	StartupCheck string `yaml:"startup_check"`
+	// SensitiveResponseEncryption is off, optional or required
+	SensitiveResponseEncryption string `yaml:"sensitive_response_encryption"`
+	// AmountFormat is string, or number for the old float amounts
+	AmountFormat string `yaml:"amount_format"`
+	// TimeZone is the IANA zone RFC 3339 times in responses are written in,
+	// and dates in filters are read in
+	TimeZone string `yaml:"time_zone"`
+	// MessagesDir holds message catalogs (<language>.json) translating the
+	// API's error and status messages; English is built in
+	MessagesDir string `yaml:"messages_dir"`
+	// BroadcastOnly turns off every endpoint that handles private keys, for
+	// a watch-only node wallet whose keys stay offline
+	BroadcastOnly bool `yaml:"broadcast_only"`
+	// Demo replaces kernelcoind with a simulated node holding a canned
+	// wallet, and keeps the store in memory, for developing and showing
+	// the wallet without a node
+	Demo bool `yaml:"demo"`
+}
+
+// RPCConfig is how to reach kernelcoind
+type RPCConfig struct {
+	URL      string `yaml:"url"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// ElectrumConfig is the ElectrumX or Fulcrum server of the electrum
+// backend, as tcp://host:port or ssl://host:port
+type ElectrumConfig struct {
+	Server        string `yaml:"server"`
+	TLSSkipVerify bool   `yaml:"tls_skip_verify"` // for self-signed ssl:// servers
+}
+
+// ServerConfig is the HTTP listener. Streaming and long-poll endpoints (/ws,
+// /api/events, /api/wait, exports) lift the write timeout for themselves.
+type ServerConfig struct {
+	Listen          string   `yaml:"listen"`
+	ReadTimeout     Duration `yaml:"read_timeout"`
+	WriteTimeout    Duration `yaml:"write_timeout"`
+	IdleTimeout     Duration `yaml:"idle_timeout"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+	// AssetsDir serves the frontend from disk instead of the embedded copy
+	AssetsDir string `yaml:"assets_dir"`
+	// BasePath serves everything under a prefix like /wallet, for reverse
+	// proxies that route by path
+	BasePath string `yaml:"base_path"`
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For names the
+	// real client
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// CORSOrigins are the web origins (https://shop.example.com, or "*")
+	// whose pages may call the API
+	CORSOrigins []string `yaml:"cors_origins"`
+}
+
+// TLSConfig serves HTTPS directly when both files are set
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Enabled reports whether HTTPS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// AuthConfig puts HTTP basic auth in front of the UI and API when both are
+// set
+type AuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Enabled reports whether basic auth is required
+func (c AuthConfig) Enabled() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+// OIDCConfig delegates login to an OpenID Connect provider when an issuer
+// is set. A user gets the admin role if one of their groups, or their
+// verified email, is in AdminGroups, else viewer if it is in ViewerGroups;
+// anyone else is turned away.
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // this wallet's /auth/callback
+	Scopes       []string `yaml:"scopes"`
+	GroupsClaim  string   `yaml:"groups_claim"` // the ID token claim listing the user's groups
+	AdminGroups  []string `yaml:"admin_groups"`
+	ViewerGroups []string `yaml:"viewer_groups"`
+	SessionTTL   Duration `yaml:"session_ttl"`
+}
+
+// Enabled reports whether users log in through the provider
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// RateLimitConfig limits API requests per client address; a rate of 0
+// disables the limit
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// CacheConfig holds the caches' lifetimes and refresh intervals
+type CacheConfig struct {
+	BalanceTTL        Duration `yaml:"balance_ttl"`         // 0 disables
+	TxSyncInterval    Duration `yaml:"tx_sync_interval"`    // 0 disables the transaction cache
+	ChainPollInterval Duration `yaml:"chain_poll_interval"` // blockchain/network info refresh
+}
+
+// IntervalConfig holds the background loops' intervals
+type IntervalConfig struct {
+	FeeSample          Duration `yaml:"fee_sample"`
+	Scheduler          Duration `yaml:"scheduler"`
+	EventPoll          Duration `yaml:"event_poll"`
+	SessionIdleTimeout Duration `yaml:"session_idle_timeout"`
+}
+
+// PriceConfig selects the fiat price sources; no provider disables fiat
+// values
+type PriceConfig struct {
+	Provider  string   `yaml:"provider"`  // one provider, backed by static prices when set
+	Providers []string `yaml:"providers"` // asked in order; overrides provider
+	Selection string   `yaml:"selection"` // first or median
+	Static    string   `yaml:"static"`    // "USD=0.05,EUR=0.046"
+	Currency  string   `yaml:"currency"`
+	CacheTTL  Duration `yaml:"cache_ttl"`
+	// RequestsPerMinute limits the calls to each provider; 0 is unlimited
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	// Sources overrides cache_ttl and requests_per_minute per provider
+	Sources map[string]PriceSourceConfig `yaml:"sources"`
+	APIURL  string                       `yaml:"api_url"`
+	APIKey  string                       `yaml:"api_key"`
+	CoinID  string                       `yaml:"coin_id"`
+}
+
+// PriceSourceConfig is one provider's own cache and rate limit; zero keeps
+// the prices section's
+type PriceSourceConfig struct {
+	CacheTTL          Duration `yaml:"cache_ttl"`
+	RequestsPerMinute float64  `yaml:"requests_per_minute"`
+}
+
+// FeeConfig defines the fee presets a send can name instead of a fee rate
+type FeeConfig struct {
+	Economy  FeePresetConfig `yaml:"economy"`
+	Normal   FeePresetConfig `yaml:"normal"`
+	Priority FeePresetConfig `yaml:"priority"`
+}
+
+// FeePresetConfig is one fee preset: the node's fee estimate for
+// ConfTarget blocks, kept between Floor and Ceiling (kernels per vbyte; a
+// zero Ceiling leaves it unbounded)
+type FeePresetConfig struct {
+	ConfTarget int     `yaml:"conf_target"`
+	Floor      float64 `yaml:"floor"`
+	Ceiling    float64 `yaml:"ceiling"`
+}
+
+// LogConfig is the log output
+type LogConfig struct {
+	Format string `yaml:"format"` // json or text
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	// Access logs one line per HTTP request, except for AccessSkip paths
+	Access     bool     `yaml:"access"`
+	AccessSkip []string `yaml:"access_skip"`
+	// File logs there instead of stderr, rotating once it reaches
+	// MaxSizeMB or is RotateEvery old, and keeping MaxBackups rotated
+	// files no older than MaxAge. Zero turns each limit off.
+	File        string   `yaml:"file"`
+	MaxSizeMB   int      `yaml:"max_size_mb"`
+	RotateEvery Duration `yaml:"rotate_every"`
+	MaxBackups  int      `yaml:"max_backups"`
+	MaxAge      Duration `yaml:"max_age"`
+}
+
+// DebugConfig enables pprof and expvar on a separate admin address
+type DebugConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr"`
+}
+
+// ErrorsConfig sends panics and 5xx errors to a Sentry-compatible
+// collector when a DSN is set
+type ErrorsConfig struct {
+	DSN         string `yaml:"dsn"`
+	Environment string `yaml:"environment"`
+}
+
+// TelegramConfig sends wallet notifications to a Telegram chat and
+// answers its commands when a bot token is set
+type TelegramConfig struct {
+	BotToken string `yaml:"bot_token"`
+	ChatID   string `yaml:"chat_id"` // the only chat the bot talks to
+	APIURL   string `yaml:"api_url"`
+}
+
+// Enabled reports whether the bot runs
+func (c TelegramConfig) Enabled() bool {
+	return c.BotToken != ""
+}
+
+// CheckoutConfig holds the merchant checkout defaults. Callbacks are
+// signed with CallbackSecret and need it set.
+type CheckoutConfig struct {
+	CallbackSecret string   `yaml:"callback_secret"`
+	Confirmations  int      `yaml:"confirmations"`
+	Expiry         Duration `yaml:"expiry"` // how long a checkout waits for payment
+}
+
+// TorConfig publishes the wallet as a v3 onion service through Tor's
+// control port. The onion key is kept in KeyFile so the address survives
+// restarts; delete it to get a new address.
+type TorConfig struct {
+	Onion           bool   `yaml:"onion"`
+	ControlAddr     string `yaml:"control_addr"`
+	ControlPassword string `yaml:"control_password"` // for HashedControlPassword; cookie auth needs none
+	KeyFile         string `yaml:"key_file"`
+	Port            int    `yaml:"port"` // the port on the .onion address
+}
+
+// KeyExportConfig enables /api/export-key, which hands out the node
+// wallet's private keys, behind a TOTP code from an authenticator app
+type KeyExportConfig struct {
+	TOTPSecret string `yaml:"totp_secret"` // base32, as in otpauth:// URIs
+}
+
+// NotificationsConfig fills the notification center from wallet events.
+// While it is enabled the wallet watcher polls the node even with no live
+// client connected.
+type NotificationsConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	LowBalance string   `yaml:"low_balance"` // KCN; notify when the balance drops below it; empty disables
+	Retention  Duration `yaml:"retention"`   // how long notifications are kept
+}
+
+// MultiUserConfig hosts a node wallet per registered user. Users log in
+// with their own password, or through OIDC; the auth user or an OIDC admin
+// registers them under /api/admin/users and works on the default wallet.
+type MultiUserConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	WalletPrefix string `yaml:"wallet_prefix"` // a user's node wallet is named prefix + username
+}
+
+// Duration is a time.Duration written as "5m" in config files
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func defaultConfig() Config {
+	return Config{
+		RPC: RPCConfig{
+			URL:      "http://127.0.0.1:9332",
+			User:     "kernelcoinrpc",
+			Password: "kernelcoinpass",
+		},
+		Server: ServerConfig{
+			Listen:          "127.0.0.1:8080",
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(60 * time.Second),
+			IdleTimeout:     Duration(2 * time.Minute),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		OIDC: OIDCConfig{
+			Scopes:      []string{"openid", "email", "profile"},
+			GroupsClaim: "groups",
+			SessionTTL:  Duration(12 * time.Hour),
+		},
+		RateLimit: RateLimitConfig{Burst: 20},
+		Cache: CacheConfig{
+			BalanceTTL:        Duration(rpc.DefaultBalanceCacheTTL),
+			TxSyncInterval:    Duration(30 * time.Second),
+			ChainPollInterval: Duration(15 * time.Second),
+		},
+		Intervals: IntervalConfig{
+			FeeSample:          Duration(5 * time.Minute),
+			Scheduler:          Duration(time.Minute),
+			EventPoll:          Duration(10 * time.Second),
+			SessionIdleTimeout: Duration(defaultSessionIdleTimeout),
+		},
+		Prices: PriceConfig{
+			Selection:         PriceSelectFirst,
+			Currency:          "USD",
+			CacheTTL:          Duration(5 * time.Minute),
+			RequestsPerMinute: 30,
+			APIURL:            "https://api.coingecko.com/api/v3",
+			CoinID:            "kernelcoin",
+		},
+		Fees: FeeConfig{
+			Economy:  FeePresetConfig{ConfTarget: 24, Floor: 1},
+			Normal:   FeePresetConfig{ConfTarget: 6, Floor: 1},
+			Priority: FeePresetConfig{ConfTarget: 2, Floor: 1},
+		},
+		Log: LogConfig{
+			Format:     "json",
+			Level:      "info",
+			Access:     true,
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		Debug:                       DebugConfig{Addr: defaultDebugAddr},
+		Telegram:                    TelegramConfig{APIURL: "https://api.telegram.org"},
+		Checkout:                    CheckoutConfig{Confirmations: 1, Expiry: Duration(time.Hour)},
+		Tor:                         TorConfig{ControlAddr: "127.0.0.1:9051", KeyFile: "onion.key", Port: 80},
+		Notifications:               NotificationsConfig{Enabled: true, Retention: Duration(30 * 24 * time.Hour)},
+		MultiUser:                   MultiUserConfig{WalletPrefix: "user-"},
+		StorePath:                   "webwallet.db",
+		Backend:                     BackendNode,
+		Network:                     "main",
+		StartupCheck:                StartupCheckFail,
+		SensitiveResponseEncryption: EncryptionOptional,
+		AmountFormat:                "string",
+		TimeZone:                    "UTC",
+	}
+}
+
+// loadConfigFile reads path over cfg. Unknown keys are an error so a typo
+// doesn't silently leave a setting at its default.
+func loadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// envReader applies environment variables over a config, keeping the first
+// malformed value's error
+type envReader struct {
+	err error
+}
+
+func (e *envReader) string(name string, dst *string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+// list reads a comma-separated list
+func (e *envReader) list(name string, dst *[]string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	*dst = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*dst = append(*dst, item)
+		}
+	}
+}
+
+func (e *envReader) duration(name string, dst *Duration) {
+	v := os.Getenv(name)
+	if v == "" || e.err != nil {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.err = fmt.Errorf("invalid %s %q: %w", name, v, err)
+		return
+	}
+	*dst = Duration(d)
+}
+
+func (e *envReader) float(name string, dst *float64) {
+	v := os.Getenv(name)
+	if v == "" || e.err != nil {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.err = fmt.Errorf("invalid %s %q: %w", name, v, err)
+		return
+	}
+	*dst = f
+}
+
+func (e *envReader) int(name string, dst *int) {
+	v := os.Getenv(name)
+	if v == "" || e.err != nil {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.err = fmt.Errorf("invalid %s %q: %w", name, v, err)
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) bool(name string, dst *bool) {
+	v := os.Getenv(name)
+	if v == "" || e.err != nil {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.err = fmt.Errorf("invalid %s %q: %w", name, v, err)
+		return
+	}
+	*dst = b
+}
+
+// applyEnv overrides cfg with the environment variables that are set
+func applyEnv(cfg *Config) error {
+	var e envReader
+	e.string("RPC_URL", &cfg.RPC.URL)
+	e.string("RPC_USER", &cfg.RPC.User)
+	e.string("RPC_PASS", &cfg.RPC.Password)
+
+	e.string("BACKEND", &cfg.Backend)
+	e.string("ELECTRUM_SERVER", &cfg.Electrum.Server)
+	e.bool("ELECTRUM_TLS_SKIP_VERIFY", &cfg.Electrum.TLSSkipVerify)
+
+	e.string("LISTEN_ADDR", &cfg.Server.Listen)
+	e.duration("HTTP_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	e.duration("HTTP_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	e.duration("HTTP_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	e.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	e.string("ASSETS_DIR", &cfg.Server.AssetsDir)
+	e.string("BASE_PATH", &cfg.Server.BasePath)
+	e.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	e.list("CORS_ORIGINS", &cfg.Server.CORSOrigins)
+
+	e.string("TLS_CERT_FILE", &cfg.TLS.CertFile)
+	e.string("TLS_KEY_FILE", &cfg.TLS.KeyFile)
+
+	e.string("AUTH_USERNAME", &cfg.Auth.Username)
+	e.string("AUTH_PASSWORD", &cfg.Auth.Password)
+
+	e.string("OIDC_ISSUER", &cfg.OIDC.Issuer)
+	e.string("OIDC_CLIENT_ID", &cfg.OIDC.ClientID)
+	e.string("OIDC_CLIENT_SECRET", &cfg.OIDC.ClientSecret)
+	e.string("OIDC_REDIRECT_URL", &cfg.OIDC.RedirectURL)
+	e.list("OIDC_SCOPES", &cfg.OIDC.Scopes)
+	e.string("OIDC_GROUPS_CLAIM", &cfg.OIDC.GroupsClaim)
+	e.list("OIDC_ADMIN_GROUPS", &cfg.OIDC.AdminGroups)
+	e.list("OIDC_VIEWER_GROUPS", &cfg.OIDC.ViewerGroups)
+	e.duration("OIDC_SESSION_TTL", &cfg.OIDC.SessionTTL)
+
+	e.float("RATE_LIMIT", &cfg.RateLimit.RequestsPerSecond)
+	e.int("RATE_LIMIT_BURST", &cfg.RateLimit.Burst)
+
+	e.duration("BALANCE_CACHE_TTL", &cfg.Cache.BalanceTTL)
+	e.duration("TX_SYNC_INTERVAL", &cfg.Cache.TxSyncInterval)
+	e.duration("CHAIN_POLL_INTERVAL", &cfg.Cache.ChainPollInterval)
+
+	e.duration("FEE_SAMPLE_INTERVAL", &cfg.Intervals.FeeSample)
+	e.duration("SCHEDULER_INTERVAL", &cfg.Intervals.Scheduler)
+	e.duration("EVENT_POLL_INTERVAL", &cfg.Intervals.EventPoll)
+	e.duration("SESSION_IDLE_TIMEOUT", &cfg.Intervals.SessionIdleTimeout)
+
+	e.string("PRICE_PROVIDER", &cfg.Prices.Provider)
+	e.list("PRICE_PROVIDERS", &cfg.Prices.Providers)
+	e.string("PRICE_SELECTION", &cfg.Prices.Selection)
+	e.float("PRICE_RATE_LIMIT", &cfg.Prices.RequestsPerMinute)
+	e.string("PRICE_STATIC", &cfg.Prices.Static)
+	e.string("PRICE_CURRENCY", &cfg.Prices.Currency)
+	e.duration("PRICE_CACHE_TTL", &cfg.Prices.CacheTTL)
+	e.string("PRICE_API_URL", &cfg.Prices.APIURL)
+	e.string("PRICE_API_KEY", &cfg.Prices.APIKey)
+	e.string("PRICE_COIN_ID", &cfg.Prices.CoinID)
+
+	for _, preset := range []struct {
+		env string
+		dst *FeePresetConfig
+	}{
+		{"ECONOMY", &cfg.Fees.Economy},
+		{"NORMAL", &cfg.Fees.Normal},
+		{"PRIORITY", &cfg.Fees.Priority},
+	} {
+		e.int("FEE_"+preset.env+"_TARGET", &preset.dst.ConfTarget)
+		e.float("FEE_"+preset.env+"_FLOOR", &preset.dst.Floor)
+		e.float("FEE_"+preset.env+"_CEILING", &preset.dst.Ceiling)
+	}
+
+	e.string("LOG_FORMAT", &cfg.Log.Format)
+	e.string("LOG_LEVEL", &cfg.Log.Level)
+	e.bool("ACCESS_LOG", &cfg.Log.Access)
+	e.list("ACCESS_LOG_SKIP", &cfg.Log.AccessSkip)
+	e.string("LOG_FILE", &cfg.Log.File)
+	e.int("LOG_MAX_SIZE_MB", &cfg.Log.MaxSizeMB)
+	e.duration("LOG_ROTATE_EVERY", &cfg.Log.RotateEvery)
+	e.int("LOG_MAX_BACKUPS", &cfg.Log.MaxBackups)
+	e.duration("LOG_MAX_AGE", &cfg.Log.MaxAge)
+
+	e.bool("DEBUG", &cfg.Debug.Enabled)
+	e.string("DEBUG_ADDR", &cfg.Debug.Addr)
+
+	e.string("SENTRY_DSN", &cfg.Errors.DSN)
+	e.string("SENTRY_ENVIRONMENT", &cfg.Errors.Environment)
+
+	e.string("TELEGRAM_BOT_TOKEN", &cfg.Telegram.BotToken)
+	e.string("TELEGRAM_CHAT_ID", &cfg.Telegram.ChatID)
+	e.string("TELEGRAM_API_URL", &cfg.Telegram.APIURL)
+
+	e.string("CHECKOUT_CALLBACK_SECRET", &cfg.Checkout.CallbackSecret)
+	e.int("CHECKOUT_CONFIRMATIONS", &cfg.Checkout.Confirmations)
+	e.duration("CHECKOUT_EXPIRY", &cfg.Checkout.Expiry)
+
+	e.bool("TOR_ONION", &cfg.Tor.Onion)
+	e.string("TOR_CONTROL_ADDR", &cfg.Tor.ControlAddr)
+	e.string("TOR_CONTROL_PASSWORD", &cfg.Tor.ControlPassword)
+	e.string("TOR_KEY_FILE", &cfg.Tor.KeyFile)
+	e.int("TOR_ONION_PORT", &cfg.Tor.Port)
+
+	e.string("KEY_EXPORT_TOTP_SECRET", &cfg.KeyExport.TOTPSecret)
+
+	e.bool("NOTIFICATIONS", &cfg.Notifications.Enabled)
+	e.string("LOW_BALANCE_ALERT", &cfg.Notifications.LowBalance)
+	e.duration("NOTIFICATION_RETENTION", &cfg.Notifications.Retention)
+
+	e.bool("MULTI_USER", &cfg.MultiUser.Enabled)
+	e.string("MULTI_USER_WALLET_PREFIX", &cfg.MultiUser.WalletPrefix)
+
+	e.string("STORE_PATH", &cfg.StorePath)
+	e.string("BACKUP_DIR", &cfg.BackupDir)
+	e.bool("BROADCAST_ONLY", &cfg.BroadcastOnly)
+	e.bool("DEMO", &cfg.Demo)
+	e.string("NETWORK", &cfg.Network)
+	e.string("STARTUP_CHECK", &cfg.StartupCheck)
+	e.string("SENSITIVE_RESPONSE_ENCRYPTION", &cfg.SensitiveResponseEncryption)
+	e.string("AMOUNT_FORMAT", &cfg.AmountFormat)
+	e.string("TIME_ZONE", &cfg.TimeZone)
+	e.string("MESSAGES_DIR", &cfg.MessagesDir)
+	return e.err
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if u, err := url.Parse(c.RPC.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("rpc.url %q must be an http:// or https:// URL", c.RPC.URL)
+	}
+	switch c.Backend {
+	case BackendNode:
+	case BackendElectrum:
+		if _, err := newElectrumClient(c.Electrum); err != nil {
+			fail("electrum.server: %v", err)
+		}
+	default:
+		fail("backend %q must be node or electrum", c.Backend)
+	}
+	if _, _, err := net.SplitHostPort(c.Server.Listen); err != nil {
+		fail("server.listen %q must be host:port", c.Server.Listen)
+	}
+	if c.Server.BasePath != "" && (!strings.HasPrefix(c.Server.BasePath, "/") || strings.ContainsAny(c.Server.BasePath, "?#")) {
+		fail("server.base_path %q must be a path like /wallet", c.Server.BasePath)
+	}
+	if _, err := parseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		fail("server.trusted_proxies: %v", err)
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if !validCORSOrigin(origin) {
+			fail("server.cors_origins %q must be * or an origin like https://shop.example.com", origin)
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"cache.chain_poll_interval", c.Cache.ChainPollInterval},
+		{"intervals.fee_sample", c.Intervals.FeeSample},
+		{"intervals.scheduler", c.Intervals.Scheduler},
+		{"intervals.event_poll", c.Intervals.EventPoll},
+		{"intervals.session_idle_timeout", c.Intervals.SessionIdleTimeout},
+		{"prices.cache_ttl", c.Prices.CacheTTL},
+		{"checkout.expiry", c.Checkout.Expiry},
+	} {
+		if d.value <= 0 {
+			fail("%s must be positive, got %s", d.name, time.Duration(d.value))
+		}
+	}
+	if c.Cache.BalanceTTL < 0 {
+		fail("cache.balance_ttl must not be negative")
+	}
+	if c.Cache.TxSyncInterval < 0 {
+		fail("cache.tx_sync_interval must not be negative")
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		fail("tls.cert_file and tls.key_file must be set together")
+	}
+	if (c.Auth.Username == "") != (c.Auth.Password == "") {
+		fail("auth.username and auth.password must be set together")
+	}
+	if c.OIDC.Enabled() {
+		if u, err := url.Parse(c.OIDC.Issuer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("oidc.issuer %q must be an http:// or https:// URL", c.OIDC.Issuer)
+		}
+		if u, err := url.Parse(c.OIDC.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("oidc.redirect_url %q must be the wallet's http:// or https:// /auth/callback URL", c.OIDC.RedirectURL)
+		}
+		if c.OIDC.ClientID == "" {
+			fail("oidc.client_id must be set")
+		}
+		if c.OIDC.GroupsClaim == "" {
+			fail("oidc.groups_claim must be set")
+		}
+		if len(c.OIDC.AdminGroups) == 0 && len(c.OIDC.ViewerGroups) == 0 {
+			fail("oidc needs admin_groups or viewer_groups, or no one can log in")
+		}
+		if c.OIDC.SessionTTL <= 0 {
+			fail("oidc.session_ttl must be positive")
+		}
+		if c.Auth.Enabled() {
+			fail("auth and oidc cannot both be set")
+		}
+	}
+	if c.RateLimit.RequestsPerSecond < 0 {
+		fail("rate_limit.requests_per_second must not be negative")
+	}
+	if c.RateLimit.RequestsPerSecond > 0 && c.RateLimit.Burst < 1 {
+		fail("rate_limit.burst must be at least 1")
+	}
+
+	seen := map[string]bool{}
+	for _, name := range c.Prices.providerNames() {
+		if _, ok := priceProviderFactory(name); !ok {
+			fail("price provider %q must be one of %s", name, strings.Join(priceProviderNames(), ", "))
+		}
+		if seen[name] {
+			fail("price provider %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	if seen["static"] && c.Prices.Static == "" {
+		fail("price provider static needs prices.static")
+	}
+	if c.Prices.Selection != PriceSelectFirst && c.Prices.Selection != PriceSelectMedian {
+		fail("prices.selection %q must be first or median", c.Prices.Selection)
+	}
+	if c.Prices.RequestsPerMinute < 0 {
+		fail("prices.requests_per_minute must not be negative")
+	}
+	for name, source := range c.Prices.Sources {
+		if !seen[name] {
+			fail("prices.sources.%s is not a configured price provider", name)
+		}
+		if source.CacheTTL < 0 || source.RequestsPerMinute < 0 {
+			fail("prices.sources.%s must not be negative", name)
+		}
+	}
+	if c.Prices.Static != "" {
+		if _, err := parseStaticPrices(c.Prices.Static); err != nil {
+			fail("prices.static: %v", err)
+		}
+	}
+
+	for _, preset := range []struct {
+		name   string
+		preset FeePresetConfig
+	}{
+		{"economy", c.Fees.Economy},
+		{"normal", c.Fees.Normal},
+		{"priority", c.Fees.Priority},
+	} {
+		if preset.preset.ConfTarget < 1 || preset.preset.ConfTarget > maxConfTarget {
+			fail("fees.%s.conf_target must be between 1 and %d", preset.name, maxConfTarget)
+		}
+		if preset.preset.Floor < 0 || preset.preset.Ceiling < 0 {
+			fail("fees.%s.floor and ceiling must not be negative", preset.name)
+		}
+		if preset.preset.Ceiling > 0 && preset.preset.Ceiling < preset.preset.Floor {
+			fail("fees.%s.ceiling must not be below its floor", preset.name)
+		}
+	}
+
+	switch c.Log.Format {
+	case "json", "text":
+	default:
+		fail("log.format %q must be json or text", c.Log.Format)
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("log.level %q must be debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.MaxSizeMB < 0 || c.Log.MaxBackups < 0 || c.Log.RotateEvery < 0 || c.Log.MaxAge < 0 {
+		fail("log.max_size_mb, log.rotate_every, log.max_backups and log.max_age must not be negative")
+	}
+
+	if c.Debug.Enabled {
+		if _, _, err := net.SplitHostPort(c.Debug.Addr); err != nil {
+			fail("debug.addr %q must be host:port", c.Debug.Addr)
+		}
+	}
+	if c.Errors.DSN != "" {
+		if u, err := url.Parse(c.Errors.DSN); err != nil || u.User == nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("error_reporting.dsn must look like https://KEY@host/PROJECT_ID")
+		}
+	}
+	if c.Telegram.Enabled() {
+		if _, err := newTelegramBot(c.Telegram); err != nil {
+			fail("telegram.chat_id must be the numeric id of the chat to notify")
+		}
+		if c.Backend != BackendNode {
+			fail("telegram needs the node backend")
+		}
+	}
+	if c.Checkout.Confirmations < 0 || c.Checkout.Confirmations > 100 {
+		fail("checkout.confirmations must be between 0 and 100")
+	}
+	if c.Tor.Onion {
+		if _, _, err := net.SplitHostPort(c.Tor.ControlAddr); err != nil {
+			fail("tor.control_addr %q must be host:port", c.Tor.ControlAddr)
+		}
+		if c.Tor.KeyFile == "" {
+			fail("tor.key_file must be set")
+		}
+		if c.Tor.Port < 1 || c.Tor.Port > 65535 {
+			fail("tor.port must be between 1 and 65535")
+		}
+		if !c.Auth.Enabled() && !c.OIDC.Enabled() {
+			fail("tor.onion needs auth or oidc: anyone who learns the .onion address could use the wallet")
+		}
+	}
+	if c.KeyExport.TOTPSecret != "" {
+		if _, err := decodeTOTPSecret(c.KeyExport.TOTPSecret); err != nil {
+			fail("key_export.totp_secret: %v", err)
+		}
+		if !c.Auth.Enabled() && !c.OIDC.Enabled() {
+			fail("key_export needs auth or oidc: anyone reaching the wallet could try codes")
+		}
+		if c.Backend != BackendNode {
+			fail("key_export needs the node backend")
+		}
+	}
+	if c.Notifications.LowBalance != "" {
+		if amount, err := rpc.ParseAmount(c.Notifications.LowBalance); err != nil || amount <= 0 {
+			fail("notifications.low_balance %q must be a positive KCN amount", c.Notifications.LowBalance)
+		}
+	}
+	if c.Notifications.Retention <= 0 {
+		fail("notifications.retention must be positive")
+	}
+	if c.StorePath == "" {
+		fail("store_path must be set")
+	}
+	if c.BroadcastOnly && c.Backend != BackendNode {
+		fail("broadcast_only needs the node backend: the electrum backend only serves keys opened in sessions")
+	}
+	if c.MultiUser.Enabled {
+		if c.Backend != BackendNode {
+			fail("multi_user needs the node backend, which holds the users' wallets")
+		}
+		if !c.Auth.Enabled() && !c.OIDC.Enabled() {
+			fail("multi_user needs auth or oidc: the auth user, or an OIDC admin, manages the users")
+		}
+		if c.BroadcastOnly {
+			fail("multi_user and broadcast_only cannot both be set")
+		}
+		if strings.ContainsAny(c.MultiUser.WalletPrefix, `/\`) {
+			fail("multi_user.wallet_prefix %q must not contain slashes", c.MultiUser.WalletPrefix)
+		}
+	}
+	if c.Demo {
+		if c.Backend != BackendNode {
+			fail("demo needs the node backend: the simulated node stands in for kernelcoind")
+		}
+		if c.MultiUser.Enabled {
+			fail("demo and multi_user cannot both be set: the simulated node has a single wallet")
+		}
+	}
+	if c.BackupDir != "" && !filepath.IsAbs(c.BackupDir) {
+		fail("backup_dir %q must be an absolute path, the same for the node", c.BackupDir)
+	}
+	switch c.Network {
+	case "main", "test", "regtest":
+	default:
+		fail("network %q must be main, test or regtest", c.Network)
+	}
+	switch c.StartupCheck {
+	case StartupCheckFail, StartupCheckDegraded, StartupCheckOff:
+	default:
+		fail("startup_check %q must be fail, degraded or off", c.StartupCheck)
+	}
+	switch c.SensitiveResponseEncryption {
+	case EncryptionOff, EncryptionOptional, EncryptionRequired:
+	default:
+		fail("sensitive_response_encryption %q must be off, optional or required", c.SensitiveResponseEncryption)
+	}
+	switch c.AmountFormat {
+	case "string", "number":
+	default:
+		fail("amount_format %q must be string or number", c.AmountFormat)
+	}
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		fail("time_zone %q is not a known time zone, such as UTC or Europe/Berlin", c.TimeZone)
+	}
+	return errors.Join(errs...)
+}
+
+// redacted returns a copy of c safe to print
+func (c Config) redacted() Config {
+	if c.RPC.Password != "" {
+		c.RPC.Password = "REDACTED"
+	}
+	if c.Auth.Password != "" {
+		c.Auth.Password = "REDACTED"
+	}
+	if c.OIDC.ClientSecret != "" {
+		c.OIDC.ClientSecret = "REDACTED"
+	}
+	if c.Prices.APIKey != "" {
+		c.Prices.APIKey = "REDACTED"
+	}
+	if c.Errors.DSN != "" {
+		c.Errors.DSN = "REDACTED"
+	}
+	if c.Telegram.BotToken != "" {
+		c.Telegram.BotToken = "REDACTED"
+	}
+	if c.Checkout.CallbackSecret != "" {
+		c.Checkout.CallbackSecret = "REDACTED"
+	}
+	if c.Tor.ControlPassword != "" {
+		c.Tor.ControlPassword = "REDACTED"
+	}
+	if c.KeyExport.TOTPSecret != "" {
+		c.KeyExport.TOTPSecret = "REDACTED"
+	}
+	return c
+}
+
+// printConfig writes c as YAML, with passwords redacted
+func printConfig(w io.Writer, c Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// loadConfig builds the configuration from defaults, the config file, the
+// environment and args, and validates it. printOnly is set by -print-config.
+func loadConfig(args []string) (cfg Config, printOnly bool, err error) {
+	fs := flag.NewFlagSet("kernelcoin-wallet", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	fs.BoolVar(&printOnly, "print-config", false, "print the effective configuration and exit")
+	demo := fs.Bool("demo", false, "run against a simulated node with a canned wallet, storing nothing")
+
+	// String settings that can be given as flags, applied only when passed
+	overrides := map[string]*string{}
+	for _, f := range []struct{ name, usage string }{
+		{"rpc-url", "kernelcoind RPC URL"},
+		{"rpc-user", "kernelcoind RPC user"},
+		{"backend", "session address backend: node or electrum"},
+		{"electrum-server", "Electrum server, tcp://host:port or ssl://host:port"},
+		{"listen", "HTTP listen address"},
+		{"tls-cert", "TLS certificate file"},
+		{"tls-key", "TLS key file"},
+		{"store", "local store path"},
+		{"assets-dir", "serve the frontend from this directory (development)"},
+		{"base-path", "URL prefix to serve under, e.g. /wallet"},
+		{"log-format", "log format: json or text"},
+		{"log-level", "log level: debug, info, warn or error"},
+		{"log-file", "log to this file instead of stderr"},
+	} {
+		overrides[f.name] = fs.String(f.name, "", f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+
+	cfg = defaultConfig()
+	if *configPath != "" {
+		if err := loadConfigFile(*configPath, &cfg); err != nil {
+			return cfg, false, err
+		}
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, false, err
+	}
+
+	targets := map[string]*string{
+		"rpc-url":         &cfg.RPC.URL,
+		"rpc-user":        &cfg.RPC.User,
+		"backend":         &cfg.Backend,
+		"electrum-server": &cfg.Electrum.Server,
+		"listen":          &cfg.Server.Listen,
+		"tls-cert":        &cfg.TLS.CertFile,
+		"tls-key":         &cfg.TLS.KeyFile,
+		"store":           &cfg.StorePath,
+		"assets-dir":      &cfg.Server.AssetsDir,
+		"base-path":       &cfg.Server.BasePath,
+		"log-format":      &cfg.Log.Format,
+		"log-level":       &cfg.Log.Level,
+		"log-file":        &cfg.Log.File,
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if dst, ok := targets[f.Name]; ok {
+			*dst = *overrides[f.Name]
+		}
+	})
+	if *demo {
+		cfg.Demo = true
+	}
+
+	// "/wallet/" and "/wallet" mean the same; "/" is no prefix at all
+	cfg.Server.BasePath = strings.TrimRight(cfg.Server.BasePath, "/")
+	return cfg, printOnly, cfg.Validate()
+}
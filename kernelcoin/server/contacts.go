@@ -0,0 +1,373 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxContactName bounds contact names so they fit in transaction listings
+const maxContactName = 100
+
+// Contact is an address book entry: a name for one or more addresses
+type Contact struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+	Notes     string   `json:"notes,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+type ContactRequest struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+	Notes     string   `json:"notes,omitempty"`
+}
+
+type ContactResponse struct {
+	Success bool     `json:"success"`
+	Contact *Contact `json:"contact,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type ContactsListResponse struct {
+	Success  bool      `json:"success"`
+	Contacts []Contact `json:"contacts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// errAddressTaken is returned when saving an address that already belongs to
+// another contact
+var errAddressTaken = errors.New("address already belongs to another contact")
+
+// Contacts returns every contact of owner ordered by name
+func (s *Store) Contacts(owner string) ([]Contact, error) {
+	rows, err := s.db.Query(`SELECT id, name, notes, created_at, updated_at FROM contacts
+		WHERE owner = ? ORDER BY name COLLATE NOCASE`, owner)
+	if err != nil {
+		return nil, err
+	}
+	contacts := []Contact{}
+	for rows.Next() {
+		var c Contact
+		if err := rows.Scan(&c.ID, &c.Name, &c.Notes, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		contacts = append(contacts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.contactAddresses(owner)
+	if err != nil {
+		return nil, err
+	}
+	for i := range contacts {
+		contacts[i].Addresses = addresses[contacts[i].ID]
+	}
+	return contacts, nil
+}
+
+// Contact returns a single contact of owner, or nil if it does not exist
+func (s *Store) Contact(owner, id string) (*Contact, error) {
+	var c Contact
+	err := s.db.QueryRow(`SELECT id, name, notes, created_at, updated_at FROM contacts WHERE id = ? AND owner = ?`, id, owner).
+		Scan(&c.ID, &c.Name, &c.Notes, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.contactAddresses(owner)
+	if err != nil {
+		return nil, err
+	}
+	c.Addresses = addresses[c.ID]
+	return &c, nil
+}
+
+// contactAddresses maps the IDs of owner's contacts to their addresses
+func (s *Store) contactAddresses(owner string) (map[string][]string, error) {
+	rows, err := s.db.Query(`SELECT contact_id, address FROM contact_addresses WHERE owner = ? ORDER BY address`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := map[string][]string{}
+	for rows.Next() {
+		var id, address string
+		if err := rows.Scan(&id, &address); err != nil {
+			return nil, err
+		}
+		addresses[id] = append(addresses[id], address)
+	}
+	return addresses, rows.Err()
+}
+
+// ContactNames maps every address in owner's address book to its
+// contact's name
+func (s *Store) ContactNames(owner string) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT a.address, c.name FROM contact_addresses a JOIN contacts c ON c.id = a.contact_id
+		WHERE a.owner = ?`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[string]string{}
+	for rows.Next() {
+		var address, name string
+		if err := rows.Scan(&address, &name); err != nil {
+			return nil, err
+		}
+		names[address] = name
+	}
+	return names, rows.Err()
+}
+
+// SaveContact inserts or replaces a contact of owner and its addresses
+func (s *Store) SaveContact(owner string, c Contact) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO contacts (id, owner, name, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, notes = excluded.notes, updated_at = excluded.updated_at`,
+		c.ID, owner, c.Name, c.Notes, c.CreatedAt, c.UpdatedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM contact_addresses WHERE contact_id = ?`, c.ID); err != nil {
+		return err
+	}
+	for _, address := range c.Addresses {
+		var holder string
+		err := tx.QueryRow(`SELECT contact_id FROM contact_addresses WHERE owner = ? AND address = ?`, owner, address).Scan(&holder)
+		if err == nil {
+			return errAddressTaken
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO contact_addresses (owner, address, contact_id) VALUES (?, ?, ?)`, owner, address, c.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteContact removes a contact of owner; it returns false if there was
+// none
+func (s *Store) DeleteContact(owner, id string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM contact_addresses WHERE contact_id = ? AND owner = ?`, id, owner); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`DELETE FROM contacts WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, tx.Commit()
+}
+
+// validateContact normalizes req and checks every address with the node
+func (ws *WalletServer) validateContact(req *ContactRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Notes = strings.TrimSpace(req.Notes)
+	if req.Name == "" || len(req.Name) > maxContactName {
+		return fmt.Sprintf("Name is required and may be at most %d characters", maxContactName)
+	}
+	if len(req.Addresses) == 0 {
+		return "At least one address is required"
+	}
+
+	seen := map[string]bool{}
+	addresses := []string{}
+	for _, address := range req.Addresses {
+		address = strings.TrimSpace(address)
+		if seen[address] {
+			continue
+		}
+		if valid, err := ws.rpcClient.ValidateAddress(address); err != nil || !valid {
+			return fmt.Sprintf("Invalid address %q", address)
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	req.Addresses = addresses
+	return ""
+}
+
+// resolveContacts fills in the contact name for transactions of owner's
+// wallet whose address is in owner's address book
+func (ws *WalletServer) resolveContacts(owner string, transactions []TransactionResponse) {
+	names, err := ws.store.ContactNames(owner)
+	if err != nil {
+		log.Printf("[API] WARNING: Could not load contact names: %v", err)
+		return
+	}
+	for i := range transactions {
+		transactions[i].Contact = names[transactions[i].Address]
+	}
+}
+
+// HandleContacts lists (GET) or creates (POST) contacts in the requester's
+// address book
+func (ws *WalletServer) HandleContacts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		contacts, err := ws.store.Contacts(walletOwner(r))
+		if err != nil {
+			logRequest(r, "[API] Contacts ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ContactsListResponse{
+				Success: false,
+				Error:   "Failed to load contacts",
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ContactsListResponse{
+			Success:  true,
+			Contacts: contacts,
+		})
+
+	case http.MethodPost:
+		id, err := newRecordID()
+		if err != nil {
+			logRequest(r, "[API] CreateContact ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ContactResponse{
+				Success: false,
+				Error:   "Failed to save contact",
+			})
+			return
+		}
+		now := time.Now().Unix()
+		ws.saveContact(w, r, Contact{ID: id, CreatedAt: now})
+	}
+}
+
+// HandleContact handles /api/contacts/{id}: GET, PUT (replace) and DELETE
+func (ws *WalletServer) HandleContact(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	contact, err := ws.store.Contact(walletOwner(r), id)
+	if err != nil || contact == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ContactResponse{
+			Success: false,
+			Error:   "Contact not found",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ContactResponse{
+			Success: true,
+			Contact: contact,
+		})
+
+	case http.MethodPut:
+		ws.saveContact(w, r, *contact)
+
+	case http.MethodDelete:
+		if _, err := ws.store.DeleteContact(walletOwner(r), id); err != nil {
+			logRequest(r, "[API] DeleteContact ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ContactResponse{
+				Success: false,
+				Error:   "Failed to delete contact",
+			})
+			return
+		}
+
+		logRequest(r, "[API] DeleteContact SUCCESS: %s", id)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ContactResponse{Success: true})
+	}
+}
+
+// saveContact validates the request body and stores it over contact
+func (ws *WalletServer) saveContact(w http.ResponseWriter, r *http.Request, contact Contact) {
+	var req ContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ContactResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	if validationErr := ws.validateContact(&req); validationErr != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ContactResponse{
+			Success: false,
+			Error:   validationErr,
+		})
+		return
+	}
+
+	contact.Name = req.Name
+	contact.Addresses = req.Addresses
+	contact.Notes = req.Notes
+	contact.UpdatedAt = time.Now().Unix()
+
+	if err := ws.store.SaveContact(walletOwner(r), contact); err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to save contact"
+		if err == errAddressTaken {
+			status = http.StatusConflict
+			message = "One of the addresses already belongs to another contact"
+		} else {
+			logRequest(r, "[API] SaveContact ERROR: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(ContactResponse{
+			Success: false,
+			Error:   message,
+		})
+		return
+	}
+
+	logRequest(r, "[API] SaveContact SUCCESS: %s (%d addresses)", contact.ID, len(contact.Addresses))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ContactResponse{
+		Success: true,
+		Contact: &contact,
+	})
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// defaultCPFPConfTarget is used to pick a package fee rate when none is given
+const defaultCPFPConfTarget = 2
+
+type CPFPRequest struct {
+	Txid       string  `json:"txid"`
+	FeeRate    float64 `json:"fee_rate,omitempty"` // target package rate, sat/vB
+	ConfTarget int     `json:"conf_target,omitempty"`
+}
+
+type CPFPResponse struct {
+	Success        bool       `json:"success"`
+	Txid           string     `json:"txid,omitempty"`
+	ParentTxid     string     `json:"parent_txid,omitempty"`
+	ParentFeeRate  float64    `json:"parent_fee_rate,omitempty"`
+	ChildFee       rpc.Amount `json:"child_fee,omitempty"`
+	ChildVSize     int64      `json:"child_vsize,omitempty"`
+	PackageFeeRate float64    `json:"package_fee_rate,omitempty"`
+	Error          string     `json:"error,omitempty"`
+}
+
+// cpfpChildFee returns the fee (kernels) a child of childVSize vbytes must pay
+// so that it and its unconfirmed ancestors together reach targetRate sat/vB.
+// The child never pays less than 1 sat/vB for itself.
+func cpfpChildFee(ancestorSize int64, ancestorFees rpc.Amount, childVSize int64, targetRate float64) rpc.Amount {
+	needed := rpc.Amount(math.Ceil(targetRate*float64(ancestorSize+childVSize))) - ancestorFees
+	if needed < rpc.Amount(childVSize) {
+		needed = rpc.Amount(childVSize)
+	}
+	return needed
+}
+
+// HandleCPFP spends the wallet's outputs of a stuck unconfirmed transaction
+// back to the wallet, paying enough fee that miners will want to confirm
+// both (child pays for parent)
+func (ws *WalletServer) HandleCPFP(w http.ResponseWriter, r *http.Request) {
+	var req CPFPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Txid) != 64 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success: false,
+			Error:   "Invalid request format: txid is required",
+		})
+		return
+	}
+
+	parent, err := ws.rpc(r).GetMempoolEntry(req.Txid)
+	if err != nil {
+		logRequest(r, "[API] CPFP ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success: false,
+			Error:   "Transaction is not in the mempool (it may already be confirmed)",
+		})
+		return
+	}
+	parentRate := float64(parent.AncestorFees) / float64(parent.AncestorSize)
+
+	targetRate := req.FeeRate
+	if targetRate <= 0 {
+		confTarget := req.ConfTarget
+		if confTarget <= 0 {
+			confTarget = defaultCPFPConfTarget
+		}
+		estimate, err := ws.rpc(r).EstimateSmartFee(confTarget)
+		if err != nil || estimate <= 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(CPFPResponse{
+				Success: false,
+				Error:   "No fee estimate available; specify fee_rate",
+			})
+			return
+		}
+		// KCN/kvB to kernels/vB
+		targetRate = estimate * rpc.KernelsPerKCN / 1000
+	}
+
+	if parentRate >= targetRate {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success:       false,
+			ParentTxid:    req.Txid,
+			ParentFeeRate: parentRate,
+			Error:         fmt.Sprintf("Transaction already pays %.2f sat/vB, at least the target of %.2f", parentRate, targetRate),
+		})
+		return
+	}
+
+	// Spend every wallet output of the parent
+	utxos, err := ws.rpc(r).ListUnspent(0)
+	if err != nil {
+		logRequest(r, "[API] CPFP ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success: false,
+			Error:   "Failed to list unspent outputs",
+		})
+		return
+	}
+
+	inputs := []rpc.Outpoint{}
+	var inputTotal rpc.Amount
+	childVSize := int64(hdwallet.TxOverheadVSize)
+	for _, utxo := range utxos {
+		if utxo.Txid != req.Txid || !utxo.Spendable {
+			continue
+		}
+		script, _ := hex.DecodeString(utxo.ScriptPubKey)
+		size, err := hdwallet.InputVSize(script)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(CPFPResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Cannot spend output %d: %v", utxo.Vout, err),
+			})
+			return
+		}
+		inputs = append(inputs, rpc.Outpoint{Txid: utxo.Txid, Vout: utxo.Vout})
+		inputTotal += utxo.Amount
+		childVSize += size
+	}
+
+	if len(inputs) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success: false,
+			Error:   "The wallet has no spendable outputs in this transaction",
+		})
+		return
+	}
+
+	// Pay everything back to a fresh wallet address, less the fee
+	changeAddr, err := ws.rpc(r).GetNewAddress("", "bech32")
+	var changeScript []byte
+	if err == nil {
+		var addr btcutil.Address
+		if addr, err = hdwallet.DecodeAddress(changeAddr); err == nil {
+			changeScript, err = txscript.PayToAddrScript(addr)
+		}
+	}
+	if err != nil {
+		logRequest(r, "[API] CPFP ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success: false,
+			Error:   "Failed to get a wallet address for the child transaction",
+		})
+		return
+	}
+	childVSize += hdwallet.OutputVSize(changeScript)
+
+	childFee := cpfpChildFee(parent.AncestorSize, parent.AncestorFees, childVSize, targetRate)
+	if inputTotal-childFee < hdwallet.DustThreshold {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success:       false,
+			ParentTxid:    req.Txid,
+			ParentFeeRate: parentRate,
+			ChildFee:      childFee,
+			Error:         fmt.Sprintf("The wallet's outputs (%s KCN) are too small to pay the %s KCN fee needed", inputTotal, childFee),
+		})
+		return
+	}
+
+	txid, err := ws.sendChildTransaction(ws.rpc(r), inputs, changeAddr, inputTotal-childFee)
+	if err != nil {
+		logRequest(r, "[API] CPFP ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CPFPResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	packageRate := float64(parent.AncestorFees+childFee) / float64(parent.AncestorSize+childVSize)
+	logRequest(r, "[API] CPFP SUCCESS: child %s pays %s KCN, package rate %.2f sat/vB", txid, childFee, packageRate)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CPFPResponse{
+		Success:        true,
+		Txid:           txid,
+		ParentTxid:     req.Txid,
+		ParentFeeRate:  parentRate,
+		ChildFee:       childFee,
+		ChildVSize:     childVSize,
+		PackageFeeRate: packageRate,
+	})
+}
+
+// sendChildTransaction spends inputs to a single wallet output of amount
+func (ws *WalletServer) sendChildTransaction(client rpc.WalletBackend, inputs []rpc.Outpoint, address string, amount rpc.Amount) (string, error) {
+	raw, err := client.CreateRawTransaction(inputs, []map[string]interface{}{
+		{address: amount.Number()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create child transaction: %w", err)
+	}
+
+	signed, complete, err := client.SignRawTransactionWithWallet(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign child transaction: %w", err)
+	}
+	if !complete {
+		return "", fmt.Errorf("wallet could not sign the child transaction")
+	}
+
+	txid, err := client.SendRawTransaction(signed)
+	if err != nil {
+		return "", fmt.Errorf("failed to broadcast child transaction: %w", err)
+	}
+	return txid, nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const defaultDashboardTransactions = 10
+
+// ChainSummary is the part of getblockchaininfo the UI shows
+type ChainSummary struct {
+	Chain                string  `json:"chain"`
+	Blocks               int64   `json:"blocks"`
+	Headers              int64   `json:"headers"`
+	BestBlockHash        string  `json:"bestblockhash"`
+	VerificationProgress float64 `json:"verificationprogress"`
+	InitialBlockDownload bool    `json:"initialblockdownload"`
+	FetchedAt            int64   `json:"fetched_at"`
+}
+
+// NetworkSummary is the part of getnetworkinfo the UI shows
+type NetworkSummary struct {
+	Version       int    `json:"version"`
+	Subversion    string `json:"subversion"`
+	Connections   int    `json:"connections"`
+	NetworkActive bool   `json:"networkactive"`
+	FetchedAt     int64  `json:"fetched_at"`
+}
+
+// DashboardResponse bundles everything the UI needs on load
+type DashboardResponse struct {
+	Success      bool                  `json:"success"`
+	Balance      *BalanceResponse      `json:"balance,omitempty"`
+	Transactions []TransactionResponse `json:"transactions,omitempty"`
+	Pagination   *Pagination           `json:"pagination,omitempty"`
+	Blockchain   *ChainSummary         `json:"blockchain,omitempty"`
+	Network      *NetworkSummary       `json:"network,omitempty"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// HandleDashboard returns the balance, the newest ?count= transactions
+// (default 10), and chain and network status in one response. The lookups
+// run concurrently; any failure fails the whole request.
+func (ws *WalletServer) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	page := PageParams{Count: defaultDashboardTransactions, Page: 1}
+	if c, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && c > 0 {
+		page.Count = min(c, maxPageSize)
+	}
+	quote := ws.fiatQuote(r)
+
+	var response DashboardResponse
+	var g errgroup.Group
+
+	g.Go(func() error {
+		info, err := ws.rpc(r).GetBalanceInfo("")
+		if err != nil {
+			return fmt.Errorf("balance: %w", err)
+		}
+		balance := balanceResponse(info)
+		balance.FiatValue = quote.Value(balance.Total)
+		response.Balance = &balance
+		return nil
+	})
+
+	g.Go(func() error {
+		var transactions []TransactionResponse
+		var total int
+		var hasMore bool
+		var err error
+		if ws.txSync.Ready() {
+			transactions, total, err = ws.filteredTransactions(ws.rpc(r), TransactionFilter{}, page)
+			hasMore = len(transactions) < total
+		} else {
+			transactions, total, hasMore, err = ws.transactionPage(ws.rpc(r), page)
+		}
+		if err != nil {
+			return fmt.Errorf("transactions: %w", err)
+		}
+		setDirections(transactions)
+		owner := walletOwner(r)
+		ws.setStatuses(owner, transactions)
+		ws.resolveContacts(owner, transactions)
+		addFiatValues(transactions, quote)
+		response.Transactions = transactions
+		response.Pagination = &Pagination{Count: page.Count, Page: 1, Total: total, HasMore: hasMore}
+		return nil
+	})
+
+	// Node info comes from the chain-state cache, which holds both
+	g.Go(func() error {
+		m, fetchedAt, err := ws.blockchainInfo()
+		if err != nil {
+			return fmt.Errorf("blockchain info: %w", err)
+		}
+		n, _, err := ws.networkInfo()
+		if err != nil {
+			return fmt.Errorf("network info: %w", err)
+		}
+
+		response.Blockchain = &ChainSummary{
+			Chain:                rpc.GetString(m, "chain"),
+			Blocks:               rpc.GetInt64(m, "blocks"),
+			Headers:              rpc.GetInt64(m, "headers"),
+			BestBlockHash:        rpc.GetString(m, "bestblockhash"),
+			VerificationProgress: rpc.GetFloat64(m, "verificationprogress"),
+			FetchedAt:            fetchedAt.Unix(),
+		}
+		response.Blockchain.InitialBlockDownload, _ = m["initialblockdownload"].(bool)
+
+		response.Network = &NetworkSummary{
+			Version:     rpc.GetInt(n, "version"),
+			Subversion:  rpc.GetString(n, "subversion"),
+			Connections: rpc.GetInt(n, "connections"),
+			FetchedAt:   fetchedAt.Unix(),
+		}
+		response.Network.NetworkActive, _ = n["networkactive"].(bool)
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		logRequest(r, "[API] Dashboard ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(DashboardResponse{
+			Success: false,
+			Error:   "Failed to load dashboard",
+		})
+		return
+	}
+
+	response.Success = true
+	logRequest(r, "[API] Dashboard SUCCESS: %d transactions, height %d", len(response.Transactions), response.Blockchain.Blocks)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+const defaultDebugAddr = "127.0.0.1:6060"
+
+// debugStats is published under /debug/vars as "walletserver"
+func (ws *WalletServer) debugStats() interface{} {
+	_, _, chainFetched := ws.chain.get()
+	stats := map[string]interface{}{
+		"goroutines":        runtime.NumGoroutine(),
+		"event_subscribers": ws.events.Subscribers(),
+		"payment_watches":   len(ws.paymentWatches.All()),
+		"wallet_changes":    ws.rpcClient.WalletChanges(),
+		"tx_cache_ready":    ws.txSync.Ready(),
+	}
+	if ws.txSync.Ready() {
+		stats["tx_cache_height"] = ws.txSync.tip.Load()
+	}
+	if !chainFetched.IsZero() {
+		stats["chain_state_age_seconds"] = time.Since(chainFetched).Seconds()
+	}
+	return stats
+}
+
+// RunDebugServer serves pprof under /debug/pprof/ and expvar under
+// /debug/vars on addr. It is only started with DEBUG=true and should be bound
+// to a loopback or otherwise private address: profiles expose internals and
+// the endpoints have no authentication.
+func (ws *WalletServer) RunDebugServer(addr string) {
+	expvar.Publish("walletserver", expvar.Func(ws.debugStats))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("[DEBUG] WARNING: debug endpoints enabled on %s (pprof, expvar)", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("[DEBUG] ERROR: debug server stopped: %v", err)
+	}
+}
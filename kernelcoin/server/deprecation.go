@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RouteDeprecation describes an API route that is being phased out
+type RouteDeprecation struct {
+	Path        string    `json:"path"`
+	Replacement string    `json:"replacement,omitempty"`
+	Deprecated  time.Time `json:"deprecated"`
+	Sunset      time.Time `json:"sunset"`
+	Note        string    `json:"note,omitempty"`
+}
+
+// DeprecationWarning is added to JSON responses from deprecated routes
+type DeprecationWarning struct {
+	Message     string `json:"message"`
+	Replacement string `json:"replacement,omitempty"`
+	Sunset      string `json:"sunset"`
+}
+
+type DeprecationsResponse struct {
+	Success      bool               `json:"success"`
+	Deprecations []RouteDeprecation `json:"deprecations"`
+}
+
+// deprecatedRoutes is the registry of routes scheduled for removal. Entries
+// stay here after their sunset so callers get a 410 pointing at the
+// replacement rather than the index page.
+var deprecatedRoutes = []RouteDeprecation{
+	{
+		Path:        "/api/getnewaddress",
+		Replacement: "/api/generate-address",
+		Deprecated:  time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC),
+		Sunset:      time.Date(2027, time.April, 15, 0, 0, 0, 0, time.UTC),
+		Note:        "Duplicate of /api/generate-address; send {\"type\": ...} instead of {\"address_type\": ...}",
+	},
+}
+
+// lookupDeprecation returns the registry entry for path, if any
+func lookupDeprecation(path string) (RouteDeprecation, bool) {
+	for _, d := range deprecatedRoutes {
+		if d.Path == path {
+			return d, true
+		}
+	}
+	return RouteDeprecation{}, false
+}
+
+// warning builds the structured warning for the entry
+func (d RouteDeprecation) warning() DeprecationWarning {
+	msg := fmt.Sprintf("%s is deprecated and will be removed on %s", d.Path, d.Sunset.Format("2006-01-02"))
+	if d.Replacement != "" {
+		msg += fmt.Sprintf("; use %s instead", d.Replacement)
+	}
+	return DeprecationWarning{
+		Message:     msg,
+		Replacement: d.Replacement,
+		Sunset:      d.Sunset.Format(time.RFC3339),
+	}
+}
+
+// setHeaders writes the Deprecation (RFC 9745), Sunset (RFC 8594) and
+// successor Link headers
+func (d RouteDeprecation) setHeaders(h http.Header) {
+	h.Set("Deprecation", "@"+strconv.FormatInt(d.Deprecated.Unix(), 10))
+	h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	if d.Replacement != "" {
+		h.Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", urlPath(d.Replacement)))
+	}
+}
+
+// bufferedResponse captures a handler's response so a warning can be merged
+// into the JSON body before it is sent
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// deprecatedRoute wraps the handler for a registered deprecated path. Before
+// the sunset it adds deprecation headers and a "deprecation" field to JSON
+// object responses; afterwards it answers 410 Gone.
+func deprecatedRoute(path string, next http.HandlerFunc) http.HandlerFunc {
+	d, ok := lookupDeprecation(path)
+	if !ok {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logRequest(r, "[API] Deprecated route %s called by %s (%s)", d.Path, r.RemoteAddr, r.UserAgent())
+		d.setHeaders(w.Header())
+
+		if time.Now().After(d.Sunset) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":     false,
+				"error":       fmt.Sprintf("%s was removed on %s", d.Path, d.Sunset.Format("2006-01-02")),
+				"deprecation": d.warning(),
+			})
+			return
+		}
+
+		buf := &bufferedResponse{header: w.Header()}
+		next(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+
+		body := buf.body.Bytes()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(body, &fields); err == nil {
+				warning, _ := json.Marshal(d.warning())
+				fields["deprecation"] = warning
+				if merged, err := json.Marshal(fields); err == nil {
+					body = append(merged, '\n')
+				}
+			}
+		}
+
+		w.Header().Del("Content-Length")
+		w.WriteHeader(buf.status)
+		w.Write(body)
+	}
+}
+
+// HandleDeprecations lists deprecated routes and their sunset dates
+func (ws *WalletServer) HandleDeprecations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DeprecationsResponse{
+		Success:      true,
+		Deprecations: deprecatedRoutes,
+	})
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// maxDevMineBlocks caps a single /api/dev/mine call
+const maxDevMineBlocks = 1000
+
+type DevMineRequest struct {
+	Blocks  int    `json:"blocks"`
+	Address string `json:"address,omitempty"`
+}
+
+type DevMineResponse struct {
+	Success bool     `json:"success"`
+	Address string   `json:"address,omitempty"`
+	Blocks  []string `json:"blocks,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+type DevFaucetRequest struct {
+	Address string     `json:"address"`
+	Amount  rpc.Amount `json:"amount"`
+}
+
+type DevFaucetResponse struct {
+	Success bool   `json:"success"`
+	Txid    string `json:"txid,omitempty"`
+	Block   string `json:"block,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type DevResetResponse struct {
+	Success     bool   `json:"success"`
+	Invalidated string `json:"invalidated,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// requireRegtest rejects developer requests unless the node runs regtest.
+// Returns false if a response has already been written.
+func (ws *WalletServer) requireRegtest(w http.ResponseWriter, r *http.Request) bool {
+	chain, err := ws.rpc(r).GetChainName()
+	if err != nil {
+		logRequest(r, "[DEV] ERROR: Could not determine chain: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get blockchain info"})
+		return false
+	}
+
+	if chain != "regtest" {
+		logRequest(r, "[DEV] Rejected %s: node is on %s, not regtest", r.URL.Path, chain)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Developer endpoints are only available in regtest"})
+		return false
+	}
+	return true
+}
+
+// HandleDevMine mines blocks to the wallet (or a given address) in regtest
+func (ws *WalletServer) HandleDevMine(w http.ResponseWriter, r *http.Request) {
+	if !ws.requireRegtest(w, r) {
+		return
+	}
+
+	var req DevMineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Blocks <= 0 || req.Blocks > maxDevMineBlocks {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DevMineResponse{
+			Success: false,
+			Error:   fmt.Sprintf("blocks must be between 1 and %d", maxDevMineBlocks),
+		})
+		return
+	}
+
+	address := req.Address
+	if address == "" {
+		addr, err := ws.rpc(r).GetNewAddress("", "bech32")
+		if err != nil {
+			logRequest(r, "[DEV] Mine ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(DevMineResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to get mining address: %v", err),
+			})
+			return
+		}
+		address = addr
+	}
+
+	hashes, err := ws.rpc(r).GenerateToAddress(req.Blocks, address)
+	if err != nil {
+		logRequest(r, "[DEV] Mine ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DevMineResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to mine blocks: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[DEV] Mine SUCCESS: %d blocks to %s", len(hashes), address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DevMineResponse{
+		Success: true,
+		Address: address,
+		Blocks:  hashes,
+	})
+}
+
+// HandleDevFaucet pays an address from the node wallet and mines a block to
+// confirm it, so test clients can be funded in one call
+func (ws *WalletServer) HandleDevFaucet(w http.ResponseWriter, r *http.Request) {
+	if !ws.requireRegtest(w, r) {
+		return
+	}
+
+	var req DevFaucetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" || req.Amount <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DevFaucetResponse{
+			Success: false,
+			Error:   "address and a positive amount are required",
+		})
+		return
+	}
+
+	txid, err := ws.rpc(r).SendToAddress(req.Address, req.Amount)
+	if err != nil {
+		logRequest(r, "[DEV] Faucet ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(DevFaucetResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to send: %v (mine at least 101 blocks to fund the wallet first)", err),
+		})
+		return
+	}
+
+	// Confirm the payment straight away
+	minerAddr, err := ws.rpc(r).GetNewAddress("", "bech32")
+	var hashes []string
+	if err == nil {
+		hashes, err = ws.rpc(r).GenerateToAddress(1, minerAddr)
+	}
+	if err != nil {
+		logRequest(r, "[DEV] Faucet WARNING: sent %s but failed to mine confirmation block: %v", txid, err)
+	}
+
+	response := DevFaucetResponse{
+		Success: true,
+		Txid:    txid,
+	}
+	if len(hashes) > 0 {
+		response.Block = hashes[0]
+	}
+
+	logRequest(r, "[DEV] Faucet SUCCESS: %s KCN to %s (txid=%s)", req.Amount, req.Address, txid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleDevReset rewinds the regtest chain to genesis and clears the local
+// store, returning the demo to a clean state
+func (ws *WalletServer) HandleDevReset(w http.ResponseWriter, r *http.Request) {
+	if !ws.requireRegtest(w, r) {
+		return
+	}
+
+	// Invalidating block 1 disconnects every block above genesis
+	hash, err := ws.rpc(r).GetBlockHash(1)
+	if err == nil {
+		err = ws.rpc(r).InvalidateBlock(hash)
+	} else {
+		// Nothing mined yet: the chain is already at genesis
+		hash, err = "", nil
+	}
+	if err != nil {
+		logRequest(r, "[DEV] Reset ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(DevResetResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to rewind chain: %v", err),
+		})
+		return
+	}
+
+	if err := ws.store.Reset(); err != nil {
+		logRequest(r, "[DEV] Reset ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(DevResetResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to clear local store: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[DEV] Reset SUCCESS")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DevResetResponse{
+		Success:     true,
+		Invalidated: hash,
+	})
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// electrumTimeout bounds connecting and each request
+	electrumTimeout = 30 * time.Second
+	// electrumProtocolVersion is the protocol version asked for in the
+	// handshake; 1.4 is the oldest with the scripthash methods we use
+	electrumProtocolVersion = "1.4"
+)
+
+// electrumClient talks the Electrum protocol, newline-delimited JSON-RPC,
+// to an ElectrumX or Fulcrum server. It keeps one connection, opened on
+// first use and reopened after a failure, and sends one request at a time.
+type electrumClient struct {
+	addr      string
+	tlsConfig *tls.Config // nil for tcp://
+
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	nextID   int
+	software string // server software from the handshake
+}
+
+// newElectrumClient parses a server like "ssl://electrum.example.com:50002"
+// or "tcp://127.0.0.1:50001"; nothing is dialed yet
+func newElectrumClient(c ElectrumConfig) (*electrumClient, error) {
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid electrum server %q: %w", c.Server, err)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return nil, fmt.Errorf("electrum server %q needs a host:port", c.Server)
+	}
+
+	client := &electrumClient{addr: u.Host}
+	switch u.Scheme {
+	case "tcp":
+	case "ssl":
+		// Public Electrum servers commonly use self-signed certificates
+		client.tlsConfig = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: c.TLSSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		}
+	default:
+		return nil, fmt.Errorf("electrum server %q must start with tcp:// or ssl://", c.Server)
+	}
+	return client, nil
+}
+
+type electrumRequest struct {
+	ID     int           `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type electrumResponse struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// electrumError is an error returned by the server, as opposed to a
+// connection failure
+type electrumError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *electrumError) Error() string {
+	return fmt.Sprintf("electrum server error %d: %s", e.Code, e.Message)
+}
+
+// call sends method and decodes its result into result, which may be nil.
+// A request that fails on a reused connection, which the server may have
+// closed while idle, is retried once on a new one.
+func (c *electrumClient) call(result interface{}, method string, params ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reused := c.conn != nil
+	raw, err := c.request(method, params)
+	if err != nil && reused && c.conn == nil {
+		raw, err = c.request(method, params)
+	}
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("unexpected %s response: %w", method, err)
+	}
+	return nil
+}
+
+// request does one round trip, connecting first if needed. Connection
+// errors close the connection. The caller holds c.mu.
+func (c *electrumClient) request(method string, params []interface{}) (json.RawMessage, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	c.nextID++
+	id := c.nextID
+	line, err := json.Marshal(electrumRequest{ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+
+	c.conn.SetDeadline(time.Now().Add(electrumTimeout))
+	if _, err := c.conn.Write(append(line, '\n')); err != nil {
+		c.close()
+		return nil, fmt.Errorf("electrum %s: %w", method, err)
+	}
+
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("electrum %s: %w", method, err)
+		}
+		var resp electrumResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			c.close()
+			return nil, fmt.Errorf("electrum %s: malformed response: %w", method, err)
+		}
+		// Skip subscription notifications, which carry no id
+		if resp.ID == nil || *resp.ID != id {
+			continue
+		}
+		if len(resp.Error) > 0 && string(resp.Error) != "null" {
+			var serverErr electrumError
+			if err := json.Unmarshal(resp.Error, &serverErr); err != nil {
+				serverErr.Message = string(resp.Error)
+			}
+			return nil, &serverErr
+		}
+		return resp.Result, nil
+	}
+}
+
+// connect dials the server and negotiates the protocol version. The caller
+// holds c.mu.
+func (c *electrumClient) connect() error {
+	dialer := &net.Dialer{Timeout: electrumTimeout}
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, c.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot reach electrum server %s: %w", c.addr, err)
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	raw, err := c.request("server.version", []interface{}{"kernelcoin-webwallet", electrumProtocolVersion})
+	if err != nil {
+		c.close()
+		return fmt.Errorf("electrum handshake with %s failed: %w", c.addr, err)
+	}
+	var version []string
+	if err := json.Unmarshal(raw, &version); err != nil || len(version) != 2 {
+		c.close()
+		return fmt.Errorf("electrum handshake with %s: unexpected server.version response %s", c.addr, raw)
+	}
+	if c.software != version[0] {
+		log.Printf("[ELECTRUM] Connected to %s: %s, protocol %s", c.addr, version[0], version[1])
+	}
+	c.software = version[0]
+	return nil
+}
+
+// close drops the connection; the next request reconnects. The caller
+// holds c.mu.
+func (c *electrumClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.reader = nil
+	}
+}
+
+// Ping checks the server answers and returns its software version
+func (c *electrumClient) Ping() (string, error) {
+	if err := c.call(nil, "server.ping"); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.software, nil
+}
+
+// electrumScript returns an address's scriptPubKey and the Electrum
+// scripthash indexing it: its SHA-256, byte-reversed, in hex
+func electrumScript(address string) ([]byte, string, error) {
+	addr, err := hdwallet.DecodeAddress(address)
+	if err != nil {
+		return nil, "", err
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(script)
+	for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+		sum[i], sum[j] = sum[j], sum[i]
+	}
+	return script, hex.EncodeToString(sum[:]), nil
+}
+
+func (c *electrumClient) UTXOs(addresses []string) ([]hdwallet.LocalUTXO, error) {
+	utxos := []hdwallet.LocalUTXO{}
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+		script, scripthash, err := electrumScript(address)
+		if err != nil {
+			return nil, err
+		}
+
+		var unspent []struct {
+			TxHash string `json:"tx_hash"`
+			TxPos  uint32 `json:"tx_pos"`
+			Height int64  `json:"height"`
+			Value  int64  `json:"value"`
+		}
+		if err := c.call(&unspent, "blockchain.scripthash.listunspent", scripthash); err != nil {
+			return nil, err
+		}
+		for _, u := range unspent {
+			// Confirmed only, like scantxoutset on the node
+			if u.Height <= 0 {
+				continue
+			}
+			hash, err := chainhash.NewHashFromStr(u.TxHash)
+			if err != nil {
+				return nil, fmt.Errorf("bad txid %q from electrum server: %w", u.TxHash, err)
+			}
+			utxos = append(utxos, hdwallet.LocalUTXO{
+				OutPoint: *wire.NewOutPoint(hash, u.TxPos),
+				Value:    u.Value,
+				PkScript: script,
+			})
+		}
+	}
+	return utxos, nil
+}
+
+func (c *electrumClient) Balance(addresses []string) (AddressBalance, error) {
+	var total AddressBalance
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+		_, scripthash, err := electrumScript(address)
+		if err != nil {
+			return AddressBalance{}, err
+		}
+
+		var balance struct {
+			Confirmed   int64 `json:"confirmed"`
+			Unconfirmed int64 `json:"unconfirmed"`
+		}
+		if err := c.call(&balance, "blockchain.scripthash.get_balance", scripthash); err != nil {
+			return AddressBalance{}, err
+		}
+		total.Confirmed += rpc.Amount(balance.Confirmed)
+		total.Unconfirmed += rpc.Amount(balance.Unconfirmed)
+	}
+	return total, nil
+}
+
+func (c *electrumClient) History(addresses []string) ([]AddressHistoryEntry, error) {
+	seen := map[string]bool{}
+	history := []AddressHistoryEntry{}
+	for _, address := range addresses {
+		if address == "" {
+			continue
+		}
+		_, scripthash, err := electrumScript(address)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []struct {
+			TxHash string `json:"tx_hash"`
+			Height int64  `json:"height"`
+		}
+		if err := c.call(&entries, "blockchain.scripthash.get_history", scripthash); err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if seen[e.TxHash] {
+				continue
+			}
+			seen[e.TxHash] = true
+			// Mempool transactions are 0, or -1 with unconfirmed parents
+			history = append(history, AddressHistoryEntry{Txid: e.TxHash, Height: max(e.Height, 0)})
+		}
+	}
+
+	// Newest first, with unconfirmed transactions on top
+	sort.SliceStable(history, func(i, j int) bool {
+		hi, hj := history[i].Height, history[j].Height
+		if hi == 0 || hj == 0 {
+			return hi == 0 && hj != 0
+		}
+		return hi > hj
+	})
+	return history, nil
+}
+
+func (c *electrumClient) Broadcast(rawHex string) (string, error) {
+	var txid string
+	if err := c.call(&txid, "blockchain.transaction.broadcast", rawHex); err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+func (c *electrumClient) FeeRate(blocks int) (int64, error) {
+	var rate float64
+	if err := c.call(&rate, "blockchain.estimatefee", blocks); err != nil {
+		return 0, err
+	}
+	// -1 when the server's node has no estimate
+	if rate <= 0 {
+		return 0, nil
+	}
+	// KCN/kvB -> kernels/vB
+	return int64(math.Ceil(rate * 1e5)), nil
+}
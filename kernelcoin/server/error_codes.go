@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error codes, in the code field of every JSON error response. Clients
+// branch on these; the error text beside them may change.
+const (
+	ErrInvalidRequest    = "INVALID_REQUEST"    // malformed body or parameters
+	ErrInvalidAddress    = "INVALID_ADDRESS"    // not an address of the network
+	ErrInvalidAmount     = "INVALID_AMOUNT"     // missing, not a number, zero or negative
+	ErrAmountPrecision   = "AMOUNT_PRECISION"   // more than 8 decimal places
+	ErrDustAmount        = "DUST_AMOUNT"        // below the dust threshold
+	ErrInsufficientFunds = "INSUFFICIENT_FUNDS" // more than the wallet, or the selected inputs, can pay
+	ErrWalletLocked      = "WALLET_LOCKED"      // the node wallet is encrypted and locked
+	ErrTxRejected        = "TX_REJECTED"        // the node refused the transaction
+	ErrSendLimit         = "SEND_LIMIT"         // a user's daily send limit
+	ErrNodeUnavailable   = "NODE_UNAVAILABLE"   // the node is unreachable, starting up or refusing our credentials
+	ErrNodeError         = "NODE_ERROR"         // any other error from the node
+	ErrReadOnly          = "READ_ONLY"          // writes are refused until the node check passes
+	ErrUnauthorized      = "UNAUTHORIZED"
+	ErrForbidden         = "FORBIDDEN"
+	ErrNotFound          = "NOT_FOUND"
+	ErrMethodNotAllowed  = "METHOD_NOT_ALLOWED"
+	ErrConflict          = "CONFLICT"
+	ErrRateLimited       = "RATE_LIMITED"
+	ErrNotSupported      = "NOT_SUPPORTED" // not available with this backend or configuration
+	ErrInternal          = "INTERNAL_ERROR"
+)
+
+// errorTextCodes map what node and server errors say to their codes, most
+// specific first. RPC errors read "RPC error: map[code:-6 message:...]".
+var errorTextCodes = []struct {
+	text string
+	code string
+}{
+	{"code:-6 ", ErrInsufficientFunds},
+	{"code:-13 ", ErrWalletLocked},
+	// -5 is any bad address, key or txid
+	{"Invalid recipient address", ErrInvalidAddress},
+	{"Invalid address", ErrInvalidAddress},
+	{"Invalid Kernelcoin address", ErrInvalidAddress},
+	{"non-wallet transaction", ErrNotFound},
+	{"code:-5 ", ErrInvalidRequest},
+	{"code:-3 ", ErrInvalidAmount},
+	{"code:-25 ", ErrTxRejected},
+	{"code:-26 ", ErrTxRejected},
+	{"code:-27 ", ErrTxRejected},
+	{"code:-28 ", ErrNodeUnavailable},
+	{"RPC POST failed", ErrNodeUnavailable},
+	{"RPC credentials rejected", ErrNodeUnavailable},
+	{"code:-32601 ", ErrNotSupported},
+	{"daily send limit reached", ErrSendLimit},
+	{"Insufficient funds", ErrInsufficientFunds},
+	{"RPC error:", ErrNodeError},
+}
+
+// statusCodes are the codes of errors nothing more is known about
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          ErrInvalidRequest,
+	http.StatusUnauthorized:        ErrUnauthorized,
+	http.StatusForbidden:           ErrForbidden,
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusMethodNotAllowed:    ErrMethodNotAllowed,
+	http.StatusConflict:            ErrConflict,
+	http.StatusGone:                ErrNotFound,
+	http.StatusTooManyRequests:     ErrRateLimited,
+	http.StatusNotImplemented:      ErrNotSupported,
+	http.StatusBadGateway:          ErrNodeUnavailable,
+	http.StatusServiceUnavailable:  ErrNodeUnavailable,
+	http.StatusGatewayTimeout:      ErrNodeUnavailable,
+	http.StatusInternalServerError: ErrInternal,
+}
+
+// errorCode picks the code of an error response from its text and the
+// ERROR lines logged while handling it, or else from its status
+func errorCode(status int, texts ...string) string {
+	for _, text := range texts {
+		for _, c := range errorTextCodes {
+			if strings.Contains(text, c.text) {
+				return c.code
+			}
+		}
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return ErrInternal
+	}
+	return ErrInvalidRequest
+}
+
+// heldWriter holds back the JSON responses hold picks by status, so a
+// middleware can rewrite them; other responses pass straight through
+type heldWriter struct {
+	http.ResponseWriter
+	hold   func(status int) bool
+	status int
+	held   *bytes.Buffer
+}
+
+func (e *heldWriter) WriteHeader(code int) {
+	if e.status != 0 {
+		return
+	}
+	e.status = code
+	if e.hold(code) && strings.HasPrefix(e.Header().Get("Content-Type"), "application/json") {
+		e.held = &bytes.Buffer{}
+		return
+	}
+	e.ResponseWriter.WriteHeader(code)
+}
+
+func (e *heldWriter) Write(b []byte) (int, error) {
+	if e.status == 0 {
+		e.WriteHeader(http.StatusOK)
+	}
+	if e.held != nil {
+		return e.held.Write(b)
+	}
+	return e.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses (SSE) working through the writer
+func (e *heldWriter) Flush() {
+	if f, ok := e.ResponseWriter.(http.Flusher); ok && e.held == nil {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection to the WebSocket handler
+func (e *heldWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := e.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the real writer
+func (e *heldWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+// rewrite decodes the held response, lets edit change it and writes the
+// result; a body that isn't a JSON value goes out as it came
+func (e *heldWriter) rewrite(edit func(response interface{})) {
+	body := e.held.Bytes()
+	var response interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&response) == nil {
+		edit(response)
+		if encoded, err := json.Marshal(response); err == nil {
+			body = append(encoded, '\n')
+		}
+	}
+	e.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	e.ResponseWriter.WriteHeader(e.status)
+	e.ResponseWriter.Write(body)
+}
+
+// withErrorCodes adds a code to every JSON error response whose handler
+// didn't give one, so handlers only name codes they know better than the
+// error text and status do, and translates the error into the request's
+// language. It goes inside withRecovery, whose ERROR lines it reads.
+func withErrorCodes(messages *messageCatalogs, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &heldWriter{ResponseWriter: w, hold: func(status int) bool { return status >= 400 }}
+		next.ServeHTTP(ew, r)
+		if ew.held == nil {
+			return
+		}
+
+		ew.rewrite(func(decoded interface{}) {
+			response, ok := decoded.(map[string]interface{})
+			if !ok {
+				return
+			}
+			message, _ := response["error"].(string)
+			if _, ok := response["code"]; !ok {
+				texts := []string{message}
+				if errs, ok := r.Context().Value(requestErrorsKey{}).(*requestErrors); ok {
+					texts = append(texts, errs.all()...)
+				}
+				response["code"] = errorCode(ew.status, texts...)
+			}
+			// After the code, which is picked from the English
+			if message != "" {
+				response["error"] = messages.forRequest(w, r).translate(message)
+			}
+		})
+	})
+}
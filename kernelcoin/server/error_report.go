@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errorReportQueue bounds the events waiting to be sent; beyond it new
+// events are dropped rather than piling up while the collector is down
+const errorReportQueue = 100
+
+// errorReporter sends events to a Sentry-compatible collector. Events carry
+// the request's method, path, request ID and the handler's ERROR lines, never
+// query strings, bodies or headers other than User-Agent.
+type errorReporter struct {
+	endpoint    string
+	auth        string
+	environment string
+	serverName  string
+	client      *http.Client
+	queue       chan sentryEvent
+}
+
+// sentryEvent is the subset of the Sentry event payload we fill in
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Logger      string                 `json:"logger"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Message     string                 `json:"message,omitempty"`
+	Exception   *sentryExceptions      `json:"exception,omitempty"`
+	Request     *sentryRequest         `json:"request,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// newErrorReporter parses a DSN of the form
+// https://PUBLIC_KEY@host[/path]/PROJECT_ID and starts the sender
+func newErrorReporter(dsn, environment string) (*errorReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid DSN: want https://KEY@host/PROJECT_ID")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 || path[slash+1:] == "" {
+		return nil, fmt.Errorf("invalid DSN: missing project ID")
+	}
+
+	serverName, _ := os.Hostname()
+	r := &errorReporter{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:slash], path[slash+1:]),
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_client=kernelcoin-webwallet/1.0, sentry_key=%s",
+			u.User.Username()),
+		environment: environment,
+		serverName:  serverName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan sentryEvent, errorReportQueue),
+	}
+	go r.run()
+	return r, nil
+}
+
+// run sends queued events one at a time
+func (r *errorReporter) run() {
+	for event := range r.queue {
+		if err := r.send(event); err != nil {
+			log.Printf("[REPORT] WARNING: failed to send error report %s: %v", event.EventID, err)
+		}
+	}
+}
+
+// send posts event as a Sentry envelope
+func (r *errorReporter) send(event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", event.EventID, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// capture fills in the common fields and queues event, dropping it when
+// the queue is full. A nil reporter does nothing.
+func (r *errorReporter) capture(req *http.Request, event sentryEvent) {
+	if r == nil {
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	event.EventID = hex.EncodeToString(id)
+	event.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	event.Platform = "go"
+	event.Logger = "kernelcoin-webwallet"
+	event.ServerName = r.serverName
+	event.Environment = r.environment
+	event.Request = &sentryRequest{
+		Method:  req.Method,
+		URL:     req.URL.Path,
+		Headers: map[string]string{"User-Agent": req.UserAgent()},
+	}
+	event.Tags = map[string]string{"request_id": requestID(req)}
+
+	select {
+	case r.queue <- event:
+	default:
+		log.Printf("[REPORT] WARNING: error report queue full, dropping event for %s", req.URL.Path)
+	}
+}
+
+// capturePanic reports a recovered panic with the stack that raised it
+func (r *errorReporter) capturePanic(req *http.Request, value interface{}, frames []sentryFrame, errs []string) {
+	event := sentryEvent{
+		Level: "fatal",
+		Exception: &sentryExceptions{Values: []sentryException{{
+			Type:       "panic",
+			Value:      fmt.Sprint(value),
+			Stacktrace: &sentryStacktrace{Frames: frames},
+		}}},
+	}
+	if len(errs) > 0 {
+		event.Extra = map[string]interface{}{"errors": errs}
+	}
+	r.capture(req, event)
+}
+
+// captureServerError reports a 5xx response with the ERROR lines logged
+// while producing it
+func (r *errorReporter) captureServerError(req *http.Request, status int, errs []string) {
+	event := sentryEvent{
+		Level:   "error",
+		Message: fmt.Sprintf("HTTP %d from %s %s", status, req.Method, req.URL.Path),
+	}
+	if len(errs) > 0 {
+		event.Message = errs[0]
+		event.Extra = map[string]interface{}{"status": status, "errors": errs}
+	}
+	r.capture(req, event)
+}
+
+// panicFrames is the stack of the panicking goroutine, outermost call first
+// as Sentry expects
+func panicFrames() []sentryFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var out []sentryFrame
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			out = append(out, sentryFrame{
+				Function: frame.Function,
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    strings.HasPrefix(frame.Function, "main."),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// requestErrors collects the ERROR lines a handler logs, for the report
+// if the request ends in a 5xx
+type requestErrors struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+type requestErrorsKey struct{}
+
+func (e *requestErrors) add(line string) {
+	e.mu.Lock()
+	e.lines = append(e.lines, line)
+	e.mu.Unlock()
+}
+
+func (e *requestErrors) all() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.lines...)
+}
+
+// noteRequestError keeps line for r's error report when it is an ERROR line
+func noteRequestError(r *http.Request, line string) {
+	errs, ok := r.Context().Value(requestErrorsKey{}).(*requestErrors)
+	if !ok {
+		return
+	}
+	if level, _, _ := parseLogLine(line); level >= slog.LevelError {
+		errs.add(line)
+	}
+}
+
+// withRecovery turns a handler panic into a logged, reported 500 instead of
+// a dropped connection, and reports any other 5xx response. reporter may be
+// nil, in which case nothing is sent but panics are still recovered.
+func withRecovery(reporter *errorReporter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errs := &requestErrors{}
+		r = r.WithContext(context.WithValue(r.Context(), requestErrorsKey{}, errs))
+		rec := &accessRecorder{ResponseWriter: w}
+
+		defer func() {
+			value := recover()
+			if value == nil {
+				if rec.status >= 500 {
+					reporter.captureServerError(r, rec.status, errs.all())
+				}
+				return
+			}
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+
+			frames := panicFrames()
+			reporter.capturePanic(r, value, frames, errs.all())
+			buf := make([]byte, 16<<10)
+			buf = buf[:runtime.Stack(buf, false)]
+			logRequest(r, "[HTTP] ERROR: panic serving %s %s: %v\n%s", r.Method, r.URL.Path, value, buf)
+
+			if rec.status == 0 {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Internal server error", "code": ErrInternal})
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
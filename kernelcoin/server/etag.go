@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// walletETag identifies the wallet state a read response was built from:
+// the wallet, the chain tip, the wallet's transaction count and any change this server
+// made (abandoning, say, moves neither), transaction metadata edits included. The query string and current price
+// are mixed in since they shape the response too, and so is the state of the
+// transaction cache, which lags the node by up to a sync interval.
+func (ws *WalletServer) walletETag(r *http.Request) (string, error) {
+	_, tip, err := ws.rpc(r).GetBestBlock()
+	if err != nil {
+		return "", err
+	}
+	info, err := ws.rpc(r).GetWalletInfo()
+	if err != nil {
+		return "", err
+	}
+	txcount := rpc.GetInt(info, "txcount")
+	ws.rpc(r).NoteTxCount(txcount)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%d|%d|%d|%s", ws.rpc(r).URL(), tip, txcount, ws.rpc(r).WalletChanges(), ws.metadataChanges.Load(), r.URL.RawQuery)
+	if ws.txSync.Ready() {
+		_, cached, err := ws.store.WalletTransactions(TransactionFilter{}, PageParams{}, 0)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "|%d|%d", ws.txSync.tip.Load(), cached)
+	}
+	if quote := ws.fiatQuote(r); quote != nil {
+		fmt.Fprintf(h, "|%s%g", quote.Currency, quote.Price)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+// chainETag tags a getblockchaininfo result by the fields that move: the
+// tip, header count and sync progress
+func chainETag(info map[string]interface{}) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%v|%v", rpc.GetString(info, "bestblockhash"), rpc.GetInt64(info, "headers"),
+		info["verificationprogress"], info["initialblockdownload"])
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header names tag. Weak
+// comparison is used, as RFC 9110 requires for If-None-Match.
+func etagMatches(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// withWalletETag answers GET requests with 304 Not Modified when the
+// client's If-None-Match still matches walletETag, so polling clients cost
+// two small RPCs and no body. If the tag can't be computed the request is
+// served normally.
+func (ws *WalletServer) withWalletETag(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			handler(w, r)
+			return
+		}
+
+		tag, err := ws.walletETag(r)
+		if err != nil {
+			handler(w, r)
+			return
+		}
+		if notModified(w, r, tag) {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// notModified sets the ETag header and, when the request's If-None-Match
+// matches it, writes 304 and returns true
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
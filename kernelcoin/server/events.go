@@ -0,0 +1,362 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Event types pushed to live clients
+const (
+	EventBalance      = "balance"
+	EventTransaction  = "transaction"
+	EventConfirmation = "confirmation"
+
+	EventTxReceived       = "tx_received"  // new incoming payment
+	EventTxConfirmed      = "tx_confirmed" // first confirmation of a wallet transaction
+	EventBlockConnected   = "block_connected"
+	EventNodeDisconnected = "node_disconnected"
+	EventNodeConnected    = "node_connected" // the node is reachable again
+)
+
+const (
+	// eventHistory is how many past events the hub keeps for long-poll
+	// clients catching up
+	eventHistory = 256
+
+	// waitIdleGrace is how long after its last long-poll request a client
+	// still counts as listening, so the watcher doesn't idle between its
+	// requests
+	waitIdleGrace = time.Minute
+)
+
+// confirmationWatchDepth is how many confirmations a transaction is followed
+// for before confirmation events stop
+const confirmationWatchDepth = 6
+
+// allOwners is the owner of events about the node rather than a wallet,
+// which everyone sees, and subscribes to every owner's events
+const allOwners = "*"
+
+// WalletEvent is a change pushed to live clients
+type WalletEvent struct {
+	Type string      `json:"type"`
+	Time int64       `json:"time"`
+	Seq  int64       `json:"seq"` // counts up from 1 in each run of the server
+	Data interface{} `json:"data"`
+	// Owner is whose wallet the event is about, as walletOwner names
+	// them, or allOwners
+	Owner string `json:"-"`
+}
+
+// visibleTo reports whether a client of owner's wallet may see ev
+func (ev WalletEvent) visibleTo(owner string) bool {
+	return owner == allOwners || ev.Owner == allOwners || ev.Owner == owner
+}
+
+// eventHub fans wallet events out to subscribers, each getting the events
+// visible to its owner. Slow subscribers miss events rather than blocking
+// the publisher. The last eventHistory events are kept for long-poll
+// clients, which fetch what they missed by cursor.
+type eventHub struct {
+	mu      sync.Mutex
+	subs    map[chan WalletEvent]string // to the owner subscribed
+	seq     int64
+	history []WalletEvent
+
+	// run tells this run's cursors from those of an earlier one
+	run string
+	// waited is when a long-poll request last finished, unix seconds
+	waited atomic.Int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: map[chan WalletEvent]string{},
+		run:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		done: make(chan struct{}),
+	}
+}
+
+// Close tells streaming clients to disconnect, so a graceful shutdown isn't
+// held up by connections that never go idle
+func (h *eventHub) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// Done is closed once the hub is closed
+func (h *eventHub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Subscribe returns a channel of every owner's events
+func (h *eventHub) Subscribe() chan WalletEvent {
+	return h.SubscribeFor(allOwners)
+}
+
+// SubscribeFor returns a channel of the events visible to owner
+func (h *eventHub) SubscribeFor(owner string) chan WalletEvent {
+	ch := make(chan WalletEvent, 32)
+	h.mu.Lock()
+	h.subs[ch] = owner
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) Unsubscribe(ch chan WalletEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Idle reports whether nobody is listening: no subscribers and no recent
+// long-poll requests
+func (h *eventHub) Idle() bool {
+	return h.Subscribers() == 0 && time.Since(time.Unix(h.waited.Load(), 0)) > waitIdleGrace
+}
+
+// Cursor is the position after the latest event
+func (h *eventHub) Cursor() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cursor()
+}
+
+func (h *eventHub) cursor() string {
+	return fmt.Sprintf("%s-%d", h.run, h.seq)
+}
+
+// Since returns the events visible to owner after cursor, and the cursor
+// after them. It returns false if cursor is from an earlier run or older
+// than the history, and the client has to reload instead.
+func (h *eventHub) Since(cursor, owner string) ([]WalletEvent, string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var run string
+	var seq int64
+	if _, err := fmt.Sscanf(strings.Replace(cursor, "-", " ", 1), "%s %d", &run, &seq); err != nil ||
+		run != h.run || seq > h.seq {
+		return nil, h.cursor(), false
+	}
+	if seq == h.seq {
+		return []WalletEvent{}, h.cursor(), true
+	}
+	if len(h.history) == 0 || seq < h.history[0].Seq-1 {
+		return nil, h.cursor(), false
+	}
+	events := []WalletEvent{}
+	for _, ev := range h.history[seq-h.history[0].Seq+1:] {
+		if ev.visibleTo(owner) {
+			events = append(events, ev)
+		}
+	}
+	return events, h.cursor(), true
+}
+
+// Publish sends an event about the default wallet
+func (h *eventHub) Publish(eventType string, data interface{}) {
+	h.PublishFor("", eventType, data)
+}
+
+// PublishFor sends an event about owner's wallet, or with allOwners about
+// the node
+func (h *eventHub) PublishFor(owner, eventType string, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	ev := WalletEvent{Type: eventType, Time: time.Now().Unix(), Seq: h.seq, Data: data, Owner: owner}
+	h.history = append(h.history, ev)
+	if len(h.history) > eventHistory {
+		h.history = h.history[len(h.history)-eventHistory:]
+	}
+
+	for ch, subscriber := range h.subs {
+		if !ev.visibleTo(subscriber) {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// BlockEvent is the data of a block_connected event
+type BlockEvent struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// walletSnapshot is what the watcher compares between polls
+type walletSnapshot struct {
+	balance       BalanceResponse
+	confirmations map[string]int
+	tip           BlockEvent
+}
+
+// entryKey identifies a listtransactions entry; one transaction can have
+// several (e.g. a send and its change)
+func entryKey(tx TransactionResponse) string {
+	return fmt.Sprintf("%s:%s:%s", tx.Txid, tx.Category, tx.Address)
+}
+
+// RunWalletWatcher polls the node and publishes balance, transaction, block
+// and payment watch events. In multi-user mode it polls every enabled
+// user's wallet too. It idles while nobody is subscribed.
+func (ws *WalletServer) RunWalletWatcher(interval time.Duration) {
+	log.Printf("[EVENTS] Watching wallet every %s", interval)
+
+	// The last snapshot of each owner's wallet
+	prev := map[string]*walletSnapshot{}
+	nodeDown := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if ws.events.Idle() {
+			// Re-seed when someone connects so they don't get a burst of old news
+			prev = map[string]*walletSnapshot{}
+			continue
+		}
+
+		next, recent, err := ws.takeWalletSnapshot(ws.rpcClient)
+		if err != nil {
+			log.Printf("[EVENTS] WARNING: poll failed: %v", err)
+			if !nodeDown {
+				nodeDown = true
+				ws.events.PublishFor(allOwners, EventNodeDisconnected, map[string]string{"error": err.Error()})
+			}
+			continue
+		}
+		if nodeDown {
+			nodeDown = false
+			ws.events.PublishFor(allOwners, EventNodeConnected, next.tip)
+		}
+
+		if last := prev[""]; last != nil {
+			if next.tip.Hash != last.tip.Hash {
+				ws.events.PublishFor(allOwners, EventBlockConnected, next.tip)
+			}
+			ws.publishChanges("", last, next, recent)
+		}
+		prev[""] = next
+		ws.watchUserWallets(prev)
+
+		ws.checkPaymentWatches()
+	}
+}
+
+// watchUserWallets publishes the changes to each enabled user's wallet
+// since its snapshot in prev, and replaces the snapshots
+func (ws *WalletServer) watchUserWallets(prev map[string]*walletSnapshot) {
+	if ws.tenants == nil {
+		return
+	}
+	users, err := ws.store.Users()
+	if err != nil {
+		log.Printf("[EVENTS] WARNING: Could not list users: %v", err)
+		return
+	}
+
+	watched := map[string]bool{"": true}
+	for _, u := range users {
+		if u.Disabled {
+			continue
+		}
+		watched[u.Username] = true
+		next, recent, err := ws.takeWalletSnapshot(ws.tenants.client(ws.rpcClient, u.Wallet))
+		if err != nil {
+			log.Printf("[EVENTS] WARNING: poll of %s's wallet failed: %v", u.Username, err)
+			continue
+		}
+		if last := prev[u.Username]; last != nil {
+			ws.publishChanges(u.Username, last, next, recent)
+		}
+		prev[u.Username] = next
+	}
+	for owner := range prev {
+		if !watched[owner] {
+			delete(prev, owner)
+		}
+	}
+}
+
+func (ws *WalletServer) takeWalletSnapshot(client rpc.WalletBackend) (*walletSnapshot, []TransactionResponse, error) {
+	// The tip comes first: a new one invalidates the cached balance
+	height, hash, err := client.GetBestBlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := client.GetBalanceInfo("")
+	if err != nil {
+		return nil, nil, err
+	}
+	txs, err := client.ListTransactions("", 100, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snap := &walletSnapshot{
+		balance:       balanceResponse(info),
+		confirmations: map[string]int{},
+		tip:           BlockEvent{Height: height, Hash: hash},
+	}
+	recent := []TransactionResponse{}
+	for _, item := range txs {
+		if txMap, ok := item.(map[string]interface{}); ok {
+			tx := transactionFromRPC(txMap)
+			snap.confirmations[entryKey(tx)] = tx.Confirmations
+			recent = append(recent, tx)
+		}
+	}
+	setDirections(recent)
+	return snap, recent, nil
+}
+
+// publishChanges publishes what changed in owner's wallet between
+// snapshots
+func (ws *WalletServer) publishChanges(owner string, prev, next *walletSnapshot, recent []TransactionResponse) {
+	if !reflect.DeepEqual(next.balance, prev.balance) {
+		ws.events.PublishFor(owner, EventBalance, next.balance)
+	}
+
+	for _, tx := range recent {
+		if before, seen := prev.confirmations[entryKey(tx)]; seen {
+			ws.noteConfirmations(owner, tx, before)
+		}
+	}
+	ws.setStatuses(owner, recent)
+
+	for _, tx := range recent {
+		before, seen := prev.confirmations[entryKey(tx)]
+		if !seen {
+			ws.events.PublishFor(owner, EventTransaction, tx)
+			if tx.Category == "receive" {
+				ws.events.PublishFor(owner, EventTxReceived, tx)
+			}
+		} else if before != tx.Confirmations && before < confirmationWatchDepth {
+			ws.events.PublishFor(owner, EventConfirmation, tx)
+		}
+		if before <= 0 && tx.Confirmations > 0 {
+			ws.events.PublishFor(owner, EventTxConfirmed, tx)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// exportCurrency is the ticker written into accounting exports
+const exportCurrency = "KCN"
+
+// exportFormat describes one ?format= of /api/transactions/export
+type exportFormat struct {
+	contentType string
+	extension   string
+	open        func(w io.Writer, fiat string) exportWriter
+}
+
+// exportWriter writes an export one row at a time; Close writes any trailer
+type exportWriter interface {
+	WriteRow(row exportRow) error
+	Close() error
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":          {"text/csv", "csv", newCSVExport},
+	"koinly":       {"text/csv", "csv", newKoinlyExport},
+	"cointracking": {"text/csv", "csv", newCoinTrackingExport},
+	"ofx":          {"application/x-ofx", "ofx", newOFXExport},
+	"qif":          {"application/qif", "qif", newQIFExport},
+	"json":         {"application/json", "json", newJSONExport},
+}
+
+// exportRow is one wallet entry as written to an export
+type exportRow struct {
+	TransactionResponse
+
+	// BookedFee is the transaction fee as a positive amount, set on the first
+	// entry of each transaction only; listtransactions repeats it on every
+	// output of a send
+	BookedFee rpc.Amount
+
+	// FiatValue is the absolute amount in the requested currency, or ""
+	// when no price is available
+	FiatValue string
+}
+
+// HandleExportTransactions downloads the wallet history (optionally
+// filtered like /api/transactions) as plain CSV, Koinly or CoinTracking CSV,
+// OFX, QIF or a JSON array. The export is streamed as the wallet is paged
+// through, so its size is not bounded by memory.
+func (ws *WalletServer) HandleExportTransactions(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("Unknown format %q (use csv, koinly, cointracking, ofx, qif or json)", name),
+		})
+		return
+	}
+
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	fiat := strings.ToUpper(r.URL.Query().Get("currency"))
+	if prices := ws.prices.Load(); prices != nil {
+		if fiat == "" {
+			fiat = prices.currency
+		}
+		if err := prices.CheckCurrency(fiat); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unknown currency"})
+			return
+		}
+	}
+
+	// A long history can take longer than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	// Headers go out with the first batch, so a wallet that can't be read
+	// at all still gets a proper error response
+	var out exportWriter
+	begin := func() {
+		w.Header().Set("Content-Type", format.contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="kernelcoin-transactions.%s"`, format.extension))
+		out = format.open(w, fiat)
+	}
+
+	books := exportBooks{fiat: fiat, all: name == "csv"}
+	written := 0
+	err = ws.streamTransactions(ws.rpc(r), filter, func(batch []TransactionResponse) error {
+		if out == nil {
+			begin()
+		}
+		setDirections(batch)
+		owner := walletOwner(r)
+		ws.setStatuses(owner, batch)
+		ws.resolveContacts(owner, batch)
+		for _, tx := range batch {
+			row, ok := ws.exportRow(tx, &books)
+			if !ok {
+				continue
+			}
+			if err := out.WriteRow(row); err != nil {
+				return err
+			}
+			written++
+		}
+		return rc.Flush()
+	})
+	if err != nil && out == nil {
+		logRequest(r, "[API] ExportTransactions ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list transactions"})
+		return
+	}
+	if err != nil {
+		// Too late for an error status; the client sees a truncated file
+		logRequest(r, "[API] ExportTransactions ERROR after %d entries: %v", written, err)
+		return
+	}
+
+	if out == nil {
+		begin()
+	}
+	if err := out.Close(); err != nil {
+		logRequest(r, "[API] ExportTransactions ERROR: %v", err)
+		return
+	}
+	logRequest(r, "[API] ExportTransactions SUCCESS: %d entries as %s", written, name)
+}
+
+// exportBooks is the state carried between rows of one export
+type exportBooks struct {
+	fiat string
+	all  bool
+
+	// lastFeeTxid is the transaction whose fee was booked last; entries of
+	// one transaction are adjacent, so that is all that's needed to book
+	// each fee once
+	lastFeeTxid string
+}
+
+// exportRow prepares one transaction for export. Unless books.all is set,
+// entries that never affected the books are dropped: abandoned and
+// conflicted transactions, orphaned and still-immature coinbases.
+func (ws *WalletServer) exportRow(tx TransactionResponse, books *exportBooks) (exportRow, bool) {
+	if !books.all && (tx.Abandoned || tx.Conflicted || tx.Category == "orphan" || tx.Category == "immature") {
+		return exportRow{}, false
+	}
+
+	row := exportRow{TransactionResponse: tx}
+	if tx.Fee != 0 && tx.Txid != books.lastFeeTxid {
+		row.BookedFee = tx.Fee.Abs()
+		books.lastFeeTxid = tx.Txid
+	}
+
+	if prices := ws.prices.Load(); prices != nil {
+		price, err := prices.PriceAt(books.fiat, time.Unix(tx.Time, 0))
+		if err != nil {
+			log.Printf("[API] ExportTransactions WARNING: no %s price for %s: %v", books.fiat, tx.Txid, err)
+		} else {
+			row.FiatValue = fmt.Sprintf("%.2f", tx.Amount.Abs().KCN()*price)
+		}
+	}
+	return row, true
+}
+
+// description is the free-text note for an entry: its contact, comments and
+// address
+func (row exportRow) description() string {
+	parts := []string{}
+	if row.Contact != "" {
+		parts = append(parts, row.Contact)
+	}
+	if row.Comment != "" {
+		parts = append(parts, row.Comment)
+	}
+	if row.CommentTo != "" {
+		parts = append(parts, "to "+row.CommentTo)
+	}
+	if row.Address != "" {
+		parts = append(parts, row.Address)
+	}
+	return strings.Join(parts, " / ")
+}
+
+func (row exportRow) incoming() bool {
+	return row.Amount >= 0
+}
+
+// csvExport writes one CSV record per row
+type csvExport struct {
+	out    *csv.Writer
+	fiat   string
+	record func(row exportRow, fiat string) []string
+}
+
+func (e *csvExport) WriteRow(row exportRow) error {
+	return e.out.Write(e.record(row, e.fiat))
+}
+
+func (e *csvExport) Close() error {
+	e.out.Flush()
+	return e.out.Error()
+}
+
+func newCSVExport(w io.Writer, fiat string) exportWriter {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Date", "Txid", "Vout", "Category", "Address", "Amount", "Fee", "Confirmations", "Label", "Comment", "Fiat Value", "Fiat Currency"})
+	return &csvExport{out: out, fiat: fiat, record: csvRecord}
+}
+
+func csvRecord(row exportRow, fiat string) []string {
+	feeText := ""
+	if row.BookedFee != 0 {
+		feeText = row.BookedFee.String()
+	}
+	fiatCurrency := ""
+	if row.FiatValue != "" {
+		fiatCurrency = fiat
+	}
+	return []string{
+		time.Unix(row.Time, 0).UTC().Format(time.RFC3339),
+		row.Txid,
+		fmt.Sprint(row.Vout),
+		row.Category,
+		row.Address,
+		row.Amount.String(),
+		feeText,
+		fmt.Sprint(row.Confirmations),
+		row.Account,
+		row.Comment,
+		row.FiatValue,
+		fiatCurrency,
+	}
+}
+
+// newKoinlyExport writes Koinly's universal CSV layout
+func newKoinlyExport(w io.Writer, fiat string) exportWriter {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
+		"Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency", "Label", "Description", "TxHash"})
+	return &csvExport{out: out, fiat: fiat, record: koinlyRecord}
+}
+
+func koinlyRecord(row exportRow, fiat string) []string {
+	record := make([]string, 12)
+	record[0] = time.Unix(row.Time, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	if row.incoming() {
+		record[3], record[4] = row.Amount.String(), exportCurrency
+	} else {
+		record[1], record[2] = row.Amount.Abs().String(), exportCurrency
+	}
+	if row.BookedFee != 0 {
+		record[5], record[6] = row.BookedFee.String(), exportCurrency
+	}
+	if row.FiatValue != "" {
+		record[7], record[8] = row.FiatValue, fiat
+	}
+	if row.Category == "generate" {
+		record[9] = "mining"
+	}
+	record[10] = row.description()
+	record[11] = row.Txid
+	return record
+}
+
+// newCoinTrackingExport writes CoinTracking's CSV import layout. Values in
+// the account currency assume it matches the requested fiat currency.
+func newCoinTrackingExport(w io.Writer, fiat string) exportWriter {
+	out := csv.NewWriter(w)
+	out.Write([]string{"Type", "Buy Amount", "Buy Currency", "Sell Amount", "Sell Currency", "Fee", "Fee Currency",
+		"Exchange", "Trade-Group", "Comment", "Date", "Tx-ID", "Buy Value in Account Currency", "Sell Value in Account Currency"})
+	return &csvExport{out: out, fiat: fiat, record: coinTrackingRecord}
+}
+
+func coinTrackingRecord(row exportRow, fiat string) []string {
+	record := make([]string, 14)
+	switch {
+	case row.Category == "generate":
+		record[0] = "Mining"
+	case row.incoming():
+		record[0] = "Deposit"
+	default:
+		record[0] = "Withdrawal"
+	}
+	if row.incoming() {
+		record[1], record[2], record[12] = row.Amount.String(), exportCurrency, row.FiatValue
+	} else {
+		record[3], record[4], record[13] = row.Amount.Abs().String(), exportCurrency, row.FiatValue
+	}
+	if row.BookedFee != 0 {
+		record[5], record[6] = row.BookedFee.String(), exportCurrency
+	}
+	record[7] = "Kernelcoin Wallet"
+	record[9] = row.description()
+	record[10] = time.Unix(row.Time, 0).UTC().Format("2006-01-02 15:04:05")
+	record[11] = row.Txid
+	return record
+}
+
+// ofxText escapes s for an OFX 2 (XML) element
+func ofxText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const ofxTime = "20060102150405"
+
+// ofxExport writes an OFX 2.1 bank statement in KCN. Fees are separate FEE
+// transactions so the statement balances. The statement runs from the first
+// entry to the time of the export.
+type ofxExport struct {
+	out     *bufio.Writer
+	now     time.Time
+	started bool
+	last    time.Time
+	balance rpc.Amount
+}
+
+func newOFXExport(w io.Writer, fiat string) exportWriter {
+	return &ofxExport{out: bufio.NewWriter(w), now: time.Now().UTC()}
+}
+
+// header writes everything up to the transaction list, which opens at start
+func (e *ofxExport) header(start time.Time) {
+	out := e.out
+	fmt.Fprintf(out, "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+	fmt.Fprintf(out, "<?OFX OFXHEADER=\"200\" VERSION=\"211\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n")
+	fmt.Fprintf(out, "<OFX>\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+	fmt.Fprintf(out, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n", e.now.Format(ofxTime))
+	fmt.Fprintf(out, "<BANKMSGSRSV1><STMTTRNRS><TRNUID>1</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(out, "<STMTRS><CURDEF>%s</CURDEF>\n", exportCurrency)
+	fmt.Fprintf(out, "<BANKACCTFROM><BANKID>KERNELCOIN</BANKID><ACCTID>wallet</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n")
+	fmt.Fprintf(out, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", start.Format(ofxTime), e.now.Format(ofxTime))
+	e.started = true
+}
+
+func (e *ofxExport) WriteRow(row exportRow) error {
+	posted := time.Unix(row.Time, 0).UTC()
+	if !e.started {
+		e.header(posted)
+	}
+	e.last = posted
+
+	trnType := "DEBIT"
+	if row.incoming() {
+		trnType = "CREDIT"
+	}
+	fmt.Fprintf(e.out, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s-%d</FITID><NAME>Kernelcoin %s</NAME><MEMO>%s</MEMO></STMTTRN>\n",
+		trnType, posted.Format(ofxTime), row.Amount, row.Txid, row.Vout, ofxText(row.Category), ofxText(row.description()))
+	e.balance += row.Amount
+
+	if row.BookedFee != 0 {
+		fmt.Fprintf(e.out, "<STMTTRN><TRNTYPE>FEE</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%s-fee</FITID><NAME>Network fee</NAME></STMTTRN>\n",
+			posted.Format(ofxTime), -row.BookedFee, row.Txid)
+		e.balance -= row.BookedFee
+	}
+	return nil
+}
+
+func (e *ofxExport) Close() error {
+	if !e.started {
+		e.header(e.now)
+		e.last = e.now
+	}
+	fmt.Fprintf(e.out, "</BANKTRANLIST>\n<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", e.balance, e.last.Format(ofxTime))
+	fmt.Fprintf(e.out, "</STMTRS></STMTTRNRS></BANKMSGSRSV1>\n</OFX>\n")
+	return e.out.Flush()
+}
+
+// qifExport writes a QIF bank register. Fees are separate entries.
+type qifExport struct {
+	out *bufio.Writer
+}
+
+func newQIFExport(w io.Writer, fiat string) exportWriter {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "!Type:Bank\n")
+	return &qifExport{out: out}
+}
+
+func (e *qifExport) WriteRow(row exportRow) error {
+	date := time.Unix(row.Time, 0).UTC().Format("01/02/2006")
+	fmt.Fprintf(e.out, "D%s\nT%s\nPKernelcoin %s\nM%s\nN%s\n^\n", date, row.Amount, row.Category, row.description(), row.Txid)
+	if row.BookedFee != 0 {
+		fmt.Fprintf(e.out, "D%s\nT%s\nPNetwork fee\nN%s\n^\n", date, -row.BookedFee, row.Txid)
+	}
+	return nil
+}
+
+func (e *qifExport) Close() error {
+	return e.out.Flush()
+}
+
+// jsonExport writes a JSON array of transactions as /api/transactions
+// returns them, with fiat_value at the historical price
+type jsonExport struct {
+	out   *bufio.Writer
+	enc   *json.Encoder
+	fiat  string
+	count int
+}
+
+func newJSONExport(w io.Writer, fiat string) exportWriter {
+	out := bufio.NewWriter(w)
+	out.WriteString("[\n")
+	return &jsonExport{out: out, enc: json.NewEncoder(out), fiat: fiat}
+}
+
+func (e *jsonExport) WriteRow(row exportRow) error {
+	tx := row.TransactionResponse
+	if row.FiatValue != "" {
+		value, _ := strconv.ParseFloat(row.FiatValue, 64)
+		tx.FiatValue = &FiatValue{Currency: e.fiat, Value: value}
+	}
+	if e.count > 0 {
+		e.out.WriteString(",")
+	}
+	e.count++
+	// Encode ends each element with a newline
+	return e.enc.Encode(tx)
+}
+
+func (e *jsonExport) Close() error {
+	e.out.WriteString("]\n")
+	return e.out.Flush()
+}
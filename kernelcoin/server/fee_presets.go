@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// The fee presets, slowest first
+const (
+	FeePresetEconomy  = "economy"
+	FeePresetNormal   = "normal"
+	FeePresetPriority = "priority"
+)
+
+var feePresetNames = []string{FeePresetEconomy, FeePresetNormal, FeePresetPriority}
+
+// FeePreset is a fee preset as it stands against the node's current estimate
+type FeePreset struct {
+	Name       string  `json:"name"`
+	ConfTarget int     `json:"conf_target"`
+	FeeRate    float64 `json:"fee_rate"` // kernels per vbyte
+	// Estimate is the node's estimate, absent when it has none
+	Estimate *float64 `json:"estimate,omitempty"`
+	// Bound is floor or ceiling when that setting, not the estimate, gave
+	// the fee rate
+	Bound string `json:"bound,omitempty"`
+}
+
+type FeePresetsResponse struct {
+	Success bool        `json:"success"`
+	Presets []FeePreset `json:"presets,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// preset returns the configuration of the named preset
+func (c FeeConfig) preset(name string) (FeePresetConfig, bool) {
+	switch name {
+	case FeePresetEconomy:
+		return c.Economy, true
+	case FeePresetNormal:
+		return c.Normal, true
+	case FeePresetPriority:
+		return c.Priority, true
+	}
+	return FeePresetConfig{}, false
+}
+
+// feePreset resolves the named preset into a fee rate. Without a node
+// estimate the floor applies, and with no floor either there is no rate
+// to give.
+func (ws *WalletServer) feePreset(client rpc.WalletBackend, name string) (*FeePreset, error) {
+	config, ok := ws.fees.preset(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown fee preset %q", name)
+	}
+
+	// KCN per kvB
+	rate, err := client.EstimateSmartFee(config.ConfTarget)
+	if err != nil {
+		return nil, fmt.Errorf("estimatesmartfee(%d) failed: %w", config.ConfTarget, err)
+	}
+
+	preset := &FeePreset{Name: name, ConfTarget: config.ConfTarget}
+	if rate > 0 {
+		// Kernels per vbyte, to the 0.001 the node accepts
+		estimate := math.Round(rate*rpc.KernelsPerKCN) / 1000
+		preset.Estimate = &estimate
+		preset.FeeRate = estimate
+	}
+	switch {
+	case preset.FeeRate < config.Floor:
+		preset.FeeRate, preset.Bound = config.Floor, "floor"
+	case config.Ceiling > 0 && preset.FeeRate > config.Ceiling:
+		preset.FeeRate, preset.Bound = config.Ceiling, "ceiling"
+	}
+	if preset.FeeRate <= 0 {
+		return nil, fmt.Errorf("no fee estimate for %d blocks and no floor for the %s preset", config.ConfTarget, name)
+	}
+	return preset, nil
+}
+
+// HandleFeePresets returns the fee rate each preset gives right now
+func (ws *WalletServer) HandleFeePresets(w http.ResponseWriter, r *http.Request) {
+	presets := []FeePreset{}
+	for _, name := range feePresetNames {
+		preset, err := ws.feePreset(ws.rpc(r), name)
+		if err != nil {
+			logRequest(r, "[API] FeePresets ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(FeePresetsResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to price the %s fee preset", name),
+			})
+			return
+		}
+		presets = append(presets, *preset)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FeePresetsResponse{
+		Success: true,
+		Presets: presets,
+	})
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// feeHistoryRetention is how long fee samples are kept in the store
+const feeHistoryRetention = 30 * 24 * time.Hour
+
+// FeeSample is one point of the fee and mempool history. Fee rates are in
+// KCN/kvB and nil when the node had no estimate for that target.
+type FeeSample struct {
+	SampledAt     int64    `json:"sampled_at"`
+	FeeRate2      *float64 `json:"fee_rate_2"`
+	FeeRate6      *float64 `json:"fee_rate_6"`
+	FeeRate12     *float64 `json:"fee_rate_12"`
+	MempoolTx     int64    `json:"mempool_tx"`
+	MempoolBytes  int64    `json:"mempool_bytes"`
+	MempoolMinFee float64  `json:"mempool_min_fee"`
+}
+
+type FeeHistoryResponse struct {
+	Success bool        `json:"success"`
+	Samples []FeeSample `json:"samples,omitempty"`
+	Trend   string      `json:"trend,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// InsertFeeSample records a fee sample
+func (s *Store) InsertFeeSample(sample FeeSample) error {
+	_, err := s.db.Exec(`INSERT INTO fee_samples
+		(sampled_at, fee_rate_2, fee_rate_6, fee_rate_12, mempool_tx, mempool_bytes, mempool_min_fee)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		sample.SampledAt, sample.FeeRate2, sample.FeeRate6, sample.FeeRate12,
+		sample.MempoolTx, sample.MempoolBytes, sample.MempoolMinFee)
+	return err
+}
+
+// FeeSamplesSince returns samples taken at or after since (unix seconds), oldest first
+func (s *Store) FeeSamplesSince(since int64) ([]FeeSample, error) {
+	rows, err := s.db.Query(`SELECT sampled_at, fee_rate_2, fee_rate_6, fee_rate_12, mempool_tx, mempool_bytes, mempool_min_fee
+		FROM fee_samples WHERE sampled_at >= ? ORDER BY sampled_at`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []FeeSample{}
+	for rows.Next() {
+		sample, err := scanFeeSample(rows)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, *sample)
+	}
+	return samples, rows.Err()
+}
+
+// LatestFeeSample returns the most recent sample, or nil if none exist
+func (s *Store) LatestFeeSample() (*FeeSample, error) {
+	row := s.db.QueryRow(`SELECT sampled_at, fee_rate_2, fee_rate_6, fee_rate_12, mempool_tx, mempool_bytes, mempool_min_fee
+		FROM fee_samples ORDER BY sampled_at DESC LIMIT 1`)
+	sample, err := scanFeeSample(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sample, err
+}
+
+// PruneFeeSamples deletes samples taken before cutoff (unix seconds)
+func (s *Store) PruneFeeSamples(cutoff int64) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM fee_samples WHERE sampled_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func scanFeeSample(row interface{ Scan(...interface{}) error }) (*FeeSample, error) {
+	var sample FeeSample
+	var fee2, fee6, fee12 sql.NullFloat64
+	if err := row.Scan(&sample.SampledAt, &fee2, &fee6, &fee12,
+		&sample.MempoolTx, &sample.MempoolBytes, &sample.MempoolMinFee); err != nil {
+		return nil, err
+	}
+	sample.FeeRate2 = nullFloatPtr(fee2)
+	sample.FeeRate6 = nullFloatPtr(fee6)
+	sample.FeeRate12 = nullFloatPtr(fee12)
+	return &sample, nil
+}
+
+func nullFloatPtr(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+// sampleFees queries the node for current fee estimates and mempool stats
+func (ws *WalletServer) sampleFees() (*FeeSample, error) {
+	mempool, err := ws.rpcClient.GetMempoolInfo()
+	if err != nil {
+		return nil, fmt.Errorf("getmempoolinfo failed: %w", err)
+	}
+
+	sample := &FeeSample{
+		SampledAt:     time.Now().Unix(),
+		MempoolTx:     mempool.Size,
+		MempoolBytes:  mempool.Bytes,
+		MempoolMinFee: mempool.MinFeeRate,
+	}
+
+	targets := []struct {
+		blocks int
+		dest   **float64
+	}{
+		{2, &sample.FeeRate2},
+		{6, &sample.FeeRate6},
+		{12, &sample.FeeRate12},
+	}
+	for _, target := range targets {
+		rate, err := ws.rpcClient.EstimateSmartFee(target.blocks)
+		if err != nil {
+			return nil, fmt.Errorf("estimatesmartfee(%d) failed: %w", target.blocks, err)
+		}
+		if rate > 0 {
+			*target.dest = &rate
+		}
+	}
+
+	return sample, nil
+}
+
+// RunFeeSampler records a fee sample every interval and prunes old samples.
+// It never returns.
+func (ws *WalletServer) RunFeeSampler(interval time.Duration) {
+	log.Printf("[FEES] Sampling fee estimates every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sample, err := ws.sampleFees()
+		if err != nil {
+			log.Printf("[FEES] WARNING: Fee sample failed: %v", err)
+		} else if err := ws.store.InsertFeeSample(*sample); err != nil {
+			log.Printf("[FEES] WARNING: Failed to store fee sample: %v", err)
+		}
+
+		cutoff := time.Now().Add(-feeHistoryRetention).Unix()
+		if pruned, err := ws.store.PruneFeeSamples(cutoff); err != nil {
+			log.Printf("[FEES] WARNING: Failed to prune fee samples: %v", err)
+		} else if pruned > 0 {
+			log.Printf("[FEES] Pruned %d old fee samples", pruned)
+		}
+
+		<-ticker.C
+	}
+}
+
+// feeTrend compares the average 6-block fee rate of the older and newer
+// halves of the samples: "falling", "rising", "stable" or "unknown"
+func feeTrend(samples []FeeSample) string {
+	rates := []float64{}
+	for _, sample := range samples {
+		if sample.FeeRate6 != nil {
+			rates = append(rates, *sample.FeeRate6)
+		}
+	}
+	if len(rates) < 2 {
+		return "unknown"
+	}
+
+	half := len(rates) / 2
+	older, newer := 0.0, 0.0
+	for _, rate := range rates[:half] {
+		older += rate
+	}
+	for _, rate := range rates[half:] {
+		newer += rate
+	}
+	older /= float64(half)
+	newer /= float64(len(rates) - half)
+
+	switch {
+	case newer < older*0.9:
+		return "falling"
+	case newer > older*1.1:
+		return "rising"
+	default:
+		return "stable"
+	}
+}
+
+// HandleFeeHistory returns sampled fee estimates and mempool stats
+func (ws *WalletServer) HandleFeeHistory(w http.ResponseWriter, r *http.Request) {
+	// Get hours from query parameters, default to 24, capped at the retention window
+	hours := 24
+	if hoursStr := r.URL.Query().Get("hours"); hoursStr != "" {
+		if h, err := strconv.Atoi(hoursStr); err == nil && h > 0 {
+			hours = h
+		}
+	}
+	if maxHours := int(feeHistoryRetention / time.Hour); hours > maxHours {
+		hours = maxHours
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour).Unix()
+	samples, err := ws.store.FeeSamplesSince(since)
+	if err != nil {
+		logRequest(r, "[API] FeeHistory ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(FeeHistoryResponse{
+			Success: false,
+			Error:   "Failed to load fee history",
+		})
+		return
+	}
+
+	logRequest(r, "[API] FeeHistory SUCCESS: %d samples over %d hours", len(samples), hours)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FeeHistoryResponse{
+		Success: true,
+		Samples: samples,
+		Trend:   feeTrend(samples),
+	})
+}
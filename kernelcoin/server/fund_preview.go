@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/btcsuite/btcd/txscript"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// maxDraftOutputs bounds the outputs of one fund preview
+const maxDraftOutputs = 100
+
+// DraftOutput is a payment of a draft transaction
+type DraftOutput struct {
+	Address string     `json:"address"`
+	Amount  rpc.Amount `json:"amount"`
+}
+
+type FundPreviewRequest struct {
+	Outputs []DraftOutput `json:"outputs"`
+	// Inputs, Replaceable, FeePreset and ChangeAddress are as for a send
+	Inputs        []rpc.Outpoint `json:"inputs,omitempty"`
+	Replaceable   bool           `json:"replaceable,omitempty"`
+	FeePreset     string         `json:"fee_preset,omitempty"`
+	ChangeAddress string         `json:"change_address,omitempty"`
+}
+
+// FundedInput is a coin the node chose, or was given, to fund a draft.
+// Address and Amount are absent for a coin the wallet doesn't list, such as
+// a locked one.
+type FundedInput struct {
+	Txid          string     `json:"txid"`
+	Vout          int        `json:"vout"`
+	Address       string     `json:"address,omitempty"`
+	Amount        rpc.Amount `json:"amount,omitempty"`
+	Confirmations int        `json:"confirmations"`
+}
+
+// FundedOutput is an output of a funded draft. Change is the one the node
+// added; Data marks an OP_RETURN output, which has no address.
+type FundedOutput struct {
+	Address string     `json:"address,omitempty"`
+	Amount  rpc.Amount `json:"amount"`
+	Change  bool       `json:"change,omitempty"`
+	Data    bool       `json:"data,omitempty"`
+}
+
+type FundPreviewResponse struct {
+	Success bool           `json:"success"`
+	Inputs  []FundedInput  `json:"inputs,omitempty"`
+	Outputs []FundedOutput `json:"outputs,omitempty"`
+	Change  rpc.Amount     `json:"change"`
+	Fee     rpc.Amount     `json:"fee"`
+	// VSize and FeeRate are as in the send preview
+	VSize   int64   `json:"vsize,omitempty"`
+	FeeRate float64 `json:"fee_rate,omitempty"`
+	Error   string  `json:"error,omitempty"`
+	Code    string  `json:"code,omitempty"`
+}
+
+// HandleFundPreview has the node fund a draft paying outputs, as a send
+// would, and reports the coins it selected, the change and the fee. Nothing
+// is signed or broadcast and no coins are locked, so two previews may pick
+// the same coins.
+func (ws *WalletServer) HandleFundPreview(w http.ResponseWriter, r *http.Request) {
+	var req FundPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] FundPreview ERROR: Invalid request - %v", err)
+		response := FundPreviewResponse{Success: false, Error: "Invalid request format"}
+		if refused := amountError(err); refused != nil {
+			response.Error, response.Code = refused.Message, refused.Code
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if refused := refuseDraft(r, ws.rpc(r), req); refused != nil {
+		logRequest(r, "[API] FundPreview ERROR: %s", refused.Message)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(FundPreviewResponse{
+			Success: false,
+			Error:   refused.Message,
+			Code:    refused.Code,
+		})
+		return
+	}
+
+	outputs := []map[string]interface{}{}
+	for _, out := range req.Outputs {
+		outputs = append(outputs, map[string]interface{}{out.Address: out.Amount.Number()})
+	}
+	funded, err := ws.fundDraft(ws.rpc(r), outputs, SendTransactionRequest{
+		Inputs:        req.Inputs,
+		Replaceable:   req.Replaceable,
+		FeePreset:     req.FeePreset,
+		ChangeAddress: req.ChangeAddress,
+	})
+	if err != nil {
+		logRequest(r, "[API] FundPreview ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(FundPreviewResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Cannot build transaction: %v", err),
+		})
+		return
+	}
+
+	tx, err := decodeDraft(funded.Hex)
+	var coins map[rpc.Outpoint]rpc.UnspentOutput
+	if err == nil {
+		coins, err = walletCoins(ws.rpc(r))
+	}
+	if err != nil {
+		logRequest(r, "[API] FundPreview ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(FundPreviewResponse{
+			Success: false,
+			Error:   "Failed to read the funded transaction",
+		})
+		return
+	}
+
+	response := FundPreviewResponse{Success: true, Fee: funded.Fee, Inputs: []FundedInput{}, Outputs: []FundedOutput{}}
+	for _, in := range tx.TxIn {
+		outpoint := rpc.Outpoint{Txid: in.PreviousOutPoint.Hash.String(), Vout: int(in.PreviousOutPoint.Index)}
+		coin := coins[outpoint]
+		response.Inputs = append(response.Inputs, FundedInput{
+			Txid:          outpoint.Txid,
+			Vout:          outpoint.Vout,
+			Address:       coin.Address,
+			Amount:        coin.Amount,
+			Confirmations: coin.Confirmations,
+		})
+	}
+	for i, out := range tx.TxOut {
+		output := FundedOutput{Amount: rpc.Amount(out.Value), Change: i == funded.ChangePos}
+		if txscript.GetScriptClass(out.PkScript) == txscript.NullDataTy {
+			output.Data = true
+		} else if _, addrs, _, err := txscript.ExtractPkScriptAddrs(out.PkScript, hdwallet.Params()); err == nil && len(addrs) == 1 {
+			output.Address = addrs[0].EncodeAddress()
+		}
+		if output.Change {
+			response.Change = output.Amount
+		}
+		response.Outputs = append(response.Outputs, output)
+	}
+	if size := sizeDraft(tx, coins); size.VSize > 0 {
+		response.VSize = size.VSize
+		response.FeeRate = math.Round(float64(funded.Fee)/float64(size.VSize)*1000) / 1000
+	}
+
+	logRequest(r, "[API] FundPreview SUCCESS: %d inputs, %d outputs, fee %s", len(response.Inputs), len(response.Outputs), funded.Fee)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// refuseDraft runs the send checks that apply to a fund preview: the
+// outputs' addresses and amounts, the fee preset and the change address
+func refuseDraft(r *http.Request, client rpc.WalletBackend, req FundPreviewRequest) *sendError {
+	if len(req.Outputs) == 0 || len(req.Outputs) > maxDraftOutputs {
+		return &sendError{ErrInvalidRequest, fmt.Sprintf("A draft needs between 1 and %d outputs", maxDraftOutputs)}
+	}
+	seen := map[string]bool{}
+	for _, out := range req.Outputs {
+		if seen[out.Address] {
+			return &sendError{ErrInvalidRequest, fmt.Sprintf("Address %s is paid twice", out.Address)}
+		}
+		seen[out.Address] = true
+		if valid, err := client.ValidateAddress(out.Address); err != nil || !valid {
+			return &sendError{ErrInvalidAddress, fmt.Sprintf("Invalid address %s", out.Address)}
+		}
+		if refused := checkSendAmount(out.Amount); refused != nil {
+			return refused
+		}
+	}
+	if seen[req.ChangeAddress] {
+		return &sendError{ErrInvalidAddress, "Change address is the recipient address"}
+	}
+	if refused := checkFeePreset(req.FeePreset); refused != nil {
+		return refused
+	}
+	refused, err := checkChangeAddress(client, SendTransactionRequest{ChangeAddress: req.ChangeAddress})
+	if err != nil {
+		logRequest(r, "[API] WARNING: change address precheck skipped: %v", err)
+	}
+	return refused
+}
@@ -0,0 +1,848 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxGraphQLQuery bounds the query text, which is parsed before anything
+// else looks at it
+const maxGraphQLQuery = 64 << 10
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse is shaped as the GraphQL spec has it rather than like
+// the other endpoints, so GraphQL clients can read it
+type GraphQLResponse struct {
+	Data   *graphQLObject `json:"data,omitempty"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"` // response keys and list indexes
+}
+
+// TransactionPage is what the transactions query returns
+type TransactionPage struct {
+	Items      []TransactionResponse `json:"items"` // newest last, as in /api/transactions
+	Pagination Pagination            `json:"pagination"`
+}
+
+// graphQLQueryField is a field of the root query type. Its value is
+// resolved by resolve, then narrowed to the selected subfields by matching
+// them against the JSON names of its Go type, so every type has the fields
+// its REST counterpart has.
+type graphQLQueryField struct {
+	args    []string
+	resolve func(ws *WalletServer, r *http.Request, args url.Values, sel []*graphQLField) (interface{}, error)
+}
+
+var graphQLQuery = map[string]graphQLQueryField{
+	"balance": {
+		resolve: (*WalletServer).resolveGraphQLBalance,
+	},
+	"transactions": {
+		args:    []string{"count", "skip", "page", "address", "category", "from_time", "to_time", "min_amount"},
+		resolve: (*WalletServer).resolveGraphQLTransactions,
+	},
+	"transaction": {
+		args:    []string{"txid"},
+		resolve: (*WalletServer).resolveGraphQLTransaction,
+	},
+	"addresses": {
+		resolve: (*WalletServer).resolveGraphQLAddresses,
+	},
+	"address": {
+		args:    []string{"address"},
+		resolve: (*WalletServer).resolveGraphQLAddress,
+	},
+}
+
+// HandleGraphQL answers GraphQL queries over the balance, transactions and
+// addresses, so a client can fetch exactly the fields it shows in one
+// request. Queries come as POST {"query", "variables", "operationName"}
+// or GET ?query=&variables=. Only queries are served: no mutations,
+// fragments or directives.
+func (ws *WalletServer) HandleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			decoder := json.NewDecoder(strings.NewReader(v))
+			decoder.UseNumber()
+			if err := decoder.Decode(&req.Variables); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	case http.MethodPost:
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLQuery))
+		decoder.UseNumber()
+		if err := decoder.Decode(&req); err != nil {
+			writeGraphQLError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	if req.Query == "" || len(req.Query) > maxGraphQLQuery {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Sprintf("query is required, up to %d bytes", maxGraphQLQuery))
+		return
+	}
+
+	op, err := parseGraphQL(req.Query, req.OperationName)
+	if err == nil {
+		err = op.bind(req.Variables)
+	}
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var exec graphQLExecutor
+	data := &graphQLObject{}
+	for _, f := range op.sel {
+		if f.name == "__typename" {
+			data.set(f.key(), "Query")
+			continue
+		}
+		field := graphQLQuery[f.name]
+		args, err := f.values(field.args)
+		if err != nil {
+			exec.fail(err.Error(), []interface{}{f.key()})
+			data.set(f.key(), nil)
+			continue
+		}
+		value, err := field.resolve(ws, r, args, f.sel)
+		if err != nil {
+			exec.fail(err.Error(), []interface{}{f.key()})
+			data.set(f.key(), nil)
+			continue
+		}
+		data.set(f.key(), exec.value(reflect.ValueOf(value), f, []interface{}{f.key()}))
+	}
+
+	logRequest(r, "[API] GraphQL SUCCESS: %d fields, %d errors", len(op.sel), len(exec.errors))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GraphQLResponse{Data: data, Errors: exec.errors})
+}
+
+// writeGraphQLError answers a request that could not be run at all
+func writeGraphQLError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(GraphQLResponse{Errors: []GraphQLError{{Message: message}}})
+}
+
+func (ws *WalletServer) resolveGraphQLBalance(r *http.Request, args url.Values, sel []*graphQLField) (interface{}, error) {
+	balanceInfo, err := ws.rpc(r).GetBalanceInfo("")
+	if err != nil {
+		logRequest(r, "[API] GraphQL balance ERROR: %v", err)
+		return nil, fmt.Errorf("Failed to get balance")
+	}
+	response := balanceResponse(balanceInfo)
+	if graphQLSelects(sel, "fiat_value") {
+		response.FiatValue = ws.fiatQuote(r).Value(response.Total)
+	}
+	return response, nil
+}
+
+func (ws *WalletServer) resolveGraphQLTransactions(r *http.Request, args url.Values, sel []*graphQLField) (interface{}, error) {
+	page := pageParamsFromValues(args)
+	filter, err := transactionFilterFromValues(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []TransactionResponse
+	var total int
+	var hasMore bool
+	if filter.Active() || ws.txSync.Ready() {
+		transactions, total, err = ws.filteredTransactions(ws.rpc(r), filter, page)
+		hasMore = page.Skip+len(transactions) < total
+	} else {
+		transactions, total, hasMore, err = ws.transactionPage(ws.rpc(r), page)
+	}
+	if err != nil {
+		logRequest(r, "[API] GraphQL transactions ERROR: %v", err)
+		return nil, fmt.Errorf("Failed to list transactions")
+	}
+	ws.completeGraphQLTransactions(r, transactions, graphQLSelects(sel, "items", "fiat_value"))
+
+	return TransactionPage{
+		Items: transactions,
+		Pagination: Pagination{
+			Count:   page.Count,
+			Skip:    page.Skip,
+			Page:    page.Page,
+			Total:   total,
+			HasMore: hasMore,
+		},
+	}, nil
+}
+
+// resolveGraphQLTransaction lists the wallet entries of one transaction,
+// read from gettransaction's details
+func (ws *WalletServer) resolveGraphQLTransaction(r *http.Request, args url.Values, sel []*graphQLField) (interface{}, error) {
+	txid := args.Get("txid")
+	if len(txid) != 64 {
+		return nil, fmt.Errorf("txid must be 64 hex characters")
+	}
+	tx, err := ws.rpc(r).GetTransaction(txid)
+	if err != nil {
+		return nil, fmt.Errorf("Transaction not found in the wallet")
+	}
+
+	transactions := []TransactionResponse{}
+	details, _ := tx["details"].([]interface{})
+	for _, d := range details {
+		detail, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := map[string]interface{}{}
+		for k, v := range tx {
+			if k != "amount" && k != "fee" && k != "details" && k != "hex" {
+				entry[k] = v
+			}
+		}
+		for k, v := range detail {
+			entry[k] = v
+		}
+		transactions = append(transactions, transactionFromRPC(entry))
+	}
+	ws.completeGraphQLTransactions(r, transactions, graphQLSelects(sel, "fiat_value"))
+	return transactions, nil
+}
+
+// completeGraphQLTransactions fills in what /api/transactions adds to
+// listtransactions entries
+func (ws *WalletServer) completeGraphQLTransactions(r *http.Request, transactions []TransactionResponse, fiat bool) {
+	setDirections(transactions)
+	owner := walletOwner(r)
+	ws.setStatuses(owner, transactions)
+	ws.resolveContacts(owner, transactions)
+	ws.resolveMetadata(owner, transactions)
+	if fiat {
+		addFiatValues(transactions, ws.fiatQuote(r))
+	}
+}
+
+func (ws *WalletServer) resolveGraphQLAddresses(r *http.Request, args url.Values, sel []*graphQLField) (interface{}, error) {
+	addrs, err := ws.rpc(r).GetAddressesByLabel("")
+	if err != nil {
+		logRequest(r, "[API] GraphQL addresses ERROR: %v", err)
+		return nil, fmt.Errorf("Failed to get addresses")
+	}
+	addresses := []AddressInfo{}
+	for _, addr := range addrs {
+		addresses = append(addresses, AddressInfo{Address: addr, Type: "Address"})
+	}
+	return addresses, nil
+}
+
+func (ws *WalletServer) resolveGraphQLAddress(r *http.Request, args url.Values, sel []*graphQLField) (interface{}, error) {
+	address := strings.TrimSpace(args.Get("address"))
+	rpc := ws.rpc(r)
+	if valid, err := rpc.ValidateAddress(address); err != nil || !valid {
+		return nil, fmt.Errorf("Invalid address")
+	}
+	info, err := rpc.GetAddressInfo(address)
+	if err != nil {
+		logRequest(r, "[API] GraphQL address ERROR: %v", err)
+		return nil, fmt.Errorf("Failed to get address info")
+	}
+	return info, nil
+}
+
+// graphQLSelects reports whether sel selects the field at path, so
+// resolvers can skip work nobody asked for
+func graphQLSelects(sel []*graphQLField, path ...string) bool {
+	for _, f := range sel {
+		if f.name == path[0] && (len(path) == 1 || graphQLSelects(f.sel, path[1:]...)) {
+			return true
+		}
+	}
+	return false
+}
+
+// graphQLExecutor narrows resolved values to the selected fields and
+// collects field errors, which null the field and leave the rest
+type graphQLExecutor struct {
+	errors []GraphQLError
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func (e *graphQLExecutor) fail(message string, path []interface{}) {
+	e.errors = append(e.errors, GraphQLError{Message: message, Path: path})
+}
+
+// value is v as field f selects it: scalars as they are, lists element by
+// element and objects by the JSON names of their fields
+func (e *graphQLExecutor) value(v reflect.Value, f *graphQLField, path []interface{}) interface{} {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	isObject := v.Kind() == reflect.Struct && !v.Type().Implements(jsonMarshalerType)
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = e.value(v.Index(i), f, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case !isObject:
+		if f.sel != nil {
+			e.fail(fmt.Sprintf("Field %q must not have a selection since it has no subfields", f.name), path)
+			return nil
+		}
+		return v.Interface()
+	case f.sel == nil:
+		e.fail(fmt.Sprintf("Field %q of type %s must have a selection of subfields", f.name, v.Type().Name()), path)
+		return nil
+	}
+
+	object := &graphQLObject{}
+	for _, sub := range f.sel {
+		subPath := append(path[:len(path):len(path)], sub.key())
+		if sub.name == "__typename" {
+			object.set(sub.key(), v.Type().Name())
+			continue
+		}
+		if len(sub.args) > 0 {
+			e.fail(fmt.Sprintf("Field %q takes no arguments", sub.name), subPath)
+			object.set(sub.key(), nil)
+			continue
+		}
+		index, ok := jsonFieldIndex(v.Type(), sub.name)
+		if !ok {
+			e.fail(fmt.Sprintf("Cannot query field %q on type %s", sub.name, v.Type().Name()), subPath)
+			object.set(sub.key(), nil)
+			continue
+		}
+		fv, err := v.FieldByIndexErr(index)
+		if err != nil {
+			// Inside an embedded struct that is nil
+			object.set(sub.key(), nil)
+			continue
+		}
+		object.set(sub.key(), e.value(fv, sub, subPath))
+	}
+	return object
+}
+
+// jsonFieldIndex finds the field of t, or of a struct embedded in it, that
+// encodes to JSON as name
+func jsonFieldIndex(t reflect.Type, name string) ([]int, bool) {
+	for _, sf := range reflect.VisibleFields(t) {
+		if sf.Anonymous || !sf.IsExported() {
+			continue
+		}
+		tagName, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if tagName == "-" {
+			continue
+		}
+		if tagName == "" {
+			tagName = sf.Name
+		}
+		if tagName == name {
+			return sf.Index, true
+		}
+	}
+	return nil, false
+}
+
+// graphQLObject is a JSON object that keeps its keys in the order the
+// query asked for them
+type graphQLObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *graphQLObject) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *graphQLObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// graphQLField is one field of a selection set
+type graphQLField struct {
+	alias, name string
+	args        map[string]interface{}
+	sel         []*graphQLField
+}
+
+// graphQLVariable is a $name in an argument, until bind replaces it
+type graphQLVariable string
+
+// key is the field's name in the response
+func (f *graphQLField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// values turns the field's arguments into the query parameters the REST
+// endpoints take, so both share their parsing and validation. Lists
+// become comma separated.
+func (f *graphQLField) values(allowed []string) (url.Values, error) {
+	values := url.Values{}
+	for name, arg := range f.args {
+		known := false
+		for _, a := range allowed {
+			known = known || a == name
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown argument %q on field %q", name, f.name)
+		}
+
+		items, ok := arg.([]interface{})
+		if !ok {
+			items = []interface{}{arg}
+		}
+		var parts []string
+		for _, item := range items {
+			switch item := item.(type) {
+			case nil:
+			case string:
+				parts = append(parts, item)
+			case json.Number:
+				parts = append(parts, item.String())
+			case bool:
+				parts = append(parts, strconv.FormatBool(item))
+			default:
+				return nil, fmt.Errorf("Argument %q must be a string, number, boolean or a list of them", name)
+			}
+		}
+		if len(parts) > 0 {
+			values.Set(name, strings.Join(parts, ","))
+		}
+	}
+	return values, nil
+}
+
+type graphQLVariableDef struct {
+	name     string
+	required bool // a non-null type without a default
+	def      interface{}
+}
+
+type graphQLOperation struct {
+	vars []graphQLVariableDef
+	sel  []*graphQLField
+}
+
+// bind replaces the operation's variables with their values and checks
+// its root fields exist
+func (op *graphQLOperation) bind(variables map[string]interface{}) error {
+	values := map[string]interface{}{}
+	for _, def := range op.vars {
+		v, ok := variables[def.name]
+		if !ok {
+			v = def.def
+		}
+		if v == nil && def.required {
+			return fmt.Errorf("Variable $%s is required", def.name)
+		}
+		values[def.name] = v
+	}
+
+	var substitute func(v interface{}) (interface{}, error)
+	substitute = func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case graphQLVariable:
+			value, ok := values[string(v)]
+			if !ok {
+				return nil, fmt.Errorf("Variable $%s is not defined", v)
+			}
+			return value, nil
+		case []interface{}:
+			list := make([]interface{}, len(v))
+			for i, item := range v {
+				var err error
+				if list[i], err = substitute(item); err != nil {
+					return nil, err
+				}
+			}
+			return list, nil
+		}
+		return v, nil
+	}
+	var walk func(sel []*graphQLField) error
+	walk = func(sel []*graphQLField) error {
+		for _, f := range sel {
+			for name, arg := range f.args {
+				v, err := substitute(arg)
+				if err != nil {
+					return err
+				}
+				f.args[name] = v
+			}
+			if err := walk(f.sel); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(op.sel); err != nil {
+		return err
+	}
+
+	for _, f := range op.sel {
+		if _, ok := graphQLQuery[f.name]; !ok && f.name != "__typename" {
+			return fmt.Errorf("Cannot query field %q on type Query", f.name)
+		}
+	}
+	return nil
+}
+
+// graphQLParser reads the part of the GraphQL query language the endpoint
+// serves: operations with variables, fields, aliases and arguments
+type graphQLParser struct {
+	src string
+	pos int
+}
+
+// parseGraphQL parses src and returns the operation named name, or its
+// only operation when name is empty
+func parseGraphQL(src, name string) (*graphQLOperation, error) {
+	p := &graphQLParser{src: src}
+	var found *graphQLOperation
+	count := 0
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			break
+		}
+		opName, op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		count++
+		if name == "" || opName == name {
+			found = op
+		}
+	}
+	switch {
+	case count == 0:
+		return nil, fmt.Errorf("The query has no operation")
+	case name == "" && count > 1:
+		return nil, fmt.Errorf("operationName is required when the query has several operations")
+	case found == nil:
+		return nil, fmt.Errorf("Unknown operation %q", name)
+	}
+	return found, nil
+}
+
+func (p *graphQLParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	column := p.pos - strings.LastIndex(p.src[:p.pos], "\n")
+	return fmt.Errorf("Syntax error at line %d, column %d: %s", line, column, fmt.Sprintf(format, args...))
+}
+
+// skip passes whitespace, commas and comments
+func (p *graphQLParser) skip() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// peek is the next character, or 0 at the end
+func (p *graphQLParser) peek() byte {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *graphQLParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *graphQLParser) name() (string, error) {
+	if !isNameStart(p.peek()) {
+		return "", p.errorf("expected a name")
+	}
+	start := p.pos
+	for p.pos < len(p.src) && (isNameStart(p.src[p.pos]) || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *graphQLParser) operation() (string, *graphQLOperation, error) {
+	op := &graphQLOperation{}
+	var name string
+	if p.peek() != '{' {
+		kind, err := p.name()
+		if err != nil {
+			return "", nil, err
+		}
+		switch kind {
+		case "query":
+		case "mutation", "subscription":
+			return "", nil, fmt.Errorf("Only queries are supported; use the REST endpoints to make changes")
+		case "fragment":
+			return "", nil, fmt.Errorf("Fragments are not supported")
+		default:
+			return "", nil, p.errorf("unexpected %q", kind)
+		}
+		if isNameStart(p.peek()) {
+			if name, err = p.name(); err != nil {
+				return "", nil, err
+			}
+		}
+		if p.peek() == '(' {
+			if op.vars, err = p.variableDefs(); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	var err error
+	op.sel, err = p.selectionSet()
+	return name, op, err
+}
+
+func (p *graphQLParser) variableDefs() ([]graphQLVariableDef, error) {
+	p.pos++ // (
+	var defs []graphQLVariableDef
+	for p.peek() != ')' {
+		if err := p.expect('$'); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		// Types are only checked where the value is used
+		depth := 0
+		for p.peek() == '[' {
+			p.pos++
+			depth++
+		}
+		if _, err := p.name(); err != nil {
+			return nil, err
+		}
+		for ; depth > 0; depth-- {
+			if p.peek() == '!' {
+				p.pos++
+			}
+			if err := p.expect(']'); err != nil {
+				return nil, err
+			}
+		}
+		def := graphQLVariableDef{name: name}
+		if p.peek() == '!' {
+			p.pos++
+			def.required = true
+		}
+		if p.peek() == '=' {
+			p.pos++
+			if def.def, err = p.value(true); err != nil {
+				return nil, err
+			}
+			def.required = false
+		}
+		defs = append(defs, def)
+	}
+	p.pos++ // )
+	return defs, nil
+}
+
+func (p *graphQLParser) selectionSet() ([]*graphQLField, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var fields []*graphQLField
+	for p.peek() != '}' {
+		switch c := p.peek(); {
+		case c == 0:
+			return nil, p.errorf("unclosed selection set")
+		case c == '.':
+			return nil, fmt.Errorf("Fragments are not supported")
+		case c == '@':
+			return nil, fmt.Errorf("Directives are not supported")
+		}
+		f := &graphQLField{}
+		var err error
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if p.peek() == ':' {
+			p.pos++
+			f.alias = f.name
+			if f.name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.peek() == '(' {
+			p.pos++
+			f.args = map[string]interface{}{}
+			for p.peek() != ')' {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(':'); err != nil {
+					return nil, err
+				}
+				if f.args[name], err = p.value(false); err != nil {
+					return nil, err
+				}
+			}
+			p.pos++ // )
+		}
+		if p.peek() == '@' {
+			return nil, fmt.Errorf("Directives are not supported")
+		}
+		if p.peek() == '{' {
+			if f.sel, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, f)
+	}
+	p.pos++ // }
+	if len(fields) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return fields, nil
+}
+
+// value reads an argument value: a variable (unless constant), number,
+// string, boolean, null, enum value (read as a string) or list
+func (p *graphQLParser) value(constant bool) (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '$' && !constant:
+		p.pos++
+		name, err := p.name()
+		return graphQLVariable(name), err
+	case c == '"':
+		start := p.pos
+		for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '"'; p.pos++ {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			} else if p.src[p.pos] == '\n' {
+				break
+			}
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != '"' {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos++
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			return nil, p.errorf("invalid string")
+		}
+		return s, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		n := json.Number(p.src[start:p.pos])
+		if _, err := n.Float64(); err != nil {
+			return nil, p.errorf("invalid number %q", n)
+		}
+		return n, nil
+	case c == '[':
+		p.pos++
+		list := []interface{}{}
+		for p.peek() != ']' {
+			if p.peek() == 0 {
+				return nil, p.errorf("unclosed list")
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		p.pos++
+		return list, nil
+	case c == '{':
+		return nil, p.errorf("input objects are not supported")
+	case isNameStart(c):
+		name, _ := p.name()
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return name, nil
+	}
+	return nil, p.errorf("expected a value")
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// englishMessages lists every message the API translates, each mapped to
+// itself: the template for a new catalog. Add a message here when a
+// handler gains one.
+//
+//go:embed locales/en.json
+var englishMessages []byte
+
+// catalogFile is a message catalog as translators write it:
+//
+//	{"language": "de", "messages": {"Failed to bump fee: %v": "Gebühr nicht erhöht: %v"}}
+//
+// Keys are the English messages as the server formats them, whose verbs
+// (%v, %s, %d, %q...) stand for the text filled in. A translation repeats
+// the verbs, in order or by index (%[2]v), and each is replaced by that
+// text as it is, translated too if it is a message itself.
+type catalogFile struct {
+	Language string            `json:"language"`
+	Messages map[string]string `json:"messages"`
+}
+
+// formatVerb matches a printf verb, with an optional explicit index
+var formatVerb = regexp.MustCompile(`%(?:\[(\d+)\])?[-+# 0]*\d*(?:\.\d+)?[a-zA-Z%]`)
+
+// messageCatalog translates API messages into one language. A nil
+// catalog leaves them in English.
+type messageCatalog struct {
+	language string
+	exact    map[string]string // messages without verbs
+	patterns []messagePattern  // the rest, most literal text first
+}
+
+type messagePattern struct {
+	match       *regexp.Regexp
+	literal     int
+	translation string
+}
+
+// compileCatalog turns each key of file into a pattern matching the
+// messages it formats, refusing translations that use verbs their key
+// doesn't have
+func compileCatalog(file catalogFile) (*messageCatalog, error) {
+	c := &messageCatalog{language: file.Language, exact: map[string]string{}}
+	for key, translation := range file.Messages {
+		var pattern strings.Builder
+		verbs, literal, last := 0, 0, 0
+		for _, loc := range formatVerb.FindAllStringIndex(key, -1) {
+			text := key[last:loc[0]]
+			if key[loc[1]-1] == '%' {
+				text += "%"
+			}
+			pattern.WriteString(regexp.QuoteMeta(text))
+			literal += len(text)
+			if key[loc[1]-1] != '%' {
+				pattern.WriteString("(.*?)")
+				verbs++
+			}
+			last = loc[1]
+		}
+		pattern.WriteString(regexp.QuoteMeta(key[last:]))
+		literal += len(key) - last
+
+		if _, err := fillVerbs(translation, make([]string, verbs)); err != nil {
+			return nil, fmt.Errorf("%q: %w", key, err)
+		}
+		if verbs == 0 {
+			english, _ := fillVerbs(key, nil)
+			c.exact[english], _ = fillVerbs(translation, nil)
+			continue
+		}
+		c.patterns = append(c.patterns, messagePattern{
+			match:       regexp.MustCompile("(?s)^" + pattern.String() + "$"),
+			literal:     literal,
+			translation: translation,
+		})
+	}
+	sort.Slice(c.patterns, func(i, j int) bool {
+		return c.patterns[i].literal > c.patterns[j].literal
+	})
+	return c, nil
+}
+
+// fillVerbs replaces the verbs of format with args, the way fmt indexes
+// them, but taking each arg as text
+func fillVerbs(format string, args []string) (string, error) {
+	var err error
+	next := 0
+	filled := formatVerb.ReplaceAllStringFunc(format, func(verb string) string {
+		if strings.HasSuffix(verb, "%") {
+			return "%"
+		}
+		i := next
+		if m := formatVerb.FindStringSubmatch(verb); m[1] != "" {
+			i, _ = strconv.Atoi(m[1])
+			i--
+		}
+		next = i + 1
+		if i < 0 || i >= len(args) {
+			err = fmt.Errorf("%s has no matching verb in the English message", verb)
+			return verb
+		}
+		return args[i]
+	})
+	return filled, err
+}
+
+// Language is the tag of the catalog's language, for Content-Language
+func (c *messageCatalog) Language() string {
+	if c == nil {
+		return "en"
+	}
+	return c.language
+}
+
+// translate returns message in the catalog's language, or as it is if
+// the catalog doesn't have it
+func (c *messageCatalog) translate(message string) string {
+	if c == nil || message == "" {
+		return message
+	}
+	if translation, ok := c.exact[message]; ok {
+		return translation
+	}
+	for _, p := range c.patterns {
+		args := p.match.FindStringSubmatch(message)
+		if args == nil {
+			continue
+		}
+		args = args[1:]
+		for i := range args {
+			args[i] = c.translate(args[i])
+		}
+		translation, _ := fillVerbs(p.translation, args)
+		return translation
+	}
+	return message
+}
+
+// messageCatalogs are the languages the API answers in, by lowercase tag.
+// English is always there; a nil set answers in English only.
+type messageCatalogs struct {
+	byTag map[string]*messageCatalog
+}
+
+// loadMessageCatalogs reads the catalogs in dir (every *.json), beside the
+// built-in English. An en.json in dir rewords the English messages.
+func loadMessageCatalogs(dir string) (*messageCatalogs, error) {
+	var english catalogFile
+	if err := json.Unmarshal(englishMessages, &english); err != nil {
+		return nil, fmt.Errorf("built-in English messages: %w", err)
+	}
+	m := &messageCatalogs{byTag: map[string]*messageCatalog{"en": {language: "en"}}}
+	if dir == "" {
+		return m, nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("messages_dir: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	loaded := map[string]string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var file catalogFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tag := strings.ToLower(file.Language)
+		if tag == "" {
+			return nil, fmt.Errorf("%s: language is not set", path)
+		}
+		if other, ok := loaded[tag]; ok {
+			return nil, fmt.Errorf("%s and %s are both %s catalogs", other, path, file.Language)
+		}
+		catalog, err := compileCatalog(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		loaded[tag] = path
+		m.byTag[tag] = catalog
+
+		stale := 0
+		for key := range file.Messages {
+			if _, ok := english.Messages[key]; !ok {
+				stale++
+			}
+		}
+		log.Printf("[INIT] Messages: %s from %s, %d of %d translated", file.Language, path, len(file.Messages)-stale, len(english.Messages))
+		if stale > 0 {
+			log.Printf("[INIT] WARNING: %s has %d messages the server doesn't send; they are kept, but check them against the English", path, stale)
+		}
+	}
+	return m, nil
+}
+
+// negotiate picks the catalog for an Accept-Language header: that of the
+// most preferred language there is one for, by full tag (pt-BR) or
+// primary subtag (pt), else English
+func (m *messageCatalogs) negotiate(acceptLanguage string) *messageCatalog {
+	if m == nil {
+		return nil
+	}
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if tag != "" && q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if t.tag == "*" {
+			break
+		}
+		if c, ok := m.byTag[t.tag]; ok {
+			return c
+		}
+		primary, _, _ := strings.Cut(t.tag, "-")
+		if c, ok := m.byTag[primary]; ok {
+			return c
+		}
+	}
+	return m.byTag["en"]
+}
+
+// forRequest negotiates the catalog for r and labels the response with its
+// language. Call it before writing the header.
+func (m *messageCatalogs) forRequest(w http.ResponseWriter, r *http.Request) *messageCatalog {
+	if m == nil {
+		return nil
+	}
+	catalog := m.negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", catalog.Language())
+	w.Header().Add("Vary", "Accept-Language")
+	return catalog
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// totpStep is the TOTP time step (RFC 6238)
+	totpStep = 30 * time.Second
+	// totpSkew is how many steps either side of now a code is accepted,
+	// for clock drift between the phone and the server
+	totpSkew = 1
+	// keyExportMaxFailures wrong codes in a row lock key export for
+	// keyExportLockout
+	keyExportMaxFailures = 5
+	keyExportLockout     = 5 * time.Minute
+)
+
+// decodeTOTPSecret decodes a base32 TOTP secret as authenticator apps
+// show it: any case, spaces allowed, padding optional
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("not base32")
+	}
+	if len(key) < 10 {
+		return nil, fmt.Errorf("too short: use at least 16 base32 characters (80 bits)")
+	}
+	return key, nil
+}
+
+// totpCode is the 6-digit code for time step counter (RFC 4226 HOTP with
+// SHA-1, as authenticator apps use)
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// keyExportGuard checks TOTP codes for key export. A code is accepted once
+// only, and repeated wrong codes lock export for a while.
+type keyExportGuard struct {
+	key []byte
+
+	mu          sync.Mutex
+	lastCounter uint64 // the time step of the last accepted code
+	failures    int
+	lockedUntil time.Time
+}
+
+func newKeyExportGuard(cfg KeyExportConfig) (*keyExportGuard, error) {
+	key, err := decodeTOTPSecret(cfg.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	return &keyExportGuard{key: key}, nil
+}
+
+// verify checks code against the current time step and its neighbours
+func (g *keyExportGuard) verify(code string, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Before(g.lockedUntil) {
+		return fmt.Errorf("Too many wrong codes; key export is locked until %s", g.lockedUntil.UTC().Format(time.RFC3339))
+	}
+
+	current := uint64(now.Unix()) / uint64(totpStep/time.Second)
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(g.key, counter)), []byte(code)) != 1 {
+			continue
+		}
+		if counter <= g.lastCounter {
+			return fmt.Errorf("This code has already been used; wait for the next one")
+		}
+		g.lastCounter = counter
+		g.failures = 0
+		return nil
+	}
+
+	g.failures++
+	if g.failures >= keyExportMaxFailures {
+		g.failures = 0
+		g.lockedUntil = now.Add(keyExportLockout)
+	}
+	return fmt.Errorf("Wrong authenticator code")
+}
+
+// requestUser names who made r, for the audit log: the OIDC subject or the
+// basic auth user
+func (ws *WalletServer) requestUser(r *http.Request) string {
+	if ws.oidc != nil {
+		if session, ok := ws.oidc.session(r); ok {
+			if session.Email != "" {
+				return fmt.Sprintf("%s (%s)", session.Subject, session.Email)
+			}
+			return session.Subject
+		}
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return "anonymous"
+}
+
+type ExportKeyRequest struct {
+	Address string `json:"address"`
+	Code    string `json:"code"` // the authenticator app's current code
+}
+
+type ExportKeyResponse struct {
+	Success bool   `json:"success"`
+	Address string `json:"address,omitempty"`
+	WIF     string `json:"wif,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HandleExportKey returns the private key of a node wallet address, for
+// moving the wallet elsewhere. It needs a TOTP code on top of the login,
+// and every attempt is written to the log under [AUDIT].
+func (ws *WalletServer) HandleExportKey(w http.ResponseWriter, r *http.Request) {
+	user := ws.requestUser(r)
+	if ws.keyExport == nil {
+		logRequest(r, "[AUDIT] WARNING: key export refused for %s from %s: not enabled", user, clientAddress(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ExportKeyResponse{
+			Success: false,
+			Error:   "Key export is disabled; set KEY_EXPORT_TOTP_SECRET to enable it",
+		})
+		return
+	}
+
+	if !ws.requireResponseKey(w, r) {
+		return
+	}
+
+	var req ExportKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ExportKeyResponse{
+			Success: false,
+			Error:   "Invalid request format: address and code are required",
+		})
+		return
+	}
+	address := strings.TrimSpace(req.Address)
+
+	if err := ws.keyExport.verify(strings.TrimSpace(req.Code), time.Now()); err != nil {
+		logRequest(r, "[AUDIT] WARNING: key export of %s refused for %s from %s: %v", address, user, clientAddress(r), err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(ExportKeyResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	wif, err := ws.rpc(r).DumpPrivKey(address)
+	if err != nil {
+		logRequest(r, "[AUDIT] WARNING: key export of %s by %s from %s failed: %v", address, user, clientAddress(r), err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ExportKeyResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to export key: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[AUDIT] WARNING: private key of %s exported by %s from %s", address, user, clientAddress(r))
+	ws.writeSensitiveJSON(w, r, ExportKeyResponse{
+		Success: true,
+		Address: address,
+		WIF:     wif,
+	})
+}
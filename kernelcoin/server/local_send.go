@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+type LocalSendRequest struct {
+	SessionID string     `json:"session_id"`
+	ToAddress string     `json:"to_address"`
+	Amount    rpc.Amount `json:"amount"`
+	FeeRate   int64      `json:"fee_rate,omitempty"` // sat/vB, estimated when zero
+}
+
+type LocalSendResponse struct {
+	Success bool       `json:"success"`
+	Txid    string     `json:"txid,omitempty"`
+	Fee     rpc.Amount `json:"fee,omitempty"`
+	FeeRate int64      `json:"fee_rate,omitempty"`
+	Inputs  int        `json:"inputs,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// HandleLocalSend builds and signs a transaction with a session's in-memory
+// key and broadcasts it through the address backend, without importing the
+// key into the node
+func (ws *WalletServer) HandleLocalSend(w http.ResponseWriter, r *http.Request) {
+	var req LocalSendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] LocalSend ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	session, ok := ws.getSession(req.SessionID)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   "Unknown or expired session",
+		})
+		return
+	}
+
+	wif, err := btcutil.DecodeWIF(session.Wallet.PrivateKeyWIF)
+	if err != nil {
+		logRequest(r, "[API] LocalSend ERROR: session key unusable: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   "Session key is unusable",
+		})
+		return
+	}
+
+	amount := req.Amount
+	if amount <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   "Invalid amount",
+		})
+		return
+	}
+
+	backend := ws.backend(r)
+	utxos, err := backend.UTXOs([]string{session.Wallet.LegacyAddress, session.Wallet.SegWitAddress})
+	if err != nil {
+		logRequest(r, "[API] LocalSend ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to find spendable outputs: %v", err),
+		})
+		return
+	}
+
+	feeRate := req.FeeRate
+	if feeRate <= 0 {
+		feeRate = estimateFeeRate(backend)
+	}
+
+	changeAddress := session.Wallet.SegWitAddress
+	if changeAddress == "" {
+		changeAddress = session.Wallet.LegacyAddress
+	}
+
+	built, err := hdwallet.BuildSignedTransaction(wif.PrivKey, wif.CompressPubKey, utxos,
+		req.ToAddress, int64(amount), feeRate, changeAddress)
+	if err != nil {
+		logRequest(r, "[API] LocalSend ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to build transaction: %v", err),
+		})
+		return
+	}
+
+	rawHex, err := hdwallet.SerializeTx(built.Tx)
+	if err == nil {
+		_, err = backend.Broadcast(rawHex)
+	}
+	if err != nil {
+		logRequest(r, "[API] LocalSend ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(LocalSendResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to broadcast transaction: %v", err),
+		})
+		return
+	}
+
+	txid := built.Tx.TxHash().String()
+	logRequest(r, "[API] LocalSend SUCCESS: txid=%s fee=%d kernels", txid, built.Fee)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LocalSendResponse{
+		Success: true,
+		Txid:    txid,
+		Fee:     rpc.Amount(built.Fee),
+		FeeRate: feeRate,
+		Inputs:  len(built.Tx.TxIn),
+	})
+}
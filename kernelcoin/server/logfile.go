@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotationTimeFormat suffixes rotated files: webwallet.log.20260115-030405.123
+const rotationTimeFormat = "20060102-150405.000"
+
+// rotatingFile is a log file that moves itself aside once it grows past
+// maxSize or gets older than every, keeping at most maxBackups old files
+// no older than maxAge (zero means no limit)
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	every      time.Duration
+	maxBackups int
+	maxAge     time.Duration
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(c LogConfig) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       c.File,
+		maxSize:    int64(c.MaxSizeMB) << 20,
+		every:      time.Duration(c.RotateEvery),
+		maxBackups: c.MaxBackups,
+		maxAge:     time.Duration(c.MaxAge),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open appends to the current file, carrying on from its size and age
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	if f.size > 0 {
+		f.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the old file rather than losing lines
+			fmt.Fprintf(os.Stderr, "[LOG] ERROR: rotating %s: %v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) due(next int) bool {
+	if f.maxSize > 0 && f.size+int64(next) > f.maxSize {
+		return true
+	}
+	return f.every > 0 && time.Since(f.opened) >= f.every
+}
+
+// rotate renames the current file with a timestamp suffix, starts a new one
+// and prunes old backups
+func (f *rotatingFile) rotate() error {
+	backup := f.path + "." + time.Now().Format(rotationTimeFormat)
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, backup); err != nil {
+		// Reopen so later writes still land somewhere
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune deletes backups beyond maxBackups or older than maxAge
+func (f *rotatingFile) prune() {
+	backups, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	// The timestamp suffix sorts chronologically; newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	kept := 0
+	for _, backup := range backups {
+		stamp := strings.TrimPrefix(backup, f.path+".")
+		rotated, err := time.ParseInLocation(rotationTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue // not one of ours
+		}
+		tooMany := f.maxBackups > 0 && kept >= f.maxBackups
+		tooOld := f.maxAge > 0 && time.Since(rotated) > f.maxAge
+		if tooMany || tooOld {
+			os.Remove(backup)
+			continue
+		}
+		kept++
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// logger receives every log line, including the "[TAG] message" lines
+// written through the log package
+var logger = slog.Default()
+
+// logLevel is logger's minimum level, changeable while running
+var logLevel = new(slog.LevelVar)
+
+// setupLogging switches logging to structured records: JSON (the default)
+// or logfmt-style text, at level debug, info (the default), warn or error,
+// written to stderr or a rotating file. Lines from log.Printf become records
+// with a component taken from their [TAG] and a level taken from their
+// ERROR/WARNING marker.
+func setupLogging(c LogConfig) error {
+	if err := setLogLevel(c.Level); err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: logLevel}
+
+	var out io.Writer = os.Stderr
+	if c.File != "" {
+		f, err := openRotatingFile(c)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		out = f
+	}
+
+	switch c.Format {
+	case "", "json":
+		logger = slog.New(slog.NewJSONHandler(out, opts))
+	case "text":
+		logger = slog.New(slog.NewTextHandler(out, opts))
+	default:
+		return fmt.Errorf("invalid log format %q (want json or text)", c.Format)
+	}
+
+	slog.SetDefault(logger)
+	// SetDefault routes the log package into logger at info level; take it
+	// over again so legacy lines get their levels
+	log.SetFlags(0)
+	log.SetOutput(legacyLogWriter{})
+	return nil
+}
+
+// setLogLevel changes the minimum level of logged records
+func setLogLevel(level string) error {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+		}
+	}
+	logLevel.Set(lvl)
+	return nil
+}
+
+// legacyLogWriter turns log package output into records
+type legacyLogWriter struct{}
+
+func (legacyLogWriter) Write(p []byte) (int, error) {
+	logLine("", strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// parseLogLine splits "[RPC] GetBalance ERROR: ..." into its level,
+// component ("rpc") and message. A leading DEBUG marks debug lines and is
+// dropped from the message. The marker is looked for before the first
+// colon so values in the message can't change the level.
+func parseLogLine(line string) (slog.Level, string, string) {
+	component, msg := "", line
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "] "); end > 0 {
+			component, msg = strings.ToLower(line[1:end]), line[end+2:]
+		}
+	}
+
+	head, _, _ := strings.Cut(msg, ":")
+	switch {
+	case component == "error":
+		return slog.LevelError, "", msg
+	case strings.Contains(head, "ERROR"):
+		return slog.LevelError, component, msg
+	case strings.Contains(head, "WARNING"):
+		return slog.LevelWarn, component, msg
+	case strings.HasPrefix(head, "DEBUG"):
+		return slog.LevelDebug, component, strings.TrimPrefix(strings.TrimPrefix(msg, "DEBUG"), " ")
+	}
+	return slog.LevelInfo, component, msg
+}
+
+// logLine records a "[TAG] message" line, tagged with requestID if set
+func logLine(requestID, line string) {
+	level, component, msg := parseLogLine(line)
+	ctx := context.Background()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 2)
+	if component != "" {
+		attrs = append(attrs, slog.String("component", component))
+	}
+	if requestID != "" {
+		attrs = append(attrs, slog.String("request_id", requestID))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+type requestIDKey struct{}
+
+// withRequestID gives every request an ID, kept from a sane incoming
+// X-Request-ID (so a proxy's IDs carry through) or generated, and echoes it
+// in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID withRequestID gave r, or ""
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequest is log.Printf for handlers: the line carries r's request ID,
+// and ERROR lines go into the error report if the request fails
+func logRequest(r *http.Request, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	logLine(requestID(r), line)
+	noteRequestError(r, line)
+}
+
+// rpc returns the RPC client for handling r, which tags its log lines with
+// r's request ID. In multi-user mode it calls the wallet of r's user.
+func (ws *WalletServer) rpc(r *http.Request) rpc.WalletBackend {
+	if user := requestWalletUser(r); user != nil {
+		return ws.tenants.client(ws.rpcClient, user.Wallet).WithRequestID(requestID(r))
+	}
+	return ws.rpcClient.WithRequestID(requestID(r))
+}
@@ -0,0 +1,1671 @@
+// Package server is the Kernelcoin web wallet: the HTTP API and frontend over
+// a kernelcoind node (or an Electrum server), with its local store and
+// background watchers. Main runs it as the webwallet command does.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"kernelcoin-wallet/kernelcoin/demo"
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// WalletServer manages wallet operations and serves the web interface
+type WalletServer struct {
+	// rpcClient is the node wallet: a kernelcoind client, unless another
+	// backend was given to NewWalletServerWithBackend
+	rpcClient rpc.WalletBackend
+	store     *Store
+	mu        sync.RWMutex
+	wallets   map[string]*WalletSession
+
+	// responseEncryption controls ECIES wrapping of secret-bearing responses
+	responseEncryption string
+
+	// sessionIdleTimeout drops in-memory signing sessions after inactivity
+	sessionIdleTimeout time.Duration
+
+	// events carries wallet changes to WebSocket and SSE clients
+	events *eventHub
+
+	// paymentWatches are the addresses waiting for an expected payment
+	paymentWatches *paymentWatches
+
+	// prices converts amounts to fiat; nil when no provider is configured.
+	// A config reload can swap it.
+	prices atomic.Pointer[PriceService]
+
+	// txSync tracks the local transaction cache; nil when it is disabled
+	txSync *txSyncState
+
+	// chain caches node info between chain-state polls
+	chain *chainState
+
+	// assets holds index.html and the /static/ files
+	assets fs.FS
+
+	// messages translates error and status messages; nil answers in
+	// English
+	messages *messageCatalogs
+
+	// network is the chain the node must be on: main, test or regtest
+	network string
+
+	// node is the result of the startup node check
+	node *nodeStatus
+
+	// checkout holds the merchant checkout defaults and callback secret
+	checkout CheckoutConfig
+
+	// fees defines the fee presets
+	fees FeeConfig
+
+	// broadcastOnly refuses every endpoint that handles private keys
+	broadcastOnly bool
+
+	// backupDir is where the node writes wallet backups and reads restored
+	// ones; empty disables both
+	backupDir string
+
+	// keyExport checks the authenticator codes /api/export-key needs; nil
+	// disables key export
+	keyExport *keyExportGuard
+
+	// metadataChanges moves whenever transaction metadata is edited, for
+	// ETags
+	metadataChanges atomic.Int64
+
+	// reorgs remembers transactions that dropped out of the chain
+	reorgs *reorgTracker
+
+	// jobs tracks background rescans of the node wallet, on their own or
+	// after a key import
+	jobs *walletJobs
+
+	// electrum serves session addresses instead of the node; nil with the
+	// node backend
+	electrum *electrumClient
+
+	// signingMu serializes uploads and broadcasts of PSBT signing requests
+	signingMu sync.Mutex
+
+	// oidc logs users in through an OpenID Connect provider; nil when
+	// it isn't configured
+	oidc *oidcProvider
+
+	// limiter rate-limits API requests per client; reloadable
+	limiter *rateLimiter
+
+	// errorReports sends panics and 5xx errors on; nil when no DSN is set
+	errorReports *errorReporter
+
+	// tenants gives each registered user a wallet of their own; nil in
+	// single-user mode
+	tenants *tenants
+}
+
+// WalletSession stores information about a wallet session
+type WalletSession struct {
+	ID        string
+	Wallet    *hdwallet.Wallet
+	CreatedAt time.Time
+	LastUsed  time.Time
+}
+
+// API Response structures
+type BalanceResponse struct {
+	Total       rpc.Amount `json:"total"`
+	Confirmed   rpc.Amount `json:"confirmed"`
+	Unconfirmed rpc.Amount `json:"unconfirmed"`
+	Immature    rpc.Amount `json:"immature"`
+
+	// The same figures under their getbalances names
+	Trusted          rpc.Amount            `json:"trusted"`
+	UntrustedPending rpc.Amount            `json:"untrusted_pending"`
+	WatchOnly        *rpc.WatchOnlyBalance `json:"watch_only,omitempty"`
+
+	// FiatValue is Total at the current price, when a price provider is set
+	FiatValue *FiatValue `json:"fiat_value,omitempty"`
+}
+
+type TransactionResponse struct {
+	Account       string     `json:"account"`
+	Address       string     `json:"address"`
+	Category      string     `json:"category"`
+	Amount        rpc.Amount `json:"amount"`
+	Fee           rpc.Amount `json:"fee,omitempty"` // sends only, negative
+	Net           rpc.Amount `json:"net"`           // Amount plus Fee: what the entry did to the balance
+	Direction     string     `json:"direction"`     // incoming, outgoing or self (a send to the wallet's own address)
+	Status        string     `json:"status"`        // confirmed, pending, reorged, conflicted or abandoned
+	Confirmations int        `json:"confirmations"`
+	Txid          string     `json:"txid"`
+	Vout          int        `json:"vout"`
+	Time          int64      `json:"time"`
+	TimeReceived  int64      `json:"timereceived"`
+	Comment       string     `json:"comment,omitempty"`
+	CommentTo     string     `json:"comment_to,omitempty"`
+	Contact       string     `json:"contact,omitempty"` // address book name for Address
+
+	// TimeISO and TimeReceivedISO are Time and TimeReceived in RFC 3339,
+	// in the configured time zone
+	TimeISO         string `json:"time_iso,omitempty"`
+	TimeReceivedISO string `json:"timereceived_iso,omitempty"`
+
+	// Metadata is what the user recorded about the transaction
+	Metadata *TxMetadata `json:"metadata,omitempty"`
+
+	// FiatValue is Amount at the current price (not the price at the time)
+	FiatValue *FiatValue `json:"fiat_value,omitempty"`
+
+	// Abandoned and Conflicted transactions will never confirm as they are;
+	// WalletConflicts lists the wallet transactions spending the same inputs
+	Abandoned       bool     `json:"abandoned,omitempty"`
+	Conflicted      bool     `json:"conflicted,omitempty"`
+	WalletConflicts []string `json:"walletconflicts,omitempty"`
+}
+
+type SendTransactionRequest struct {
+	ToAddress   string         `json:"to_address"`
+	Amount      rpc.Amount     `json:"amount"`
+	Inputs      []rpc.Outpoint `json:"inputs,omitempty"`
+	Replaceable bool           `json:"replaceable,omitempty"`
+
+	// Comment and CommentTo are stored in the node wallet with the
+	// transaction; they are not part of the transaction itself
+	Comment   string `json:"comment,omitempty"`
+	CommentTo string `json:"comment_to,omitempty"`
+
+	// OpReturn (UTF-8 text) or OpReturnHex attaches public data to the
+	// transaction in an OP_RETURN output
+	OpReturn    string `json:"op_return,omitempty"`
+	OpReturnHex string `json:"op_return_hex,omitempty"`
+
+	// AmountWordsLocale requests the amount spelled out in the response
+	AmountWordsLocale string `json:"amount_words_locale,omitempty"`
+
+	// FeePreset (economy, normal or priority) sets the fee rate; without
+	// it the node's own estimate applies
+	FeePreset string `json:"fee_preset,omitempty"`
+
+	// ChangeAddress is where change goes: an address, or ChangeNewSegWit
+	// for a new bech32 change address of the wallet. Without it the node
+	// picks its own change address.
+	ChangeAddress string `json:"change_address,omitempty"`
+}
+
+type SendTransactionResponse struct {
+	Success     bool   `json:"success"`
+	Txid        string `json:"txid,omitempty"`
+	AmountWords string `json:"amount_words,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// Code says why the send was refused; see the Err codes
+	Code string `json:"code,omitempty"`
+}
+
+type SendMaxRequest struct {
+	ToAddress string `json:"to_address"`
+}
+
+type SendMaxResponse struct {
+	Success bool       `json:"success"`
+	Txid    string     `json:"txid,omitempty"`
+	Amount  rpc.Amount `json:"amount,omitempty"`
+	Fee     rpc.Amount `json:"fee,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type BumpFeeRequest struct {
+	Txid       string  `json:"txid"`
+	ConfTarget int     `json:"conf_target,omitempty"`
+	FeeRate    float64 `json:"fee_rate,omitempty"` // sat/vB
+}
+
+type BumpFeeResponse struct {
+	Success      bool       `json:"success"`
+	Txid         string     `json:"txid,omitempty"`
+	OriginalTxid string     `json:"original_txid,omitempty"`
+	OriginalFee  rpc.Amount `json:"original_fee,omitempty"`
+	Fee          rpc.Amount `json:"fee,omitempty"`
+	Warnings     []string   `json:"warnings,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+type ImportKeyRequest struct {
+	WIF        string `json:"wif"`        // or a BIP38 key (6P...)
+	Passphrase string `json:"passphrase"` // decrypts a BIP38 key
+	// Rescan looks for the key's past transactions in a background job;
+	// true when omitted
+	Rescan      *bool `json:"rescan,omitempty"`
+	StartHeight int64 `json:"start_height,omitempty"` // where the rescan starts
+}
+
+type ImportKeyResponse struct {
+	Success bool       `json:"success"`
+	Job     *WalletJob `json:"job,omitempty"` // the rescan, when requested
+	Error   string     `json:"error,omitempty"`
+}
+
+type MnemonicToWIFRequest struct {
+	Mnemonic string `json:"mnemonic"`
+}
+
+type MnemonicToWIFResponse struct {
+	Success bool   `json:"success"`
+	WIF     string `json:"wif,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type NewAddressResponse struct {
+	Success       bool   `json:"success"`
+	LegacyAddress string `json:"legacy_address,omitempty"`
+	SegWitAddress string `json:"segwit_address,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type AddressesResponse struct {
+	Success   bool          `json:"success"`
+	Addresses []AddressInfo `json:"addresses,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type AddressInfo struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+}
+
+type GetNewAddressRequest struct {
+	AddressType string `json:"address_type"`
+}
+
+type GetNewAddressResponse struct {
+	Success bool   `json:"success"`
+	Address string `json:"address,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type GenerateAddressRequest struct {
+	Type string `json:"type"`
+}
+
+type GenerateAddressResponse struct {
+	Success bool   `json:"success"`
+	Address string `json:"address,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ValidateAddressRequest struct {
+	Address string `json:"address"`
+}
+
+type ValidateAddressResponse struct {
+	Isvalid bool   `json:"isvalid"`
+	Error   string `json:"error,omitempty"`
+
+	// The wallet's details, for addresses it owns or watches
+	*rpc.AddressDetails
+}
+
+// NewWalletRequest is the optional body of /api/new-wallet
+type NewWalletRequest struct {
+	// BIP38Passphrase also returns the key BIP38 encrypted with it
+	BIP38Passphrase string `json:"bip38_passphrase"`
+}
+
+type NewWalletResponse struct {
+	Success         bool   `json:"success"`
+	Mnemonic        string `json:"mnemonic,omitempty"`
+	PrivateKeyWIF   string `json:"private_key_wif,omitempty"`
+	PrivateKeyBIP38 string `json:"private_key_bip38,omitempty"`
+	LegacyAddress   string `json:"legacy_address,omitempty"`
+	SegWitAddress   string `json:"segwit_address,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+type TransactionsListResponse struct {
+	Success      bool                  `json:"success"`
+	Transactions []TransactionResponse `json:"transactions,omitempty"`
+	Pagination   *Pagination           `json:"pagination,omitempty"`
+	Error        string                `json:"error,omitempty"`
+}
+
+// NewWalletServer creates a new wallet server instance
+func NewWalletServer(rpcURL, rpcUser, rpcPass string) *WalletServer {
+	rpcClient := rpc.NewClient(rpcURL, rpcUser, rpcPass)
+	rpcClient.SetLogger(logLine)
+	return NewWalletServerWithBackend(rpcClient)
+}
+
+// NewWalletServerWithBackend creates a wallet server whose handlers work
+// through backend rather than a kernelcoind client
+func NewWalletServerWithBackend(backend rpc.WalletBackend) *WalletServer {
+	return &WalletServer{
+		rpcClient:          backend,
+		wallets:            make(map[string]*WalletSession),
+		responseEncryption: EncryptionOptional,
+		sessionIdleTimeout: defaultSessionIdleTimeout,
+		events:             newEventHub(),
+		paymentWatches:     newPaymentWatches(),
+		chain:              newChainState(),
+		assets:             embeddedAssets,
+		limiter:            newRateLimiter(RateLimitConfig{}),
+		network:            "main",
+		fees:               defaultConfig().Fees,
+		node:               &nodeStatus{},
+		jobs:               newWalletJobs(),
+		reorgs:             newReorgTracker(),
+	}
+}
+
+// HTTP Handler Functions
+
+// HandleIndex serves the main HTML page
+func (ws *WalletServer) HandleIndex(w http.ResponseWriter, r *http.Request) {
+	ws.serveIndex(w, r)
+}
+
+// HandleBalance returns the current balance
+func (ws *WalletServer) HandleBalance(w http.ResponseWriter, r *http.Request) {
+	// Get all addresses in the wallet and sum their balances
+	balanceInfo, err := ws.rpc(r).GetBalanceInfo("")
+	if err != nil {
+		logRequest(r, "[API] Balance ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get balance"})
+		return
+	}
+
+	response := balanceResponse(balanceInfo)
+	response.FiatValue = ws.fiatQuote(r).Value(response.Total)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	logRequest(r, "[API] Balance response: %+v", response)
+}
+
+// balanceResponse maps getbalances figures onto the API response
+func balanceResponse(balanceInfo *rpc.BalanceInfo) BalanceResponse {
+	return BalanceResponse{
+		Total:       balanceInfo.Total,
+		Confirmed:   balanceInfo.Confirmed,
+		Unconfirmed: balanceInfo.Unconfirmed,
+		Immature:    balanceInfo.Immature,
+
+		Trusted:          balanceInfo.Confirmed,
+		UntrustedPending: balanceInfo.Unconfirmed,
+		WatchOnly:        balanceInfo.WatchOnly,
+	}
+}
+
+// HandleSendTransaction handles sending coins
+func (ws *WalletServer) HandleSendTransaction(w http.ResponseWriter, r *http.Request) {
+	var req SendTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] SendTransaction ERROR: Invalid request - %v", err)
+		response := SendTransactionResponse{Success: false, Error: "Invalid request format"}
+		if refused := amountError(err); refused != nil {
+			response.Error, response.Code = refused.Message, refused.Code
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	logRequest(r, "[API] SendTransaction: %s KCN to %s", req.Amount, req.ToAddress)
+
+	if refused := refuseSend(r, ws.rpc(r), req); refused != nil {
+		logRequest(r, "[API] SendTransaction ERROR: %s", refused.Message)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendTransactionResponse{
+			Success: false,
+			Error:   refused.Message,
+			Code:    refused.Code,
+		})
+		return
+	}
+
+	// Validate address
+	valid, err := ws.rpc(r).ValidateAddress(req.ToAddress)
+	if err != nil || !valid {
+		logRequest(r, "[API] SendTransaction ERROR: Invalid address - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendTransactionResponse{
+			Success: false,
+			Error:   "Invalid recipient address",
+		})
+		return
+	}
+
+	if needsDraft(req) {
+		logRequest(r, "[API] Raw send: %s KCN to %s from %d selected inputs", req.Amount, req.ToAddress, len(req.Inputs))
+	}
+
+	// Send transaction using the loaded wallet
+	txid, err := ws.sendWithinLimit(r, req.Amount, func() (string, error) {
+		return ws.submitSend(ws.rpc(r), req)
+	})
+	if err != nil {
+		logRequest(r, "[API] SendTransaction ERROR: %v", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, errSendLimit) {
+			status = http.StatusForbidden
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(SendTransactionResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to send transaction: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] SendTransaction SUCCESS: txid=%s", txid)
+	response := SendTransactionResponse{
+		Success: true,
+		Txid:    txid,
+	}
+	if req.AmountWordsLocale != "" {
+		response.AmountWords = AmountInWords(req.Amount, req.AmountWordsLocale)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// needsDraft reports whether req is sent as a hand-built transaction, which
+// selected inputs, OP_RETURN data and a change address need
+func needsDraft(req SendTransactionRequest) bool {
+	return len(req.Inputs) > 0 || req.OpReturn != "" || req.OpReturnHex != "" || req.ChangeAddress != ""
+}
+
+// submitSend broadcasts an already-validated send request through the loaded
+// wallet. Shared by the send endpoint and the scheduler.
+func (ws *WalletServer) submitSend(client rpc.WalletBackend, req SendTransactionRequest) (string, error) {
+	if needsDraft(req) {
+		// sendrawtransaction has nowhere to record wallet comments
+		if req.Comment != "" || req.CommentTo != "" {
+			return "", fmt.Errorf("comments are not supported with selected inputs, OP_RETURN data or a change address")
+		}
+		return ws.sendDraft(client, req)
+	}
+	options := rpc.SendOptions{
+		Comment:     req.Comment,
+		CommentTo:   req.CommentTo,
+		Replaceable: req.Replaceable,
+	}
+	if req.FeePreset != "" {
+		preset, err := ws.feePreset(client, req.FeePreset)
+		if err != nil {
+			return "", err
+		}
+		options.FeeRate = preset.FeeRate
+	}
+	return client.SendToAddressWithOptions(req.ToAddress, req.Amount, options)
+}
+
+// HandleSendMax sweeps every confirmed, spendable output to an address,
+// paying the fee out of the swept amount
+func (ws *WalletServer) HandleSendMax(w http.ResponseWriter, r *http.Request) {
+	var req SendMaxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] SendMax ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendMaxResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	valid, err := ws.rpc(r).ValidateAddress(req.ToAddress)
+	if err != nil || !valid {
+		logRequest(r, "[API] SendMax ERROR: Invalid address - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendMaxResponse{
+			Success: false,
+			Error:   "Invalid recipient address",
+		})
+		return
+	}
+
+	// The same coins /api/max-send prices, so the amount it reports is
+	// the one sent
+	inputs, total, err := sweepableCoins(ws.rpc(r))
+	if err != nil {
+		logRequest(r, "[API] SendMax ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SendMaxResponse{
+			Success: false,
+			Error:   "Failed to list unspent outputs",
+		})
+		return
+	}
+
+	if total <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendMaxResponse{
+			Success: false,
+			Error:   "No spendable balance",
+		})
+		return
+	}
+
+	funded, err := sweepDraft(ws.rpc(r), inputs, req.ToAddress, total, 0)
+	if err != nil {
+		logRequest(r, "[API] SendMax ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendMaxResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Cannot build transaction: %v", err),
+		})
+		return
+	}
+	amount, fee := total-funded.Fee, funded.Fee
+
+	logRequest(r, "[API] SendMax: sweeping %s KCN (fee %s) to %s", amount, fee, req.ToAddress)
+
+	// The limit counts what the recipient gets, as for /api/send
+	txid, err := ws.sendWithinLimit(r, amount, func() (string, error) {
+		return broadcastDraft(ws.rpc(r), funded)
+	})
+	if err != nil {
+		logRequest(r, "[API] SendMax ERROR: %v", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, errSendLimit) {
+			status = http.StatusForbidden
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(SendMaxResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to send transaction: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] SendMax SUCCESS: txid=%s fee=%s", txid, fee)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SendMaxResponse{
+		Success: true,
+		Txid:    txid,
+		Amount:  amount,
+		Fee:     fee,
+	})
+}
+
+// HandleBumpFee replaces a stuck replaceable transaction with a higher-fee one
+func (ws *WalletServer) HandleBumpFee(w http.ResponseWriter, r *http.Request) {
+	var req BumpFeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Txid == "" {
+		logRequest(r, "[API] BumpFee ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BumpFeeResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	if req.ConfTarget > 0 && req.FeeRate > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BumpFeeResponse{
+			Success: false,
+			Error:   "Specify either conf_target or fee_rate, not both",
+		})
+		return
+	}
+
+	result, err := ws.rpc(r).BumpFee(req.Txid, req.ConfTarget, req.FeeRate)
+	if err != nil {
+		logRequest(r, "[API] BumpFee ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(BumpFeeResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to bump fee: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] BumpFee SUCCESS: %s replaced by %s", req.Txid, result.Txid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BumpFeeResponse{
+		Success:      true,
+		Txid:         result.Txid,
+		OriginalTxid: req.Txid,
+		OriginalFee:  result.OrigFee,
+		Fee:          result.Fee,
+		Warnings:     result.Errors,
+	})
+}
+
+// HandleImportKey imports a private key
+func (ws *WalletServer) HandleImportKey(w http.ResponseWriter, r *http.Request) {
+	var req ImportKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] ImportKey ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportKeyResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	wif, err := hdwallet.DecryptKeyInput(strings.TrimSpace(req.WIF), req.Passphrase)
+	if err != nil {
+		logRequest(r, "[API] ImportKey ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportKeyResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to decrypt key: %v", err),
+		})
+		return
+	}
+	if req.StartHeight < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportKeyResponse{
+			Success: false,
+			Error:   "start_height must not be negative",
+		})
+		return
+	}
+
+	// importprivkey's own rescan holds the request for as long as the node
+	// scans, so import without it and rescan in a job instead
+	rescan := req.Rescan == nil || *req.Rescan
+	if rescan {
+		if err := ws.canStartJob(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(ImportKeyResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Cannot rescan: %v; retry later or import with \"rescan\": false", err),
+			})
+			return
+		}
+	}
+
+	_, err = ws.rpc(r).ImportPrivateKey(wif, false)
+	if err != nil {
+		logRequest(r, "[API] ImportKey ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ImportKeyResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to import key: %v", err),
+		})
+		return
+	}
+
+	if !rescan {
+		logRequest(r, "[API] ImportKey SUCCESS (no rescan)")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ImportKeyResponse{
+			Success: true,
+		})
+		return
+	}
+
+	client := ws.rpc(r)
+	job := &WalletJob{Kind: "import", StartHeight: req.StartHeight}
+	err = ws.jobs.start(job, func() (int64, int64, error) {
+		return client.RescanBlockchain(req.StartHeight, 0)
+	})
+	if err != nil {
+		// Lost a race with another job; the key is in the wallet regardless
+		logRequest(r, "[API] ImportKey WARNING: imported, but rescan not started: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ImportKeyResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Key imported, but the rescan could not start: %v; use /api/wallet/rescan", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] ImportKey SUCCESS: rescanning from block %d in job %s", req.StartHeight, job.ID)
+	started, _ := ws.jobs.get(ws.rpc(r), job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ImportKeyResponse{
+		Success: true,
+		Job:     &started,
+	})
+}
+
+// HandleNewWallet generates a new wallet
+func (ws *WalletServer) HandleNewWallet(w http.ResponseWriter, r *http.Request) {
+	if !ws.requireResponseKey(w, r) {
+		return
+	}
+
+	// The body is optional; older clients send none
+	var req NewWalletRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(NewWalletResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	wallet, err := hdwallet.GenerateNewWallet()
+	var encrypted string
+	if err == nil && req.BIP38Passphrase != "" {
+		var wif *btcutil.WIF
+		if wif, err = btcutil.DecodeWIF(wallet.PrivateKeyWIF); err == nil {
+			encrypted, err = hdwallet.EncryptBIP38(wif, req.BIP38Passphrase)
+		}
+	}
+	if err != nil {
+		logRequest(r, "[API] NewWallet ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(NewWalletResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to generate wallet: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] NewWallet SUCCESS: %s", wallet.LegacyAddress)
+	ws.writeSensitiveJSON(w, r, NewWalletResponse{
+		Success:         true,
+		Mnemonic:        wallet.Mnemonic,
+		PrivateKeyWIF:   wallet.PrivateKeyWIF,
+		PrivateKeyBIP38: encrypted,
+		LegacyAddress:   wallet.LegacyAddress,
+		SegWitAddress:   wallet.SegWitAddress,
+	})
+}
+
+// HandleNewAddress generates a new address from an existing wallet
+func (ws *WalletServer) HandleNewAddress(w http.ResponseWriter, r *http.Request) {
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] NewAddress ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(NewAddressResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	mnemonic, ok := req["mnemonic"]
+	if !ok || mnemonic == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(NewAddressResponse{
+			Success: false,
+			Error:   "Mnemonic is required",
+		})
+		return
+	}
+
+	wallet, err := hdwallet.GenerateWalletFromMnemonic(mnemonic)
+	if err != nil {
+		logRequest(r, "[API] NewAddress ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(NewAddressResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to generate address: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] NewAddress SUCCESS: %s", wallet.LegacyAddress)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewAddressResponse{
+		Success:       true,
+		LegacyAddress: wallet.LegacyAddress,
+		SegWitAddress: wallet.SegWitAddress,
+	})
+}
+
+// HandleListTransactions lists transactions a page at a time, newest page
+// first. Filters (see parseTransactionFilter) are applied server-side, from
+// the transaction cache once it has synced.
+func (ws *WalletServer) HandleListTransactions(w http.ResponseWriter, r *http.Request) {
+	page := parsePageParams(r)
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TransactionsListResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var transactions []TransactionResponse
+	var total int
+	var hasMore bool
+	if filter.Active() || ws.txSync.Ready() {
+		transactions, total, err = ws.filteredTransactions(ws.rpc(r), filter, page)
+		hasMore = page.Skip+len(transactions) < total
+	} else {
+		transactions, total, hasMore, err = ws.transactionPage(ws.rpc(r), page)
+	}
+	if err != nil {
+		logRequest(r, "[API] ListTransactions ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TransactionsListResponse{
+			Success: false,
+			Error:   "Failed to list transactions",
+		})
+		return
+	}
+
+	setDirections(transactions)
+	owner := walletOwner(r)
+	ws.setStatuses(owner, transactions)
+	ws.resolveContacts(owner, transactions)
+	ws.resolveMetadata(owner, transactions)
+	addFiatValues(transactions, ws.fiatQuote(r))
+
+	logRequest(r, "[API] ListTransactions SUCCESS: Retrieved %d transactions", len(transactions))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionsListResponse{
+		Success:      true,
+		Transactions: transactions,
+		Pagination: &Pagination{
+			Count:   page.Count,
+			Skip:    page.Skip,
+			Page:    page.Page,
+			Total:   total,
+			HasMore: hasMore,
+		},
+	})
+}
+
+// transactionPage reads one unfiltered page straight from listtransactions
+func (ws *WalletServer) transactionPage(client rpc.WalletBackend, page PageParams) ([]TransactionResponse, int, bool, error) {
+	// Fetch one extra entry to learn whether an older page exists
+	txs, err := client.ListTransactions("", page.Count+1, page.Skip)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	hasMore := len(txs) > page.Count
+	if hasMore {
+		// Entries are oldest first, so the extra one is at the front
+		txs = txs[1:]
+	}
+
+	// Convert interface{} slice to TransactionResponse structs
+	transactions := []TransactionResponse{}
+	for _, tx := range txs {
+		if txMap, ok := tx.(map[string]interface{}); ok {
+			transactions = append(transactions, transactionFromRPC(txMap))
+		}
+	}
+
+	// txcount counts transactions, not entries; a transaction paying several
+	// wallet outputs lists once per output
+	total := page.Skip + len(transactions)
+	if info, err := client.GetWalletInfo(); err == nil {
+		total = max(total, rpc.GetInt(info, "txcount"))
+	}
+	return transactions, total, hasMore, nil
+}
+
+// transactionFromRPC converts a listtransactions entry
+func transactionFromRPC(txMap map[string]interface{}) TransactionResponse {
+	txResp := TransactionResponse{
+		Account:       rpc.GetString(txMap, "account"),
+		Address:       rpc.GetString(txMap, "address"),
+		Category:      rpc.GetString(txMap, "category"),
+		Amount:        rpc.GetAmount(txMap, "amount"),
+		Fee:           rpc.GetAmount(txMap, "fee"),
+		Confirmations: rpc.GetInt(txMap, "confirmations"),
+		Txid:          rpc.GetString(txMap, "txid"),
+		Vout:          rpc.GetInt(txMap, "vout"),
+		Time:          rpc.GetInt64(txMap, "time"),
+		TimeReceived:  rpc.GetInt64(txMap, "timereceived"),
+		Comment:       rpc.GetString(txMap, "comment"),
+		CommentTo:     rpc.GetString(txMap, "to"),
+	}
+	txResp.TimeISO, txResp.TimeReceivedISO = formatTime(txResp.Time), formatTime(txResp.TimeReceived)
+	txResp.Abandoned, _ = txMap["abandoned"].(bool)
+	if conflicts, ok := txMap["walletconflicts"].([]interface{}); ok {
+		for _, c := range conflicts {
+			if id, ok := c.(string); ok {
+				txResp.WalletConflicts = append(txResp.WalletConflicts, id)
+			}
+		}
+	}
+	// Negative confirmations mean a conflicting transaction was mined
+	txResp.Conflicted = txResp.Confirmations < 0
+	return txResp
+}
+
+// HandleGetAddresses lists all addresses with label ""
+func (ws *WalletServer) HandleGetAddresses(w http.ResponseWriter, r *http.Request) {
+	addrs, err := ws.rpc(r).GetAddressesByLabel("")
+	if err != nil {
+		logRequest(r, "[API] GetAddresses ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(AddressesResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to get addresses: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] GetAddresses: Retrieved %d addresses from RPC", len(addrs))
+
+	addresses := []AddressInfo{}
+	for _, addr := range addrs {
+		addresses = append(addresses, AddressInfo{
+			Address: addr,
+			Type:    "Address",
+		})
+	}
+
+	logRequest(r, "[API] GetAddresses SUCCESS: Returning %d addresses", len(addresses))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AddressesResponse{
+		Success:   true,
+		Addresses: addresses,
+	})
+}
+
+// HandleGetNewAddress generates a new address
+//
+// Deprecated: served for old clients only; use /api/generate-address.
+func (ws *WalletServer) HandleGetNewAddress(w http.ResponseWriter, r *http.Request) {
+	var req GetNewAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] GetNewAddress ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GetNewAddressResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	addr, err := ws.rpc(r).GetNewAddress("", req.AddressType)
+	if err != nil {
+		logRequest(r, "[API] GetNewAddress ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GetNewAddressResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to generate address: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] GetNewAddress SUCCESS: %s", addr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetNewAddressResponse{
+		Success: true,
+		Address: addr,
+	})
+}
+
+// HandleGenerateAddress generates a new address (frontend-compatible endpoint)
+func (ws *WalletServer) HandleGenerateAddress(w http.ResponseWriter, r *http.Request) {
+	var req GenerateAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] GenerateAddress ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GenerateAddressResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	addr, err := ws.rpc(r).GetNewAddress("", req.Type)
+	if err != nil {
+		logRequest(r, "[API] GenerateAddress ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GenerateAddressResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to generate address: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] GenerateAddress SUCCESS: %s", addr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GenerateAddressResponse{
+		Success: true,
+		Address: addr,
+	})
+}
+
+// HandleValidateAddress validates an address format
+func (ws *WalletServer) HandleValidateAddress(w http.ResponseWriter, r *http.Request) {
+	var req ValidateAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] ValidateAddress ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ValidateAddressResponse{
+			Isvalid: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	valid, err := ws.rpc(r).ValidateAddress(req.Address)
+	if err != nil {
+		logRequest(r, "[API] ValidateAddress ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ValidateAddressResponse{
+			Isvalid: false,
+			Error:   fmt.Sprintf("Validation error: %v", err),
+		})
+		return
+	}
+
+	response := ValidateAddressResponse{Isvalid: valid}
+	if valid {
+		// Validation doesn't fail for want of details
+		info, err := ws.rpc(r).GetAddressInfo(req.Address)
+		if err != nil {
+			logRequest(r, "[API] ValidateAddress WARNING: no address info: %v", err)
+		} else if info.IsMine || info.IsWatchOnly {
+			response.AddressDetails = info
+		}
+	}
+
+	logRequest(r, "[API] ValidateAddress: %s is valid=%v", req.Address, valid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleCheckWallet checks if a wallet is loaded
+func (ws *WalletServer) HandleCheckWallet(w http.ResponseWriter, r *http.Request) {
+	addrs, err := ws.rpc(r).GetAddressesByLabel("")
+	if err != nil {
+		logRequest(r, "[API] CheckWallet ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"loaded": false,
+		})
+		return
+	}
+
+	loaded := len(addrs) > 0
+	logRequest(r, "[API] CheckWallet: Wallet loaded=%v (addresses: %d)", loaded, len(addrs))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"loaded": loaded,
+	})
+}
+
+// HandleMnemonicToWIF converts a mnemonic phrase to WIF format
+func (ws *WalletServer) HandleMnemonicToWIF(w http.ResponseWriter, r *http.Request) {
+	var req MnemonicToWIFRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] MnemonicToWIF ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MnemonicToWIFResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	if !ws.requireResponseKey(w, r) {
+		return
+	}
+
+	if req.Mnemonic == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MnemonicToWIFResponse{
+			Success: false,
+			Error:   "Mnemonic phrase is required",
+		})
+		return
+	}
+
+	// Generate wallet from mnemonic
+	wallet, err := hdwallet.GenerateWalletFromMnemonic(req.Mnemonic)
+	if err != nil {
+		logRequest(r, "[API] MnemonicToWIF ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MnemonicToWIFResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to convert mnemonic: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] MnemonicToWIF SUCCESS: Converted mnemonic to WIF")
+	ws.writeSensitiveJSON(w, r, MnemonicToWIFResponse{
+		Success: true,
+		WIF:     wallet.PrivateKeyWIF,
+	})
+}
+
+// HandleNetworkInfo returns network information from the chain-state
+// cache, with fetched_at saying how fresh it is
+func (ws *WalletServer) HandleNetworkInfo(w http.ResponseWriter, r *http.Request) {
+	info, fetchedAt, err := ws.networkInfo()
+	if err != nil {
+		logRequest(r, "[API] NetworkInfo ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get network info"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withFetchedAt(info, fetchedAt))
+	logRequest(r, "[API] NetworkInfo response sent")
+}
+
+// HandleBlockchainInfo returns blockchain information from the chain-state
+// cache, with fetched_at saying how fresh it is. Its ETag follows the cached
+// chain state, so revalidating costs no RPC at all.
+func (ws *WalletServer) HandleBlockchainInfo(w http.ResponseWriter, r *http.Request) {
+	info, fetchedAt, err := ws.blockchainInfo()
+	if err != nil {
+		logRequest(r, "[API] BlockchainInfo ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get blockchain info"})
+		return
+	}
+
+	if notModified(w, r, chainETag(info)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withFetchedAt(info, fetchedAt))
+	logRequest(r, "[API] BlockchainInfo response sent")
+}
+
+// maxHeaderBytes caps request headers; the API needs nothing near this
+const maxHeaderBytes = 64 << 10
+
+// routes declares every endpoint with its methods; the router answers the
+// rest with 405. The most literal match wins, so order doesn't matter.
+func (ws *WalletServer) routes() *router {
+	rt := newRouter()
+
+	rt.handle("GET", "/api/dashboard", ws.HandleDashboard)
+	rt.handle("GET", "/api/balance", ws.withWalletETag(ws.HandleBalance))
+	rt.handle("GET", "/api/balance/history", ws.withWalletETag(ws.HandleBalanceHistory))
+	rt.handle("POST", "/api/send", ws.HandleSendTransaction)
+	rt.handle("POST", "/api/send/preview", ws.HandleSendPreview)
+	rt.handle("POST", "/api/send-max", ws.HandleSendMax)
+	rt.handle("GET", "/api/max-send", ws.HandleMaxSend)
+	rt.handle("POST", "/api/fund-preview", ws.HandleFundPreview)
+	rt.handle("GET", "/api/fee-presets", ws.HandleFeePresets)
+	rt.handle("GET", "/api/utxos", ws.HandleListUnspent)
+	rt.handle("GET", "/api/wallet/stats", ws.HandleWalletStats)
+	rt.handle("POST", "/api/wallet/backup", ws.HandleWalletBackup)
+	rt.handle("POST", "/api/wallet/restore", ws.HandleWalletRestore)
+	rt.handle("POST", "/api/wallet/rescan", ws.HandleRescan)
+	rt.handle("GET", "/api/wallet/jobs", ws.HandleWalletJobs)
+	rt.handle("GET", "/api/wallet/jobs/{id}", ws.HandleWalletJob)
+	rt.handle("POST", "/api/wallet/jobs/{id}/abort", ws.HandleWalletJob)
+	rt.handle("GET", "/api/utxos/locked", ws.HandleListLockedUTXOs)
+	rt.handle("POST", "/api/utxos/lock", ws.HandleLockUTXOs)
+	rt.handle("POST", "/api/utxos/unlock", ws.HandleUnlockUTXOs)
+	rt.handle("POST", "/api/bumpfee", ws.HandleBumpFee)
+	rt.handle("POST", "/api/cpfp", ws.HandleCPFP)
+	rt.handle("GET", "/api/amount-words", ws.HandleAmountWords)
+	rt.handle("POST", "/api/session/open", ws.HandleOpenSession)
+	rt.handle("POST", "/api/session/close", ws.HandleCloseSession)
+	rt.handle("POST", "/api/session/balance", ws.HandleSessionBalance)
+	rt.handle("POST", "/api/session/history", ws.HandleSessionHistory)
+	rt.handle("POST", "/api/local/send", ws.HandleLocalSend)
+	rt.handle("POST", "/api/sweep", ws.HandleSweep)
+	rt.handle("POST", "/api/psbt/create", ws.HandlePSBTCreate)
+	rt.handle("POST", "/api/psbt/process", ws.HandlePSBTProcess)
+	rt.handle("POST", "/api/psbt/finalize", ws.HandlePSBTFinalize)
+	rt.handle("POST", "/api/psbt/import", ws.HandlePSBTImport)
+	rt.handle("POST", "/api/psbt/export", ws.HandlePSBTExport)
+	rt.handle("POST", "/api/broadcast", ws.HandleBroadcast)
+	rt.handle("GET POST", "/api/psbt/requests", ws.HandleSigningRequests)
+	rt.handle("GET", "/api/psbt/requests/{id}", ws.signingRequestRoute(""))
+	rt.handle("GET", "/api/psbt/requests/{id}/psbt", ws.signingRequestRoute("psbt"))
+	rt.handle("GET", "/api/psbt/requests/{id}/qr", ws.signingRequestRoute("qr"))
+	rt.handle("GET", "/api/psbt/requests/{id}/qr/{frame}", ws.signingRequestRoute("qr/frame"))
+	rt.handle("POST", "/api/psbt/requests/{id}/signed", ws.signingRequestRoute("signed"))
+	rt.handle("POST", "/api/psbt/requests/{id}/broadcast", ws.signingRequestRoute("broadcast"))
+	rt.handle("POST", "/api/psbt/requests/{id}/cancel", ws.signingRequestRoute("cancel"))
+	rt.handle("GET POST", "/api/multisig", ws.HandleMultisigWallets)
+	rt.handle("GET", "/api/multisig/{id}", ws.HandleMultisigWallet)
+	rt.handle("POST", "/api/multisig/{id}/spend", ws.HandleMultisigWallet)
+	rt.handle("POST", "/api/import", ws.HandleImportKey)
+	rt.handle("POST", "/api/import-mnemonic", ws.HandleMnemonicToWIF)
+	rt.handle("POST", "/api/export-key", ws.HandleExportKey)
+	rt.handle("POST", "/api/new-wallet", ws.HandleNewWallet)
+	rt.handle("POST", "/api/new-address", ws.HandleNewAddress)
+	rt.handle("GET", "/api/transactions", ws.withWalletETag(ws.HandleListTransactions))
+	rt.handle("GET", "/api/transactions/export", ws.HandleExportTransactions)
+	rt.handle("POST", "/api/transaction/{txid}/abandon", withTxid(ws.serveAbandonTransaction))
+	rt.handle("GET POST DELETE", "/api/transaction/{txid}/watch", withTxid(ws.serveTransactionWatch))
+	rt.handle("GET PATCH DELETE", "/api/transaction/{txid}/metadata", withTxid(ws.serveTransactionMetadata))
+	rt.handle("GET", "/api/tags", ws.withWalletETag(ws.HandleTags))
+	rt.handle("GET", "/api/reports/tags", ws.withWalletETag(ws.HandleTagReport))
+	rt.handle("GET", "/api/search", ws.HandleSearch)
+	rt.handle("GET POST", "/api/graphql", ws.HandleGraphQL)
+	rt.handle("GET", "/api/notifications", ws.HandleNotifications)
+	rt.handle("GET", "/api/notifications/unread", ws.HandleUnreadNotifications)
+	rt.handle("POST", "/api/notifications/read", ws.HandleMarkNotificationsRead)
+	rt.handle("GET", "/api/addresses", ws.HandleGetAddresses)
+	rt.handle("POST", "/api/addresses/bulk", ws.HandleBulkAddresses)
+	rt.handle("GET", "/api/addresses/groupings", ws.HandleAddressGroupings)
+	rt.handle("GET POST", "/api/contacts", ws.HandleContacts)
+	rt.handle("GET PUT DELETE", "/api/contacts/{id}", ws.HandleContact)
+	rt.handle("GET", "/api/address/{address}/transactions", withPathParam("address", ws.serveAddressTransactions))
+	rt.handle("GET", "/api/address/{address}/qr", withPathParam("address", ws.serveAddressQR))
+	rt.handle("GET", "/api/address/{address}/received", withPathParam("address", ws.serveAddressReceived))
+	rt.handle("POST DELETE", "/api/address/{address}/watch", withPathParam("address", ws.serveAddressWatch))
+	rt.handle("GET", "/api/qr", ws.HandleQR)
+	rt.handle("GET", "/api/payment-uri", ws.HandlePaymentURI)
+	rt.handle("GET", "/api/price", ws.HandlePrice)
+	rt.handle("POST", "/api/getnewaddress", deprecatedRoute("/api/getnewaddress", ws.HandleGetNewAddress))
+	rt.handle("POST", "/api/generate-address", ws.HandleGenerateAddress)
+	rt.handle("POST", "/api/validateaddress", ws.HandleValidateAddress)
+	rt.handle("GET", "/api/address-info", ws.HandleAddressInfo)
+	rt.handle("GET", "/api/check-wallet", ws.HandleCheckWallet)
+	rt.handle("GET", "/api/network-info", ws.HandleNetworkInfo)
+	rt.handle("GET", "/api/network/peers", ws.HandlePeers)
+	rt.handle("GET", "/api/network/traffic", ws.HandleTraffic)
+	rt.handle("GET", "/api/blockchain-info", ws.HandleBlockchainInfo)
+	rt.handle("GET", "/api/mining/immature", ws.withWalletETag(ws.HandleImmature))
+	rt.handle("GET", "/api/fees/history", ws.HandleFeeHistory)
+	rt.handle("GET POST", "/api/scheduler/rules", ws.HandleSendRules)
+	rt.handle("GET", "/api/scheduler/rules/{id}", ws.HandleSendRuleAction)
+	rt.handle("POST", "/api/scheduler/rules/{id}/cancel", ws.HandleSendRuleAction)
+	rt.handle("GET", "/api/deprecations", ws.HandleDeprecations)
+	rt.handle("GET", "/api/status", ws.HandleStatus)
+	rt.handle("GET", "/api/selftest", ws.HandleSelfTest)
+	rt.handle("GET POST", "/api/checkout", ws.HandleCheckouts)
+	rt.handle("GET", "/api/checkout/{id}", ws.HandleCheckout)
+	rt.handle("GET", "/api/pay/{id}", ws.HandlePayStatus)
+	rt.handle("GET", "/pay/{id}", ws.HandlePay)
+	rt.handle("GET", "/ws", ws.HandleWebSocket)
+	if ws.oidc != nil {
+		rt.handle("GET", "/auth/login", ws.HandleOIDCLogin)
+		rt.handle("GET", "/auth/callback", ws.HandleOIDCCallback)
+		rt.handle("GET POST", "/auth/logout", ws.HandleOIDCLogout)
+		rt.handle("GET", "/api/auth/me", ws.HandleAuthMe)
+	}
+	if ws.tenants != nil {
+		rt.handle("GET", "/api/account", ws.HandleAccount)
+		rt.handle("GET POST", "/api/admin/users", ws.HandleUsers)
+		rt.handle("GET PUT DELETE", "/api/admin/users/{username}", ws.HandleUser)
+	}
+	rt.handle("GET", "/api/events", ws.HandleEvents)
+	rt.handle("GET", "/api/wait", ws.HandleWait)
+
+	// Developer helpers (refuse to run unless the node is on regtest)
+	rt.handle("POST", "/api/dev/mine", ws.HandleDevMine)
+	rt.handle("POST", "/api/dev/faucet", ws.HandleDevFaucet)
+	rt.handle("POST", "/api/dev/reset", ws.HandleDevReset)
+
+	// The web UI, which routes the rest of the paths itself
+	rt.handle("GET", "/", ws.HandleIndex)
+	rt.handle("GET", "/static/", http.FileServer(http.FS(ws.assets)).ServeHTTP)
+	return rt
+}
+
+// handler is the routes inside the middleware every request goes through
+func (ws *WalletServer) handler(cfg Config) (http.Handler, error) {
+	trusted, err := parseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outermost first
+	stack := []middleware{
+		withRequestID,
+		// Before the access log and rate limiter so they see the real client
+		func(h http.Handler) http.Handler { return withForwardedFor(trusted, h) },
+	}
+	// The access log sits outside the rest so rejected requests and panics
+	// are logged
+	if cfg.Log.Access {
+		stack = append(stack, func(h http.Handler) http.Handler { return withAccessLog(cfg.Log.AccessSkip, h) })
+	}
+	stack = append(stack,
+		func(h http.Handler) http.Handler { return mountAt(basePath, h) },
+		func(h http.Handler) http.Handler { return withRecovery(ws.errorReports, h) },
+		func(h http.Handler) http.Handler { return withErrorCodes(ws.messages, h) },
+		withAmountUnits,
+		// Outside the rate limit and auth, so browsers can read their
+		// refusals and preflights need no credentials
+		func(h http.Handler) http.Handler { return withCORS(cfg.Server.CORSOrigins, h) },
+		// Before auth so password guessing is throttled too. Always
+		// installed so a config reload can turn it on.
+		func(h http.Handler) http.Handler { return withRateLimit(ws.limiter, h) },
+	)
+	if ws.oidc != nil {
+		stack = append(stack, func(h http.Handler) http.Handler { return withOIDCAuth(ws.oidc, h) })
+	}
+	if ws.tenants != nil {
+		stack = append(stack, func(h http.Handler) http.Handler { return ws.withTenants(cfg.Auth, h) })
+	} else if cfg.Auth.Enabled() {
+		stack = append(stack, func(h http.Handler) http.Handler { return withBasicAuth(cfg.Auth, h) })
+	}
+	if ws.broadcastOnly {
+		stack = append(stack, withBroadcastOnlyGuard)
+	}
+	stack = append(stack, ws.withReadOnlyGuard)
+	return chain(ws.routes(), stack...), nil
+}
+
+// StartServer serves HTTP (or HTTPS when TLS is configured) until SIGINT or
+// SIGTERM, then stops accepting connections and waits up to
+// cfg.Server.ShutdownTimeout for in-flight requests
+func (ws *WalletServer) StartServer(cfg Config) error {
+	handler, err := ws.handler(cfg)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:           cfg.Server.Listen,
+		Handler:        handler,
+		ReadTimeout:    time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:   time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:    time.Duration(cfg.Server.IdleTimeout),
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	// Event streams never go idle, so end them when shutdown starts
+	srv.RegisterOnShutdown(ws.events.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLS.Enabled() {
+			log.Printf("[SERVER] Starting wallet server on https://%s", cfg.Server.Listen)
+			serveErr <- srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			return
+		}
+		log.Printf("[SERVER] Starting wallet server on %s", cfg.Server.Listen)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("[SERVER] Shutting down; waiting up to %s for requests to finish", time.Duration(cfg.Server.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	log.Printf("[SERVER] Stopped")
+	return nil
+}
+
+// InitializeWalletFromEnv loads and imports a wallet from the WALLET_WIF environment variable
+func (ws *WalletServer) InitializeWalletFromEnv() error {
+	walletWIF := os.Getenv("WALLET_WIF")
+	if walletWIF == "" {
+		log.Printf("[INIT] No WALLET_WIF environment variable set - wallet will need to be imported manually")
+		return nil
+	}
+
+	log.Printf("[INIT] Loading wallet from WALLET_WIF environment variable...")
+	_, err := ws.rpcClient.ImportPrivateKey(walletWIF, true)
+	if err != nil {
+		log.Printf("[INIT] WARNING: Failed to import wallet from WALLET_WIF: %v", err)
+		return err
+	}
+
+	log.Printf("[INIT] Wallet successfully imported from WALLET_WIF")
+	return nil
+}
+
+// demoBlockInterval is how often the demo node mines a block: often enough
+// to watch transactions confirm
+const demoBlockInterval = 30 * time.Second
+
+// Main runs the web wallet with the command line arguments args (without
+// the program name) until it is stopped. It exits the process on failure.
+func Main(args []string) {
+	cfg, printOnly, err := loadConfig(args)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatalf("[ERROR] Invalid configuration: %v", err)
+	}
+	if printOnly {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		return
+	}
+
+	if err := setupLogging(cfg.Log); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
+	// Keys and addresses are made for, and checked against, the node's chain
+	if err := hdwallet.UseNetwork(cfg.Network); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
+	if cfg.Demo {
+		// The simulated node stands in for kernelcoind, and nothing
+		// outlives the process
+		url, err := demo.NewNode(cfg.Network).Start(demoBlockInterval)
+		if err != nil {
+			log.Fatalf("[ERROR] %v", err)
+		}
+		cfg.RPC = RPCConfig{URL: url, User: "demo", Password: "demo"}
+		cfg.StorePath = ":memory:"
+		log.Printf("[INIT] Demo mode: simulated node at %s mining a block every %s; nothing is stored", url, demoBlockInterval)
+	}
+
+	prices, err := priceServiceFromConfig(cfg.Prices)
+	if err != nil {
+		log.Fatalf("[ERROR] Invalid price configuration: %v", err)
+	}
+
+	basePath = cfg.Server.BasePath
+
+	// Amounts are JSON strings by default; "number" restores the old floats
+	if cfg.AmountFormat == "number" {
+		rpc.AmountsAsNumbers = true
+		log.Printf("[INIT] AMOUNT_FORMAT=number: amounts are returned as JSON numbers (compatibility mode)")
+	}
+	if err := setTimeZone(cfg.TimeZone); err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
+	assets, err := assetsFS(cfg.Server.AssetsDir)
+	if err != nil {
+		log.Fatalf("[ERROR] %v", err)
+	}
+
+	messages, err := loadMessageCatalogs(cfg.MessagesDir)
+	if err != nil {
+		log.Fatalf("[ERROR] Invalid message catalogs: %v", err)
+	}
+
+	log.Printf("[INIT] Kernelcoin Web Wallet")
+	if cfg.Backend == BackendElectrum {
+		log.Printf("[INIT] Backend: Electrum server %s", cfg.Electrum.Server)
+	} else {
+		log.Printf("[INIT] RPC URL: %s", cfg.RPC.URL)
+		log.Printf("[INIT] RPC User: %s", cfg.RPC.User)
+	}
+	log.Printf("[INIT] Listen Address: %s", cfg.Server.Listen)
+	if basePath != "" {
+		log.Printf("[INIT] Base path: %s", basePath)
+	}
+	log.Printf("[INIT] TLS: %v, basic auth: %v, rate limit: %g/s", cfg.TLS.Enabled(), cfg.Auth.Enabled(), cfg.RateLimit.RequestsPerSecond)
+	log.Printf("[INIT] Sensitive response encryption: %s", cfg.SensitiveResponseEncryption)
+	log.Printf("[INIT] Local store: %s", cfg.StorePath)
+	if cfg.Server.AssetsDir != "" {
+		log.Printf("[INIT] Serving frontend from %s instead of the embedded copy", cfg.Server.AssetsDir)
+	}
+
+	store, err := OpenStore(cfg.StorePath)
+	if err != nil {
+		log.Fatalf("[ERROR] Failed to open local store: %v", err)
+	}
+	defer store.Close()
+
+	// Create wallet server
+	rpcClient := rpc.NewClient(cfg.RPC.URL, cfg.RPC.User, cfg.RPC.Password)
+	rpcClient.SetLogger(logLine)
+	rpcClient.SetBalanceTTL(time.Duration(cfg.Cache.BalanceTTL))
+	server := NewWalletServerWithBackend(rpcClient)
+	server.store = store
+	server.responseEncryption = cfg.SensitiveResponseEncryption
+	server.sessionIdleTimeout = time.Duration(cfg.Intervals.SessionIdleTimeout)
+	server.prices.Store(prices)
+	server.assets = assets
+	server.messages = messages
+	server.limiter.update(cfg.RateLimit)
+	server.network = cfg.Network
+	server.checkout = cfg.Checkout
+	server.fees = cfg.Fees
+	server.backupDir = cfg.BackupDir
+	server.broadcastOnly = cfg.BroadcastOnly
+	if cfg.Backend == BackendElectrum {
+		// Validate has already parsed the server
+		server.electrum, _ = newElectrumClient(cfg.Electrum)
+	}
+	if cfg.KeyExport.TOTPSecret != "" {
+		// Validate has already decoded the secret
+		server.keyExport, _ = newKeyExportGuard(cfg.KeyExport)
+		log.Printf("[INIT] Private key export enabled behind an authenticator code")
+	}
+	if cfg.OIDC.Enabled() {
+		server.oidc = newOIDCProvider(cfg.OIDC)
+		log.Printf("[INIT] Logging users in through OIDC provider %s", cfg.OIDC.Issuer)
+	}
+	if cfg.Errors.DSN != "" {
+		server.errorReports, err = newErrorReporter(cfg.Errors.DSN, cfg.Errors.Environment)
+		if err != nil {
+			log.Fatalf("[ERROR] Invalid error reporting configuration: %v", err)
+		}
+		log.Printf("[INIT] Reporting errors to a Sentry-compatible collector")
+	}
+	if cfg.MultiUser.Enabled {
+		server.tenants = newTenants(cfg.MultiUser)
+		if server.oidc != nil {
+			server.oidc.multiUser = true
+		}
+		log.Printf("[INIT] Multi-user mode: users' wallets are named %s<username>", cfg.MultiUser.WalletPrefix)
+	}
+	// The transaction cache follows the default wallet alone
+	if cfg.Cache.TxSyncInterval > 0 && !cfg.MultiUser.Enabled {
+		server.txSync = newTxSyncState()
+	}
+
+	if err := server.StartupCheck(cfg.StartupCheck, cfg.Network); err != nil {
+		log.Fatalf("[ERROR] Backend check failed: %v", err)
+	}
+	if server.tenants != nil {
+		server.loadUserWallets()
+	}
+
+	// Initialize wallet from environment variable if provided. The key goes
+	// into the node wallet, so there is nothing to do without a node, and
+	// broadcast-only servers must not take keys at all.
+	if cfg.BroadcastOnly {
+		log.Printf("[INIT] Broadcast-only mode: endpoints that handle private keys are disabled")
+		server.checkWatchOnlyWallet()
+	} else if cfg.Backend == BackendNode {
+		if err := server.InitializeWalletFromEnv(); err != nil {
+			log.Printf("[INIT] WARNING: Could not initialize wallet from environment: %v", err)
+		}
+	}
+
+	// Background tasks. Without a node there is no node wallet to watch or
+	// send from, so only sessions work.
+	if cfg.Backend == BackendNode {
+		feeSampleInterval := time.Duration(cfg.Intervals.FeeSample)
+		eventPollInterval := time.Duration(cfg.Intervals.EventPoll)
+		go server.RunFeeSampler(feeSampleInterval)
+		if !cfg.BroadcastOnly {
+			// Scheduled sends need the wallet's keys
+			go server.RunScheduler(time.Duration(cfg.Intervals.Scheduler), 2*feeSampleInterval)
+		}
+		go server.RunWalletWatcher(eventPollInterval)
+		go server.RunTxWatcher(eventPollInterval)
+		go server.RunCheckoutMonitor(eventPollInterval)
+		go server.RunChainStatePoller(time.Duration(cfg.Cache.ChainPollInterval))
+		if server.txSync != nil {
+			go server.RunTransactionSync(time.Duration(cfg.Cache.TxSyncInterval))
+		}
+		if cfg.Notifications.Enabled {
+			go server.RunNotifier(cfg.Notifications)
+		}
+	}
+	if cfg.Debug.Enabled {
+		go server.RunDebugServer(cfg.Debug.Addr)
+	}
+	if cfg.Telegram.Enabled() {
+		bot, _ := newTelegramBot(cfg.Telegram) // checked by Validate
+		go server.RunTelegramBot(bot)
+	}
+	if cfg.Tor.Onion {
+		go RunOnionService(cfg.Tor, cfg.Server.Listen)
+	}
+	go server.RunConfigReloader(args, cfg)
+
+	// Start server
+	if err := server.StartServer(cfg); err != nil {
+		log.Fatalf("[ERROR] Failed to start server: %v", err)
+	}
+}
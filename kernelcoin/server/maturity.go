@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// coinbaseMaturity is how many blocks must follow a coinbase before its
+	// outputs can be spent; the wallet counts it as immature until it has
+	// coinbaseMaturity+1 confirmations
+	coinbaseMaturity = 100
+
+	// blockSpacingSample is how many recent blocks the block time estimate
+	// for maturity ETAs averages over
+	blockSpacingSample = 100
+)
+
+// ImmatureOutput is a mined reward that can't be spent yet
+type ImmatureOutput struct {
+	Txid            string     `json:"txid"`
+	Vout            int        `json:"vout"`
+	Address         string     `json:"address"`
+	Amount          rpc.Amount `json:"amount"`
+	Confirmations   int        `json:"confirmations"`
+	BlockHeight     int64      `json:"block_height"`     // the block it was mined in
+	BlocksRemaining int        `json:"blocks_remaining"` // until it is spendable
+	MatureHeight    int64      `json:"mature_height"`    // the tip height at which it is spendable
+	ETA             int64      `json:"eta,omitempty"`    // unix seconds, from the recent block time
+}
+
+type ImmatureResponse struct {
+	Success      bool             `json:"success"`
+	Height       int64            `json:"height"`
+	Maturity     int              `json:"maturity"`
+	BlockSpacing float64          `json:"block_spacing,omitempty"` // recent average, seconds
+	Total        rpc.Amount       `json:"total"`
+	Outputs      []ImmatureOutput `json:"outputs"` // soonest first
+	Error        string           `json:"error,omitempty"`
+}
+
+// blockSpacing is the average time between the last blockSpacingSample
+// blocks below height, in seconds
+func blockSpacing(rpc rpc.WalletBackend, height int64) (float64, error) {
+	sample := min(height, blockSpacingSample)
+	if sample == 0 {
+		return 0, nil
+	}
+	newest, err := rpc.GetBlockTime(height)
+	if err != nil {
+		return 0, err
+	}
+	oldest, err := rpc.GetBlockTime(height - sample)
+	if err != nil {
+		return 0, err
+	}
+	return float64(newest-oldest) / float64(sample), nil
+}
+
+// HandleImmature lists the wallet's immature coinbase outputs with when
+// each becomes spendable, for miners
+func (ws *WalletServer) HandleImmature(w http.ResponseWriter, r *http.Request) {
+	rpc := ws.rpc(r)
+	height, _, err := rpc.GetBestBlock()
+	if err != nil {
+		logRequest(r, "[API] Immature ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ImmatureResponse{
+			Success: false,
+			Error:   "Failed to get the chain height",
+		})
+		return
+	}
+
+	txs, _, err := ws.filteredTransactions(ws.rpc(r), TransactionFilter{Categories: map[string]bool{"immature": true}}, PageParams{Count: maxTransactionScan})
+	if err != nil {
+		logRequest(r, "[API] Immature ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ImmatureResponse{
+			Success: false,
+			Error:   "Failed to list transactions",
+		})
+		return
+	}
+
+	response := ImmatureResponse{Success: true, Height: height, Maturity: coinbaseMaturity, Outputs: []ImmatureOutput{}}
+	if len(txs) > 0 {
+		// ETAs are left out rather than failing the listing
+		if response.BlockSpacing, err = blockSpacing(rpc, height); err != nil {
+			logRequest(r, "[API] Immature WARNING: no block time estimate: %v", err)
+		}
+	}
+
+	// Oldest first, so the soonest to mature come first
+	now := time.Now().Unix()
+	for _, tx := range txs {
+		if tx.Confirmations < 1 {
+			continue
+		}
+		remaining := max(coinbaseMaturity+1-tx.Confirmations, 0)
+		output := ImmatureOutput{
+			Txid:            tx.Txid,
+			Vout:            tx.Vout,
+			Address:         tx.Address,
+			Amount:          tx.Amount,
+			Confirmations:   tx.Confirmations,
+			BlockHeight:     height - int64(tx.Confirmations) + 1,
+			BlocksRemaining: remaining,
+			MatureHeight:    height + int64(remaining),
+		}
+		if response.BlockSpacing > 0 {
+			output.ETA = now + int64(float64(remaining)*response.BlockSpacing)
+		}
+		response.Outputs = append(response.Outputs, output)
+		response.Total += tx.Amount
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// maxConfTarget is the longest confirmation target the node estimates fees for
+const maxConfTarget = 1008
+
+type MaxSendResponse struct {
+	Success    bool       `json:"success"`
+	ToAddress  string     `json:"to_address,omitempty"`
+	Amount     rpc.Amount `json:"amount"`
+	Fee        rpc.Amount `json:"fee"`
+	Inputs     int        `json:"inputs"`
+	ConfTarget int        `json:"conf_target,omitempty"`
+	// Total is the coins swept, Amount plus Fee; absent when the send limit
+	// caps Amount
+	Total rpc.Amount `json:"total,omitempty"`
+	// LimitedBySendLimit is set when the user's daily send limit, not the
+	// balance, caps the amount
+	LimitedBySendLimit bool   `json:"limited_by_send_limit,omitempty"`
+	Error              string `json:"error,omitempty"`
+}
+
+// HandleMaxSend reports the largest amount a send to the "to" address can
+// carry right now: every confirmed, spendable output less the fee of the
+// transaction spending them all, at the node's estimate for conf_target
+// blocks (the wallet default without one). Locked coins are left out, as
+// listunspent doesn't return them. Nothing is signed or broadcast. The fee
+// comes out of the coins swept: POST /api/send-max sends the same coins,
+// and without conf_target sends this amount.
+func (ws *WalletServer) HandleMaxSend(w http.ResponseWriter, r *http.Request) {
+	toAddress := r.URL.Query().Get("to")
+	valid, err := ws.rpc(r).ValidateAddress(toAddress)
+	if toAddress == "" || err != nil || !valid {
+		logRequest(r, "[API] MaxSend ERROR: Invalid address %q - %v", toAddress, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MaxSendResponse{
+			Success: false,
+			Error:   "Invalid recipient address",
+		})
+		return
+	}
+
+	confTarget := 0
+	if v := r.URL.Query().Get("conf_target"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxConfTarget {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(MaxSendResponse{
+				Success: false,
+				Error:   fmt.Sprintf("conf_target must be between 1 and %d", maxConfTarget),
+			})
+			return
+		}
+		confTarget = n
+	}
+
+	inputs, total, err := sweepableCoins(ws.rpc(r))
+	if err != nil {
+		logRequest(r, "[API] MaxSend ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MaxSendResponse{
+			Success: false,
+			Error:   "Failed to list unspent outputs",
+		})
+		return
+	}
+
+	response := MaxSendResponse{Success: true, ToAddress: toAddress, ConfTarget: confTarget}
+	if total > 0 {
+		funded, err := sweepDraft(ws.rpc(r), inputs, toAddress, total, confTarget)
+		if err != nil {
+			logRequest(r, "[API] MaxSend ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(MaxSendResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Cannot build transaction: %v", err),
+			})
+			return
+		}
+		response.Amount = total - funded.Fee
+		response.Fee = funded.Fee
+		response.Total = total
+		response.Inputs = len(inputs)
+	}
+
+	if user := requestWalletUser(r); user != nil && user.DailySendLimit != nil {
+		sent, err := ws.store.UserSentSince(user.Username, time.Now().Add(-sendLimitWindow).Unix())
+		if err != nil {
+			logRequest(r, "[API] MaxSend ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(MaxSendResponse{
+				Success: false,
+				Error:   "Failed to check the send limit",
+			})
+			return
+		}
+		left := *user.DailySendLimit - sent
+		if left < 0 {
+			left = 0
+		}
+		if response.Amount > left {
+			response.Amount = left
+			response.Total = 0
+			response.LimitedBySendLimit = true
+		}
+	}
+
+	logRequest(r, "[API] MaxSend: %s KCN to %s from %d inputs, fee %s", response.Amount, toAddress, response.Inputs, response.Fee)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// sweepableCoins returns the wallet's confirmed, spendable outputs and
+// their total: the coins /api/max-send prices and /api/send-max spends
+func sweepableCoins(client rpc.WalletBackend) ([]rpc.Outpoint, rpc.Amount, error) {
+	utxos, err := client.ListUnspent(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	inputs := []rpc.Outpoint{}
+	var total rpc.Amount
+	for _, utxo := range utxos {
+		if utxo.Spendable && utxo.Safe {
+			inputs = append(inputs, rpc.Outpoint{Txid: utxo.Txid, Vout: utxo.Vout})
+			total += utxo.Amount
+		}
+	}
+	return inputs, total, nil
+}
+
+// sweepDraft funds, but does not sign, a draft sending total, all of
+// inputs, to one address, with the fee taken out of that output so there is
+// no change
+func sweepDraft(client rpc.WalletBackend, inputs []rpc.Outpoint, toAddress string, total rpc.Amount, confTarget int) (*rpc.FundedTransaction, error) {
+	raw, err := client.CreateRawTransaction(inputs, []map[string]interface{}{
+		{toAddress: total.Number()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	options := map[string]interface{}{
+		"add_inputs":             false,
+		"subtractFeeFromOutputs": []int{0},
+	}
+	if confTarget > 0 {
+		options["conf_target"] = confTarget
+	}
+	funded, err := client.FundRawTransaction(raw, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fund transaction: %w", err)
+	}
+	return funded, nil
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// middleware wraps a handler with behaviour every request shares
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in stack, the first middleware outermost: a request passes
+// through them in the order they are listed
+func chain(h http.Handler, stack ...middleware) http.Handler {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] != nil {
+			h = stack[i](h)
+		}
+	}
+	return h
+}
+
+// corsMethods are the methods a preflight may ask for; the router still
+// answers 405 for those a route doesn't take
+const corsMethods = "GET, HEAD, POST, PUT, PATCH, DELETE"
+
+// withCORS lets web pages from origins (scheme://host[:port], or "*" for
+// any) call the API. Preflights from them are answered here, before
+// authentication, since browsers send them without credentials. Cookies
+// are not shared, so cross-origin clients authenticate with a header.
+func withCORS(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.ToLower(origin)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") || !(allowed["*"] || allowed[strings.ToLower(origin)]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "Allow, Content-Language, Retry-After, X-Request-ID")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validCORSOrigin reports whether origin is "*" or a bare scheme://host
+func validCORSOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
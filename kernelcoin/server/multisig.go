@@ -0,0 +1,363 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// maxMultisigKeys is the most participants the node accepts, for
+	// segwit; legacy P2SH fits fewer and the node says so
+	maxMultisigKeys = 20
+	// maxMultisigNameLength bounds a multisig wallet's name
+	maxMultisigNameLength = 100
+)
+
+// MultisigWallet is an m-of-n address shared by co-signers. The node wallet
+// watches it; spends are signing requests that each co-signer signs with
+// their own device until Required signatures are in.
+type MultisigWallet struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Required     int      `json:"required"`
+	PubKeys      []string `json:"pubkeys"` // in script order
+	AddressType  string   `json:"address_type"`
+	Address      string   `json:"address"`
+	RedeemScript string   `json:"redeem_script"`
+	Descriptor   string   `json:"descriptor,omitempty"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+type MultisigCreateRequest struct {
+	Name        string   `json:"name"`
+	Required    int      `json:"required"`
+	PubKeys     []string `json:"pubkeys"`
+	AddressType string   `json:"address_type,omitempty"` // legacy, p2sh-segwit or bech32 (default)
+}
+
+type MultisigResponse struct {
+	Success bool            `json:"success"`
+	Wallet  *MultisigWallet `json:"wallet,omitempty"`
+	Balance *AddressBalance `json:"balance,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type MultisigListResponse struct {
+	Success bool             `json:"success"`
+	Wallets []MultisigWallet `json:"wallets"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// CosignerStatus shows which participants have signed a multisig spend.
+// A participant counts once they have signed every input.
+type CosignerStatus struct {
+	Required int      `json:"required"`
+	Signed   []string `json:"signed"`
+	Pending  []string `json:"pending"`
+}
+
+const multisigColumns = `id, name, required, pubkeys, address_type, address, redeem_script, descriptor, created_at`
+
+func scanMultisig(row interface{ Scan(...interface{}) error }) (MultisigWallet, error) {
+	var m MultisigWallet
+	var pubkeys string
+	err := row.Scan(&m.ID, &m.Name, &m.Required, &pubkeys, &m.AddressType, &m.Address, &m.RedeemScript, &m.Descriptor, &m.CreatedAt)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal([]byte(pubkeys), &m.PubKeys)
+	return m, err
+}
+
+// SaveMultisig stores a new multisig wallet
+func (s *Store) SaveMultisig(m MultisigWallet) error {
+	pubkeys, err := json.Marshal(m.PubKeys)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO multisig_wallets (`+multisigColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, m.Name, m.Required, string(pubkeys), m.AddressType, m.Address, m.RedeemScript, m.Descriptor, m.CreatedAt)
+	return err
+}
+
+// Multisig returns the multisig wallet with id, or nil if there is none
+func (s *Store) Multisig(id string) (*MultisigWallet, error) {
+	m, err := scanMultisig(s.db.QueryRow(`SELECT `+multisigColumns+` FROM multisig_wallets WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Multisigs returns every multisig wallet, oldest first
+func (s *Store) Multisigs() ([]MultisigWallet, error) {
+	rows, err := s.db.Query(`SELECT ` + multisigColumns + ` FROM multisig_wallets ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := []MultisigWallet{}
+	for rows.Next() {
+		m, err := scanMultisig(rows)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, m)
+	}
+	return wallets, rows.Err()
+}
+
+// validateMultisigRequest checks req and fills in the default address
+// type, returning a message for the client if it is invalid
+func validateMultisigRequest(req *MultisigCreateRequest) string {
+	if req.Name == "" || len(req.Name) > maxMultisigNameLength {
+		return fmt.Sprintf("name is required and may be at most %d characters", maxMultisigNameLength)
+	}
+	if len(req.PubKeys) == 0 || len(req.PubKeys) > maxMultisigKeys {
+		return fmt.Sprintf("Give between 1 and %d pubkeys", maxMultisigKeys)
+	}
+	if req.Required < 1 || req.Required > len(req.PubKeys) {
+		return fmt.Sprintf("required must be between 1 and %d, the number of pubkeys", len(req.PubKeys))
+	}
+
+	seen := map[string]bool{}
+	for i, key := range req.PubKeys {
+		key = strings.ToLower(strings.TrimSpace(key))
+		raw, err := hex.DecodeString(key)
+		if err == nil {
+			_, err = btcec.ParsePubKey(raw)
+		}
+		if err != nil {
+			return fmt.Sprintf("pubkey %d is not a valid hex public key", i+1)
+		}
+		if seen[key] {
+			return fmt.Sprintf("pubkey %d is a duplicate", i+1)
+		}
+		seen[key] = true
+		req.PubKeys[i] = key
+	}
+
+	switch req.AddressType {
+	case "":
+		req.AddressType = "bech32"
+	case "legacy", "p2sh-segwit", "bech32":
+	default:
+		return "address_type must be legacy, p2sh-segwit or bech32"
+	}
+	return ""
+}
+
+// multisigInputs returns the confirmed coins of a multisig address
+func multisigInputs(client rpc.WalletBackend, address string) ([]rpc.Outpoint, error) {
+	utxos, err := client.ListUnspent(1)
+	if err != nil {
+		return nil, err
+	}
+	inputs := []rpc.Outpoint{}
+	for _, u := range utxos {
+		if u.Address == address {
+			inputs = append(inputs, rpc.Outpoint{Txid: u.Txid, Vout: u.Vout})
+		}
+	}
+	return inputs, nil
+}
+
+// cosignerStatus reports who has signed a multisig spend, from the partial
+// signatures in its PSBT. It is nil for other signing requests, or when
+// the PSBT can't be read.
+func (ws *WalletServer) cosignerStatus(client rpc.WalletBackend, signing *SigningRequest) *CosignerStatus {
+	if signing.MultisigID == "" {
+		return nil
+	}
+	multisig, err := ws.store.Multisig(signing.MultisigID)
+	if err != nil || multisig == nil {
+		return nil
+	}
+	decoded, err := client.DecodePSBT(signing.PSBT)
+	if err != nil {
+		log.Printf("[MULTISIG] WARNING: cannot read signatures of %s: %v", signing.ID, err)
+		return nil
+	}
+
+	inputs, _ := decoded["inputs"].([]interface{})
+	status := &CosignerStatus{Required: multisig.Required, Signed: []string{}, Pending: []string{}}
+	for _, key := range multisig.PubKeys {
+		signed := len(inputs) > 0
+		for _, input := range inputs {
+			in, _ := input.(map[string]interface{})
+			sigs, _ := in["partial_signatures"].(map[string]interface{})
+			if _, ok := sigs[key]; !ok {
+				signed = false
+				break
+			}
+		}
+		if signed {
+			status.Signed = append(status.Signed, key)
+		} else {
+			status.Pending = append(status.Pending, key)
+		}
+	}
+	return status
+}
+
+// HandleMultisigWallets lists (GET) or creates (POST) multisig wallets.
+// Creating adds the address to the node wallet as watch-only.
+func (ws *WalletServer) HandleMultisigWallets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		wallets, err := ws.store.Multisigs()
+		if err != nil {
+			logRequest(r, "[API] Multisig ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(MultisigListResponse{
+				Success: false,
+				Error:   "Failed to load multisig wallets",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MultisigListResponse{Success: true, Wallets: wallets})
+		return
+
+	case http.MethodPost:
+	}
+
+	var req MultisigCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MultisigResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	if msg := validateMultisigRequest(&req); msg != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MultisigResponse{Success: false, Error: msg})
+		return
+	}
+
+	added, err := ws.rpc(r).AddMultisigAddress(req.Required, req.PubKeys, "multisig "+req.Name, req.AddressType)
+	if err != nil {
+		logRequest(r, "[API] Multisig ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(MultisigResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create multisig address: %v", err),
+		})
+		return
+	}
+
+	id, err := newRecordID()
+	wallet := MultisigWallet{
+		ID:           id,
+		Name:         req.Name,
+		Required:     req.Required,
+		PubKeys:      req.PubKeys,
+		AddressType:  req.AddressType,
+		Address:      added.Address,
+		RedeemScript: added.RedeemScript,
+		Descriptor:   added.Descriptor,
+		CreatedAt:    time.Now().Unix(),
+	}
+	if err == nil {
+		err = ws.store.SaveMultisig(wallet)
+	}
+	if err != nil {
+		logRequest(r, "[API] Multisig ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(MultisigResponse{
+			Success: false,
+			Error:   "Failed to save multisig wallet",
+		})
+		return
+	}
+
+	logRequest(r, "[API] Multisig SUCCESS: %s is %d-of-%d at %s", wallet.Name, wallet.Required, len(wallet.PubKeys), wallet.Address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MultisigResponse{Success: true, Wallet: &wallet})
+}
+
+// HandleMultisigWallet handles /api/multisig/{id} (GET, with the balance)
+// and /api/multisig/{id}/spend (POST), which creates a signing request
+// for the co-signers from a SigningRequestCreate
+func (ws *WalletServer) HandleMultisigWallet(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	// The router takes POST only on the spend route
+	spend := r.Method == http.MethodPost
+
+	multisig, err := ws.store.Multisig(id)
+	if err != nil || multisig == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(MultisigResponse{
+			Success: false,
+			Error:   "Multisig wallet not found",
+		})
+		return
+	}
+
+	if spend {
+		var req SigningRequestCreate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(SigningRequestResponse{
+				Success: false,
+				Error:   "Invalid request format",
+			})
+			return
+		}
+		if req.Label == "" {
+			req.Label = multisig.Name
+		}
+		ws.createSigningRequest(w, r, req, multisig)
+		return
+	}
+
+	utxos, err := ws.rpc(r).ListUnspent(0)
+	if err != nil {
+		logRequest(r, "[API] Multisig ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(MultisigResponse{
+			Success: false,
+			Wallet:  multisig,
+			Error:   fmt.Sprintf("Failed to get balance: %v", err),
+		})
+		return
+	}
+	var balance AddressBalance
+	for _, u := range utxos {
+		if u.Address != multisig.Address {
+			continue
+		}
+		if u.Confirmations > 0 {
+			balance.Confirmed += u.Amount
+		} else {
+			balance.Unconfirmed += u.Amount
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MultisigResponse{Success: true, Wallet: multisig, Balance: &balance})
+}
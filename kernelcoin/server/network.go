@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+type PeersResponse struct {
+	Success  bool           `json:"success"`
+	Peers    []rpc.PeerInfo `json:"peers,omitempty"`
+	Inbound  int            `json:"inbound"`
+	Outbound int            `json:"outbound"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type TrafficResponse struct {
+	Success bool `json:"success"`
+	*rpc.NetTotals
+	Error string `json:"error,omitempty"`
+}
+
+// HandlePeers lists the node's connected peers
+func (ws *WalletServer) HandlePeers(w http.ResponseWriter, r *http.Request) {
+	peers, err := ws.rpc(r).GetPeerInfo()
+	if err != nil {
+		logRequest(r, "[API] Peers ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(PeersResponse{
+			Success: false,
+			Error:   "Failed to get peer info",
+		})
+		return
+	}
+
+	response := PeersResponse{Success: true, Peers: peers}
+	for _, peer := range peers {
+		if peer.Inbound {
+			response.Inbound++
+		} else {
+			response.Outbound++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleTraffic returns the node's total network traffic
+func (ws *WalletServer) HandleTraffic(w http.ResponseWriter, r *http.Request) {
+	totals, err := ws.rpc(r).GetNetTotals()
+	if err != nil {
+		logRequest(r, "[API] Traffic ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TrafficResponse{
+			Success: false,
+			Error:   "Failed to get network traffic",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TrafficResponse{
+		Success:   true,
+		NetTotals: totals,
+	})
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// nodeWarmupWait is how long startup waits for a node that is still
+	// loading its block index
+	nodeWarmupWait = 2 * time.Minute
+	// nodeRecheckInterval is how often a degraded server checks the node
+	// again
+	nodeRecheckInterval = 30 * time.Second
+)
+
+// Startup check modes
+const (
+	StartupCheckFail     = "fail"     // refuse to start
+	StartupCheckDegraded = "degraded" // start read-only until the node checks out
+	StartupCheckOff      = "off"
+)
+
+// nodeStatus is the outcome of the last node check. While degraded the
+// server refuses requests that would change anything.
+type nodeStatus struct {
+	mu        sync.RWMutex
+	degraded  bool
+	reason    string
+	chain     string
+	checkedAt time.Time
+
+	// mode is the startup check mode; with it off the node is not
+	// checked on reconnect either
+	mode string
+	// rechecking is set while the node is being checked again, so there
+	// is one recheck at a time
+	rechecking atomic.Bool
+}
+
+func (s *nodeStatus) set(chain string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degraded = err != nil
+	s.reason = ""
+	if err != nil {
+		s.reason = err.Error()
+	}
+	if chain != "" {
+		s.chain = chain
+	}
+	s.checkedAt = time.Now()
+}
+
+// Chain returns the chain the node reported at the last check
+func (s *nodeStatus) Chain() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.chain
+}
+
+// Degraded returns whether the server is read-only and why
+func (s *nodeStatus) Degraded() (bool, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.degraded, s.reason
+}
+
+// isWarmingUp reports whether err is the node's "still loading" error
+// (RPC_IN_WARMUP, -28)
+func isWarmingUp(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "code:-28")
+}
+
+// checkNode verifies the node answers with our credentials, runs the
+// expected chain and has a wallet loaded. It returns the node's chain.
+func (ws *WalletServer) checkNode(network string) (string, error) {
+	deadline := time.Now().Add(nodeWarmupWait)
+	var info interface{}
+	var err error
+	for {
+		info, err = ws.rpcClient.GetBlockchainInfo()
+		if !isWarmingUp(err) || time.Now().After(deadline) {
+			break
+		}
+		log.Printf("[INIT] Node is still starting up; waiting")
+		time.Sleep(5 * time.Second)
+	}
+	if errors.Is(err, rpc.ErrAuth) {
+		return "", fmt.Errorf("%w: check RPC_USER and RPC_PASS against kernelcoin.conf", err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot query node at %s: %w", ws.rpcClient.URL(), err)
+	}
+
+	m, ok := info.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("unexpected getblockchaininfo response type: %T", info)
+	}
+	chain := rpc.GetString(m, "chain")
+	if chain != network {
+		return chain, fmt.Errorf("node is on the %q chain but network is %q", chain, network)
+	}
+	if err := ws.checkAddressNetwork(network); err != nil {
+		return chain, err
+	}
+
+	if _, err := ws.rpcClient.GetWalletInfo(); err != nil {
+		return chain, fmt.Errorf("node has no usable wallet (createwallet or loadwallet first): %w", err)
+	}
+	return chain, nil
+}
+
+// checkAddressNetwork has the node validate addresses made with the
+// network's parameters. A node reporting the right chain name with other
+// address prefixes (another coin's, or a custom build) would otherwise be
+// paid to, and handed keys for, addresses it doesn't know.
+func (ws *WalletServer) checkAddressNetwork(network string) error {
+	probe := btcutil.Hash160([]byte("kernelcoin webwallet network check"))
+	legacy, err := btcutil.NewAddressPubKeyHash(probe, hdwallet.Params())
+	if err != nil {
+		return err
+	}
+	segwit, err := btcutil.NewAddressWitnessPubKeyHash(probe, hdwallet.Params())
+	if err != nil {
+		return err
+	}
+	for _, addr := range []btcutil.Address{legacy, segwit} {
+		valid, err := ws.rpcClient.ValidateAddress(addr.EncodeAddress())
+		if err != nil {
+			return fmt.Errorf("cannot validate an address with the node: %w", err)
+		}
+		if !valid {
+			return fmt.Errorf("node rejects %s address %s: its address prefixes are not those of Kernelcoin %s", network, addr.EncodeAddress(), network)
+		}
+	}
+	return nil
+}
+
+// checkElectrum verifies the Electrum server answers. The protocol doesn't
+// name the chain, so there is none to compare with the network.
+func (ws *WalletServer) checkElectrum() error {
+	software, err := ws.electrum.Ping()
+	if err != nil {
+		return err
+	}
+	log.Printf("[INIT] Electrum server %s is running %s", ws.electrum.addr, software)
+	return nil
+}
+
+// checkBackend checks the Electrum server with the electrum backend and
+// the node otherwise
+func (ws *WalletServer) checkBackend(network string) (string, error) {
+	if ws.electrum != nil {
+		return "", ws.checkElectrum()
+	}
+	return ws.checkNode(network)
+}
+
+// StartupCheck runs checkBackend before serving. In fail mode a failure is
+// returned for main to exit on; in degraded mode the server starts
+// read-only and keeps checking until the backend is fine.
+func (ws *WalletServer) StartupCheck(mode, network string) error {
+	ws.node.mode = mode
+	if mode == StartupCheckOff {
+		return nil
+	}
+
+	chain, err := ws.checkBackend(network)
+	ws.node.set(chain, err)
+	if err == nil {
+		log.Printf("[INIT] Backend check passed: network %s", network)
+		return nil
+	}
+	if mode == StartupCheckFail {
+		return err
+	}
+
+	log.Printf("[INIT] WARNING: backend check failed, starting read-only: %v", err)
+	go ws.recheckNode(network)
+	return nil
+}
+
+// recheckNode repeats the backend check until it passes, then leaves
+// degraded mode
+func (ws *WalletServer) recheckNode(network string) {
+	if !ws.node.rechecking.CompareAndSwap(false, true) {
+		return
+	}
+	defer ws.node.rechecking.Store(false)
+
+	ticker := time.NewTicker(nodeRecheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		chain, err := ws.checkBackend(network)
+		ws.node.set(chain, err)
+		if err == nil {
+			log.Printf("[INIT] Backend check passed: network %s; leaving read-only mode", network)
+			return
+		}
+		log.Printf("[INIT] WARNING: backend check still failing: %v", err)
+	}
+}
+
+// nodeReconnected checks the node again when it answers after failing, or
+// reports another chain than at the last check: it may have been restarted
+// on another network. Whatever the startup mode, short of off, a failure
+// makes the server read-only until the check passes.
+func (ws *WalletServer) nodeReconnected() {
+	if ws.electrum != nil || ws.node.mode == StartupCheckOff || !ws.node.rechecking.CompareAndSwap(false, true) {
+		return
+	}
+	chain, err := ws.checkNode(ws.network)
+	ws.node.set(chain, err)
+	ws.node.rechecking.Store(false)
+	if err != nil {
+		log.Printf("[POLLER] WARNING: node check failed again, going read-only: %v", err)
+		go ws.recheckNode(ws.network)
+		return
+	}
+	log.Printf("[POLLER] Node check passed again: network %s", ws.network)
+}
+
+// withReadOnlyGuard answers API writes with 503 while the backend check is
+// failing; reads go through and fail or succeed on their own
+func (ws *WalletServer) withReadOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		degraded, reason := ws.node.Degraded()
+		if !degraded || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logRequest(r, "[API] WARNING: refused %s %s in read-only mode", r.Method, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Wallet is read-only until the backend check passes: " + reason,
+			"code":    ErrReadOnly,
+		})
+	})
+}
+
+type StatusResponse struct {
+	Success   bool   `json:"success"`
+	Status    string `json:"status"` // ok or degraded
+	Reason    string `json:"reason,omitempty"`
+	Backend   string `json:"backend"` // node or electrum
+	Network   string `json:"network"`
+	Chain     string `json:"chain,omitempty"`
+	CheckedAt int64  `json:"checked_at,omitempty"`
+	// BroadcastOnly means sending and key import are disabled
+	BroadcastOnly bool `json:"broadcast_only,omitempty"`
+}
+
+// HandleStatus reports whether the server is fully up or read-only
+func (ws *WalletServer) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	ws.node.mu.RLock()
+	response := StatusResponse{
+		Success: true,
+		Status:  "ok",
+		Reason:  ws.node.reason,
+		Backend: BackendNode,
+		Network: ws.network,
+		Chain:   ws.node.chain,
+
+		BroadcastOnly: ws.broadcastOnly,
+	}
+	if ws.electrum != nil {
+		response.Backend = BackendElectrum
+	}
+	if ws.node.degraded {
+		response.Status = "degraded"
+	}
+	if !ws.node.checkedAt.IsZero() {
+		response.CheckedAt = ws.node.checkedAt.Unix()
+	}
+	ws.node.mu.RUnlock()
+
+	response.Reason = ws.messages.forRequest(w, r).translate(response.Reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Notification kinds
+const (
+	NotifyPaymentReceived = "payment_received"
+	NotifySendConfirmed   = "send_confirmed"
+	NotifyNodeOffline     = "node_offline"
+	NotifyLowBalance      = "low_balance"
+	NotifyTxReorged       = "tx_reorged"
+	NotifyTxConflicted    = "tx_conflicted"
+)
+
+// EventNotification carries each new notification to live clients, for
+// the unread counter
+const EventNotification = "notification"
+
+// maxMarkRead bounds the ids of one mark-read request
+const maxMarkRead = 500
+
+// Notification is an entry in the notification center. Each wallet's
+// notifications are seen by its users, and node-wide ones by everyone;
+// Read is the requesting user's own.
+type Notification struct {
+	Owner     string `json:"-"` // whose wallet it is about, or allOwners
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Txid      string `json:"txid,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	Read      bool   `json:"read"`
+}
+
+type NotificationsResponse struct {
+	Success       bool           `json:"success"`
+	Notifications []Notification `json:"notifications,omitempty"` // newest first
+	Unread        int            `json:"unread"`
+	Pagination    *Pagination    `json:"pagination,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// MarkReadRequest marks the notifications listed in IDs read, or every
+// one with All
+type MarkReadRequest struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
+// InsertNotification stores n. It returns false if n is about a
+// transaction that already has a notification of the same kind for the
+// same owner.
+func (s *Store) InsertNotification(n Notification) (bool, error) {
+	result, err := s.db.Exec(`INSERT OR IGNORE INTO notifications (id, owner, kind, title, message, txid, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, n.ID, n.Owner, n.Kind, n.Title, n.Message, n.Txid, n.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted == 1, err
+}
+
+// Notifications returns one page of the notifications owner's users see,
+// newest first, with whether user has read each, and the total number
+// listed
+func (s *Store) Notifications(owner, user string, unreadOnly bool, page PageParams) ([]Notification, int, error) {
+	clause := ""
+	if unreadOnly {
+		clause = " AND r.notification_id IS NULL"
+	}
+	from := ` FROM notifications n
+		LEFT JOIN notification_reads r ON r.notification_id = n.id AND r.user = ?
+		WHERE n.owner IN (?, ?)` + clause
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*)`+from, user, owner, allOwners).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.db.Query(`SELECT n.id, n.kind, n.title, n.message, n.txid, n.created_at, r.notification_id IS NOT NULL`+from+`
+		ORDER BY n.created_at DESC, n.id LIMIT ? OFFSET ?`, user, owner, allOwners, page.Count, page.Skip)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Title, &n.Message, &n.Txid, &n.CreatedAt, &n.Read); err != nil {
+			return nil, 0, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, total, rows.Err()
+}
+
+// UnreadNotifications counts the notifications of owner's that user hasn't
+// read
+func (s *Store) UnreadNotifications(owner, user string) (int, error) {
+	var unread int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM notifications n WHERE n.owner IN (?, ?)
+		AND NOT EXISTS (SELECT 1 FROM notification_reads r WHERE r.notification_id = n.id AND r.user = ?)`,
+		owner, allOwners, user).Scan(&unread)
+	return unread, err
+}
+
+// MarkNotificationsRead marks the given notifications of owner's read for
+// user; nil ids marks them all
+func (s *Store) MarkNotificationsRead(owner, user string, ids []string, at int64) error {
+	where := " WHERE owner IN (?, ?)"
+	args := []interface{}{user, at, owner, allOwners}
+	if ids != nil {
+		if len(ids) == 0 {
+			return nil
+		}
+		where += " AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO notification_reads (notification_id, user, read_at)
+		SELECT id, ?, ? FROM notifications`+where, args...)
+	return err
+}
+
+// PruneNotifications deletes notifications created before cutoff
+func (s *Store) PruneNotifications(cutoff int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM notification_reads
+		WHERE notification_id IN (SELECT id FROM notifications WHERE created_at < ?)`, cutoff); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM notifications WHERE created_at < ?`, cutoff); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RunNotifier turns wallet events into notifications: payments received,
+// sends confirmed, reorged or conflicted transactions, the node going
+// offline, and the balance dropping below cfg.LowBalance. Each goes to the
+// owner of the wallet the event is about. Being subscribed, it keeps the
+// wallet watcher polling.
+func (ws *WalletServer) RunNotifier(cfg NotificationsConfig) {
+	var lowBalance rpc.Amount
+	if cfg.LowBalance != "" {
+		lowBalance, _ = rpc.ParseAmount(cfg.LowBalance) // checked by Validate
+	}
+	retention := time.Duration(cfg.Retention)
+	log.Printf("[NOTIFY] Notification center on, keeping notifications for %s", retention)
+
+	events := ws.events.Subscribe()
+	defer ws.events.Unsubscribe(events)
+
+	// Whose balance is below lowBalance
+	balanceLow := map[string]bool{}
+	for {
+		var ev WalletEvent
+		select {
+		case ev = <-events:
+		case <-ws.events.Done():
+			return
+		}
+
+		var n Notification
+		switch data := ev.Data.(type) {
+		case TransactionResponse:
+			named := []TransactionResponse{data}
+			ws.resolveContacts(ev.Owner, named)
+			tx := named[0]
+			counterparty := tx.Address
+			if tx.Contact != "" {
+				counterparty = fmt.Sprintf("%s (%s)", tx.Contact, tx.Address)
+			}
+			switch {
+			case ev.Type == EventTxReceived:
+				n = Notification{Kind: NotifyPaymentReceived, Txid: tx.Txid,
+					Title:   fmt.Sprintf("Received %s KCN", tx.Amount),
+					Message: fmt.Sprintf("%s KCN to %s", tx.Amount, counterparty)}
+			case ev.Type == EventTxConfirmed && tx.Category == "send":
+				n = Notification{Kind: NotifySendConfirmed, Txid: tx.Txid,
+					Title:   fmt.Sprintf("Payment of %s KCN confirmed", tx.Amount.Abs()),
+					Message: fmt.Sprintf("%s KCN to %s has its first confirmation", tx.Amount.Abs(), counterparty)}
+			}
+
+		case TxReorgEvent:
+			switch ev.Type {
+			case EventTxReorged:
+				n = Notification{Kind: NotifyTxReorged, Txid: data.Txid,
+					Title:   "Transaction lost its confirmations",
+					Message: fmt.Sprintf("%s had %d confirmations before a chain reorganization; it may confirm again", data.Txid, data.PreviousConfirmations)}
+			case EventTxConflicted:
+				n = Notification{Kind: NotifyTxConflicted, Txid: data.Txid,
+					Title:   "Transaction double-spent",
+					Message: fmt.Sprintf("A transaction spending the same coins as %s was mined; it will never confirm", data.Txid)}
+			}
+
+		case BalanceResponse:
+			if lowBalance > 0 {
+				if data.Total < lowBalance && !balanceLow[ev.Owner] {
+					n = Notification{Kind: NotifyLowBalance,
+						Title:   "Low balance",
+						Message: fmt.Sprintf("The balance is %s KCN, below %s KCN", data.Total, lowBalance)}
+				}
+				balanceLow[ev.Owner] = data.Total < lowBalance
+			}
+
+		case map[string]string:
+			if ev.Type == EventNodeDisconnected {
+				n = Notification{Kind: NotifyNodeOffline,
+					Title:   "Node offline",
+					Message: "The wallet cannot reach kernelcoind: " + data["error"]}
+			}
+		}
+		if n.Kind == "" {
+			continue
+		}
+		n.Owner = ev.Owner
+		if err := ws.notify(n, retention); err != nil {
+			log.Printf("[NOTIFY] WARNING: could not store a %s notification: %v", n.Kind, err)
+		}
+	}
+}
+
+// notify stores n, tells its owner's live clients about it and drops
+// notifications older than retention
+func (ws *WalletServer) notify(n Notification, retention time.Duration) error {
+	id, err := newRecordID()
+	if err != nil {
+		return err
+	}
+	n.ID = id
+	n.CreatedAt = time.Now().Unix()
+	inserted, err := ws.store.InsertNotification(n)
+	if err != nil || !inserted {
+		return err
+	}
+	ws.events.PublishFor(n.Owner, EventNotification, n)
+	return ws.store.PruneNotifications(time.Now().Add(-retention).Unix())
+}
+
+// HandleNotifications lists the notification center for the requesting
+// user, newest first; ?unread=true leaves out what they have read
+func (ws *WalletServer) HandleNotifications(w http.ResponseWriter, r *http.Request) {
+	owner, user := walletOwner(r), ws.requestUser(r)
+	page := parsePageParams(r)
+	notifications, total, err := ws.store.Notifications(owner, user, r.URL.Query().Get("unread") == "true", page)
+	var unread int
+	if err == nil {
+		unread, err = ws.store.UnreadNotifications(owner, user)
+	}
+	if err != nil {
+		logRequest(r, "[API] Notifications ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(NotificationsResponse{
+			Success: false,
+			Error:   "Failed to load notifications",
+		})
+		return
+	}
+
+	// Stored in English, so each reader gets their own language
+	catalog := ws.messages.forRequest(w, r)
+	for i := range notifications {
+		notifications[i].Title = catalog.translate(notifications[i].Title)
+		notifications[i].Message = catalog.translate(notifications[i].Message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NotificationsResponse{
+		Success:       true,
+		Notifications: notifications,
+		Unread:        unread,
+		Pagination: &Pagination{
+			Count:   page.Count,
+			Skip:    page.Skip,
+			Page:    page.Page,
+			Total:   total,
+			HasMore: page.Skip+len(notifications) < total,
+		},
+	})
+}
+
+// HandleUnreadNotifications returns the requesting user's unread count,
+// for the bell icon
+func (ws *WalletServer) HandleUnreadNotifications(w http.ResponseWriter, r *http.Request) {
+	unread, err := ws.store.UnreadNotifications(walletOwner(r), ws.requestUser(r))
+	if err != nil {
+		logRequest(r, "[API] UnreadNotifications ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(NotificationsResponse{
+			Success: false,
+			Error:   "Failed to count notifications",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NotificationsResponse{Success: true, Unread: unread})
+}
+
+// HandleMarkNotificationsRead marks notifications read for the requesting
+// user and returns what is left unread
+func (ws *WalletServer) HandleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	var req MarkReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(NotificationsResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	if req.All == (len(req.IDs) > 0) || len(req.IDs) > maxMarkRead {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(NotificationsResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Give either ids (at most %d) or all", maxMarkRead),
+		})
+		return
+	}
+
+	owner, user := walletOwner(r), ws.requestUser(r)
+	ids := req.IDs
+	if req.All {
+		ids = nil
+	}
+	err := ws.store.MarkNotificationsRead(owner, user, ids, time.Now().Unix())
+	var unread int
+	if err == nil {
+		unread, err = ws.store.UnreadNotifications(owner, user)
+	}
+	if err != nil {
+		logRequest(r, "[API] MarkNotificationsRead ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(NotificationsResponse{
+			Success: false,
+			Error:   "Failed to mark notifications read",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NotificationsResponse{Success: true, Unread: unread})
+}
@@ -0,0 +1,663 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // SHA-384 and SHA-512 for RS384, RS512 and ES384
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Roles given to OIDC users
+const (
+	RoleAdmin  = "admin"  // everything
+	RoleViewer = "viewer" // GET requests only: balances and history, no sending
+)
+
+const (
+	// loginCookie holds the login session id
+	loginCookie = "webwallet_session"
+	// oidcLoginTimeout is how long a user has to finish at the provider
+	oidcLoginTimeout = 10 * time.Minute
+	// maxPendingLogins bounds logins started but not finished
+	maxPendingLogins = 1000
+	// oidcClockSkew is the leeway for ID token times
+	oidcClockSkew = time.Minute
+	// jwksRefreshInterval limits refetching the provider's keys for an
+	// unknown key id
+	jwksRefreshInterval = time.Minute
+)
+
+// oidcProvider logs users in with the authorization code flow (with PKCE)
+// and keeps their login sessions in memory, so a restart logs everyone
+// out. The provider's discovery document and keys are fetched on first use
+// so the wallet starts while the provider is down.
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey // by key id
+	keysFetched time.Time
+	pending     map[string]oidcPendingLogin // by state
+	sessions    map[string]*loginSession    // by cookie value
+
+	// multiUser lets viewers write too: in multi-user mode they work on
+	// wallets of their own
+	multiUser bool
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcPendingLogin is a login sent to the provider and not back yet
+type oidcPendingLogin struct {
+	verifier string // PKCE code verifier
+	nonce    string
+	next     string // where to go after logging in
+	expires  time.Time
+}
+
+// loginSession is a logged-in OIDC user
+type loginSession struct {
+	Subject   string    `json:"subject"`
+	Name      string    `json:"name,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newOIDCProvider(cfg OIDCConfig) *oidcProvider {
+	return &oidcProvider{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		pending:  map[string]oidcPendingLogin{},
+		sessions: map[string]*loginSession{},
+	}
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// getJSON fetches url into out
+func (p *oidcProvider) getJSON(url string, out interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// discover returns the provider's endpoints, fetching them once
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	d := p.discovery
+	p.mu.Unlock()
+	if d != nil {
+		return d, nil
+	}
+
+	d = &oidcDiscovery{}
+	if err := p.getJSON(strings.TrimRight(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", d); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("OIDC discovery: provider says its issuer is %q, not %q", d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery: the provider lists no authorization, token or JWKS endpoint")
+	}
+
+	p.mu.Lock()
+	p.discovery = d
+	p.mu.Unlock()
+	return d, nil
+}
+
+// key returns the provider's signing key kid, refetching the key set when
+// it is unknown, as after a key rotation
+func (p *oidcProvider) key(jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.keysFetched) > jwksRefreshInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching signing keys failed: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verifyIDToken checks an ID token's signature, issuer, audience, expiry
+// and nonce, and returns its claims
+func (p *oidcProvider) verifyIDToken(d *oidcDiscovery, token, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("ID token is not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(raw, &header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad ID token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("bad ID token signature: %w", err)
+	}
+
+	var hash crypto.Hash
+	switch header.Alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	key, err := p.key(d.JWKSURI, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(header.Alg, "RS") || rsa.VerifyPKCS1v15(key, hash, digest, sig) != nil {
+			return nil, errors.New("ID token signature is invalid")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(header.Alg, "ES") || len(sig) != 2*size ||
+			!ecdsa.Verify(key, digest, new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])) {
+			return nil, errors.New("ID token signature is invalid")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	var claims map[string]interface{}
+	raw, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err == nil {
+		err = json.Unmarshal(raw, &claims)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad ID token claims: %w", err)
+	}
+
+	if rpc.GetString(claims, "iss") != d.Issuer {
+		return nil, fmt.Errorf("ID token is from %q", rpc.GetString(claims, "iss"))
+	}
+	audienceOK := rpc.GetString(claims, "aud") == p.cfg.ClientID
+	if audiences, ok := claims["aud"].([]interface{}); ok {
+		for _, aud := range audiences {
+			audienceOK = audienceOK || aud == p.cfg.ClientID
+		}
+	}
+	if !audienceOK {
+		return nil, errors.New("ID token is for another client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("ID token has expired")
+	}
+	if rpc.GetString(claims, "nonce") != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// role maps a user's groups, or verified email, to a role; "" denies them
+func (p *oidcProvider) role(claims map[string]interface{}) string {
+	var memberships []string
+	switch groups := claims[p.cfg.GroupsClaim].(type) {
+	case string:
+		memberships = append(memberships, groups)
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				memberships = append(memberships, s)
+			}
+		}
+	}
+	if verified, _ := claims["email_verified"].(bool); verified && rpc.GetString(claims, "email") != "" {
+		memberships = append(memberships, rpc.GetString(claims, "email"))
+	}
+
+	for _, mapping := range []struct {
+		role   string
+		groups []string
+	}{
+		{RoleAdmin, p.cfg.AdminGroups},
+		{RoleViewer, p.cfg.ViewerGroups},
+	} {
+		for _, group := range mapping.groups {
+			for _, m := range memberships {
+				if strings.EqualFold(m, group) {
+					return mapping.role
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// session returns r's unexpired login session
+func (p *oidcProvider) session(r *http.Request) (*loginSession, bool) {
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil {
+		return nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.sessions[cookie.Value]
+	if !ok || time.Now().After(s.ExpiresAt) {
+		delete(p.sessions, cookie.Value)
+		return nil, false
+	}
+	return s, true
+}
+
+// prune drops expired logins and sessions. The caller holds p.mu.
+func (p *oidcProvider) prune(now time.Time) {
+	for state, pending := range p.pending {
+		if now.After(pending.expires) {
+			delete(p.pending, state)
+		}
+	}
+	for id, s := range p.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(p.sessions, id)
+		}
+	}
+}
+
+// setCookie sets the login cookie, Secure when the wallet is reached over
+// HTTPS
+func (p *oidcProvider) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    value,
+		Path:     urlPath("/"),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(p.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// localPath returns next if it is a path on this site, for redirecting
+// after login, and the wallet's root otherwise
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// withOIDCAuth requires a login session on every request but the login
+// flow's and the checkout payment page's. Browsers are sent to log in; API
+// clients get 401. Viewers may only read.
+func withOIDCAuth(p *oidcProvider, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) || strings.HasPrefix(r.URL.Path, "/auth/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, ok := p.session(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/ws" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Authentication required"})
+				return
+			}
+			http.Redirect(w, r, urlPath("/auth/login?next="+url.QueryEscape(r.URL.RequestURI())), http.StatusFound)
+			return
+		}
+
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if !readOnly {
+			// The session cookie rides along on cross-site form posts in
+			// older browsers
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+					logRequest(r, "[AUTH] WARNING: refused %s %s from origin %s", r.Method, r.URL.Path, origin)
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Cross-origin request refused"})
+					return
+				}
+			}
+			if session.Role != RoleAdmin && !p.multiUser {
+				logRequest(r, "[AUTH] WARNING: refused %s %s for viewer %s", r.Method, r.URL.Path, session.Subject)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Your role may only view the wallet"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+var authMessagePage = template.Must(template.New("auth").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Kernelcoin Web Wallet</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f5f7; color: #222; margin: 0; }
+main { max-width: 420px; margin: 40px auto; background: #fff; border-radius: 8px; padding: 24px; text-align: center; box-shadow: 0 1px 4px rgba(0,0,0,.1); }
+a.button { display: inline-block; margin-top: 12px; padding: 10px 18px; background: #2f6fed; color: #fff; border-radius: 4px; text-decoration: none; }
+</style>
+</head>
+<body>
+<main>
+<p>{{.Message}}</p>
+<a class="button" href="{{.Login}}">Sign in</a>
+</main>
+</body>
+</html>
+`))
+
+// writeAuthMessage renders a short page with a sign-in link
+func writeAuthMessage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	authMessagePage.Execute(w, map[string]string{"Message": message, "Login": urlPath("/auth/login")})
+}
+
+// HandleOIDCLogin sends the browser to the provider to log in. ?next= is
+// where to return afterwards.
+func (ws *WalletServer) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	p := ws.oidc
+	d, err := p.discover()
+	if err != nil {
+		logRequest(r, "[AUTH] ERROR: %v", err)
+		writeAuthMessage(w, http.StatusBadGateway, "The login provider is unavailable. Try again later.")
+		return
+	}
+
+	state, err := randomToken()
+	var verifier, nonce string
+	if err == nil {
+		verifier, err = randomToken()
+	}
+	if err == nil {
+		nonce, err = randomToken()
+	}
+	if err != nil {
+		logRequest(r, "[AUTH] ERROR: %v", err)
+		writeAuthMessage(w, http.StatusInternalServerError, "Could not start the login.")
+		return
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	p.prune(now)
+	full := len(p.pending) >= maxPendingLogins
+	if !full {
+		p.pending[state] = oidcPendingLogin{
+			verifier: verifier,
+			nonce:    nonce,
+			next:     localPath(r.URL.Query().Get("next")),
+			expires:  now.Add(oidcLoginTimeout),
+		}
+	}
+	p.mu.Unlock()
+	if full {
+		logRequest(r, "[AUTH] WARNING: too many unfinished logins")
+		writeAuthMessage(w, http.StatusServiceUnavailable, "Too many logins in progress. Try again in a few minutes.")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+}
+
+// HandleOIDCCallback finishes a login: it trades the code for an ID token,
+// maps the user's groups to a role and starts their session
+func (ws *WalletServer) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	p := ws.oidc
+	query := r.URL.Query()
+
+	p.mu.Lock()
+	pending, ok := p.pending[query.Get("state")]
+	delete(p.pending, query.Get("state"))
+	p.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		writeAuthMessage(w, http.StatusBadRequest, "This login has expired or was already used.")
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		logRequest(r, "[AUTH] WARNING: provider refused the login: %s %s", e, query.Get("error_description"))
+		writeAuthMessage(w, http.StatusForbidden, "The login provider refused the login.")
+		return
+	}
+
+	claims, err := ws.exchangeOIDCCode(query.Get("code"), pending)
+	if err != nil {
+		logRequest(r, "[AUTH] ERROR: login failed: %v", err)
+		writeAuthMessage(w, http.StatusBadGateway, "The login could not be completed.")
+		return
+	}
+
+	subject := rpc.GetString(claims, "sub")
+	role := p.role(claims)
+	if role == "" {
+		logRequest(r, "[AUTH] WARNING: %s (%s) has no wallet role", subject, rpc.GetString(claims, "email"))
+		writeAuthMessage(w, http.StatusForbidden, "Your account has no access to this wallet.")
+		return
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		logRequest(r, "[AUTH] ERROR: %v", err)
+		writeAuthMessage(w, http.StatusInternalServerError, "The login could not be completed.")
+		return
+	}
+	ttl := time.Duration(p.cfg.SessionTTL)
+	session := &loginSession{
+		Subject:   subject,
+		Name:      rpc.GetString(claims, "name"),
+		Email:     rpc.GetString(claims, "email"),
+		Role:      role,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	p.mu.Lock()
+	p.prune(time.Now())
+	p.sessions[id] = session
+	p.mu.Unlock()
+
+	logRequest(r, "[AUTH] %s (%s) logged in as %s", subject, session.Email, role)
+	p.setCookie(w, id, int(ttl/time.Second))
+	http.Redirect(w, r, urlPath(pending.next), http.StatusFound)
+}
+
+// exchangeOIDCCode redeems an authorization code at the token endpoint and
+// returns the verified ID token's claims
+func (ws *WalletServer) exchangeOIDCCode(code string, pending oidcPendingLogin) (map[string]interface{}, error) {
+	p := ws.oidc
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {pending.verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s", token.Error, token.Description)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token endpoint returned no ID token")
+	}
+	return p.verifyIDToken(d, token.IDToken, pending.nonce)
+}
+
+// HandleOIDCLogout ends the login session. The provider's own session is
+// left alone, so signing in again may not ask for a password.
+func (ws *WalletServer) HandleOIDCLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(loginCookie); err == nil {
+		ws.oidc.mu.Lock()
+		delete(ws.oidc.sessions, cookie.Value)
+		ws.oidc.mu.Unlock()
+	}
+	ws.oidc.setCookie(w, "", -1)
+	writeAuthMessage(w, http.StatusOK, "You are signed out.")
+}
+
+// HandleAuthMe returns the logged-in user and their role
+func (ws *WalletServer) HandleAuthMe(w http.ResponseWriter, r *http.Request) {
+	session, ok := ws.oidc.session(r)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Authentication required"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "user": session})
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// maxOpReturnData is the largest OP_RETURN payload relayed by default
+// (-datacarriersize=83 counts the opcode and push prefix)
+const maxOpReturnData = 80
+
+// opReturnData returns the hex OP_RETURN payload requested by req, or "" if
+// none. Text is sent as its UTF-8 bytes.
+func opReturnData(req SendTransactionRequest) (string, error) {
+	var data []byte
+	switch {
+	case req.OpReturn != "" && req.OpReturnHex != "":
+		return "", fmt.Errorf("specify either op_return or op_return_hex, not both")
+	case req.OpReturnHex != "":
+		decoded, err := hex.DecodeString(req.OpReturnHex)
+		if err != nil {
+			return "", fmt.Errorf("op_return_hex is not valid hex")
+		}
+		data = decoded
+	case req.OpReturn != "":
+		data = []byte(req.OpReturn)
+	default:
+		return "", nil
+	}
+
+	if len(data) > maxOpReturnData {
+		return "", fmt.Errorf("OP_RETURN data is %d bytes; the relay limit is %d", len(data), maxOpReturnData)
+	}
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// PageParams is a window onto a newest-first list
+type PageParams struct {
+	Count int
+	Skip  int
+	Page  int
+}
+
+// parsePageParams reads count, skip (or its alias offset) and the 1-based page
+// from the query string. An explicit skip wins over page.
+func parsePageParams(r *http.Request) PageParams {
+	return pageParamsFromValues(r.URL.Query())
+}
+
+// pageParamsFromValues is parsePageParams over any set of parameters
+func pageParamsFromValues(q url.Values) PageParams {
+	p := PageParams{Count: defaultPageSize, Page: 1}
+
+	if c, err := strconv.Atoi(q.Get("count")); err == nil && c > 0 {
+		p.Count = min(c, maxPageSize)
+	}
+
+	skipStr := q.Get("skip")
+	if skipStr == "" {
+		skipStr = q.Get("offset")
+	}
+	if s, err := strconv.Atoi(skipStr); err == nil && s >= 0 {
+		p.Skip = s
+		p.Page = s/p.Count + 1
+	} else if pg, err := strconv.Atoi(q.Get("page")); err == nil && pg > 0 {
+		p.Page = pg
+		p.Skip = (pg - 1) * p.Count
+	}
+	return p
+}
+
+// Pagination is returned with paged lists so a UI can draw its pager
+type Pagination struct {
+	Count   int  `json:"count"`
+	Skip    int  `json:"skip"`
+	Page    int  `json:"page"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"`
+}
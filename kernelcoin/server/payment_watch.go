@@ -0,0 +1,263 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// EventPaymentReceived fires when a watched address has been paid
+const EventPaymentReceived = "payment_received"
+
+const (
+	defaultPaymentWatchTTL = 24 * time.Hour
+	maxPaymentWatchTTL     = 30 * 24 * time.Hour
+)
+
+// PaymentWatch waits for Amount to arrive at Address with at least
+// Confirmations confirmations. Only funds received after the watch was set
+// count, so reused addresses don't fire at once.
+type PaymentWatch struct {
+	Owner         string     `json:"-"` // whose wallet the address is in
+	Address       string     `json:"address"`
+	Amount        rpc.Amount `json:"amount"` // zero fires on any payment
+	Confirmations int        `json:"confirmations"`
+	Baseline      rpc.Amount `json:"baseline"`
+	ExpiresAt     int64      `json:"expires_at"`
+}
+
+// PaymentReceivedEvent is the data of a payment_received event
+type PaymentReceivedEvent struct {
+	Address       string     `json:"address"`
+	Expected      rpc.Amount `json:"expected"`
+	Received      rpc.Amount `json:"received"`
+	Confirmations int        `json:"confirmations"`
+}
+
+type PaymentWatchRequest struct {
+	Amount        rpc.Amount `json:"amount"`
+	Confirmations int        `json:"confirmations"`
+	ExpiresIn     int64      `json:"expires_in,omitempty"` // seconds
+}
+
+type ReceivedResponse struct {
+	Success       bool          `json:"success"`
+	Address       string        `json:"address,omitempty"`
+	Unconfirmed   rpc.Amount    `json:"unconfirmed"` // received at 0 confirmations
+	Confirmed     rpc.Amount    `json:"confirmed"`   // received at Confirmations
+	Confirmations int           `json:"confirmations"`
+	Watch         *PaymentWatch `json:"watch,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// paymentWatchKey identifies owner's watch on address
+type paymentWatchKey struct {
+	owner, address string
+}
+
+// paymentWatches holds the active watches by owner and address
+type paymentWatches struct {
+	mu      sync.Mutex
+	watches map[paymentWatchKey]PaymentWatch
+}
+
+func newPaymentWatches() *paymentWatches {
+	return &paymentWatches{watches: map[paymentWatchKey]PaymentWatch{}}
+}
+
+func (p *paymentWatches) Set(watch PaymentWatch) {
+	p.mu.Lock()
+	p.watches[paymentWatchKey{watch.Owner, watch.Address}] = watch
+	p.mu.Unlock()
+}
+
+func (p *paymentWatches) Get(owner, address string) (PaymentWatch, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	watch, ok := p.watches[paymentWatchKey{owner, address}]
+	return watch, ok
+}
+
+func (p *paymentWatches) Delete(owner, address string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := paymentWatchKey{owner, address}
+	_, ok := p.watches[key]
+	delete(p.watches, key)
+	return ok
+}
+
+// DeleteOwner drops every watch of owner
+func (p *paymentWatches) DeleteOwner(owner string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.watches {
+		if key.owner == owner {
+			delete(p.watches, key)
+		}
+	}
+}
+
+func (p *paymentWatches) All() []PaymentWatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	all := make([]PaymentWatch, 0, len(p.watches))
+	for _, watch := range p.watches {
+		all = append(all, watch)
+	}
+	return all
+}
+
+// checkPaymentWatches publishes payment_received to the owner of every
+// watch that has been paid and drops it, along with expired watches
+func (ws *WalletServer) checkPaymentWatches() {
+	now := time.Now().Unix()
+	for _, watch := range ws.paymentWatches.All() {
+		if now >= watch.ExpiresAt {
+			ws.paymentWatches.Delete(watch.Owner, watch.Address)
+			continue
+		}
+
+		client, _, err := ws.ownerWallet(watch.Owner)
+		if err != nil {
+			log.Printf("[EVENTS] WARNING: cannot check payment to %s: %v", watch.Address, err)
+			continue
+		}
+		received, err := client.GetReceivedByAddress(watch.Address, watch.Confirmations)
+		if err != nil {
+			log.Printf("[EVENTS] WARNING: checking payment to %s failed: %v", watch.Address, err)
+			continue
+		}
+		paid := received - watch.Baseline
+		if paid <= 0 || paid < watch.Amount {
+			continue
+		}
+
+		log.Printf("[EVENTS] Payment of %s KCN received on %s", paid, watch.Address)
+		ws.events.PublishFor(watch.Owner, EventPaymentReceived, PaymentReceivedEvent{
+			Address:       watch.Address,
+			Expected:      watch.Amount,
+			Received:      paid,
+			Confirmations: watch.Confirmations,
+		})
+		ws.paymentWatches.Delete(watch.Owner, watch.Address)
+	}
+}
+
+// serveAddressReceived serves GET /api/address/{address}/received. The
+// ?confirmations= depth defaults to 1.
+func (ws *WalletServer) serveAddressReceived(w http.ResponseWriter, r *http.Request, address string) {
+	confirmations := 1
+	if v := r.URL.Query().Get("confirmations"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ReceivedResponse{
+				Success: false,
+				Error:   "confirmations must be a non-negative integer",
+			})
+			return
+		}
+		confirmations = n
+	}
+
+	unconfirmed, err := ws.rpc(r).GetReceivedByAddress(address, 0)
+	var confirmed rpc.Amount
+	if err == nil {
+		confirmed, err = ws.rpc(r).GetReceivedByAddress(address, confirmations)
+	}
+	if err != nil {
+		// The node refuses addresses that aren't in the wallet
+		logRequest(r, "[API] AddressReceived ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ReceivedResponse{
+			Success: false,
+			Error:   "Address is not a wallet address",
+		})
+		return
+	}
+
+	response := ReceivedResponse{
+		Success:       true,
+		Address:       address,
+		Unconfirmed:   unconfirmed,
+		Confirmed:     confirmed,
+		Confirmations: confirmations,
+	}
+	if watch, ok := ws.paymentWatches.Get(walletOwner(r), address); ok {
+		response.Watch = &watch
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// serveAddressWatch serves /api/address/{address}/watch: POST starts (or
+// replaces) a payment watch, DELETE cancels it. Payments are announced as
+// payment_received events on /ws and /api/events; watches are checked every
+// EVENT_POLL_INTERVAL while a client is listening.
+func (ws *WalletServer) serveAddressWatch(w http.ResponseWriter, r *http.Request, address string) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		ws.paymentWatches.Delete(walletOwner(r), address)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ReceivedResponse{Success: true, Address: address})
+		return
+	}
+
+	var req PaymentWatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount < 0 || req.Confirmations < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ReceivedResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	ttl := defaultPaymentWatchTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(min(req.ExpiresIn, int64(maxPaymentWatchTTL/time.Second))) * time.Second
+	}
+
+	baseline, err := ws.rpc(r).GetReceivedByAddress(address, req.Confirmations)
+	if err != nil {
+		logRequest(r, "[API] AddressWatch ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ReceivedResponse{
+			Success: false,
+			Error:   "Address is not a wallet address",
+		})
+		return
+	}
+
+	watch := PaymentWatch{
+		Owner:         walletOwner(r),
+		Address:       address,
+		Amount:        req.Amount,
+		Confirmations: req.Confirmations,
+		Baseline:      baseline,
+		ExpiresAt:     time.Now().Add(ttl).Unix(),
+	}
+	ws.paymentWatches.Set(watch)
+
+	logRequest(r, "[API] AddressWatch SUCCESS: waiting for %s KCN on %s", watch.Amount, address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReceivedResponse{
+		Success:       true,
+		Address:       address,
+		Confirmed:     baseline,
+		Confirmations: req.Confirmations,
+		Watch:         &watch,
+	})
+}
@@ -0,0 +1,605 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// PriceProvider quotes KCN in fiat currencies (ISO codes such as "USD")
+type PriceProvider interface {
+	Name() string
+	Price(currency string) (float64, error)
+	PriceAt(currency string, at time.Time) (float64, error)
+}
+
+// coinGeckoProvider reads prices from a CoinGecko-compatible HTTP API
+type coinGeckoProvider struct {
+	baseURL string
+	coinID  string
+	apiKey  string // optional; sent as a demo or pro key by host
+	client  *http.Client
+}
+
+func newCoinGeckoProvider(baseURL, coinID, apiKey string) *coinGeckoProvider {
+	return &coinGeckoProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		coinID:  coinID,
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *coinGeckoProvider) Name() string { return "coingecko" }
+
+func (p *coinGeckoProvider) get(path string, query url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if p.apiKey != "" {
+		header := "x-cg-demo-api-key"
+		if strings.Contains(p.baseURL, "pro-api.") {
+			header = "x-cg-pro-api-key"
+		}
+		req.Header.Set(header, p.apiKey)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("price API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (p *coinGeckoProvider) Price(currency string) (float64, error) {
+	vs := strings.ToLower(currency)
+	var result map[string]map[string]float64
+	query := url.Values{"ids": {p.coinID}, "vs_currencies": {vs}}
+	if err := p.get("/simple/price", query, &result); err != nil {
+		return 0, err
+	}
+	price, ok := result[p.coinID][vs]
+	if !ok {
+		return 0, fmt.Errorf("no %s price for %s", currency, p.coinID)
+	}
+	return price, nil
+}
+
+func (p *coinGeckoProvider) PriceAt(currency string, at time.Time) (float64, error) {
+	vs := strings.ToLower(currency)
+	var result struct {
+		MarketData struct {
+			CurrentPrice map[string]float64 `json:"current_price"`
+		} `json:"market_data"`
+	}
+	query := url.Values{"date": {at.UTC().Format("02-01-2006")}, "localization": {"false"}}
+	if err := p.get("/coins/"+url.PathEscape(p.coinID)+"/history", query, &result); err != nil {
+		return 0, err
+	}
+	price, ok := result.MarketData.CurrentPrice[vs]
+	if !ok {
+		return 0, fmt.Errorf("no %s price for %s on %s", currency, p.coinID, at.UTC().Format("2006-01-02"))
+	}
+	return price, nil
+}
+
+// staticPriceProvider returns fixed, manually configured prices. It has no
+// history, so past values use today's price.
+type staticPriceProvider struct {
+	prices map[string]float64
+}
+
+// parseStaticPrices reads "USD=0.05,EUR=0.046"
+func parseStaticPrices(s string) (*staticPriceProvider, error) {
+	p := &staticPriceProvider{prices: map[string]float64{}}
+	for _, pair := range strings.Split(s, ",") {
+		currency, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected CURRENCY=price, got %q", pair)
+		}
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil || price <= 0 {
+			return nil, fmt.Errorf("invalid price %q for %s", value, currency)
+		}
+		p.prices[strings.ToUpper(currency)] = price
+	}
+	return p, nil
+}
+
+func (p *staticPriceProvider) Name() string { return "static" }
+
+func (p *staticPriceProvider) Price(currency string) (float64, error) {
+	price, ok := p.prices[currency]
+	if !ok {
+		return 0, fmt.Errorf("no static %s price configured", currency)
+	}
+	return price, nil
+}
+
+func (p *staticPriceProvider) PriceAt(currency string, at time.Time) (float64, error) {
+	return p.Price(currency)
+}
+
+// fiatCurrencies are the codes the price service quotes besides its
+// default: ISO 4217 currencies, the IMF's XDR and gold and silver. Others
+// are refused before they reach a provider or a cache, which a client could
+// otherwise fill with made-up codes.
+var fiatCurrencies = map[string]bool{
+	"AED": true, "ARS": true, "AUD": true, "BDT": true, "BHD": true, "BMD": true,
+	"BRL": true, "CAD": true, "CHF": true, "CLP": true, "CNY": true, "CZK": true,
+	"DKK": true, "EUR": true, "GBP": true, "GEL": true, "HKD": true, "HUF": true,
+	"IDR": true, "ILS": true, "INR": true, "JPY": true, "KRW": true, "KWD": true,
+	"LKR": true, "MMK": true, "MXN": true, "MYR": true, "NGN": true, "NOK": true,
+	"NZD": true, "PHP": true, "PKR": true, "PLN": true, "RUB": true, "SAR": true,
+	"SEK": true, "SGD": true, "THB": true, "TRY": true, "TWD": true, "UAH": true,
+	"USD": true, "VEF": true, "VND": true, "ZAR": true, "XDR": true, "XAG": true,
+	"XAU": true,
+}
+
+// errUnknownCurrency refuses a currency outside fiatCurrencies
+var errUnknownCurrency = errors.New("unknown currency")
+
+// PriceQuote is one KCN price as served by /api/price
+type PriceQuote struct {
+	Currency  string  `json:"currency"`
+	Price     float64 `json:"price"`
+	Source    string  `json:"source"` // the provider, or those a median was taken of, comma-separated
+	FetchedAt int64   `json:"fetched_at"`
+	Stale     bool    `json:"stale,omitempty"` // every provider failed; this is the last good quote
+}
+
+// FiatValue is an amount converted with a PriceQuote
+type FiatValue struct {
+	Currency string  `json:"currency"`
+	Value    float64 `json:"value"`
+}
+
+// Value converts amount at the quote's price, rounded to cents
+func (q *PriceQuote) Value(amount rpc.Amount) *FiatValue {
+	if q == nil {
+		return nil
+	}
+	return &FiatValue{
+		Currency: q.Currency,
+		Value:    math.Round(amount.KCN()*q.Price*100) / 100,
+	}
+}
+
+// PriceProviderFactory builds a provider from the price settings
+type PriceProviderFactory func(c PriceConfig) (PriceProvider, error)
+
+var (
+	priceProvidersMu sync.RWMutex
+	priceProviders   = map[string]PriceProviderFactory{}
+)
+
+// RegisterPriceProvider makes a provider available to prices.providers
+// under name. Call it from an init function; a name can only be taken once.
+func RegisterPriceProvider(name string, factory PriceProviderFactory) {
+	priceProvidersMu.Lock()
+	defer priceProvidersMu.Unlock()
+	if _, ok := priceProviders[name]; ok {
+		panic(fmt.Sprintf("price provider %q registered twice", name))
+	}
+	priceProviders[name] = factory
+}
+
+// priceProviderFactory returns the factory registered under name
+func priceProviderFactory(name string) (PriceProviderFactory, bool) {
+	priceProvidersMu.RLock()
+	defer priceProvidersMu.RUnlock()
+	factory, ok := priceProviders[name]
+	return factory, ok
+}
+
+// priceProviderNames lists the registered providers, sorted
+func priceProviderNames() []string {
+	priceProvidersMu.RLock()
+	defer priceProvidersMu.RUnlock()
+	names := make([]string, 0, len(priceProviders))
+	for name := range priceProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterPriceProvider("coingecko", func(c PriceConfig) (PriceProvider, error) {
+		return newCoinGeckoProvider(c.APIURL, c.CoinID, c.APIKey), nil
+	})
+	RegisterPriceProvider("static", func(c PriceConfig) (PriceProvider, error) {
+		if c.Static == "" {
+			return nil, fmt.Errorf("the static provider needs prices.static")
+		}
+		static, err := parseStaticPrices(c.Static)
+		if err != nil {
+			return nil, fmt.Errorf("prices.static: %w", err)
+		}
+		return static, nil
+	})
+}
+
+// How the price service picks among its providers' answers
+const (
+	PriceSelectFirst  = "first"  // the first provider, in order, that answers
+	PriceSelectMedian = "median" // the median of every provider that answers
+)
+
+// A failing provider is left alone for priceRetryMin, doubling with each
+// further failure up to priceRetryMax
+const (
+	priceRetryMin = 30 * time.Second
+	priceRetryMax = 10 * time.Minute
+)
+
+// priceBurst is how many calls a provider may take at once under its rate
+// limit
+const priceBurst = 5
+
+// sourcePrice is one provider's price and when it was fetched
+type sourcePrice struct {
+	price float64
+	at    time.Time
+}
+
+// priceSource wraps a provider with its own cache of current prices, rate
+// limit and failure backoff, so a slow or failing provider costs nothing
+// until it is due to be tried again
+type priceSource struct {
+	provider PriceProvider
+	ttl      time.Duration
+	limiter  *rateLimiter
+
+	mu        sync.Mutex
+	current   map[string]sourcePrice
+	failures  int
+	downUntil time.Time
+}
+
+func newPriceSource(provider PriceProvider, ttl time.Duration, requestsPerMinute float64) *priceSource {
+	return &priceSource{
+		provider: provider,
+		ttl:      ttl,
+		limiter:  newRateLimiter(RateLimitConfig{RequestsPerSecond: requestsPerMinute / 60, Burst: priceBurst}),
+		current:  map[string]sourcePrice{},
+	}
+}
+
+// call runs fetch for the price described by what, unless the provider is
+// backing off or out of requests, and keeps its health
+func (s *priceSource) call(what string, fetch func() (float64, error)) (float64, error) {
+	name := s.provider.Name()
+	s.mu.Lock()
+	downUntil := s.downUntil
+	s.mu.Unlock()
+	if time.Now().Before(downUntil) {
+		return 0, fmt.Errorf("%s is failing; next try in %s", name, time.Until(downUntil).Round(time.Second))
+	}
+	if ok, wait := s.limiter.Allow(name); !ok {
+		return 0, fmt.Errorf("%s rate limit reached; next call in %s", name, wait.Round(time.Second))
+	}
+
+	price, err := fetch()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failures++
+		backoff := priceRetryMin << (s.failures - 1)
+		if backoff > priceRetryMax || backoff <= 0 {
+			backoff = priceRetryMax
+		}
+		s.downUntil = time.Now().Add(backoff)
+		log.Printf("[PRICE] WARNING: %s %s price failed, next try in %s: %v", name, what, backoff, err)
+		return 0, err
+	}
+	if s.failures > 0 {
+		log.Printf("[PRICE] %s is answering again after %d failures", name, s.failures)
+	}
+	s.failures, s.downUntil = 0, time.Time{}
+	return price, nil
+}
+
+// price returns the provider's current price in currency, cached for ttl
+func (s *priceSource) price(currency string) (sourcePrice, error) {
+	s.mu.Lock()
+	cached, ok := s.current[currency]
+	s.mu.Unlock()
+	if ok && time.Since(cached.at) < s.ttl {
+		return cached, nil
+	}
+
+	price, err := s.call(currency, func() (float64, error) { return s.provider.Price(currency) })
+	if err != nil {
+		return sourcePrice{}, err
+	}
+	fetched := sourcePrice{price: price, at: time.Now()}
+	s.mu.Lock()
+	s.current[currency] = fetched
+	s.mu.Unlock()
+	return fetched, nil
+}
+
+func (s *priceSource) priceAt(currency string, at time.Time) (float64, error) {
+	return s.call(currency+" "+at.UTC().Format("2006-01-02"), func() (float64, error) { return s.provider.PriceAt(currency, at) })
+}
+
+// PriceService asks its providers in order, each behind its own cache and
+// rate limit, and answers with the first price or the median of all of
+// them. Historical daily prices are cached for good.
+type PriceService struct {
+	sources   []*priceSource
+	selection string
+	currency  string // default for fiat_value fields
+
+	mu      sync.Mutex
+	last    map[string]PriceQuote // the last good quote, served stale when every provider fails
+	history map[string]float64    // currency + date
+}
+
+// NewPriceService asks providers in order for the first price that comes
+// back, caching each one's prices for ttl without limiting its calls
+func NewPriceService(providers []PriceProvider, currency string, ttl time.Duration) *PriceService {
+	sources := []*priceSource{}
+	for _, provider := range providers {
+		sources = append(sources, newPriceSource(provider, ttl, 0))
+	}
+	return newPriceService(sources, PriceSelectFirst, currency)
+}
+
+func newPriceService(sources []*priceSource, selection, currency string) *PriceService {
+	return &PriceService{
+		sources:   sources,
+		selection: selection,
+		currency:  strings.ToUpper(currency),
+		last:      map[string]PriceQuote{},
+		history:   map[string]float64{},
+	}
+}
+
+// CheckCurrency refuses a currency the service doesn't quote
+func (s *PriceService) CheckCurrency(currency string) error {
+	currency = strings.ToUpper(currency)
+	if currency == s.currency || fiatCurrencies[currency] {
+		return nil
+	}
+	return fmt.Errorf("%w %q", errUnknownCurrency, currency)
+}
+
+// Quote returns the current price in currency ("" for the default currency)
+func (s *PriceService) Quote(currency string) (*PriceQuote, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = s.currency
+	}
+	if err := s.CheckCurrency(currency); err != nil {
+		return nil, err
+	}
+
+	var prices []float64
+	var names []string
+	var oldest time.Time
+	var lastErr error
+	for _, source := range s.sources {
+		fetched, err := source.price(currency)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		prices = append(prices, fetched.price)
+		names = append(names, source.provider.Name())
+		if oldest.IsZero() || fetched.at.Before(oldest) {
+			oldest = fetched.at
+		}
+		if s.selection != PriceSelectMedian {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(prices) == 0 {
+		if last, ok := s.last[currency]; ok {
+			last.Stale = true
+			return &last, nil
+		}
+		return nil, lastErr
+	}
+	quote := PriceQuote{
+		Currency:  currency,
+		Price:     median(prices),
+		Source:    strings.Join(names, ","),
+		FetchedAt: oldest.Unix(),
+	}
+	s.last[currency] = quote
+	return &quote, nil
+}
+
+// PriceAt returns the price in currency on the UTC day of at
+func (s *PriceService) PriceAt(currency string, at time.Time) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if err := s.CheckCurrency(currency); err != nil {
+		return 0, err
+	}
+	key := currency + at.UTC().Format("2006-01-02")
+
+	s.mu.Lock()
+	price, ok := s.history[key]
+	s.mu.Unlock()
+	if ok {
+		return price, nil
+	}
+
+	var prices []float64
+	var lastErr error
+	for _, source := range s.sources {
+		price, err := source.priceAt(currency, at)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		prices = append(prices, price)
+		if s.selection != PriceSelectMedian {
+			break
+		}
+	}
+	if len(prices) == 0 {
+		return 0, lastErr
+	}
+	price = median(prices)
+	s.mu.Lock()
+	s.history[key] = price
+	s.mu.Unlock()
+	return price, nil
+}
+
+// median of one or more prices; an even count averages the middle two
+func median(prices []float64) float64 {
+	sorted := append([]float64(nil), prices...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// providerNames lists the providers to ask, in order: prices.providers, or
+// else prices.provider with static prices as its fallback
+func (c PriceConfig) providerNames() []string {
+	if len(c.Providers) > 0 {
+		return c.Providers
+	}
+	if c.Provider == "" {
+		return nil
+	}
+	names := []string{c.Provider}
+	if c.Provider != "static" && c.Static != "" {
+		names = append(names, "static")
+	}
+	return names
+}
+
+// source returns the cache and rate limit settings of the named provider
+func (c PriceConfig) source(name string) (ttl time.Duration, requestsPerMinute float64) {
+	ttl, requestsPerMinute = time.Duration(c.CacheTTL), c.RequestsPerMinute
+	if override, ok := c.Sources[name]; ok {
+		if override.CacheTTL > 0 {
+			ttl = time.Duration(override.CacheTTL)
+		}
+		if override.RequestsPerMinute > 0 {
+			requestsPerMinute = override.RequestsPerMinute
+		}
+	}
+	return ttl, requestsPerMinute
+}
+
+// priceServiceFromConfig builds the price service from the registered
+// providers the configuration names. It returns nil when it names none.
+func priceServiceFromConfig(c PriceConfig) (*PriceService, error) {
+	names := c.providerNames()
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	sources := []*priceSource{}
+	for _, name := range names {
+		factory, ok := priceProviderFactory(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown price provider %q (use %s)", name, strings.Join(priceProviderNames(), ", "))
+		}
+		provider, err := factory(c)
+		if err != nil {
+			return nil, fmt.Errorf("price provider %s: %w", name, err)
+		}
+		ttl, requestsPerMinute := c.source(name)
+		sources = append(sources, newPriceSource(provider, ttl, requestsPerMinute))
+	}
+
+	selection := c.Selection
+	if selection == "" {
+		selection = PriceSelectFirst
+	}
+	log.Printf("[PRICE] Using %s prices in %s (%s)", strings.Join(names, ", "), strings.ToUpper(c.Currency), selection)
+	return newPriceService(sources, selection, c.Currency), nil
+}
+
+// addFiatValues sets FiatValue on every transaction; a nil quote leaves them
+// unset
+func addFiatValues(transactions []TransactionResponse, quote *PriceQuote) {
+	for i := range transactions {
+		transactions[i].FiatValue = quote.Value(transactions[i].Amount)
+	}
+}
+
+// fiatQuote returns the quote for ?currency= (or the default) to add
+// fiat_value fields, or nil when prices are off or unavailable
+func (ws *WalletServer) fiatQuote(r *http.Request) *PriceQuote {
+	prices := ws.prices.Load()
+	if prices == nil {
+		return nil
+	}
+	quote, err := prices.Quote(r.URL.Query().Get("currency"))
+	if err != nil {
+		return nil
+	}
+	return quote
+}
+
+// HandlePrice returns the current KCN price in ?currency= (default from
+// PRICE_CURRENCY)
+func (ws *WalletServer) HandlePrice(w http.ResponseWriter, r *http.Request) {
+	prices := ws.prices.Load()
+	if prices == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "No price provider configured (set PRICE_PROVIDER)",
+		})
+		return
+	}
+
+	quote, err := prices.Quote(r.URL.Query().Get("currency"))
+	if errors.Is(err, errUnknownCurrency) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Unknown currency",
+		})
+		return
+	}
+	if err != nil {
+		logRequest(r, "[API] Price ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Price unavailable",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Success bool `json:"success"`
+		*PriceQuote
+	}{true, quote})
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// basePath is the URL prefix the wallet is served under behind a reverse
+// proxy, like "/wallet", or "" at the root
+var basePath string
+
+// urlPath returns path with the base path in front, for links the server
+// generates
+func urlPath(path string) string {
+	return basePath + path
+}
+
+// mountAt serves handler under prefix: requests outside it get 404 and the
+// bare prefix redirects to prefix/ so the page's relative URLs resolve
+func mountAt(prefix string, handler http.Handler) http.Handler {
+	if prefix == "" {
+		return handler
+	}
+	root := http.NewServeMux()
+	root.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+	root.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+	return root
+}
+
+// serveIndex serves index.html with its <base href> pointing at the base
+// path, which every URL in the page is relative to
+func (ws *WalletServer) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if basePath == "" {
+		ws.serveAsset(w, r, "index.html")
+		return
+	}
+
+	f, err := ws.assets.Open("index.html")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	page, err := io.ReadAll(f)
+	if err != nil {
+		http.Error(w, "Failed to read index.html", http.StatusInternalServerError)
+		return
+	}
+	page = bytes.Replace(page, []byte(`<base href="/">`), []byte(`<base href="`+basePath+`/">`), 1)
+	http.ServeContent(w, r, "index.html", time.Time{}, bytes.NewReader(page))
+}
+
+// trustedProxies are the networks whose X-Forwarded-For is believed
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies reads IPs and CIDRs like "127.0.0.1" or "10.0.0.0/8"
+func parseTrustedProxies(list []string) (trustedProxies, error) {
+	var nets trustedProxies
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (t trustedProxies) contains(ip net.IP) bool {
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withForwardedFor sets RemoteAddr to the real client for requests arriving
+// through a trusted proxy: the nearest X-Forwarded-For hop that isn't itself
+// a trusted proxy. Anyone else's X-Forwarded-For is ignored, since clients
+// can send whatever they like.
+func withForwardedFor(trusted trustedProxies, next http.Handler) http.Handler {
+	if len(trusted) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := net.ParseIP(clientAddress(r))
+		xff := r.Header.Values("X-Forwarded-For")
+		if peer == nil || !trusted.contains(peer) || len(xff) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			client = ip.String()
+			if !trusted.contains(ip) {
+				break
+			}
+		}
+		if client != "" {
+			r = r.WithContext(r.Context())
+			r.RemoteAddr = client
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,342 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// psbtMagic prefixes every serialized PSBT (BIP 174)
+var psbtMagic = []byte{'p', 's', 'b', 't', 0xff}
+
+// maxPSBTSize bounds uploaded PSBTs
+const maxPSBTSize = 1 << 20
+
+type PSBTOutput struct {
+	Address string     `json:"address"`
+	Amount  rpc.Amount `json:"amount"`
+}
+
+type PSBTCreateRequest struct {
+	Outputs     []PSBTOutput   `json:"outputs"`
+	Inputs      []rpc.Outpoint `json:"inputs,omitempty"`
+	ConfTarget  int            `json:"conf_target,omitempty"`
+	FeeRate     float64        `json:"fee_rate,omitempty"` // sat/vB
+	Replaceable bool           `json:"replaceable,omitempty"`
+}
+
+type PSBTRequest struct {
+	PSBT      string `json:"psbt"`
+	Sign      bool   `json:"sign,omitempty"`
+	Broadcast bool   `json:"broadcast,omitempty"`
+}
+
+type PSBTResponse struct {
+	Success   bool       `json:"success"`
+	PSBT      string     `json:"psbt,omitempty"`
+	Fee       rpc.Amount `json:"fee,omitempty"`
+	ChangePos *int       `json:"change_pos,omitempty"`
+	Complete  bool       `json:"complete"`
+	Hex       string     `json:"hex,omitempty"`
+	Txid      string     `json:"txid,omitempty"`
+	Inputs    int        `json:"inputs,omitempty"`
+	Outputs   int        `json:"outputs,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// normalizePSBT accepts a PSBT as raw binary or base64 text and returns it
+// base64 encoded, the form every node RPC expects
+func normalizePSBT(data []byte) (string, error) {
+	if bytes.HasPrefix(data, psbtMagic) {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+
+	text := strings.Join(strings.Fields(string(data)), "")
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return "", fmt.Errorf("PSBT is neither binary nor valid base64")
+	}
+	if !bytes.HasPrefix(raw, psbtMagic) {
+		return "", fmt.Errorf("data is not a PSBT")
+	}
+	return text, nil
+}
+
+// decodePSBTRequest reads a PSBTRequest and normalizes its psbt field
+func decodePSBTRequest(r *http.Request) (PSBTRequest, error) {
+	var req PSBTRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2*maxPSBTSize)).Decode(&req); err != nil {
+		return req, fmt.Errorf("Invalid request format")
+	}
+	psbt, err := normalizePSBT([]byte(req.PSBT))
+	if err != nil {
+		return req, err
+	}
+	req.PSBT = psbt
+	return req, nil
+}
+
+// fundingArgs returns the walletcreatefundedpsbt outputs and options for
+// req, or a message for the client if it is invalid
+func (req PSBTCreateRequest) fundingArgs() ([]map[string]interface{}, map[string]interface{}, string) {
+	if len(req.Outputs) == 0 {
+		return nil, nil, "Invalid request format: at least one output is required"
+	}
+	outputs := []map[string]interface{}{}
+	for _, out := range req.Outputs {
+		if out.Address == "" || out.Amount <= 0 {
+			return nil, nil, "Each output needs an address and a positive amount"
+		}
+		outputs = append(outputs, map[string]interface{}{out.Address: out.Amount.Number()})
+	}
+
+	options := map[string]interface{}{
+		"includeWatching": true,
+		"replaceable":     req.Replaceable,
+	}
+	if req.FeeRate > 0 {
+		options["fee_rate"] = req.FeeRate
+	} else if req.ConfTarget > 0 {
+		options["conf_target"] = req.ConfTarget
+	}
+	return outputs, options, ""
+}
+
+// HandlePSBTCreate creates a funded, unsigned PSBT. Watch-only coins are
+// included so keys held by a hardware wallet or offline machine can fund it.
+func (ws *WalletServer) HandlePSBTCreate(w http.ResponseWriter, r *http.Request) {
+	var req PSBTCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   "Invalid request format: at least one output is required",
+		})
+		return
+	}
+	outputs, options, msg := req.fundingArgs()
+	if msg != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   msg,
+		})
+		return
+	}
+
+	result, err := ws.rpc(r).WalletCreateFundedPSBT(req.Inputs, outputs, options)
+	if err != nil {
+		logRequest(r, "[API] PSBTCreate ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create PSBT: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] PSBTCreate SUCCESS: fee %s KCN", result.Fee)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PSBTResponse{
+		Success:   true,
+		PSBT:      result.PSBT,
+		Fee:       result.Fee,
+		ChangePos: &result.ChangePos,
+	})
+}
+
+// HandlePSBTProcess fills in wallet data for a PSBT and optionally signs the
+// inputs the node wallet holds keys for
+func (ws *WalletServer) HandlePSBTProcess(w http.ResponseWriter, r *http.Request) {
+	req, err := decodePSBTRequest(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := ws.rpc(r).WalletProcessPSBT(req.PSBT, req.Sign)
+	if err != nil {
+		logRequest(r, "[API] PSBTProcess ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to process PSBT: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] PSBTProcess SUCCESS: complete=%v", result.Complete)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PSBTResponse{
+		Success:  true,
+		PSBT:     result.PSBT,
+		Complete: result.Complete,
+	})
+}
+
+// HandlePSBTFinalize finalizes a signed PSBT, returning the raw transaction
+// and broadcasting it when requested
+func (ws *WalletServer) HandlePSBTFinalize(w http.ResponseWriter, r *http.Request) {
+	req, err := decodePSBTRequest(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	result, err := ws.rpc(r).FinalizePSBT(req.PSBT)
+	if err != nil {
+		logRequest(r, "[API] PSBTFinalize ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to finalize PSBT: %v", err),
+		})
+		return
+	}
+
+	response := PSBTResponse{
+		Success:  true,
+		PSBT:     result.PSBT,
+		Complete: result.Complete,
+		Hex:      result.Hex,
+	}
+
+	if req.Broadcast {
+		if !result.Complete {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			response.Success = false
+			response.Error = "PSBT is not fully signed; cannot broadcast"
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		txid, err := ws.rpc(r).SendRawTransaction(result.Hex)
+		if err != nil {
+			logRequest(r, "[API] PSBTFinalize broadcast ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			response.Success = false
+			response.Error = fmt.Sprintf("Failed to broadcast transaction: %v", err)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		response.Txid = txid
+		logRequest(r, "[API] PSBTFinalize broadcast SUCCESS: txid=%s", txid)
+	}
+
+	logRequest(r, "[API] PSBTFinalize SUCCESS: complete=%v", result.Complete)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandlePSBTImport accepts a PSBT file (raw binary or base64 text) and returns
+// it base64 encoded with a short summary for review
+func (ws *WalletServer) HandlePSBTImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxPSBTSize+1))
+	if err != nil || len(data) > maxPSBTSize {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   "Failed to read PSBT (limit is 1 MiB)",
+		})
+		return
+	}
+
+	// JSON bodies carry the PSBT in a "psbt" field
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req PSBTRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(PSBTResponse{
+				Success: false,
+				Error:   "Invalid request format",
+			})
+			return
+		}
+		data = []byte(req.PSBT)
+	}
+
+	psbt, err := normalizePSBT(data)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	decoded, err := ws.rpc(r).DecodePSBT(psbt)
+	if err != nil {
+		logRequest(r, "[API] PSBTImport ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to decode PSBT: %v", err),
+		})
+		return
+	}
+
+	response := PSBTResponse{
+		Success: true,
+		PSBT:    psbt,
+		Fee:     rpc.GetAmount(decoded, "fee"),
+	}
+	if inputs, ok := decoded["inputs"].([]interface{}); ok {
+		response.Inputs = len(inputs)
+	}
+	if outputs, ok := decoded["outputs"].([]interface{}); ok {
+		response.Outputs = len(outputs)
+	}
+
+	logRequest(r, "[API] PSBTImport SUCCESS: %d inputs, %d outputs", response.Inputs, response.Outputs)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandlePSBTExport returns a base64 PSBT as a binary .psbt file for transfer
+// to a signing device
+func (ws *WalletServer) HandlePSBTExport(w http.ResponseWriter, r *http.Request) {
+	req, err := decodePSBTRequest(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(PSBTResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(req.PSBT)
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="transaction.psbt"`)
+	w.Write(raw)
+}
@@ -0,0 +1,640 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Signing request statuses
+const (
+	SigningAwaiting  = "awaiting_signature"
+	SigningPartial   = "partially_signed" // some inputs still need a signature
+	SigningSigned    = "signed"           // complete, ready to broadcast
+	SigningBroadcast = "broadcast"
+	SigningCancelled = "cancelled"
+)
+
+const (
+	// psbtQRChunkSize is the base64 characters per QR frame, small enough
+	// for hardware wallet cameras to read at a glance
+	psbtQRChunkSize = 400
+	// maxPSBTQRParts bounds an uploaded frame sequence
+	maxPSBTQRParts = 1000
+	// maxSigningLabelLength bounds a signing request's label
+	maxSigningLabelLength = 100
+)
+
+// SigningRequest is a transaction built by the node wallet from watch-only
+// coins, waiting for a hardware wallet or air-gapped machine to sign it.
+// The PSBT goes out as a file or animated QR code and comes back signed;
+// signed copies from several devices are combined until it is complete.
+// No private key ever reaches the server.
+type SigningRequest struct {
+	ID            string       `json:"id"`
+	Label         string       `json:"label,omitempty"`
+	Status        string       `json:"status"`
+	UnsignedTxid  string       `json:"unsigned_txid"` // identifies uploads of the same transaction
+	PSBT          string       `json:"psbt"`          // with every signature uploaded so far
+	Hex           string       `json:"hex,omitempty"` // once signed
+	Txid          string       `json:"txid,omitempty"`
+	Fee           rpc.Amount   `json:"fee"`
+	Outputs       []PSBTOutput `json:"outputs"`
+	Uploads       int          `json:"uploads"`
+	MultisigID    string       `json:"multisig_id,omitempty"` // spends a multisig address
+	AutoBroadcast bool         `json:"auto_broadcast,omitempty"`
+	CreatedAt     int64        `json:"created_at"`
+	UpdatedAt     int64        `json:"updated_at"`
+	BroadcastAt   int64        `json:"broadcast_at,omitempty"`
+}
+
+type SigningRequestCreate struct {
+	PSBTCreateRequest
+	Label string `json:"label,omitempty"`
+	// Broadcast sends the transaction as soon as the last signature is in
+	Broadcast bool `json:"broadcast,omitempty"`
+}
+
+// SigningUploadRequest carries a signed PSBT, whole or as the scanned
+// frames of an animated QR code
+type SigningUploadRequest struct {
+	PSBT  string   `json:"psbt,omitempty"`
+	Parts []string `json:"parts,omitempty"`
+}
+
+type SigningRequestResponse struct {
+	Success        bool            `json:"success"`
+	Request        *SigningRequest `json:"request,omitempty"`
+	Cosigners      *CosignerStatus `json:"cosigners,omitempty"`       // multisig spends only
+	BroadcastError string          `json:"broadcast_error,omitempty"` // signed, but the auto-broadcast failed
+	Error          string          `json:"error,omitempty"`
+}
+
+type SigningRequestListResponse struct {
+	Success  bool             `json:"success"`
+	Requests []SigningRequest `json:"requests"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// SigningQRResponse lists the QR frames of a signing request's PSBT, as
+// text and as image URLs, in display order
+type SigningQRResponse struct {
+	Success bool     `json:"success"`
+	Parts   []string `json:"parts"`
+	Images  []string `json:"images"`
+}
+
+const signingRequestColumns = `id, label, status, unsigned_txid, psbt, hex, txid, fee, outputs,
+	uploads, multisig_id, auto_broadcast, created_at, updated_at, broadcast_at`
+
+func scanSigningRequest(row interface{ Scan(...interface{}) error }) (SigningRequest, error) {
+	var s SigningRequest
+	var outputs string
+	err := row.Scan(&s.ID, &s.Label, &s.Status, &s.UnsignedTxid, &s.PSBT, &s.Hex, &s.Txid, &s.Fee, &outputs,
+		&s.Uploads, &s.MultisigID, &s.AutoBroadcast, &s.CreatedAt, &s.UpdatedAt, &s.BroadcastAt)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal([]byte(outputs), &s.Outputs)
+	return s, err
+}
+
+// SaveSigningRequest stores a new signing request
+func (s *Store) SaveSigningRequest(req SigningRequest) error {
+	outputs, err := json.Marshal(req.Outputs)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO signing_requests (`+signingRequestColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.ID, req.Label, req.Status, req.UnsignedTxid, req.PSBT, req.Hex, req.Txid, req.Fee, string(outputs),
+		req.Uploads, req.MultisigID, req.AutoBroadcast, req.CreatedAt, req.UpdatedAt, req.BroadcastAt)
+	return err
+}
+
+// UpdateSigningRequest saves a signing request's progress
+func (s *Store) UpdateSigningRequest(req SigningRequest) error {
+	_, err := s.db.Exec(`UPDATE signing_requests SET status = ?, psbt = ?, hex = ?, txid = ?,
+		uploads = ?, updated_at = ?, broadcast_at = ? WHERE id = ?`,
+		req.Status, req.PSBT, req.Hex, req.Txid, req.Uploads, req.UpdatedAt, req.BroadcastAt, req.ID)
+	return err
+}
+
+// SigningRequest returns the signing request with id, or nil if there is none
+func (s *Store) SigningRequest(id string) (*SigningRequest, error) {
+	req, err := scanSigningRequest(s.db.QueryRow(`SELECT `+signingRequestColumns+` FROM signing_requests WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// SigningRequests returns the newest signing requests
+func (s *Store) SigningRequests(limit int) ([]SigningRequest, error) {
+	rows, err := s.db.Query(`SELECT `+signingRequestColumns+` FROM signing_requests
+		ORDER BY created_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []SigningRequest{}
+	for rows.Next() {
+		req, err := scanSigningRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+// psbtQRParts splits a base64 PSBT into QR frames. A PSBT that fits one
+// frame is returned as is; longer ones use the "pMofN " prefix that
+// Specter-style signers read as an animated QR code.
+func psbtQRParts(psbt string) []string {
+	if len(psbt) <= psbtQRChunkSize {
+		return []string{psbt}
+	}
+	n := (len(psbt) + psbtQRChunkSize - 1) / psbtQRChunkSize
+	parts := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		chunk := psbt[i*psbtQRChunkSize : min((i+1)*psbtQRChunkSize, len(psbt))]
+		parts = append(parts, fmt.Sprintf("p%dof%d %s", i+1, n, chunk))
+	}
+	return parts
+}
+
+// joinPSBTParts reassembles scanned QR frames, in any order and with
+// repeats, into the PSBT they carry
+func joinPSBTParts(parts []string) (string, error) {
+	if len(parts) == 1 && !strings.HasPrefix(parts[0], "p") {
+		return parts[0], nil
+	}
+
+	var chunks []string
+	for i, part := range parts {
+		prefix, chunk, ok := strings.Cut(strings.TrimSpace(part), " ")
+		var m, n int
+		if ok {
+			_, err := fmt.Sscanf(prefix, "p%dof%d", &m, &n)
+			ok = err == nil && n >= 1 && n <= maxPSBTQRParts && m >= 1 && m <= n
+		}
+		if !ok {
+			return "", fmt.Errorf("QR frame %d is not of the form \"pMofN data\"", i+1)
+		}
+		if chunks == nil {
+			chunks = make([]string, n)
+		}
+		if len(chunks) != n {
+			return "", fmt.Errorf("QR frames are from different sequences")
+		}
+		chunks[m-1] = chunk
+	}
+	for i, chunk := range chunks {
+		if chunk == "" {
+			return "", fmt.Errorf("QR frame %d of %d is missing", i+1, len(chunks))
+		}
+	}
+	return strings.Join(chunks, ""), nil
+}
+
+// psbtUnsignedTxid returns the txid of a PSBT's unsigned transaction,
+// which signing doesn't change
+func psbtUnsignedTxid(client rpc.WalletBackend, psbt string) (string, error) {
+	decoded, err := client.DecodePSBT(psbt)
+	if err != nil {
+		return "", err
+	}
+	tx, _ := decoded["tx"].(map[string]interface{})
+	txid := rpc.GetString(tx, "txid")
+	if txid == "" {
+		return "", fmt.Errorf("decodepsbt returned no txid")
+	}
+	return txid, nil
+}
+
+// HandleSigningRequests lists (GET, newest first) or creates (POST) signing
+// requests. Creating takes a PSBTCreateRequest and an optional label.
+func (ws *WalletServer) HandleSigningRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		requests, err := ws.store.SigningRequests(100)
+		if err != nil {
+			logRequest(r, "[API] SigningRequests ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(SigningRequestListResponse{
+				Success: false,
+				Error:   "Failed to load signing requests",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SigningRequestListResponse{Success: true, Requests: requests})
+		return
+
+	case http.MethodPost:
+	}
+
+	var req SigningRequestCreate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+	ws.createSigningRequest(w, r, req, nil)
+}
+
+// createSigningRequest funds req's PSBT and saves it as a signing request.
+// A multisig spend is funded from the multisig address only, with change
+// back to it.
+func (ws *WalletServer) createSigningRequest(w http.ResponseWriter, r *http.Request, req SigningRequestCreate, multisig *MultisigWallet) {
+	outputs, options, msg := req.fundingArgs()
+	if msg == "" && len(req.Label) > maxSigningLabelLength {
+		msg = fmt.Sprintf("label may be at most %d characters", maxSigningLabelLength)
+	}
+	if msg != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SigningRequestResponse{Success: false, Error: msg})
+		return
+	}
+
+	client := ws.rpc(r)
+	if multisig != nil {
+		if len(req.Inputs) == 0 {
+			inputs, err := multisigInputs(client, multisig.Address)
+			if err != nil {
+				logRequest(r, "[API] SigningRequest ERROR: %v", err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadGateway)
+				json.NewEncoder(w).Encode(SigningRequestResponse{
+					Success: false,
+					Error:   fmt.Sprintf("Failed to list the multisig coins: %v", err),
+				})
+				return
+			}
+			req.Inputs = inputs
+		}
+		if len(req.Inputs) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(SigningRequestResponse{
+				Success: false,
+				Error:   "The multisig address has no confirmed coins",
+			})
+			return
+		}
+		options["add_inputs"] = false
+		options["changeAddress"] = multisig.Address
+	}
+	result, err := client.WalletCreateFundedPSBT(req.Inputs, outputs, options)
+	if err != nil {
+		logRequest(r, "[API] SigningRequest ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create PSBT: %v", err),
+		})
+		return
+	}
+
+	txid, err := psbtUnsignedTxid(client, result.PSBT)
+	var id string
+	if err == nil {
+		id, err = newSessionID()
+	}
+	if err != nil {
+		logRequest(r, "[API] SigningRequest ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   "Failed to create signing request",
+		})
+		return
+	}
+
+	now := time.Now().Unix()
+	signing := SigningRequest{
+		ID:            id,
+		Label:         req.Label,
+		Status:        SigningAwaiting,
+		UnsignedTxid:  txid,
+		PSBT:          result.PSBT,
+		Fee:           result.Fee,
+		Outputs:       req.Outputs,
+		AutoBroadcast: req.Broadcast,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if multisig != nil {
+		signing.MultisigID = multisig.ID
+	}
+	if err := ws.store.SaveSigningRequest(signing); err != nil {
+		logRequest(r, "[API] SigningRequest ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   "Failed to save signing request",
+		})
+		return
+	}
+
+	logRequest(r, "[API] SigningRequest SUCCESS: %s for %s, fee %s KCN", signing.ID, signing.UnsignedTxid, signing.Fee)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SigningRequestResponse{
+		Success:   true,
+		Request:   &signing,
+		Cosigners: ws.cosignerStatus(client, &signing),
+	})
+}
+
+// signingRequestRoute serves one signing request, action saying which
+// part of it; StartServer routes
+//
+//	GET  /api/psbt/requests/{id}              the request and its current PSBT
+//	GET  /api/psbt/requests/{id}/psbt         the PSBT as a binary .psbt file
+//	GET  /api/psbt/requests/{id}/qr           the PSBT's QR frames
+//	GET  /api/psbt/requests/{id}/qr/{frame}   one frame (from 1) as an image
+//	POST /api/psbt/requests/{id}/signed       upload a signed PSBT
+//	POST /api/psbt/requests/{id}/broadcast    broadcast the signed transaction
+//	POST /api/psbt/requests/{id}/cancel       give up on it
+func (ws *WalletServer) signingRequestRoute(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ws.serveSigningRequest(w, r, action)
+	}
+}
+
+func (ws *WalletServer) serveSigningRequest(w http.ResponseWriter, r *http.Request, action string) {
+	// Uploads and broadcasts read, change and save the request
+	if r.Method == http.MethodPost {
+		ws.signingMu.Lock()
+		defer ws.signingMu.Unlock()
+	}
+
+	signing, err := ws.store.SigningRequest(pathParam(r, "id"))
+	if err != nil || signing == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   "Signing request not found",
+		})
+		return
+	}
+
+	switch action {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success:   true,
+			Request:   signing,
+			Cosigners: ws.cosignerStatus(ws.rpc(r), signing),
+		})
+	case "psbt":
+		raw, _ := base64.StdEncoding.DecodeString(signing.PSBT)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.psbt"`, signing.UnsignedTxid))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(raw)
+	case "qr":
+		ws.serveSigningQR(w, r, signing, "")
+	case "qr/frame":
+		ws.serveSigningQR(w, r, signing, pathParam(r, "frame"))
+	case "signed":
+		ws.serveSigningUpload(w, r, signing)
+	case "broadcast":
+		ws.serveSigningBroadcast(w, r, signing)
+	case "cancel":
+		ws.serveSigningCancel(w, r, signing)
+	}
+}
+
+// serveSigningQR lists the QR frames, or renders frame if it is set. Image URLs
+// carry the upload count so a PSBT updated by an upload isn't served from
+// a cached frame.
+func (ws *WalletServer) serveSigningQR(w http.ResponseWriter, r *http.Request, signing *SigningRequest, frame string) {
+	parts := psbtQRParts(signing.PSBT)
+	if frame == "" {
+		images := make([]string, len(parts))
+		for i := range parts {
+			images[i] = urlPath(fmt.Sprintf("/api/psbt/requests/%s/qr/%d?v=%d", signing.ID, i+1, signing.Uploads))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SigningQRResponse{Success: true, Parts: parts, Images: images})
+		return
+	}
+
+	n, err := strconv.Atoi(frame)
+	if err != nil || n < 1 || n > len(parts) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Frame must be between 1 and %d", len(parts))})
+		return
+	}
+	writeQR(w, r, parts[n-1])
+}
+
+// serveSigningUpload accepts a signed copy of the request's PSBT, as a JSON
+// SigningUploadRequest or a raw binary or base64 body, and combines it
+// with the signatures already collected
+func (ws *WalletServer) serveSigningUpload(w http.ResponseWriter, r *http.Request, signing *SigningRequest) {
+	if signing.Status != SigningAwaiting && signing.Status != SigningPartial {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Request: signing,
+			Error:   fmt.Sprintf("Signing request is %s", signing.Status),
+		})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, 2*maxPSBTSize+1))
+	if err == nil && len(data) > 2*maxPSBTSize {
+		err = fmt.Errorf("Failed to read PSBT (limit is 1 MiB)")
+	}
+	if err == nil && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req SigningUploadRequest
+		if err = json.Unmarshal(data, &req); err != nil {
+			err = fmt.Errorf("Invalid request format")
+		} else if len(req.Parts) > 0 {
+			var joined string
+			joined, err = joinPSBTParts(req.Parts)
+			data = []byte(joined)
+		} else {
+			data = []byte(req.PSBT)
+		}
+	}
+	var psbt string
+	if err == nil {
+		psbt, err = normalizePSBT(data)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	client := ws.rpc(r)
+	txid, err := psbtUnsignedTxid(client, psbt)
+	if err == nil && txid != signing.UnsignedTxid {
+		err = fmt.Errorf("it is for transaction %s, not %s", txid, signing.UnsignedTxid)
+	}
+	var combined string
+	if err == nil {
+		combined, err = client.CombinePSBT([]string{signing.PSBT, psbt})
+	}
+	var result *rpc.PSBTResult
+	if err == nil {
+		result, err = client.FinalizePSBT(combined)
+	}
+	if err != nil {
+		logRequest(r, "[API] SigningUpload ERROR: %s: %v", signing.ID, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Signed PSBT rejected: %v", err),
+		})
+		return
+	}
+
+	signing.PSBT = combined
+	signing.Uploads++
+	signing.Status = SigningPartial
+	if result.Complete {
+		signing.Status = SigningSigned
+		signing.Hex = result.Hex
+	}
+	signing.UpdatedAt = time.Now().Unix()
+
+	// A failed broadcast leaves the request signed, to retry by hand
+	response := SigningRequestResponse{Success: true, Request: signing}
+	if signing.Status == SigningSigned && signing.AutoBroadcast {
+		if err := broadcastSigningRequest(client, signing); err != nil {
+			logRequest(r, "[API] SigningUpload WARNING: %s: broadcast failed: %v", signing.ID, err)
+			response.BroadcastError = fmt.Sprintf("Failed to broadcast transaction: %v", err)
+		}
+	}
+	if !ws.saveSigningRequest(w, r, signing) {
+		return
+	}
+	response.Cosigners = ws.cosignerStatus(client, signing)
+
+	logRequest(r, "[API] SigningUpload SUCCESS: %s is %s", signing.ID, signing.Status)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// serveSigningBroadcast sends a fully signed request's transaction
+func (ws *WalletServer) serveSigningBroadcast(w http.ResponseWriter, r *http.Request, signing *SigningRequest) {
+	if signing.Status != SigningSigned {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Request: signing,
+			Error:   fmt.Sprintf("Signing request is %s; only a signed one can be broadcast", signing.Status),
+		})
+		return
+	}
+
+	if err := broadcastSigningRequest(ws.rpc(r), signing); err != nil {
+		logRequest(r, "[API] SigningBroadcast ERROR: %s: %v", signing.ID, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Request: signing,
+			Error:   fmt.Sprintf("Failed to broadcast transaction: %v", err),
+		})
+		return
+	}
+
+	if !ws.saveSigningRequest(w, r, signing) {
+		return
+	}
+
+	logRequest(r, "[API] SigningBroadcast SUCCESS: %s txid=%s", signing.ID, signing.Txid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SigningRequestResponse{Success: true, Request: signing})
+}
+
+// broadcastSigningRequest sends a signed request's transaction and marks
+// it broadcast
+func broadcastSigningRequest(client rpc.WalletBackend, signing *SigningRequest) error {
+	txid, err := client.SendRawTransaction(signing.Hex)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	signing.Status = SigningBroadcast
+	signing.Txid = txid
+	signing.BroadcastAt = now
+	signing.UpdatedAt = now
+	return nil
+}
+
+// serveSigningCancel abandons a request that hasn't been broadcast
+func (ws *WalletServer) serveSigningCancel(w http.ResponseWriter, r *http.Request, signing *SigningRequest) {
+	if signing.Status == SigningBroadcast {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Request: signing,
+			Error:   "Signing request was already broadcast",
+		})
+		return
+	}
+
+	signing.Status = SigningCancelled
+	signing.UpdatedAt = time.Now().Unix()
+	if !ws.saveSigningRequest(w, r, signing) {
+		return
+	}
+
+	logRequest(r, "[API] SigningCancel SUCCESS: %s", signing.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SigningRequestResponse{Success: true, Request: signing})
+}
+
+// saveSigningRequest stores signing's progress, writing the error response
+// when it can't
+func (ws *WalletServer) saveSigningRequest(w http.ResponseWriter, r *http.Request, signing *SigningRequest) bool {
+	if err := ws.store.UpdateSigningRequest(*signing); err != nil {
+		logRequest(r, "[API] SigningRequest ERROR: saving %s: %v", signing.ID, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SigningRequestResponse{
+			Success: false,
+			Error:   "Failed to save signing request",
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// maxQRData bounds what /api/qr will encode; payment URIs are far shorter
+	maxQRData = 1024
+
+	defaultQRSize = 256
+	maxQRSize     = 1024
+)
+
+// writeQR renders data as a PNG (default) or SVG QR code. ?format=svg picks
+// SVG, ?size= the PNG width in pixels.
+func writeQR(w http.ResponseWriter, r *http.Request, data string) {
+	q, err := qrcode.New(data, qrcode.Medium)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Cannot encode QR code: %v", err)})
+		return
+	}
+
+	// QR codes for addresses and payment requests never change, but they
+	// are still the user's addresses
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+
+	if r.URL.Query().Get("format") == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(qrSVG(q.Bitmap())))
+		return
+	}
+
+	size := defaultQRSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			size = min(n, maxQRSize)
+		}
+	}
+	png, err := q.PNG(size)
+	if err != nil {
+		logRequest(r, "[API] QR ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to render QR code"})
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// qrSVG draws a QR bitmap (quiet zone included) as one path of unit squares
+func qrSVG(bitmap [][]bool) string {
+	n := len(bitmap)
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`, n, n, n, n, path.String())
+}
+
+// HandleQR renders ?data= as a QR code image
+func (ws *WalletServer) HandleQR(w http.ResponseWriter, r *http.Request) {
+	data := r.URL.Query().Get("data")
+	if data == "" || len(data) > maxQRData {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": fmt.Sprintf("data is required and may be at most %d bytes", maxQRData),
+		})
+		return
+	}
+	writeQR(w, r, data)
+}
+
+// serveAddressQR renders a payment URI for address as a QR code; amount,
+// label and message may be given as for /api/payment-uri
+func (ws *WalletServer) serveAddressQR(w http.ResponseWriter, r *http.Request, address string) {
+	if valid, err := ws.rpc(r).ValidateAddress(address); err != nil || !valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid address"})
+		return
+	}
+
+	amount, label, message, err := parsePaymentRequest(r)
+	if err != nil || amount < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid amount"})
+		return
+	}
+	writeQR(w, r, paymentURI(address, amount, label, message))
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+)
+
+// RunConfigReloader re-reads the configuration from the same file, env and
+// args on every SIGHUP and applies what can change without a restart: the
+// log level, rate limits and price settings. Sessions and connections are
+// untouched. A configuration that fails to load or validate is rejected and
+// the running one kept.
+func (ws *WalletServer) RunConfigReloader(args []string, current Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		cfg, _, err := loadConfig(args)
+		if err != nil {
+			log.Printf("[CONFIG] ERROR: reload rejected, keeping the running configuration: %v", err)
+			continue
+		}
+		if err := ws.applyConfig(current, cfg); err != nil {
+			log.Printf("[CONFIG] ERROR: reload rejected, keeping the running configuration: %v", err)
+			continue
+		}
+		// Keep comparing against what is actually running, so a pending
+		// restart-only change is warned about on every reload
+		current.Prices, current.Log.Level, current.RateLimit = cfg.Prices, cfg.Log.Level, cfg.RateLimit
+	}
+}
+
+// applyConfig moves the reloadable settings from old to cfg and warns about
+// changes that need a restart
+func (ws *WalletServer) applyConfig(old, cfg Config) error {
+	if !reflect.DeepEqual(old.Prices, cfg.Prices) {
+		prices, err := priceServiceFromConfig(cfg.Prices)
+		if err != nil {
+			return err
+		}
+		ws.prices.Store(prices)
+		log.Printf("[CONFIG] Price settings reloaded")
+	}
+
+	if old.RateLimit != cfg.RateLimit {
+		ws.limiter.update(cfg.RateLimit)
+		log.Printf("[CONFIG] Rate limit set to %g/s, burst %d", cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	}
+
+	// Last, so raising the level doesn't hide the lines above
+	if old.Log.Level != cfg.Log.Level {
+		log.Printf("[CONFIG] Log level set to %s", cfg.Log.Level)
+		if err := setLogLevel(cfg.Log.Level); err != nil {
+			return err
+		}
+	}
+
+	// Everything else is read once at startup
+	old.Prices, old.Log.Level, old.RateLimit = cfg.Prices, cfg.Log.Level, cfg.RateLimit
+	for _, section := range []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"rpc", old.RPC, cfg.RPC},
+		{"backend", old.Backend, cfg.Backend},
+		{"electrum", old.Electrum, cfg.Electrum},
+		{"server", old.Server, cfg.Server},
+		{"tls", old.TLS, cfg.TLS},
+		{"auth", old.Auth, cfg.Auth},
+		{"oidc", old.OIDC, cfg.OIDC},
+		{"cache", old.Cache, cfg.Cache},
+		{"intervals", old.Intervals, cfg.Intervals},
+		{"fees", old.Fees, cfg.Fees},
+		{"log", old.Log, cfg.Log},
+		{"debug", old.Debug, cfg.Debug},
+		{"error_reporting", old.Errors, cfg.Errors},
+		{"telegram", old.Telegram, cfg.Telegram},
+		{"checkout", old.Checkout, cfg.Checkout},
+		{"tor", old.Tor, cfg.Tor},
+		{"key_export", old.KeyExport, cfg.KeyExport},
+		{"notifications", old.Notifications, cfg.Notifications},
+		{"multi_user", old.MultiUser, cfg.MultiUser},
+		{"store_path", old.StorePath, cfg.StorePath},
+		{"backup_dir", old.BackupDir, cfg.BackupDir},
+		{"network", old.Network, cfg.Network},
+		{"startup_check", old.StartupCheck, cfg.StartupCheck},
+		{"sensitive_response_encryption", old.SensitiveResponseEncryption, cfg.SensitiveResponseEncryption},
+		{"amount_format", old.AmountFormat, cfg.AmountFormat},
+		{"time_zone", old.TimeZone, cfg.TimeZone},
+		{"messages_dir", old.MessagesDir, cfg.MessagesDir},
+		{"broadcast_only", old.BroadcastOnly, cfg.BroadcastOnly},
+		{"demo", old.Demo, cfg.Demo},
+	} {
+		if !reflect.DeepEqual(section.old, section.new) {
+			log.Printf("[CONFIG] WARNING: %s changed; restart to apply it", section.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"log"
+	"sync"
+)
+
+// Transaction statuses
+const (
+	TxStatusConfirmed  = "confirmed"
+	TxStatusPending    = "pending"
+	TxStatusReorged    = "reorged" // was confirmed, then its block left the chain
+	TxStatusConflicted = "conflicted"
+	TxStatusAbandoned  = "abandoned"
+)
+
+// Events for transactions that are no longer where they were
+const (
+	EventTxReorged    = "tx_reorged"    // a confirmed transaction lost its confirmations
+	EventTxConflicted = "tx_conflicted" // a double-spend of the transaction was mined
+)
+
+// TxReorgEvent is the data of tx_reorged and tx_conflicted events
+type TxReorgEvent struct {
+	TransactionResponse
+	PreviousConfirmations int `json:"previous_confirmations"`
+}
+
+// reorgTracker remembers transactions knocked out of the chain, which look
+// like any unconfirmed one to the node, and which transactions it has
+// already reported. It is in memory only: after a restart they are pending.
+// Transactions are kept by owner and txid, so one in two users' wallets is
+// reported to both.
+type reorgTracker struct {
+	mu         sync.Mutex
+	reorged    map[string]bool
+	conflicted map[string]bool
+}
+
+// reorgKey is the tracker's key for txid in owner's wallet
+func reorgKey(owner, txid string) string {
+	return owner + "/" + txid
+}
+
+func newReorgTracker() *reorgTracker {
+	return &reorgTracker{reorged: map[string]bool{}, conflicted: map[string]bool{}}
+}
+
+// status is the status of tx in owner's wallet as of what the tracker has
+// seen
+func (t *reorgTracker) status(owner string, tx TransactionResponse) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case tx.Abandoned:
+		return TxStatusAbandoned
+	case tx.Conflicted:
+		return TxStatusConflicted
+	case tx.Confirmations > 0:
+		return TxStatusConfirmed
+	case t.reorged[reorgKey(owner, tx.Txid)]:
+		return TxStatusReorged
+	default:
+		return TxStatusPending
+	}
+}
+
+// setStatuses fills in the Status of each entry of owner's wallet
+func (ws *WalletServer) setStatuses(owner string, transactions []TransactionResponse) {
+	for i := range transactions {
+		transactions[i].Status = ws.reorgs.status(owner, transactions[i])
+	}
+}
+
+// noteConfirmations compares tx in owner's wallet with the confirmations
+// it had before and publishes an event the first time it drops out of the
+// chain or is conflicted. The event watcher and the transaction sync both
+// report here, so each change is published once whichever sees it first.
+func (ws *WalletServer) noteConfirmations(owner string, tx TransactionResponse, before int) {
+	t := ws.reorgs
+	key := reorgKey(owner, tx.Txid)
+	t.mu.Lock()
+	var event string
+	switch {
+	case tx.Confirmations < 0:
+		if before >= 0 && !t.conflicted[key] {
+			t.conflicted[key] = true
+			delete(t.reorged, key)
+			event = EventTxConflicted
+		}
+	case tx.Confirmations == 0:
+		if before > 0 && !t.reorged[key] && !tx.Abandoned {
+			t.reorged[key] = true
+			event = EventTxReorged
+		}
+	default:
+		delete(t.reorged, key)
+		delete(t.conflicted, key)
+	}
+	t.mu.Unlock()
+	if event == "" {
+		return
+	}
+
+	if event == EventTxConflicted {
+		log.Printf("[EVENTS] WARNING: %s is conflicted by a mined double-spend (had %d confirmations)", tx.Txid, before)
+	} else {
+		log.Printf("[EVENTS] WARNING: %s lost its %d confirmations in a reorg", tx.Txid, before)
+	}
+	entries := []TransactionResponse{tx}
+	setDirections(entries)
+	ws.setStatuses(owner, entries)
+	ws.events.PublishFor(owner, event, TxReorgEvent{TransactionResponse: entries[0], PreviousConfirmations: before})
+}
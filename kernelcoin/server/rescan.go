@@ -0,0 +1,285 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Wallet job states
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// maxWalletJobs is how many finished jobs are remembered
+const maxWalletJobs = 50
+
+// WalletJob is a long node wallet operation running in the background. Jobs
+// live in memory only and are forgotten on restart.
+type WalletJob struct {
+	ID          string  `json:"id"`
+	Kind        string  `json:"kind"` // rescan or import
+	Status      string  `json:"status"`
+	StartHeight int64   `json:"start_height"`
+	StopHeight  int64   `json:"stop_height,omitempty"` // the tip when 0
+	Progress    float64 `json:"progress"`              // 0 to 1, from getwalletinfo
+	Error       string  `json:"error,omitempty"`
+	StartedAt   int64   `json:"started_at"`
+	FinishedAt  int64   `json:"finished_at,omitempty"`
+}
+
+// walletJobs tracks background wallet jobs. The node scans for one wallet
+// operation at a time, so at most one job runs.
+type walletJobs struct {
+	mu     sync.Mutex
+	jobs   map[string]*WalletJob
+	order  []string // oldest first
+	active string
+}
+
+func newWalletJobs() *walletJobs {
+	return &walletJobs{jobs: make(map[string]*WalletJob)}
+}
+
+// start registers a running job and runs work in the background; work
+// returns the range it covered. It fails if another job is running.
+func (j *walletJobs) start(job *WalletJob, work func() (int64, int64, error)) error {
+	id, err := newRecordID()
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	if j.active != "" {
+		j.mu.Unlock()
+		return fmt.Errorf("Job %s is still running", j.active)
+	}
+	job.ID = id
+	job.Status = JobRunning
+	job.StartedAt = time.Now().Unix()
+	j.jobs[id] = job
+	j.order = append(j.order, id)
+	j.active = id
+	for len(j.order) > maxWalletJobs {
+		delete(j.jobs, j.order[0])
+		j.order = j.order[1:]
+	}
+	j.mu.Unlock()
+
+	go func() {
+		var start, stop int64
+		var err error
+		func() {
+			// A panic fails the job rather than taking the server down
+			defer func() {
+				if value := recover(); value != nil {
+					err = fmt.Errorf("panic: %v", value)
+				}
+			}()
+			start, stop, err = work()
+		}()
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job.FinishedAt = time.Now().Unix()
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			log.Printf("[RESCAN] Job %s (%s) failed: %v", job.ID, job.Kind, err)
+		} else {
+			job.Status = JobDone
+			job.Progress = 1
+			job.StartHeight, job.StopHeight = start, stop
+			log.Printf("[RESCAN] Job %s (%s) done: blocks %d to %d", job.ID, job.Kind, start, stop)
+		}
+		j.active = ""
+	}()
+	return nil
+}
+
+// get returns a copy of job id, with the node's scan progress when it is
+// running
+func (j *walletJobs) get(rpc rpc.WalletBackend, id string) (WalletJob, bool) {
+	j.mu.Lock()
+	job, ok := j.jobs[id]
+	running := ok && job.Status == JobRunning
+	j.mu.Unlock()
+	if !ok {
+		return WalletJob{}, false
+	}
+
+	if running {
+		if scanning, progress, err := rpc.ScanProgress(); err == nil && scanning {
+			j.mu.Lock()
+			if job.Status == JobRunning {
+				job.Progress = progress
+			}
+			j.mu.Unlock()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return *job, true
+}
+
+// list returns copies of the remembered jobs, newest first
+func (j *walletJobs) list() []WalletJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]WalletJob, 0, len(j.order))
+	for i := len(j.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, *j.jobs[j.order[i]])
+	}
+	return jobs
+}
+
+type RescanRequest struct {
+	StartHeight int64 `json:"start_height"` // 0 rescans the whole chain
+	StopHeight  int64 `json:"stop_height"`  // 0 rescans to the tip
+}
+
+type WalletJobResponse struct {
+	Success bool       `json:"success"`
+	Job     *WalletJob `json:"job,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+type WalletJobListResponse struct {
+	Success bool        `json:"success"`
+	Jobs    []WalletJob `json:"jobs"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// canStartJob returns why a wallet job can't start now, or nil
+func (ws *WalletServer) canStartJob(r *http.Request) error {
+	if scanning, _, err := ws.rpc(r).ScanProgress(); err == nil && scanning {
+		return fmt.Errorf("The node wallet is already rescanning")
+	}
+	ws.jobs.mu.Lock()
+	defer ws.jobs.mu.Unlock()
+	if ws.jobs.active != "" {
+		return fmt.Errorf("Job %s is still running", ws.jobs.active)
+	}
+	return nil
+}
+
+// startWalletJob starts job and writes the 202 response, or the reason it
+// couldn't start
+func (ws *WalletServer) startWalletJob(w http.ResponseWriter, r *http.Request, job *WalletJob, work func() (int64, int64, error)) {
+	err := ws.canStartJob(r)
+	if err == nil {
+		err = ws.jobs.start(job, work)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(WalletJobResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Cannot start: %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[RESCAN] Started job %s (%s) from block %d", job.ID, job.Kind, job.StartHeight)
+	started, _ := ws.jobs.get(ws.rpc(r), job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(WalletJobResponse{
+		Success: true,
+		Job:     &started,
+	})
+}
+
+// HandleRescan starts a rescan of the chain for wallet transactions, from
+// start_height (to stop_height), as a background job
+func (ws *WalletServer) HandleRescan(w http.ResponseWriter, r *http.Request) {
+	var req RescanRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		err = fmt.Errorf("Invalid request format")
+	} else if req.StartHeight < 0 || req.StopHeight < 0 || (req.StopHeight > 0 && req.StopHeight < req.StartHeight) {
+		err = fmt.Errorf("start_height and stop_height must not be negative, and stop_height not below start_height")
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(WalletJobResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	job := &WalletJob{Kind: "rescan", StartHeight: req.StartHeight, StopHeight: req.StopHeight}
+	ws.startWalletJob(w, r, job, func() (int64, int64, error) {
+		return ws.rpcClient.RescanBlockchain(req.StartHeight, req.StopHeight)
+	})
+}
+
+// HandleWalletJobs lists recent background wallet jobs
+func (ws *WalletServer) HandleWalletJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WalletJobListResponse{
+		Success: true,
+		Jobs:    ws.jobs.list(),
+	})
+}
+
+// HandleWalletJob serves /api/wallet/jobs/{id} (GET, with live progress)
+// and /api/wallet/jobs/{id}/abort (POST)
+func (ws *WalletServer) HandleWalletJob(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	// The router takes POST only on the abort route
+	abort := r.Method == http.MethodPost
+
+	rpc := ws.rpc(r)
+	job, ok := ws.jobs.get(rpc, id)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(WalletJobResponse{
+			Success: false,
+			Error:   "Job not found",
+		})
+		return
+	}
+
+	if abort {
+		if job.Status != JobRunning {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(WalletJobResponse{
+				Success: false,
+				Job:     &job,
+				Error:   fmt.Sprintf("Job is %s", job.Status),
+			})
+			return
+		}
+		// The job's call then returns with an error and the job fails
+		if _, err := rpc.AbortRescan(); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(WalletJobResponse{
+				Success: false,
+				Job:     &job,
+				Error:   fmt.Sprintf("Failed to abort: %v", err),
+			})
+			return
+		}
+		logRequest(r, "[RESCAN] Aborting job %s", id)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WalletJobResponse{
+		Success: true,
+		Job:     &job,
+	})
+}
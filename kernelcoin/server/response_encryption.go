@@ -0,0 +1,138 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ResponseKeyHeader carries the client's ephemeral P-256 public key (base64,
+// uncompressed point) for endpoints that return secrets
+const ResponseKeyHeader = "X-Response-Public-Key"
+
+// Response encryption modes (SENSITIVE_RESPONSE_ENCRYPTION)
+const (
+	EncryptionOff      = "off"
+	EncryptionOptional = "optional"
+	EncryptionRequired = "required"
+)
+
+// responseEncryptionInfo is the HKDF info string shared with the browser
+const responseEncryptionInfo = "kernelcoin-webwallet response v1"
+
+// EncryptedResponse wraps a JSON payload encrypted to the client's key
+type EncryptedResponse struct {
+	Encrypted          bool   `json:"encrypted"`
+	Algorithm          string `json:"alg"`
+	EphemeralPublicKey string `json:"ephemeral_public_key"`
+	Nonce              string `json:"nonce"`
+	Ciphertext         string `json:"ciphertext"`
+}
+
+// encryptResponse encrypts payload with ECIES: ECDH(P-256) between a fresh
+// server key and the client key, HKDF-SHA256 and AES-256-GCM
+func encryptResponse(clientKeyB64 string, payload []byte) (*EncryptedResponse, error) {
+	clientKeyBytes, err := base64.StdEncoding.DecodeString(clientKeyB64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+
+	curve := ecdh.P256()
+	clientKey, err := curve.NewPublicKey(clientKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	ephemeral, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	shared, err := ephemeral.ECDH(clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("ECDH failed: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, []byte(responseEncryptionInfo)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &EncryptedResponse{
+		Encrypted:          true,
+		Algorithm:          "ECDH-P256+HKDF-SHA256+A256GCM",
+		EphemeralPublicKey: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:              base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:         base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, payload, nil)),
+	}, nil
+}
+
+// requireResponseKey rejects requests without a client key when encryption is
+// mandatory. Returns false if a response has already been written.
+func (ws *WalletServer) requireResponseKey(w http.ResponseWriter, r *http.Request) bool {
+	if ws.responseEncryption != EncryptionRequired || r.Header.Get(ResponseKeyHeader) != "" {
+		return true
+	}
+
+	logRequest(r, "[API] %s rejected: missing %s header", r.URL.Path, ResponseKeyHeader)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": fmt.Sprintf("Encrypted response required: send an ephemeral P-256 public key in %s", ResponseKeyHeader),
+	})
+	return false
+}
+
+// writeSensitiveJSON writes a successful response containing secrets,
+// encrypting it when the client supplied a public key
+func (ws *WalletServer) writeSensitiveJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	clientKey := r.Header.Get(ResponseKeyHeader)
+	if clientKey == "" || ws.responseEncryption == EncryptionOff {
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		logRequest(r, "[API] %s ERROR: failed to marshal response: %v", r.URL.Path, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to encode response"})
+		return
+	}
+
+	encrypted, err := encryptResponse(clientKey, payload)
+	if err != nil {
+		logRequest(r, "[API] %s ERROR: response encryption failed: %v", r.URL.Path, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Failed to encrypt response: %v", err)})
+		return
+	}
+
+	logRequest(r, "[API] %s: response encrypted to client key", r.URL.Path)
+	json.NewEncoder(w).Encode(encrypted)
+}
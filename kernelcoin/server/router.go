@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// router dispatches requests by method and path. A route's path is made of
+// literal segments and {name} segments, which match any one segment and
+// are read back with pathParam; a path ending in "/" matches everything
+// under it. The route with the most literal segments wins. A path whose
+// routes don't take the request's method is answered 405 with an Allow
+// header, so handlers never check the method themselves; GET routes take
+// HEAD too.
+type router struct {
+	routes []*route
+	// notFound answers API paths no route matches; the rest go to the
+	// "/" route, the web UI
+	notFound http.HandlerFunc
+}
+
+type route struct {
+	segments []string
+	subtree  bool
+	handlers map[string]http.HandlerFunc // by method
+}
+
+// pathParamsKey is the context key of a request's {name} segments
+type pathParamsKey struct{}
+
+// pathParam returns the {name} segment of the request's route
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+func newRouter() *router {
+	return &router{notFound: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Not found"})
+	}}
+}
+
+// handle routes the methods (space separated, e.g. "GET POST") of path to
+// h. A path registered twice adds methods to the same route.
+func (rt *router) handle(methods, path string, h http.HandlerFunc) {
+	subtree := strings.HasSuffix(path, "/")
+	segments := splitPath(path)
+	var rte *route
+	for _, existing := range rt.routes {
+		if existing.subtree == subtree && strings.Join(existing.segments, "/") == strings.Join(segments, "/") {
+			rte = existing
+		}
+	}
+	if rte == nil {
+		rte = &route{segments: segments, subtree: subtree, handlers: map[string]http.HandlerFunc{}}
+		rt.routes = append(rt.routes, rte)
+	}
+	for _, method := range strings.Fields(methods) {
+		if _, ok := rte.handlers[method]; ok {
+			panic("router: " + method + " " + path + " registered twice")
+		}
+		rte.handlers[method] = h
+	}
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// match reports whether rte matches segments, with its {name} values and
+// how many of its segments are literal
+func (rte *route) match(segments []string) (map[string]string, int, bool) {
+	if len(segments) < len(rte.segments) || (!rte.subtree && len(segments) != len(rte.segments)) {
+		return nil, 0, false
+	}
+	var params map[string]string
+	literal := 0
+	for i, seg := range rte.segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			if params == nil {
+				params = map[string]string{}
+			}
+			params[seg[1:len(seg)-1]] = segments[i]
+			continue
+		}
+		if seg != segments[i] {
+			return nil, 0, false
+		}
+		literal++
+	}
+	return params, literal, true
+}
+
+// lookup finds the route for path: an exact one before a subtree, the
+// longest subtree, and the most literal of equals
+func (rt *router) lookup(path string) (*route, map[string]string) {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if path == "/" {
+		segments = nil
+	}
+	var best *route
+	var bestParams map[string]string
+	bestScore := -1
+	for _, rte := range rt.routes {
+		params, literal, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+		score := literal
+		if rte.subtree {
+			score += len(rte.segments) * 1000
+		} else {
+			score += 1 << 20
+		}
+		if score > bestScore {
+			best, bestParams, bestScore = rte, params, score
+		}
+	}
+	return best, bestParams
+}
+
+// allow lists the methods a route takes, for the Allow header
+func (rte *route) allow() string {
+	methods := []string{http.MethodOptions}
+	for method := range rte.handlers {
+		methods = append(methods, method)
+	}
+	if _, ok := rte.handlers[http.MethodGet]; ok {
+		if _, ok := rte.handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rte, params := rt.lookup(r.URL.Path)
+	if rte == nil || (rte.subtree && len(rte.segments) == 0 && strings.HasPrefix(r.URL.Path, "/api/")) {
+		rt.notFound(w, r)
+		return
+	}
+
+	h, ok := rte.handlers[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		h, ok = rte.handlers[http.MethodGet]
+	}
+	if !ok {
+		w.Header().Set("Allow", rte.allow())
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Method not allowed",
+			"code":    ErrMethodNotAllowed,
+		})
+		return
+	}
+
+	if params != nil {
+		r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, params))
+	}
+	h.ServeHTTP(w, r)
+}
+
+// withPathParam hands serve the {name} segment of the route
+func withPathParam(name string, serve func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, pathParam(r, name))
+	}
+}
@@ -0,0 +1,448 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// Conditional send rule conditions
+const (
+	// ConditionFeeBelow triggers when estimatesmartfee(6) drops below the
+	// threshold (KCN/kvB)
+	ConditionFeeBelow = "fee_below"
+	// ConditionBalanceAbove triggers when the confirmed balance exceeds the
+	// threshold (KCN)
+	ConditionBalanceAbove = "balance_above"
+)
+
+// Conditional send rule states
+const (
+	RuleStatusPending   = "pending"
+	RuleStatusSending   = "sending"
+	RuleStatusSent      = "sent"
+	RuleStatusFailed    = "failed"
+	RuleStatusExpired   = "expired"
+	RuleStatusCancelled = "cancelled"
+)
+
+// SendRule is a prepared send that the scheduler broadcasts once its
+// condition is met
+type SendRule struct {
+	Owner     string                 `json:"-"` // whose wallet sends it
+	ID        string                 `json:"id"`
+	Request   SendTransactionRequest `json:"request"`
+	Condition string                 `json:"condition"`
+	Threshold float64                `json:"threshold"`
+	ExpiresAt int64                  `json:"expires_at,omitempty"`
+	Status    string                 `json:"status"`
+	Txid      string                 `json:"txid,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	CreatedAt int64                  `json:"created_at"`
+	UpdatedAt int64                  `json:"updated_at"`
+}
+
+type CreateSendRuleRequest struct {
+	SendTransactionRequest
+	Condition string  `json:"condition"`
+	Threshold float64 `json:"threshold"`
+	ExpiresAt int64   `json:"expires_at,omitempty"`
+}
+
+type SendRuleResponse struct {
+	Success bool      `json:"success"`
+	Rule    *SendRule `json:"rule,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type SendRulesListResponse struct {
+	Success bool       `json:"success"`
+	Rules   []SendRule `json:"rules,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// InsertSendRule stores a new rule
+func (s *Store) InsertSendRule(rule SendRule) error {
+	request, err := json.Marshal(rule.Request)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO send_rules
+		(id, owner, request, condition, threshold, expires_at, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ID, rule.Owner, string(request), rule.Condition, rule.Threshold, rule.ExpiresAt,
+		rule.Status, rule.CreatedAt, rule.UpdatedAt)
+	return err
+}
+
+// SendRules returns owner's rules, or with allOwners everyone's, newest
+// first. An empty status returns all rules.
+func (s *Store) SendRules(owner, status string) ([]SendRule, error) {
+	query := `SELECT ` + sendRuleColumns + ` FROM send_rules`
+	where := []string{}
+	args := []interface{}{}
+	if owner != allOwners {
+		where = append(where, `owner = ?`)
+		args = append(args, owner)
+	}
+	if status != "" {
+		where = append(where, `status = ?`)
+		args = append(args, status)
+	}
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []SendRule{}
+	for rows.Next() {
+		rule, err := scanSendRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// SendRule returns a single rule of owner's, or nil if it does not exist
+func (s *Store) SendRule(owner, id string) (*SendRule, error) {
+	row := s.db.QueryRow(`SELECT `+sendRuleColumns+` FROM send_rules WHERE id = ? AND owner = ?`, id, owner)
+	rule, err := scanSendRule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rule, err
+}
+
+// TransitionSendRule moves a rule from one status to another, recording the
+// txid or error. It returns false if the rule was not in the from status,
+// which makes it safe against concurrent cancellation.
+func (s *Store) TransitionSendRule(id, from, to, txid, errMsg string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE send_rules SET status = ?, txid = ?, error = ?, updated_at = ?
+		WHERE id = ? AND status = ?`,
+		to, txid, errMsg, time.Now().Unix(), id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+const sendRuleColumns = `owner, id, request, condition, threshold, expires_at, status, txid, error, created_at, updated_at`
+
+func scanSendRule(row interface{ Scan(...interface{}) error }) (*SendRule, error) {
+	var rule SendRule
+	var request string
+	if err := row.Scan(&rule.Owner, &rule.ID, &request, &rule.Condition, &rule.Threshold, &rule.ExpiresAt,
+		&rule.Status, &rule.Txid, &rule.Error, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(request), &rule.Request); err != nil {
+		return nil, fmt.Errorf("corrupt request for rule %s: %w", rule.ID, err)
+	}
+	return &rule, nil
+}
+
+// currentFeeRate returns the 6-block fee estimate, preferring the sampled fee
+// history and falling back to a live estimate when the latest sample is stale
+func (ws *WalletServer) currentFeeRate(maxAge time.Duration) (float64, error) {
+	sample, err := ws.store.LatestFeeSample()
+	if err != nil {
+		return 0, err
+	}
+	if sample != nil && sample.FeeRate6 != nil && time.Since(time.Unix(sample.SampledAt, 0)) <= maxAge {
+		return *sample.FeeRate6, nil
+	}
+	return ws.rpcClient.EstimateSmartFee(6)
+}
+
+// ruleConditionMet evaluates a rule's condition against the node and the
+// wallet of client
+func (ws *WalletServer) ruleConditionMet(client rpc.WalletBackend, rule SendRule, maxFeeAge time.Duration) (bool, error) {
+	switch rule.Condition {
+	case ConditionFeeBelow:
+		rate, err := ws.currentFeeRate(maxFeeAge)
+		if err != nil {
+			return false, err
+		}
+		// A zero rate means the node has no estimate yet
+		return rate > 0 && rate < rule.Threshold, nil
+	case ConditionBalanceAbove:
+		balance, err := client.GetBalanceInfo("")
+		if err != nil {
+			return false, err
+		}
+		return balance.Confirmed > rpc.AmountFromKCN(rule.Threshold), nil
+	default:
+		return false, fmt.Errorf("unknown condition %q", rule.Condition)
+	}
+}
+
+// runScheduledSends evaluates all pending rules once, each on its owner's
+// wallet. A disabled user's rules wait, though they still expire.
+func (ws *WalletServer) runScheduledSends(maxFeeAge time.Duration) {
+	rules, err := ws.store.SendRules(allOwners, RuleStatusPending)
+	if err != nil {
+		log.Printf("[SCHEDULER] WARNING: Failed to load rules: %v", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, rule := range rules {
+		if rule.ExpiresAt > 0 && now >= rule.ExpiresAt {
+			if _, err := ws.store.TransitionSendRule(rule.ID, RuleStatusPending, RuleStatusExpired, "", ""); err != nil {
+				log.Printf("[SCHEDULER] WARNING: Failed to expire rule %s: %v", rule.ID, err)
+			} else {
+				log.Printf("[SCHEDULER] Rule %s expired", rule.ID)
+			}
+			continue
+		}
+
+		client, user, err := ws.ownerWallet(rule.Owner)
+		if err != nil {
+			log.Printf("[SCHEDULER] WARNING: Rule %s waits: %v", rule.ID, err)
+			continue
+		}
+		met, err := ws.ruleConditionMet(client, rule, maxFeeAge)
+		if err != nil {
+			log.Printf("[SCHEDULER] WARNING: Could not evaluate rule %s: %v", rule.ID, err)
+			continue
+		}
+		if !met {
+			continue
+		}
+
+		// Claim the rule before broadcasting so a concurrent cancel cannot race us
+		claimed, err := ws.store.TransitionSendRule(rule.ID, RuleStatusPending, RuleStatusSending, "", "")
+		if err != nil || !claimed {
+			continue
+		}
+
+		log.Printf("[SCHEDULER] Rule %s condition met (%s %.8f), sending %s KCN to %s",
+			rule.ID, rule.Condition, rule.Threshold, rule.Request.Amount, rule.Request.ToAddress)
+
+		txid, err := ws.sendWithinUserLimit(user, rule.Request.Amount, func() (string, error) {
+			return ws.submitSend(client, rule.Request)
+		})
+		if err != nil {
+			log.Printf("[SCHEDULER] Rule %s send FAILED: %v", rule.ID, err)
+			ws.store.TransitionSendRule(rule.ID, RuleStatusSending, RuleStatusFailed, "", err.Error())
+			continue
+		}
+
+		log.Printf("[SCHEDULER] Rule %s SENT: txid=%s", rule.ID, txid)
+		ws.store.TransitionSendRule(rule.ID, RuleStatusSending, RuleStatusSent, txid, "")
+	}
+}
+
+// recoverSendingRules settles rules left in sending by a server that stopped
+// mid-send. One with a txid went out; for the others the send may or may
+// not have reached the node, so they fail rather than go out twice.
+func (ws *WalletServer) recoverSendingRules() {
+	rules, err := ws.store.SendRules(allOwners, RuleStatusSending)
+	if err != nil {
+		log.Printf("[SCHEDULER] WARNING: Failed to load interrupted rules: %v", err)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Txid != "" {
+			log.Printf("[SCHEDULER] Rule %s was interrupted after sending txid=%s", rule.ID, rule.Txid)
+			ws.store.TransitionSendRule(rule.ID, RuleStatusSending, RuleStatusSent, rule.Txid, "")
+			continue
+		}
+		log.Printf("[SCHEDULER] WARNING: Rule %s was interrupted while sending; marking it failed", rule.ID)
+		ws.store.TransitionSendRule(rule.ID, RuleStatusSending, RuleStatusFailed, "",
+			"interrupted before the result was recorded; check the wallet before retrying")
+	}
+}
+
+// RunScheduler settles rules interrupted by a restart, then evaluates
+// conditional send rules every interval. It never returns.
+func (ws *WalletServer) RunScheduler(interval, maxFeeAge time.Duration) {
+	ws.recoverSendingRules()
+	log.Printf("[SCHEDULER] Evaluating conditional sends every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ws.runScheduledSends(maxFeeAge)
+	}
+}
+
+// HandleSendRules lists (GET) or creates (POST) the requester's
+// conditional send rules
+func (ws *WalletServer) HandleSendRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := ws.store.SendRules(walletOwner(r), r.URL.Query().Get("status"))
+		if err != nil {
+			logRequest(r, "[API] SendRules ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(SendRulesListResponse{
+				Success: false,
+				Error:   "Failed to load rules",
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendRulesListResponse{
+			Success: true,
+			Rules:   rules,
+		})
+
+	case http.MethodPost:
+		ws.createSendRule(w, r)
+	}
+}
+
+func (ws *WalletServer) createSendRule(w http.ResponseWriter, r *http.Request) {
+	var req CreateSendRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] CreateSendRule ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendRuleResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	var validationErr string
+	amountErr := checkSendAmount(req.Amount)
+	switch {
+	case req.Condition != ConditionFeeBelow && req.Condition != ConditionBalanceAbove:
+		validationErr = fmt.Sprintf("Condition must be %s or %s", ConditionFeeBelow, ConditionBalanceAbove)
+	case req.Threshold <= 0:
+		validationErr = "Threshold must be positive"
+	case amountErr != nil:
+		validationErr = amountErr.Message
+	case req.ExpiresAt != 0 && req.ExpiresAt <= time.Now().Unix():
+		validationErr = "Expiry must be in the future"
+	}
+	if validationErr == "" {
+		if valid, err := ws.rpc(r).ValidateAddress(req.ToAddress); err != nil || !valid {
+			validationErr = "Invalid recipient address"
+		}
+	}
+	if validationErr != "" {
+		logRequest(r, "[API] CreateSendRule ERROR: %s", validationErr)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendRuleResponse{
+			Success: false,
+			Error:   validationErr,
+		})
+		return
+	}
+
+	id, err := newRecordID()
+	if err != nil {
+		logRequest(r, "[API] CreateSendRule ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SendRuleResponse{
+			Success: false,
+			Error:   "Failed to save rule",
+		})
+		return
+	}
+
+	now := time.Now().Unix()
+	rule := SendRule{
+		Owner:     walletOwner(r),
+		ID:        id,
+		Request:   req.SendTransactionRequest,
+		Condition: req.Condition,
+		Threshold: req.Threshold,
+		ExpiresAt: req.ExpiresAt,
+		Status:    RuleStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := ws.store.InsertSendRule(rule); err != nil {
+		logRequest(r, "[API] CreateSendRule ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SendRuleResponse{
+			Success: false,
+			Error:   "Failed to save rule",
+		})
+		return
+	}
+
+	logRequest(r, "[API] CreateSendRule SUCCESS: %s (%s %.8f)", rule.ID, rule.Condition, rule.Threshold)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SendRuleResponse{
+		Success: true,
+		Rule:    &rule,
+	})
+}
+
+// HandleSendRuleAction handles /api/scheduler/rules/{id} (GET) and
+// /api/scheduler/rules/{id}/cancel (POST)
+func (ws *WalletServer) HandleSendRuleAction(w http.ResponseWriter, r *http.Request) {
+	id := pathParam(r, "id")
+	// The router takes POST only on the cancel route
+	cancel := r.Method == http.MethodPost
+
+	rule, err := ws.store.SendRule(walletOwner(r), id)
+	if err != nil || rule == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(SendRuleResponse{
+			Success: false,
+			Error:   "Rule not found",
+		})
+		return
+	}
+
+	if cancel {
+		cancelled, err := ws.store.TransitionSendRule(id, RuleStatusPending, RuleStatusCancelled, "", "")
+		if err != nil {
+			logRequest(r, "[API] CancelSendRule ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(SendRuleResponse{
+				Success: false,
+				Error:   "Failed to cancel rule",
+			})
+			return
+		}
+		if !cancelled {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(SendRuleResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Rule is %s, only pending rules can be cancelled", rule.Status),
+			})
+			return
+		}
+
+		logRequest(r, "[API] CancelSendRule SUCCESS: %s", id)
+		rule.Status = RuleStatusCancelled
+		rule.UpdatedAt = time.Now().Unix()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SendRuleResponse{
+		Success: true,
+		Rule:    rule,
+	})
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// minSearchQuery is the shortest query searched, so one letter doesn't
+// match the whole wallet
+const minSearchQuery = 2
+
+// SearchHit is one thing a search found: a wallet transaction, one of the
+// wallet's addresses or an address book contact
+type SearchHit struct {
+	Type  string `json:"type"`  // transaction, address or contact
+	ID    string `json:"id"`    // the txid, address or contact ID
+	Field string `json:"field"` // what matched, e.g. txid, label, notes, tag or name
+	Text  string `json:"text"`  // the matching value
+
+	// Transactions only
+	Time     int64       `json:"time,omitempty"`
+	TimeISO  string      `json:"time_iso,omitempty"`
+	Amount   rpc.Amount  `json:"amount,omitempty"` // what it did to the balance, fees included
+	Address  string      `json:"address,omitempty"`
+	Contact  string      `json:"contact,omitempty"`
+	Metadata *TxMetadata `json:"metadata,omitempty"`
+}
+
+type SearchResponse struct {
+	Success    bool        `json:"success"`
+	Query      string      `json:"query,omitempty"`
+	Hits       []SearchHit `json:"hits"` // contacts, then addresses, then transactions newest first
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// searchField is a named value a search can match
+type searchField struct{ name, value string }
+
+// matchSearch reports whether every term appears in one of fields, case
+// insensitively, and which field matched the first term
+func matchSearch(terms []string, fields []searchField) (searchField, bool) {
+	var first searchField
+	for i, term := range terms {
+		found := false
+		for _, f := range fields {
+			if f.value != "" && strings.Contains(strings.ToLower(f.value), term) {
+				if i == 0 {
+					first = f
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return searchField{}, false
+		}
+	}
+	return first, true
+}
+
+// HandleSearch finds ?q= in txids, addresses, comments, contact names and
+// the user's transaction labels, categories, notes and tags. Every word of
+// the query must match, though not all in the same field, so "bob rent"
+// finds rent paid to the contact Bob. Paged with count and skip.
+func (ws *WalletServer) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	terms := strings.Fields(strings.ToLower(query))
+	if len(query) < minSearchQuery {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SearchResponse{
+			Success: false,
+			Error:   fmt.Sprintf("q must be at least %d characters", minSearchQuery),
+		})
+		return
+	}
+	page := parsePageParams(r)
+
+	fail := func(message string, err error) {
+		logRequest(r, "[API] Search ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SearchResponse{
+			Success: false,
+			Error:   message,
+		})
+	}
+
+	contacts, err := ws.store.Contacts(walletOwner(r))
+	if err != nil {
+		fail("Failed to load contacts", err)
+		return
+	}
+	metadata, err := ws.store.AllTransactionMetadata(walletOwner(r))
+	if err != nil {
+		fail("Failed to load transaction metadata", err)
+		return
+	}
+	addresses, err := ws.rpc(r).GetAddressesByLabel("")
+	if err != nil {
+		fail("Failed to get addresses", err)
+		return
+	}
+
+	hits := []SearchHit{}
+	names := map[string]string{}
+	for _, c := range contacts {
+		fields := []searchField{{"name", c.Name}, {"notes", c.Notes}}
+		for _, address := range c.Addresses {
+			names[address] = c.Name
+			fields = append(fields, searchField{"address", address})
+		}
+		if f, ok := matchSearch(terms, fields); ok {
+			hits = append(hits, SearchHit{Type: "contact", ID: c.ID, Field: f.name, Text: f.value})
+		}
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		if f, ok := matchSearch(terms, []searchField{{"address", address}}); ok {
+			hits = append(hits, SearchHit{Type: "address", ID: address, Field: f.name, Text: f.value})
+		}
+	}
+
+	// A transaction is matched as a whole, over all of its entries
+	type candidate struct {
+		hit    SearchHit
+		fields []searchField
+	}
+	var order []string
+	candidates := map[string]*candidate{}
+	feeCounted := map[string]bool{}
+	err = ws.streamTransactions(ws.rpc(r), TransactionFilter{}, func(batch []TransactionResponse) error {
+		for _, tx := range batch {
+			c := candidates[tx.Txid]
+			if c == nil {
+				c = &candidate{hit: SearchHit{Type: "transaction", ID: tx.Txid, Time: tx.Time, TimeISO: tx.TimeISO, Address: tx.Address, Contact: names[tx.Address]}}
+				candidates[tx.Txid] = c
+				order = append(order, tx.Txid)
+			}
+			c.hit.Amount += balanceDelta(tx, feeCounted)
+			c.fields = append(c.fields,
+				searchField{"contact", names[tx.Address]},
+				searchField{"comment", tx.Comment},
+				searchField{"comment_to", tx.CommentTo},
+				searchField{"address", tx.Address},
+			)
+		}
+		return nil
+	})
+	if err != nil {
+		fail("Failed to list transactions", err)
+		return
+	}
+
+	// Newest first. What the user wrote is named as the match before
+	// what the node recorded.
+	for i := len(order) - 1; i >= 0; i-- {
+		c := candidates[order[i]]
+		fields := []searchField{{"txid", c.hit.ID}}
+		if m := metadata[c.hit.ID]; m != nil {
+			c.hit.Metadata = m
+			fields = append(fields, searchField{"label", m.Label}, searchField{"category", m.Category}, searchField{"notes", m.Notes})
+			for _, tag := range m.Tags {
+				fields = append(fields, searchField{"tag", tag})
+			}
+		}
+		fields = append(fields, c.fields...)
+		if f, ok := matchSearch(terms, fields); ok {
+			c.hit.Field, c.hit.Text = f.name, f.value
+			hits = append(hits, c.hit)
+		}
+	}
+
+	total := len(hits)
+	start := min(page.Skip, total)
+	end := min(start+page.Count, total)
+	logRequest(r, "[API] Search SUCCESS: %d hits over %d transactions", total, len(order))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{
+		Success: true,
+		Query:   query,
+		Hits:    hits[start:end],
+		Pagination: &Pagination{
+			Count:   page.Count,
+			Skip:    page.Skip,
+			Page:    page.Page,
+			Total:   total,
+			HasMore: end < total,
+		},
+	})
+}
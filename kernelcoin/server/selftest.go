@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+)
+
+type SelfTestResponse struct {
+	Success  bool              `json:"success"`
+	Network  string            `json:"network"`
+	Vectors  int               `json:"vectors"`
+	Failures []SelfTestFailure `json:"failures,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// SelfTestFailure is a test vector this build derives differently
+type SelfTestFailure struct {
+	Network string `json:"network"`
+	Path    string `json:"path"`
+	Error   string `json:"error"`
+}
+
+// HandleSelfTest derives hdwallet's test vectors, for operators to check
+// that a build (its network parameters and key libraries) makes the keys
+// and addresses it should. It needs no node. The UI doesn't link it.
+func (ws *WalletServer) HandleSelfTest(w http.ResponseWriter, r *http.Request) {
+	response := SelfTestResponse{Success: true, Network: ws.network, Vectors: len(hdwallet.TestVectors)}
+	for _, v := range hdwallet.TestVectors {
+		if err := v.Check(); err != nil {
+			response.Failures = append(response.Failures, SelfTestFailure{Network: v.Network, Path: v.Path, Error: err.Error()})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(response.Failures) > 0 {
+		logRequest(r, "[SELFTEST] ERROR: %d of %d test vectors failed: %+v", len(response.Failures), response.Vectors, response.Failures)
+		response.Success = false
+		response.Error = fmt.Sprintf("%d of %d test vectors derived wrong keys", len(response.Failures), response.Vectors)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// sendError is a send refused by the server's own checks, with its
+// error code
+type sendError struct {
+	Code    string
+	Message string
+}
+
+func (e *sendError) Error() string {
+	return e.Message
+}
+
+// amountError turns a JSON decoding error caused by an unreadable amount
+// into a sendError; other errors give nil
+func amountError(err error) *sendError {
+	var parseErr *rpc.AmountError
+	if !errors.As(err, &parseErr) {
+		return nil
+	}
+	if parseErr.Precision {
+		return &sendError{ErrAmountPrecision, "Amount has more than 8 decimal places"}
+	}
+	return &sendError{ErrInvalidAmount, "Amount must be a number of KCN"}
+}
+
+// checkSendAmount refuses amounts the node would, with a clearer reason
+func checkSendAmount(amount rpc.Amount) *sendError {
+	if amount <= 0 {
+		return &sendError{ErrInvalidAmount, "Amount must be positive"}
+	}
+	if amount < hdwallet.DustThreshold {
+		return &sendError{ErrDustAmount, fmt.Sprintf("Amount is below the dust threshold of %s KCN", rpc.Amount(hdwallet.DustThreshold))}
+	}
+	return nil
+}
+
+// checkSendBalance refuses a send the wallet's spendable balance, or the
+// selected inputs, can't cover. The fee is not known yet, so a send that
+// passes can still fail for want of it.
+func checkSendBalance(client rpc.WalletBackend, req SendTransactionRequest) (*sendError, error) {
+	var available rpc.Amount
+	if len(req.Inputs) > 0 {
+		utxos, err := client.ListUnspent(0)
+		if err != nil {
+			return nil, err
+		}
+		selected := map[rpc.Outpoint]bool{}
+		for _, in := range req.Inputs {
+			selected[in] = true
+		}
+		for _, u := range utxos {
+			if selected[rpc.Outpoint{Txid: u.Txid, Vout: u.Vout}] {
+				available += u.Amount
+			}
+		}
+	} else {
+		balance, err := client.GetBalanceInfo("")
+		if err != nil {
+			return nil, err
+		}
+		available = balance.Confirmed
+	}
+
+	if req.Amount > available {
+		message := "Amount exceeds the spendable balance of %s KCN"
+		if len(req.Inputs) > 0 {
+			message = "Amount exceeds the selected inputs of %s KCN"
+		}
+		return &sendError{ErrInsufficientFunds, fmt.Sprintf(message, available)}, nil
+	}
+	return nil, nil
+}
+
+// checkFeePreset refuses a fee preset name that isn't one
+func checkFeePreset(name string) *sendError {
+	if _, ok := (FeeConfig{}).preset(name); name != "" && !ok {
+		return &sendError{ErrInvalidRequest, fmt.Sprintf("Unknown fee preset %q: use economy, normal or priority", name)}
+	}
+	return nil
+}
+
+// ChangeNewSegWit as a send's change address asks for a new bech32 change
+// address of the wallet
+const ChangeNewSegWit = "new-segwit"
+
+// checkChangeAddress refuses a change address that isn't one, is the
+// recipient's or isn't the wallet's. Change sent elsewhere would be a
+// payment the send limit doesn't count.
+func checkChangeAddress(client rpc.WalletBackend, req SendTransactionRequest) (*sendError, error) {
+	if req.ChangeAddress == "" || req.ChangeAddress == ChangeNewSegWit {
+		return nil, nil
+	}
+	if req.ChangeAddress == req.ToAddress {
+		return &sendError{ErrInvalidAddress, "Change address is the recipient address"}, nil
+	}
+	valid, err := client.ValidateAddress(req.ChangeAddress)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return &sendError{ErrInvalidAddress, "Invalid change address"}, nil
+	}
+	info, err := client.GetAddressInfo(req.ChangeAddress)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsMine {
+		return &sendError{ErrInvalidAddress, "Change address is not one of the wallet's"}, nil
+	}
+	return nil, nil
+}
+
+// refuseSend runs the amount, fee preset, change address and balance
+// checks on a send, returning the first that fails
+func refuseSend(r *http.Request, client rpc.WalletBackend, req SendTransactionRequest) *sendError {
+	if refused := checkSendAmount(req.Amount); refused != nil {
+		return refused
+	}
+	if refused := checkFeePreset(req.FeePreset); refused != nil {
+		return refused
+	}
+	refused, err := checkChangeAddress(client, req)
+	if err != nil {
+		logRequest(r, "[API] WARNING: change address precheck skipped: %v", err)
+	}
+	if refused != nil {
+		return refused
+	}
+	refused, err = checkSendBalance(client, req)
+	if err != nil {
+		// The node will say what is wrong when the send is tried
+		logRequest(r, "[API] WARNING: balance precheck skipped: %v", err)
+	}
+	return refused
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/btcsuite/btcd/wire"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+type SendPreviewResponse struct {
+	Success     bool       `json:"success"`
+	ToAddress   string     `json:"to_address,omitempty"`
+	Amount      rpc.Amount `json:"amount,omitempty"`
+	Fee         rpc.Amount `json:"fee,omitempty"`
+	Total       rpc.Amount `json:"total,omitempty"`
+	Replaceable bool       `json:"replaceable,omitempty"`
+	Inputs      int        `json:"inputs,omitempty"`
+	Outputs     int        `json:"outputs,omitempty"`
+	// VSize is the estimated size once signed, in vbytes, and FeeRate the
+	// fee over it in kernels per vbyte. Both are absent when an input's
+	// script type can't be sized before signing.
+	VSize       int64   `json:"vsize,omitempty"`
+	FeeRate     float64 `json:"fee_rate,omitempty"`
+	AmountWords string  `json:"amount_words,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	// Code says why the send was refused; see the Err codes
+	Code string `json:"code,omitempty"`
+}
+
+// HandleSendPreview validates a send and reports its fee and total debit
+// without signing or broadcasting anything. The fee comes from funding a
+// draft, so an actual send may differ slightly if the wallet's coins change
+// in between.
+func (ws *WalletServer) HandleSendPreview(w http.ResponseWriter, r *http.Request) {
+	var req SendTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] SendPreview ERROR: Invalid request - %v", err)
+		response := SendPreviewResponse{Success: false, Error: "Invalid request format"}
+		if refused := amountError(err); refused != nil {
+			response.Error, response.Code = refused.Message, refused.Code
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if refused := refuseSend(r, ws.rpc(r), req); refused != nil {
+		logRequest(r, "[API] SendPreview ERROR: %s", refused.Message)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendPreviewResponse{
+			Success: false,
+			Error:   refused.Message,
+			Code:    refused.Code,
+		})
+		return
+	}
+
+	valid, err := ws.rpc(r).ValidateAddress(req.ToAddress)
+	if err != nil || !valid {
+		logRequest(r, "[API] SendPreview ERROR: Invalid address - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendPreviewResponse{
+			Success: false,
+			Error:   "Invalid recipient address",
+		})
+		return
+	}
+
+	draft, err := ws.draftTransaction(ws.rpc(r), req)
+	if err != nil {
+		logRequest(r, "[API] SendPreview ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SendPreviewResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Cannot build transaction: %v", err),
+		})
+		return
+	}
+
+	response := SendPreviewResponse{
+		Success:     true,
+		ToAddress:   req.ToAddress,
+		Amount:      req.Amount,
+		Fee:         draft.Fee,
+		Total:       req.Amount + draft.Fee,
+		Replaceable: req.Replaceable,
+	}
+	if size, err := measureDraft(ws.rpc(r), draft.Hex); err != nil {
+		logRequest(r, "[API] SendPreview WARNING: %v", err)
+	} else {
+		response.Inputs, response.Outputs = size.Inputs, size.Outputs
+		if size.VSize > 0 {
+			response.VSize = size.VSize
+			response.FeeRate = math.Round(float64(draft.Fee)/float64(size.VSize)*1000) / 1000
+		}
+	}
+	if req.AmountWordsLocale != "" {
+		response.AmountWords = AmountInWords(req.Amount, req.AmountWordsLocale)
+	}
+
+	logRequest(r, "[API] SendPreview SUCCESS: %s KCN + %s fee to %s", req.Amount, draft.Fee, req.ToAddress)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// draftSize is the shape of an unsigned draft transaction
+type draftSize struct {
+	Inputs  int
+	Outputs int
+	// VSize estimates the signed size; 0 when an input can't be sized
+	VSize int64
+}
+
+// decodeDraft decodes an unsigned transaction from hex
+func decodeDraft(txHex string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(txHex)
+	if err != nil {
+		return nil, fmt.Errorf("draft is not hex: %w", err)
+	}
+	var tx wire.MsgTx
+	if err := tx.DeserializeNoWitness(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("cannot decode draft: %w", err)
+	}
+	return &tx, nil
+}
+
+// walletCoins indexes the wallet's unspent outputs by outpoint
+func walletCoins(client rpc.WalletBackend) (map[rpc.Outpoint]rpc.UnspentOutput, error) {
+	utxos, err := client.ListUnspent(0)
+	if err != nil {
+		return nil, err
+	}
+	coins := map[rpc.Outpoint]rpc.UnspentOutput{}
+	for _, utxo := range utxos {
+		coins[rpc.Outpoint{Txid: utxo.Txid, Vout: utxo.Vout}] = utxo
+	}
+	return coins, nil
+}
+
+// measureDraft counts the inputs and outputs of an unsigned transaction
+// and estimates its signed vsize from the script types of the coins it
+// spends
+func measureDraft(client rpc.WalletBackend, txHex string) (*draftSize, error) {
+	tx, err := decodeDraft(txHex)
+	if err != nil {
+		return nil, err
+	}
+	coins, err := walletCoins(client)
+	if err != nil {
+		return nil, err
+	}
+	size := sizeDraft(tx, coins)
+	return &size, nil
+}
+
+// sizeDraft measures tx, whose inputs spend coins
+func sizeDraft(tx *wire.MsgTx, coins map[rpc.Outpoint]rpc.UnspentOutput) draftSize {
+	size := draftSize{Inputs: len(tx.TxIn), Outputs: len(tx.TxOut)}
+	vsize := int64(hdwallet.TxOverheadVSize)
+	for _, in := range tx.TxIn {
+		coin := coins[rpc.Outpoint{Txid: in.PreviousOutPoint.Hash.String(), Vout: int(in.PreviousOutPoint.Index)}]
+		script, err := hex.DecodeString(coin.ScriptPubKey)
+		if err != nil || len(script) == 0 {
+			return size
+		}
+		inputSize, err := hdwallet.InputVSize(script)
+		if err != nil {
+			return size
+		}
+		vsize += inputSize
+	}
+	for _, out := range tx.TxOut {
+		vsize += int64(out.SerializeSize())
+	}
+	size.VSize = vsize
+	return size
+}
@@ -0,0 +1,1290 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+	"kernelcoin-wallet/kernelcoin/rpc/rpctest"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := hdwallet.UseNetwork("regtest"); err != nil {
+		panic(err)
+	}
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	log.SetOutput(io.Discard)
+
+	code := m.Run()
+	// Only a full run can tell whether every route was exercised
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		if missing := uncoveredRoutes(); len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "routes no test requested:\n  %s\n", strings.Join(missing, "\n  "))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// testWallet is a wallet server on a fake node, served over HTTP through
+// the same middleware as in production
+type testWallet struct {
+	t    *testing.T
+	node *rpctest.Server
+	ws   *WalletServer
+	url  string
+
+	// user and password, when set, authenticate every request
+	user, password string
+}
+
+// newTestWallet starts a server on a regtest fake node with a fresh
+// in-memory store. configure may change the configuration first.
+func newTestWallet(t *testing.T, configure ...func(*Config)) *testWallet {
+	t.Helper()
+	node := rpctest.NewServer("regtest")
+	t.Cleanup(node.Close)
+
+	cfg := defaultConfig()
+	cfg.Network = "regtest"
+	cfg.Log.Access = false
+	cfg.Prices = PriceConfig{Provider: "static", Static: "USD=0.05,EUR=0.04", Currency: "USD", CacheTTL: Duration(time.Minute)}
+	cfg.KeyExport.TOTPSecret = testTOTPSecret
+	for _, c := range configure {
+		c(&cfg)
+	}
+
+	store, err := OpenStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	prices, err := priceServiceFromConfig(cfg.Prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := loadMessageCatalogs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := NewWalletServerWithBackend(node.Client())
+	ws.store = store
+	ws.network = cfg.Network
+	ws.prices.Store(prices)
+	ws.messages = messages
+	ws.assets = embeddedAssets
+	ws.checkout = cfg.Checkout
+	ws.fees = cfg.Fees
+	ws.backupDir = cfg.BackupDir
+	ws.broadcastOnly = cfg.BroadcastOnly
+	ws.keyExport, err = newKeyExportGuard(cfg.KeyExport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MultiUser.Enabled {
+		ws.tenants = newTenants(cfg.MultiUser)
+	}
+
+	handler, err := ws.handler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	t.Cleanup(ws.events.Close)
+
+	return &testWallet{t: t, node: node, ws: ws, url: srv.URL}
+}
+
+// testTOTPSecret enables /api/export-key; the tests never know its code
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// request sends body (JSON encoded unless it is a string) and returns the
+// response with its body read
+func (tw *testWallet) request(method, path string, body interface{}, header ...string) (*http.Response, []byte) {
+	tw.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			tw.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, tw.url+path, reader)
+	if err != nil {
+		tw.t.Fatal(err)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tw.user != "" {
+		req.SetBasicAuth(tw.user, tw.password)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	noteRoute(tw.ws, method, req.URL.Path)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tw.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tw.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp, data
+}
+
+// call sends a request that must answer status with a JSON object, and
+// returns the object
+func (tw *testWallet) call(method, path string, body interface{}, status int) map[string]interface{} {
+	tw.t.Helper()
+	resp, data := tw.request(method, path, body)
+	if resp.StatusCode != status {
+		tw.t.Fatalf("%s %s: status %d, want %d: %s", method, path, resp.StatusCode, status, data)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		tw.t.Fatalf("%s %s: not a JSON object: %v: %s", method, path, err, data)
+	}
+	if status >= 400 && decoded["code"] == nil {
+		tw.t.Errorf("%s %s: error response without a code: %s", method, path, data)
+	}
+	return decoded
+}
+
+// newAddress returns a new address of the node wallet
+func (tw *testWallet) newAddress() string {
+	tw.t.Helper()
+	resp := tw.call("POST", "/api/generate-address", map[string]string{"type": "bech32"}, http.StatusOK)
+	return resp["address"].(string)
+}
+
+// testMnemonic is the BIP39 test vector mnemonic, a wallet no one funds
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// externalAddress returns an address the node wallet doesn't own
+func externalAddress(t *testing.T) string {
+	t.Helper()
+	w, err := hdwallet.GenerateWalletFromMnemonic(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.SegWitAddress
+}
+
+// covered records which routes and methods the tests have requested
+var covered = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+func routeKey(rte *route, method string) string {
+	path := "/" + strings.Join(rte.segments, "/")
+	if rte.subtree && path != "/" {
+		path += "/"
+	}
+	return method + " " + path
+}
+
+func noteRoute(ws *WalletServer, method, path string) {
+	rte, _ := ws.routes().lookup(path)
+	if rte == nil {
+		return
+	}
+	covered.Lock()
+	defer covered.Unlock()
+	covered.seen[routeKey(rte, method)] = true
+}
+
+// uncoveredRoutes lists the routes and methods of a multi-user server that
+// no test has requested. OIDC needs a provider to talk to and is left out.
+func uncoveredRoutes() []string {
+	ws := NewWalletServerWithBackend(nil)
+	ws.tenants = newTenants(MultiUserConfig{})
+	covered.Lock()
+	defer covered.Unlock()
+	var missing []string
+	for _, rte := range ws.routes().routes {
+		for method := range rte.handlers {
+			if key := routeKey(rte, method); !covered.seen[key] {
+				missing = append(missing, key)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func TestReadEndpoints(t *testing.T) {
+	tw := newTestWallet(t)
+	address := tw.newAddress()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/dashboard", http.StatusOK},
+		{"/api/balance", http.StatusOK},
+		{"/api/balance/history", http.StatusOK},
+		{"/api/utxos", http.StatusOK},
+		{"/api/utxos?min_conf=6", http.StatusOK},
+		{"/api/utxos/locked", http.StatusOK},
+		{"/api/wallet/stats", http.StatusOK},
+		{"/api/wallet/jobs", http.StatusOK},
+		{"/api/amount-words?amount=12.5", http.StatusOK},
+		{"/api/amount-words?amount=ten", http.StatusBadRequest},
+		{"/api/transactions", http.StatusOK},
+		{"/api/tags", http.StatusOK},
+		{"/api/reports/tags", http.StatusOK},
+		{"/api/search?q=Donations", http.StatusOK},
+		{"/api/notifications", http.StatusOK},
+		{"/api/notifications/unread", http.StatusOK},
+		{"/api/addresses", http.StatusOK},
+		{"/api/addresses/groupings", http.StatusOK},
+		{"/api/address/" + address + "/transactions", http.StatusOK},
+		{"/api/address/" + address + "/received", http.StatusOK},
+		{"/api/address/nonsense/received", http.StatusBadRequest},
+		{"/api/payment-uri?address=" + address + "&amount=1.5", http.StatusOK},
+		{"/api/payment-uri?address=nonsense", http.StatusBadRequest},
+		{"/api/price", http.StatusOK},
+		{"/api/price?currency=EUR", http.StatusOK},
+		{"/api/address-info?address=" + address, http.StatusOK},
+		{"/api/address-info", http.StatusBadRequest},
+		{"/api/check-wallet", http.StatusOK},
+		{"/api/network-info", http.StatusOK},
+		{"/api/network/peers", http.StatusOK},
+		{"/api/network/traffic", http.StatusOK},
+		{"/api/blockchain-info", http.StatusOK},
+		{"/api/mining/immature", http.StatusOK},
+		{"/api/fees/history", http.StatusOK},
+		{"/api/deprecations", http.StatusOK},
+		{"/api/status", http.StatusOK},
+		{"/api/wait?timeout=1ms", http.StatusOK},
+		{"/api/graphql?query=" + "%7Bbalance%7Bconfirmed%7D%7D", http.StatusOK},
+		{"/api/nope", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			tw.t = t
+			tw.call("GET", tt.path, nil, tt.status)
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	tw := newTestWallet(t)
+	to := externalAddress(t)
+
+	preview := tw.call("POST", "/api/send/preview", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1.5)}, http.StatusOK)
+	if preview["fee"] == nil {
+		t.Errorf("preview without a fee: %v", preview)
+	}
+	// One payment and change, from wallet coins the preview can size
+	if preview["inputs"] == nil || preview["outputs"] != 2.0 || preview["vsize"] == nil || preview["fee_rate"] == nil {
+		t.Errorf("preview without its size: %v", preview)
+	}
+	if calls := tw.node.Calls("sendtoaddress"); calls != 0 {
+		t.Fatalf("preview called sendtoaddress %d times", calls)
+	}
+
+	sent := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1.5), Comment: "rent"}, http.StatusOK)
+	txid, _ := sent["txid"].(string)
+	if len(txid) != 64 {
+		t.Fatalf("send returned txid %q", txid)
+	}
+	tw.call("POST", "/api/send-max", SendMaxRequest{ToAddress: to}, http.StatusOK)
+
+	tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: "nonsense", Amount: rpc.AmountFromKCN(1)}, http.StatusBadRequest)
+	tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(-1)}, http.StatusBadRequest)
+	tw.call("POST", "/api/send", "{", http.StatusBadRequest)
+
+	// The node's errors come back with the wallet's codes
+	tw.node.SetError("sendtoaddress", -6, "Insufficient funds")
+	resp := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1)}, http.StatusBadRequest)
+	if resp["code"] != ErrInsufficientFunds {
+		t.Errorf("insufficient funds answered code %v", resp["code"])
+	}
+}
+
+func TestTransactionActions(t *testing.T) {
+	tw := newTestWallet(t)
+	sent := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: externalAddress(t), Amount: rpc.AmountFromKCN(0.25), Replaceable: true}, http.StatusOK)
+	txid := sent["txid"].(string)
+	base := "/api/transaction/" + txid
+
+	label := "Rent"
+	tags := []string{"home", "monthly"}
+	tw.call("PATCH", base+"/metadata", TxMetadataRequest{Label: &label, Tags: &tags}, http.StatusOK)
+	meta := tw.call("GET", base+"/metadata", nil, http.StatusOK)
+	if !strings.Contains(fmt.Sprint(meta), "Rent") {
+		t.Errorf("metadata not saved: %v", meta)
+	}
+	tw.call("DELETE", base+"/metadata", nil, http.StatusOK)
+
+	tw.call("POST", base+"/watch", TxWatchRequest{}, http.StatusOK)
+	tw.call("GET", base+"/watch", nil, http.StatusOK)
+	tw.call("DELETE", base+"/watch", nil, http.StatusOK)
+
+	tw.call("POST", "/api/bumpfee", BumpFeeRequest{Txid: txid, FeeRate: 5}, http.StatusOK)
+
+	// The demo wallet's one unconfirmed payment can be sped up by its child
+	for _, u := range tw.call("GET", "/api/utxos", nil, http.StatusOK)["utxos"].([]interface{}) {
+		if utxo := u.(map[string]interface{}); utxo["confirmations"].(float64) == 0 && utxo["txid"] != txid {
+			tw.call("POST", "/api/cpfp", CPFPRequest{Txid: utxo["txid"].(string), FeeRate: 20}, http.StatusOK)
+		}
+	}
+	tw.call("POST", "/api/cpfp", CPFPRequest{}, http.StatusBadRequest)
+	// The node won't abandon what is still in its mempool
+	tw.call("POST", base+"/abandon", nil, http.StatusBadRequest)
+	tw.node.SetResult("abandontransaction", nil)
+	tw.call("POST", base+"/abandon", nil, http.StatusOK)
+
+	tw.call("GET", "/api/transaction/xyz/metadata", nil, http.StatusNotFound)
+	tw.call("GET", "/api/transactions/export?format=nope", nil, http.StatusBadRequest)
+	resp, data := tw.request("GET", "/api/transactions/export?format=csv", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), txid) {
+		t.Errorf("CSV export: status %d without the new transaction", resp.StatusCode)
+	}
+}
+
+func TestCoinControl(t *testing.T) {
+	tw := newTestWallet(t)
+	utxos := tw.call("GET", "/api/utxos", nil, http.StatusOK)["utxos"].([]interface{})
+	first := utxos[0].(map[string]interface{})
+	outpoint := rpc.Outpoint{Txid: first["txid"].(string), Vout: int(first["vout"].(float64))}
+
+	tw.call("POST", "/api/utxos/lock", LockUTXOsRequest{Outpoints: []rpc.Outpoint{outpoint}}, http.StatusOK)
+	locked := tw.call("GET", "/api/utxos/locked", nil, http.StatusOK)
+	if !strings.Contains(fmt.Sprint(locked), outpoint.Txid) {
+		t.Errorf("locked UTXOs without %s: %v", outpoint.Txid, locked)
+	}
+	tw.call("POST", "/api/utxos/unlock", LockUTXOsRequest{All: true}, http.StatusOK)
+	tw.call("POST", "/api/utxos/lock", LockUTXOsRequest{}, http.StatusBadRequest)
+
+	// Sending from chosen inputs
+	tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: externalAddress(t), Amount: rpc.AmountFromKCN(1), Inputs: []rpc.Outpoint{outpoint}}, http.StatusOK)
+}
+
+func TestFundPreview(t *testing.T) {
+	tw := newTestWallet(t)
+	to, change := externalAddress(t), tw.newAddress()
+	draft := FundPreviewRequest{
+		Outputs: []DraftOutput{
+			{Address: to, Amount: rpc.AmountFromKCN(0.5)},
+			{Address: tw.newAddress(), Amount: rpc.AmountFromKCN(0.25)},
+		},
+		ChangeAddress: change,
+	}
+
+	resp := tw.call("POST", "/api/fund-preview", draft, http.StatusOK)
+	inputs, outputs := resp["inputs"].([]interface{}), resp["outputs"].([]interface{})
+	if len(inputs) == 0 || len(outputs) != 3 {
+		t.Fatalf("funded %d inputs to %d outputs", len(inputs), len(outputs))
+	}
+	if first := inputs[0].(map[string]interface{}); first["address"] == nil || first["amount"] == nil {
+		t.Errorf("input without its coin: %v", first)
+	}
+	changed := 0
+	for _, o := range outputs {
+		if output := o.(map[string]interface{}); output["change"] == true {
+			changed++
+			if output["address"] != change || output["amount"] != resp["change"] {
+				t.Errorf("change output %v, change %v", output, resp["change"])
+			}
+		}
+	}
+	if changed != 1 || resp["vsize"] == nil || resp["fee_rate"] == nil {
+		t.Errorf("fund preview %v", resp)
+	}
+	if calls := tw.node.Calls("sendrawtransaction") + tw.node.Calls("signrawtransactionwithwallet"); calls != 0 {
+		t.Errorf("fund preview made %d sign or send calls", calls)
+	}
+
+	tw.call("POST", "/api/fund-preview", FundPreviewRequest{}, http.StatusBadRequest)
+	draft.Outputs[1].Address = "nonsense"
+	if resp := tw.call("POST", "/api/fund-preview", draft, http.StatusBadRequest); resp["code"] != ErrInvalidAddress {
+		t.Errorf("bad output address answered code %v", resp["code"])
+	}
+}
+
+func TestMaxSend(t *testing.T) {
+	tw := newTestWallet(t)
+	to := externalAddress(t)
+
+	// The confirmed coins, one of them locked
+	var confirmed rpc.Amount
+	var locked *rpc.Outpoint
+	for _, u := range tw.call("GET", "/api/utxos", nil, http.StatusOK)["utxos"].([]interface{}) {
+		utxo := u.(map[string]interface{})
+		if utxo["confirmations"].(float64) < 1 {
+			continue
+		}
+		amount, err := rpc.ParseAmount(fmt.Sprint(utxo["amount"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked == nil {
+			locked = &rpc.Outpoint{Txid: utxo["txid"].(string), Vout: int(utxo["vout"].(float64))}
+			continue
+		}
+		confirmed += amount
+	}
+	if locked == nil || confirmed == 0 {
+		t.Fatal("the demo wallet needs two confirmed coins")
+	}
+	tw.call("POST", "/api/utxos/lock", LockUTXOsRequest{Outpoints: []rpc.Outpoint{*locked}}, http.StatusOK)
+
+	resp := tw.call("GET", "/api/max-send?to="+to+"&conf_target=2", nil, http.StatusOK)
+	max, err := rpc.ParseAmount(fmt.Sprint(resp["amount"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee, _ := rpc.ParseAmount(fmt.Sprint(resp["fee"]))
+	if fee <= 0 || max+fee != confirmed {
+		t.Errorf("max %s + fee %s, want the unlocked confirmed %s", max, fee, confirmed)
+	}
+
+	// The Max button asks without conf_target and sends through send-max,
+	// which pays out exactly what was reported and leaves no confirmed coins
+	// but the locked one
+	resp = tw.call("GET", "/api/max-send?to="+to, nil, http.StatusOK)
+	if total, _ := rpc.ParseAmount(fmt.Sprint(resp["total"])); total != confirmed {
+		t.Errorf("max-send total %s, want the unlocked confirmed %s", total, confirmed)
+	}
+	swept := tw.call("POST", "/api/send-max", SendMaxRequest{ToAddress: to}, http.StatusOK)
+	if swept["amount"] != resp["amount"] || swept["fee"] != resp["fee"] {
+		t.Errorf("send-max sent %v with fee %v, max-send reported %v with fee %v", swept["amount"], swept["fee"], resp["amount"], resp["fee"])
+	}
+	for _, u := range tw.call("GET", "/api/utxos", nil, http.StatusOK)["utxos"].([]interface{}) {
+		if utxo := u.(map[string]interface{}); utxo["confirmations"].(float64) >= 1 {
+			t.Errorf("confirmed coin %v:%v left after sending the max", utxo["txid"], utxo["vout"])
+		}
+	}
+
+	tw.call("GET", "/api/max-send?to=nonsense", nil, http.StatusBadRequest)
+	tw.call("GET", "/api/max-send?to="+to+"&conf_target=0", nil, http.StatusBadRequest)
+}
+
+func TestChangeAddress(t *testing.T) {
+	tw := newTestWallet(t)
+	to := externalAddress(t)
+	change := tw.newAddress()
+
+	sent := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(0.5), ChangeAddress: change}, http.StatusOK)
+	found := false
+	for _, u := range tw.call("GET", "/api/utxos?min_conf=0", nil, http.StatusOK)["utxos"].([]interface{}) {
+		utxo := u.(map[string]interface{})
+		found = found || (utxo["txid"] == sent["txid"] && utxo["address"] == change)
+	}
+	if !found {
+		t.Errorf("no change of %s at %s", sent["txid"], change)
+	}
+
+	tw.call("POST", "/api/send/preview", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(0.5), ChangeAddress: ChangeNewSegWit}, http.StatusOK)
+	if calls := tw.node.Calls("getrawchangeaddress"); calls != 1 {
+		t.Errorf("new-segwit made %d getrawchangeaddress calls", calls)
+	}
+
+	// Change can't leave the wallet, where a send limit wouldn't count it
+	outside, err := hdwallet.GenerateWalletFromMnemonic(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funded := tw.node.Calls("fundrawtransaction")
+	for _, changeAddress := range []string{"nonsense", to, outside.LegacyAddress} {
+		resp := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(0.5), ChangeAddress: changeAddress}, http.StatusBadRequest)
+		if resp["code"] != ErrInvalidAddress {
+			t.Errorf("change address %s answered code %v", changeAddress, resp["code"])
+		}
+	}
+	if calls := tw.node.Calls("fundrawtransaction"); calls != funded {
+		t.Errorf("refused change addresses reached fundrawtransaction %d times", calls-funded)
+	}
+
+	// Nor from a scheduled send, which doesn't go through the send checks
+	if _, err := tw.ws.submitSend(tw.ws.rpcClient, SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(0.5), ChangeAddress: outside.LegacyAddress}); err == nil {
+		t.Error("a draft with outside change was sent")
+	}
+}
+
+func TestFeePresets(t *testing.T) {
+	tw := newTestWallet(t, func(cfg *Config) {
+		cfg.Fees.Priority.Ceiling = 100
+	})
+	to := externalAddress(t)
+
+	// 0.5 KCN/kvB is 50000 kernels per vbyte, over priority's ceiling
+	tw.node.SetResult("estimatesmartfee", map[string]interface{}{"feerate": 0.5, "blocks": 2})
+	presets := tw.call("GET", "/api/fee-presets", nil, http.StatusOK)["presets"].([]interface{})
+	if len(presets) != 3 {
+		t.Fatalf("presets %v", presets)
+	}
+	economy, priority := presets[0].(map[string]interface{}), presets[2].(map[string]interface{})
+	if economy["fee_rate"] != 50000.0 || economy["bound"] != nil {
+		t.Errorf("economy preset %v", economy)
+	}
+	if priority["fee_rate"] != 100.0 || priority["bound"] != "ceiling" {
+		t.Errorf("priority preset %v", priority)
+	}
+
+	// Without an estimate the floor applies
+	tw.node.SetResult("estimatesmartfee", map[string]interface{}{"errors": []string{"Insufficient data or no feerate found"}, "blocks": 0})
+	normal := tw.call("GET", "/api/fee-presets", nil, http.StatusOK)["presets"].([]interface{})[1].(map[string]interface{})
+	if normal["fee_rate"] != 1.0 || normal["bound"] != "floor" || normal["estimate"] != nil {
+		t.Errorf("normal preset without an estimate %v", normal)
+	}
+
+	cheap := tw.call("POST", "/api/send/preview", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1), FeePreset: "normal"}, http.StatusOK)
+	tw.node.SetResult("estimatesmartfee", map[string]interface{}{"feerate": 0.5, "blocks": 2})
+	fast := tw.call("POST", "/api/send/preview", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1), FeePreset: "priority"}, http.StatusOK)
+	cheapFee, _ := rpc.ParseAmount(fmt.Sprint(cheap["fee"]))
+	fastFee, _ := rpc.ParseAmount(fmt.Sprint(fast["fee"]))
+	if fastFee < 50*cheapFee {
+		t.Errorf("priority fee %s against normal %s at 1 kernel/vB", fastFee, cheapFee)
+	}
+
+	tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1), FeePreset: "priority"}, http.StatusOK)
+	resp := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: to, Amount: rpc.AmountFromKCN(1), FeePreset: "ludicrous"}, http.StatusBadRequest)
+	if resp["code"] != ErrInvalidRequest {
+		t.Errorf("unknown preset answered code %v", resp["code"])
+	}
+}
+
+// testPriceProvider quotes every currency at price, or fails when it is 0
+type testPriceProvider struct {
+	name  string
+	price float64
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *testPriceProvider) Name() string { return p.name }
+
+func (p *testPriceProvider) Price(currency string) (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.price == 0 {
+		return 0, fmt.Errorf("%s is down", p.name)
+	}
+	return p.price, nil
+}
+
+func (p *testPriceProvider) PriceAt(currency string, at time.Time) (float64, error) {
+	return p.Price(currency)
+}
+
+func (p *testPriceProvider) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+// registerTestPrices registers a testPriceProvider for each name and
+// price until the test ends, returning the provider last built for each
+func registerTestPrices(t *testing.T, prices map[string]float64) map[string]*testPriceProvider {
+	t.Helper()
+	built := map[string]*testPriceProvider{}
+	for name, price := range prices {
+		name, price := name, price
+		RegisterPriceProvider(name, func(PriceConfig) (PriceProvider, error) {
+			built[name] = &testPriceProvider{name: name, price: price}
+			return built[name], nil
+		})
+		t.Cleanup(func() {
+			priceProvidersMu.Lock()
+			defer priceProvidersMu.Unlock()
+			delete(priceProviders, name)
+		})
+	}
+	return built
+}
+
+func TestPriceProviders(t *testing.T) {
+	testPrices := registerTestPrices(t, map[string]float64{"test-down": 0, "test-low": 0.04, "test-high": 0.09})
+	prices := func(selection string, providers ...string) func(*Config) {
+		return func(cfg *Config) {
+			cfg.Prices.Providers, cfg.Prices.Selection = providers, selection
+		}
+	}
+
+	// A failing provider is skipped, then left alone while it backs off
+	tw := newTestWallet(t, prices(PriceSelectFirst, "test-down", "test-low"))
+	for i := 0; i < 2; i++ {
+		resp := tw.call("GET", "/api/price", nil, http.StatusOK)
+		if resp["price"] != 0.04 || resp["source"] != "test-low" {
+			t.Errorf("first healthy price %v", resp)
+		}
+	}
+	if down, low := testPrices["test-down"].callCount(), testPrices["test-low"].callCount(); down != 1 || low != 1 {
+		t.Errorf("%d calls to the failing provider and %d to the cached one", down, low)
+	}
+
+	tw = newTestWallet(t, prices(PriceSelectMedian, "test-low", "test-down", "static", "test-high"))
+	resp := tw.call("GET", "/api/price", nil, http.StatusOK)
+	if resp["price"] != 0.05 || resp["source"] != "test-low,static,test-high" {
+		t.Errorf("median price %v", resp)
+	}
+
+	// Each provider keeps its own rate limit
+	tw = newTestWallet(t, prices(PriceSelectFirst, "test-low", "test-high"), func(cfg *Config) {
+		cfg.Prices.Sources = map[string]PriceSourceConfig{"test-low": {RequestsPerMinute: 1}}
+	})
+	for _, currency := range []string{"USD", "EUR", "GBP", "JPY", "CHF", "CAD"} {
+		tw.call("GET", "/api/price?currency="+currency, nil, http.StatusOK)
+	}
+	if low, high := testPrices["test-low"].callCount(), testPrices["test-high"].callCount(); low != priceBurst || high != 1 {
+		t.Errorf("%d calls to the limited provider and %d to the next", low, high)
+	}
+
+	// Made-up currencies never reach a provider or its cache
+	tw = newTestWallet(t, prices(PriceSelectFirst, "test-low"))
+	for _, currency := range []string{"NOPE", "usd1", "XXXXXXXXXXXXXXXX"} {
+		tw.call("GET", "/api/price?currency="+currency, nil, http.StatusBadRequest)
+	}
+	tw.call("POST", "/api/checkout", CheckoutRequest{OrderID: "order-1", FiatAmount: 10, Currency: "NOPE"}, http.StatusBadRequest)
+	tw.call("GET", "/api/transactions/export?currency=NOPE", nil, http.StatusBadRequest)
+	if calls := testPrices["test-low"].callCount(); calls != 0 {
+		t.Errorf("unknown currencies made %d provider calls", calls)
+	}
+	tw.call("GET", "/api/price?currency=eur", nil, http.StatusOK)
+}
+
+func TestRescanJobs(t *testing.T) {
+	tw := newTestWallet(t)
+	tw.node.SetDelay("rescanblockchain", time.Second)
+
+	job := tw.call("POST", "/api/wallet/rescan", RescanRequest{}, http.StatusAccepted)
+	id := fmt.Sprint(job["job"].(map[string]interface{})["id"])
+	tw.call("GET", "/api/wallet/jobs/"+id, nil, http.StatusOK)
+	tw.call("POST", "/api/wallet/jobs/"+id+"/abort", nil, http.StatusOK)
+	tw.call("GET", "/api/wallet/jobs/nope", nil, http.StatusNotFound)
+	tw.call("POST", "/api/wallet/rescan", RescanRequest{StartHeight: 10, StopHeight: 5}, http.StatusBadRequest)
+}
+
+func TestContacts(t *testing.T) {
+	tw := newTestWallet(t)
+	address := externalAddress(t)
+
+	created := tw.call("POST", "/api/contacts", ContactRequest{Name: "Alice", Addresses: []string{address}}, http.StatusOK)
+	id := fmt.Sprint(created["contact"].(map[string]interface{})["id"])
+	tw.call("GET", "/api/contacts", nil, http.StatusOK)
+	tw.call("GET", "/api/contacts/"+id, nil, http.StatusOK)
+	tw.call("PUT", "/api/contacts/"+id, ContactRequest{Name: "Alice B", Addresses: []string{address}}, http.StatusOK)
+	tw.call("DELETE", "/api/contacts/"+id, nil, http.StatusOK)
+	tw.call("GET", "/api/contacts/"+id, nil, http.StatusNotFound)
+	tw.call("POST", "/api/contacts", ContactRequest{Name: "Bob", Addresses: []string{"nonsense"}}, http.StatusBadRequest)
+}
+
+func TestAddresses(t *testing.T) {
+	tw := newTestWallet(t)
+	address := tw.newAddress()
+
+	tw.call("POST", "/api/validateaddress", ValidateAddressRequest{Address: address}, http.StatusOK)
+	tw.call("POST", "/api/getnewaddress", map[string]string{}, http.StatusOK)
+	tw.call("POST", "/api/addresses/bulk", BulkAddressRequest{Count: 3, Label: "invoice-##"}, http.StatusOK)
+	tw.call("POST", "/api/addresses/bulk", BulkAddressRequest{Count: 0}, http.StatusBadRequest)
+
+	tw.call("POST", "/api/address/"+address+"/watch", PaymentWatchRequest{Amount: rpc.AmountFromKCN(1)}, http.StatusOK)
+	tw.call("DELETE", "/api/address/"+address+"/watch", nil, http.StatusOK)
+
+	for _, path := range []string{"/api/address/" + address + "/qr", "/api/qr?data=" + address} {
+		resp, data := tw.request("GET", path, nil)
+		if resp.StatusCode != http.StatusOK || !bytes.HasPrefix(data, []byte("\x89PNG")) {
+			t.Errorf("GET %s: status %d, %s", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+	tw.call("GET", "/api/qr", nil, http.StatusBadRequest)
+}
+
+func TestKeys(t *testing.T) {
+	tw := newTestWallet(t)
+	wallet := tw.call("POST", "/api/new-wallet", NewWalletRequest{}, http.StatusOK)
+	mnemonic := wallet["mnemonic"].(string)
+
+	tw.call("POST", "/api/new-address", map[string]string{"mnemonic": mnemonic}, http.StatusOK)
+	tw.call("POST", "/api/new-address", map[string]string{}, http.StatusBadRequest)
+	tw.call("POST", "/api/import-mnemonic", MnemonicToWIFRequest{Mnemonic: mnemonic}, http.StatusOK)
+	tw.call("POST", "/api/import-mnemonic", MnemonicToWIFRequest{Mnemonic: "not a mnemonic"}, http.StatusBadRequest)
+
+	rescan := false
+	tw.call("POST", "/api/import", ImportKeyRequest{WIF: wallet["private_key_wif"].(string), Rescan: &rescan}, http.StatusOK)
+	tw.call("POST", "/api/import", ImportKeyRequest{WIF: "nonsense"}, http.StatusBadRequest)
+
+	// A key leaves the node for the authenticator's current code, once
+	address := tw.newAddress()
+	code := totpCode(tw.ws.keyExport.key, uint64(time.Now().Unix())/uint64(totpStep/time.Second))
+	if code != "000000" {
+		tw.call("POST", "/api/export-key", ExportKeyRequest{Address: address, Code: "000000"}, http.StatusForbidden)
+	}
+	exported := tw.call("POST", "/api/export-key", ExportKeyRequest{Address: address, Code: code}, http.StatusOK)
+	if exported["wif"] == nil {
+		t.Errorf("export answered %v", exported)
+	}
+	tw.call("POST", "/api/export-key", ExportKeyRequest{Address: address, Code: code}, http.StatusForbidden)
+}
+
+// testPSBT is a PSBT as far as the wallet server looks into one: the node
+// fixtures answer for what is inside
+var testPSBT = base64.StdEncoding.EncodeToString([]byte("psbt\xff\x01\x00unsigned"))
+
+// setPSBTFixtures gives the fake node the PSBT methods it lacks, for a
+// transaction with the given unsigned txid
+func setPSBTFixtures(node *rpctest.Server, txid string) {
+	node.SetResult("walletcreatefundedpsbt", map[string]interface{}{"psbt": testPSBT, "fee": 0.0000141, "changepos": 1})
+	node.SetResult("walletprocesspsbt", map[string]interface{}{"psbt": testPSBT, "complete": true})
+	node.SetResult("combinepsbt", testPSBT)
+	node.SetResult("finalizepsbt", map[string]interface{}{"hex": "0200000000", "complete": true})
+	node.SetResult("decodepsbt", map[string]interface{}{
+		"tx":      map[string]interface{}{"txid": txid},
+		"fee":     0.0000141,
+		"inputs":  []interface{}{map[string]interface{}{}},
+		"outputs": []interface{}{map[string]interface{}{}, map[string]interface{}{}},
+	})
+	node.SetResult("sendrawtransaction", txid)
+}
+
+func TestPSBT(t *testing.T) {
+	tw := newTestWallet(t)
+	txid := strings.Repeat("ab", 32)
+	setPSBTFixtures(tw.node, txid)
+	outputs := []PSBTOutput{{Address: externalAddress(t), Amount: rpc.AmountFromKCN(0.5)}}
+
+	created := tw.call("POST", "/api/psbt/create", PSBTCreateRequest{Outputs: outputs}, http.StatusOK)
+	if created["psbt"] != testPSBT {
+		t.Errorf("created PSBT %v", created["psbt"])
+	}
+	tw.call("POST", "/api/psbt/create", PSBTCreateRequest{}, http.StatusBadRequest)
+	tw.call("POST", "/api/psbt/process", PSBTRequest{PSBT: testPSBT, Sign: true}, http.StatusOK)
+	finalized := tw.call("POST", "/api/psbt/finalize", PSBTRequest{PSBT: testPSBT, Broadcast: true}, http.StatusOK)
+	if finalized["txid"] != txid {
+		t.Errorf("finalize broadcast txid %v", finalized["txid"])
+	}
+	tw.call("POST", "/api/psbt/process", PSBTRequest{PSBT: "bm90IGEgUFNCVA=="}, http.StatusBadRequest)
+
+	imported := tw.call("POST", "/api/psbt/import", PSBTRequest{PSBT: testPSBT}, http.StatusOK)
+	if imported["inputs"] != 1.0 || imported["outputs"] != 2.0 {
+		t.Errorf("imported %v", imported)
+	}
+	resp, data := tw.request("POST", "/api/psbt/export", PSBTRequest{PSBT: testPSBT})
+	if resp.StatusCode != http.StatusOK || !bytes.HasPrefix(data, []byte("psbt\xff")) {
+		t.Errorf("export: status %d, %q", resp.StatusCode, data)
+	}
+	tw.call("POST", "/api/broadcast", BroadcastRequest{Hex: "0200000000"}, http.StatusOK)
+}
+
+func TestSigningRequests(t *testing.T) {
+	tw := newTestWallet(t)
+	txid := strings.Repeat("cd", 32)
+	setPSBTFixtures(tw.node, txid)
+	outputs := []PSBTOutput{{Address: externalAddress(t), Amount: rpc.AmountFromKCN(0.5)}}
+
+	created := tw.call("POST", "/api/psbt/requests", SigningRequestCreate{PSBTCreateRequest: PSBTCreateRequest{Outputs: outputs}, Label: "cold storage"}, http.StatusOK)
+	base := "/api/psbt/requests/" + created["request"].(map[string]interface{})["id"].(string)
+	tw.call("GET", "/api/psbt/requests", nil, http.StatusOK)
+	tw.call("GET", base, nil, http.StatusOK)
+	if resp, data := tw.request("GET", base+"/psbt", nil); resp.StatusCode != http.StatusOK || !bytes.HasPrefix(data, []byte("psbt\xff")) {
+		t.Errorf("PSBT download: status %d", resp.StatusCode)
+	}
+	qr := tw.call("GET", base+"/qr", nil, http.StatusOK)
+	if len(qr["parts"].([]interface{})) == 0 {
+		t.Fatalf("no QR frames: %v", qr)
+	}
+	if resp, _ := tw.request("GET", base+"/qr/1", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("QR frame: status %d", resp.StatusCode)
+	}
+	tw.call("GET", base+"/qr/99", nil, http.StatusNotFound)
+
+	signed := tw.call("POST", base+"/signed", SigningUploadRequest{PSBT: testPSBT}, http.StatusOK)
+	if status := signed["request"].(map[string]interface{})["status"]; status != SigningSigned {
+		t.Errorf("status after the last signature %v", status)
+	}
+	tw.call("POST", base+"/broadcast", nil, http.StatusOK)
+	tw.call("POST", base+"/cancel", nil, http.StatusConflict)
+	tw.call("GET", "/api/psbt/requests/nope", nil, http.StatusNotFound)
+
+	// An upload of another transaction is refused
+	other := tw.call("POST", "/api/psbt/requests", SigningRequestCreate{PSBTCreateRequest: PSBTCreateRequest{Outputs: outputs}}, http.StatusOK)
+	base = "/api/psbt/requests/" + other["request"].(map[string]interface{})["id"].(string)
+	setPSBTFixtures(tw.node, strings.Repeat("ef", 32))
+	tw.call("POST", base+"/signed", SigningUploadRequest{PSBT: testPSBT}, http.StatusBadRequest)
+	tw.call("POST", base+"/cancel", nil, http.StatusOK)
+}
+
+func TestMultisig(t *testing.T) {
+	tw := newTestWallet(t)
+	var pubkeys []string
+	for i := 0; i < 3; i++ {
+		w, err := hdwallet.WalletFromMnemonic(testMnemonic, fmt.Sprintf("m/48'/2'/0'/2'/%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubkeys = append(pubkeys, w.PublicKeyHex)
+	}
+	address := externalAddress(t)
+	tw.node.SetResult("addmultisigaddress", map[string]interface{}{"address": address, "redeemScript": "5221", "descriptor": "wsh(multi(2))"})
+
+	created := tw.call("POST", "/api/multisig", MultisigCreateRequest{Name: "Board", Required: 2, PubKeys: pubkeys}, http.StatusOK)
+	base := "/api/multisig/" + created["wallet"].(map[string]interface{})["id"].(string)
+	tw.call("POST", "/api/multisig", MultisigCreateRequest{Name: "Board", Required: 4, PubKeys: pubkeys}, http.StatusBadRequest)
+	tw.call("GET", "/api/multisig", nil, http.StatusOK)
+	tw.call("GET", base, nil, http.StatusOK)
+	tw.call("GET", "/api/multisig/nope", nil, http.StatusNotFound)
+
+	spend := SigningRequestCreate{PSBTCreateRequest: PSBTCreateRequest{Outputs: []PSBTOutput{{Address: externalAddress(t), Amount: rpc.AmountFromKCN(0.1)}}}}
+	tw.call("POST", base+"/spend", spend, http.StatusBadRequest)
+
+	// With a coin at the multisig address, spending makes a signing request
+	setPSBTFixtures(tw.node, strings.Repeat("12", 32))
+	tw.node.SetResult("listunspent", []interface{}{map[string]interface{}{
+		"txid": strings.Repeat("34", 32), "vout": 0, "address": address, "amount": 1.0, "confirmations": 6, "spendable": false, "solvable": true, "safe": true,
+	}})
+	spent := tw.call("POST", base+"/spend", spend, http.StatusOK)
+	if spent["cosigners"] == nil {
+		t.Errorf("multisig spend without cosigners: %v", spent)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	tw := newTestWallet(t)
+
+	opened := tw.call("POST", "/api/session/open", OpenSessionRequest{Mnemonic: testMnemonic}, http.StatusOK)
+	session := SessionRequest{SessionID: opened["session_id"].(string)}
+	tw.call("POST", "/api/session/balance", session, http.StatusOK)
+	// Only the electrum backend keeps address history
+	tw.call("POST", "/api/session/history", session, http.StatusNotImplemented)
+	tw.call("POST", "/api/local/send", LocalSendRequest{SessionID: session.SessionID, ToAddress: tw.newAddress(), Amount: rpc.AmountFromKCN(1)}, http.StatusBadRequest)
+	tw.call("POST", "/api/session/close", session, http.StatusOK)
+	tw.call("POST", "/api/session/balance", session, http.StatusUnauthorized)
+	tw.call("POST", "/api/session/open", OpenSessionRequest{Mnemonic: "not a mnemonic"}, http.StatusBadRequest)
+
+	key, err := hdwallet.GenerateWalletFromMnemonic(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.call("POST", "/api/sweep", SweepRequest{WIF: key.PrivateKeyWIF, Preview: true}, http.StatusBadRequest)
+	tw.call("POST", "/api/sweep", SweepRequest{WIF: "nonsense"}, http.StatusBadRequest)
+}
+
+func TestScheduler(t *testing.T) {
+	tw := newTestWallet(t)
+	send := SendTransactionRequest{ToAddress: externalAddress(t), Amount: rpc.AmountFromKCN(1)}
+
+	created := tw.call("POST", "/api/scheduler/rules", CreateSendRuleRequest{SendTransactionRequest: send, Condition: ConditionBalanceAbove, Threshold: 1e6}, http.StatusOK)
+	base := "/api/scheduler/rules/" + fmt.Sprint(created["rule"].(map[string]interface{})["id"])
+	tw.call("GET", "/api/scheduler/rules", nil, http.StatusOK)
+	tw.call("GET", base, nil, http.StatusOK)
+	tw.call("POST", base+"/cancel", nil, http.StatusOK)
+	tw.call("GET", "/api/scheduler/rules/nope", nil, http.StatusNotFound)
+	tw.call("POST", "/api/scheduler/rules", CreateSendRuleRequest{SendTransactionRequest: send, Condition: "someday"}, http.StatusBadRequest)
+
+	// Rules a restart caught mid-send are settled, not sent again
+	for _, id := range []string{"broadcast", "unknown"} {
+		if err := tw.ws.store.InsertSendRule(SendRule{ID: id, Request: send, Condition: ConditionBalanceAbove, Status: RuleStatusSending}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.ws.store.TransitionSendRule("broadcast", RuleStatusSending, RuleStatusSending, "feed", "")
+	tw.ws.recoverSendingRules()
+	if rule := tw.call("GET", "/api/scheduler/rules/broadcast", nil, http.StatusOK)["rule"].(map[string]interface{}); rule["status"] != RuleStatusSent || rule["txid"] != "feed" {
+		t.Errorf("interrupted rule with a txid is %v", rule)
+	}
+	if rule := tw.call("GET", "/api/scheduler/rules/unknown", nil, http.StatusOK)["rule"].(map[string]interface{}); rule["status"] != RuleStatusFailed || rule["error"] == nil {
+		t.Errorf("interrupted rule without a txid is %v", rule)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	tw := newTestWallet(t)
+
+	created := tw.call("POST", "/api/checkout", CheckoutRequest{OrderID: "order-1", Amount: rpc.AmountFromKCN(2)}, http.StatusOK)
+	id := created["checkout"].(map[string]interface{})["id"].(string)
+	tw.call("POST", "/api/checkout", CheckoutRequest{OrderID: "order-2", FiatAmount: 10, Currency: "EUR"}, http.StatusOK)
+	tw.call("POST", "/api/checkout", CheckoutRequest{OrderID: "order-3"}, http.StatusBadRequest)
+	tw.call("GET", "/api/checkout", nil, http.StatusOK)
+	tw.call("GET", "/api/checkout/"+id, nil, http.StatusOK)
+	tw.call("GET", "/api/checkout/nope", nil, http.StatusNotFound)
+	tw.call("GET", "/api/pay/"+id, nil, http.StatusOK)
+
+	resp, data := tw.request("GET", "/pay/"+id, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), "<html") {
+		t.Errorf("payment page: status %d", resp.StatusCode)
+	}
+}
+
+func TestNotificationsAndQueries(t *testing.T) {
+	tw := newTestWallet(t)
+
+	tw.call("POST", "/api/notifications/read", MarkReadRequest{All: true}, http.StatusOK)
+	tw.call("POST", "/api/notifications/read", MarkReadRequest{}, http.StatusBadRequest)
+
+	result := tw.call("POST", "/api/graphql", GraphQLRequest{Query: "{ balance { confirmed } }"}, http.StatusOK)
+	if result["data"] == nil {
+		t.Errorf("GraphQL answered %v", result)
+	}
+	tw.call("POST", "/api/graphql", GraphQLRequest{Query: "{ nope }"}, http.StatusBadRequest)
+}
+
+func TestDevHelpers(t *testing.T) {
+	tw := newTestWallet(t)
+	address := tw.newAddress()
+
+	mined := tw.call("POST", "/api/dev/mine", DevMineRequest{Blocks: 3}, http.StatusOK)
+	if blocks := mined["blocks"].([]interface{}); len(blocks) != 3 {
+		t.Errorf("mined %d blocks, want 3", len(blocks))
+	}
+	tw.call("POST", "/api/dev/faucet", DevFaucetRequest{Address: address, Amount: rpc.AmountFromKCN(5)}, http.StatusOK)
+	// The simulated chain can't be rewound
+	tw.call("POST", "/api/dev/reset", nil, http.StatusInternalServerError)
+	tw.node.SetResult("invalidateblock", nil)
+	tw.call("POST", "/api/dev/reset", nil, http.StatusOK)
+
+	// Anywhere but regtest they refuse
+	main := newTestWallet(t, func(cfg *Config) { cfg.Network = "main" })
+	main.node.SetResult("getblockchaininfo", map[string]interface{}{"chain": "main", "blocks": 100})
+	main.call("POST", "/api/dev/mine", DevMineRequest{Blocks: 1}, http.StatusForbidden)
+}
+
+func TestBackups(t *testing.T) {
+	tw := newTestWallet(t)
+	tw.call("POST", "/api/wallet/backup", nil, http.StatusServiceUnavailable)
+	tw.call("POST", "/api/wallet/restore?name=restored", "backup", http.StatusServiceUnavailable)
+
+	tw = newTestWallet(t, func(cfg *Config) { cfg.BackupDir = t.TempDir() })
+	tw.node.SetResult("backupwallet", nil)
+	tw.node.SetResult("restorewallet", map[string]interface{}{"name": "restored", "warning": ""})
+	// The fake node writes no file, as a node not sharing BACKUP_DIR
+	tw.call("POST", "/api/wallet/backup", nil, http.StatusInternalServerError)
+	tw.call("POST", "/api/wallet/restore?name=restored", "backup", http.StatusOK)
+	tw.call("POST", "/api/wallet/restore?name=.hidden", "backup", http.StatusBadRequest)
+	tw.call("POST", "/api/wallet/restore?name=restored", "", http.StatusBadRequest)
+}
+
+func TestMultiUser(t *testing.T) {
+	tw := newTestWallet(t, func(cfg *Config) {
+		cfg.MultiUser = MultiUserConfig{Enabled: true, WalletPrefix: "user-"}
+		cfg.Auth = AuthConfig{Username: "admin", Password: "admin-secret"}
+	})
+	tw.node.SetResult("createwallet", map[string]interface{}{"name": "user-alice", "warning": ""})
+	tw.node.SetResult("unloadwallet", map[string]interface{}{"warning": ""})
+
+	tw.call("GET", "/api/admin/users", nil, http.StatusUnauthorized)
+	tw.user, tw.password = "admin", "admin-secret"
+	limit := rpc.AmountFromKCN(1)
+	tw.call("POST", "/api/admin/users", UserRequest{Username: "alice", Password: "alice-secret", DailySendLimit: &limit}, http.StatusOK)
+	tw.call("POST", "/api/admin/users", UserRequest{Username: "alice", Password: "another-secret"}, http.StatusConflict)
+	tw.call("GET", "/api/admin/users", nil, http.StatusOK)
+	tw.call("GET", "/api/admin/users/alice", nil, http.StatusOK)
+	tw.call("GET", "/api/account", nil, http.StatusOK)
+
+	tw.user, tw.password = "alice", "alice-secret"
+	account := tw.call("GET", "/api/account", nil, http.StatusOK)
+	if account["admin"] != false {
+		t.Errorf("alice's account %v", account)
+	}
+	tw.call("GET", "/api/balance", nil, http.StatusOK)
+	tw.call("GET", "/api/admin/users", nil, http.StatusForbidden)
+	resp := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: externalAddress(t), Amount: rpc.AmountFromKCN(2)}, http.StatusForbidden)
+	if resp["code"] != ErrSendLimit {
+		t.Errorf("send over the limit answered code %v", resp["code"])
+	}
+
+	tw.user, tw.password = "admin", "admin-secret"
+	tw.call("PUT", "/api/admin/users/alice", UserRequest{Disabled: true}, http.StatusOK)
+	tw.call("DELETE", "/api/admin/users/alice", nil, http.StatusOK)
+	tw.call("GET", "/api/admin/users/alice", nil, http.StatusNotFound)
+
+	// Her wallet stays on the node and is only handed over on request
+	tw.node.SetError("createwallet", -4, "Wallet file verification failed. Failed to create database path 'user-alice'. Database already exists.")
+	tw.node.SetResult("loadwallet", map[string]interface{}{"name": "user-alice", "warning": ""})
+	tw.call("POST", "/api/admin/users", UserRequest{Username: "alice", Password: "alice-secret"}, http.StatusConflict)
+	if calls := tw.node.Calls("loadwallet"); calls != 0 {
+		t.Errorf("a refused registration loaded the wallet %d times", calls)
+	}
+	tw.call("POST", "/api/admin/users", UserRequest{Username: "alice", Password: "alice-secret", AdoptWallet: true}, http.StatusOK)
+	if calls := tw.node.Calls("loadwallet"); calls != 1 {
+		t.Errorf("adopting the wallet loaded it %d times", calls)
+	}
+}
+
+func TestSendMaxLimit(t *testing.T) {
+	tw := newTestWallet(t, func(cfg *Config) {
+		cfg.MultiUser = MultiUserConfig{Enabled: true, WalletPrefix: "user-"}
+		cfg.Auth = AuthConfig{Username: "admin", Password: "admin-secret"}
+	})
+	tw.node.SetResult("createwallet", map[string]interface{}{"name": "user-alice", "warning": ""})
+	to := externalAddress(t)
+
+	// A limit of exactly the sweep after its fee lets the sweep through
+	tw.user, tw.password = "admin", "admin-secret"
+	max, err := rpc.ParseAmount(fmt.Sprint(tw.call("GET", "/api/max-send?to="+to, nil, http.StatusOK)["amount"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.call("POST", "/api/admin/users", UserRequest{Username: "alice", Password: "alice-secret", DailySendLimit: &max}, http.StatusOK)
+
+	tw.user, tw.password = "alice", "alice-secret"
+	swept := tw.call("POST", "/api/send-max", SendMaxRequest{ToAddress: to}, http.StatusOK)
+	if amount, _ := rpc.ParseAmount(fmt.Sprint(swept["amount"])); amount != max {
+		t.Errorf("swept %s, want %s", amount, max)
+	}
+}
+
+func TestMultiUserIsolation(t *testing.T) {
+	tw := newTestWallet(t, func(cfg *Config) {
+		cfg.MultiUser = MultiUserConfig{Enabled: true, WalletPrefix: "user-"}
+		cfg.Auth = AuthConfig{Username: "admin", Password: "admin-secret"}
+	})
+	tw.node.SetResult("createwallet", map[string]interface{}{"name": "user", "warning": ""})
+	tw.user, tw.password = "admin", "admin-secret"
+	for _, name := range []string{"alice", "bob"} {
+		tw.call("POST", "/api/admin/users", UserRequest{Username: name, Password: name + "-secret"}, http.StatusOK)
+	}
+	as := func(name string) { tw.user, tw.password = name, name+"-secret" }
+	count := func(resp map[string]interface{}, field string) int {
+		list, _ := resp[field].([]interface{})
+		return len(list)
+	}
+
+	// Alice fills in her data
+	as("alice")
+	address := externalAddress(t)
+	contact := tw.call("POST", "/api/contacts", ContactRequest{Name: "Carol", Addresses: []string{address}}, http.StatusOK)
+	contactID := contact["contact"].(map[string]interface{})["id"].(string)
+	txid := tw.call("POST", "/api/send", SendTransactionRequest{ToAddress: address, Amount: rpc.AmountFromKCN(0.1)}, http.StatusOK)["txid"].(string)
+	label, tags := "Rent", []string{"home"}
+	tw.call("PATCH", "/api/transaction/"+txid+"/metadata", TxMetadataRequest{Label: &label, Tags: &tags}, http.StatusOK)
+	tw.call("POST", "/api/transaction/"+txid+"/watch", TxWatchRequest{}, http.StatusOK)
+	rule := tw.call("POST", "/api/scheduler/rules", CreateSendRuleRequest{
+		SendTransactionRequest: SendTransactionRequest{ToAddress: address, Amount: rpc.AmountFromKCN(1)},
+		Condition:              ConditionBalanceAbove, Threshold: 1e6,
+	}, http.StatusOK)
+	ruleID := rule["rule"].(map[string]interface{})["id"].(string)
+	checkout := tw.call("POST", "/api/checkout", CheckoutRequest{OrderID: "alice-1", Amount: rpc.AmountFromKCN(2)}, http.StatusOK)
+	checkoutID := checkout["checkout"].(map[string]interface{})["id"].(string)
+	if err := tw.ws.notify(Notification{Owner: "alice", Kind: NotifyPaymentReceived, Txid: txid, Title: "Received", Message: "For alice"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(tw.call("GET", "/api/contacts", nil, http.StatusOK), "contacts"); n != 1 {
+		t.Errorf("alice has %d contacts, want 1", n)
+	}
+	if n := count(tw.call("GET", "/api/notifications", nil, http.StatusOK), "notifications"); n != 1 {
+		t.Errorf("alice has %d notifications, want 1", n)
+	}
+
+	// Bob sees none of it, and can reuse the address in his own book
+	as("bob")
+	for _, list := range []struct{ path, field string }{
+		{"/api/contacts", "contacts"},
+		{"/api/tags", "tags"},
+		{"/api/scheduler/rules", "rules"},
+		{"/api/checkout", "checkouts"},
+		{"/api/notifications", "notifications"},
+		{"/api/search?q=carol", "hits"},
+	} {
+		if n := count(tw.call("GET", list.path, nil, http.StatusOK), list.field); n != 0 {
+			t.Errorf("bob sees %d of alice's %s", n, list.field)
+		}
+	}
+	tw.call("GET", "/api/contacts/"+contactID, nil, http.StatusNotFound)
+	tw.call("GET", "/api/scheduler/rules/"+ruleID, nil, http.StatusNotFound)
+	tw.call("POST", "/api/scheduler/rules/"+ruleID+"/cancel", nil, http.StatusNotFound)
+	tw.call("GET", "/api/checkout/"+checkoutID, nil, http.StatusNotFound)
+	tw.call("GET", "/api/transaction/"+txid+"/watch", nil, http.StatusNotFound)
+	if meta := tw.call("GET", "/api/transaction/"+txid+"/metadata", nil, http.StatusOK); strings.Contains(fmt.Sprint(meta), "Rent") {
+		t.Errorf("bob sees alice's metadata: %v", meta)
+	}
+	tw.call("POST", "/api/contacts", ContactRequest{Name: "Carol", Addresses: []string{address}}, http.StatusOK)
+
+	// Live events go to their owner, node events to everyone
+	cursor := tw.call("GET", "/api/wait", nil, http.StatusOK)["cursor"].(string)
+	tw.ws.events.PublishFor("alice", EventBalance, BalanceResponse{})
+	if n := count(tw.call("GET", "/api/wait?timeout=10ms&since="+cursor, nil, http.StatusOK), "events"); n != 0 {
+		t.Errorf("bob got %d of alice's events", n)
+	}
+	tw.ws.events.PublishFor(allOwners, EventBlockConnected, BlockEvent{Height: 1})
+	if n := count(tw.call("GET", "/api/wait?timeout=10ms&since="+cursor, nil, http.StatusOK), "events"); n != 1 {
+		t.Errorf("bob got %d node events, want 1", n)
+	}
+	as("alice")
+	if n := count(tw.call("GET", "/api/wait?timeout=10ms&since="+cursor, nil, http.StatusOK), "events"); n != 2 {
+		t.Errorf("alice got %d events, want 2", n)
+	}
+
+	// The admin's data is apart from both, and deleting alice drops hers
+	as("admin")
+	if n := count(tw.call("GET", "/api/contacts", nil, http.StatusOK), "contacts"); n != 0 {
+		t.Errorf("the admin sees %d users' contacts", n)
+	}
+	tw.node.SetResult("unloadwallet", map[string]interface{}{"warning": ""})
+	tw.call("DELETE", "/api/admin/users/alice", nil, http.StatusOK)
+	if contacts, err := tw.ws.store.Contacts("alice"); err != nil || len(contacts) != 0 {
+		t.Errorf("deleted alice still has contacts %v, %v", contacts, err)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	tw := newTestWallet(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", tw.url+"/api/events?types=block", nil)
+	noteRoute(tw.ws, "GET", "/api/events")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || resp.Header.Get("Content-Type") != "text/event-stream" || line != ": connected\n" {
+		t.Errorf("event stream opened with %q, %v (%s)", line, err, resp.Header.Get("Content-Type"))
+	}
+
+	noteRoute(tw.ws, "GET", "/ws")
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(tw.url, "http")+"/ws", "", tw.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var hello WalletEvent
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := websocket.JSON.Receive(conn, &hello); err != nil || hello.Type != EventBalance {
+		t.Errorf("WebSocket greeted with %+v, %v", hello, err)
+	}
+	if _, err := websocket.Dial("ws"+strings.TrimPrefix(tw.url, "http")+"/ws", "", "https://elsewhere.example"); err == nil {
+		t.Error("cross-origin WebSocket accepted")
+	}
+}
+
+func TestWebUI(t *testing.T) {
+	tw := newTestWallet(t)
+	for _, path := range []string{"/", "/send", "/contacts/12"} {
+		resp, data := tw.request("GET", path, nil)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(data), "<html") {
+			t.Errorf("GET %s: status %d", path, resp.StatusCode)
+		}
+	}
+	if resp, _ := tw.request("GET", "/static/missing.js", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing asset: status %d", resp.StatusCode)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tw := newTestWallet(t)
+
+	resp, data := tw.request("POST", "/api/balance", nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, HEAD, OPTIONS" || !strings.Contains(string(data), ErrMethodNotAllowed) {
+		t.Errorf("POST /api/balance: status %d, Allow %q: %s", resp.StatusCode, resp.Header.Get("Allow"), data)
+	}
+	resp, _ = tw.request("OPTIONS", "/api/contacts", nil)
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf("OPTIONS /api/contacts: status %d, Allow %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+	resp, data = tw.request("HEAD", "/api/status", nil)
+	if resp.StatusCode != http.StatusOK || len(data) != 0 {
+		t.Errorf("HEAD /api/status: status %d with %d bytes", resp.StatusCode, len(data))
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tw := newTestWallet(t, func(cfg *Config) { cfg.Server.CORSOrigins = []string{"https://shop.example"} })
+
+	resp, _ := tw.request("OPTIONS", "/api/balance", nil, "Origin", "https://shop.example", "Access-Control-Request-Method", "GET")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://shop.example" {
+		t.Errorf("preflight: status %d, origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	resp, _ = tw.request("GET", "/api/balance", nil, "Origin", "https://elsewhere.example")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("other origin allowed: %q", resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestNodeFailures(t *testing.T) {
+	tw := newTestWallet(t)
+
+	tw.node.SetError("getbalances", -28, "Loading wallet...")
+	resp := tw.call("GET", "/api/balance", nil, http.StatusInternalServerError)
+	if resp["code"] != ErrNodeUnavailable {
+		t.Errorf("warming up node answered code %v", resp["code"])
+	}
+	tw.node.Reset()
+
+	// A node that stops answering
+	tw.node.Close()
+	resp = tw.call("GET", "/api/balance", nil, http.StatusInternalServerError)
+	if resp["code"] != ErrNodeUnavailable {
+		t.Errorf("unreachable node answered code %v", resp["code"])
+	}
+}
+
+func TestSlowNode(t *testing.T) {
+	tw := newTestWallet(t)
+	tw.node.SetDelay("getblockchaininfo", 200*time.Millisecond)
+
+	// Requests arriving together share one call to the node
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", tw.url+"/api/blockchain-info", nil)
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := tw.node.Calls("getblockchaininfo"); calls != 1 {
+		t.Errorf("5 concurrent requests made %d getblockchaininfo calls", calls)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	tw := newTestWallet(t)
+	// It needs no node
+	tw.node.Close()
+
+	resp := tw.call("GET", "/api/selftest", nil, http.StatusOK)
+	if resp["vectors"] != float64(len(hdwallet.TestVectors)) || resp["failures"] != nil {
+		t.Errorf("self test answered %v", resp)
+	}
+
+	vectors := hdwallet.TestVectors
+	defer func() { hdwallet.TestVectors = vectors }()
+	wrong := vectors[0]
+	wrong.SegWitAddress = vectors[1].SegWitAddress
+	hdwallet.TestVectors = append([]hdwallet.TestVector{wrong}, vectors[1:]...)
+	resp = tw.call("GET", "/api/selftest", nil, http.StatusInternalServerError)
+	if failures := resp["failures"].([]interface{}); len(failures) != 1 {
+		t.Errorf("self test with a wrong vector answered %v", resp)
+	}
+}
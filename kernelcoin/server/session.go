@@ -0,0 +1,166 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+)
+
+// defaultSessionIdleTimeout drops in-memory keys that have not been used recently
+const defaultSessionIdleTimeout = 15 * time.Minute
+
+type OpenSessionRequest struct {
+	Mnemonic   string `json:"mnemonic,omitempty"`
+	WIF        string `json:"wif,omitempty"`        // or a BIP38 key (6P...)
+	Passphrase string `json:"passphrase,omitempty"` // decrypts a BIP38 key
+}
+
+type OpenSessionResponse struct {
+	Success       bool   `json:"success"`
+	SessionID     string `json:"session_id,omitempty"`
+	LegacyAddress string `json:"legacy_address,omitempty"`
+	SegWitAddress string `json:"segwit_address,omitempty"`
+	ExpiresIn     int    `json:"expires_in,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type CloseSessionRequest struct {
+	SessionID string `json:"session_id"`
+}
+
+// newSessionID returns a random 128-bit session identifier
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// openSession keeps a wallet's keys in memory and returns its session
+func (ws *WalletServer) openSession(wallet *hdwallet.Wallet) (*WalletSession, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	now := time.Now()
+	session := &WalletSession{
+		ID:        id,
+		Wallet:    wallet,
+		CreatedAt: now,
+		LastUsed:  now,
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	// Drop idle sessions while we hold the lock
+	for sid, s := range ws.wallets {
+		if now.Sub(s.LastUsed) > ws.sessionIdleTimeout {
+			delete(ws.wallets, sid)
+		}
+	}
+	ws.wallets[id] = session
+	return session, nil
+}
+
+// getSession returns a live session and refreshes its idle timer
+func (ws *WalletServer) getSession(id string) (*WalletSession, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	session, ok := ws.wallets[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(session.LastUsed) > ws.sessionIdleTimeout {
+		delete(ws.wallets, id)
+		return nil, false
+	}
+	session.LastUsed = time.Now()
+	return session, true
+}
+
+// HandleOpenSession loads a mnemonic or WIF into server memory for local
+// signing. Nothing is imported into the node.
+func (ws *WalletServer) HandleOpenSession(w http.ResponseWriter, r *http.Request) {
+	var req OpenSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Mnemonic == "") == (req.WIF == "") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(OpenSessionResponse{
+			Success: false,
+			Error:   "Provide exactly one of mnemonic or wif",
+		})
+		return
+	}
+
+	var wallet *hdwallet.Wallet
+	var err error
+	if req.Mnemonic != "" {
+		wallet, err = hdwallet.GenerateWalletFromMnemonic(req.Mnemonic)
+	} else {
+		var wif string
+		if wif, err = hdwallet.DecryptKeyInput(strings.TrimSpace(req.WIF), req.Passphrase); err == nil {
+			wallet, err = hdwallet.WalletFromWIF(wif)
+		}
+	}
+	if err != nil {
+		logRequest(r, "[API] OpenSession ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(OpenSessionResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to load keys: %v", err),
+		})
+		return
+	}
+
+	session, err := ws.openSession(wallet)
+	if err != nil {
+		logRequest(r, "[API] OpenSession ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(OpenSessionResponse{
+			Success: false,
+			Error:   "Failed to open session",
+		})
+		return
+	}
+
+	logRequest(r, "[API] OpenSession SUCCESS: %s", wallet.LegacyAddress)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(OpenSessionResponse{
+		Success:       true,
+		SessionID:     session.ID,
+		LegacyAddress: wallet.LegacyAddress,
+		SegWitAddress: wallet.SegWitAddress,
+		ExpiresIn:     int(ws.sessionIdleTimeout.Seconds()),
+	})
+}
+
+// HandleCloseSession forgets a session's keys
+func (ws *WalletServer) HandleCloseSession(w http.ResponseWriter, r *http.Request) {
+	var req CloseSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Invalid request format"})
+		return
+	}
+
+	ws.mu.Lock()
+	delete(ws.wallets, req.SessionID)
+	ws.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment line, so
+// proxies don't close it
+const sseKeepAlive = 15 * time.Second
+
+// HandleEvents streams wallet events as Server-Sent Events, for clients that
+// can't use the /ws WebSocket. ?types=tx_received,block_connected limits the
+// stream to the named event types. Like /ws it carries only events about
+// the requester's wallet, or the node.
+func (ws *WalletServer) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Streaming not supported"})
+		return
+	}
+
+	var types map[string]bool
+	if t := r.URL.Query().Get("types"); t != "" {
+		types = map[string]bool{}
+		for _, name := range strings.Split(t, ",") {
+			types[strings.TrimSpace(name)] = true
+		}
+	}
+
+	events := ws.events.SubscribeFor(walletOwner(r))
+	defer ws.events.Unsubscribe(events)
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev := <-events:
+			if types != nil && !types[ev.Type] {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				logRequest(r, "[EVENTS] WARNING: cannot encode %s event: %v", ev.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-ws.events.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+// Store is the local SQLite database holding data the node does not keep
+// (fee history, user metadata, caches)
+type Store struct {
+	db *sql.DB
+}
+
+// storeMigrations are applied in order; the index+1 of the last applied
+// migration is tracked in PRAGMA user_version. Only ever append to this list.
+var storeMigrations = []string{
+	// 1: fee sampling history
+	`CREATE TABLE fee_samples (
+		sampled_at      INTEGER NOT NULL,
+		fee_rate_2      REAL,
+		fee_rate_6      REAL,
+		fee_rate_12     REAL,
+		mempool_tx      INTEGER NOT NULL,
+		mempool_bytes   INTEGER NOT NULL,
+		mempool_min_fee REAL NOT NULL
+	);
+	CREATE INDEX fee_samples_sampled_at ON fee_samples (sampled_at);`,
+
+	// 2: scheduler conditional send rules
+	`CREATE TABLE send_rules (
+		id         TEXT PRIMARY KEY,
+		request    TEXT NOT NULL,
+		condition  TEXT NOT NULL,
+		threshold  REAL NOT NULL,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		status     TEXT NOT NULL,
+		txid       TEXT NOT NULL DEFAULT '',
+		error      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX send_rules_status ON send_rules (status);`,
+
+	// 3: address book
+	`CREATE TABLE contacts (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		notes      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE contact_addresses (
+		address    TEXT PRIMARY KEY,
+		contact_id TEXT NOT NULL REFERENCES contacts (id)
+	);
+	CREATE INDEX contact_addresses_contact_id ON contact_addresses (contact_id);`,
+
+	// 4: confirmation watches on wallet transactions
+	`CREATE TABLE tx_watches (
+		txid        TEXT PRIMARY KEY,
+		webhook_url TEXT NOT NULL DEFAULT '',
+		notified    INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL
+	);`,
+
+	// 5: wallet transaction cache filled by the sync loop. A wallet entry is
+	// a txid, an output and a direction; category moves from immature to
+	// generate, so it isn't part of the key.
+	`CREATE TABLE wallet_transactions (
+		txid             TEXT NOT NULL,
+		vout             INTEGER NOT NULL,
+		sent             INTEGER NOT NULL,
+		category         TEXT NOT NULL,
+		address          TEXT NOT NULL DEFAULT '',
+		label            TEXT NOT NULL DEFAULT '',
+		amount           INTEGER NOT NULL,
+		fee              INTEGER NOT NULL DEFAULT 0,
+		confirmations    INTEGER NOT NULL,
+		synced_height    INTEGER NOT NULL,
+		time             INTEGER NOT NULL,
+		time_received    INTEGER NOT NULL,
+		comment          TEXT NOT NULL DEFAULT '',
+		comment_to       TEXT NOT NULL DEFAULT '',
+		abandoned        INTEGER NOT NULL DEFAULT 0,
+		wallet_conflicts TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (txid, vout, sent)
+	);
+	CREATE INDEX wallet_transactions_order ON wallet_transactions (time_received, txid, vout);
+	CREATE INDEX wallet_transactions_address ON wallet_transactions (address);`,
+
+	// 6: merchant checkouts and their callback delivery
+	`CREATE TABLE checkouts (
+		id                TEXT PRIMARY KEY,
+		order_id          TEXT NOT NULL,
+		address           TEXT NOT NULL,
+		amount            INTEGER NOT NULL,
+		fiat_amount       REAL NOT NULL DEFAULT 0,
+		fiat_currency     TEXT NOT NULL DEFAULT '',
+		confirmations     INTEGER NOT NULL,
+		callback_url      TEXT NOT NULL DEFAULT '',
+		status            TEXT NOT NULL,
+		received          INTEGER NOT NULL DEFAULT 0,
+		callback_status   TEXT NOT NULL DEFAULT '',
+		callback_attempts INTEGER NOT NULL DEFAULT 0,
+		next_callback_at  INTEGER NOT NULL DEFAULT 0,
+		created_at        INTEGER NOT NULL,
+		expires_at        INTEGER NOT NULL,
+		paid_at           INTEGER NOT NULL DEFAULT 0,
+		confirmed_at      INTEGER NOT NULL DEFAULT 0,
+		updated_at        INTEGER NOT NULL
+	);
+	CREATE INDEX checkouts_status ON checkouts (status, callback_status);
+	CREATE INDEX checkouts_order_id ON checkouts (order_id);`,
+
+	// 7: PSBTs waiting for an external signer
+	`CREATE TABLE signing_requests (
+		id             TEXT PRIMARY KEY,
+		label          TEXT NOT NULL DEFAULT '',
+		status         TEXT NOT NULL,
+		unsigned_txid  TEXT NOT NULL,
+		psbt           TEXT NOT NULL,
+		hex            TEXT NOT NULL DEFAULT '',
+		txid           TEXT NOT NULL DEFAULT '',
+		fee            INTEGER NOT NULL,
+		outputs        TEXT NOT NULL,
+		uploads        INTEGER NOT NULL DEFAULT 0,
+		created_at     INTEGER NOT NULL,
+		updated_at     INTEGER NOT NULL,
+		broadcast_at   INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX signing_requests_created ON signing_requests (created_at);`,
+
+	// 8: multisig addresses and their spends
+	`CREATE TABLE multisig_wallets (
+		id            TEXT PRIMARY KEY,
+		name          TEXT NOT NULL,
+		required      INTEGER NOT NULL,
+		pubkeys       TEXT NOT NULL,
+		address_type  TEXT NOT NULL,
+		address       TEXT NOT NULL,
+		redeem_script TEXT NOT NULL,
+		descriptor    TEXT NOT NULL DEFAULT '',
+		created_at    INTEGER NOT NULL
+	);
+	ALTER TABLE signing_requests ADD COLUMN multisig_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE signing_requests ADD COLUMN auto_broadcast INTEGER NOT NULL DEFAULT 0;`,
+
+	// 9: user metadata on wallet transactions
+	`CREATE TABLE transaction_metadata (
+		txid       TEXT PRIMARY KEY,
+		label      TEXT NOT NULL DEFAULT '',
+		category   TEXT NOT NULL DEFAULT '',
+		notes      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE transaction_tags (
+		txid TEXT NOT NULL REFERENCES transaction_metadata (txid),
+		tag  TEXT NOT NULL,
+		PRIMARY KEY (txid, tag)
+	);
+	CREATE INDEX transaction_tags_tag ON transaction_tags (tag);`,
+
+	// 10: notification center; read state is per user
+	`CREATE TABLE notifications (
+		id         TEXT PRIMARY KEY,
+		kind       TEXT NOT NULL,
+		title      TEXT NOT NULL,
+		message    TEXT NOT NULL,
+		txid       TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX notifications_created_at ON notifications (created_at);
+	CREATE UNIQUE INDEX notifications_kind_txid ON notifications (kind, txid) WHERE txid != '';
+	CREATE TABLE notification_reads (
+		notification_id TEXT NOT NULL REFERENCES notifications (id),
+		user            TEXT NOT NULL,
+		read_at         INTEGER NOT NULL,
+		PRIMARY KEY (notification_id, user)
+	);`,
+
+	// 11: multi-user accounts and the sends their quotas count
+	`CREATE TABLE users (
+		username         TEXT PRIMARY KEY,
+		wallet           TEXT NOT NULL UNIQUE,
+		password_hash    TEXT NOT NULL DEFAULT '',
+		oidc_subject     TEXT NOT NULL DEFAULT '',
+		daily_send_limit INTEGER,
+		disabled         INTEGER NOT NULL DEFAULT 0,
+		created_at       INTEGER NOT NULL,
+		updated_at       INTEGER NOT NULL
+	);
+	CREATE UNIQUE INDEX users_oidc_subject ON users (oidc_subject) WHERE oidc_subject != '';
+	CREATE TABLE user_sends (
+		username TEXT NOT NULL REFERENCES users (username),
+		txid     TEXT NOT NULL,
+		amount   INTEGER NOT NULL,
+		sent_at  INTEGER NOT NULL
+	);
+	CREATE INDEX user_sends_username ON user_sends (username, sent_at);`,
+
+	// 12: multi-user data kept apart by owner, the username or '' for the
+	// admin. Tables keyed by address or txid are rebuilt with the owner
+	// in the key, since two users' wallets can share a transaction.
+	`ALTER TABLE contacts ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	CREATE INDEX contacts_owner ON contacts (owner);
+	ALTER TABLE contact_addresses RENAME TO contact_addresses_old;
+	CREATE TABLE contact_addresses (
+		owner      TEXT NOT NULL DEFAULT '',
+		address    TEXT NOT NULL,
+		contact_id TEXT NOT NULL REFERENCES contacts (id),
+		PRIMARY KEY (owner, address)
+	);
+	INSERT INTO contact_addresses (address, contact_id) SELECT address, contact_id FROM contact_addresses_old;
+	DROP TABLE contact_addresses_old;
+	CREATE INDEX contact_addresses_contact_id ON contact_addresses (contact_id);
+
+	ALTER TABLE transaction_tags RENAME TO transaction_tags_old;
+	ALTER TABLE transaction_metadata RENAME TO transaction_metadata_old;
+	CREATE TABLE transaction_metadata (
+		owner      TEXT NOT NULL DEFAULT '',
+		txid       TEXT NOT NULL,
+		label      TEXT NOT NULL DEFAULT '',
+		category   TEXT NOT NULL DEFAULT '',
+		notes      TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		PRIMARY KEY (owner, txid)
+	);
+	CREATE TABLE transaction_tags (
+		owner TEXT NOT NULL DEFAULT '',
+		txid  TEXT NOT NULL,
+		tag   TEXT NOT NULL,
+		PRIMARY KEY (owner, txid, tag),
+		FOREIGN KEY (owner, txid) REFERENCES transaction_metadata (owner, txid)
+	);
+	INSERT INTO transaction_metadata (txid, label, category, notes, created_at, updated_at)
+		SELECT txid, label, category, notes, created_at, updated_at FROM transaction_metadata_old;
+	INSERT INTO transaction_tags (txid, tag) SELECT txid, tag FROM transaction_tags_old;
+	DROP TABLE transaction_tags_old;
+	DROP TABLE transaction_metadata_old;
+	CREATE INDEX transaction_tags_tag ON transaction_tags (owner, tag);
+
+	ALTER TABLE tx_watches RENAME TO tx_watches_old;
+	CREATE TABLE tx_watches (
+		owner       TEXT NOT NULL DEFAULT '',
+		txid        TEXT NOT NULL,
+		webhook_url TEXT NOT NULL DEFAULT '',
+		notified    INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL,
+		PRIMARY KEY (owner, txid)
+	);
+	INSERT INTO tx_watches (txid, webhook_url, notified, created_at, updated_at)
+		SELECT txid, webhook_url, notified, created_at, updated_at FROM tx_watches_old;
+	DROP TABLE tx_watches_old;
+
+	ALTER TABLE notifications ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	DROP INDEX notifications_kind_txid;
+	CREATE UNIQUE INDEX notifications_kind_txid ON notifications (owner, kind, txid) WHERE txid != '';
+
+	ALTER TABLE send_rules ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	ALTER TABLE checkouts ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+	CREATE INDEX checkouts_owner ON checkouts (owner, created_at);`,
+}
+
+// OpenStore opens (or creates) the database at path and brings its schema up to date
+func OpenStore(path string) (*Store, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	// SQLite serialises writers anyway; a single connection avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	store := &Store{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies any migrations newer than the database's user_version
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(storeMigrations); i++ {
+		log.Printf("[STORE] Applying migration %d", i+1)
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(storeMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// newRecordID returns a random identifier for store records
+func newRecordID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Reset deletes every row from every table, keeping the schema
+func (s *Store) Reset() error {
+	rows, err := s.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+	tables := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if _, err := s.db.Exec(fmt.Sprintf("DELETE FROM %q", table)); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
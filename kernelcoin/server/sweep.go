@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+type SweepRequest struct {
+	WIF        string `json:"wif"`                  // or a BIP38 key (6P...)
+	Passphrase string `json:"passphrase,omitempty"` // decrypts a BIP38 key
+	// ToAddress defaults to a new address of the node wallet
+	ToAddress string `json:"to_address,omitempty"`
+	FeeRate   int64  `json:"fee_rate,omitempty"` // sat/vB, estimated when zero
+	// Preview builds and signs the transaction but doesn't broadcast it
+	Preview bool `json:"preview,omitempty"`
+}
+
+type SweepResponse struct {
+	Success   bool       `json:"success"`
+	Txid      string     `json:"txid,omitempty"`
+	ToAddress string     `json:"to_address,omitempty"`
+	Amount    rpc.Amount `json:"amount,omitempty"` // what arrives, after the fee
+	Fee       rpc.Amount `json:"fee,omitempty"`
+	FeeRate   int64      `json:"fee_rate,omitempty"`
+	Inputs    int        `json:"inputs,omitempty"`
+	Broadcast bool       `json:"broadcast"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// HandleSweep moves everything held by an outside private key into the
+// wallet. The key is only used to sign in memory, never imported, so the
+// node wallet doesn't keep rescanning for a one-off paper wallet.
+func (ws *WalletServer) HandleSweep(w http.ResponseWriter, r *http.Request) {
+	var req SweepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logRequest(r, "[API] Sweep ERROR: Invalid request - %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SweepResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	wifStr, err := hdwallet.DecryptKeyInput(strings.TrimSpace(req.WIF), req.Passphrase)
+	var wallet *hdwallet.Wallet
+	var wif *btcutil.WIF
+	if err == nil {
+		wallet, err = hdwallet.WalletFromWIF(wifStr)
+	}
+	if err == nil {
+		wif, err = btcutil.DecodeWIF(wallet.PrivateKeyWIF)
+	}
+	if err != nil {
+		logRequest(r, "[API] Sweep ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SweepResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to load key: %v", err),
+		})
+		return
+	}
+
+	backend := ws.backend(r)
+	utxos, err := backend.UTXOs([]string{wallet.LegacyAddress, wallet.SegWitAddress})
+	if err != nil {
+		logRequest(r, "[API] Sweep ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(SweepResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to find spendable outputs: %v", err),
+		})
+		return
+	}
+	if len(utxos) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SweepResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Nothing to sweep: %s has no confirmed outputs", wallet.LegacyAddress),
+		})
+		return
+	}
+
+	toAddress := req.ToAddress
+	if toAddress == "" {
+		if ws.electrum != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(SweepResponse{
+				Success: false,
+				Error:   "to_address is required without a node wallet",
+			})
+			return
+		}
+		if toAddress, err = ws.rpc(r).GetNewAddress("", "bech32"); err != nil {
+			logRequest(r, "[API] Sweep ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(SweepResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to get a wallet address: %v", err),
+			})
+			return
+		}
+	}
+
+	feeRate := req.FeeRate
+	if feeRate <= 0 {
+		feeRate = estimateFeeRate(backend)
+	}
+
+	built, err := hdwallet.BuildSweepTransaction(wif.PrivKey, wif.CompressPubKey, utxos, toAddress, feeRate)
+	if err != nil {
+		logRequest(r, "[API] Sweep ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SweepResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to build transaction: %v", err),
+		})
+		return
+	}
+
+	response := SweepResponse{
+		Success:   true,
+		Txid:      built.Tx.TxHash().String(),
+		ToAddress: toAddress,
+		Amount:    rpc.Amount(built.Tx.TxOut[0].Value),
+		Fee:       rpc.Amount(built.Fee),
+		FeeRate:   feeRate,
+		Inputs:    len(built.Tx.TxIn),
+	}
+	if req.Preview {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rawHex, err := hdwallet.SerializeTx(built.Tx)
+	if err == nil {
+		_, err = backend.Broadcast(rawHex)
+	}
+	if err != nil {
+		logRequest(r, "[API] Sweep ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(SweepResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to broadcast transaction: %v", err),
+		})
+		return
+	}
+
+	response.Broadcast = true
+	logRequest(r, "[API] Sweep SUCCESS: txid=%s amount=%s to %s", response.Txid, response.Amount, toAddress)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// telegramPollTimeout is how long one getUpdates call waits for messages
+	telegramPollTimeout = 50 * time.Second
+	// telegramRetryDelay is the pause after a failed getUpdates
+	telegramRetryDelay = 10 * time.Second
+	// telegramMaxLastTx caps /lasttx N
+	telegramMaxLastTx = 10
+)
+
+// telegramBot talks to the Telegram Bot API for one chat. Messages from
+// other chats are ignored: the bot's commands show the wallet's balance.
+type telegramBot struct {
+	baseURL string // API URL with the bot token, never logged
+	chatID  int64
+	client  *http.Client
+}
+
+func newTelegramBot(c TelegramConfig) (*telegramBot, error) {
+	chatID, err := strconv.ParseInt(c.ChatID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid telegram chat id %q", c.ChatID)
+	}
+	return &telegramBot{
+		baseURL: strings.TrimRight(c.APIURL, "/") + "/bot" + c.BotToken,
+		chatID:  chatID,
+		client:  &http.Client{Timeout: telegramPollTimeout + 10*time.Second},
+	}, nil
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// call invokes a Bot API method. Transport errors are unwrapped from their
+// URL, which contains the token.
+func (b *telegramBot) call(method string, params interface{}, out interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.baseURL+"/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram %s: %s", method, resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram %s: %s", method, result.Description)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
+
+// Send posts a plain-text message to the chat
+func (b *telegramBot) Send(text string) error {
+	return b.call("sendMessage", map[string]interface{}{
+		"chat_id":                  b.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// updates long-polls for messages after offset
+func (b *telegramBot) updates(offset int64) ([]telegramUpdate, error) {
+	var updates []telegramUpdate
+	err := b.call("getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(telegramPollTimeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// RunTelegramBot pushes wallet transactions and confirmations to the chat
+// and answers its /balance and /lasttx commands
+func (ws *WalletServer) RunTelegramBot(bot *telegramBot) {
+	log.Printf("[TELEGRAM] Notifying chat %d", bot.chatID)
+	go ws.runTelegramNotifier(bot)
+
+	var offset int64
+	for {
+		updates, err := bot.updates(offset)
+		if err != nil {
+			log.Printf("[TELEGRAM] WARNING: getUpdates failed: %v", err)
+			time.Sleep(telegramRetryDelay)
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil {
+				continue
+			}
+			if u.Message.Chat.ID != bot.chatID {
+				log.Printf("[TELEGRAM] WARNING: ignoring a message from chat %d", u.Message.Chat.ID)
+				continue
+			}
+			if reply := ws.telegramCommand(u.Message.Text); reply != "" {
+				if err := bot.Send(reply); err != nil {
+					log.Printf("[TELEGRAM] WARNING: reply failed: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// runTelegramNotifier sends new transactions of the default wallet and
+// their first confirmation to the chat
+func (ws *WalletServer) runTelegramNotifier(bot *telegramBot) {
+	events := ws.events.SubscribeFor("")
+	defer ws.events.Unsubscribe(events)
+
+	for {
+		var ev WalletEvent
+		select {
+		case ev = <-events:
+		case <-ws.events.Done():
+			return
+		}
+
+		tx, ok := ev.Data.(TransactionResponse)
+		if !ok || (ev.Type != EventTransaction && ev.Type != EventTxConfirmed) {
+			continue
+		}
+		named := []TransactionResponse{tx}
+		ws.resolveContacts("", named)
+
+		text := ws.telegramTransaction(named[0])
+		if ev.Type == EventTxConfirmed {
+			text = "Confirmed: " + text
+		}
+		if err := bot.Send(text); err != nil {
+			log.Printf("[TELEGRAM] WARNING: notification failed: %v", err)
+		}
+	}
+}
+
+// telegramCommand answers a chat message; unknown text gets the help
+func (ws *WalletServer) telegramCommand(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	// In groups commands arrive as /balance@SomeBot
+	command, _, _ := strings.Cut(fields[0], "@")
+
+	switch command {
+	case "/balance":
+		return ws.telegramBalance()
+	case "/lasttx":
+		count := 1
+		if len(fields) > 1 {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+				count = min(n, telegramMaxLastTx)
+			}
+		}
+		return ws.telegramLastTransactions(count)
+	default:
+		return "Commands:\n/balance - wallet balance\n/lasttx [N] - the last N transactions (default 1)"
+	}
+}
+
+func (ws *WalletServer) telegramBalance() string {
+	info, err := ws.rpcClient.GetBalanceInfo("")
+	if err != nil {
+		log.Printf("[TELEGRAM] WARNING: balance failed: %v", err)
+		return "Could not get the balance: the node is unavailable"
+	}
+	balance := balanceResponse(info)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Balance: %s KCN%s", balance.Total, ws.telegramFiat(balance.Total))
+	if balance.Unconfirmed != 0 {
+		fmt.Fprintf(&b, "\nUnconfirmed: %s KCN", balance.Unconfirmed)
+	}
+	if balance.Immature != 0 {
+		fmt.Fprintf(&b, "\nImmature: %s KCN", balance.Immature)
+	}
+	return b.String()
+}
+
+func (ws *WalletServer) telegramLastTransactions(count int) string {
+	transactions, _, _, err := ws.transactionPage(ws.rpcClient, PageParams{Count: count, Page: 1})
+	if err != nil {
+		log.Printf("[TELEGRAM] WARNING: transactions failed: %v", err)
+		return "Could not get transactions: the node is unavailable"
+	}
+	if len(transactions) == 0 {
+		return "No transactions yet"
+	}
+	ws.resolveContacts("", transactions)
+
+	// Newest first
+	lines := make([]string, 0, len(transactions))
+	for i := len(transactions) - 1; i >= 0; i-- {
+		lines = append(lines, ws.telegramTransaction(transactions[i]))
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+// telegramTransaction describes a wallet transaction in a few lines
+func (ws *WalletServer) telegramTransaction(tx TransactionResponse) string {
+	counterparty := tx.Address
+	if tx.Contact != "" {
+		counterparty = fmt.Sprintf("%s (%s)", tx.Contact, tx.Address)
+	}
+
+	var b strings.Builder
+	switch tx.Category {
+	case "receive":
+		fmt.Fprintf(&b, "Received %s KCN%s at %s", tx.Amount, ws.telegramFiat(tx.Amount), counterparty)
+	case "send":
+		fmt.Fprintf(&b, "Sent %s KCN%s to %s", tx.Amount.Abs(), ws.telegramFiat(tx.Amount.Abs()), counterparty)
+		if tx.Fee != 0 {
+			fmt.Fprintf(&b, ", fee %s KCN", tx.Fee.Abs())
+		}
+	default:
+		fmt.Fprintf(&b, "%s %s KCN at %s", tx.Category, tx.Amount, counterparty)
+	}
+	fmt.Fprintf(&b, "\n%d confirmations\n%s", tx.Confirmations, tx.Txid)
+	return b.String()
+}
+
+// telegramFiat is " (≈ 1.23 USD)" at the current price, or "" without one
+func (ws *WalletServer) telegramFiat(amount rpc.Amount) string {
+	prices := ws.prices.Load()
+	if prices == nil {
+		return ""
+	}
+	quote, err := prices.Quote("")
+	if err != nil {
+		return ""
+	}
+	value := quote.Value(amount)
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (≈ %.2f %s)", value.Value, value.Currency)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	// Zone names resolve on hosts and containers without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// timeZone is where the RFC 3339 times in responses are written, and where
+// dates and zoneless times in filters are read; see setTimeZone
+var timeZone = time.UTC
+
+// setTimeZone sets timeZone from an IANA name such as Europe/Berlin, or
+// UTC or Local
+func setTimeZone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q", name)
+	}
+	timeZone = loc
+	return nil
+}
+
+// formatTime writes unix seconds as RFC 3339 in timeZone, or "" for 0,
+// which the node reports for times it doesn't know
+func formatTime(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).In(timeZone).Format(time.RFC3339)
+}
+
+// Layouts parseTimeParam reads in timeZone, as they carry no offset
+const (
+	localDateTime = "2006-01-02T15:04:05"
+	localDate     = time.DateOnly
+)
+
+// parseTimeParam accepts unix seconds, an RFC 3339 timestamp, or a date or
+// a time without offset, read in timeZone. A bare date is its first
+// second, or with endOfDay its last, so to_time=2024-03-31 takes in the
+// whole day.
+func parseTimeParam(v string, endOfDay bool) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.ParseInLocation(localDateTime, v, timeZone); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.ParseInLocation(localDate, v, timeZone)
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither unix seconds, RFC 3339 nor a YYYY-MM-DD date", v)
+	}
+	if endOfDay {
+		return t.AddDate(0, 0, 1).Unix() - 1, nil
+	}
+	return t.Unix(), nil
+}
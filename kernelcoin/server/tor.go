@@ -0,0 +1,241 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// torRetryDelay is the pause before reconnecting to the control port
+	torRetryDelay = 30 * time.Second
+	// torDialTimeout bounds connecting to the control port
+	torDialTimeout = 10 * time.Second
+)
+
+// torControl is an authenticated connection to Tor's control port
+type torControl struct {
+	conn *textproto.Conn
+}
+
+// command sends line and returns the 250 reply's text, one line per
+// "250-" line
+func (c *torControl) command(line string) (string, error) {
+	id, err := c.conn.Cmd("%s", line)
+	if err != nil {
+		return "", err
+	}
+	c.conn.StartResponse(id)
+	defer c.conn.EndResponse(id)
+	_, msg, err := c.conn.ReadResponse(250)
+	if err != nil {
+		// Don't echo passwords or keys back into the log
+		verb, _, _ := strings.Cut(line, " ")
+		return "", fmt.Errorf("tor %s: %w", verb, err)
+	}
+	return msg, nil
+}
+
+// dialTorControl connects to the control port and authenticates with the
+// best method Tor offers: the password when one is configured, else
+// SAFECOOKIE, COOKIE or none
+func dialTorControl(cfg TorConfig) (*torControl, error) {
+	conn, err := net.DialTimeout("tcp", cfg.ControlAddr, torDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach the tor control port %s: %w", cfg.ControlAddr, err)
+	}
+	c := &torControl{conn: textproto.NewConn(conn)}
+
+	info, err := c.command("PROTOCOLINFO 1")
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	methods, cookieFile := parseProtocolInfo(info)
+
+	switch {
+	case cfg.ControlPassword != "" && methods["HASHEDPASSWORD"]:
+		_, err = c.command("AUTHENTICATE " + strconv.Quote(cfg.ControlPassword))
+	case methods["SAFECOOKIE"]:
+		err = c.authenticateSafeCookie(cookieFile)
+	case methods["COOKIE"]:
+		var cookie []byte
+		if cookie, err = os.ReadFile(cookieFile); err == nil {
+			_, err = c.command("AUTHENTICATE " + hex.EncodeToString(cookie))
+		}
+	case methods["NULL"]:
+		_, err = c.command("AUTHENTICATE")
+	case methods["HASHEDPASSWORD"]:
+		err = errors.New("tor wants a control password (set TOR_CONTROL_PASSWORD)")
+	default:
+		err = fmt.Errorf("no supported tor authentication method in %q", info)
+	}
+	if err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("tor control authentication failed: %w", err)
+	}
+	return c, nil
+}
+
+// parseProtocolInfo returns the auth methods and cookie file from a
+// PROTOCOLINFO reply like
+//
+//	AUTH METHODS=COOKIE,SAFECOOKIE COOKIEFILE="/run/tor/control.authcookie"
+func parseProtocolInfo(info string) (map[string]bool, string) {
+	methods := map[string]bool{}
+	cookieFile := ""
+	for _, line := range strings.Split(info, "\n") {
+		rest, ok := strings.CutPrefix(line, "AUTH ")
+		if !ok {
+			continue
+		}
+		if list, ok := strings.CutPrefix(rest, "METHODS="); ok {
+			list, _, _ = strings.Cut(list, " ")
+			for _, m := range strings.Split(list, ",") {
+				methods[m] = true
+			}
+		}
+		if _, quoted, ok := strings.Cut(rest, "COOKIEFILE="); ok {
+			if path, err := strconv.Unquote(quoted); err == nil {
+				cookieFile = path
+			}
+		}
+	}
+	return methods, cookieFile
+}
+
+// authenticateSafeCookie proves knowledge of the cookie without sending it,
+// and checks Tor knows it too
+func (c *torControl) authenticateSafeCookie(cookieFile string) error {
+	cookie, err := os.ReadFile(cookieFile)
+	if err != nil {
+		return err
+	}
+	clientNonce := make([]byte, 32)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return err
+	}
+
+	reply, err := c.command("AUTHCHALLENGE SAFECOOKIE " + hex.EncodeToString(clientNonce))
+	if err != nil {
+		return err
+	}
+	var serverHash, serverNonce []byte
+	for _, field := range strings.Fields(reply) {
+		if v, ok := strings.CutPrefix(field, "SERVERHASH="); ok {
+			serverHash, _ = hex.DecodeString(v)
+		}
+		if v, ok := strings.CutPrefix(field, "SERVERNONCE="); ok {
+			serverNonce, _ = hex.DecodeString(v)
+		}
+	}
+
+	mac := func(key string) []byte {
+		h := hmac.New(sha256.New, []byte(key))
+		h.Write(cookie)
+		h.Write(clientNonce)
+		h.Write(serverNonce)
+		return h.Sum(nil)
+	}
+	if serverNonce == nil || !hmac.Equal(serverHash, mac("Tor safe cookie authentication server-to-controller hash")) {
+		return errors.New("tor's SAFECOOKIE reply doesn't match the cookie file")
+	}
+	_, err = c.command("AUTHENTICATE " + hex.EncodeToString(mac("Tor safe cookie authentication controller-to-server hash")))
+	return err
+}
+
+// onionTarget is where Tor forwards onion connections: the listen address,
+// with a wildcard host replaced by loopback
+func onionTarget(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return listen
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// publishOnion adds the onion service, creating its key on first use and
+// keeping it in cfg.KeyFile so the address stays the same across restarts.
+// Tor removes the service when the control connection closes.
+func publishOnion(c *torControl, cfg TorConfig, target string) (string, error) {
+	key := "NEW:ED25519-V3"
+	saved, err := os.ReadFile(cfg.KeyFile)
+	switch {
+	case err == nil:
+		key = strings.TrimSpace(string(saved))
+	case !os.IsNotExist(err):
+		return "", fmt.Errorf("cannot read onion key: %w", err)
+	}
+
+	reply, err := c.command(fmt.Sprintf("ADD_ONION %s Port=%d,%s", key, cfg.Port, target))
+	if err != nil {
+		return "", err
+	}
+	var serviceID, privateKey string
+	for _, line := range strings.Split(reply, "\n") {
+		if v, ok := strings.CutPrefix(line, "ServiceID="); ok {
+			serviceID = v
+		}
+		if v, ok := strings.CutPrefix(line, "PrivateKey="); ok {
+			privateKey = v
+		}
+	}
+	if serviceID == "" {
+		return "", fmt.Errorf("tor ADD_ONION returned no service id")
+	}
+
+	if privateKey != "" {
+		if err := os.WriteFile(cfg.KeyFile, []byte(privateKey+"\n"), 0600); err != nil {
+			return "", fmt.Errorf("cannot save onion key (the address will change on restart): %w", err)
+		}
+		log.Printf("[TOR] Created a new onion key in %s", cfg.KeyFile)
+	}
+	return serviceID + ".onion", nil
+}
+
+// RunOnionService publishes the wallet as a v3 onion service through Tor's
+// control port and keeps it published, reconnecting when Tor restarts
+func RunOnionService(cfg TorConfig, listen string) {
+	target := onionTarget(listen)
+	for {
+		err := func() error {
+			c, err := dialTorControl(cfg)
+			if err != nil {
+				return err
+			}
+			defer c.conn.Close()
+
+			onion, err := publishOnion(c, cfg, target)
+			if err != nil {
+				return err
+			}
+			url := "http://" + onion
+			if cfg.Port != 80 {
+				url += ":" + strconv.Itoa(cfg.Port)
+			}
+			log.Printf("[TOR] Wallet published at %s%s/", url, basePath)
+
+			// The service lives as long as this connection
+			for {
+				if _, err := c.conn.ReadLine(); err != nil {
+					return fmt.Errorf("tor control connection closed: %w", err)
+				}
+			}
+		}()
+		log.Printf("[TOR] WARNING: %v; retrying in %s", err, torRetryDelay)
+		time.Sleep(torRetryDelay)
+	}
+}
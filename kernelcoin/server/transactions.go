@@ -0,0 +1,278 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// transactionScanBatch is the listtransactions page size used when
+	// filtering server-side
+	transactionScanBatch = 1000
+
+	// maxTransactionScan bounds how many wallet entries one filtered query reads
+	maxTransactionScan = 100000
+)
+
+// transactionCategories are the listtransactions categories a filter may name
+var transactionCategories = map[string]bool{
+	"send": true, "receive": true, "generate": true, "immature": true, "orphan": true,
+}
+
+// TransactionFilter narrows a transaction listing. Zero fields match anything.
+type TransactionFilter struct {
+	Categories map[string]bool
+	Address    string
+	FromTime   int64 // unix seconds, inclusive
+	ToTime     int64 // unix seconds, inclusive
+	MinAmount  rpc.Amount
+}
+
+// parseTransactionFilter reads category (comma separated), address,
+// from_time, to_time and min_amount from the query string
+func parseTransactionFilter(r *http.Request) (TransactionFilter, error) {
+	return transactionFilterFromValues(r.URL.Query())
+}
+
+// transactionFilterFromValues is parseTransactionFilter over any set of
+// parameters
+func transactionFilterFromValues(q url.Values) (TransactionFilter, error) {
+	f := TransactionFilter{Address: q.Get("address")}
+
+	if c := q.Get("category"); c != "" {
+		f.Categories = map[string]bool{}
+		for _, cat := range strings.Split(c, ",") {
+			cat = strings.TrimSpace(cat)
+			if !transactionCategories[cat] {
+				return f, fmt.Errorf("unknown category %q", cat)
+			}
+			f.Categories[cat] = true
+		}
+	}
+
+	var err error
+	if f.FromTime, err = parseTimeParam(q.Get("from_time"), false); err != nil {
+		return f, fmt.Errorf("invalid from_time: %w", err)
+	}
+	if f.ToTime, err = parseTimeParam(q.Get("to_time"), true); err != nil {
+		return f, fmt.Errorf("invalid to_time: %w", err)
+	}
+
+	if m := q.Get("min_amount"); m != "" {
+		if f.MinAmount, err = rpc.ParseAmount(m); err != nil || f.MinAmount < 0 {
+			return f, fmt.Errorf("invalid min_amount %q", m)
+		}
+	}
+	return f, nil
+}
+
+// Active reports whether the filter excludes anything
+func (f TransactionFilter) Active() bool {
+	return f.Categories != nil || f.Address != "" || f.FromTime != 0 || f.ToTime != 0 || f.MinAmount != 0
+}
+
+// Matches reports whether tx passes the filter. min_amount compares the
+// absolute value, so it applies to sends (negative amounts) too.
+func (f TransactionFilter) Matches(tx TransactionResponse) bool {
+	if f.Categories != nil && !f.Categories[tx.Category] {
+		return false
+	}
+	if f.Address != "" && tx.Address != f.Address {
+		return false
+	}
+	if f.FromTime != 0 && tx.Time < f.FromTime {
+		return false
+	}
+	if f.ToTime != 0 && tx.Time > f.ToTime {
+		return false
+	}
+	amount := tx.Amount
+	if amount < 0 {
+		amount = -amount
+	}
+	return amount >= f.MinAmount
+}
+
+// setDirections fills in each entry's Net and Direction. Sending to one
+// of the wallet's own addresses lists a send and a receive to the same
+// address; when both are in transactions, both are self.
+func setDirections(transactions []TransactionResponse) {
+	received := map[string]bool{}
+	for _, tx := range transactions {
+		if tx.Category == "receive" {
+			received[tx.Txid+"/"+tx.Address] = true
+		}
+	}
+	sentToSelf := map[string]bool{}
+	for _, tx := range transactions {
+		if tx.Category == "send" && received[tx.Txid+"/"+tx.Address] {
+			sentToSelf[tx.Txid+"/"+tx.Address] = true
+		}
+	}
+
+	for i := range transactions {
+		tx := &transactions[i]
+		tx.Net = tx.Amount + tx.Fee
+		switch {
+		case sentToSelf[tx.Txid+"/"+tx.Address]:
+			tx.Direction = "self"
+		case tx.Category == "send":
+			tx.Direction = "outgoing"
+		default:
+			tx.Direction = "incoming"
+		}
+	}
+}
+
+// filteredTransactions returns one page of entries matching filter (oldest
+// first, like listtransactions) together with the total number of matches.
+// It reads the transaction cache when synced, and otherwise scans the wallet
+// newest first.
+func (ws *WalletServer) filteredTransactions(client rpc.WalletBackend, filter TransactionFilter, page PageParams) ([]TransactionResponse, int, error) {
+	if ws.txSync.Ready() {
+		return ws.cachedTransactions(filter, page)
+	}
+
+	matches := []TransactionResponse{}
+	for skip := 0; skip < maxTransactionScan; skip += transactionScanBatch {
+		batch, err := client.ListTransactions("", transactionScanBatch, skip)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Batches are oldest first; walk each backwards to keep newest first
+		for i := len(batch) - 1; i >= 0; i-- {
+			if txMap, ok := batch[i].(map[string]interface{}); ok {
+				if tx := transactionFromRPC(txMap); filter.Matches(tx) {
+					matches = append(matches, tx)
+				}
+			}
+		}
+		if len(batch) < transactionScanBatch {
+			break
+		}
+	}
+
+	total := len(matches)
+	start := min(page.Skip, total)
+	end := min(page.Skip+page.Count, total)
+	window := matches[start:end]
+
+	result := make([]TransactionResponse, 0, len(window))
+	for i := len(window) - 1; i >= 0; i-- {
+		result = append(result, window[i])
+	}
+	return result, total, nil
+}
+
+// streamTransactions calls fn for every entry matching filter, oldest first,
+// reading the wallet transactionScanBatch entries at a time so the whole
+// history is never held in memory. Reading stops at the first error.
+func (ws *WalletServer) streamTransactions(client rpc.WalletBackend, filter TransactionFilter, fn func(batch []TransactionResponse) error) error {
+	var total int
+	var fetch func(skip, count int) ([]TransactionResponse, error)
+
+	if ws.txSync.Ready() {
+		var err error
+		if _, total, err = ws.cachedTransactions(filter, PageParams{}); err != nil {
+			return err
+		}
+		tip := ws.txSync.tip.Load()
+		fetch = func(skip, count int) ([]TransactionResponse, error) {
+			txs, _, err := ws.store.WalletTransactions(filter, PageParams{Count: count, Skip: skip}, tip)
+			return txs, err
+		}
+	} else {
+		var err error
+		if total, err = ws.countWalletEntries(client); err != nil {
+			return err
+		}
+		fetch = func(skip, count int) ([]TransactionResponse, error) {
+			batch, err := client.ListTransactions("", count, skip)
+			if err != nil {
+				return nil, err
+			}
+			txs := []TransactionResponse{}
+			for _, entry := range batch {
+				if txMap, ok := entry.(map[string]interface{}); ok {
+					if tx := transactionFromRPC(txMap); filter.Matches(tx) {
+						txs = append(txs, tx)
+					}
+				}
+			}
+			return txs, nil
+		}
+	}
+
+	// Windows are counted from the newest entry, so walk them from the far
+	// end. Entries arriving meanwhile shift the windows towards older ones;
+	// anything already sent from the previous window is skipped.
+	previous := map[string]bool{}
+	for remaining := min(total, maxTransactionScan); remaining > 0; {
+		count := min(transactionScanBatch, remaining)
+		remaining -= count
+
+		txs, err := fetch(remaining, count)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]bool, len(txs))
+		fresh := txs[:0]
+		for _, tx := range txs {
+			key := fmt.Sprintf("%s:%d:%s", tx.Txid, tx.Vout, tx.Category)
+			current[key] = true
+			if !previous[key] {
+				fresh = append(fresh, tx)
+			}
+		}
+		previous = current
+
+		if len(fresh) > 0 {
+			if err := fn(fresh); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// countWalletEntries finds how many listtransactions entries the wallet
+// has by probing single entries, which is far cheaper than reading them all
+func (ws *WalletServer) countWalletEntries(client rpc.WalletBackend) (int, error) {
+	exists := func(i int) (bool, error) {
+		batch, err := client.ListTransactions("", 1, i)
+		return len(batch) > 0, err
+	}
+
+	// Double until an index is missing, then bisect between the last two
+	// probes
+	lo, hi := 0, 0
+	for hi < maxTransactionScan {
+		ok, err := exists(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi+1, 2*hi+1
+	}
+	hi = min(hi, maxTransactionScan)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type TransactionActionResponse struct {
+	Success bool   `json:"success"`
+	Txid    string `json:"txid,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// withTxid hands serve the {txid} segment of the
+// /api/transaction/{txid}/... routes, answering 404 if it isn't a txid
+func withTxid(serve func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txid := pathParam(r, "txid")
+		if len(txid) != 64 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(TransactionActionResponse{
+				Success: false,
+				Error:   "Not found",
+			})
+			return
+		}
+		serve(w, r, txid)
+	}
+}
+
+func (ws *WalletServer) serveAbandonTransaction(w http.ResponseWriter, r *http.Request, txid string) {
+	if err := ws.rpc(r).AbandonTransaction(txid); err != nil {
+		logRequest(r, "[API] AbandonTransaction ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TransactionActionResponse{
+			Success: false,
+			Txid:    txid,
+			Error:   fmt.Sprintf("Failed to abandon transaction (it must be unconfirmed and not in the mempool): %v", err),
+		})
+		return
+	}
+
+	logRequest(r, "[API] AbandonTransaction SUCCESS: %s", txid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TransactionActionResponse{
+		Success: true,
+		Txid:    txid,
+	})
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits on transaction metadata, so it fits in listings
+const (
+	maxTxLabel    = 100
+	maxTxCategory = 50
+	maxTxNotes    = 2000
+	maxTxTags     = 20
+	maxTxTag      = 32
+)
+
+// TxMetadata is what the user recorded about a wallet transaction: the
+// node has nowhere to keep it
+type TxMetadata struct {
+	Txid      string   `json:"txid"`
+	Label     string   `json:"label,omitempty"`
+	Category  string   `json:"category,omitempty"` // the user's, e.g. "rent"; not the node's send/receive
+	Notes     string   `json:"notes,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// TxMetadataRequest changes the fields it has and leaves the others
+type TxMetadataRequest struct {
+	Label    *string   `json:"label"`
+	Category *string   `json:"category"`
+	Notes    *string   `json:"notes"`
+	Tags     *[]string `json:"tags"` // replaces the tags
+}
+
+type TxMetadataResponse struct {
+	Success  bool        `json:"success"`
+	Metadata *TxMetadata `json:"metadata,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// TransactionMetadata returns owner's metadata of the given transactions by
+// txid; transactions without any are left out
+func (s *Store) TransactionMetadata(owner string, txids []string) (map[string]*TxMetadata, error) {
+	if len(txids) == 0 {
+		return map[string]*TxMetadata{}, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(txids)), ", ")
+	args := []interface{}{owner}
+	for _, txid := range txids {
+		args = append(args, txid)
+	}
+	return s.transactionMetadata(" AND txid IN ("+placeholders+")", args...)
+}
+
+// AllTransactionMetadata returns the metadata of every transaction of
+// owner's by txid
+func (s *Store) AllTransactionMetadata(owner string) (map[string]*TxMetadata, error) {
+	return s.transactionMetadata("", owner)
+}
+
+// transactionMetadata loads the metadata and tags of the owner's
+// transactions matching an extra condition on txid. The owner is the
+// first of args.
+func (s *Store) transactionMetadata(and string, args ...interface{}) (map[string]*TxMetadata, error) {
+	where := " WHERE owner = ?" + and
+	found := map[string]*TxMetadata{}
+	rows, err := s.db.Query(`SELECT txid, label, category, notes, created_at, updated_at
+		FROM transaction_metadata`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var m TxMetadata
+		if err := rows.Scan(&m.Txid, &m.Label, &m.Category, &m.Notes, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found[m.Txid] = &m
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT txid, tag FROM transaction_tags`+where+` ORDER BY tag`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var txid, tag string
+		if err := rows.Scan(&txid, &tag); err != nil {
+			return nil, err
+		}
+		if m := found[txid]; m != nil {
+			m.Tags = append(m.Tags, tag)
+		}
+	}
+	return found, rows.Err()
+}
+
+// SaveTransactionMetadata inserts or replaces owner's m and its tags
+func (s *Store) SaveTransactionMetadata(owner string, m TxMetadata) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO transaction_metadata (owner, txid, label, category, notes, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, txid) DO UPDATE SET label = excluded.label, category = excluded.category,
+			notes = excluded.notes, updated_at = excluded.updated_at`,
+		owner, m.Txid, m.Label, m.Category, m.Notes, m.CreatedAt, m.UpdatedAt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM transaction_tags WHERE owner = ? AND txid = ?`, owner, m.Txid); err != nil {
+		return err
+	}
+	for _, tag := range m.Tags {
+		if _, err := tx.Exec(`INSERT INTO transaction_tags (owner, txid, tag) VALUES (?, ?, ?)`, owner, m.Txid, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTransactionMetadata removes owner's metadata and tags of txid
+func (s *Store) DeleteTransactionMetadata(owner, txid string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM transaction_tags WHERE owner = ? AND txid = ?`, owner, txid); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM transaction_metadata WHERE owner = ? AND txid = ?`, owner, txid); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// normalizeTags lowercases, trims and deduplicates tags, sorted
+func normalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTxTag || strings.ContainsAny(tag, ",\n\t") {
+			return nil, fmt.Errorf("Tags may be at most %d characters, without commas", maxTxTag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTxTags {
+		return nil, fmt.Errorf("At most %d tags per transaction", maxTxTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// apply validates req and changes m accordingly
+func (req TxMetadataRequest) apply(m *TxMetadata) error {
+	if req.Label != nil {
+		m.Label = strings.TrimSpace(*req.Label)
+	}
+	if req.Category != nil {
+		m.Category = strings.ToLower(strings.TrimSpace(*req.Category))
+	}
+	if req.Notes != nil {
+		m.Notes = strings.TrimSpace(*req.Notes)
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			return err
+		}
+		m.Tags = tags
+	}
+
+	switch {
+	case len(m.Label) > maxTxLabel:
+		return fmt.Errorf("Label may be at most %d characters", maxTxLabel)
+	case len(m.Category) > maxTxCategory:
+		return fmt.Errorf("Category may be at most %d characters", maxTxCategory)
+	case len(m.Notes) > maxTxNotes:
+		return fmt.Errorf("Notes may be at most %d characters", maxTxNotes)
+	}
+	return nil
+}
+
+// resolveMetadata attaches owner's metadata to transactions that have
+// some
+func (ws *WalletServer) resolveMetadata(owner string, transactions []TransactionResponse) {
+	txids := make([]string, 0, len(transactions))
+	for _, tx := range transactions {
+		txids = append(txids, tx.Txid)
+	}
+	metadata, err := ws.store.TransactionMetadata(owner, txids)
+	if err != nil {
+		log.Printf("[API] WARNING: Could not load transaction metadata: %v", err)
+		return
+	}
+	for i := range transactions {
+		transactions[i].Metadata = metadata[transactions[i].Txid]
+	}
+}
+
+// serveTransactionMetadata serves /api/transaction/{txid}/metadata: GET,
+// PATCH (change the fields given) and DELETE of the requester's metadata
+func (ws *WalletServer) serveTransactionMetadata(w http.ResponseWriter, r *http.Request, txid string) {
+	owner := walletOwner(r)
+	found, err := ws.store.TransactionMetadata(owner, []string{txid})
+	if err != nil {
+		logRequest(r, "[API] TransactionMetadata ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TxMetadataResponse{
+			Success: false,
+			Error:   "Failed to load metadata",
+		})
+		return
+	}
+	metadata := found[txid]
+
+	switch r.Method {
+	case http.MethodGet:
+		if metadata == nil {
+			metadata = &TxMetadata{Txid: txid}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TxMetadataResponse{Success: true, Metadata: metadata})
+		return
+
+	case http.MethodDelete:
+		if err := ws.store.DeleteTransactionMetadata(owner, txid); err != nil {
+			logRequest(r, "[API] TransactionMetadata ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(TxMetadataResponse{
+				Success: false,
+				Error:   "Failed to delete metadata",
+			})
+			return
+		}
+		ws.metadataChanges.Add(1)
+		logRequest(r, "[API] TransactionMetadata SUCCESS: cleared %s", txid)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TxMetadataResponse{Success: true})
+		return
+
+	case http.MethodPatch:
+	}
+
+	var req TxMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TxMetadataResponse{
+			Success: false,
+			Error:   "Invalid request format",
+		})
+		return
+	}
+
+	if metadata == nil {
+		if _, err := ws.rpc(r).GetTransaction(txid); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(TxMetadataResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Not a wallet transaction: %v", err),
+			})
+			return
+		}
+		metadata = &TxMetadata{Txid: txid, CreatedAt: time.Now().Unix()}
+	}
+
+	if err := req.apply(metadata); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TxMetadataResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	metadata.UpdatedAt = time.Now().Unix()
+
+	if err := ws.store.SaveTransactionMetadata(owner, *metadata); err != nil {
+		logRequest(r, "[API] TransactionMetadata ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TxMetadataResponse{
+			Success: false,
+			Error:   "Failed to save metadata",
+		})
+		return
+	}
+	ws.metadataChanges.Add(1)
+
+	logRequest(r, "[API] TransactionMetadata SUCCESS: %s (%d tags)", txid, len(metadata.Tags))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TxMetadataResponse{Success: true, Metadata: metadata})
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// TagCount is how many transactions carry a tag or category
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type TagsResponse struct {
+	Success    bool       `json:"success"`
+	Tags       []TagCount `json:"tags"`
+	Categories []TagCount `json:"categories"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ReportRow sums the transactions of one tag or category in one month
+type ReportRow struct {
+	Month    string     `json:"month,omitempty"` // YYYY-MM in UTC; empty in totals
+	Key      string     `json:"key"`             // the tag or category
+	Received rpc.Amount `json:"received"`
+	Sent     rpc.Amount `json:"sent"` // fees included
+	Net      rpc.Amount `json:"net"`
+	Count    int        `json:"count"` // transactions
+}
+
+type ReportResponse struct {
+	Success bool        `json:"success"`
+	Group   string      `json:"group,omitempty"`
+	Rows    []ReportRow `json:"rows"`   // by month, then key
+	Totals  []ReportRow `json:"totals"` // by key, over all months
+	Error   string      `json:"error,omitempty"`
+}
+
+// TagCounts counts owner's transactions of each tag and of each category,
+// most used first
+func (s *Store) TagCounts(owner string) ([]TagCount, []TagCount, error) {
+	var lists [2][]TagCount
+	for i, query := range []string{
+		`SELECT tag, COUNT(*) FROM transaction_tags WHERE owner = ? GROUP BY tag ORDER BY COUNT(*) DESC, tag`,
+		`SELECT category, COUNT(*) FROM transaction_metadata WHERE owner = ? AND category != ''
+			GROUP BY category ORDER BY COUNT(*) DESC, category`,
+	} {
+		rows, err := s.db.Query(query, owner)
+		if err != nil {
+			return nil, nil, err
+		}
+		lists[i] = []TagCount{}
+		for rows.Next() {
+			var c TagCount
+			if err := rows.Scan(&c.Name, &c.Count); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			lists[i] = append(lists[i], c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return lists[0], lists[1], nil
+}
+
+// HandleTags lists the tags and categories the requester uses, with their
+// counts
+func (ws *WalletServer) HandleTags(w http.ResponseWriter, r *http.Request) {
+	tags, categories, err := ws.store.TagCounts(walletOwner(r))
+	if err != nil {
+		logRequest(r, "[API] Tags ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TagsResponse{
+			Success: false,
+			Error:   "Failed to load tags",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagsResponse{
+		Success:    true,
+		Tags:       tags,
+		Categories: categories,
+	})
+}
+
+// HandleTagReport sums tagged transactions per month: ?group=tag (the
+// default) or category, narrowed by from_time and to_time. A transaction
+// counts by what it did to the balance, and under each of its tags.
+// ?format=csv downloads the monthly rows.
+func (ws *WalletServer) HandleTagReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	group := q.Get("group")
+	if group == "" {
+		group = "tag"
+	}
+	format := q.Get("format")
+	var err error
+	if group != "tag" && group != "category" {
+		err = fmt.Errorf("group must be tag or category")
+	} else if format != "" && format != "json" && format != "csv" {
+		err = fmt.Errorf("Unknown format %q (use json or csv)", format)
+	}
+	var from, to int64
+	if err == nil {
+		if from, err = parseTimeParam(q.Get("from_time"), false); err != nil {
+			err = fmt.Errorf("invalid from_time: %w", err)
+		}
+	}
+	if err == nil {
+		if to, err = parseTimeParam(q.Get("to_time"), true); err != nil {
+			err = fmt.Errorf("invalid to_time: %w", err)
+		}
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ReportResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	metadata, err := ws.store.AllTransactionMetadata(walletOwner(r))
+	if err != nil {
+		logRequest(r, "[API] TagReport ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ReportResponse{
+			Success: false,
+			Error:   "Failed to load transaction metadata",
+		})
+		return
+	}
+
+	// What each tagged transaction did to the balance, and when
+	type txNet struct {
+		net  rpc.Amount
+		time int64
+	}
+	nets := map[string]*txNet{}
+	feeCounted := map[string]bool{}
+	filter := TransactionFilter{FromTime: from, ToTime: to}
+	err = ws.streamTransactions(ws.rpc(r), filter, func(batch []TransactionResponse) error {
+		for _, tx := range batch {
+			if metadata[tx.Txid] == nil {
+				continue
+			}
+			n := nets[tx.Txid]
+			if n == nil {
+				n = &txNet{time: tx.Time}
+				nets[tx.Txid] = n
+			}
+			n.net += balanceDelta(tx, feeCounted)
+		}
+		return nil
+	})
+	if err != nil {
+		logRequest(r, "[API] TagReport ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ReportResponse{
+			Success: false,
+			Error:   "Failed to list transactions",
+		})
+		return
+	}
+
+	type rowKey struct{ month, key string }
+	rows := map[rowKey]*ReportRow{}
+	totals := map[string]*ReportRow{}
+	add := func(row *ReportRow, net rpc.Amount) {
+		if net > 0 {
+			row.Received += net
+		} else {
+			row.Sent -= net
+		}
+		row.Net += net
+		row.Count++
+	}
+	for txid, n := range nets {
+		keys := metadata[txid].Tags
+		if group == "category" {
+			keys = nil
+			if category := metadata[txid].Category; category != "" {
+				keys = []string{category}
+			}
+		}
+		month := time.Unix(n.time, 0).UTC().Format("2006-01")
+		for _, key := range keys {
+			row := rows[rowKey{month, key}]
+			if row == nil {
+				row = &ReportRow{Month: month, Key: key}
+				rows[rowKey{month, key}] = row
+			}
+			add(row, n.net)
+			total := totals[key]
+			if total == nil {
+				total = &ReportRow{Key: key}
+				totals[key] = total
+			}
+			add(total, n.net)
+		}
+	}
+
+	response := ReportResponse{Success: true, Group: group, Rows: []ReportRow{}, Totals: []ReportRow{}}
+	for _, row := range rows {
+		response.Rows = append(response.Rows, *row)
+	}
+	sort.Slice(response.Rows, func(i, j int) bool {
+		a, b := response.Rows[i], response.Rows[j]
+		return a.Month < b.Month || (a.Month == b.Month && a.Key < b.Key)
+	})
+	for _, total := range totals {
+		response.Totals = append(response.Totals, *total)
+	}
+	sort.Slice(response.Totals, func(i, j int) bool { return response.Totals[i].Key < response.Totals[j].Key })
+
+	logRequest(r, "[API] TagReport SUCCESS: %d rows by %s over %d transactions", len(response.Rows), group, len(nets))
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="kernelcoin-%s-report.csv"`, group))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"month", group, "received", "sent", "net", "count"})
+		for _, row := range response.Rows {
+			cw.Write([]string{row.Month, row.Key, row.Received.String(), row.Sent.String(), row.Net.String(), fmt.Sprint(row.Count)})
+		}
+		cw.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+const (
+	// txSyncBatch is the listtransactions page size of an incremental sync
+	txSyncBatch = 100
+
+	// txSyncSettledDepth is the depth after which a cached entry is no
+	// longer re-read; its confirmations are counted forward from the tip
+	txSyncSettledDepth = 6
+
+	// maxTxSyncRefresh bounds the unsettled entries re-read per sync
+	maxTxSyncRefresh = 100
+)
+
+// txSyncState tracks the local transaction cache. Listings are served from
+// the store once the first sync has completed.
+type txSyncState struct {
+	mu      sync.Mutex // serializes syncs
+	ready   atomic.Bool
+	tip     atomic.Int64 // chain height at the last sync
+	changes atomic.Int64 // rpc WalletChanges at the last sync
+}
+
+func newTxSyncState() *txSyncState {
+	return &txSyncState{}
+}
+
+// Ready reports whether listings can be served from the store. It is false
+// on a nil state, which is how TX_SYNC_INTERVAL=0 disables the cache.
+func (s *txSyncState) Ready() bool {
+	return s != nil && s.ready.Load()
+}
+
+const walletTransactionColumns = `txid, vout, category, address, label, amount, fee, confirmations,
+	synced_height, time, time_received, comment, comment_to, abandoned, wallet_conflicts`
+
+// SaveWalletTransactions upserts listtransactions entries seen at height
+func (s *Store) SaveWalletTransactions(txs []TransactionResponse, height int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO wallet_transactions (` + walletTransactionColumns + `, sent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (txid, vout, sent) DO UPDATE SET
+			category = excluded.category, address = excluded.address, label = excluded.label,
+			amount = excluded.amount, fee = excluded.fee, confirmations = excluded.confirmations,
+			synced_height = excluded.synced_height, time = excluded.time, time_received = excluded.time_received,
+			comment = excluded.comment, comment_to = excluded.comment_to, abandoned = excluded.abandoned,
+			wallet_conflicts = excluded.wallet_conflicts`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range txs {
+		if _, err := stmt.Exec(t.Txid, t.Vout, t.Category, t.Address, t.Account, int64(t.Amount), int64(t.Fee),
+			t.Confirmations, height, t.Time, t.TimeReceived, t.Comment, t.CommentTo, t.Abandoned,
+			strings.Join(t.WalletConflicts, ","), t.Category == "send"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// walletTransactionsSettled reports whether every entry is already stored
+// and deep enough (or abandoned) that it will not change
+func (s *Store) walletTransactionsSettled(txs []TransactionResponse) (bool, error) {
+	for _, t := range txs {
+		if !t.Abandoned && t.Confirmations < txSyncSettledDepth && t.Confirmations > -txSyncSettledDepth {
+			return false, nil
+		}
+	}
+	for _, t := range txs {
+		var one int
+		err := s.db.QueryRow(`SELECT 1 FROM wallet_transactions WHERE txid = ? AND vout = ? AND sent = ?`,
+			t.Txid, t.Vout, t.Category == "send").Scan(&one)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// unsettledTxids returns stored transactions not read at height that were
+// still shallower than txSyncSettledDepth
+func (s *Store) unsettledTxids(height int64) ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT txid FROM wallet_transactions
+		WHERE abandoned = 0 AND synced_height < ?
+			AND (confirmations = 0 OR ABS(confirmations) + ? - synced_height < ?)
+		LIMIT ?`, height, height, txSyncSettledDepth, maxTxSyncRefresh)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txids := []string{}
+	for rows.Next() {
+		var txid string
+		if err := rows.Scan(&txid); err != nil {
+			return nil, err
+		}
+		txids = append(txids, txid)
+	}
+	return txids, rows.Err()
+}
+
+// walletTransactionConfirmations returns txid's stored confirmations,
+// brought forward to height, and whether it is stored at all
+func (s *Store) walletTransactionConfirmations(txid string, height int64) (int, bool, error) {
+	var confirmations int
+	var syncedHeight int64
+	err := s.db.QueryRow(`SELECT confirmations, synced_height FROM wallet_transactions WHERE txid = ? LIMIT 1`, txid).
+		Scan(&confirmations, &syncedHeight)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if confirmations > 0 {
+		confirmations += int(height - syncedHeight)
+	}
+	return confirmations, true, nil
+}
+
+// noteStoredConfirmations reports entries that are unconfirmed or
+// conflicted now against what the store had for them
+func (ws *WalletServer) noteStoredConfirmations(txs []TransactionResponse, height int64) error {
+	for _, tx := range txs {
+		if tx.Confirmations > 0 {
+			continue
+		}
+		before, stored, err := ws.store.walletTransactionConfirmations(tx.Txid, height)
+		if err != nil {
+			return err
+		}
+		if stored {
+			ws.noteConfirmations("", tx, before)
+		}
+	}
+	return nil
+}
+
+// setWalletTransactionConfirmations updates every entry of txid
+func (s *Store) setWalletTransactionConfirmations(txid string, confirmations int, height int64) error {
+	_, err := s.db.Exec(`UPDATE wallet_transactions SET confirmations = ?, synced_height = ? WHERE txid = ?`,
+		confirmations, height, txid)
+	return err
+}
+
+// WalletTransactions returns one page of cached entries matching filter
+// (oldest first, like listtransactions) and the total number of matches.
+// Confirmations are brought forward to tip.
+func (s *Store) WalletTransactions(filter TransactionFilter, page PageParams, tip int64) ([]TransactionResponse, int, error) {
+	where := []string{}
+	args := []interface{}{}
+	if filter.Categories != nil {
+		placeholders := []string{}
+		for category := range filter.Categories {
+			placeholders = append(placeholders, "?")
+			args = append(args, category)
+		}
+		where = append(where, "category IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.Address != "" {
+		where = append(where, "address = ?")
+		args = append(args, filter.Address)
+	}
+	if filter.FromTime != 0 {
+		where = append(where, "time >= ?")
+		args = append(args, filter.FromTime)
+	}
+	if filter.ToTime != 0 {
+		where = append(where, "time <= ?")
+		args = append(args, filter.ToTime)
+	}
+	if filter.MinAmount != 0 {
+		where = append(where, "ABS(amount) >= ?")
+		args = append(args, int64(filter.MinAmount))
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM wallet_transactions`+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(`SELECT `+walletTransactionColumns+` FROM wallet_transactions`+clause+`
+		ORDER BY time_received DESC, txid DESC, vout DESC LIMIT ? OFFSET ?`,
+		append(args, page.Count, page.Skip)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	newestFirst := []TransactionResponse{}
+	for rows.Next() {
+		var t TransactionResponse
+		var amount, fee, syncedHeight int64
+		var conflicts string
+		if err := rows.Scan(&t.Txid, &t.Vout, &t.Category, &t.Address, &t.Account, &amount, &fee, &t.Confirmations,
+			&syncedHeight, &t.Time, &t.TimeReceived, &t.Comment, &t.CommentTo, &t.Abandoned, &conflicts); err != nil {
+			return nil, 0, err
+		}
+		t.Amount, t.Fee = rpc.Amount(amount), rpc.Amount(fee)
+		t.TimeISO, t.TimeReceivedISO = formatTime(t.Time), formatTime(t.TimeReceived)
+		if conflicts != "" {
+			t.WalletConflicts = strings.Split(conflicts, ",")
+		}
+		// Negative counts (conflicts) grow away from zero too
+		if t.Confirmations > 0 {
+			t.Confirmations += int(tip - syncedHeight)
+		} else if t.Confirmations < 0 {
+			t.Confirmations -= int(tip - syncedHeight)
+		}
+		t.Conflicted = t.Confirmations < 0
+		newestFirst = append(newestFirst, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]TransactionResponse, 0, len(newestFirst))
+	for i := len(newestFirst) - 1; i >= 0; i-- {
+		result = append(result, newestFirst[i])
+	}
+	return result, total, nil
+}
+
+// syncTransactions pulls wallet entries newest first into the store until it
+// reaches a page that is already stored and settled, then re-reads older
+// entries that were still unconfirmed
+func (ws *WalletServer) syncTransactions() error {
+	s := ws.txSync
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changes := ws.rpcClient.WalletChanges()
+	height, _, err := ws.rpcClient.GetBestBlock()
+	if err != nil {
+		return err
+	}
+
+	// The first sync of a run may have a whole wallet to read
+	batchSize := txSyncBatch
+	if !s.ready.Load() {
+		batchSize = transactionScanBatch
+	}
+
+	fetched := 0
+	for skip := 0; skip < maxTransactionScan; skip += batchSize {
+		batch, err := ws.rpcClient.ListTransactions("", batchSize, skip)
+		if err != nil {
+			return err
+		}
+		txs := make([]TransactionResponse, 0, len(batch))
+		for _, entry := range batch {
+			if txMap, ok := entry.(map[string]interface{}); ok {
+				txs = append(txs, transactionFromRPC(txMap))
+			}
+		}
+
+		settled, err := ws.store.walletTransactionsSettled(txs)
+		if err != nil {
+			return err
+		}
+		if err := ws.noteStoredConfirmations(txs, height); err != nil {
+			return err
+		}
+		if err := ws.store.SaveWalletTransactions(txs, height); err != nil {
+			return err
+		}
+		fetched += len(txs)
+		if settled || len(batch) < batchSize {
+			break
+		}
+	}
+
+	txids, err := ws.store.unsettledTxids(height)
+	if err != nil {
+		return err
+	}
+	for _, txid := range txids {
+		tx, err := ws.rpcClient.GetTransaction(txid)
+		if err != nil {
+			log.Printf("[SYNC] WARNING: refreshing %s failed: %v", txid, err)
+			continue
+		}
+		refreshed := TransactionResponse{
+			Txid:          txid,
+			Amount:        rpc.GetAmount(tx, "amount"),
+			Fee:           rpc.GetAmount(tx, "fee"),
+			Confirmations: rpc.GetInt(tx, "confirmations"),
+			Time:          rpc.GetInt64(tx, "time"),
+		}
+		refreshed.Abandoned, _ = tx["abandoned"].(bool)
+		refreshed.Conflicted = refreshed.Confirmations < 0
+		if err := ws.noteStoredConfirmations([]TransactionResponse{refreshed}, height); err != nil {
+			return err
+		}
+		if err := ws.store.setWalletTransactionConfirmations(txid, refreshed.Confirmations, height); err != nil {
+			return err
+		}
+	}
+
+	s.tip.Store(height)
+	s.changes.Store(changes)
+	if !s.ready.Swap(true) {
+		log.Printf("[SYNC] Transaction cache ready at height %d", height)
+	}
+	log.Printf("[SYNC] Synced %d entries, refreshed %d unconfirmed transactions", fetched, len(txids))
+	return nil
+}
+
+// cachedTransactions serves a listing from the store, first catching up if
+// this server has changed the wallet since the last sync
+func (ws *WalletServer) cachedTransactions(filter TransactionFilter, page PageParams) ([]TransactionResponse, int, error) {
+	if ws.rpcClient.WalletChanges() != ws.txSync.changes.Load() {
+		if err := ws.syncTransactions(); err != nil {
+			log.Printf("[SYNC] WARNING: catching up failed: %v", err)
+		}
+	}
+	return ws.store.WalletTransactions(filter, page, ws.txSync.tip.Load())
+}
+
+// RunTransactionSync keeps the transaction cache up to date, syncing at once
+// and then every interval
+func (ws *WalletServer) RunTransactionSync(interval time.Duration) {
+	if err := ws.syncTransactions(); err != nil {
+		log.Printf("[SYNC] WARNING: transaction sync failed: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ws.syncTransactions(); err != nil {
+			log.Printf("[SYNC] WARNING: transaction sync failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// EventTxConfirmations fires when a watched transaction reaches one of
+// txWatchMilestones, or is conflicted
+const EventTxConfirmations = "tx_confirmations"
+
+// txWatchMilestones are the confirmation counts a watch reports; the watch
+// ends after the last one
+var txWatchMilestones = []int{1, 3, 6}
+
+// webhookClient delivers watch notifications
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// TxWatch follows a wallet transaction's confirmations. Notified is the last
+// milestone reported, so restarts don't repeat notifications.
+type TxWatch struct {
+	Owner      string `json:"-"` // whose wallet the transaction is in
+	Txid       string `json:"txid"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	Notified   int    `json:"notified"`
+	CreatedAt  int64  `json:"created_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+// TxConfirmationsEvent is the data of a tx_confirmations event
+type TxConfirmationsEvent struct {
+	Txid          string `json:"txid"`
+	Confirmations int    `json:"confirmations"`
+	Milestone     int    `json:"milestone,omitempty"`
+	Conflicted    bool   `json:"conflicted,omitempty"`
+}
+
+type TxWatchRequest struct {
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+type TxWatchResponse struct {
+	Success bool     `json:"success"`
+	Watch   *TxWatch `json:"watch,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// SaveTxWatch stores a watch, replacing any existing one of its owner for
+// the txid
+func (s *Store) SaveTxWatch(watch TxWatch) error {
+	_, err := s.db.Exec(`INSERT INTO tx_watches (owner, txid, webhook_url, notified, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, txid) DO UPDATE SET webhook_url = excluded.webhook_url, updated_at = excluded.updated_at`,
+		watch.Owner, watch.Txid, watch.WebhookURL, watch.Notified, watch.CreatedAt, watch.UpdatedAt)
+	return err
+}
+
+// TxWatches returns every owner's active watches
+func (s *Store) TxWatches() ([]TxWatch, error) {
+	rows, err := s.db.Query(`SELECT owner, txid, webhook_url, notified, created_at, updated_at FROM tx_watches ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watches := []TxWatch{}
+	for rows.Next() {
+		var watch TxWatch
+		if err := rows.Scan(&watch.Owner, &watch.Txid, &watch.WebhookURL, &watch.Notified, &watch.CreatedAt, &watch.UpdatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, watch)
+	}
+	return watches, rows.Err()
+}
+
+// TxWatch returns owner's watch for txid, or nil if there is none
+func (s *Store) TxWatch(owner, txid string) (*TxWatch, error) {
+	var watch TxWatch
+	err := s.db.QueryRow(`SELECT owner, txid, webhook_url, notified, created_at, updated_at FROM tx_watches
+		WHERE owner = ? AND txid = ?`, owner, txid).
+		Scan(&watch.Owner, &watch.Txid, &watch.WebhookURL, &watch.Notified, &watch.CreatedAt, &watch.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &watch, err
+}
+
+// SetTxWatchNotified records the last milestone reported for owner's
+// watch on txid
+func (s *Store) SetTxWatchNotified(owner, txid string, milestone int) error {
+	_, err := s.db.Exec(`UPDATE tx_watches SET notified = ?, updated_at = ? WHERE owner = ? AND txid = ?`,
+		milestone, time.Now().Unix(), owner, txid)
+	return err
+}
+
+// DeleteTxWatch removes owner's watch for txid
+func (s *Store) DeleteTxWatch(owner, txid string) error {
+	_, err := s.db.Exec(`DELETE FROM tx_watches WHERE owner = ? AND txid = ?`, owner, txid)
+	return err
+}
+
+// postWebhook delivers ev to url as JSON. Delivery is best effort: failures
+// are logged and not retried.
+func postWebhook(url string, ev WalletEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[EVENTS] WARNING: webhook %s failed: %v", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[EVENTS] WARNING: webhook %s returned %s", url, resp.Status)
+	}
+}
+
+// notifyTxWatch publishes a tx_confirmations event to the watch's owner
+// and calls its webhook, if any
+func (ws *WalletServer) notifyTxWatch(watch TxWatch, data TxConfirmationsEvent) {
+	ws.events.PublishFor(watch.Owner, EventTxConfirmations, data)
+	if watch.WebhookURL != "" {
+		go postWebhook(watch.WebhookURL, WalletEvent{Type: EventTxConfirmations, Time: time.Now().Unix(), Data: data})
+	}
+}
+
+// checkTxWatches reports milestones reached by watched transactions and
+// drops watches that are finished or conflicted
+func (ws *WalletServer) checkTxWatches() {
+	watches, err := ws.store.TxWatches()
+	if err != nil {
+		log.Printf("[EVENTS] WARNING: loading transaction watches failed: %v", err)
+		return
+	}
+
+	for _, watch := range watches {
+		client, _, err := ws.ownerWallet(watch.Owner)
+		if err != nil {
+			log.Printf("[EVENTS] WARNING: cannot check %s: %v", watch.Txid, err)
+			continue
+		}
+		tx, err := client.GetTransaction(watch.Txid)
+		if err != nil {
+			log.Printf("[EVENTS] WARNING: checking %s failed: %v", watch.Txid, err)
+			continue
+		}
+		confirmations := rpc.GetInt(tx, "confirmations")
+
+		if confirmations < 0 {
+			ws.notifyTxWatch(watch, TxConfirmationsEvent{Txid: watch.Txid, Confirmations: confirmations, Conflicted: true})
+			ws.store.DeleteTxWatch(watch.Owner, watch.Txid)
+			continue
+		}
+
+		for _, milestone := range txWatchMilestones {
+			if milestone <= watch.Notified || confirmations < milestone {
+				continue
+			}
+			ws.notifyTxWatch(watch, TxConfirmationsEvent{Txid: watch.Txid, Confirmations: confirmations, Milestone: milestone})
+			watch.Notified = milestone
+		}
+
+		if watch.Notified >= txWatchMilestones[len(txWatchMilestones)-1] {
+			ws.store.DeleteTxWatch(watch.Owner, watch.Txid)
+		} else if err := ws.store.SetTxWatchNotified(watch.Owner, watch.Txid, watch.Notified); err != nil {
+			log.Printf("[EVENTS] WARNING: saving watch on %s failed: %v", watch.Txid, err)
+		}
+	}
+}
+
+// RunTxWatcher checks watched transactions every interval. Unlike the
+// wallet watcher it runs without subscribers, since webhooks need no client.
+func (ws *WalletServer) RunTxWatcher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ws.checkTxWatches()
+	}
+}
+
+// serveTransactionWatch serves /api/transaction/{txid}/watch: POST starts
+// watching (optionally with a webhook_url), GET shows the watch and DELETE
+// stops it. Each user has their own watches.
+func (ws *WalletServer) serveTransactionWatch(w http.ResponseWriter, r *http.Request, txid string) {
+	owner := walletOwner(r)
+	switch r.Method {
+	case http.MethodGet:
+		watch, err := ws.store.TxWatch(owner, txid)
+		if err != nil || watch == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(TxWatchResponse{
+				Success: false,
+				Error:   "Transaction is not watched",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TxWatchResponse{Success: true, Watch: watch})
+		return
+
+	case http.MethodDelete:
+		if err := ws.store.DeleteTxWatch(owner, txid); err != nil {
+			logRequest(r, "[API] TransactionWatch ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(TxWatchResponse{
+				Success: false,
+				Error:   "Failed to remove watch",
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(TxWatchResponse{Success: true})
+		return
+
+	case http.MethodPost:
+	}
+
+	var req TxWatchRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TxWatchResponse{
+				Success: false,
+				Error:   "Invalid request format",
+			})
+			return
+		}
+	}
+	if req.WebhookURL != "" {
+		u, err := url.Parse(req.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TxWatchResponse{
+				Success: false,
+				Error:   "webhook_url must be an http or https URL",
+			})
+			return
+		}
+	}
+
+	if _, err := ws.rpc(r).GetTransaction(txid); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(TxWatchResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Not a wallet transaction: %v", err),
+		})
+		return
+	}
+
+	now := time.Now().Unix()
+	watch := TxWatch{Owner: owner, Txid: txid, WebhookURL: req.WebhookURL, CreatedAt: now, UpdatedAt: now}
+	if err := ws.store.SaveTxWatch(watch); err != nil {
+		logRequest(r, "[API] TransactionWatch ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(TxWatchResponse{
+			Success: false,
+			Error:   "Failed to save watch",
+		})
+		return
+	}
+
+	// An existing watch keeps its progress
+	if saved, err := ws.store.TxWatch(owner, txid); err == nil && saved != nil {
+		watch = *saved
+	}
+
+	logRequest(r, "[API] TransactionWatch SUCCESS: watching %s", txid)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TxWatchResponse{Success: true, Watch: &watch})
+}
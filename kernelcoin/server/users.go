@@ -0,0 +1,709 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+// In multi-user mode every registered user has a node wallet of their own,
+// reached through the node's multiwallet endpoint, and the API works on it:
+// ws.rpc(r) returns a client for the wallet of the user making r. The
+// admin (the auth user, or an OIDC admin) works on the default wallet as
+// before and manages the users under /api/admin/users.
+
+// sendLimitWindow is the period a daily send limit covers
+const sendLimitWindow = 24 * time.Hour
+
+// usernamePattern is what usernames may look like; they become part of
+// node wallet names
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,31}$`)
+
+// errSendLimit is returned for a send that would take a user past their
+// daily send limit
+var errSendLimit = errors.New("daily send limit reached")
+
+// nodeWidePaths are the API paths that work on the node itself or its
+// default wallet: user management, backups and rescans, signing requests,
+// multisig and key export. In multi-user mode only the admin may use them.
+// Entries ending in / cover everything under them. Everything else a
+// user reaches is their own: store data is kept apart by walletOwner and
+// events by WalletEvent.Owner.
+var nodeWidePaths = []string{
+	"/api/admin/",
+	"/api/wallet/backup",
+	"/api/wallet/restore",
+	"/api/wallet/rescan",
+	"/api/wallet/jobs",
+	"/api/wallet/jobs/",
+	"/api/psbt/requests",
+	"/api/psbt/requests/",
+	"/api/multisig",
+	"/api/multisig/",
+	"/api/export-key",
+	"/api/dev/",
+}
+
+// isNodeWide reports whether path is one of nodeWidePaths
+func isNodeWide(path string) bool {
+	for _, p := range nodeWidePaths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WalletUser is a registered user of a multi-user server
+type WalletUser struct {
+	Username    string `json:"username"`
+	Wallet      string `json:"wallet"` // the user's node wallet
+	OIDCSubject string `json:"oidc_subject,omitempty"`
+	// DailySendLimit caps what the user may send in any 24 hours; nil for
+	// no limit
+	DailySendLimit *rpc.Amount `json:"daily_send_limit"`
+	Disabled       bool        `json:"disabled"`
+	CreatedAt      int64       `json:"created_at"`
+	UpdatedAt      int64       `json:"updated_at"`
+	// SentLast24h is what the user sent in the last 24 hours; filled in
+	// for responses
+	SentLast24h rpc.Amount `json:"sent_last_24h"`
+
+	passwordHash string
+}
+
+type UserRequest struct {
+	Username       string      `json:"username"`           // POST only
+	Password       string      `json:"password,omitempty"` // PUT keeps the old one when empty
+	OIDCSubject    string      `json:"oidc_subject,omitempty"`
+	DailySendLimit *rpc.Amount `json:"daily_send_limit,omitempty"` // KCN; absent for no limit
+	Disabled       bool        `json:"disabled,omitempty"`
+	// AdoptWallet lets a POST take over a node wallet of the user's name,
+	// such as one left behind by a deleted user. POST only.
+	AdoptWallet bool `json:"adopt_wallet,omitempty"`
+}
+
+type UserResponse struct {
+	Success bool        `json:"success"`
+	User    *WalletUser `json:"user,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type UsersListResponse struct {
+	Success bool         `json:"success"`
+	Users   []WalletUser `json:"users,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type AccountResponse struct {
+	Success bool        `json:"success"`
+	Admin   bool        `json:"admin"`
+	User    *WalletUser `json:"user,omitempty"` // nil for the admin
+}
+
+const userColumns = `username, wallet, password_hash, oidc_subject, daily_send_limit, disabled, created_at, updated_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (WalletUser, error) {
+	var u WalletUser
+	var limit sql.NullInt64
+	err := row.Scan(&u.Username, &u.Wallet, &u.passwordHash, &u.OIDCSubject, &limit, &u.Disabled, &u.CreatedAt, &u.UpdatedAt)
+	if limit.Valid {
+		amount := rpc.Amount(limit.Int64)
+		u.DailySendLimit = &amount
+	}
+	return u, err
+}
+
+// Users returns every registered user ordered by name
+func (s *Store) Users() ([]WalletUser, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []WalletUser{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// User returns the user called username, or nil if there is none
+func (s *Store) User(username string) (*WalletUser, error) {
+	u, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UserByOIDCSubject returns the user who logs in as subject, or nil if
+// there is none
+func (s *Store) UserByOIDCSubject(subject string) (*WalletUser, error) {
+	if subject == "" {
+		return nil, nil
+	}
+	u, err := scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE oidc_subject = ?`, subject))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// SaveUser stores u, replacing any user of the same name. The wallet and
+// creation time of an existing user are kept.
+func (s *Store) SaveUser(u WalletUser) error {
+	var limit sql.NullInt64
+	if u.DailySendLimit != nil {
+		limit = sql.NullInt64{Int64: int64(*u.DailySendLimit), Valid: true}
+	}
+	_, err := s.db.Exec(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET password_hash = excluded.password_hash,
+		oidc_subject = excluded.oidc_subject, daily_send_limit = excluded.daily_send_limit,
+		disabled = excluded.disabled, updated_at = excluded.updated_at`,
+		u.Username, u.Wallet, u.passwordHash, u.OIDCSubject, limit, u.Disabled, u.CreatedAt, u.UpdatedAt)
+	return err
+}
+
+// ownedData deletes what a user kept in the store, children first
+var ownedData = []string{
+	`DELETE FROM contact_addresses WHERE owner = ?`,
+	`DELETE FROM contacts WHERE owner = ?`,
+	`DELETE FROM transaction_tags WHERE owner = ?`,
+	`DELETE FROM transaction_metadata WHERE owner = ?`,
+	`DELETE FROM tx_watches WHERE owner = ?`,
+	`DELETE FROM notification_reads WHERE notification_id IN (SELECT id FROM notifications WHERE owner = ?)`,
+	`DELETE FROM notifications WHERE owner = ?`,
+	`DELETE FROM send_rules WHERE owner = ?`,
+	`DELETE FROM checkouts WHERE owner = ?`,
+	`DELETE FROM user_sends WHERE username = ?`,
+}
+
+// DeleteUser removes a user with their send history and everything else
+// they kept in the store, so a later user of the same name starts empty.
+// It reports whether the user existed.
+func (s *Store) DeleteUser(username string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, query := range ownedData {
+		if _, err := tx.Exec(query, username); err != nil {
+			return false, err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM users WHERE username = ?`, username)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+// RecordUserSend counts a send against the user's daily send limit
+func (s *Store) RecordUserSend(username, txid string, amount rpc.Amount, sentAt int64) error {
+	_, err := s.db.Exec(`INSERT INTO user_sends (username, txid, amount, sent_at) VALUES (?, ?, ?, ?)`,
+		username, txid, amount, sentAt)
+	return err
+}
+
+// UserSentSince sums what the user has sent since the Unix time since
+func (s *Store) UserSentSince(username string, since int64) (rpc.Amount, error) {
+	var sent rpc.Amount
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM user_sends WHERE username = ? AND sent_at >= ?`,
+		username, since).Scan(&sent)
+	return sent, err
+}
+
+// tenants is the multi-user state the store doesn't hold
+type tenants struct {
+	cfg MultiUserConfig
+
+	mu sync.Mutex
+	// clients are the node clients of the users' wallets, by wallet name,
+	// so each keeps its balance cache between requests
+	clients map[string]rpc.WalletBackend
+	// verified remembers the SHA-256 of each user's last good password, so
+	// bcrypt runs once per login rather than once per request
+	verified map[string][32]byte
+
+	// sendMu serializes users' sends so two can't both pass a limit check
+	sendMu sync.Mutex
+}
+
+func newTenants(cfg MultiUserConfig) *tenants {
+	return &tenants{
+		cfg:      cfg,
+		clients:  map[string]rpc.WalletBackend{},
+		verified: map[string][32]byte{},
+	}
+}
+
+// client returns the client for wallet, made from base
+func (t *tenants) client(base rpc.WalletBackend, wallet string) rpc.WalletBackend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.clients[wallet]
+	if !ok {
+		c = base.ForWallet(wallet)
+		t.clients[wallet] = c
+	}
+	return c
+}
+
+// checkPassword reports whether password is u's
+func (t *tenants) checkPassword(u *WalletUser, password string) bool {
+	sum := sha256.Sum256([]byte(password))
+	t.mu.Lock()
+	known, ok := t.verified[u.Username]
+	t.mu.Unlock()
+	if ok && subtle.ConstantTimeCompare(known[:], sum[:]) == 1 {
+		return true
+	}
+
+	if u.passwordHash == "" || bcrypt.CompareHashAndPassword([]byte(u.passwordHash), []byte(password)) != nil {
+		return false
+	}
+	t.mu.Lock()
+	t.verified[u.Username] = sum
+	t.mu.Unlock()
+	return true
+}
+
+// forget drops what is remembered about a changed or deleted user
+func (t *tenants) forget(u *WalletUser) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.verified, u.Username)
+	delete(t.clients, u.Wallet)
+}
+
+type walletUserKey struct{}
+
+// requestWalletUser returns the registered user making r, or nil for the
+// admin and in single-user mode
+func requestWalletUser(r *http.Request) *WalletUser {
+	u, _ := r.Context().Value(walletUserKey{}).(*WalletUser)
+	return u
+}
+
+// walletOwner names whose store data r works on: the registered user
+// making it, or "" for the admin and in single-user mode
+func walletOwner(r *http.Request) string {
+	if u := requestWalletUser(r); u != nil {
+		return u.Username
+	}
+	return ""
+}
+
+// ownerWallet returns the client and user for owner's wallet, for work
+// done outside a request; the user is nil for the admin's default wallet.
+// A deleted or disabled user has none.
+func (ws *WalletServer) ownerWallet(owner string) (rpc.WalletBackend, *WalletUser, error) {
+	if owner == "" {
+		return ws.rpcClient, nil, nil
+	}
+	if ws.tenants == nil {
+		return nil, nil, fmt.Errorf("user %s: multi-user mode is off", owner)
+	}
+	user, err := ws.store.User(owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, nil, fmt.Errorf("user %s is deleted or disabled", owner)
+	}
+	return ws.tenants.client(ws.rpcClient, user.Wallet), user, nil
+}
+
+// withTenants works out who makes each request in multi-user mode. Without
+// OIDC, the auth credentials are the admin's and registered users log in
+// with their own through basic auth; with OIDC, which has checked the
+// session already, admins are admins and everyone else needs a registered
+// user with their subject. Registered users are refused the node-wide
+// endpoints.
+func (ws *WalletServer) withTenants(auth AuthConfig, next http.Handler) http.Handler {
+	wantUser := sha256.Sum256([]byte(auth.Username))
+	wantPass := sha256.Sum256([]byte(auth.Password))
+
+	refuse := func(w http.ResponseWriter, status int, message string) {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Kernelcoin Web Wallet", charset="UTF-8"`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": message})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) || strings.HasPrefix(r.URL.Path, "/auth/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var user *WalletUser
+		var err error
+		if ws.oidc != nil {
+			session, ok := ws.oidc.session(r)
+			if !ok || session.Role == RoleAdmin {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if user, err = ws.store.UserByOIDCSubject(session.Subject); err == nil && user == nil {
+				// The page loads; its API calls explain
+				if !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/ws" {
+					next.ServeHTTP(w, r)
+					return
+				}
+				logRequest(r, "[AUTH] WARNING: no wallet registered for %s", session.Subject)
+				refuse(w, http.StatusForbidden, "No wallet is registered for this login")
+				return
+			}
+		} else {
+			name, pass, ok := r.BasicAuth()
+			gotUser := sha256.Sum256([]byte(name))
+			gotPass := sha256.Sum256([]byte(pass))
+			if ok && subtle.ConstantTimeCompare(gotUser[:], wantUser[:]) == 1 &&
+				subtle.ConstantTimeCompare(gotPass[:], wantPass[:]) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ok {
+				user, err = ws.store.User(name)
+			}
+			if err == nil && (user == nil || !ws.tenants.checkPassword(user, pass)) {
+				logRequest(r, "[AUTH] WARNING: rejected request from %s for %s", r.RemoteAddr, r.URL.Path)
+				refuse(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+		}
+		if err != nil {
+			logRequest(r, "[AUTH] ERROR: looking up user: %v", err)
+			refuse(w, http.StatusInternalServerError, "Failed to look up user")
+			return
+		}
+
+		if user.Disabled {
+			logRequest(r, "[AUTH] WARNING: refused %s %s for disabled user %s", r.Method, r.URL.Path, user.Username)
+			refuse(w, http.StatusForbidden, "This account is disabled")
+			return
+		}
+		if isNodeWide(r.URL.Path) {
+			logRequest(r, "[AUTH] WARNING: refused %s %s for user %s", r.Method, r.URL.Path, user.Username)
+			refuse(w, http.StatusForbidden, "Only the administrator can use this endpoint")
+			return
+		}
+		// Signing a PSBT spends without an amount to check
+		if user.DailySendLimit != nil && r.URL.Path == "/api/psbt/process" {
+			refuse(w, http.StatusForbidden, "PSBT signing is not available to accounts with a send limit")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), walletUserKey{}, user)))
+	})
+}
+
+// sendWithinLimit runs send, which spends amount from r's wallet, and
+// counts the send against the daily send limit of r's user
+func (ws *WalletServer) sendWithinLimit(r *http.Request, amount rpc.Amount, send func() (string, error)) (string, error) {
+	return ws.sendWithinUserLimit(requestWalletUser(r), amount, send)
+}
+
+// sendWithinUserLimit runs send, which spends amount from user's wallet,
+// and counts the send against user's daily send limit. A send that would
+// go over the limit is refused with errSendLimit. A nil user is the admin,
+// who has no limit.
+func (ws *WalletServer) sendWithinUserLimit(user *WalletUser, amount rpc.Amount, send func() (string, error)) (string, error) {
+	if user == nil {
+		return send()
+	}
+
+	ws.tenants.sendMu.Lock()
+	defer ws.tenants.sendMu.Unlock()
+	if user.DailySendLimit != nil {
+		sent, err := ws.store.UserSentSince(user.Username, time.Now().Add(-sendLimitWindow).Unix())
+		if err != nil {
+			return "", fmt.Errorf("failed to check the send limit: %w", err)
+		}
+		if sent+amount > *user.DailySendLimit {
+			return "", fmt.Errorf("%w: %s of %s KCN sent in the last 24 hours", errSendLimit, sent, *user.DailySendLimit)
+		}
+	}
+
+	txid, err := send()
+	if err != nil {
+		return "", err
+	}
+	if err := ws.store.RecordUserSend(user.Username, txid, amount, time.Now().Unix()); err != nil {
+		log.Printf("[USERS] ERROR: send %s not counted for %s: %v", txid, user.Username, err)
+	}
+	return txid, nil
+}
+
+// loadUserWallets has the node load every registered user's wallet, which
+// it may not after a restart
+func (ws *WalletServer) loadUserWallets() {
+	users, err := ws.store.Users()
+	if err != nil {
+		log.Printf("[USERS] ERROR: Could not list users: %v", err)
+		return
+	}
+	for _, u := range users {
+		if err := ws.rpcClient.LoadWallet(u.Wallet); err != nil {
+			log.Printf("[USERS] WARNING: Could not load wallet %s of %s: %v", u.Wallet, u.Username, err)
+		}
+	}
+	log.Printf("[USERS] Multi-user mode: %d users", len(users))
+}
+
+// withSentTotal fills in u.SentLast24h
+func (ws *WalletServer) withSentTotal(u WalletUser) WalletUser {
+	sent, err := ws.store.UserSentSince(u.Username, time.Now().Add(-sendLimitWindow).Unix())
+	if err != nil {
+		log.Printf("[USERS] WARNING: Could not sum sends of %s: %v", u.Username, err)
+	}
+	u.SentLast24h = sent
+	return u
+}
+
+// HandleAccount returns the user making the request, or that it is the
+// admin
+func (ws *WalletServer) HandleAccount(w http.ResponseWriter, r *http.Request) {
+	response := AccountResponse{Success: true, Admin: true}
+	if user := requestWalletUser(r); user != nil {
+		u := ws.withSentTotal(*user)
+		response = AccountResponse{Success: true, User: &u}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleUsers lists (GET) or registers (POST) users. Registering creates
+// the user's node wallet; when one of that name already exists it answers
+// 409 unless the request sets adopt_wallet.
+func (ws *WalletServer) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := ws.store.Users()
+		if err != nil {
+			logRequest(r, "[API] Users ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(UsersListResponse{
+				Success: false,
+				Error:   "Failed to load users",
+			})
+			return
+		}
+		for i := range users {
+			users[i] = ws.withSentTotal(users[i])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UsersListResponse{
+			Success: true,
+			Users:   users,
+		})
+
+	case http.MethodPost:
+		now := time.Now().Unix()
+		ws.saveUser(w, r, WalletUser{CreatedAt: now}, true)
+	}
+}
+
+// HandleUser handles /api/admin/users/{username}: GET, PUT (replace) and
+// DELETE. Deleting drops the user's store data and unloads their node
+// wallet, but leaves its files on the node.
+func (ws *WalletServer) HandleUser(w http.ResponseWriter, r *http.Request) {
+	username := pathParam(r, "username")
+	user, err := ws.store.User(username)
+	if err != nil || user == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(UserResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		u := ws.withSentTotal(*user)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UserResponse{
+			Success: true,
+			User:    &u,
+		})
+
+	case http.MethodPut:
+		ws.saveUser(w, r, *user, false)
+
+	case http.MethodDelete:
+		if _, err := ws.store.DeleteUser(username); err != nil {
+			logRequest(r, "[API] DeleteUser ERROR: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(UserResponse{
+				Success: false,
+				Error:   "Failed to delete user",
+			})
+			return
+		}
+		ws.tenants.forget(user)
+		ws.paymentWatches.DeleteOwner(username)
+		if err := ws.rpc(r).UnloadWallet(user.Wallet); err != nil {
+			logRequest(r, "[API] DeleteUser WARNING: wallet %s not unloaded: %v", user.Wallet, err)
+		}
+
+		logRequest(r, "[AUDIT] DeleteUser SUCCESS: %s (wallet %s kept on the node)", username, user.Wallet)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UserResponse{Success: true})
+	}
+}
+
+// validateUser checks a user request, returning a message for the client
+// or "" when it is acceptable
+func (ws *WalletServer) validateUser(req *UserRequest, create bool) string {
+	req.Username = strings.TrimSpace(req.Username)
+	req.OIDCSubject = strings.TrimSpace(req.OIDCSubject)
+	if create && !usernamePattern.MatchString(req.Username) {
+		return "Username must be 1-32 lowercase letters, digits, '.', '_' or '-'"
+	}
+	if ws.oidc != nil {
+		if req.Password != "" {
+			return "Users log in through OIDC and have no password"
+		}
+		if req.OIDCSubject == "" {
+			return "oidc_subject is required: users log in through OIDC"
+		}
+	} else {
+		if req.OIDCSubject != "" {
+			return "oidc_subject needs OIDC login to be configured"
+		}
+		if create && req.Password == "" {
+			return "Password is required"
+		}
+		if req.Password != "" && (len(req.Password) < 8 || len(req.Password) > 72) {
+			return "Password must be 8 to 72 bytes long"
+		}
+	}
+	if req.DailySendLimit != nil && *req.DailySendLimit <= 0 {
+		return "daily_send_limit must be a positive KCN amount"
+	}
+	return ""
+}
+
+// saveUser validates the request body and stores it over user, creating
+// the node wallet first when create is set
+func (ws *WalletServer) saveUser(w http.ResponseWriter, r *http.Request, user WalletUser, create bool) {
+	fail := func(status int, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(UserResponse{
+			Success: false,
+			Error:   message,
+		})
+	}
+
+	var req UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(http.StatusBadRequest, "Invalid request format")
+		return
+	}
+	if validationErr := ws.validateUser(&req, create); validationErr != "" {
+		fail(http.StatusBadRequest, validationErr)
+		return
+	}
+
+	if create {
+		user.Username = req.Username
+		user.Wallet = ws.tenants.cfg.WalletPrefix + req.Username
+		if existing, err := ws.store.User(user.Username); err != nil || existing != nil {
+			fail(http.StatusConflict, "A user with that name already exists")
+			return
+		}
+	}
+	if req.OIDCSubject != "" {
+		if owner, err := ws.store.UserByOIDCSubject(req.OIDCSubject); err != nil || (owner != nil && owner.Username != user.Username) {
+			fail(http.StatusConflict, "Another user has that OIDC subject")
+			return
+		}
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logRequest(r, "[API] SaveUser ERROR: %v", err)
+			fail(http.StatusInternalServerError, "Failed to save user")
+			return
+		}
+		user.passwordHash = string(hash)
+	}
+	user.OIDCSubject = req.OIDCSubject
+	user.DailySendLimit = req.DailySendLimit
+	user.Disabled = req.Disabled
+	user.UpdatedAt = time.Now().Unix()
+
+	if create {
+		err := ws.rpc(r).CreateWallet(user.Wallet)
+		if err != nil && strings.Contains(err.Error(), "already exists") {
+			if !req.AdoptWallet {
+				logRequest(r, "[API] SaveUser ERROR: wallet %s already exists", user.Wallet)
+				fail(http.StatusConflict, fmt.Sprintf("Node wallet %s already exists; set adopt_wallet to give it to this user", user.Wallet))
+				return
+			}
+			if err = ws.rpc(r).LoadWallet(user.Wallet); err == nil {
+				logRequest(r, "[AUDIT] SaveUser: %s adopts existing wallet %s", user.Username, user.Wallet)
+			}
+		}
+		if err != nil {
+			logRequest(r, "[API] SaveUser ERROR: wallet %s: %v", user.Wallet, err)
+			fail(http.StatusBadGateway, fmt.Sprintf("Failed to create the node wallet: %v", err))
+			return
+		}
+	}
+
+	if err := ws.store.SaveUser(user); err != nil {
+		logRequest(r, "[API] SaveUser ERROR: %v", err)
+		fail(http.StatusInternalServerError, "Failed to save user")
+		return
+	}
+	ws.tenants.forget(&user)
+
+	logRequest(r, "[AUDIT] SaveUser SUCCESS: %s (wallet %s, disabled=%v)", user.Username, user.Wallet, user.Disabled)
+	u := ws.withSentTotal(user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserResponse{
+		Success: true,
+		User:    &u,
+	})
+}
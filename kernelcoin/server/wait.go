@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultWaitTimeout = 25 * time.Second
+	maxWaitTimeout     = 55 * time.Second
+)
+
+// waitWakers are the events that end a wait: the ones that change what a
+// wallet UI shows
+var waitWakers = map[string]bool{
+	EventBlockConnected: true,
+	EventTransaction:    true,
+	EventConfirmation:   true,
+	EventBalance:        true,
+	EventTxReorged:      true,
+	EventTxConflicted:   true,
+}
+
+type WaitResponse struct {
+	Success bool          `json:"success"`
+	Cursor  string        `json:"cursor,omitempty"` // for the next ?since=
+	Events  []WalletEvent `json:"events"`
+	// Reset means since was from before a restart or too old to catch up
+	// from; reload everything, then wait from Cursor
+	Reset bool   `json:"reset,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// HandleWait long-polls for wallet changes, for clients that can't keep a
+// WebSocket or event stream open. Without ?since= it returns the current
+// cursor at once. With one, it returns every event since then as soon as
+// a new block or wallet transaction arrives, or no events after ?timeout=
+// (25s by default, at most 55s). Only events about the requester's wallet,
+// or the node, are returned.
+func (ws *WalletServer) HandleWait(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultWaitTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil || d <= 0 || d > maxWaitTimeout {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(WaitResponse{
+				Success: false,
+				Error:   fmt.Sprintf("timeout must be a duration up to %s, e.g. 25s", maxWaitTimeout),
+			})
+			return
+		}
+		timeout = d
+	}
+
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		ws.events.waited.Store(time.Now().Unix())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(WaitResponse{Success: true, Cursor: ws.events.Cursor(), Events: []WalletEvent{}})
+		return
+	}
+
+	// Subscribed before looking, so nothing slips in between
+	owner := walletOwner(r)
+	events := ws.events.SubscribeFor(owner)
+	defer ws.events.Unsubscribe(events)
+	defer ws.events.waited.Store(time.Now().Unix())
+
+	// The wait may outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		missed, cursor, ok := ws.events.Since(since, owner)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(WaitResponse{Success: true, Cursor: cursor, Events: []WalletEvent{}, Reset: true})
+			return
+		}
+		for _, ev := range missed {
+			if waitWakers[ev.Type] {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(WaitResponse{Success: true, Cursor: cursor, Events: missed})
+				return
+			}
+		}
+
+		select {
+		case <-events:
+		case <-timer.C:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(WaitResponse{Success: true, Cursor: cursor, Events: missed})
+			return
+		case <-r.Context().Done():
+			return
+		case <-ws.events.Done():
+			return
+		}
+	}
+}
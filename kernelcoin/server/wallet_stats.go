@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"kernelcoin-wallet/kernelcoin/hdwallet"
+	"kernelcoin-wallet/kernelcoin/rpc"
+)
+
+type WalletStatsResponse struct {
+	Success      bool       `json:"success"`
+	UTXOCount    int        `json:"utxo_count"`
+	DustCount    int        `json:"dust_count"` // below the dust threshold
+	TotalValue   rpc.Amount `json:"total_value"`
+	AverageUTXO  rpc.Amount `json:"average_utxo"`
+	MedianUTXO   rpc.Amount `json:"median_utxo"`
+	SmallestUTXO rpc.Amount `json:"smallest_utxo"`
+	LargestUTXO  rpc.Amount `json:"largest_utxo"`
+
+	// UneconomicalCount is how many outputs would cost more in fees to spend
+	// than they are worth at FeeRate (sat/vB, the 6-block estimate)
+	UneconomicalCount int     `json:"uneconomical_count"`
+	FeeRate           float64 `json:"fee_rate,omitempty"`
+
+	// TotalFeesPaid sums the fees of every send, once per transaction
+	TotalFeesPaid rpc.Amount `json:"total_fees_paid"`
+	SendCount     int        `json:"send_count"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// HandleWalletStats summarizes the wallet's UTXO set and historical fees
+func (ws *WalletServer) HandleWalletStats(w http.ResponseWriter, r *http.Request) {
+	utxos, err := ws.rpc(r).ListUnspent(0)
+	if err != nil {
+		logRequest(r, "[API] WalletStats ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(WalletStatsResponse{
+			Success: false,
+			Error:   "Failed to list unspent outputs",
+		})
+		return
+	}
+
+	stats := WalletStatsResponse{Success: true, UTXOCount: len(utxos)}
+
+	// KCN/kvB to sat/vB; zero when the node has no estimate
+	if estimate, err := ws.rpc(r).EstimateSmartFee(6); err == nil && estimate > 0 {
+		stats.FeeRate = estimate * rpc.KernelsPerKCN / 1000
+	}
+
+	values := make([]rpc.Amount, 0, len(utxos))
+	for _, utxo := range utxos {
+		values = append(values, utxo.Amount)
+		stats.TotalValue += utxo.Amount
+		if utxo.Amount < hdwallet.DustThreshold {
+			stats.DustCount++
+		}
+		if stats.FeeRate > 0 {
+			script, _ := hex.DecodeString(utxo.ScriptPubKey)
+			if size, err := hdwallet.InputVSize(script); err == nil && float64(utxo.Amount) <= float64(size)*stats.FeeRate {
+				stats.UneconomicalCount++
+			}
+		}
+	}
+
+	if len(values) > 0 {
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		stats.SmallestUTXO = values[0]
+		stats.LargestUTXO = values[len(values)-1]
+		stats.AverageUTXO = stats.TotalValue / rpc.Amount(len(values))
+		mid := len(values) / 2
+		if len(values)%2 == 1 {
+			stats.MedianUTXO = values[mid]
+		} else {
+			stats.MedianUTXO = (values[mid-1] + values[mid]) / 2
+		}
+	}
+
+	sends, _, err := ws.filteredTransactions(ws.rpc(r), TransactionFilter{Categories: map[string]bool{"send": true}}, PageParams{Count: maxTransactionScan})
+	if err != nil {
+		logRequest(r, "[API] WalletStats ERROR: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(WalletStatsResponse{
+			Success: false,
+			Error:   "Failed to list transactions",
+		})
+		return
+	}
+
+	// A send lists once per output, each carrying the whole fee
+	counted := map[string]bool{}
+	for _, tx := range sends {
+		if counted[tx.Txid] || tx.Abandoned || tx.Conflicted {
+			continue
+		}
+		counted[tx.Txid] = true
+		stats.TotalFeesPaid += tx.Fee.Abs()
+		stats.SendCount++
+	}
+
+	logRequest(r, "[API] WalletStats SUCCESS: %d UTXOs (%d dust), %s KCN fees over %d sends",
+		stats.UTXOCount, stats.DustCount, stats.TotalFeesPaid, stats.SendCount)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// HandleWebSocket upgrades /ws and pushes WalletEvents as JSON text messages.
+// The current balance is sent on connect; after that only changes are sent,
+// to the requester's wallet or the node.
+func (ws *WalletServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler:   ws.serveWebSocket,
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkSameOrigin refuses cross-site WebSocket connections; browsers attach
+// cookies and basic auth to them just like same-site ones
+func checkSameOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	if err != nil || origin.Host != r.Host {
+		return fmt.Errorf("cross-origin WebSocket from %q refused", r.Header.Get("Origin"))
+	}
+	config.Origin = origin
+	return nil
+}
+
+func (ws *WalletServer) serveWebSocket(conn *websocket.Conn) {
+	defer conn.Close()
+
+	// Drop the deadlines the HTTP server's timeouts left on the connection
+	conn.SetDeadline(time.Time{})
+
+	r := conn.Request()
+	events := ws.events.SubscribeFor(walletOwner(r))
+	defer ws.events.Unsubscribe(events)
+
+	// Clients don't send anything; reading just notices when they go away
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	if info, err := ws.rpc(r).GetBalanceInfo(""); err == nil {
+		hello := WalletEvent{Type: EventBalance, Data: balanceResponse(info)}
+		if err := websocket.JSON.Send(conn, hello); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case ev := <-events:
+			if err := websocket.JSON.Send(conn, ev); err != nil {
+				log.Printf("[API] WebSocket closed: %v", err)
+				return
+			}
+		case <-closed:
+			return
+		case <-ws.events.Done():
+			return
+		}
+	}
+}